@@ -0,0 +1,133 @@
+// Package main provides the entry point for importing pipeline output into Dgraph.
+// It applies the generated schema and loads the RDF data through the configured transport.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func main() {
+	// Parse command line arguments
+	var (
+		configPath  = flag.String("config", "config/config.yaml", "Path to YAML configuration file (defaults apply when the default path is missing)")
+		transport   = flag.String("transport", "", "Dgraph transport: http or grpc (empty = use config)")
+		alpha       = flag.String("alpha", "", "Dgraph Alpha HTTP endpoint, or comma-separated gRPC endpoints with -transport grpc (empty = use config)")
+		schemaFile  = flag.String("schema", "", "Schema file to apply (empty = output.schema_file in the data directory)")
+		files       = flag.String("files", "", "Comma-separated files or globs to import, by extension: .rdf, .nq, .nquad, .nquads, .json, optionally .gz (empty = pipeline output)")
+		dataDir     = flag.String("data-dir", "", "Directory holding the pipeline output (empty = use config)")
+		skipSchema  = flag.Bool("skip-schema", false, "Load data without applying the schema")
+		mode        = flag.String("mode", "", "Mutation mode: set or upsert (empty = use config)")
+		parallel    = flag.Int("parallel", 0, "Batches to commit concurrently (0 = use config)")
+		ordered     = flag.Bool("ordered", false, "Commit batches one at a time, in file order")
+		verify      = flag.Bool("verify", false, "Count the imported nodes of each schema type afterwards")
+		checksums   = flag.Bool("verify-checksums", false, "Check the files against output.manifest_file before loading")
+		retryFailed = flag.Bool("retry-failed", false, "Re-send only the batches listed in output.failed_batches_file")
+	)
+	flag.Parse()
+
+	// A config file named on the command line must exist; only the default
+	// path may be missing
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			return
+		}
+		if _, err := os.Stat(*configPath); err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+	})
+
+	// Load and validate configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Override configuration with command line flags
+	if *transport != "" {
+		cfg.Dgraph.Transport = *transport
+	}
+	if *alpha != "" && cfg.Dgraph.Transport == "grpc" {
+		cfg.Dgraph.Alpha = strings.Split(*alpha, ",")
+	} else if *alpha != "" {
+		cfg.Dgraph.HTTPAlpha = *alpha
+	}
+	if *files != "" {
+		cfg.Dgraph.ImportFiles = strings.Split(*files, ",")
+	}
+	if *dataDir != "" {
+		cfg.Output.Directory = *dataDir
+	}
+	if *schemaFile != "" {
+		path, err := filepath.Abs(*schemaFile)
+		if err != nil {
+			log.Fatalf("Invalid schema path: %v", err)
+		}
+		cfg.Output.SchemaFile = path
+	}
+	if *mode != "" {
+		cfg.Dgraph.ImportMode = *mode
+	}
+	if *parallel > 0 {
+		cfg.Dgraph.Parallel = *parallel
+	}
+	if *ordered {
+		cfg.Dgraph.Parallel = 1
+	}
+	if *checksums {
+		cfg.Dgraph.VerifyChecksums = true
+	}
+	// The flags may break what the file alone passed
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	logger, err := logger.NewWithOutput(cfg.Logger.Level, cfg.Logger.Format,
+		cfg.Logger.Output, cfg.Logger.MaxSizeMB, cfg.Logger.MaxBackups)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
+	logger.Info("Starting Dgraph import",
+		"config", *configPath,
+		"transport", cfg.Dgraph.Transport,
+		"alpha", cfg.Dgraph.Endpoint(),
+		"batch_size", cfg.Dgraph.BatchSize,
+		"parallel", cfg.Dgraph.Parallel,
+		"mode", cfg.Dgraph.ImportMode)
+
+	im, err := importer.New(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize importer", "error", err)
+	}
+	defer im.Close()
+
+	// Setup graceful shutdown handling
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if *retryFailed {
+		_, err = im.RetryFailed(ctx)
+	} else {
+		_, err = im.Run(ctx, *skipSchema)
+	}
+	if err != nil {
+		logger.FatalWithCleanup(func() { im.Close() }, "Import failed", "error", err)
+	}
+
+	if *verify {
+		if _, err := im.Verify(ctx); err != nil {
+			logger.FatalWithCleanup(func() { im.Close() }, "Import verification failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs main itself when the test binary is started by runImporter
+func TestMain(m *testing.M) {
+	if args := os.Getenv("IMPORTER_TEST_MAIN_ARGS"); args != "" {
+		os.Args = append([]string{"importer"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runImporter runs main in dir with args and no standard input, and returns
+// its combined output and whether it succeeded. A prompt would leave it
+// waiting until the deadline.
+func runImporter(t *testing.T, dir string, args ...string) (string, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "DGRAPH_ALPHA=", "OUTPUT_DIR=", "IMPORTER_TEST_MAIN_ARGS="+strings.Join(args, "\n"))
+	cmd.Stdin = nil
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("importer %v did not finish: %s", args, out)
+	}
+	return string(out), err == nil
+}
+
+// alphaRequest is a request received by the test alpha
+type alphaRequest struct {
+	path, body string
+}
+
+func TestFlagsWithoutConfig(t *testing.T) {
+	var mu sync.Mutex
+	var requests []alphaRequest
+	alpha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, alphaRequest{path: r.URL.Path, body: string(body)})
+		mu.Unlock()
+		io.WriteString(w, `{"data": {"code": "Success", "uids": {}}}`)
+	}))
+	defer alpha.Close()
+
+	// No config/config.yaml in the working directory
+	workDir := t.TempDir()
+	dataDir := t.TempDir()
+	writeFile(t, filepath.Join(dataDir, "data.rdf"), "_:users_1 <users.name> \"Ada\" .\n")
+	schemaPath := filepath.Join(t.TempDir(), "custom.dql")
+	writeFile(t, schemaPath, "users.name: string .\ntype users {\n  users.name\n}\n")
+	dumpDir := t.TempDir()
+	writeFile(t, filepath.Join(dumpDir, "dump.nq"), "_:users_1 <users.name> \"Ada\" .\n")
+
+	tests := []struct {
+		name     string
+		args     []string
+		ok       bool
+		output   string   // Part of the output
+		requests []string // Paths requested from the alpha
+	}{
+		{
+			name:     "flags only",
+			args:     []string{"-alpha", alpha.URL, "-data-dir", dataDir, "-schema", schemaPath},
+			ok:       true,
+			requests: []string{"/alter", "/mutate"},
+		},
+		{
+			name:     "skip schema",
+			args:     []string{"-alpha", alpha.URL, "-data-dir", dataDir, "-skip-schema"},
+			ok:       true,
+			requests: []string{"/mutate"},
+		},
+		{
+			name:     "files",
+			args:     []string{"-alpha", alpha.URL, "-files", filepath.Join(dumpDir, "*.nq"), "-skip-schema"},
+			ok:       true,
+			requests: []string{"/mutate"},
+		},
+		{
+			name:   "missing config file",
+			args:   []string{"-config", filepath.Join(workDir, "missing.yaml"), "-alpha", alpha.URL, "-data-dir", dataDir},
+			output: "Failed to load configuration",
+		},
+		{
+			name:   "invalid transport flag",
+			args:   []string{"-transport", "tcp", "-alpha", alpha.URL, "-data-dir", dataDir},
+			output: "Invalid configuration: dgraph transport must be http or grpc",
+		},
+		{
+			name:   "invalid mode flag",
+			args:   []string{"-mode", "merge", "-alpha", alpha.URL, "-data-dir", dataDir},
+			output: "Invalid configuration",
+		},
+		{
+			name:   "missing data",
+			args:   []string{"-alpha", alpha.URL, "-data-dir", t.TempDir(), "-skip-schema"},
+			output: "Import failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			out, ok := runImporter(t, workDir, tt.args...)
+			if ok != tt.ok {
+				t.Fatalf("importer succeeded: %v, want %v\n%s", ok, tt.ok, out)
+			}
+			if !strings.Contains(out, tt.output) {
+				t.Errorf("output lacks %q:\n%s", tt.output, out)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			var paths []string
+			for _, r := range requests {
+				paths = append(paths, r.path)
+				if r.path == "/alter" && !strings.Contains(r.body, "type users") {
+					t.Errorf("applied schema %q, want the -schema file", r.body)
+				}
+				if r.path == "/mutate" && !strings.Contains(r.body, `<users.name> "Ada"`) {
+					t.Errorf("mutation %q lacks the data file's triple", r.body)
+				}
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.requests, ",") {
+				t.Errorf("requests %v, want %v", paths, tt.requests)
+			}
+		})
+	}
+}
+
+// writeFile writes content to path
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,31 +4,46 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
-	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/pipeline"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/pipeline"
+	"gopkg.in/yaml.v2"
 )
 
 func main() {
 	// Parse command line arguments
 	var (
-		configPath = flag.String("config", "config/config.yaml", "Path to YAML configuration file")
-		mode       = flag.String("mode", "full", "Pipeline execution mode: schema, data, full, validate")
-		dryRun     = flag.Bool("dry-run", false, "Preview mode - analyze without writing data")
-		tables     = flag.String("tables", "", "Specific tables to process (comma-separated, empty = all)")
-		parallel   = flag.Int("parallel", 4, "Number of parallel worker threads")
-		batchSize  = flag.Int("batch-size", 1000, "Records per batch for processing")
+		configPath  = flag.String("config", "config/config.yaml", "Path to YAML configuration file")
+		mode        = flag.String("mode", "full", "Pipeline execution mode: schema, data, full, validate, validate-rdf, relationships-observed, schema-diff, analyze, discover-relationships, preflight")
+		dryRun      = flag.Bool("dry-run", false, "Preview mode - analyze without writing data")
+		resume      = flag.Bool("resume", false, "Continue an interrupted data export from its checkpoint")
+		tables      = flag.String("tables", "", "Specific tables to process (comma-separated, empty = all)")
+		parallel    = flag.Int("parallel", 4, "Number of parallel worker threads")
+		batchSize   = flag.Int("batch-size", 1000, "Records per batch for processing")
+		chunkSize   = flag.Int64("chunk-size", 0, "Records per data_chunk_N.rdf file (0 = use configuration)")
+		format      = flag.String("format", "", "Data output format: rdf (default) or json batch files")
+		target      = flag.String("target", "", "Data destination: file (default) or dgraph for direct mutations")
+		graphQL     = flag.Bool("graphql", false, "Also generate a Dgraph GraphQL schema next to the DQL schema")
+		printConfig = flag.Bool("print-config", false, "Print the effective configuration (secrets redacted) and exit")
+		progress    = flag.Duration("progress-interval", 0, "Progress report interval, e.g. 10s (0 = use configuration)")
+		quiet       = flag.Bool("quiet", false, "Suppress progress reports")
+		verifyConn  = flag.Bool("verify-connection", false, "Run the preflight checks and exit (same as -mode preflight)")
 	)
 	flag.Parse()
+	if *verifyConn {
+		*mode = "preflight"
+	}
 
 	// Load and validate configuration
-	cfg, err := config.Load(*configPath)
+	cfg, err := pipeline.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -40,16 +55,78 @@ func main() {
 	if *batchSize > 0 {
 		cfg.Pipeline.BatchSize = *batchSize
 	}
-	cfg.Pipeline.DryRun = *dryRun
+	if *dryRun {
+		cfg.Pipeline.DryRun = true
+	}
+	if *resume {
+		cfg.Pipeline.Resume = true
+	}
+	if *chunkSize > 0 {
+		cfg.Output.ChunkSize = *chunkSize
+	}
+	if *format != "" {
+		cfg.Output.Format = *format
+	}
+	if *target != "" {
+		cfg.Output.Target = *target
+	}
+	if *graphQL {
+		cfg.Output.GenerateGraphQL = true
+	}
+	if *progress != 0 {
+		cfg.Pipeline.ProgressReportInterval = *progress
+	}
+	if *quiet {
+		cfg.Pipeline.ProgressReportInterval = 0
+	}
+	// The flags may break what the file alone passed
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Show the resolved configuration without running the pipeline
+	if *printConfig {
+		data, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			log.Fatalf("Failed to encode configuration: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
 
 	// Initialize structured logger
-	logger := logger.New(cfg.Logger.Level, cfg.Logger.Format)
+	logger, err := logger.NewWithOutput(cfg.Logger.Level, cfg.Logger.Format,
+		cfg.Logger.Output, cfg.Logger.MaxSizeMB, cfg.Logger.MaxBackups)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
 	logger.Info("Starting MySQL to Dgraph migration pipeline",
 		"mode", *mode,
 		"config", *configPath,
-		"dry_run", *dryRun,
+		"dry_run", cfg.Pipeline.DryRun,
 		"workers", cfg.Pipeline.Workers,
-		"batch_size", cfg.Pipeline.BatchSize)
+		"batch_size", cfg.Pipeline.BatchSize,
+		"format", cfg.Output.Format)
+
+	// Checking the RDF output against the schema needs neither MySQL nor Dgraph
+	if *mode == "validate-rdf" {
+		if err := pipeline.ValidateRDF(cfg, logger); err != nil {
+			logger.Fatal("RDF validation failed", "error", err)
+		}
+		return
+	}
+
+	// Preflight reports every check, so it connects on its own rather than
+	// stopping at the first failure as pipeline.New would
+	if *mode == "preflight" {
+		report := pipeline.Preflight(context.Background(), cfg, logger)
+		report.WriteText(os.Stdout)
+		if !report.Passed() {
+			logger.Fatal("Preflight checks failed", "failed", report.Failed())
+		}
+		return
+	}
 
 	// Create and initialize the migration pipeline
 	p, err := pipeline.New(cfg, logger)
@@ -67,43 +144,39 @@ func main() {
 		p.Stop()
 	}()
 
-	// Execute pipeline based on selected mode
-	if err := runPipelineMode(p, *mode, *tables, logger); err != nil {
-		logger.Fatal("Pipeline execution failed", "error", err)
+	// Execute pipeline based on selected mode, closing connections and
+	// output before exiting on failure
+	var tableList []string
+	if *tables != "" {
+		tableList = strings.Split(*tables, ",")
 	}
-
-	logger.Info("Pipeline completed successfully")
-}
-
-// runPipelineMode executes the appropriate pipeline operation based on mode
-func runPipelineMode(p *pipeline.Pipeline, mode, tables string, logger *logger.Logger) error {
-	switch mode {
-	case "schema":
-		// Extract MySQL schema and generate Dgraph schema
-		logger.Info("Running schema extraction and generation")
-		if err := p.ExtractSchema(); err != nil {
-			return err
-		}
-		return p.GenerateDgraphSchema()
-
-	case "data":
-		// Migrate data from MySQL to RDF format
-		logger.Info("Running data migration")
-		return p.MigrateData(tables)
-
-	case "full":
-		// Complete pipeline: schema + data + validation
-		logger.Info("Running complete pipeline")
-		return p.RunFull(tables)
-
-	case "validate":
-		// Validate migrated data integrity
-		logger.Info("Running data validation")
-		return p.ValidateData()
-
-	default:
-		logger.Fatal("Invalid pipeline mode", "mode", mode,
-			"valid_modes", []string{"schema", "data", "full", "validate"})
-		return nil
+	result, err := p.Run(context.Background(), *mode, pipeline.RunOptions{Tables: tableList})
+	if err != nil {
+		logger.FatalWithCleanup(p.Stop, "Pipeline execution failed", "error", err)
+	}
+	if result.Analysis != nil {
+		result.Analysis.WriteText(os.Stdout)
 	}
+	if result.Discovery != nil {
+		result.Discovery.WriteText(os.Stdout)
+	}
+	if result.SchemaDiff != nil {
+		result.SchemaDiff.WriteText(os.Stdout)
+	}
+	for _, chunk := range result.Chunks {
+		logger.Info("Chunk written",
+			"chunk", chunk.Index,
+			"file", chunk.Filename,
+			"records", chunk.Records,
+			"size", chunk.Size,
+			"checksum", chunk.Checksum)
+	}
+
+	logger.Info("Pipeline completed successfully",
+		"tables", len(result.Tables),
+		"processed_rows", result.ProcessedRows,
+		"errors", result.Errors,
+		"output_files", strings.Join(result.OutputFiles, ","),
+		"chunks", len(result.Chunks),
+		"elapsed", result.Elapsed.Round(time.Second))
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestMain runs main itself when the test binary is started by runMain
+func TestMain(m *testing.M) {
+	if args := os.Getenv("PIPELINE_TEST_MAIN_ARGS"); args != "" {
+		os.Args = append([]string{"pipeline"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs main with args and extra environment variables and returns
+// its standard output
+func runMain(t *testing.T, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), append(env, "PIPELINE_TEST_MAIN_ARGS="+strings.Join(args, "\n"))...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("main %v: %v\n%s", args, err, stderr.String())
+	}
+	return string(out)
+}
+
+func TestPrintConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+mysql:
+  host: file-host
+  user: exporter
+  password: s3cret
+  database: shop
+pipeline:
+  batch_size: 500
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       []string
+		args      []string
+		host      string
+		database  string
+		batchSize int
+	}{
+		{
+			name:      "the file alone",
+			args:      []string{"-batch-size", "0"},
+			host:      "file-host",
+			database:  "shop",
+			batchSize: 500,
+		},
+		{
+			name:      "the environment overrides the file",
+			env:       []string{"MYSQL_HOST=env-host", "MYSQL_PASSWORD=from-env"},
+			args:      []string{"-batch-size", "0"},
+			host:      "env-host",
+			database:  "shop",
+			batchSize: 500,
+		},
+		{
+			name:      "flags override the environment",
+			env:       []string{"PIPELINE_BATCH_SIZE=700", "MYSQL_DATABASE=env_shop"},
+			args:      []string{"-batch-size", "250"},
+			host:      "file-host",
+			database:  "env_shop",
+			batchSize: 250,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := append([]string{"MYSQL_HOST=", "MYSQL_PASSWORD=", "MYSQL_DATABASE=", "PIPELINE_BATCH_SIZE="}, tt.env...)
+			out := runMain(t, env, append([]string{"-config", path, "-print-config"}, tt.args...)...)
+
+			var printed struct {
+				MySQL struct {
+					Host     string `yaml:"host"`
+					Password string `yaml:"password"`
+					Database string `yaml:"database"`
+				} `yaml:"mysql"`
+				Pipeline struct {
+					BatchSize int `yaml:"batch_size"`
+				} `yaml:"pipeline"`
+			}
+			if err := yaml.Unmarshal([]byte(out), &printed); err != nil {
+				t.Fatalf("printed configuration is not YAML: %v\n%s", err, out)
+			}
+			if printed.MySQL.Host != tt.host || printed.MySQL.Database != tt.database || printed.Pipeline.BatchSize != tt.batchSize {
+				t.Errorf("printed host %q, database %q, batch_size %d; want %q, %q, %d",
+					printed.MySQL.Host, printed.MySQL.Database, printed.Pipeline.BatchSize, tt.host, tt.database, tt.batchSize)
+			}
+			if printed.MySQL.Password != "********" {
+				t.Errorf("printed password %q, want it masked", printed.MySQL.Password)
+			}
+			for _, secret := range []string{"s3cret", "from-env"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("printed configuration contains the password %q", secret)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want time.Duration
+	}{
+		{name: "configuration", want: 30 * time.Second},
+		{name: "interval", args: []string{"-progress-interval", "10s"}, want: 10 * time.Second},
+		{name: "quiet", args: []string{"-quiet"}, want: 0},
+		{name: "quiet wins over an interval", args: []string{"-progress-interval", "10s", "-quiet"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := runMain(t, []string{"PIPELINE_PROGRESS_REPORT_INTERVAL="},
+				append([]string{"-config", filepath.Join(t.TempDir(), "none.yaml"), "-print-config"}, tt.args...)...)
+			var printed struct {
+				Pipeline struct {
+					ProgressReportInterval time.Duration `yaml:"progress_report_interval"`
+				} `yaml:"pipeline"`
+			}
+			if err := yaml.Unmarshal([]byte(out), &printed); err != nil {
+				t.Fatalf("printed configuration is not YAML: %v\n%s", err, out)
+			}
+			if got := printed.Pipeline.ProgressReportInterval; got != tt.want {
+				t.Errorf("progress_report_interval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package compress wraps output files in the configured compression and
+// opens them again for reading. The exporter writes through NewWriter and
+// every reader, in the pipeline and the importer, goes through Open, so a
+// compressed export reads like a plain one.
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// Compression methods accepted by output.compression
+const (
+	None = "none"
+	Gzip = "gzip"
+)
+
+// Extension returns the suffix appended to files written with method
+func Extension(method string) string {
+	if method == Gzip {
+		return ".gz"
+	}
+	return ""
+}
+
+// ForPath returns the compression method of a file, judged by its name
+func ForPath(path string) string {
+	if TrimExtension(path) != path {
+		return Gzip
+	}
+	return None
+}
+
+// TrimExtension strips a compression suffix, so the data format of a file
+// can be told from the extension left
+func TrimExtension(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		return path[:len(path)-len(".gz")]
+	}
+	return path
+}
+
+// NewWriter compresses what is written to w with method. Closing the
+// returned writer ends the compressed stream and closes w.
+func NewWriter(w io.WriteCloser, method string) io.WriteCloser {
+	if method != Gzip {
+		return w
+	}
+	return &gzipWriter{Writer: gzip.NewWriter(w), file: w}
+}
+
+// gzipWriter closes the gzip stream before the file under it
+type gzipWriter struct {
+	*gzip.Writer
+	file io.Closer
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Open opens a file for reading, decompressing it when its name ends in .gz.
+// Appended gzip streams, as left by a resumed export, read as one.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if ForPath(path) == None {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipReader{Reader: reader, file: file}, nil
+}
+
+// gzipReader closes the file under the gzip stream
+type gzipReader struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (r *gzipReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
@@ -0,0 +1,103 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		path    string
+		method  string
+		trimmed string
+	}{
+		{path: "data.rdf", method: None, trimmed: "data.rdf"},
+		{path: "data.rdf.gz", method: Gzip, trimmed: "data.rdf"},
+		{path: "out/batch_0001.json.GZ", method: Gzip, trimmed: "out/batch_0001.json"},
+		{path: "data.gzip", method: None, trimmed: "data.gzip"},
+	}
+	for _, tt := range tests {
+		if got := ForPath(tt.path); got != tt.method {
+			t.Errorf("ForPath(%q) = %q, want %q", tt.path, got, tt.method)
+		}
+		if got := TrimExtension(tt.path); got != tt.trimmed {
+			t.Errorf("TrimExtension(%q) = %q, want %q", tt.path, got, tt.trimmed)
+		}
+	}
+	if Extension(Gzip) != ".gz" || Extension(None) != "" || Extension("") != "" {
+		t.Errorf("Extension: gzip %q, none %q", Extension(Gzip), Extension(None))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		streams []string // Written one after another to the same file
+	}{
+		{name: "plain", method: None, streams: []string{"_:a <name> \"a\" .\n"}},
+		{name: "gzip", method: Gzip, streams: []string{"_:a <name> \"a\" .\n"}},
+		{name: "appended gzip streams", method: Gzip, streams: []string{"_:a <name> \"a\" .\n", "_:b <name> \"b\" .\n"}},
+		{name: "empty gzip", method: Gzip, streams: []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.rdf"+Extension(tt.method))
+			var want string
+			for _, stream := range tt.streams {
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := NewWriter(file, tt.method)
+				if _, err := io.WriteString(w, stream); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				want += stream
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gzipped := bytes.HasPrefix(raw, []byte{0x1f, 0x8b}); gzipped != (tt.method == Gzip) {
+				t.Errorf("file gzipped: %v, want %v", gzipped, tt.method == Gzip)
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+			if string(got) != want {
+				t.Errorf("read %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOpenInvalidGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.rdf.gz")
+	if err := os.WriteFile(path, []byte("_:a <name> \"a\" .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := Open(path); err == nil {
+		r.Close()
+		t.Error("Open of a plain file named .gz succeeded")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.rdf")); !os.IsNotExist(err) {
+		t.Errorf("Open of a missing file = %v", err)
+	}
+}
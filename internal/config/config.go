@@ -3,11 +3,20 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/expr"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/sink"
 	"gopkg.in/yaml.v2"
 )
 
@@ -18,6 +27,7 @@ type Config struct {
 	Pipeline PipelineConfig `yaml:"pipeline"` // Pipeline execution parameters
 	Logger   LoggerConfig   `yaml:"logger"`   // Logging configuration
 	Output   OutputConfig   `yaml:"output"`   // Output file configuration
+	Retry    RetryConfig    `yaml:"retry"`    // Error classification for retries
 }
 
 // MySQLConfig contains MySQL database connection and performance settings
@@ -25,12 +35,32 @@ type MySQLConfig struct {
 	Host            string        `yaml:"host"`               // MySQL server hostname
 	Port            int           `yaml:"port"`               // MySQL server port
 	User            string        `yaml:"user"`               // Database username
-	Password        string        `yaml:"password"`           // Database password
+	Password        string        `yaml:"password"`           // Database password, or ${ENV_VAR} to read it from the environment
+	PasswordFile    string        `yaml:"password_file"`      // File holding the password, used when no literal password is set
 	Database        string        `yaml:"database"`           // Target database name
-	MaxConnections  int           `yaml:"max_connections"`    // Connection pool size
+	Databases       []string      `yaml:"databases"`          // Several databases to export in one run, with names prefixed by database
+	MaxConnections  int           `yaml:"max_connections"`    // Connection pool size (0 = unlimited)
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // Maximum connection lifetime
 	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // Maximum connection idle time
 	Timeout         time.Duration `yaml:"timeout"`            // Query timeout
+	DecimalAsString bool          `yaml:"decimal_as_string"`  // Map DECIMAL to string to keep exact digits
+
+	InvalidDatePolicy string `yaml:"invalid_date_policy"` // Dates like 0000-00-00: skip, null, epoch or string
+	DefaultTimezone   string `yaml:"default_timezone"`    // IANA zone of DATETIME values without an offset, e.g. Europe/Berlin
+	BinaryPolicy      string `yaml:"binary_policy"`       // BINARY, VARBINARY and BLOB columns: base64 or skip
+
+	TLS        string `yaml:"tls"`         // disabled, preferred, required, verify-ca, verify-identity
+	CACert     string `yaml:"ca_cert"`     // CA certificate (PEM) for verify-ca and verify-identity
+	ClientCert string `yaml:"client_cert"` // Client certificate (PEM) for mutual TLS
+	ClientKey  string `yaml:"client_key"`  // Client private key (PEM) for mutual TLS
+
+	MaxConcurrentQueries int  `yaml:"max_concurrent_queries"` // Queries in flight across all workers (0 = unlimited)
+	WarmupConnections    int  `yaml:"warmup_connections"`     // Connections opened before the first query (0 = open lazily)
+	PreparedStatements   bool `yaml:"prepared_statements"`    // Prepare each table's batch query once and reuse it
+
+	DSNParams map[string]string `yaml:"dsn_params"` // Extra driver parameters, e.g. charset or readTimeout
+	ReadHost  string            `yaml:"read_host"`  // Replica that serves row reads; schema metadata stays on host
+	ReadPort  int               `yaml:"read_port"`  // Replica port (0 = port)
 }
 
 // DgraphConfig contains Dgraph database connection and performance settings
@@ -38,9 +68,32 @@ type DgraphConfig struct {
 	Alpha       []string      `yaml:"alpha"`       // Dgraph Alpha server endpoints
 	Timeout     time.Duration `yaml:"timeout"`     // Request timeout
 	BatchSize   int           `yaml:"batch_size"`  // Batch size for bulk operations
+	Parallel    int           `yaml:"parallel"`    // Batches the importer commits concurrently (1 = in file order)
 	MaxRetries  int           `yaml:"max_retries"` // Maximum retry attempts
-	RetryDelay  time.Duration `yaml:"retry_delay"` // Delay between retry attempts
-	Compression bool          `yaml:"compression"` // Enable gRPC compression
+	RetryDelay  time.Duration `yaml:"retry_delay"` // Delay before the first retry, doubled for each further one up to retry.max_delay
+	Compression bool          `yaml:"compression"` // Compress gRPC requests with gzip
+	Transport   string        `yaml:"transport"`   // Transport to Dgraph: http (http_alpha) or grpc (alpha)
+	HTTPAlpha   string        `yaml:"http_alpha"`  // Dgraph Alpha HTTP endpoint used by the http transport
+
+	ImportMode      string `yaml:"import_mode"`      // Importer mutations: set (new nodes every run) or upsert (match nodes by upsert_predicate)
+	UpsertPredicate string `yaml:"upsert_predicate"` // Predicate identifying nodes across imports in upsert mode (output.emit_xid writes xid)
+
+	ImportFiles     []string `yaml:"import_files"`     // Files or globs to import instead of the pipeline output: .rdf, .nq, .nquad, .nquads or .json
+	VerifyChecksums bool     `yaml:"verify_checksums"` // Check every file against output.manifest_file before loading any
+
+	AuthToken  string          `yaml:"auth_token"`  // Token sent with every request, or ${ENV_VAR} to read it from the environment
+	AuthHeader string          `yaml:"auth_header"` // Header carrying auth_token: X-Dgraph-AuthToken, or X-Auth-Token for Dgraph Cloud
+	TLS        DgraphTLSConfig `yaml:"tls"`         // Certificates for https endpoints
+}
+
+// DgraphTLSConfig holds the certificates for a TLS connection to Dgraph.
+// https endpoints verify against the system roots when no CA is given.
+type DgraphTLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`     // Use TLS without any of the settings below, verifying against the system roots
+	CACert     string `yaml:"ca_cert"`     // CA certificate (PEM) the server certificate is verified against
+	ClientCert string `yaml:"client_cert"` // Client certificate (PEM) for mutual TLS
+	ClientKey  string `yaml:"client_key"`  // Client private key (PEM) for mutual TLS
+	ServerName string `yaml:"server_name"` // Name expected in the server certificate, when it differs from the host
 }
 
 // PipelineConfig contains pipeline execution and performance settings
@@ -49,29 +102,134 @@ type PipelineConfig struct {
 	BatchSize              int           `yaml:"batch_size"`               // Records processed per batch
 	MemoryLimit            int64         `yaml:"memory_limit_mb"`          // Memory limit in MB (0 = unlimited)
 	DryRun                 bool          `yaml:"dry_run"`                  // Preview mode without writing data
+	Resume                 bool          `yaml:"resume"`                   // Continue an interrupted data export from output.checkpoint_file
 	SkipValidation         bool          `yaml:"skip_validation"`          // Skip data validation step
 	CheckpointInterval     int           `yaml:"checkpoint_interval"`      // Records between progress checkpoints
-	ProgressReportInterval time.Duration `yaml:"progress_report_interval"` // Progress reporting frequency
-	EnableMetrics          bool          `yaml:"enable_metrics"`           // Enable performance metrics
+	ProgressReportInterval time.Duration `yaml:"progress_report_interval"` // Progress reporting frequency (0 = no progress reports)
+	EnableMetrics          bool          `yaml:"enable_metrics"`           // Serve Prometheus metrics on /metrics
 	MetricsPort            int           `yaml:"metrics_port"`             // Metrics server port
+	DeltaColumns           bool          `yaml:"delta_columns"`            // Emit only predicates changed since the previous run
+	AnalyzeRelationships   bool          `yaml:"analyze_relationships"`    // Discover extra relationships by sampling column values
+	AnalysisSampleSize     int           `yaml:"analysis_sample_size"`     // Distinct values sampled per candidate column
+	AnalysisTimeBudget     time.Duration `yaml:"analysis_time_budget"`     // Time limit for relationship analysis (0 = unlimited)
+	PartitionAware         bool          `yaml:"partition_aware"`          // Read partitioned tables one partition per job
+	UseApproximateCounts   bool          `yaml:"use_approximate_counts"`   // Show progress against information_schema row estimates
+	DeterministicUIDs      bool          `yaml:"deterministic_uids"`       // Derive blank nodes on demand and keep no UID map
+	UIDMapSpillThreshold   int           `yaml:"uid_map_spill_threshold"`  // UID map entries held in memory before spilling to disk (0 = never)
+	Profile                bool          `yaml:"profile"`                  // Collect per-predicate statistics into output.profile_file
+
+	RelationshipConfidence         float64 `yaml:"relationship_confidence"`          // Share of sampled values found in the target before a data-driven relationship is applied
+	RelationshipOverrideConfidence float64 `yaml:"relationship_override_confidence"` // Share at which sampling replaces the target of a naming-convention key (0 = never)
+	RelationshipSampleSize         int     `yaml:"relationship_sample_size"`         // Rows read per candidate column when sampling distinct values (0 = all rows)
+	RelationshipMaxTableRows       int64   `yaml:"relationship_max_table_rows"`      // Tables estimated above this many rows keep declared and convention keys only (0 = no limit)
+
+	IncludeTables []string `yaml:"include_tables"` // Table globs to process (empty = all); "!pattern" excludes
+	ExcludeTables []string `yaml:"exclude_tables"` // Table globs to skip, taking precedence over include_tables
+
+	CollapseJunctionTables bool `yaml:"collapse_junction_tables"` // Turn many-to-many link table rows into direct edges
+	ExpandJSONColumns      bool `yaml:"expand_json_columns"`      // Emit table.column.key predicates for top-level keys of JSON objects
+
+	DetectLanguageFromCollation bool `yaml:"detect_language_from_collation"` // Tag strings of language-specific collations ("Müller"@de) and mark their predicates @lang
+	SkipGeneratedColumns        bool `yaml:"skip_generated_columns"`         // Leave out virtual generated columns, which MySQL derives from other columns on read
+
+	ColumnRules  map[string]string   `yaml:"column_rules"`  // table.column -> drop, hash (SHA-256 hex) or redact ("***")
+	TableColumns map[string][]string `yaml:"table_columns"` // table -> the only columns to export (absent = all)
+	TableFilters map[string]string   `yaml:"table_filters"` // table -> raw SQL WHERE predicate; config file only, never CLI or env
+
+	Incremental IncrementalConfig `yaml:"incremental"` // Export only rows changed since the previous run
+}
+
+// IncrementalConfig controls watermark-based incremental exports. Each run
+// records the highest watermark_column value read per table in
+// output.watermark_file and the next run exports only rows past it.
+type IncrementalConfig struct {
+	Enabled         bool   `yaml:"enabled"`          // Filter rows by the previous run's watermarks
+	WatermarkColumn string `yaml:"watermark_column"` // Column that grows when a row changes, e.g. updated_at
 }
 
 // LoggerConfig contains logging configuration
 type LoggerConfig struct {
 	Level  string `yaml:"level"`  // Log level: debug, info, warn, error
 	Format string `yaml:"format"` // Log format: json, text
-	Output string `yaml:"output"` // Log output: stdout, stderr, file
+	Output string `yaml:"output"` // Log output: stdout, stderr, or a file path
+
+	MaxSizeMB  int `yaml:"max_size_mb"` // Rotate the log file past this size (0 = never)
+	MaxBackups int `yaml:"max_backups"` // Rotated log files to keep
 }
 
 // OutputConfig contains output file paths and settings
 type OutputConfig struct {
-	Directory      string `yaml:"directory"`       // Output directory path
-	RDFFile        string `yaml:"rdf_file"`        // RDF data file name
-	SchemaFile     string `yaml:"schema_file"`     // Dgraph schema file name
-	JSONFile       string `yaml:"json_file"`       // JSON export file name
-	MappingFile    string `yaml:"mapping_file"`    // UID mapping file name
-	CheckpointFile string `yaml:"checkpoint_file"` // Progress checkpoint file name
-	BackupEnabled  bool   `yaml:"backup_enabled"`  // Enable output file backup
+	Directory              string `yaml:"directory"`                // Output directory path
+	Format                 string `yaml:"format"`                   // Data output format: rdf or json
+	Target                 string `yaml:"target"`                   // Where data goes: file, or dgraph to mutate directly
+	JSONBatchSize          int    `yaml:"json_batch_size"`          // Nodes per batch_NNNN.json file when format is json
+	JSONUpsert             bool   `yaml:"json_upsert"`              // Write JSON batches as upsert blocks matching nodes by xid, so edges resolve across batch files
+	Shards                 int    `yaml:"shards"`                   // Split RDF output into N files by hash of the subject (0 or 1 = one file)
+	ChunkSize              int64  `yaml:"chunk_size"`               // Records per data_chunk_N.rdf file written by the chunked exporter (0 = one file)
+	SplitByTable           bool   `yaml:"split_by_table"`           // Write each table's triples to its own <name>_<table><ext> file, e.g. data_users.rdf
+	Compression            string `yaml:"compression"`              // Compress RDF and JSON batch files: none or gzip (adds .gz)
+	Sink                   string `yaml:"sink"`                     // Where data files are stored: local, or s3 or gcs to upload each from directory once written
+	SinkBucket             string `yaml:"sink_bucket"`              // Bucket receiving the data files when sink is s3 or gcs
+	SinkPrefix             string `yaml:"sink_prefix"`              // Object name prefix in sink_bucket, e.g. exports/2024-01-01
+	SinkRegion             string `yaml:"sink_region"`              // S3 region (empty = AWS_REGION or the AWS profile's, else us-east-1)
+	SinkEndpoint           string `yaml:"sink_endpoint"`            // S3-compatible or GCS API base URL, e.g. a MinIO server (empty = the provider's)
+	RDFFile                string `yaml:"rdf_file"`                 // RDF data file name
+	SchemaFile             string `yaml:"schema_file"`              // Dgraph schema file name
+	GraphQLFile            string `yaml:"graphql_file"`             // Dgraph GraphQL schema file name
+	GenerateGraphQL        bool   `yaml:"generate_graphql"`         // Also write a GraphQL schema bound to the DQL types
+	JSONFile               string `yaml:"json_file"`                // JSON export file name
+	MappingFile            string `yaml:"mapping_file"`             // UID mapping file name
+	MappingFormat          string `yaml:"mapping_format"`           // UID mapping format: text, json, csv, binary
+	CheckpointFile         string `yaml:"checkpoint_file"`          // Progress checkpoint file name
+	FingerprintFile        string `yaml:"fingerprint_file"`         // Per-predicate value fingerprints for delta exports
+	DeleteFile             string `yaml:"delete_file"`              // Predicates a delta export found NULL or no longer written, deleted by the upsert importer
+	WatermarkFile          string `yaml:"watermark_file"`           // Per-table watermarks for incremental exports
+	RelationshipReportFile string `yaml:"relationship_report_file"` // Report written by relationships-observed mode
+	SchemaDiffFile         string `yaml:"schema_diff_file"`         // Report written by schema-diff mode
+	NameMapFile            string `yaml:"name_map_file"`            // Escaped or shortened name -> original name, written when names change
+	ProfileFile            string `yaml:"profile_file"`             // Per-predicate statistics written when pipeline.profile is enabled
+	FailedBatchesFile      string `yaml:"failed_batches_file"`      // Importer batches that failed after all retries, for -retry-failed
+	AnalysisFile           string `yaml:"analysis_file"`            // Report written by analyze mode
+	DiscoveryReportFile    string `yaml:"discovery_report_file"`    // Report written by discover-relationships mode
+	ManifestFile           string `yaml:"manifest_file"`            // Chunk files with record counts, sizes and SHA-256 checksums, written by the chunked exporter
+	MaxNameLength          int    `yaml:"max_name_length"`          // Shorten predicate and type names longer than this (0 = unlimited)
+	BackupEnabled          bool   `yaml:"backup_enabled"`           // Enable output file backup
+
+	EmbedSchemaHeader bool `yaml:"embed_schema_header"` // Prefix RDF files with their predicates and the schema checksum
+
+	DerivedPredicates map[string]string `yaml:"derived_predicates"` // table.predicate -> expression over the row's columns
+
+	BooleanColumns []string `yaml:"boolean_columns"` // Column patterns (column or table.column, globs allowed) forced to bool
+
+	KeyColumns map[string][]string `yaml:"key_columns"` // table -> columns forming its blank-node identity instead of the primary key
+
+	UIDNamespace string `yaml:"uid_namespace"` // Prefix blank nodes as _:namespace_table_id, e.g. the database name (empty = none)
+	EmitXID      bool   `yaml:"emit_xid"`      // Give every node an xid predicate holding table:key for upsert-based loading
+
+	ReverseEdges string `yaml:"reverse_edges"` // manual (table.column_reverse triples) or directive (@reverse on the foreign key)
+
+	PluralizationOverrides map[string]string `yaml:"pluralization_overrides"` // singular -> plural for reverse edge and table names
+
+	DatetimeIndexGranularity string            `yaml:"datetime_index_granularity"` // Default datetime index: year, month, day, hour
+	DatetimeIndexOverrides   map[string]string `yaml:"datetime_index_overrides"`   // Per-column granularity keyed by table.column
+}
+
+// RetryConfig extends the built-in classification of retryable errors and
+// sets how often MySQL batch queries are retried; Dgraph requests use
+// dgraph.max_retries and dgraph.retry_delay
+type RetryConfig struct {
+	Rules      []RetryRule   `yaml:"rules"`       // Checked in order before the built-in rules
+	MaxDelay   time.Duration `yaml:"max_delay"`   // Cap on the doubling delay between retries (0 = keep the first delay constant)
+	MaxRetries int           `yaml:"max_retries"` // Retries of a failed MySQL batch query
+	Delay      time.Duration `yaml:"delay"`       // Delay before the first MySQL retry, doubled for each further one up to max_delay
+}
+
+// RetryRule marks errors matching exactly one of its matchers as retryable or fatal
+type RetryRule struct {
+	Contains   string `yaml:"contains"`    // Case-insensitive substring of the error message
+	MySQLCode  uint16 `yaml:"mysql_code"`  // MySQL server error number
+	HTTPStatus int    `yaml:"http_status"` // HTTP status returned by Dgraph
+	Retryable  bool   `yaml:"retryable"`   // Retry matching errors (false = fail immediately)
 }
 
 // DefaultConfig returns a configuration with sensible defaults for production use
@@ -87,46 +245,118 @@ func DefaultConfig() *Config {
 			ConnMaxLifetime: 5 * time.Minute,
 			ConnMaxIdleTime: 2 * time.Minute,
 			Timeout:         30 * time.Second,
+
+			InvalidDatePolicy:  "skip",
+			BinaryPolicy:       "base64",
+			DefaultTimezone:    "UTC",
+			PreparedStatements: true,
+			TLS:                "disabled",
 		},
 		Dgraph: DgraphConfig{
 			Alpha:       []string{"localhost:9080"},
 			Timeout:     30 * time.Second,
 			BatchSize:   10000,
+			Parallel:    1,
 			MaxRetries:  3,
 			RetryDelay:  time.Second,
 			Compression: true,
+			Transport:   "http",
+			HTTPAlpha:   "localhost:8080",
+			AuthHeader:  "X-Dgraph-AuthToken",
+
+			ImportMode:      "set",
+			UpsertPredicate: "xid",
 		},
 		Pipeline: PipelineConfig{
 			Workers:                4,
 			BatchSize:              1000,
 			MemoryLimit:            1024, // 1GB
+			UIDMapSpillThreshold:   1000000,
 			DryRun:                 false,
 			SkipValidation:         false,
 			CheckpointInterval:     10000,
 			ProgressReportInterval: 30 * time.Second,
 			EnableMetrics:          true,
-			MetricsPort:            8080,
+			MetricsPort:            2112,
+			AnalysisSampleSize:     1000,
+			RelationshipConfidence: 0.9,
+			RelationshipSampleSize: 100000,
+			AnalysisTimeBudget:     2 * time.Minute,
 		},
 		Logger: LoggerConfig{
 			Level:  "info",
 			Format: "json",
 			Output: "stdout",
+
+			MaxBackups: 3,
+		},
+		Retry: RetryConfig{
+			MaxDelay:   30 * time.Second,
+			MaxRetries: 3,
+			Delay:      time.Second,
 		},
 		Output: OutputConfig{
-			Directory:      "output",
-			RDFFile:        "data.rdf",
-			SchemaFile:     "schema.txt",
-			JSONFile:       "data.json",
-			MappingFile:    "uid_mapping.json",
-			CheckpointFile: "checkpoint.json",
-			BackupEnabled:  true,
+			Directory:              "output",
+			Format:                 "rdf",
+			Target:                 "file",
+			JSONBatchSize:          1000,
+			Compression:            compress.None,
+			Sink:                   sink.Local,
+			RDFFile:                "data.rdf",
+			SchemaFile:             "schema.txt",
+			GraphQLFile:            "schema.graphql",
+			JSONFile:               "data.json",
+			MappingFile:            "uid_mapping.txt",
+			MappingFormat:          "text",
+			CheckpointFile:         "checkpoint.json",
+			FingerprintFile:        "fingerprints.txt",
+			DeleteFile:             "delete.rdf",
+			WatermarkFile:          "watermarks.json",
+			RelationshipReportFile: "relationships_observed.json",
+			SchemaDiffFile:         "schema_diff.json",
+			NameMapFile:            "name_map.txt",
+			ProfileFile:            "profile.json",
+			FailedBatchesFile:      "failed_batches.json",
+			AnalysisFile:           "analysis.json",
+			DiscoveryReportFile:    "relationships_discovered.json",
+			ManifestFile:           "manifest.json",
+			BackupEnabled:          true,
+			ReverseEdges:           "manual",
+
+			DatetimeIndexGranularity: "hour",
 		},
 	}
 }
 
+// unknownFieldPattern matches yaml.v2's report of a key with no struct field
+var unknownFieldPattern = regexp.MustCompile(`^(line \d+): field (\S+) not found in type \S+$`)
+
+// describeYAMLError rewords strict unmarshalling errors, listing unknown keys
+// as "line 3: unknown key piepline" instead of naming Go types
+func describeYAMLError(err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	var unknown, other []string
+	for _, msg := range typeErr.Errors {
+		if m := unknownFieldPattern.FindStringSubmatch(msg); m != nil {
+			unknown = append(unknown, fmt.Sprintf("%s: unknown key %s", m[1], m[2]))
+		} else {
+			other = append(other, msg)
+		}
+	}
+	if len(unknown) > 0 && len(other) == 0 {
+		return fmt.Errorf("unknown configuration keys (check the spelling): %s", strings.Join(unknown, "; "))
+	}
+	return fmt.Errorf("%s", strings.Join(append(unknown, other...), "; "))
+}
+
 // Load reads configuration from file and applies environment variable overrides
 func Load(configPath string) (*Config, error) {
 	cfg := DefaultConfig()
+	explicitPassword := false
 
 	// Load from YAML file if it exists
 	if _, err := os.Stat(configPath); err == nil {
@@ -135,10 +365,26 @@ func Load(configPath string) (*Config, error) {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 
-		if err := yaml.Unmarshal(data, cfg); err != nil {
-			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		// Unknown keys are rejected so a misspelled key is not silently
+		// replaced by its default
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, describeYAMLError(err))
+		}
+
+		// The default password must not take precedence over password_file,
+		// so note whether the file sets one
+		var raw struct {
+			MySQL struct {
+				Password *string `yaml:"password"`
+			} `yaml:"mysql"`
+		}
+		if err := yaml.Unmarshal(data, &raw); err == nil && raw.MySQL.Password != nil {
+			explicitPassword = true
 		}
 	}
+	if os.Getenv("MYSQL_PASSWORD") != "" {
+		explicitPassword = true
+	}
 
 	// Apply environment variable overrides
 	if err := overrideWithEnv(cfg); err != nil {
@@ -150,23 +396,83 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	if err := cfg.MySQL.resolvePassword(explicitPassword); err != nil {
+		return nil, err
+	}
+	if envVar, ok := passwordReference(cfg.Dgraph.AuthToken); ok {
+		value, set := os.LookupEnv(envVar)
+		if !set {
+			return nil, fmt.Errorf("dgraph auth_token references unset environment variable %s", envVar)
+		}
+		cfg.Dgraph.AuthToken = value
+	}
+
 	return cfg, nil
 }
 
+// resolvePassword settles the password from its sources. A literal password
+// wins over password_file, which wins over a ${ENV_VAR} reference.
+func (m *MySQLConfig) resolvePassword(explicit bool) error {
+	envVar, isReference := passwordReference(m.Password)
+
+	if explicit && !isReference {
+		return nil
+	}
+
+	if m.PasswordFile != "" {
+		data, err := os.ReadFile(m.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read mysql password_file: %w", err)
+		}
+		m.Password = strings.TrimRight(string(data), "\r\n")
+		return nil
+	}
+
+	if isReference {
+		value, ok := os.LookupEnv(envVar)
+		if !ok {
+			return fmt.Errorf("mysql password references unset environment variable %s", envVar)
+		}
+		m.Password = value
+	}
+	return nil
+}
+
+// passwordReference reports whether a password is a ${ENV_VAR} reference and
+// returns the variable name
+func passwordReference(password string) (string, bool) {
+	if !strings.HasPrefix(password, "${") || !strings.HasSuffix(password, "}") {
+		return "", false
+	}
+	name := password[2 : len(password)-1]
+	return name, name != ""
+}
+
 // overrideWithEnv applies environment variable overrides to configuration
 func overrideWithEnv(cfg *Config) error {
 	// Map environment variables to configuration fields
 	envOverrides := map[string]interface{}{
-		"MYSQL_HOST":          &cfg.MySQL.Host,
-		"MYSQL_PORT":          &cfg.MySQL.Port,
-		"MYSQL_USER":          &cfg.MySQL.User,
-		"MYSQL_PASSWORD":      &cfg.MySQL.Password,
-		"MYSQL_DATABASE":      &cfg.MySQL.Database,
-		"DGRAPH_ALPHA":        &cfg.Dgraph.Alpha,
-		"PIPELINE_WORKERS":    &cfg.Pipeline.Workers,
-		"PIPELINE_BATCH_SIZE": &cfg.Pipeline.BatchSize,
-		"LOG_LEVEL":           &cfg.Logger.Level,
-		"OUTPUT_DIR":          &cfg.Output.Directory,
+		"MYSQL_HOST":            &cfg.MySQL.Host,
+		"MYSQL_PORT":            &cfg.MySQL.Port,
+		"MYSQL_USER":            &cfg.MySQL.User,
+		"MYSQL_PASSWORD":        &cfg.MySQL.Password,
+		"MYSQL_DATABASE":        &cfg.MySQL.Database,
+		"MYSQL_TIMEOUT":         &cfg.MySQL.Timeout,
+		"MYSQL_MAX_CONNECTIONS": &cfg.MySQL.MaxConnections,
+		"MYSQL_TIMEZONE":        &cfg.MySQL.DefaultTimezone,
+		"DGRAPH_ALPHA":          &cfg.Dgraph.Alpha,
+		"DGRAPH_BATCH_SIZE":     &cfg.Dgraph.BatchSize,
+		"DGRAPH_TIMEOUT":        &cfg.Dgraph.Timeout,
+		"DGRAPH_MAX_RETRIES":    &cfg.Dgraph.MaxRetries,
+		"DGRAPH_AUTH_TOKEN":     &cfg.Dgraph.AuthToken,
+		"PIPELINE_WORKERS":      &cfg.Pipeline.Workers,
+		"PIPELINE_BATCH_SIZE":   &cfg.Pipeline.BatchSize,
+		"PIPELINE_DRY_RUN":      &cfg.Pipeline.DryRun,
+		"LOG_LEVEL":             &cfg.Logger.Level,
+		"LOG_FORMAT":            &cfg.Logger.Format,
+		"LOG_OUTPUT":            &cfg.Logger.Output,
+		"OUTPUT_DIR":            &cfg.Output.Directory,
+		"OUTPUT_RDF_FILE":       &cfg.Output.RDFFile,
 	}
 
 	// Apply environment variable values
@@ -176,11 +482,32 @@ func overrideWithEnv(cfg *Config) error {
 			case *string:
 				*v = value
 			case *int:
-				if intVal, err := strconv.Atoi(value); err == nil {
-					*v = intVal
+				intVal, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("%s: invalid integer %q", envVar, value)
+				}
+				*v = intVal
+			case *bool:
+				boolVal, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("%s: invalid boolean %q", envVar, value)
 				}
+				*v = boolVal
+			case *time.Duration:
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("%s: invalid duration %q", envVar, value)
+				}
+				*v = duration
 			case *[]string:
-				*v = []string{value} // Simplified for single value
+				// Comma-separated list, e.g. DGRAPH_ALPHA=alpha1:9080,alpha2:9080
+				var items []string
+				for _, item := range strings.Split(value, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						items = append(items, item)
+					}
+				}
+				*v = items
 			}
 		}
 	}
@@ -188,42 +515,619 @@ func overrideWithEnv(cfg *Config) error {
 	return nil
 }
 
+// redactedSecret replaces secret values in Redacted copies
+const redactedSecret = "********"
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// print or log
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.MySQL.Password != "" {
+		redacted.MySQL.Password = redactedSecret
+	}
+	if redacted.Dgraph.AuthToken != "" {
+		redacted.Dgraph.AuthToken = redactedSecret
+	}
+	return &redacted
+}
+
 // Validate ensures all required configuration values are present and valid
 func (c *Config) Validate() error {
 	// MySQL validation
 	if c.MySQL.Host == "" {
 		return fmt.Errorf("mysql host is required")
 	}
-	if c.MySQL.Database == "" {
+	if c.MySQL.Database == "" && len(c.MySQL.Databases) == 0 {
 		return fmt.Errorf("mysql database is required")
 	}
+	if c.MySQL.Database != "" && !IsIdentifier(c.MySQL.Database) {
+		return fmt.Errorf("mysql database %q may only contain letters, digits, '_' and '$'", c.MySQL.Database)
+	}
+	seenDatabases := make(map[string]bool)
+	for _, database := range c.MySQL.Databases {
+		if database == "" {
+			return fmt.Errorf("mysql databases must not contain an empty name")
+		}
+		if !IsIdentifier(database) {
+			return fmt.Errorf("mysql databases entry %q may only contain letters, digits, '_' and '$'", database)
+		}
+		if seenDatabases[database] {
+			return fmt.Errorf("mysql databases lists %s more than once", database)
+		}
+		seenDatabases[database] = true
+	}
 	if c.MySQL.Port <= 0 || c.MySQL.Port > 65535 {
 		return fmt.Errorf("mysql port must be between 1 and 65535")
 	}
+	if c.MySQL.ReadPort < 0 || c.MySQL.ReadPort > 65535 {
+		return fmt.Errorf("mysql read_port must be between 0 and 65535")
+	}
+	if err := c.MySQL.validateDSNParams(); err != nil {
+		return err
+	}
 
 	// Dgraph validation
 	if len(c.Dgraph.Alpha) == 0 {
 		return fmt.Errorf("at least one dgraph alpha endpoint is required")
 	}
+	switch c.Dgraph.ImportMode {
+	case "set":
+	case "upsert":
+		if c.Dgraph.UpsertPredicate == "" {
+			return fmt.Errorf("dgraph upsert_predicate is required for import_mode upsert")
+		}
+	default:
+		return fmt.Errorf("dgraph import_mode must be set or upsert")
+	}
+	if c.Dgraph.Parallel < 1 {
+		return fmt.Errorf("dgraph parallel must be at least 1")
+	}
+	if c.Dgraph.Transport != "http" && c.Dgraph.Transport != "grpc" {
+		return fmt.Errorf("dgraph transport must be http or grpc")
+	}
+	if c.Dgraph.Transport == "http" && c.Dgraph.HTTPAlpha == "" {
+		return fmt.Errorf("dgraph http_alpha is required for the http transport")
+	}
+	if c.Dgraph.AuthToken != "" && c.Dgraph.AuthHeader == "" {
+		return fmt.Errorf("dgraph auth_header is required with auth_token")
+	}
+	if err := c.Dgraph.validateTLS(); err != nil {
+		return err
+	}
+
+	// Logger validation
+	if c.Logger.MaxSizeMB < 0 || c.Logger.MaxBackups < 0 {
+		return fmt.Errorf("logger max_size_mb and max_backups must be >= 0")
+	}
 
 	// Pipeline validation
 	if c.Pipeline.Workers <= 0 {
 		return fmt.Errorf("pipeline workers must be positive")
 	}
+	if c.Pipeline.EnableMetrics && (c.Pipeline.MetricsPort <= 0 || c.Pipeline.MetricsPort > 65535) {
+		return fmt.Errorf("pipeline metrics_port must be between 1 and 65535")
+	}
+	if c.Pipeline.UIDMapSpillThreshold < 0 {
+		return fmt.Errorf("pipeline uid_map_spill_threshold must be >= 0")
+	}
+	if c.Pipeline.MemoryLimit < 0 {
+		return fmt.Errorf("pipeline memory_limit_mb must be >= 0")
+	}
 	if c.Pipeline.BatchSize <= 0 {
 		return fmt.Errorf("pipeline batch size must be positive")
 	}
+	if c.Pipeline.ProgressReportInterval < 0 {
+		return fmt.Errorf("pipeline progress_report_interval must be >= 0")
+	}
+	for column, action := range c.Pipeline.ColumnRules {
+		if !strings.Contains(column, ".") {
+			return fmt.Errorf("column rule %s must be named table.column", column)
+		}
+		switch action {
+		case "drop", "hash", "redact":
+		default:
+			return fmt.Errorf("column rule for %s must be drop, hash or redact", column)
+		}
+	}
+	for table, filter := range c.Pipeline.TableFilters {
+		if strings.TrimSpace(filter) == "" {
+			return fmt.Errorf("pipeline table_filters for %s is empty", table)
+		}
+	}
+	if c.Pipeline.Resume && (c.Output.Format != "rdf" || c.Output.Target != "file") {
+		return fmt.Errorf("pipeline resume requires rdf output to a file")
+	}
+	// A delta row keeps its blank node label, so only an upsert import finds
+	// the node an earlier run created; any other import gives it a new node
+	if c.Pipeline.DeltaColumns {
+		if c.Output.Format != "rdf" || c.Output.Target != "file" || !c.Output.EmitXID ||
+			c.Dgraph.ImportMode != "upsert" || c.Dgraph.UpsertPredicate != "xid" {
+			return fmt.Errorf("pipeline delta_columns requires rdf output to files with output.emit_xid, imported with dgraph.import_mode upsert on xid")
+		}
+		if c.Output.DeleteFile == "" {
+			return fmt.Errorf("pipeline delta_columns requires output.delete_file")
+		}
+	}
+	if c.Pipeline.Incremental.Enabled && c.Pipeline.Incremental.WatermarkColumn == "" {
+		return fmt.Errorf("pipeline incremental requires watermark_column")
+	}
+	if column := c.Pipeline.Incremental.WatermarkColumn; column != "" && !IsIdentifier(column) {
+		return fmt.Errorf("pipeline incremental watermark_column %q may only contain letters, digits, '_' and '$'", column)
+	}
+	for table, columns := range c.Pipeline.TableColumns {
+		if len(columns) == 0 {
+			return fmt.Errorf("pipeline table_columns for %s lists no columns", table)
+		}
+	}
+	for _, pattern := range append(c.Pipeline.IncludeTables, c.Pipeline.ExcludeTables...) {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+			return fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+	}
+	if c.Pipeline.AnalyzeRelationships && c.Pipeline.AnalysisSampleSize <= 0 {
+		return fmt.Errorf("pipeline analysis sample size must be positive")
+	}
+	if c.Pipeline.RelationshipConfidence < 0 || c.Pipeline.RelationshipConfidence > 1 {
+		return fmt.Errorf("pipeline relationship_confidence must be between 0 and 1")
+	}
+	if c.Pipeline.RelationshipOverrideConfidence < 0 || c.Pipeline.RelationshipOverrideConfidence > 1 {
+		return fmt.Errorf("pipeline relationship_override_confidence must be between 0 and 1")
+	}
+	if c.Pipeline.RelationshipSampleSize < 0 {
+		return fmt.Errorf("pipeline relationship_sample_size cannot be negative")
+	}
+	if c.Pipeline.RelationshipMaxTableRows < 0 {
+		return fmt.Errorf("pipeline relationship_max_table_rows cannot be negative")
+	}
+
+	switch c.MySQL.InvalidDatePolicy {
+	case "skip", "null", "epoch", "string":
+	default:
+		return fmt.Errorf("mysql invalid_date_policy must be skip, null, epoch or string")
+	}
+	switch c.MySQL.BinaryPolicy {
+	case "base64", "skip":
+	default:
+		return fmt.Errorf("mysql binary_policy must be base64 or skip")
+	}
+	if c.MySQL.MaxConnections > 0 && c.Pipeline.Workers > c.MySQL.MaxConnections {
+		return fmt.Errorf("pipeline workers (%d) must not exceed mysql max_connections (%d), or workers wait for connections",
+			c.Pipeline.Workers, c.MySQL.MaxConnections)
+	}
+	if c.MySQL.WarmupConnections < 0 || (c.MySQL.MaxConnections > 0 && c.MySQL.WarmupConnections > c.MySQL.MaxConnections) {
+		return fmt.Errorf("mysql warmup_connections must be between 0 and max_connections")
+	}
+	if _, err := c.MySQL.Location(); err != nil {
+		return err
+	}
+	if err := c.MySQL.validateTLS(); err != nil {
+		return err
+	}
+	if c.MySQL.PasswordFile != "" {
+		if _, err := os.Stat(c.MySQL.PasswordFile); err != nil {
+			return fmt.Errorf("mysql password_file %s: %w", c.MySQL.PasswordFile, err)
+		}
+	}
+
+	if c.Retry.MaxDelay < 0 {
+		return fmt.Errorf("retry max_delay must not be negative")
+	}
+	if c.Retry.MaxRetries < 0 {
+		return fmt.Errorf("retry max_retries must not be negative")
+	}
+	if c.Retry.Delay < 0 {
+		return fmt.Errorf("retry delay must not be negative")
+	}
+	for i, rule := range c.Retry.Rules {
+		matchers := 0
+		if rule.Contains != "" {
+			matchers++
+		}
+		if rule.MySQLCode != 0 {
+			matchers++
+		}
+		if rule.HTTPStatus != 0 {
+			matchers++
+		}
+		if matchers != 1 {
+			return fmt.Errorf("retry rule %d must set exactly one of contains, mysql_code or http_status", i+1)
+		}
+	}
 
 	// Output validation
 	if c.Output.Directory == "" {
 		return fmt.Errorf("output directory is required")
 	}
+	if c.Output.MaxNameLength < 0 || (c.Output.MaxNameLength > 0 && c.Output.MaxNameLength < 16) {
+		return fmt.Errorf("output max_name_length must be 0 (unlimited) or at least 16")
+	}
+	switch c.Output.Format {
+	case "rdf", "json":
+	default:
+		return fmt.Errorf("output format must be rdf or json")
+	}
+	switch c.Output.Target {
+	case "file", "dgraph":
+	default:
+		return fmt.Errorf("output target must be file or dgraph")
+	}
+	if c.Output.Shards < 0 {
+		return fmt.Errorf("output shards must not be negative")
+	}
+	if c.Output.Shards > 1 && (c.Output.Format != "rdf" || c.Output.Target != "file") {
+		return fmt.Errorf("output shards require rdf output to a file")
+	}
+	if c.Output.ChunkSize < 0 {
+		return fmt.Errorf("output chunk_size must not be negative")
+	}
+	if c.Output.ChunkSize > 0 && (c.Output.Format != "rdf" || c.Output.Target != "file" || c.Output.Shards > 1) {
+		return fmt.Errorf("output chunk_size requires unsharded rdf output to a file")
+	}
+	if c.Output.SplitByTable && (c.Output.Format != "rdf" || c.Output.Target != "file" || c.Output.Shards > 1 || c.Output.ChunkSize > 0) {
+		return fmt.Errorf("output split_by_table requires unsharded, unchunked rdf output to a file")
+	}
+	if c.Output.ChunkSize > 0 && c.Pipeline.Resume {
+		return fmt.Errorf("output chunk_size cannot be combined with resume, chunked exports keep no checkpoint")
+	}
+	switch c.Output.Compression {
+	case compress.None, compress.Gzip:
+	default:
+		return fmt.Errorf("output compression must be none or gzip")
+	}
+	switch c.Output.Sink {
+	case sink.Local:
+	case sink.S3, sink.GCS:
+		if c.Output.SinkBucket == "" {
+			return fmt.Errorf("output sink_bucket is required for sink %s", c.Output.Sink)
+		}
+		if c.Output.Target != "file" {
+			return fmt.Errorf("output sink %s requires output to files", c.Output.Sink)
+		}
+		if c.Output.EmbedSchemaHeader {
+			return fmt.Errorf("output embed_schema_header rewrites files after they are uploaded, use sink local")
+		}
+	default:
+		return fmt.Errorf("output sink must be local, s3 or gcs")
+	}
+	if c.Output.Format == "json" && c.Output.JSONBatchSize <= 0 {
+		return fmt.Errorf("output json_batch_size must be positive")
+	}
+	if c.Output.JSONUpsert {
+		if c.Output.Format != "json" || c.Output.Target != "file" {
+			return fmt.Errorf("output json_upsert requires json output to files")
+		}
+		if !c.Output.EmitXID {
+			return fmt.Errorf("output json_upsert requires emit_xid, whose xid predicate the upsert blocks match nodes by")
+		}
+	}
+	switch c.Output.MappingFormat {
+	case "text", "json", "csv", "binary":
+	default:
+		return fmt.Errorf("output mapping format must be text, json, csv or binary")
+	}
+	switch c.Output.ReverseEdges {
+	case "manual", "directive":
+	default:
+		return fmt.Errorf("output reverse_edges must be manual or directive")
+	}
+	if !isDatetimeGranularity(c.Output.DatetimeIndexGranularity) {
+		return fmt.Errorf("invalid datetime index granularity %q: must be year, month, day or hour",
+			c.Output.DatetimeIndexGranularity)
+	}
+	for column, granularity := range c.Output.DatetimeIndexOverrides {
+		if !isDatetimeGranularity(granularity) {
+			return fmt.Errorf("invalid datetime index granularity %q for %s: must be year, month, day or hour",
+				granularity, column)
+		}
+	}
+	for table, columns := range c.Output.KeyColumns {
+		if len(columns) == 0 {
+			return fmt.Errorf("output key_columns for %s must list at least one column", table)
+		}
+		for _, column := range columns {
+			if !IsIdentifier(column) {
+				return fmt.Errorf("output key_columns for %s: column %q may only contain letters, digits, '_' and '$'", table, column)
+			}
+		}
+	}
+	if !isBlankNodeLabel(c.Output.UIDNamespace) {
+		return fmt.Errorf("output uid_namespace %q may only contain letters, digits, '_' and '-'", c.Output.UIDNamespace)
+	}
+	for singular, plural := range c.Output.PluralizationOverrides {
+		if singular == "" || plural == "" {
+			return fmt.Errorf("output pluralization_overrides entries need both a singular and a plural, got %q: %q",
+				singular, plural)
+		}
+	}
+	for name, source := range c.Output.DerivedPredicates {
+		if !strings.Contains(name, ".") {
+			return fmt.Errorf("derived predicate %s must be named table.predicate", name)
+		}
+		if _, err := expr.Parse(source); err != nil {
+			return fmt.Errorf("invalid expression for derived predicate %s: %w", name, err)
+		}
+	}
 
 	return nil
 }
 
+// estimatedRowBytes is the assumed in-memory size of a row in flight, used to
+// compare batches against memory_limit_mb before any row is read
+const estimatedRowBytes = 1024
+
+// Warnings returns option combinations that are valid but probably not what
+// was intended. Validate rejects the ones that cannot work.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.Pipeline.DryRun && c.Output.Target == "dgraph" {
+		warnings = append(warnings, "pipeline dry_run sends nothing, so output target dgraph is ignored")
+	}
+	if c.Pipeline.MemoryLimit > 0 {
+		rows := int64(c.Pipeline.Workers) * int64(c.Pipeline.BatchSize)
+		if estimateMB := rows * estimatedRowBytes / (1024 * 1024); estimateMB > c.Pipeline.MemoryLimit {
+			warnings = append(warnings, fmt.Sprintf(
+				"pipeline workers x batch_size keeps %d rows in flight, about %d MB at 1 KB a row, above memory_limit_mb %d",
+				rows, estimateMB, c.Pipeline.MemoryLimit))
+		}
+	}
+	return warnings
+}
+
+// isDatetimeGranularity reports whether a token is a Dgraph datetime index tokenizer
+func isDatetimeGranularity(granularity string) bool {
+	switch granularity {
+	case "year", "month", "day", "hour":
+		return true
+	}
+	return false
+}
+
+// identifierPattern matches the names the exporter puts into queries
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_$]+$`)
+
+// IsIdentifier reports whether name is a plain MySQL identifier of letters,
+// digits, '_' and '$'. Database, table, column and partition names are
+// checked with it before they are interpolated into a query.
+func IsIdentifier(name string) bool {
+	return identifierPattern.MatchString(name)
+}
+
+// isBlankNodeLabel reports whether s can be embedded in a blank node label
+// without quoting; the empty string qualifies
+func isBlankNodeLabel(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ManualReverseEdges reports whether foreign keys get explicit reverse
+// predicates and triples rather than Dgraph's @reverse directive
+func (o *OutputConfig) ManualReverseEdges() bool {
+	return o.ReverseEdges != "directive"
+}
+
+// DatetimeGranularity returns the datetime index granularity for a column,
+// preferring a per-column override over the configured default
+func (o *OutputConfig) DatetimeGranularity(table, column string) string {
+	if granularity, ok := o.DatetimeIndexOverrides[table+"."+column]; ok {
+		return granularity
+	}
+	return o.DatetimeIndexGranularity
+}
+
+// Location returns the time zone that naive DATETIME values are read in
+func (m *MySQLConfig) Location() (*time.Location, error) {
+	if m.DefaultTimezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(m.DefaultTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("mysql default_timezone: %w", err)
+	}
+	return loc, nil
+}
+
 // ConnectionString builds a MySQL DSN (Data Source Name) connection string
 func (m *MySQLConfig) ConnectionString() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&timeout=%s",
-		m.User, m.Password, m.Host, m.Port, m.Database, m.Timeout)
+	return m.dsn(m.Host, m.Port)
+}
+
+// ReadConnectionString builds the DSN for row reads: the read replica when
+// read_host is set, the primary otherwise
+func (m *MySQLConfig) ReadConnectionString() string {
+	if !m.HasReadReplica() {
+		return m.ConnectionString()
+	}
+	port := m.ReadPort
+	if port == 0 {
+		port = m.Port
+	}
+	return m.dsn(m.ReadHost, port)
+}
+
+// SourceDatabases returns the databases to export: the databases list when
+// set, otherwise the single database
+func (m *MySQLConfig) SourceDatabases() []string {
+	if len(m.Databases) > 0 {
+		return m.Databases
+	}
+	return []string{m.Database}
+}
+
+// QualifiedNames reports whether table names are prefixed with their
+// database, which is the case whenever the databases list is used
+func (m *MySQLConfig) QualifiedNames() bool {
+	return len(m.Databases) > 0
+}
+
+// HasReadReplica reports whether row reads go to a separate host
+func (m *MySQLConfig) HasReadReplica() bool {
+	return m.ReadHost != ""
+}
+
+// Endpoint returns the Alpha endpoints the importer transport talks to, for
+// logs and reports
+func (d *DgraphConfig) Endpoint() string {
+	if d.Transport == "grpc" {
+		return strings.Join(d.Alpha, ",")
+	}
+	return d.HTTPAlpha
+}
+
+func (m *MySQLConfig) dsn(host string, port int) string {
+	// Dates are read as text, since parseTime fails the whole result set on
+	// values like 0000-00-00; the datetime converter validates them instead
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=false&timeout=%s",
+		m.User, m.Password, host, port, m.SourceDatabases()[0], m.Timeout)
+	if tlsParam := m.tlsParam(); tlsParam != "" {
+		dsn += "&tls=" + tlsParam
+	}
+
+	// Sorted so the DSN is the same on every run
+	keys := make([]string, 0, len(m.DSNParams))
+	for key := range m.DSNParams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dsn += "&" + key + "=" + url.QueryEscape(m.DSNParams[key])
+	}
+	return dsn
+}
+
+// allowedDSNParams are the driver parameters dsn_params may set. Parameters
+// the pipeline depends on, such as parseTime, timeout and tls, are left out.
+var allowedDSNParams = map[string]bool{
+	"allowCleartextPasswords": true,
+	"allowNativePasswords":    true,
+	"charset":                 true,
+	"collation":               true,
+	"connectionAttributes":    true,
+	"interpolateParams":       true,
+	"maxAllowedPacket":        true,
+	"readTimeout":             true,
+	"rejectReadOnly":          true,
+	"writeTimeout":            true,
+}
+
+// validateDSNParams rejects dsn_params keys outside allowedDSNParams
+func (m *MySQLConfig) validateDSNParams() error {
+	for key := range m.DSNParams {
+		if !allowedDSNParams[key] {
+			return fmt.Errorf("mysql dsn_params: unsupported parameter %q", key)
+		}
+	}
+	return nil
+}
+
+// RDFFiles returns the names of the RDF data files: rdf_file, or one
+// <name>_shard_<i><ext> file per shard when output is sharded, each with the
+// compression extension
+func (o *OutputConfig) RDFFiles() []string {
+	if o.Shards <= 1 {
+		return []string{o.CompressedName(o.RDFFile)}
+	}
+
+	ext := path.Ext(o.RDFFile)
+	base := strings.TrimSuffix(o.RDFFile, ext)
+	files := make([]string, o.Shards)
+	for i := range files {
+		files[i] = o.CompressedName(fmt.Sprintf("%s_shard_%d%s", base, i, ext))
+	}
+	return files
+}
+
+// TableRDFFile returns the name of a table's RDF file when split_by_table is
+// set: <name>_<table><ext> of rdf_file, with the compression extension
+func (o *OutputConfig) TableRDFFile(table string) string {
+	ext := path.Ext(o.RDFFile)
+	return o.CompressedName(fmt.Sprintf("%s_%s%s", strings.TrimSuffix(o.RDFFile, ext), table, ext))
+}
+
+// TableRDFPattern returns the glob matching every file TableRDFFile names
+func (o *OutputConfig) TableRDFPattern() string {
+	return o.TableRDFFile("*")
+}
+
+// SinkOptions returns the settings of the sink data files are written to
+func (o *OutputConfig) SinkOptions() sink.Options {
+	return sink.Options{
+		Kind:      o.Sink,
+		Directory: o.Directory,
+		Bucket:    o.SinkBucket,
+		Prefix:    o.SinkPrefix,
+		Region:    o.SinkRegion,
+		Endpoint:  o.SinkEndpoint,
+	}
+}
+
+// CompressedName returns the name a data file is written under, with the
+// extension of output.compression appended
+func (o *OutputConfig) CompressedName(name string) string {
+	return name + compress.Extension(o.Compression)
+}
+
+// IsBooleanColumn reports whether a column is forced to bool typing. Patterns
+// match either the bare column name or "table.column" and may use globs.
+func (o *OutputConfig) IsBooleanColumn(table, column string) bool {
+	return MatchColumn(o.BooleanColumns, table, column)
+}
+
+// ColumnRule returns the column_rules action for a column, or "" if none
+func (p *PipelineConfig) ColumnRule(table, column string) string {
+	return p.ColumnRules[table+"."+column]
+}
+
+// IncludesTable reports whether a table passes include_tables and
+// exclude_tables. Exclusions, including "!pattern" entries of include_tables,
+// take precedence; an include list without plain patterns includes everything.
+func (p *PipelineConfig) IncludesTable(table string) bool {
+	included := true
+	for _, pattern := range p.IncludeTables {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matched, _ := path.Match(negated, table); matched {
+				return false
+			}
+			continue
+		}
+		included = false
+	}
+	for _, pattern := range p.ExcludeTables {
+		if matched, _ := path.Match(pattern, table); matched {
+			return false
+		}
+	}
+	if included {
+		return true
+	}
+
+	for _, pattern := range p.IncludeTables {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		if matched, _ := path.Match(pattern, table); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchColumn reports whether any pattern matches the column name or its
+// table-qualified form. Invalid patterns never match.
+func MatchColumn(patterns []string, table, column string) bool {
+	qualified := table + "." + column
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, column); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, qualified); ok {
+			return true
+		}
+	}
+	return false
 }
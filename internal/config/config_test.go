@@ -0,0 +1,879 @@
+package config
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// loadYAML loads a configuration file holding content
+func loadYAML(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+// validateCase changes the default configuration and expects Validate to
+// fail with an error containing errText, or succeed when errText is empty
+type validateCase struct {
+	name    string
+	change  func(c *Config)
+	errText string
+}
+
+// runValidateCases runs Validate on the default configuration changed by
+// each case
+func runValidateCases(t *testing.T, tests []validateCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.errText == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Fatalf("Validate error = %v, want it to contain %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestValidateDgraphTransport(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "http", change: func(c *Config) { c.Dgraph.Transport = "http" }},
+		{name: "grpc", change: func(c *Config) { c.Dgraph.Transport = "grpc" }},
+		{name: "unknown", change: func(c *Config) { c.Dgraph.Transport = "tcp" }, errText: "dgraph transport must be http or grpc"},
+		{name: "http without endpoint", change: func(c *Config) { c.Dgraph.HTTPAlpha = "" }, errText: "http_alpha is required"},
+		{name: "grpc ignores http_alpha", change: func(c *Config) {
+			c.Dgraph.Transport = "grpc"
+			c.Dgraph.HTTPAlpha = ""
+		}},
+		{name: "grpc without alphas", change: func(c *Config) {
+			c.Dgraph.Transport = "grpc"
+			c.Dgraph.Alpha = nil
+		}, errText: "at least one dgraph alpha"},
+		{name: "tls with a plain http endpoint", change: func(c *Config) {
+			c.Dgraph.TLS.Enabled = true
+			c.Dgraph.HTTPAlpha = "http://localhost:8080"
+		}, errText: "requires an https http_alpha"},
+		{name: "tls over grpc", change: func(c *Config) {
+			c.Dgraph.Transport = "grpc"
+			c.Dgraph.TLS.Enabled = true
+			c.Dgraph.HTTPAlpha = "http://localhost:8080"
+		}},
+	})
+}
+
+func TestDgraphEndpoint(t *testing.T) {
+	tests := []struct {
+		transport string
+		want      string
+	}{
+		{"http", "localhost:8080"},
+		{"grpc", "alpha1:9080,alpha2:9080"},
+	}
+	for _, tt := range tests {
+		d := DgraphConfig{Transport: tt.transport, HTTPAlpha: "localhost:8080", Alpha: []string{"alpha1:9080", "alpha2:9080"}}
+		if got := d.Endpoint(); got != tt.want {
+			t.Errorf("Endpoint() with %s = %q, want %q", tt.transport, got, tt.want)
+		}
+	}
+}
+
+func TestIsBooleanColumn(t *testing.T) {
+	output := OutputConfig{BooleanColumns: []string{"is_*", "posts.flag_id", "*.has_avatar"}}
+	tests := []struct {
+		table, column string
+		want          bool
+	}{
+		{"users", "is_deleted", true},
+		{"posts", "flag_id", true},
+		{"comments", "flag_id", false},
+		{"users", "has_avatar", true},
+		{"users", "avatar", false},
+		{"users", "this_is_id", false},
+	}
+	for _, tt := range tests {
+		if got := output.IsBooleanColumn(tt.table, tt.column); got != tt.want {
+			t.Errorf("IsBooleanColumn(%s, %s) = %v, want %v", tt.table, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDatetimeIndex(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{
+			name: "year default with a day override",
+			change: func(c *Config) {
+				c.Output.DatetimeIndexGranularity = "year"
+				c.Output.DatetimeIndexOverrides = map[string]string{"events.starts_at": "day"}
+			},
+		},
+		{
+			name:    "unknown default",
+			change:  func(c *Config) { c.Output.DatetimeIndexGranularity = "minute" },
+			errText: `invalid datetime index granularity "minute"`,
+		},
+		{
+			name:    "empty default",
+			change:  func(c *Config) { c.Output.DatetimeIndexGranularity = "" },
+			errText: "invalid datetime index granularity",
+		},
+		{
+			name:    "unknown override",
+			change:  func(c *Config) { c.Output.DatetimeIndexOverrides = map[string]string{"users.birth_date": "Year"} },
+			errText: `invalid datetime index granularity "Year" for users.birth_date`,
+		},
+	})
+}
+
+func TestDatetimeGranularity(t *testing.T) {
+	output := OutputConfig{
+		DatetimeIndexGranularity: "day",
+		DatetimeIndexOverrides:   map[string]string{"users.birth_date": "year"},
+	}
+	tests := []struct {
+		table, column string
+		want          string
+	}{
+		{"users", "birth_date", "year"},
+		{"users", "created_at", "day"},
+		{"authors", "birth_date", "day"},
+	}
+	for _, tt := range tests {
+		if got := output.DatetimeGranularity(tt.table, tt.column); got != tt.want {
+			t.Errorf("DatetimeGranularity(%s, %s) = %q, want %q", tt.table, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidGranularity(t *testing.T) {
+	_, err := loadYAML(t, "mysql:\n  database: shop\noutput:\n  datetime_index_overrides:\n    users.birth_date: decade\n")
+	if err == nil || !strings.Contains(err.Error(), `"decade" for users.birth_date`) {
+		t.Fatalf("Load error = %v, want the invalid granularity", err)
+	}
+}
+
+func TestValidateMappingFormat(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{"text", func(c *Config) { c.Output.MappingFormat = "text" }, ""},
+		{"json", func(c *Config) { c.Output.MappingFormat = "json" }, ""},
+		{"csv", func(c *Config) { c.Output.MappingFormat = "csv" }, ""},
+		{"binary", func(c *Config) { c.Output.MappingFormat = "binary" }, ""},
+		{"unknown", func(c *Config) { c.Output.MappingFormat = "xml" }, "mapping format must be text, json, csv or binary"},
+	})
+}
+
+func TestDefaultMappingFileMatchesFormat(t *testing.T) {
+	out := DefaultConfig().Output
+	if out.MappingFormat != "text" || !strings.HasSuffix(out.MappingFile, ".txt") {
+		t.Errorf("default mapping file %q does not suit format %q", out.MappingFile, out.MappingFormat)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		errTexts []string // Every one must appear; none means the file loads
+	}{
+		{name: "known keys", content: "mysql:\n  database: shop\n  max_connections: 5\n"},
+		{
+			name:     "misspelled section",
+			content:  "mysql:\n  database: shop\npiepline:\n  workers: 2\n",
+			errTexts: []string{"unknown configuration keys (check the spelling)", "line 3: unknown key piepline"},
+		},
+		{
+			name:     "misspelled nested keys",
+			content:  "mysql:\n  database: shop\n  max_connection: 5\npipeline:\n  worker: 2\n",
+			errTexts: []string{"line 3: unknown key max_connection", "line 5: unknown key worker"},
+		},
+		{
+			name:     "unknown key and a wrong type",
+			content:  "mysql:\n  database: shop\n  port: many\n  hots: db\n",
+			errTexts: []string{"line 4: unknown key hots", "cannot unmarshal"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, tt.content)
+			if len(tt.errTexts) == 0 {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, text := range tt.errTexts {
+				if !strings.Contains(err.Error(), text) {
+					t.Errorf("Load error = %v, want it to contain %q", err, text)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadShippedConfig checks the example configuration loads, so it lists
+// no unknown keys
+func TestLoadShippedConfig(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "config", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadYAML(t, string(data)); err != nil {
+		t.Errorf("Load: %v", err)
+	}
+}
+
+// envOverrideNames are the environment variables overrideWithEnv reads
+var envOverrideNames = []string{
+	"MYSQL_HOST", "MYSQL_PORT", "MYSQL_USER", "MYSQL_PASSWORD", "MYSQL_DATABASE", "MYSQL_TIMEOUT",
+	"MYSQL_MAX_CONNECTIONS", "MYSQL_TIMEZONE", "DGRAPH_ALPHA", "DGRAPH_BATCH_SIZE", "DGRAPH_TIMEOUT",
+	"DGRAPH_MAX_RETRIES", "DGRAPH_AUTH_TOKEN", "PIPELINE_WORKERS", "PIPELINE_BATCH_SIZE", "PIPELINE_DRY_RUN",
+	"LOG_LEVEL", "LOG_FORMAT", "LOG_OUTPUT", "OUTPUT_DIR", "OUTPUT_RDF_FILE",
+}
+
+func TestEnvOverrides(t *testing.T) {
+	tests := []struct {
+		env     string
+		value   string
+		check   func(c *Config) bool
+		errText string
+	}{
+		{env: "MYSQL_TIMEOUT", value: "45s", check: func(c *Config) bool { return c.MySQL.Timeout == 45*time.Second }},
+		{env: "MYSQL_MAX_CONNECTIONS", value: "32", check: func(c *Config) bool { return c.MySQL.MaxConnections == 32 }},
+		{env: "MYSQL_PASSWORD", value: "from-secret-manager", check: func(c *Config) bool { return c.MySQL.Password == "from-secret-manager" }},
+		{env: "DGRAPH_BATCH_SIZE", value: "250", check: func(c *Config) bool { return c.Dgraph.BatchSize == 250 }},
+		{env: "DGRAPH_TIMEOUT", value: "2m", check: func(c *Config) bool { return c.Dgraph.Timeout == 2*time.Minute }},
+		{env: "DGRAPH_MAX_RETRIES", value: "7", check: func(c *Config) bool { return c.Dgraph.MaxRetries == 7 }},
+		{env: "DGRAPH_ALPHA", value: "alpha1:9080, alpha2:9080,,alpha3:9080", check: func(c *Config) bool {
+			return strings.Join(c.Dgraph.Alpha, "|") == "alpha1:9080|alpha2:9080|alpha3:9080"
+		}},
+		{env: "PIPELINE_DRY_RUN", value: "true", check: func(c *Config) bool { return c.Pipeline.DryRun }},
+		{env: "OUTPUT_RDF_FILE", value: "export.rdf", check: func(c *Config) bool { return c.Output.RDFFile == "export.rdf" }},
+		{env: "LOG_FORMAT", value: "json", check: func(c *Config) bool { return c.Logger.Format == "json" }},
+		{env: "MYSQL_TIMEOUT", value: "45", errText: `MYSQL_TIMEOUT: invalid duration "45"`},
+		{env: "MYSQL_MAX_CONNECTIONS", value: "many", errText: `MYSQL_MAX_CONNECTIONS: invalid integer "many"`},
+		{env: "PIPELINE_DRY_RUN", value: "maybe", errText: `PIPELINE_DRY_RUN: invalid boolean "maybe"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env+"="+tt.value, func(t *testing.T) {
+			for _, name := range envOverrideNames {
+				t.Setenv(name, "")
+			}
+			t.Setenv(tt.env, tt.value)
+
+			cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("Load error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("%s=%s not applied", tt.env, tt.value)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidDatePolicy(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "skip", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "skip" }},
+		{name: "null", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "null" }},
+		{name: "epoch", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "epoch" }},
+		{name: "string", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "string" }},
+		{name: "unknown", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "zero" }, errText: "invalid_date_policy must be"},
+		{name: "empty", change: func(c *Config) { c.MySQL.InvalidDatePolicy = "" }, errText: "invalid_date_policy must be"},
+	})
+}
+
+func TestValidateRetry(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "no MySQL retries", change: func(c *Config) { c.Retry.MaxRetries = 0 }},
+		{name: "negative max_retries", change: func(c *Config) { c.Retry.MaxRetries = -1 }, errText: "retry max_retries must not be negative"},
+		{name: "negative delay", change: func(c *Config) { c.Retry.Delay = -time.Second }, errText: "retry delay must not be negative"},
+		{name: "negative max_delay", change: func(c *Config) { c.Retry.MaxDelay = -time.Second }, errText: "retry max_delay must not be negative"},
+		{name: "rule with two matchers", change: func(c *Config) {
+			c.Retry.Rules = []RetryRule{{MySQLCode: 1205, Contains: "lock"}}
+		}, errText: "retry rule 1 must set exactly one"},
+	})
+}
+
+func TestValidateShards(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "one file", change: func(c *Config) { c.Output.Shards = 1 }},
+		{name: "four shards", change: func(c *Config) { c.Output.Shards = 4 }},
+		{name: "negative", change: func(c *Config) { c.Output.Shards = -1 }, errText: "output shards must not be negative"},
+		{name: "json output", change: func(c *Config) { c.Output.Shards, c.Output.Format = 4, "json" },
+			errText: "output shards require rdf output to a file"},
+		{name: "with chunks", change: func(c *Config) { c.Output.Shards, c.Output.ChunkSize = 4, 100 },
+			errText: "chunk_size requires unsharded rdf output"},
+	})
+}
+
+func TestRDFFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		shards      int
+		compression string
+		want        []string
+	}{
+		{name: "unsharded", want: []string{"data.rdf"}},
+		{name: "one shard", shards: 1, want: []string{"data.rdf"}},
+		{name: "three shards", shards: 3, want: []string{"data_shard_0.rdf", "data_shard_1.rdf", "data_shard_2.rdf"}},
+		{name: "compressed shards", shards: 2, compression: "gzip", want: []string{"data_shard_0.rdf.gz", "data_shard_1.rdf.gz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := OutputConfig{RDFFile: "data.rdf", Shards: tt.shards, Compression: tt.compression}
+			if got := o.RDFFiles(); !slices.Equal(got, tt.want) {
+				t.Errorf("RDFFiles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDefaultTimezone(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "UTC", change: func(c *Config) { c.MySQL.DefaultTimezone = "UTC" }},
+		{name: "empty", change: func(c *Config) { c.MySQL.DefaultTimezone = "" }},
+		{name: "unknown zone", change: func(c *Config) { c.MySQL.DefaultTimezone = "Mars/Olympus" }, errText: "mysql default_timezone"},
+	})
+}
+
+func TestValidateWarmupConnections(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "none", change: func(c *Config) { c.MySQL.WarmupConnections = 0 }},
+		{name: "all", change: func(c *Config) { c.MySQL.WarmupConnections = c.MySQL.MaxConnections }},
+		{name: "negative", change: func(c *Config) { c.MySQL.WarmupConnections = -1 },
+			errText: "warmup_connections must be between 0 and max_connections"},
+		{name: "over max_connections", change: func(c *Config) { c.MySQL.WarmupConnections = c.MySQL.MaxConnections + 1 },
+			errText: "warmup_connections must be between 0 and max_connections"},
+		{name: "unlimited connections", change: func(c *Config) { c.MySQL.MaxConnections, c.MySQL.WarmupConnections = 0, 8 }},
+	})
+}
+
+func TestIncludesTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		included []string
+		excluded []string
+	}{
+		{
+			name:     "no patterns",
+			included: []string{"wp_posts", "audit_log", "users"},
+		},
+		{
+			name:     "include only",
+			include:  []string{"wp_*"},
+			included: []string{"wp_posts", "wp_users"},
+			excluded: []string{"users", "audit_log"},
+		},
+		{
+			name:     "exclude only",
+			exclude:  []string{"*_log"},
+			included: []string{"wp_posts", "users"},
+			excluded: []string{"audit_log", "wp_log"},
+		},
+		{
+			name:     "exclude wins over an overlapping include",
+			include:  []string{"wp_*"},
+			exclude:  []string{"*_log"},
+			included: []string{"wp_posts"},
+			excluded: []string{"wp_log", "audit_log", "users"},
+		},
+		{
+			name:     "negated include",
+			include:  []string{"wp_*", "!wp_cache*"},
+			included: []string{"wp_posts"},
+			excluded: []string{"wp_cache", "wp_cache_meta", "users"},
+		},
+		{
+			name:     "negation alone keeps everything else",
+			include:  []string{"!audit_*"},
+			included: []string{"users", "wp_posts"},
+			excluded: []string{"audit_log"},
+		},
+		{
+			name:     "several includes",
+			include:  []string{"users", "order?"},
+			included: []string{"users", "orders"},
+			excluded: []string{"order_items", "user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PipelineConfig{IncludeTables: tt.include, ExcludeTables: tt.exclude}
+			for _, table := range tt.included {
+				if !p.IncludesTable(table) {
+					t.Errorf("%s is excluded", table)
+				}
+			}
+			for _, table := range tt.excluded {
+				if p.IncludesTable(table) {
+					t.Errorf("%s is included", table)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTablePatterns(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "globs", change: func(c *Config) {
+			c.Pipeline.IncludeTables, c.Pipeline.ExcludeTables = []string{"wp_*", "!audit_*"}, []string{"*_log"}
+		}},
+		{name: "bad include", change: func(c *Config) { c.Pipeline.IncludeTables = []string{"wp_["} }, errText: `invalid table pattern "wp_["`},
+		{name: "bad negated include", change: func(c *Config) { c.Pipeline.IncludeTables = []string{"![a-"} }, errText: `invalid table pattern "![a-"`},
+		{name: "bad exclude", change: func(c *Config) { c.Pipeline.ExcludeTables = []string{"log\\"} }, errText: "invalid table pattern"},
+	})
+}
+
+func TestValidateColumnRules(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "every action", change: func(c *Config) {
+			c.Pipeline.ColumnRules = map[string]string{"users.password": "drop", "users.ssn": "hash", "users.token": "redact"}
+		}},
+		{name: "unknown action", change: func(c *Config) { c.Pipeline.ColumnRules = map[string]string{"users.password": "encrypt"} },
+			errText: "column rule for users.password must be drop, hash or redact"},
+		{name: "column without table", change: func(c *Config) { c.Pipeline.ColumnRules = map[string]string{"password": "drop"} },
+			errText: "column rule password must be named table.column"},
+	})
+}
+
+func TestValidatePluralizationOverrides(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "override", change: func(c *Config) { c.Output.PluralizationOverrides = map[string]string{"person": "persons"} }},
+		{name: "empty plural", change: func(c *Config) { c.Output.PluralizationOverrides = map[string]string{"person": ""} },
+			errText: "pluralization_overrides entries need both a singular and a plural"},
+		{name: "empty singular", change: func(c *Config) { c.Output.PluralizationOverrides = map[string]string{"": "people"} },
+			errText: "pluralization_overrides entries need both a singular and a plural"},
+	})
+}
+
+func TestValidateMemoryLimit(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "unlimited", change: func(c *Config) { c.Pipeline.MemoryLimit = 0 }},
+		{name: "limit", change: func(c *Config) { c.Pipeline.MemoryLimit = 512 }},
+		{name: "negative", change: func(c *Config) { c.Pipeline.MemoryLimit = -1 }, errText: "memory_limit_mb must be >= 0"},
+	})
+}
+
+func TestValidateMetricsPort(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "default port", change: func(c *Config) {}},
+		{name: "disabled", change: func(c *Config) { c.Pipeline.EnableMetrics = false; c.Pipeline.MetricsPort = 0 }},
+		{name: "zero", change: func(c *Config) { c.Pipeline.EnableMetrics = true; c.Pipeline.MetricsPort = 0 },
+			errText: "metrics_port must be between 1 and 65535"},
+		{name: "too large", change: func(c *Config) { c.Pipeline.EnableMetrics = true; c.Pipeline.MetricsPort = 70000 },
+			errText: "metrics_port must be between 1 and 65535"},
+	})
+}
+
+func TestValidateLoggerRotation(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "rotation", change: func(c *Config) { c.Logger.MaxSizeMB = 100; c.Logger.MaxBackups = 5 }},
+		{name: "negative size", change: func(c *Config) { c.Logger.MaxSizeMB = -1 }, errText: "max_size_mb and max_backups must be >= 0"},
+		{name: "negative backups", change: func(c *Config) { c.Logger.MaxBackups = -1 }, errText: "max_size_mb and max_backups must be >= 0"},
+	})
+}
+
+func TestValidateUIDMapSpillThreshold(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "never spill", change: func(c *Config) { c.Pipeline.UIDMapSpillThreshold = 0 }},
+		{name: "deterministic", change: func(c *Config) { c.Pipeline.DeterministicUIDs = true }},
+		{name: "negative", change: func(c *Config) { c.Pipeline.UIDMapSpillThreshold = -1 }, errText: "uid_map_spill_threshold must be >= 0"},
+	})
+}
+
+func TestConnectionString(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(m *MySQLConfig)
+		primary string // Whole DSN of the primary
+		read    string // Address of the read connection
+		params  map[string]string
+		replica bool
+	}{
+		{
+			name:    "defaults",
+			change:  func(m *MySQLConfig) {},
+			primary: "root:root@tcp(localhost:3306)/dump?parseTime=false&timeout=30s",
+			read:    "localhost:3306",
+		},
+		{
+			name: "dsn params sorted and escaped",
+			change: func(m *MySQLConfig) {
+				m.DSNParams = map[string]string{"readTimeout": "1m", "charset": "utf8mb4", "collation": "utf8mb4_unicode_ci", "connectionAttributes": "app:pipeline,env:a b"}
+			},
+			primary: "root:root@tcp(localhost:3306)/dump?parseTime=false&timeout=30s" +
+				"&charset=utf8mb4&collation=utf8mb4_unicode_ci&connectionAttributes=app%3Apipeline%2Cenv%3Aa+b&readTimeout=1m",
+			read:   "localhost:3306",
+			params: map[string]string{"charset": "utf8mb4", "connectionAttributes": "app:pipeline,env:a b"},
+		},
+		{
+			name:    "replica on the primary port",
+			change:  func(m *MySQLConfig) { m.ReadHost = "replica" },
+			primary: "root:root@tcp(localhost:3306)/dump?parseTime=false&timeout=30s",
+			read:    "replica:3306",
+			replica: true,
+		},
+		{
+			name: "replica with its own port and params",
+			change: func(m *MySQLConfig) {
+				m.ReadHost, m.ReadPort = "replica", 3307
+				m.DSNParams = map[string]string{"charset": "utf8mb4"}
+			},
+			primary: "root:root@tcp(localhost:3306)/dump?parseTime=false&timeout=30s&charset=utf8mb4",
+			read:    "replica:3307",
+			params:  map[string]string{"charset": "utf8mb4"},
+			replica: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := DefaultConfig().MySQL
+			tt.change(&m)
+			if got := m.ConnectionString(); got != tt.primary {
+				t.Errorf("ConnectionString = %q, want %q", got, tt.primary)
+			}
+			if m.HasReadReplica() != tt.replica {
+				t.Errorf("HasReadReplica = %v, want %v", m.HasReadReplica(), tt.replica)
+			}
+
+			read, err := mysql.ParseDSN(m.ReadConnectionString())
+			if err != nil {
+				t.Fatalf("ParseDSN(%q): %v", m.ReadConnectionString(), err)
+			}
+			if read.Addr != tt.read || read.DBName != "dump" || read.ParseTime || read.Timeout != 30*time.Second {
+				t.Errorf("read connection %s/%s parseTime %v timeout %v, want %s/dump", read.Addr, read.DBName, read.ParseTime, read.Timeout, tt.read)
+			}
+			for key, value := range tt.params {
+				var got string
+				switch key {
+				case "charset":
+					// The driver keeps the charset unexported
+					if strings.Contains(read.FormatDSN(), "charset="+value) {
+						got = value
+					}
+				case "connectionAttributes":
+					got = read.ConnectionAttributes
+				}
+				if got != value {
+					t.Errorf("read connection %s = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDSNParams(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "allowed params", change: func(c *Config) {
+			c.MySQL.DSNParams = map[string]string{"charset": "utf8mb4", "maxAllowedPacket": "67108864", "writeTimeout": "30s"}
+		}},
+		{name: "pipeline param", change: func(c *Config) { c.MySQL.DSNParams = map[string]string{"parseTime": "true"} },
+			errText: `unsupported parameter "parseTime"`},
+		{name: "unknown param", change: func(c *Config) { c.MySQL.DSNParams = map[string]string{"charset": "utf8mb4", "colation": "x"} },
+			errText: `unsupported parameter "colation"`},
+		{name: "replica port", change: func(c *Config) { c.MySQL.ReadHost, c.MySQL.ReadPort = "replica", 3307 }},
+		{name: "negative replica port", change: func(c *Config) { c.MySQL.ReadPort = -1 },
+			errText: "read_port must be between 0 and 65535"},
+	})
+}
+
+func TestValidateBinaryPolicy(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "base64", change: func(c *Config) { c.MySQL.BinaryPolicy = "base64" }},
+		{name: "skip", change: func(c *Config) { c.MySQL.BinaryPolicy = "skip" }},
+		{name: "unknown", change: func(c *Config) { c.MySQL.BinaryPolicy = "hex" }, errText: "binary_policy must be base64 or skip"},
+	})
+}
+
+func TestValidateTableColumns(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "columns", change: func(c *Config) { c.Pipeline.TableColumns = map[string][]string{"users": {"name", "email"}} }},
+		{name: "empty list", change: func(c *Config) { c.Pipeline.TableColumns = map[string][]string{"users": {}} },
+			errText: "table_columns for users lists no columns"},
+	})
+}
+
+func TestValidateTableFilters(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "filter", change: func(c *Config) { c.Pipeline.TableFilters = map[string]string{"users": "deleted_at IS NULL"} }},
+		{name: "blank filter", change: func(c *Config) { c.Pipeline.TableFilters = map[string]string{"users": "  "} },
+			errText: "table_filters for users is empty"},
+	})
+}
+
+func TestValidateIncremental(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "disabled without a column", change: func(c *Config) { c.Pipeline.Incremental.WatermarkColumn = "" }},
+		{name: "enabled", change: func(c *Config) {
+			c.Pipeline.Incremental.Enabled, c.Pipeline.Incremental.WatermarkColumn = true, "updated_at"
+		}},
+		{name: "enabled without a column", change: func(c *Config) { c.Pipeline.Incremental.Enabled = true },
+			errText: "incremental requires watermark_column"},
+	})
+}
+
+func TestValidateUIDNamespace(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "none", change: func(c *Config) { c.Output.UIDNamespace = "" }},
+		{name: "database name", change: func(c *Config) { c.Output.UIDNamespace = "shop_eu-1" }},
+		{name: "space", change: func(c *Config) { c.Output.UIDNamespace = "my shop" },
+			errText: `uid_namespace "my shop" may only contain letters, digits, '_' and '-'`},
+		{name: "colon", change: func(c *Config) { c.Output.UIDNamespace = "shop:eu" },
+			errText: "may only contain letters, digits"},
+	})
+}
+
+func TestValidateResume(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "rdf file", change: func(c *Config) { c.Pipeline.Resume = true }},
+		{name: "json output", change: func(c *Config) { c.Pipeline.Resume, c.Output.Format = true, "json" },
+			errText: "pipeline resume requires rdf output to a file"},
+		{name: "dgraph target", change: func(c *Config) { c.Pipeline.Resume, c.Output.Target = true, "dgraph" },
+			errText: "pipeline resume requires rdf output to a file"},
+	})
+}
+
+func TestValidateDeltaColumns(t *testing.T) {
+	delta := func(c *Config) {
+		c.Pipeline.DeltaColumns, c.Output.EmitXID, c.Dgraph.ImportMode = true, true, "upsert"
+	}
+	const needsUpsert = "pipeline delta_columns requires rdf output to files with output.emit_xid, imported with dgraph.import_mode upsert on xid"
+	runValidateCases(t, []validateCase{
+		{name: "upsert on xid", change: delta},
+		{name: "without emit_xid", change: func(c *Config) { delta(c); c.Output.EmitXID = false }, errText: needsUpsert},
+		{name: "set import", change: func(c *Config) { delta(c); c.Dgraph.ImportMode = "set" }, errText: needsUpsert},
+		{name: "upsert on another predicate", change: func(c *Config) { delta(c); c.Dgraph.UpsertPredicate = "external_id" },
+			errText: needsUpsert},
+		{name: "dgraph target", change: func(c *Config) { delta(c); c.Output.Target = "dgraph" }, errText: needsUpsert},
+		{name: "json output", change: func(c *Config) { delta(c); c.Output.Format = "json" }, errText: needsUpsert},
+		{name: "no delete file", change: func(c *Config) { delta(c); c.Output.DeleteFile = "" },
+			errText: "pipeline delta_columns requires output.delete_file"},
+	})
+}
+
+func TestValidateProgressReportInterval(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "off", change: func(c *Config) { c.Pipeline.ProgressReportInterval = 0 }},
+		{name: "interval", change: func(c *Config) { c.Pipeline.ProgressReportInterval = 10 * time.Second }},
+		{name: "negative", change: func(c *Config) { c.Pipeline.ProgressReportInterval = -time.Second },
+			errText: "progress_report_interval must be >= 0"},
+	})
+}
+
+func TestValidateWorkersAndConnections(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "as many workers as connections", change: func(c *Config) { c.Pipeline.Workers, c.MySQL.MaxConnections = 8, 8 }},
+		{name: "fewer workers", change: func(c *Config) { c.Pipeline.Workers, c.MySQL.MaxConnections = 2, 8 }},
+		{name: "unlimited connections", change: func(c *Config) { c.Pipeline.Workers, c.MySQL.MaxConnections = 64, 0 }},
+		{name: "more workers", change: func(c *Config) { c.Pipeline.Workers, c.MySQL.MaxConnections = 9, 8 },
+			errText: "pipeline workers (9) must not exceed mysql max_connections (8)"},
+	})
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *Config)
+		warnings []string // Substrings of each warning, in order
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{name: "dry run to a file", change: func(c *Config) { c.Pipeline.DryRun = true }},
+		{name: "dry run to dgraph", change: func(c *Config) { c.Pipeline.DryRun, c.Output.Target = true, "dgraph" },
+			warnings: []string{"output target dgraph is ignored"}},
+		{name: "batches within the memory limit", change: func(c *Config) {
+			c.Pipeline.Workers, c.Pipeline.BatchSize, c.Pipeline.MemoryLimit = 4, 1000, 512
+		}},
+		{name: "batches above the memory limit", change: func(c *Config) {
+			c.Pipeline.Workers, c.Pipeline.BatchSize, c.Pipeline.MemoryLimit = 4, 100000, 100
+		}, warnings: []string{"keeps 400000 rows in flight, about 390 MB at 1 KB a row, above memory_limit_mb 100"}},
+		{name: "no memory limit", change: func(c *Config) {
+			c.Pipeline.Workers, c.Pipeline.BatchSize, c.Pipeline.MemoryLimit = 4, 100000, 0
+		}},
+		{name: "both", change: func(c *Config) {
+			c.Pipeline.DryRun, c.Output.Target = true, "dgraph"
+			c.Pipeline.Workers, c.Pipeline.BatchSize, c.Pipeline.MemoryLimit = 4, 100000, 100
+		}, warnings: []string{"dry_run", "memory_limit_mb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(cfg)
+			got := cfg.Warnings()
+			if len(got) != len(tt.warnings) {
+				t.Fatalf("Warnings = %q, want %d", got, len(tt.warnings))
+			}
+			for i, want := range tt.warnings {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("warning %q, want it to contain %q", got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDgraphParallel(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "ordered", change: func(c *Config) { c.Dgraph.Parallel = 1 }},
+		{name: "parallel", change: func(c *Config) { c.Dgraph.Parallel = 8 }},
+		{name: "zero", change: func(c *Config) { c.Dgraph.Parallel = 0 }, errText: "dgraph parallel must be at least 1"},
+	})
+}
+
+func TestValidateImportMode(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "set", change: func(c *Config) { c.Dgraph.ImportMode = "set" }},
+		{name: "upsert", change: func(c *Config) { c.Dgraph.ImportMode = "upsert" }},
+		{name: "upsert without a predicate", change: func(c *Config) { c.Dgraph.ImportMode, c.Dgraph.UpsertPredicate = "upsert", "" },
+			errText: "dgraph upsert_predicate is required for import_mode upsert"},
+		{name: "unknown", change: func(c *Config) { c.Dgraph.ImportMode = "merge" }, errText: "dgraph import_mode must be set or upsert"},
+	})
+}
+
+func TestValidateRelationshipConfidence(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "bounds", change: func(c *Config) {
+			c.Pipeline.RelationshipConfidence, c.Pipeline.RelationshipOverrideConfidence = 0, 1
+		}},
+		{name: "confidence above 1", change: func(c *Config) { c.Pipeline.RelationshipConfidence = 1.1 },
+			errText: "pipeline relationship_confidence must be between 0 and 1"},
+		{name: "negative confidence", change: func(c *Config) { c.Pipeline.RelationshipConfidence = -0.1 },
+			errText: "pipeline relationship_confidence must be between 0 and 1"},
+		{name: "override above 1", change: func(c *Config) { c.Pipeline.RelationshipOverrideConfidence = 2 },
+			errText: "pipeline relationship_override_confidence must be between 0 and 1"},
+		{name: "analysis sample size", change: func(c *Config) { c.Pipeline.AnalyzeRelationships, c.Pipeline.AnalysisSampleSize = true, 0 },
+			errText: "pipeline analysis sample size must be positive"},
+	})
+}
+
+func TestValidateRelationshipSampling(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{name: "unbounded", change: func(c *Config) { c.Pipeline.RelationshipSampleSize, c.Pipeline.RelationshipMaxTableRows = 0, 0 }},
+		{name: "bounded", change: func(c *Config) {
+			c.Pipeline.RelationshipSampleSize, c.Pipeline.RelationshipMaxTableRows = 1000, 1000000
+		}},
+		{name: "negative sample size", change: func(c *Config) { c.Pipeline.RelationshipSampleSize = -1 },
+			errText: "pipeline relationship_sample_size cannot be negative"},
+		{name: "negative max table rows", change: func(c *Config) { c.Pipeline.RelationshipMaxTableRows = -1 },
+			errText: "pipeline relationship_max_table_rows cannot be negative"},
+	})
+}
+
+func TestTableRDFFile(t *testing.T) {
+	tests := []struct {
+		rdfFile     string
+		compression string
+		want        string
+	}{
+		{rdfFile: "data.rdf", want: "data_users.rdf"},
+		{rdfFile: "export.nquads", want: "export_users.nquads"},
+		{rdfFile: "data.rdf", compression: "gzip", want: "data_users.rdf.gz"},
+	}
+	for _, tt := range tests {
+		o := OutputConfig{RDFFile: tt.rdfFile, Compression: tt.compression}
+		if got := o.TableRDFFile("users"); got != tt.want {
+			t.Errorf("TableRDFFile(users) of %s = %q, want %q", tt.rdfFile, got, tt.want)
+		}
+		if matched, _ := path.Match(o.TableRDFPattern(), tt.want); !matched {
+			t.Errorf("TableRDFPattern %q does not match %q", o.TableRDFPattern(), tt.want)
+		}
+	}
+}
+
+func TestValidateSplitByTable(t *testing.T) {
+	const errText = "output split_by_table requires unsharded, unchunked rdf output to a file"
+	runValidateCases(t, []validateCase{
+		{name: "rdf file", change: func(c *Config) { c.Output.SplitByTable = true }},
+		{name: "json", change: func(c *Config) { c.Output.SplitByTable, c.Output.Format = true, "json" }, errText: errText},
+		{name: "sharded", change: func(c *Config) { c.Output.SplitByTable, c.Output.Shards = true, 2 }, errText: errText},
+		{name: "chunked", change: func(c *Config) { c.Output.SplitByTable, c.Output.ChunkSize = true, 100 }, errText: errText},
+		{name: "dgraph target", change: func(c *Config) { c.Output.SplitByTable, c.Output.Target = true, "dgraph" }, errText: errText},
+	})
+}
+
+func TestValidateIdentifiers(t *testing.T) {
+	runValidateCases(t, []validateCase{
+		{
+			name:   "a plain database name",
+			change: func(c *Config) { c.MySQL.Database = "shop_2024$" },
+		},
+		{
+			name:    "a database name closing its quotes",
+			change:  func(c *Config) { c.MySQL.Database = "shop`; DROP DATABASE shop; --" },
+			errText: "mysql database",
+		},
+		{
+			name:    "a database name with a space",
+			change:  func(c *Config) { c.MySQL.Database = "my shop" },
+			errText: "mysql database",
+		},
+		{
+			name:    "a databases entry with a quote",
+			change:  func(c *Config) { c.MySQL.Databases = []string{"shop", "x' OR '1'='1"} },
+			errText: "mysql databases entry",
+		},
+		{
+			name: "a watermark column with a comment",
+			change: func(c *Config) {
+				c.Pipeline.Incremental.WatermarkColumn = "updated_at/**/"
+			},
+			errText: "watermark_column",
+		},
+		{
+			name:    "a key column with a backtick",
+			change:  func(c *Config) { c.Output.KeyColumns = map[string][]string{"users": {"email`"}} },
+			errText: "output key_columns for users",
+		},
+		{
+			name:   "a reserved word as key column",
+			change: func(c *Config) { c.Output.KeyColumns = map[string][]string{"users": {"order"}} },
+		},
+	})
+}
+
+func TestValidateJSONUpsert(t *testing.T) {
+	const errText = "output json_upsert requires json output to files"
+	runValidateCases(t, []validateCase{
+		{name: "json files with xids", change: func(c *Config) {
+			c.Output.JSONUpsert, c.Output.Format, c.Output.EmitXID = true, "json", true
+		}},
+		{name: "rdf", change: func(c *Config) { c.Output.JSONUpsert, c.Output.EmitXID = true, true }, errText: errText},
+		{name: "dgraph target", change: func(c *Config) {
+			c.Output.JSONUpsert, c.Output.Format, c.Output.Target, c.Output.EmitXID = true, "json", "dgraph", true
+		}, errText: errText},
+		{name: "without xids", change: func(c *Config) { c.Output.JSONUpsert, c.Output.Format = true, "json" },
+			errText: "output json_upsert requires emit_xid"},
+	})
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MySQLTLSConfigName is the name the custom TLS configuration is registered
+// under with the MySQL driver
+const MySQLTLSConfigName = "mysql_to_dgraph"
+
+// validateTLS checks the TLS mode and that referenced certificate files exist
+func (m *MySQLConfig) validateTLS() error {
+	switch m.TLS {
+	case "", "disabled", "preferred", "required":
+	case "verify-ca", "verify-identity":
+		if m.CACert == "" {
+			return fmt.Errorf("mysql tls %s requires ca_cert", m.TLS)
+		}
+	default:
+		return fmt.Errorf("mysql tls must be disabled, preferred, required, verify-ca or verify-identity")
+	}
+
+	if (m.ClientCert == "") != (m.ClientKey == "") {
+		return fmt.Errorf("mysql client_cert and client_key must be set together")
+	}
+	for _, file := range []string{m.CACert, m.ClientCert, m.ClientKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("mysql tls file %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// tlsParam returns the DSN tls parameter for the configured mode
+func (m *MySQLConfig) tlsParam() string {
+	switch m.TLS {
+	case "", "disabled":
+		return ""
+	case "preferred":
+		// The driver's built-in mode: TLS without verification when the
+		// server supports it, plain text otherwise
+		return "preferred"
+	default:
+		return MySQLTLSConfigName
+	}
+}
+
+// TLSConfig builds the TLS configuration to register with the MySQL driver.
+// It returns nil for the disabled and preferred modes, which need none.
+func (m *MySQLConfig) TLSConfig() (*tls.Config, error) {
+	if m.tlsParam() != MySQLTLSConfigName {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if m.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(m.ClientCert, m.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if m.CACert != "" {
+		pem, err := os.ReadFile(m.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert %s contains no PEM certificates", m.CACert)
+		}
+	}
+
+	switch m.TLS {
+	case "required":
+		// Encrypt without verifying the server certificate
+		tlsConfig.InsecureSkipVerify = true
+	case "verify-ca":
+		// Verify the chain against the CA but not the host name, which often
+		// differs from the certificate for proxies and cloud endpoints
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	case "verify-identity":
+		tlsConfig.RootCAs = roots
+		tlsConfig.ServerName = m.Host
+	}
+
+	return tlsConfig, nil
+}
+
+// validateTLS checks that the Dgraph certificate files exist and that TLS
+// settings are not combined with a plain http endpoint for the http transport
+func (d *DgraphConfig) validateTLS() error {
+	if (d.TLS.ClientCert == "") != (d.TLS.ClientKey == "") {
+		return fmt.Errorf("dgraph tls client_cert and client_key must be set together")
+	}
+	for _, file := range []string{d.TLS.CACert, d.TLS.ClientCert, d.TLS.ClientKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("dgraph tls file %s: %w", file, err)
+		}
+	}
+	if d.TLS.enabled() && d.Transport == "http" && strings.HasPrefix(d.HTTPAlpha, "http://") {
+		return fmt.Errorf("dgraph tls requires an https http_alpha, got %s", d.HTTPAlpha)
+	}
+	return nil
+}
+
+// enabled reports whether any TLS setting is configured
+func (t DgraphTLSConfig) enabled() bool {
+	return t.Enabled || t.CACert != "" || t.ClientCert != "" || t.ServerName != ""
+}
+
+// TLSConfig builds the TLS configuration for connections to Dgraph. It
+// returns nil when no TLS settings are configured, leaving https endpoints
+// to the system roots and gRPC connections in plain text.
+func (d *DgraphConfig) TLSConfig() (*tls.Config, error) {
+	if !d.TLS.enabled() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: d.TLS.ServerName,
+	}
+
+	if d.TLS.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(d.TLS.ClientCert, d.TLS.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load dgraph client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if d.TLS.CACert != "" {
+		pem, err := os.ReadFile(d.TLS.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dgraph ca_cert: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert %s contains no PEM certificates", d.TLS.CACert)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyChain verifies a peer certificate chain against roots without
+// checking the host name
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -0,0 +1,266 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// node is an element of the expression tree
+type node interface {
+	eval(row Row) (Value, error)
+	columns(visit func(string))
+	typ(columnType func(string) string) string
+}
+
+type literalNode struct {
+	value Value
+}
+
+func (n *literalNode) eval(Row) (Value, error) {
+	return n.value, nil
+}
+
+func (n *literalNode) columns(func(string)) {}
+
+func (n *literalNode) typ(func(string) string) string {
+	if n.value.Kind == KindNumber {
+		return numberType(n.value.Num)
+	}
+	return "string"
+}
+
+type columnNode struct {
+	name string
+}
+
+func (n *columnNode) eval(row Row) (Value, error) {
+	value, ok := row[n.name]
+	if !ok {
+		return Null, fmt.Errorf("unknown column %s", n.name)
+	}
+	return value, nil
+}
+
+func (n *columnNode) columns(visit func(string)) {
+	visit(n.name)
+}
+
+func (n *columnNode) typ(columnType func(string) string) string {
+	return columnType(n.name)
+}
+
+// binaryNode applies an arithmetic operator. "+" concatenates unless both
+// operands are numbers.
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(row Row) (Value, error) {
+	left, err := n.left.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	right, err := n.right.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	if left.IsNull() || right.IsNull() {
+		return Null, nil
+	}
+
+	if n.op == "+" && !(left.isNumeric() && right.isNumeric()) {
+		return StringValue(left.format() + right.format()), nil
+	}
+
+	a, err := left.asNumber()
+	if err != nil {
+		return Null, fmt.Errorf("operator %s: %w", n.op, err)
+	}
+	b, err := right.asNumber()
+	if err != nil {
+		return Null, fmt.Errorf("operator %s: %w", n.op, err)
+	}
+
+	switch n.op {
+	case "+":
+		return NumberValue(a + b), nil
+	case "-":
+		return NumberValue(a - b), nil
+	case "*":
+		return NumberValue(a * b), nil
+	case "/":
+		if b == 0 {
+			return Null, nil
+		}
+		return NumberValue(a / b), nil
+	case "%":
+		if b == 0 {
+			return Null, nil
+		}
+		return NumberValue(math.Mod(a, b)), nil
+	}
+	return Null, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n *binaryNode) columns(visit func(string)) {
+	n.left.columns(visit)
+	n.right.columns(visit)
+}
+
+func (n *binaryNode) typ(columnType func(string) string) string {
+	left := n.left.typ(columnType)
+	right := n.right.typ(columnType)
+
+	if n.op == "+" && !(isNumericType(left) && isNumericType(right)) {
+		return "string"
+	}
+	if n.op == "/" || left == "float" || right == "float" {
+		return "float"
+	}
+	return "int"
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(row Row) (Value, error) {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(row)
+		if err != nil {
+			return Null, err
+		}
+		if value.IsNull() && !n.fn.nullSafe {
+			return Null, nil
+		}
+		args[i] = value
+	}
+
+	value, err := n.fn.call(args)
+	if err != nil {
+		return Null, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+func (n *callNode) columns(visit func(string)) {
+	for _, arg := range n.args {
+		arg.columns(visit)
+	}
+}
+
+func (n *callNode) typ(columnType func(string) string) string {
+	if n.fn.resultType != "" {
+		return n.fn.resultType
+	}
+	// COALESCE takes the type of its first argument
+	return n.args[0].typ(columnType)
+}
+
+// function describes a built-in function
+type function struct {
+	minArgs    int
+	maxArgs    int  // -1 for variadic
+	nullSafe   bool // Receives NULL arguments instead of short-circuiting to NULL
+	resultType string
+	call       func(args []Value) (Value, error)
+}
+
+var functions = map[string]function{
+	"CONCAT": {minArgs: 1, maxArgs: -1, resultType: "string", call: func(args []Value) (Value, error) {
+		var sb strings.Builder
+		for _, arg := range args {
+			sb.WriteString(arg.format())
+		}
+		return StringValue(sb.String()), nil
+	}},
+	"UPPER": {minArgs: 1, maxArgs: 1, resultType: "string", call: func(args []Value) (Value, error) {
+		return StringValue(strings.ToUpper(args[0].format())), nil
+	}},
+	"LOWER": {minArgs: 1, maxArgs: 1, resultType: "string", call: func(args []Value) (Value, error) {
+		return StringValue(strings.ToLower(args[0].format())), nil
+	}},
+	"TRIM": {minArgs: 1, maxArgs: 1, resultType: "string", call: func(args []Value) (Value, error) {
+		return StringValue(strings.TrimSpace(args[0].format())), nil
+	}},
+	"LENGTH": {minArgs: 1, maxArgs: 1, resultType: "int", call: func(args []Value) (Value, error) {
+		return NumberValue(float64(len([]rune(args[0].format())))), nil
+	}},
+	"ROUND": {minArgs: 1, maxArgs: 1, resultType: "int", call: func(args []Value) (Value, error) {
+		n, err := args[0].asNumber()
+		if err != nil {
+			return Null, err
+		}
+		return NumberValue(math.Round(n)), nil
+	}},
+	"COALESCE": {minArgs: 1, maxArgs: -1, nullSafe: true, call: func(args []Value) (Value, error) {
+		for _, arg := range args {
+			if !arg.IsNull() {
+				return arg, nil
+			}
+		}
+		return Null, nil
+	}},
+	"NOW": {minArgs: 0, maxArgs: 0, resultType: "datetime", call: func([]Value) (Value, error) {
+		return TimeValue(time.Now().UTC()), nil
+	}},
+	"YEAR": {minArgs: 1, maxArgs: 1, resultType: "int", call: func(args []Value) (Value, error) {
+		t, err := asTime(args[0])
+		if err != nil {
+			return Null, err
+		}
+		return NumberValue(float64(t.Year())), nil
+	}},
+	"MONTH": {minArgs: 1, maxArgs: 1, resultType: "int", call: func(args []Value) (Value, error) {
+		t, err := asTime(args[0])
+		if err != nil {
+			return Null, err
+		}
+		return NumberValue(float64(t.Month())), nil
+	}},
+	"DAY": {minArgs: 1, maxArgs: 1, resultType: "int", call: func(args []Value) (Value, error) {
+		t, err := asTime(args[0])
+		if err != nil {
+			return Null, err
+		}
+		return NumberValue(float64(t.Day())), nil
+	}},
+}
+
+// timeLayouts are the formats MySQL uses for DATE, DATETIME and TIMESTAMP text
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func asTime(v Value) (time.Time, error) {
+	if v.Kind == KindTime {
+		return v.Time, nil
+	}
+	text := strings.TrimSpace(v.format())
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date", text)
+}
+
+func numberType(n float64) string {
+	if n == math.Trunc(n) {
+		return "int"
+	}
+	return "float"
+}
+
+func isNumericType(dgraphType string) bool {
+	return dgraphType == "int" || dgraphType == "float"
+}
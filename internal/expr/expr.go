@@ -0,0 +1,151 @@
+// Package expr implements the small expression language used for derived predicates.
+// It supports column references, string and number literals, + - * / %, parentheses
+// and a fixed set of functions, and never executes anything outside that set.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind identifies the type of a Value
+type Kind int
+
+const (
+	KindNull Kind = iota
+	KindString
+	KindNumber
+	KindTime
+)
+
+// Value is the result of evaluating an expression
+type Value struct {
+	Kind Kind
+	Str  string
+	Num  float64
+	Time time.Time
+}
+
+// Null is the value of a NULL column or an expression that depends on one
+var Null = Value{Kind: KindNull}
+
+// StringValue wraps a string
+func StringValue(s string) Value {
+	return Value{Kind: KindString, Str: s}
+}
+
+// NumberValue wraps a number
+func NumberValue(n float64) Value {
+	return Value{Kind: KindNumber, Num: n}
+}
+
+// TimeValue wraps a point in time
+func TimeValue(t time.Time) Value {
+	return Value{Kind: KindTime, Time: t}
+}
+
+// IsNull reports whether the value is NULL
+func (v Value) IsNull() bool {
+	return v.Kind == KindNull
+}
+
+// String renders the value as it is written to RDF
+func (v Value) String() string {
+	return v.format()
+}
+
+func (v Value) isNumeric() bool {
+	return v.Kind == KindNumber
+}
+
+func (v Value) asNumber() (float64, error) {
+	switch v.Kind {
+	case KindNumber:
+		return v.Num, nil
+	case KindString:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.Str), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v.Str)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("value is not a number")
+	}
+}
+
+// format renders a value as an RDF literal body
+func (v Value) format() string {
+	switch v.Kind {
+	case KindString:
+		return v.Str
+	case KindNumber:
+		if v.Num == math.Trunc(v.Num) && math.Abs(v.Num) < 1e15 {
+			return strconv.FormatInt(int64(v.Num), 10)
+		}
+		return strconv.FormatFloat(v.Num, 'f', -1, 64)
+	case KindTime:
+		return v.Time.Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
+// Row supplies column values during evaluation
+type Row map[string]Value
+
+// Expr is a parsed expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// Parse compiles an expression
+func Parse(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+// Eval evaluates the expression against a row. Any NULL operand makes the
+// result NULL, except inside COALESCE.
+func (e *Expr) Eval(row Row) (Value, error) {
+	return e.root.eval(row)
+}
+
+// Columns returns the column names referenced by the expression
+func (e *Expr) Columns() []string {
+	var columns []string
+	seen := make(map[string]bool)
+	e.root.columns(func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, name)
+		}
+	})
+	return columns
+}
+
+// Type infers the Dgraph type of the result. columnType returns the Dgraph
+// type of a referenced column.
+func (e *Expr) Type(columnType func(string) string) string {
+	return e.root.typ(columnType)
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
@@ -0,0 +1,199 @@
+package expr
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	row := Row{
+		"first_name": StringValue("Ada"),
+		"last_name":  StringValue("Lovelace"),
+		"birth_year": NumberValue(1815),
+		"price":      NumberValue(2.5),
+		"qty":        NumberValue(4),
+		"code":       StringValue("42"),
+		"born":       StringValue("1815-12-10 08:30:00"),
+		"nickname":   Null,
+		"odd column": StringValue("x"),
+	}
+	tests := []struct {
+		source string
+		want   Value
+	}{
+		{"first_name + ' ' + last_name", StringValue("Ada Lovelace")},
+		{"CONCAT(first_name, ' ', last_name)", StringValue("Ada Lovelace")},
+		{"price * qty", NumberValue(10)},
+		{"price * qty - 1", NumberValue(9)},
+		{"price * (qty - 1)", NumberValue(7.5)},
+		{"qty / 8", NumberValue(0.5)},
+		{"qty % 3", NumberValue(1)},
+		{"-qty + 1", NumberValue(-3)},
+		{"qty / 0", Null},
+		{"qty % 0", Null},
+		{"code * 2", NumberValue(84)},    // Numeric strings take part in arithmetic
+		{"code + 1", StringValue("421")}, // but "+" with a string concatenates
+		{"2024 - birth_year", NumberValue(209)},
+		{"YEAR(born)", NumberValue(1815)},
+		{"MONTH(born)", NumberValue(12)},
+		{"DAY(born)", NumberValue(10)},
+		{"upper(first_name)", StringValue("ADA")},
+		{"LOWER(last_name)", StringValue("lovelace")},
+		{"TRIM('  a b  ')", StringValue("a b")},
+		{"LENGTH(last_name)", NumberValue(8)},
+		{"ROUND(price)", NumberValue(3)},
+		{"nickname + last_name", Null},
+		{"UPPER(nickname)", Null},
+		{"COALESCE(nickname, first_name)", StringValue("Ada")},
+		{"COALESCE(nickname, nickname)", Null},
+		{"`odd column` + 'y'", StringValue("xy")},
+		{`'it''s ' + "a ""b"""`, StringValue(`it's a "b"`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			e, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, err := e.Eval(row)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalNow(t *testing.T) {
+	e, err := Parse("YEAR(NOW()) - birth_year")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.Eval(Row{"birth_year": NumberValue(2000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := NumberValue(float64(time.Now().UTC().Year() - 2000)); got != want {
+		t.Errorf("Eval = %+v, want %+v", got, want)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	row := Row{"name": StringValue("Ada"), "born": StringValue("yesterday")}
+	tests := []struct {
+		source  string
+		errText string
+	}{
+		{"missing + 1", "unknown column missing"},
+		{"name * 2", `operator *: "Ada" is not a number`},
+		{"YEAR(born)", `YEAR: "yesterday" is not a date`},
+		{"ROUND(name)", `ROUND: "Ada" is not a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			e, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if _, err := e.Eval(row); err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		errText string
+	}{
+		{"", "unexpected end of expression"},
+		{"a +", "unexpected end of expression"},
+		{"a b", `unexpected "b" at position 2`},
+		{"(a + b", "missing ) for ( at position 0"},
+		{"'abc", "unterminated string at position 0"},
+		{"`abc", "unterminated identifier at position 0"},
+		{"a ; b", `unexpected character ';' at position 2`},
+		{"1.2.3", `invalid number "1.2.3" at position 0`},
+		{"SLEEP(1)", "unknown function SLEEP at position 0"},
+		{"UPPER(a, b)", "wrong number of arguments to UPPER"},
+		{"NOW(1)", "wrong number of arguments to NOW"},
+		{"CONCAT()", "wrong number of arguments to CONCAT"},
+		{"UPPER(a", "missing ) for UPPER at position 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestType(t *testing.T) {
+	columnTypes := map[string]string{"name": "string", "qty": "int", "price": "float", "born": "datetime"}
+	columnType := func(name string) string { return columnTypes[name] }
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"name + ' x'", "string"},
+		{"qty + 1", "int"},
+		{"qty * price", "float"},
+		{"qty / 2", "float"},
+		{"qty + 1.5", "float"},
+		{"qty + name", "string"},
+		{"YEAR(NOW()) - YEAR(born)", "int"},
+		{"LENGTH(name)", "int"},
+		{"NOW()", "datetime"},
+		{"COALESCE(price, 0)", "float"},
+		{"CONCAT(qty, price)", "string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			e, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := e.Type(columnType); got != tt.want {
+				t.Errorf("Type = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	e, err := Parse("CONCAT(first_name, ' ', last_name) + COALESCE(nickname, first_name)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Columns(), []string{"first_name", "last_name", "nickname"}; !slices.Equal(got, want) {
+		t.Errorf("Columns = %v, want %v", got, want)
+	}
+}
+
+func TestValueString(t *testing.T) {
+	tests := []struct {
+		value Value
+		want  string
+	}{
+		{NumberValue(42), "42"},
+		{NumberValue(-3), "-3"},
+		{NumberValue(2.5), "2.5"},
+		{NumberValue(1e20), "100000000000000000000"},
+		{StringValue("a"), "a"},
+		{TimeValue(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), "2024-01-02T03:04:05Z"},
+		{Null, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits an expression into tokens. Strings use single or double
+// quotes and a doubled quote inside a string stands for the quote itself.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case strings.ContainsRune("+-*/%", r):
+			tokens = append(tokens, token{tokOperator, string(r), i})
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			quote := r
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if runes[i] == quote {
+					if i+1 < len(runes) && runes[i+1] == quote {
+						sb.WriteRune(quote)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_' || r == '`':
+			start := i
+			if r == '`' {
+				// Backquoted identifiers allow column names with unusual characters
+				i++
+				for i < len(runes) && runes[i] != '`' {
+					i++
+				}
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated identifier at position %d", start)
+				}
+				tokens = append(tokens, token{tokIdent, string(runes[start+1 : i]), start})
+				i++
+				continue
+			}
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// parseExpr handles the lowest precedence level: + and -
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokOperator && (p.peek().text == "+" || p.peek().text == "-") {
+		op := p.next().text
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseTerm handles * / and %
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokOperator && strings.Contains("*/%", p.peek().text) {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokOperator && p.peek().text == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: "-", left: &literalNode{value: NumberValue(0)}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return &literalNode{value: NumberValue(n)}, nil
+	case tokString:
+		return &literalNode{value: StringValue(t.text)}, nil
+	case tokLParen:
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", t.pos)
+		}
+		return inner, nil
+	case tokIdent:
+		if p.peek().kind != tokLParen {
+			return &columnNode{name: t.text}, nil
+		}
+		return p.parseCall(t)
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[strings.ToUpper(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at position %d", name.text, name.pos)
+	}
+	p.next() // (
+
+	var args []node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.next().kind != tokRParen {
+		return nil, fmt.Errorf("missing ) for %s at position %d", name.text, name.pos)
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s at position %d", strings.ToUpper(name.text), name.pos)
+	}
+
+	return &callNode{name: strings.ToUpper(name.text), fn: fn, args: args}, nil
+}
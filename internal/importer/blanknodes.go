@@ -0,0 +1,115 @@
+package importer
+
+import "strings"
+
+// blankNode is a blank node first seen in one batch. Later batches referring
+// to it wait for that batch to commit and then use the UID it was assigned,
+// so a node referenced across batches is not created twice.
+type blankNode struct {
+	committed chan struct{} // Closed once the owning batch has committed or failed
+	uid       string        // Assigned UID; empty when the owning batch failed
+}
+
+// BlankNodes returns the labels, without "_:", of the blank nodes in the
+// subject and object of an N-Quad. Facets and literals are never read as
+// nodes.
+func BlankNodes(nquad string) []string {
+	subject, predicate, object := splitNQuad(nquad)
+	if predicate == "" {
+		return nil
+	}
+	var labels []string
+	if strings.HasPrefix(subject, "_:") {
+		labels = append(labels, strings.TrimPrefix(subject, "_:"))
+	}
+	if strings.HasPrefix(object, "_:") {
+		labels = append(labels, strings.TrimPrefix(blankToken(object), "_:"))
+	}
+	return labels
+}
+
+// ResolveBlankNodes replaces the subject and object blank nodes of an N-Quad
+// for which uid returns a UID, keeping any facets after the object
+func ResolveBlankNodes(nquad string, uid func(label string) (string, bool)) string {
+	subject, predicate, object := splitNQuad(nquad)
+	if predicate == "" {
+		return nquad
+	}
+	if label, ok := strings.CutPrefix(subject, "_:"); ok {
+		if assigned, ok := uid(label); ok {
+			subject = "<" + assigned + ">"
+		}
+	}
+	if strings.HasPrefix(object, "_:") {
+		token := blankToken(object)
+		if assigned, ok := uid(strings.TrimPrefix(token, "_:")); ok {
+			object = "<" + assigned + ">" + object[len(token):]
+		}
+	}
+	return subject + " " + predicate + " " + object
+}
+
+// track records the blank nodes of an N-Quad batch before it is sent: nodes
+// seen for the first time are owned by b, the others make b wait for the
+// batch that owns them. It is only called from the goroutine reading files,
+// so batches are tracked in the order they are sent.
+func (l *loader) track(b *batch) {
+	b.blanks = make(map[string]*blankNode)
+	for _, nquad := range b.nquads {
+		for _, label := range BlankNodes(nquad) {
+			if _, ok := b.blanks[label]; ok {
+				continue
+			}
+			node, ok := l.nodes[label]
+			if !ok {
+				node = &blankNode{committed: make(chan struct{})}
+				l.nodes[label] = node
+				b.owned = append(b.owned, label)
+			}
+			b.blanks[label] = node
+		}
+	}
+}
+
+// resolve waits for the batches owning b's other blank nodes and returns b's
+// N-Quads with those nodes replaced by their UIDs
+func (l *loader) resolve(b *batch) ([]string, error) {
+	owned := make(map[string]bool, len(b.owned))
+	for _, label := range b.owned {
+		owned[label] = true
+	}
+	for label, node := range b.blanks {
+		if owned[label] {
+			continue
+		}
+		select {
+		case <-node.committed:
+		case <-l.ctx.Done():
+			return nil, l.ctx.Err()
+		}
+	}
+
+	nquads := make([]string, len(b.nquads))
+	for i, nquad := range b.nquads {
+		nquads[i] = ResolveBlankNodes(nquad, func(label string) (string, bool) {
+			node := b.blanks[label]
+			if node == nil || owned[label] || node.uid == "" {
+				return "", false
+			}
+			return node.uid, true
+		})
+	}
+	return nquads, nil
+}
+
+// assign records the UIDs Dgraph assigned to the blank nodes b owns and
+// releases the batches waiting for them. Nodes of a failed batch keep no
+// UID, so later batches mentioning them create them anew.
+func (b *batch) assign(uids map[string]string) {
+	for _, label := range b.owned {
+		node := b.blanks[label]
+		node.uid = uids[label]
+		close(node.committed)
+	}
+	b.owned = nil
+}
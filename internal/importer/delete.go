@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+)
+
+// applyDeletions deletes the predicates listed in output.delete_file, which a
+// delta export writes for values that became NULL since the previous run.
+// Every node is found by its dgraph.upsert_predicate value, given in the file
+// next to its deletions; a node without one is skipped, as its blank node
+// would match nothing.
+func (im *Importer) applyDeletions(ctx context.Context, summary *Summary) error {
+	if im.cfg.Dgraph.ImportMode != "upsert" || len(im.cfg.Dgraph.ImportFiles) > 0 || im.cfg.Output.DeleteFile == "" {
+		return nil
+	}
+	path := filepath.Join(im.cfg.Output.Directory, im.cfg.Output.DeleteFile)
+	file, err := compress.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open delete file: %w", err)
+	}
+
+	predicate := "<" + im.cfg.Dgraph.UpsertPredicate + ">"
+	xids := make(map[string]string)
+	var deletions []string
+	err = scanLines(file, func(_ int, line string) error {
+		subject, pred, object := splitNQuad(line)
+		switch {
+		case pred == "":
+		case pred == predicate && strings.HasPrefix(object, `"`):
+			xids[subject] = literalToken(object)
+		default:
+			deletions = append(deletions, line)
+		}
+		return nil
+	})
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	batchSize := im.cfg.Dgraph.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(deletions)
+	}
+	skipped := 0
+	for start := 0; start < len(deletions); start += batchSize {
+		end := min(start+batchSize, len(deletions))
+		query, nquads, missing := im.deleteBlock(deletions[start:end], xids)
+		skipped += missing
+		if len(nquads) == 0 {
+			continue
+		}
+		err := im.withRetry(ctx, "delete", func() error {
+			return im.transport.Delete(ctx, query, nquads)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply deletions from %s: %w", path, err)
+		}
+		summary.Deletions += int64(len(nquads))
+	}
+
+	if skipped > 0 {
+		im.logger.Warn("Skipped deletions of nodes without an external ID", "file", path, "deletions", skipped)
+	}
+	if summary.Deletions > 0 {
+		im.logger.Info("Deletions applied", "file", path, "deletions", summary.Deletions)
+	}
+	return nil
+}
+
+// deleteBlock rewrites deletions into the query and N-Quads of an upsert
+// block, binding every subject to the node carrying its external ID. It also
+// returns the number of deletions dropped for want of an ID.
+func (im *Importer) deleteBlock(deletions []string, xids map[string]string) (string, []string, int) {
+	vars := make(map[string]string)
+	var query strings.Builder
+	var nquads []string
+	missing := 0
+
+	for _, line := range deletions {
+		subject, _, _ := splitNQuad(line)
+		xid, ok := xids[subject]
+		if !ok {
+			missing++
+			continue
+		}
+		v, ok := vars[subject]
+		if !ok {
+			v = fmt.Sprintf("v%d", len(vars))
+			vars[subject] = v
+			fmt.Fprintf(&query, "  %s as var(func: eq(%s, %s))\n", v, im.cfg.Dgraph.UpsertPredicate, xid)
+		}
+		nquads = append(nquads, "uid("+v+")"+strings.TrimPrefix(line, subject))
+	}
+
+	if query.Len() == 0 {
+		return "", nil, missing
+	}
+	return "{\n" + query.String() + "}", nquads, missing
+}
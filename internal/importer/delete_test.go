@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestDeleteBlock(t *testing.T) {
+	im := &Importer{cfg: config.DefaultConfig()}
+	xids := map[string]string{"_:users_1": `"users:1"`, "_:users_2": `"users:2"`}
+
+	query, nquads, missing := im.deleteBlock([]string{
+		`_:users_1 <users.email> * .`,
+		`_:users_9 <users.email> * .`,
+		`_:users_2 <users.email> * .`,
+		`_:users_1 <users.phone> * .`,
+	}, xids)
+
+	wantQuery := "{\n  v0 as var(func: eq(xid, \"users:1\"))\n  v1 as var(func: eq(xid, \"users:2\"))\n}"
+	if query != wantQuery {
+		t.Errorf("query:\n%s\nwant:\n%s", query, wantQuery)
+	}
+	want := []string{`uid(v0) <users.email> * .`, `uid(v1) <users.email> * .`, `uid(v0) <users.phone> * .`}
+	if strings.Join(nquads, "\n") != strings.Join(want, "\n") {
+		t.Errorf("deletions:\n%s\nwant:\n%s", strings.Join(nquads, "\n"), strings.Join(want, "\n"))
+	}
+	if missing != 1 {
+		t.Errorf("missing = %d, want 1", missing)
+	}
+}
+
+// TestApplyDeletions imports an export and then a delta export whose delete
+// file drops a value that became NULL
+func TestApplyDeletions(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = dir
+	cfg.Dgraph.ImportMode = "upsert"
+	cfg.Pipeline.ProgressReportInterval = 0
+	writeLines := func(name string, lines ...string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	graph := newGraphTransport()
+	writeLines(cfg.Output.RDFFile,
+		`_:users_1 <xid> "users:1" .`,
+		`_:users_1 <users.name> "Ada" .`,
+		`_:users_1 <users.email> "ada@example.com" .`,
+	)
+	if _, err := NewWithTransport(cfg, logger.New("error", "text"), graph).Run(context.Background(), true); err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+
+	writeLines(cfg.Output.RDFFile,
+		`_:users_1 <xid> "users:1" .`,
+		`_:users_1 <users.name> "Ada Lovelace" .`,
+	)
+	writeLines(cfg.Output.DeleteFile,
+		`_:users_1 <xid> "users:1" .`,
+		`_:users_1 <users.email> * .`,
+		`_:users_9 <users.email> * .`,
+	)
+	summary, err := NewWithTransport(cfg, logger.New("error", "text"), graph).Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("delta import: %v", err)
+	}
+	if summary.Deletions != 1 {
+		t.Errorf("Deletions = %d, want 1", summary.Deletions)
+	}
+
+	if len(graph.nodes) != 1 {
+		t.Fatalf("%d nodes, want 1", len(graph.nodes))
+	}
+	user := graph.nodes[graph.byXID[`"users:1"`]]
+	if email, ok := user["<users.email>"]; ok {
+		t.Errorf("users.email = %s, want it deleted", email)
+	}
+	if name := user["<users.name>"]; name != `"Ada Lovelace"` {
+		t.Errorf("users.name = %s, want \"Ada Lovelace\"", name)
+	}
+}
@@ -0,0 +1,248 @@
+package importer
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of Dgraph's api.Dgraph gRPC service that the grpc transport
+// uses, encoded by hand with the field numbers of the api.proto shipped with
+// dgo. Fields the transport never sets are left out; fields it never reads
+// are skipped when decoding.
+
+// Methods of the api.Dgraph service
+const (
+	methodAlter = "/api.Dgraph/Alter"
+	methodQuery = "/api.Dgraph/Query"
+)
+
+// apiMessage is a message the dgraph codec can encode and decode
+type apiMessage interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// apiRequest is api.Request: a query, mutations, or both
+type apiRequest struct {
+	query     string        // 4
+	readOnly  bool          // 6
+	mutations []apiMutation // 12
+	commitNow bool          // 13
+}
+
+// apiMutation is api.Mutation
+type apiMutation struct {
+	setJSON   []byte // 1
+	setNQuads []byte // 3
+	delNQuads []byte // 4
+}
+
+// apiResponse is api.Response
+type apiResponse struct {
+	json []byte            // 1
+	uids map[string]string // 12, blank node label without "_:" -> UID
+}
+
+// apiOperation is api.Operation, which alters the schema
+type apiOperation struct {
+	schema string // 1
+}
+
+// apiPayload is api.Payload, the result of Alter, whose content is unused
+type apiPayload struct{}
+
+func (r *apiRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 4, r.query)
+	b = appendBool(b, 6, r.readOnly)
+	for _, mutation := range r.mutations {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, mutation.marshal())
+	}
+	return appendBool(b, 13, r.commitNow)
+}
+
+func (r *apiRequest) unmarshal(data []byte) error {
+	return eachField(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch {
+		case num == 4 && typ == protowire.BytesType:
+			r.query = string(value)
+		case num == 6 && typ == protowire.VarintType:
+			r.readOnly = varint != 0
+		case num == 12 && typ == protowire.BytesType:
+			var mutation apiMutation
+			if err := mutation.unmarshal(value); err != nil {
+				return err
+			}
+			r.mutations = append(r.mutations, mutation)
+		case num == 13 && typ == protowire.VarintType:
+			r.commitNow = varint != 0
+		}
+		return nil
+	})
+}
+
+func (m *apiMutation) marshal() []byte {
+	var b []byte
+	b = appendBytes(b, 1, m.setJSON)
+	b = appendBytes(b, 3, m.setNQuads)
+	return appendBytes(b, 4, m.delNQuads)
+}
+
+func (m *apiMutation) unmarshal(data []byte) error {
+	return eachField(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.setJSON = append([]byte(nil), value...)
+		case num == 3 && typ == protowire.BytesType:
+			m.setNQuads = append([]byte(nil), value...)
+		case num == 4 && typ == protowire.BytesType:
+			m.delNQuads = append([]byte(nil), value...)
+		}
+		return nil
+	})
+}
+
+func (r *apiResponse) marshal() []byte {
+	b := appendBytes(nil, 1, r.json)
+	for label, uid := range r.uids {
+		var entry []byte
+		entry = appendString(entry, 1, label)
+		entry = appendString(entry, 2, uid)
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func (r *apiResponse) unmarshal(data []byte) error {
+	return eachField(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			r.json = append([]byte(nil), value...)
+		case num == 12 && typ == protowire.BytesType:
+			// A map entry is a message with the key in field 1 and the
+			// value in field 2
+			var label, uid string
+			err := eachField(value, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					label = string(value)
+				case num == 2 && typ == protowire.BytesType:
+					uid = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if r.uids == nil {
+				r.uids = make(map[string]string)
+			}
+			r.uids[label] = uid
+		}
+		return nil
+	})
+}
+
+func (o *apiOperation) marshal() []byte {
+	return appendString(nil, 1, o.schema)
+}
+
+func (o *apiOperation) unmarshal(data []byte) error {
+	return eachField(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			o.schema = string(value)
+		}
+		return nil
+	})
+}
+
+func (*apiPayload) marshal() []byte { return nil }
+
+func (*apiPayload) unmarshal(data []byte) error {
+	return eachField(data, func(protowire.Number, protowire.Type, []byte, uint64) error { return nil })
+}
+
+// appendString appends a string field, leaving out the proto3 default ""
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendBytes appends a bytes field, leaving out an empty value
+func appendBytes(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// appendBool appends a bool field, leaving out the proto3 default false
+func appendBool(b []byte, num protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// eachField calls fn with every field of an encoded message: the bytes of
+// length-delimited fields, or the value of varint fields. Fields of other
+// types are skipped.
+func eachField(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf message: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dgraphCodec encodes the api messages for gRPC. It is named "proto" so
+// requests carry the content type Dgraph expects.
+type dgraphCodec struct{}
+
+func (dgraphCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(apiMessage)
+	if !ok {
+		return nil, fmt.Errorf("dgraph codec cannot encode %T", v)
+	}
+	return message.marshal(), nil
+}
+
+func (dgraphCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(apiMessage)
+	if !ok {
+		return fmt.Errorf("dgraph codec cannot decode %T", v)
+	}
+	return message.unmarshal(data)
+}
+
+func (dgraphCodec) Name() string { return "proto" }
@@ -0,0 +1,231 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCTransport talks to Dgraph Alphas through the api.Dgraph gRPC service,
+// as the dgo client does. Requests are spread round-robin over the Alphas;
+// every mutation is a single request committed with CommitNow.
+type GRPCTransport struct {
+	conns   []*grpc.ClientConn
+	next    atomic.Uint32
+	timeout time.Duration // Deadline of each call (0 = none)
+}
+
+// GRPCError is returned when a gRPC call fails with a status
+type GRPCError struct {
+	Method string
+	Code   codes.Code
+	Detail string
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("%s failed with %s: %s", e.Method, e.Code, e.Detail)
+}
+
+// StatusCode maps the gRPC code to the HTTP status with the same meaning, so
+// retry rules and credential checks treat both transports alike
+func (e *GRPCError) StatusCode() int {
+	switch e.Code {
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// NewGRPCTransport connects to each Alpha with the given dial options.
+// Connections are made lazily, on the first request.
+func NewGRPCTransport(alphas []string, timeout time.Duration, options ...grpc.DialOption) (*GRPCTransport, error) {
+	if len(alphas) == 0 {
+		return nil, fmt.Errorf("grpc transport needs at least one dgraph alpha")
+	}
+	t := &GRPCTransport{timeout: timeout}
+	for _, alpha := range alphas {
+		conn, err := grpc.NewClient(alpha, options...)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("invalid dgraph alpha %s: %w", alpha, err)
+		}
+		t.conns = append(t.conns, conn)
+	}
+	return t, nil
+}
+
+// grpcDialOptions builds the dial options of the dgraph section: TLS
+// credentials from dgraph.tls, the auth token on every call, gzip when
+// dgraph.compression is enabled, and the codec of the api messages
+func grpcDialOptions(cfg *config.DgraphConfig) ([]grpc.DialOption, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+	callOptions := []grpc.CallOption{grpc.ForceCodec(dgraphCodec{})}
+	if cfg.Compression {
+		callOptions = append(callOptions, grpc.UseCompressor(gzip.Name))
+	}
+
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(callOptions...),
+	}
+	if cfg.AuthToken != "" {
+		options = append(options, grpc.WithPerRPCCredentials(tokenCredentials{
+			key:   grpcAuthKey(cfg.AuthHeader),
+			token: cfg.AuthToken,
+		}))
+	}
+	return options, nil
+}
+
+// grpcAuthKey returns the metadata key carrying the auth token: Dgraph Cloud
+// reads its API key from authorization, a self-hosted Alpha its admin token
+// from auth-token
+func grpcAuthKey(authHeader string) string {
+	if strings.EqualFold(authHeader, "X-Auth-Token") {
+		return "authorization"
+	}
+	return "auth-token"
+}
+
+// tokenCredentials attaches the auth token to every call. Like the http
+// transport it also sends the token without TLS, for clusters on a trusted
+// network.
+type tokenCredentials struct {
+	key   string
+	token string
+}
+
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{c.key: c.token}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Alter applies the schema through api.Dgraph/Alter
+func (t *GRPCTransport) Alter(ctx context.Context, schema string) error {
+	return t.invoke(ctx, methodAlter, &apiOperation{schema: schema}, &apiPayload{})
+}
+
+// Mutate commits the batch through api.Dgraph/Query with CommitNow
+func (t *GRPCTransport) Mutate(ctx context.Context, nquads []string) (map[string]string, error) {
+	var resp apiResponse
+	err := t.invoke(ctx, methodQuery, &apiRequest{
+		mutations: []apiMutation{{setNQuads: []byte(strings.Join(nquads, "\n"))}},
+		commitNow: true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.uids, nil
+}
+
+// Upsert sends the query and the mutation in one request with CommitNow
+func (t *GRPCTransport) Upsert(ctx context.Context, query string, nquads []string) error {
+	return t.invoke(ctx, methodQuery, &apiRequest{
+		query:     query,
+		mutations: []apiMutation{{setNQuads: []byte(strings.Join(nquads, "\n"))}},
+		commitNow: true,
+	}, &apiResponse{})
+}
+
+// Delete sends the query and the deletion in one request with CommitNow
+func (t *GRPCTransport) Delete(ctx context.Context, query string, nquads []string) error {
+	return t.invoke(ctx, methodQuery, &apiRequest{
+		query:     query,
+		mutations: []apiMutation{{delNQuads: []byte(strings.Join(nquads, "\n"))}},
+		commitNow: true,
+	}, &apiResponse{})
+}
+
+// MutateJSON commits a JSON mutation. gRPC carries the set list and the
+// query of an upsert batch as separate fields, so the body is read whole.
+func (t *GRPCTransport) MutateJSON(ctx context.Context, body io.Reader) error {
+	var mutation struct {
+		Query string          `json:"query"`
+		Set   json.RawMessage `json:"set"`
+	}
+	if err := json.NewDecoder(body).Decode(&mutation); err != nil {
+		return fmt.Errorf("failed to read JSON mutation: %w", err)
+	}
+	return t.invoke(ctx, methodQuery, &apiRequest{
+		query:     mutation.Query,
+		mutations: []apiMutation{{setJSON: mutation.Set}},
+		commitNow: true,
+	}, &apiResponse{})
+}
+
+// Query runs a read-only query and returns the JSON of its result, the same
+// object the http transport returns as "data"
+func (t *GRPCTransport) Query(ctx context.Context, query string) (json.RawMessage, error) {
+	var resp apiResponse
+	if err := t.invoke(ctx, methodQuery, &apiRequest{query: query, readOnly: true}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.json, nil
+}
+
+// Close closes the connections to every Alpha
+func (t *GRPCTransport) Close() error {
+	var errs []error
+	for _, conn := range t.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// invoke makes a unary call on the next Alpha, turning a failure status into
+// a GRPCError
+func (t *GRPCTransport) invoke(ctx context.Context, method string, req, resp apiMessage) error {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	conn := t.conns[int(t.next.Add(1)-1)%len(t.conns)]
+	err := conn.Invoke(ctx, method, req, resp)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+	if st, ok := status.FromError(err); ok {
+		return &GRPCError{Method: method, Code: st.Code(), Detail: st.Message()}
+	}
+	return err
+}
@@ -0,0 +1,448 @@
+package importer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCall is a call received by the test Alpha
+type grpcCall struct {
+	method   string
+	metadata metadata.MD
+	request  apiRequest
+	schema   string
+}
+
+// grpcAlpha is an in-process api.Dgraph server that records every call and
+// answers Query with response, or fails every call with err
+type grpcAlpha struct {
+	mu       sync.Mutex
+	calls    []grpcCall
+	response apiResponse
+	err      error
+}
+
+func (a *grpcAlpha) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	call := grpcCall{method: method, metadata: md}
+
+	var resp apiMessage
+	switch method {
+	case methodAlter:
+		var op apiOperation
+		if err := stream.RecvMsg(&op); err != nil {
+			return err
+		}
+		call.schema = op.schema
+		resp = &apiPayload{}
+	case methodQuery:
+		if err := stream.RecvMsg(&call.request); err != nil {
+			return err
+		}
+		resp = &a.response
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	a.mu.Lock()
+	a.calls = append(a.calls, call)
+	a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	return stream.SendMsg(resp)
+}
+
+// serveGRPCAlpha starts alpha on a local port, with TLS when cert is set,
+// and returns its address
+func serveGRPCAlpha(t *testing.T, alpha *grpcAlpha, cert *tls.Certificate) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := []grpc.ServerOption{
+		grpc.UnknownServiceHandler(alpha.handle),
+		grpc.ForceServerCodec(dgraphCodec{}),
+	}
+	if cert != nil {
+		options = append(options, grpc.Creds(credentials.NewServerTLSFromCert(cert)))
+	}
+	server := grpc.NewServer(options...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// grpcConfig returns a dgraph section for the grpc transport to addr
+func grpcConfig(addr string) *config.DgraphConfig {
+	cfg := config.DefaultConfig().Dgraph
+	cfg.Transport = "grpc"
+	cfg.Alpha = []string{addr}
+	cfg.Timeout = 5 * time.Second
+	return &cfg
+}
+
+// dialGRPCAlpha connects to addr with the dial options of cfg
+func dialGRPCAlpha(t *testing.T, cfg *config.DgraphConfig) *GRPCTransport {
+	t.Helper()
+	options, err := grpcDialOptions(cfg)
+	if err != nil {
+		t.Fatalf("grpcDialOptions: %v", err)
+	}
+	transport, err := NewGRPCTransport(cfg.Alpha, cfg.Timeout, options...)
+	if err != nil {
+		t.Fatalf("NewGRPCTransport: %v", err)
+	}
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+func TestGRPCTransportRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		call      func(t *GRPCTransport) error
+		method    string
+		schema    string
+		query     string
+		readOnly  bool
+		setNQuads string
+		setJSON   string
+		delNQuads string
+	}{
+		{
+			name:   "alter sends the schema",
+			call:   func(t *GRPCTransport) error { return t.Alter(context.Background(), "name: string @index(exact) .") },
+			method: methodAlter,
+			schema: "name: string @index(exact) .",
+		},
+		{
+			name: "mutate joins the N-Quads",
+			call: func(t *GRPCTransport) error {
+				_, err := t.Mutate(context.Background(), []string{`_:a <name> "A" .`, `_:a <friend> _:b .`})
+				return err
+			},
+			method:    methodQuery,
+			setNQuads: "_:a <name> \"A\" .\n_:a <friend> _:b .",
+		},
+		{
+			name: "upsert sends the query beside the mutation",
+			call: func(t *GRPCTransport) error {
+				return t.Upsert(context.Background(), "{ v0 as var(func: eq(xid, \"users:1\")) }", []string{`uid(v0) <name> "A" .`})
+			},
+			method:    methodQuery,
+			query:     "{ v0 as var(func: eq(xid, \"users:1\")) }",
+			setNQuads: `uid(v0) <name> "A" .`,
+		},
+		{
+			name: "delete sends the query beside the deletion",
+			call: func(t *GRPCTransport) error {
+				return t.Delete(context.Background(), "{ v0 as var(func: eq(xid, \"users:1\")) }", []string{`uid(v0) <email> * .`})
+			},
+			method:    methodQuery,
+			query:     "{ v0 as var(func: eq(xid, \"users:1\")) }",
+			delNQuads: `uid(v0) <email> * .`,
+		},
+		{
+			name: "JSON upserts split the query from the set list",
+			call: func(t *GRPCTransport) error {
+				return t.MutateJSON(context.Background(), strings.NewReader(`{"query":"{ q(func: eq(xid, \"a\")) { u as uid } }","set":[{"uid":"uid(u)"}]}`))
+			},
+			method:  methodQuery,
+			query:   `{ q(func: eq(xid, "a")) { u as uid } }`,
+			setJSON: `[{"uid":"uid(u)"}]`,
+		},
+		{
+			name: "queries are read-only",
+			call: func(t *GRPCTransport) error {
+				_, err := t.Query(context.Background(), "{ q(func: has(name)) { uid } }")
+				return err
+			},
+			method:   methodQuery,
+			query:    "{ q(func: has(name)) { uid } }",
+			readOnly: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alpha := &grpcAlpha{}
+			transport := dialGRPCAlpha(t, grpcConfig(serveGRPCAlpha(t, alpha, nil)))
+			if err := tt.call(transport); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if len(alpha.calls) != 1 {
+				t.Fatalf("got %d calls, want 1", len(alpha.calls))
+			}
+			got := alpha.calls[0]
+			if got.method != tt.method {
+				t.Errorf("method = %q, want %q", got.method, tt.method)
+			}
+			if got.schema != tt.schema {
+				t.Errorf("schema = %q, want %q", got.schema, tt.schema)
+			}
+			req := got.request
+			if req.query != tt.query || req.readOnly != tt.readOnly {
+				t.Errorf("query = %q (read-only %v), want %q (read-only %v)", req.query, req.readOnly, tt.query, tt.readOnly)
+			}
+			mutating := tt.setNQuads != "" || tt.setJSON != "" || tt.delNQuads != ""
+			if req.commitNow != mutating {
+				t.Errorf("commitNow = %v, want %v", req.commitNow, mutating)
+			}
+			if !mutating {
+				if len(req.mutations) != 0 {
+					t.Errorf("unexpected mutations %v", req.mutations)
+				}
+				return
+			}
+			if len(req.mutations) != 1 {
+				t.Fatalf("got %d mutations, want 1", len(req.mutations))
+			}
+			if got := string(req.mutations[0].setNQuads); got != tt.setNQuads {
+				t.Errorf("set_nquads = %q, want %q", got, tt.setNQuads)
+			}
+			if got := string(req.mutations[0].setJSON); got != tt.setJSON {
+				t.Errorf("set_json = %q, want %q", got, tt.setJSON)
+			}
+			if got := string(req.mutations[0].delNQuads); got != tt.delNQuads {
+				t.Errorf("del_nquads = %q, want %q", got, tt.delNQuads)
+			}
+		})
+	}
+}
+
+func TestGRPCTransportResponses(t *testing.T) {
+	alpha := &grpcAlpha{response: apiResponse{
+		json: []byte(`{"q":[{"uid":"0x1"}]}`),
+		uids: map[string]string{"a": "0x1", "b": "0x2"},
+	}}
+	transport := dialGRPCAlpha(t, grpcConfig(serveGRPCAlpha(t, alpha, nil)))
+
+	uids, err := transport.Mutate(context.Background(), []string{`_:a <friend> _:b .`})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	if len(uids) != 2 || uids["a"] != "0x1" || uids["b"] != "0x2" {
+		t.Errorf("uids = %v, want a=0x1 b=0x2", uids)
+	}
+	data, err := transport.Query(context.Background(), "{ q(func: has(name)) { uid } }")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if string(data) != `{"q":[{"uid":"0x1"}]}` {
+		t.Errorf("query result = %s", data)
+	}
+}
+
+func TestGRPCTransportErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"unauthenticated", status.Error(codes.Unauthenticated, "no token"), http.StatusUnauthorized},
+		{"permission denied", status.Error(codes.PermissionDenied, "not allowed"), http.StatusForbidden},
+		{"unavailable", status.Error(codes.Unavailable, "overloaded"), http.StatusServiceUnavailable},
+		{"aborted", status.Error(codes.Aborted, "Transaction has been aborted. Please retry"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alpha := &grpcAlpha{err: tt.err}
+			transport := dialGRPCAlpha(t, grpcConfig(serveGRPCAlpha(t, alpha, nil)))
+
+			_, err := transport.Mutate(context.Background(), []string{`_:a <name> "A" .`})
+			var grpcErr *GRPCError
+			if !errors.As(err, &grpcErr) {
+				t.Fatalf("error = %v, want a GRPCError", err)
+			}
+			if grpcErr.StatusCode() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", grpcErr.StatusCode(), tt.wantStatus)
+			}
+			if want := status.Convert(tt.err).Message(); !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %q, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestGRPCDialOptions(t *testing.T) {
+	cert, caFile := testCertificate(t)
+	tests := []struct {
+		name       string
+		tls        bool
+		change     func(cfg *config.DgraphConfig)
+		authKey    string // Metadata key expected to carry the token, "" for none
+		wantDialOK bool
+	}{
+		{
+			name:       "plain text without a token",
+			change:     func(*config.DgraphConfig) {},
+			wantDialOK: true,
+		},
+		{
+			name: "self-hosted admin token",
+			change: func(cfg *config.DgraphConfig) {
+				cfg.AuthToken = "secret"
+				cfg.AuthHeader = "X-Dgraph-AuthToken"
+			},
+			authKey:    "auth-token",
+			wantDialOK: true,
+		},
+		{
+			name: "Dgraph Cloud API key with compression",
+			change: func(cfg *config.DgraphConfig) {
+				cfg.AuthToken = "secret"
+				cfg.AuthHeader = "X-Auth-Token"
+				cfg.Compression = true
+			},
+			authKey:    "authorization",
+			wantDialOK: true,
+		},
+		{
+			name: "TLS verified against ca_cert",
+			tls:  true,
+			change: func(cfg *config.DgraphConfig) {
+				cfg.TLS.CACert = caFile
+				cfg.TLS.ServerName = "localhost"
+				cfg.AuthToken = "secret"
+			},
+			authKey:    "auth-token",
+			wantDialOK: true,
+		},
+		{
+			name:   "TLS against the system roots rejects an unknown CA",
+			tls:    true,
+			change: func(cfg *config.DgraphConfig) { cfg.TLS.Enabled = true },
+		},
+		{
+			name:   "plain text to a TLS Alpha fails",
+			tls:    true,
+			change: func(*config.DgraphConfig) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alpha := &grpcAlpha{}
+			var serverCert *tls.Certificate
+			if tt.tls {
+				serverCert = &cert
+			}
+			cfg := grpcConfig(serveGRPCAlpha(t, alpha, serverCert))
+			cfg.Timeout = 2 * time.Second
+			tt.change(cfg)
+			transport := dialGRPCAlpha(t, cfg)
+
+			err := transport.Alter(context.Background(), "name: string .")
+			if !tt.wantDialOK {
+				if err == nil {
+					t.Fatal("Alter succeeded, want a connection failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Alter: %v", err)
+			}
+			md := alpha.calls[0].metadata
+			for _, key := range []string{"auth-token", "authorization"} {
+				want := ""
+				if key == tt.authKey {
+					want = "secret"
+				}
+				if got := strings.Join(md.Get(key), ","); got != want {
+					t.Errorf("%s metadata = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewGRPCTransportNeedsAlphas(t *testing.T) {
+	if _, err := NewGRPCTransport(nil, time.Second); err == nil {
+		t.Fatal("NewGRPCTransport without alphas succeeded")
+	}
+}
+
+func TestAPIMessagesRoundTrip(t *testing.T) {
+	req := apiRequest{
+		query:     "{ q(func: has(name)) { uid } }",
+		mutations: []apiMutation{{setNQuads: []byte(`_:a <name> "A" .`)}, {setJSON: []byte(`[{"uid":"_:b"}]`), delNQuads: []byte(`_:a <email> * .`)}},
+		commitNow: true,
+	}
+	var gotReq apiRequest
+	if err := gotReq.unmarshal(req.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if gotReq.query != req.query || !gotReq.commitNow || gotReq.readOnly || len(gotReq.mutations) != 2 ||
+		string(gotReq.mutations[0].setNQuads) != string(req.mutations[0].setNQuads) ||
+		string(gotReq.mutations[1].setJSON) != string(req.mutations[1].setJSON) ||
+		string(gotReq.mutations[1].delNQuads) != string(req.mutations[1].delNQuads) {
+		t.Errorf("request round trip = %+v, want %+v", gotReq, req)
+	}
+
+	resp := apiResponse{json: []byte(`{}`), uids: map[string]string{"a": "0x1", "b": "0x2"}}
+	var gotResp apiResponse
+	if err := gotResp.unmarshal(resp.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if string(gotResp.json) != "{}" || len(gotResp.uids) != 2 || gotResp.uids["b"] != "0x2" {
+		t.Errorf("response round trip = %+v, want %+v", gotResp, resp)
+	}
+
+	if err := gotResp.unmarshal([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("truncated message decoded without an error")
+	}
+}
+
+// testCertificate creates a self-signed certificate for localhost and writes
+// it to a CA file
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPTransport talks to a Dgraph Alpha through its HTTP API (/alter, /mutate and /query)
+type HTTPTransport struct {
+	baseURL string
+	client  *http.Client
+
+	authHeader string // Header carrying authToken
+	authToken  string // Sent with every request when set
+}
+
+// dgraphResponse captures the error list Dgraph returns alongside HTTP 200
+type dgraphResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// queryResponse captures the result of a query
+type queryResponse struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// mutateResponse captures the UIDs assigned by a mutation
+type mutateResponse struct {
+	Data struct {
+		UIDs map[string]string `json:"uids"`
+	} `json:"data"`
+}
+
+// StatusError is returned when Dgraph answers with a non-2xx HTTP status
+type StatusError struct {
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Path, e.Status, e.Body)
+}
+
+// StatusCode returns the HTTP status, for retry classification
+func (e *StatusError) StatusCode() int {
+	return e.Status
+}
+
+func NewHTTPTransport(endpoint string, timeout time.Duration) *HTTPTransport {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "http://" + endpoint
+	}
+
+	return &HTTPTransport{
+		baseURL: strings.TrimSuffix(endpoint, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Alter applies the schema via POST /alter
+func (t *HTTPTransport) Alter(ctx context.Context, schema string) error {
+	_, err := t.post(ctx, "/alter", "application/dql", strings.NewReader(schema))
+	return err
+}
+
+// Mutate commits the batch via POST /mutate?commitNow=true
+func (t *HTTPTransport) Mutate(ctx context.Context, nquads []string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString("{\n  set {\n")
+	for _, nquad := range nquads {
+		body.WriteString("    ")
+		body.WriteString(nquad)
+		body.WriteString("\n")
+	}
+	body.WriteString("  }\n}\n")
+
+	respBody, err := t.post(ctx, "/mutate?commitNow=true", "application/rdf", &body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed mutateResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode mutation response: %w", err)
+	}
+	return parsed.Data.UIDs, nil
+}
+
+// Upsert commits an upsert block via POST /mutate?commitNow=true
+func (t *HTTPTransport) Upsert(ctx context.Context, query string, nquads []string) error {
+	return t.upsert(ctx, query, "set", nquads)
+}
+
+// Delete commits an upsert block deleting nquads via POST /mutate?commitNow=true
+func (t *HTTPTransport) Delete(ctx context.Context, query string, nquads []string) error {
+	return t.upsert(ctx, query, "delete", nquads)
+}
+
+// upsert commits an upsert block whose mutation is a set or delete block
+func (t *HTTPTransport) upsert(ctx context.Context, query, block string, nquads []string) error {
+	var body bytes.Buffer
+	body.WriteString("upsert {\n  query ")
+	body.WriteString(query)
+	body.WriteString("\n  mutation {\n    ")
+	body.WriteString(block)
+	body.WriteString(" {\n")
+	for _, nquad := range nquads {
+		body.WriteString("      ")
+		body.WriteString(nquad)
+		body.WriteString("\n")
+	}
+	body.WriteString("    }\n  }\n}\n")
+
+	_, err := t.post(ctx, "/mutate?commitNow=true", "application/rdf", &body)
+	return err
+}
+
+// MutateJSON commits a JSON mutation via POST /mutate?commitNow=true,
+// streaming the body to Dgraph
+func (t *HTTPTransport) MutateJSON(ctx context.Context, body io.Reader) error {
+	_, err := t.post(ctx, "/mutate?commitNow=true", "application/json", body)
+	return err
+}
+
+// Query runs a read-only query via POST /query
+func (t *HTTPTransport) Query(ctx context.Context, query string) (json.RawMessage, error) {
+	respBody, err := t.post(ctx, "/query?ro=true", "application/dql", strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed queryResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	return parsed.Data, nil
+}
+
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// post sends a request and returns the response body
+func (t *HTTPTransport) post(ctx context.Context, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if t.authToken != "" {
+		req.Header.Set(t.authHeader, t.authToken)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Path: path, Status: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	// Dgraph reports most failures in the body with a 200 status
+	var parsed dgraphResponse
+	if err := json.Unmarshal(respBody, &parsed); err == nil && len(parsed.Errors) > 0 {
+		return nil, fmt.Errorf("%s failed: %s", path, parsed.Errors[0].Message)
+	}
+
+	return respBody, nil
+}
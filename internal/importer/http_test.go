@@ -0,0 +1,224 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordedRequest is a request received by the test Alpha
+type recordedRequest struct {
+	path        string
+	contentType string
+	authToken   string
+	body        string
+}
+
+// testAlpha serves /alter, /mutate and /query, recording every request and
+// answering with status and response
+func testAlpha(t *testing.T, status int, response string) (*HTTPTransport, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, recordedRequest{
+			path:        r.URL.RequestURI(),
+			contentType: r.Header.Get("Content-Type"),
+			authToken:   r.Header.Get("X-Dgraph-AuthToken"),
+			body:        string(body),
+		})
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return NewHTTPTransport(server.URL, 5*time.Second), &requests
+}
+
+func TestHTTPTransportRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		call        func(t *HTTPTransport) error
+		path        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "alter sends the schema as is",
+			call:        func(t *HTTPTransport) error { return t.Alter(context.Background(), "name: string @index(exact) .") },
+			path:        "/alter",
+			contentType: "application/dql",
+			body:        "name: string @index(exact) .",
+		},
+		{
+			name: "mutate wraps the N-Quads in a set block",
+			call: func(t *HTTPTransport) error {
+				_, err := t.Mutate(context.Background(), []string{`_:a <name> "A" .`, `_:a <friend> _:b .`})
+				return err
+			},
+			path:        "/mutate?commitNow=true",
+			contentType: "application/rdf",
+			body:        "{\n  set {\n    _:a <name> \"A\" .\n    _:a <friend> _:b .\n  }\n}\n",
+		},
+		{
+			name: "upsert sends the query beside the mutation",
+			call: func(t *HTTPTransport) error {
+				return t.Upsert(context.Background(), "{ v0 as var(func: eq(xid, \"users:1\")) }", []string{`uid(v0) <name> "A" .`})
+			},
+			path:        "/mutate?commitNow=true",
+			contentType: "application/rdf",
+			body: "upsert {\n  query { v0 as var(func: eq(xid, \"users:1\")) }\n  mutation {\n    set {\n" +
+				"      uid(v0) <name> \"A\" .\n    }\n  }\n}\n",
+		},
+		{
+			name: "delete sends the query beside a delete block",
+			call: func(t *HTTPTransport) error {
+				return t.Delete(context.Background(), "{ v0 as var(func: eq(xid, \"users:1\")) }", []string{`uid(v0) <email> * .`})
+			},
+			path:        "/mutate?commitNow=true",
+			contentType: "application/rdf",
+			body: "upsert {\n  query { v0 as var(func: eq(xid, \"users:1\")) }\n  mutation {\n    delete {\n" +
+				"      uid(v0) <email> * .\n    }\n  }\n}\n",
+		},
+		{
+			name: "JSON mutations are streamed as is",
+			call: func(t *HTTPTransport) error {
+				return t.MutateJSON(context.Background(), strings.NewReader(`{"set":[{"uid":"_:a"}]}`))
+			},
+			path:        "/mutate?commitNow=true",
+			contentType: "application/json",
+			body:        `{"set":[{"uid":"_:a"}]}`,
+		},
+		{
+			name: "queries are read-only",
+			call: func(t *HTTPTransport) error {
+				_, err := t.Query(context.Background(), "{ q(func: has(name)) { uid } }")
+				return err
+			},
+			path:        "/query?ro=true",
+			contentType: "application/dql",
+			body:        "{ q(func: has(name)) { uid } }",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, requests := testAlpha(t, http.StatusOK, `{"data":{}}`)
+			if err := tt.call(transport); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+			got := (*requests)[0]
+			if got.path != tt.path {
+				t.Errorf("path = %q, want %q", got.path, tt.path)
+			}
+			if got.contentType != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got.contentType, tt.contentType)
+			}
+			if got.body != tt.body {
+				t.Errorf("body = %q, want %q", got.body, tt.body)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		uids       map[string]string
+		wantStatus int    // StatusError status expected, 0 for none
+		errText    string // Error message expected to contain, "" for success
+	}{
+		{
+			name:     "assigned UIDs are returned",
+			status:   http.StatusOK,
+			response: `{"data":{"code":"Success","uids":{"a":"0x1","b":"0x2"}}}`,
+			uids:     map[string]string{"a": "0x1", "b": "0x2"},
+		},
+		{
+			name:     "errors in a 200 response fail the request",
+			status:   http.StatusOK,
+			response: `{"errors":[{"message":"Transaction has been aborted. Please retry"}]}`,
+			errText:  "Transaction has been aborted",
+		},
+		{
+			name:       "non-2xx status is a StatusError",
+			status:     http.StatusServiceUnavailable,
+			response:   "overloaded\n",
+			wantStatus: http.StatusServiceUnavailable,
+			errText:    "returned status 503: overloaded",
+		},
+		{
+			name:     "unreadable response",
+			status:   http.StatusOK,
+			response: "<html>",
+			errText:  "failed to decode mutation response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, _ := testAlpha(t, tt.status, tt.response)
+			uids, err := transport.Mutate(context.Background(), []string{`_:a <name> "A" .`})
+			if tt.errText == "" {
+				if err != nil {
+					t.Fatalf("Mutate: %v", err)
+				}
+				if len(uids) != len(tt.uids) {
+					t.Fatalf("uids = %v, want %v", uids, tt.uids)
+				}
+				for label, uid := range tt.uids {
+					if uids[label] != uid {
+						t.Errorf("uid of %s = %q, want %q", label, uids[label], uid)
+					}
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.errText)
+			}
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) != (tt.wantStatus != 0) {
+				t.Fatalf("StatusError = %v, want status %d", err, tt.wantStatus)
+			}
+			if tt.wantStatus != 0 && statusErr.StatusCode() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", statusErr.StatusCode(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportAuthToken(t *testing.T) {
+	transport, requests := testAlpha(t, http.StatusOK, `{"data":{}}`)
+	transport.authHeader = "X-Dgraph-AuthToken"
+	transport.authToken = "secret"
+	if err := transport.Alter(context.Background(), "name: string ."); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*requests)[0].authToken; got != "secret" {
+		t.Errorf("auth token = %q, want secret", got)
+	}
+}
+
+func TestNewHTTPTransportEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		baseURL  string
+	}{
+		{"localhost:8080", "http://localhost:8080"},
+		{"http://localhost:8080/", "http://localhost:8080"},
+		{"https://dgraph.example.com", "https://dgraph.example.com"},
+	}
+	for _, tt := range tests {
+		if got := NewHTTPTransport(tt.endpoint, time.Second).baseURL; got != tt.baseURL {
+			t.Errorf("NewHTTPTransport(%q) base URL = %q, want %q", tt.endpoint, got, tt.baseURL)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+// Package importer loads the pipeline's generated schema and RDF output into Dgraph.
+// It reads the output files in batches and hands them to a pluggable transport.
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/retry"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// Importer applies the generated schema and RDF data to Dgraph
+type Importer struct {
+	cfg       *config.Config
+	logger    *logger.Logger
+	transport Transport
+	retries   *retry.Classifier
+	xids      map[string]string // Blank node -> quoted external ID, in upsert mode
+}
+
+// Summary contains the results of an import run
+type Summary struct {
+	SchemaApplied bool
+	Batches       int
+	FailedBatches int
+	Triples       int64
+	Nodes         int64 // Nodes in JSON batch files
+	Deletions     int64 // Predicates deleted from output.delete_file
+	Duration      time.Duration
+
+	failed []FailedBatch
+}
+
+// FailedBatch records a batch that still failed after all retries. Lines are
+// 1-based and inclusive, so the batch can be re-read from its file.
+type FailedBatch struct {
+	File      string `json:"file"`
+	FirstLine int    `json:"first_line"`
+	LastLine  int    `json:"last_line"`
+	Triples   int    `json:"triples,omitempty"`
+	Nodes     int    `json:"nodes,omitempty"` // Set for JSON batch files, which are retried whole
+	Error     string `json:"error"`
+}
+
+// batch is a run of N-Quads read from one file, or a whole JSON batch file
+type batch struct {
+	file      string
+	firstLine int
+	lastLine  int
+	nquads    []string
+
+	json  bool // file is a JSON mutation, streamed as is
+	nodes int  // Nodes in the JSON mutation
+
+	blanks map[string]*blankNode // Blank nodes of the N-Quads, by label
+	owned  []string              // Labels first seen in this batch, assigned when it commits
+}
+
+// New creates an importer using the transport selected in configuration
+func New(cfg *config.Config, logger *logger.Logger) (*Importer, error) {
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithTransport(cfg, logger, transport), nil
+}
+
+// NewWithTransport creates an importer that uses the given transport
+func NewWithTransport(cfg *config.Config, logger *logger.Logger, transport Transport) *Importer {
+	return &Importer{
+		cfg:       cfg,
+		logger:    logger,
+		transport: transport,
+		retries:   retry.NewClassifier(cfg.Retry),
+	}
+}
+
+// Close releases the underlying transport
+func (im *Importer) Close() error {
+	return im.transport.Close()
+}
+
+// Run applies the schema (unless skipSchema is set), loads the data and, in
+// upsert mode, applies the deletions of a delta export.
+// A blank node keeps the UID assigned by the first batch that mentions it, so
+// triples of one node may span batches.
+func (im *Importer) Run(ctx context.Context, skipSchema bool) (*Summary, error) {
+	startTime := time.Now()
+	summary := &Summary{}
+
+	// Files are listed, and checked, before Dgraph is touched
+	paths, err := im.dataFiles()
+	if err != nil {
+		return summary, err
+	}
+	if im.cfg.Dgraph.VerifyChecksums {
+		if err := im.verifyChecksums(paths); err != nil {
+			return summary, err
+		}
+	}
+
+	if !skipSchema {
+		if err := im.ApplySchema(ctx); err != nil {
+			return summary, err
+		}
+		summary.SchemaApplied = true
+	}
+	if im.cfg.Dgraph.ImportMode == "upsert" {
+		for _, path := range paths {
+			if isJSONFile(path) {
+				return summary, fmt.Errorf("upsert mode needs N-Quads, %s can only be imported with set", path)
+			}
+		}
+		if err := im.loadXIDs(paths); err != nil {
+			return summary, err
+		}
+	}
+
+	l := im.newLoader(ctx, summary)
+	err = im.loadData(l, paths)
+	if waitErr := l.wait(); err == nil {
+		err = waitErr
+	}
+	if err == nil {
+		err = im.applyDeletions(ctx, summary)
+	}
+	return im.finish(summary, startTime, err)
+}
+
+// RetryFailed re-sends the batches listed in the failed batches file by a
+// previous run. Batches that fail again are written back to the file.
+func (im *Importer) RetryFailed(ctx context.Context) (*Summary, error) {
+	startTime := time.Now()
+	summary := &Summary{}
+
+	manifestPath := im.failedBatchesPath()
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return summary, fmt.Errorf("failed to read failed batches file: %w", err)
+	}
+	var failed []FailedBatch
+	if err := json.Unmarshal(data, &failed); err != nil {
+		return summary, fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+	}
+
+	im.logger.Info("Retrying failed batches", "file", manifestPath, "batches", len(failed))
+	if im.cfg.Dgraph.ImportMode == "upsert" {
+		var files []string
+		seen := make(map[string]bool)
+		for _, fb := range failed {
+			if !seen[fb.File] {
+				seen[fb.File] = true
+				files = append(files, fb.File)
+			}
+		}
+		if err := im.loadXIDs(files); err != nil {
+			return summary, err
+		}
+	}
+	l := im.newLoader(ctx, summary)
+	err = nil
+	for _, fb := range failed {
+		if isJSONFile(fb.File) {
+			err = im.loadJSONFile(l, fb.File)
+		} else {
+			err = im.loadLines(l, fb)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if waitErr := l.wait(); err == nil {
+		err = waitErr
+	}
+	return im.finish(summary, startTime, err)
+}
+
+// finish records the failed batches, logs the summary and reports failures
+func (im *Importer) finish(summary *Summary, startTime time.Time, err error) (*Summary, error) {
+	summary.Duration = time.Since(startTime)
+	if err != nil {
+		return summary, err
+	}
+
+	if err := im.writeFailedBatches(summary.failed); err != nil {
+		return summary, err
+	}
+	im.logSummary(summary)
+
+	if summary.FailedBatches > 0 {
+		return summary, fmt.Errorf("import finished with %d/%d failed batches, listed in %s",
+			summary.FailedBatches, summary.Batches, im.failedBatchesPath())
+	}
+	return summary, nil
+}
+
+// ApplySchema sends the generated schema file to Dgraph
+func (im *Importer) ApplySchema(ctx context.Context) error {
+	schemaPath := im.schemaPath()
+
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	im.logger.Info("Applying Dgraph schema", "file", schemaPath)
+	err = im.withRetry(ctx, "alter", func() error {
+		return im.transport.Alter(ctx, string(data))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	return nil
+}
+
+// loadData sends each file, as a JSON mutation or as N-Quads by extension
+func (im *Importer) loadData(l *loader, paths []string) error {
+	for _, path := range paths {
+		load := im.loadFile
+		if isJSONFile(path) {
+			load = im.loadJSONFile
+		}
+		if err := load(l, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataFiles returns the files to import: those matching dgraph.import_files,
+// or else the pipeline output in output.directory
+func (im *Importer) dataFiles() ([]string, error) {
+	if len(im.cfg.Dgraph.ImportFiles) > 0 {
+		var paths []string
+		for _, pattern := range im.cfg.Dgraph.ImportFiles {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid import file pattern %s: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", pattern)
+			}
+			for _, match := range matches {
+				if !isJSONFile(match) && !isRDFFile(match) {
+					return nil, fmt.Errorf("cannot import %s: expected .rdf, .nq, .nquad, .nquads or .json, optionally gzipped", match)
+				}
+			}
+			paths = append(paths, matches...)
+		}
+		return paths, nil
+	}
+
+	if im.cfg.Output.Format == "json" {
+		paths, err := im.jsonBatchPaths()
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no JSON batch files in %s", im.cfg.Output.Directory)
+		}
+		return paths, nil
+	}
+
+	// split_by_table writes data_<table>.rdf files instead of rdf_file
+	if im.cfg.Output.SplitByTable {
+		tables, err := filepath.Glob(filepath.Join(im.cfg.Output.Directory, im.cfg.Output.TableRDFPattern()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list table RDF files: %w", err)
+		}
+		if len(tables) == 0 {
+			return nil, fmt.Errorf("no table RDF files in %s", im.cfg.Output.Directory)
+		}
+		sort.Strings(tables)
+		return tables, nil
+	}
+
+	// The chunked exporter writes data_chunk_N.rdf instead of rdf_file
+	paths := im.rdfPaths()
+	if _, err := os.Stat(paths[0]); os.IsNotExist(err) {
+		chunks, err := filepath.Glob(filepath.Join(im.cfg.Output.Directory, im.cfg.Output.CompressedName("data_chunk_*.rdf")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list RDF chunk files: %w", err)
+		}
+		if len(chunks) > 0 {
+			sort.Strings(chunks)
+			return chunks, nil
+		}
+	}
+	return paths, nil
+}
+
+// rdfExtensions are the extensions of files imported as N-Quads
+var rdfExtensions = map[string]bool{".rdf": true, ".nq": true, ".nquad": true, ".nquads": true}
+
+// isRDFFile reports whether path is imported as N-Quads. A .gz suffix is
+// ignored; such files are decompressed while reading.
+func isRDFFile(path string) bool {
+	return rdfExtensions[strings.ToLower(filepath.Ext(compress.TrimExtension(path)))]
+}
+
+// isJSONFile reports whether path is imported as a JSON mutation
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(compress.TrimExtension(path)), ".json")
+}
+
+// schemaPath returns the schema file, relative to the output directory
+// unless it is absolute
+func (im *Importer) schemaPath() string {
+	if filepath.IsAbs(im.cfg.Output.SchemaFile) {
+		return im.cfg.Output.SchemaFile
+	}
+	return filepath.Join(im.cfg.Output.Directory, im.cfg.Output.SchemaFile)
+}
+
+// rdfPaths returns the paths of the RDF files to load
+func (im *Importer) rdfPaths() []string {
+	var paths []string
+	for _, name := range im.cfg.Output.RDFFiles() {
+		paths = append(paths, filepath.Join(im.cfg.Output.Directory, name))
+	}
+	return paths
+}
+
+// loadFile reads an RDF file and sends it in batches of dgraph.batch_size triples
+func (im *Importer) loadFile(l *loader, rdfPath string) error {
+	file, err := compress.Open(rdfPath)
+	if err != nil {
+		return fmt.Errorf("failed to open RDF file: %w", err)
+	}
+	defer file.Close()
+
+	batchSize := im.cfg.Dgraph.BatchSize
+	b := &batch{file: rdfPath, nquads: make([]string, 0, batchSize)}
+
+	err = scanLines(file, func(lineNo int, line string) error {
+		if len(b.nquads) == 0 {
+			b.firstLine = lineNo
+		}
+		b.lastLine = lineNo
+		b.nquads = append(b.nquads, line)
+		if len(b.nquads) < batchSize {
+			return nil
+		}
+		err := l.send(b)
+		b = &batch{file: rdfPath, nquads: make([]string, 0, batchSize)}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(b.nquads) > 0 {
+		return l.send(b)
+	}
+	return nil
+}
+
+// loadLines re-sends the lines of a failed batch as one batch
+func (im *Importer) loadLines(l *loader, fb FailedBatch) error {
+	file, err := compress.Open(fb.File)
+	if err != nil {
+		return fmt.Errorf("failed to open RDF file: %w", err)
+	}
+	defer file.Close()
+
+	b := &batch{file: fb.File, firstLine: fb.FirstLine, lastLine: fb.LastLine}
+	err = scanLines(file, func(lineNo int, line string) error {
+		if lineNo > fb.LastLine {
+			return errStopScan
+		}
+		if lineNo >= fb.FirstLine {
+			b.nquads = append(b.nquads, line)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return err
+	}
+
+	if len(b.nquads) == 0 {
+		im.logger.Warn("Failed batch has no lines left in its file",
+			"file", fb.File, "first_line", fb.FirstLine, "last_line", fb.LastLine)
+		return nil
+	}
+	return l.send(b)
+}
+
+// errStopScan ends scanLines early without reporting an error
+var errStopScan = errors.New("stop scan")
+
+// scanLines calls fn with every N-Quad line of r and its 1-based line number,
+// skipping blank lines and comments
+func scanLines(r io.Reader, fn func(lineNo int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(lineNo, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read RDF file: %w", err)
+	}
+	return nil
+}
+
+// failedBatchesPath returns the path of the failed batches file
+func (im *Importer) failedBatchesPath() string {
+	return filepath.Join(im.cfg.Output.Directory, im.cfg.Output.FailedBatchesFile)
+}
+
+// writeFailedBatches writes the failed batches file, or removes a stale one
+// when every batch succeeded
+func (im *Importer) writeFailedBatches(failed []FailedBatch) error {
+	path := im.failedBatchesPath()
+	if len(failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove failed batches file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(failed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode failed batches: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write failed batches file: %w", err)
+	}
+	return nil
+}
+
+// withRetry runs a Dgraph request, retrying retryable errors up to
+// dgraph.max_retries times
+func (im *Importer) withRetry(ctx context.Context, operation string, fn func() error) error {
+	return im.retries.Do(ctx, im.cfg.Dgraph.MaxRetries, im.cfg.Dgraph.RetryDelay,
+		func(attempt int, err error) {
+			im.logger.Warn("Retrying Dgraph request", "operation", operation, "attempt", attempt, "error", err)
+		}, fn)
+}
+
+func (im *Importer) logSummary(summary *Summary) {
+	im.logger.Info("Import completed",
+		"schema_applied", summary.SchemaApplied,
+		"batches", summary.Batches,
+		"failed_batches", summary.FailedBatches,
+		"triples", summary.Triples,
+		"nodes", summary.Nodes,
+		"deletions", summary.Deletions,
+		"duration", summary.Duration.Round(time.Millisecond))
+}
@@ -0,0 +1,374 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// flakyTransport fails its first mutations with err, then commits them
+type flakyTransport struct {
+	fakeTransport
+	mu       sync.Mutex
+	fails    int
+	err      error
+	attempts int
+}
+
+func (f *flakyTransport) Mutate(ctx context.Context, nquads []string) (map[string]string, error) {
+	f.mu.Lock()
+	f.attempts++
+	if f.fails > 0 {
+		f.fails--
+		f.mu.Unlock()
+		return nil, f.err
+	}
+	f.mu.Unlock()
+	return f.fakeTransport.Mutate(ctx, nquads)
+}
+
+// failingBatchTransport fails every mutation holding the failOn N-Quad
+type failingBatchTransport struct {
+	fakeTransport
+	failOn string
+	err    error
+}
+
+func (f *failingBatchTransport) Mutate(ctx context.Context, nquads []string) (map[string]string, error) {
+	for _, nquad := range nquads {
+		if nquad == f.failOn {
+			return nil, f.err
+		}
+	}
+	return f.fakeTransport.Mutate(ctx, nquads)
+}
+
+// importConfig imports five unrelated triples, two to a batch
+func importConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.rdf")
+	lines := []string{`_:a <name> "a" .`, `_:b <name> "b" .`, `_:c <name> "c" .`, `_:d <name> "d" .`, `_:e <name> "e" .`}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = dir
+	cfg.Dgraph.ImportFiles = []string{path}
+	cfg.Dgraph.BatchSize = 2
+	cfg.Dgraph.Parallel = 1
+	cfg.Dgraph.RetryDelay = time.Millisecond
+	cfg.Retry.MaxDelay = 4 * time.Millisecond
+	cfg.Pipeline.ProgressReportInterval = 0
+	return cfg
+}
+
+func TestImportRetries(t *testing.T) {
+	aborted := errors.New("Transaction has been aborted. Please retry")
+	tests := []struct {
+		name       string
+		fails      int
+		err        error
+		maxRetries int
+		attempts   int
+		triples    int64
+		failed     [][2]int // First and last line of each failed batch
+	}{
+		{name: "committed first time", maxRetries: 3, attempts: 3, triples: 5},
+		{name: "aborted then committed", fails: 2, err: aborted, maxRetries: 3, attempts: 5, triples: 5},
+		{name: "deadline then committed", fails: 1, err: context.DeadlineExceeded, maxRetries: 1, attempts: 4, triples: 5},
+		{name: "aborted past the retries", fails: 100, err: aborted, maxRetries: 2, attempts: 9,
+			failed: [][2]int{{1, 2}, {3, 4}, {5, 5}}},
+		{name: "fatal error is not retried", fails: 1, err: errors.New("invalid N-Quad syntax"), maxRetries: 3, attempts: 3,
+			triples: 3, failed: [][2]int{{1, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := importConfig(t)
+			cfg.Dgraph.MaxRetries = tt.maxRetries
+			transport := &flakyTransport{fails: tt.fails, err: tt.err}
+			summary, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true)
+
+			if transport.attempts != tt.attempts {
+				t.Errorf("%d mutations attempted, want %d", transport.attempts, tt.attempts)
+			}
+			if summary.Batches != 3 || summary.FailedBatches != len(tt.failed) {
+				t.Errorf("batches %d, failed %d; want 3, %d", summary.Batches, summary.FailedBatches, len(tt.failed))
+			}
+			if summary.Triples != tt.triples {
+				t.Errorf("imported %d triples, want %d", summary.Triples, tt.triples)
+			}
+
+			manifest := filepath.Join(cfg.Output.Directory, cfg.Output.FailedBatchesFile)
+			if len(tt.failed) == 0 {
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+				if _, err := os.Stat(manifest); !os.IsNotExist(err) {
+					t.Errorf("failed batches file written: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "failed batches, listed in "+manifest) {
+				t.Errorf("Run = %v, want the failed batches reported", err)
+			}
+			data, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatalf("no failed batches file: %v", err)
+			}
+			var failed []FailedBatch
+			if err := json.Unmarshal(data, &failed); err != nil {
+				t.Fatal(err)
+			}
+			var lines [][2]int
+			for _, fb := range failed {
+				lines = append(lines, [2]int{fb.FirstLine, fb.LastLine})
+				if fb.File != cfg.Dgraph.ImportFiles[0] || fb.Triples != fb.LastLine-fb.FirstLine+1 || !strings.Contains(fb.Error, tt.err.Error()) {
+					t.Errorf("failed batch %+v", fb)
+				}
+			}
+			if !reflect.DeepEqual(lines, tt.failed) {
+				t.Errorf("failed batches at lines %v, want %v", lines, tt.failed)
+			}
+		})
+	}
+}
+
+// TestRetryFailed re-sends the batches a run could not commit and checks
+// the failed batches file is removed once they are in
+func TestRetryFailed(t *testing.T) {
+	cfg := importConfig(t)
+	cfg.Dgraph.MaxRetries = 0
+	// The second batch fails
+	transport := &failingBatchTransport{failOn: `_:c <name> "c" .`, err: errors.New("Transaction has been aborted")}
+	if _, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true); err == nil {
+		t.Fatal("Run succeeded with a failing batch")
+	}
+	manifest := filepath.Join(cfg.Output.Directory, cfg.Output.FailedBatchesFile)
+	if _, err := os.Stat(manifest); err != nil {
+		t.Fatalf("no failed batches file: %v", err)
+	}
+
+	// Still failing: the file is kept
+	if _, err := NewWithTransport(cfg, logger.New("error", "text"), transport).RetryFailed(context.Background()); err == nil {
+		t.Error("RetryFailed succeeded with the batch still failing")
+	}
+	if _, err := os.Stat(manifest); err != nil {
+		t.Fatalf("failed batches file removed while the batch still fails: %v", err)
+	}
+
+	retried := &fakeTransport{}
+	summary, err := NewWithTransport(cfg, logger.New("error", "text"), retried).RetryFailed(context.Background())
+	if err != nil {
+		t.Fatalf("RetryFailed: %v", err)
+	}
+	want := [][]string{{`_:c <name> "c" .`, `_:d <name> "d" .`}}
+	if !reflect.DeepEqual(retried.batches, want) {
+		t.Errorf("retried batches %q, want %q", retried.batches, want)
+	}
+	if summary.Batches != 1 || summary.Triples != 2 {
+		t.Errorf("summary %+v, want 1 batch of 2 triples", summary)
+	}
+	if _, err := os.Stat(manifest); !os.IsNotExist(err) {
+		t.Errorf("failed batches file left after a successful retry: %v", err)
+	}
+}
+
+func TestDataFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		format      string
+		importFiles []string // Relative to the output directory
+		want        []string
+		errText     string
+	}{
+		{name: "rdf file", files: []string{"data.rdf", "data_chunk_0.rdf"}, want: []string{"data.rdf"}},
+		{name: "chunks", files: []string{"data_chunk_1.rdf", "data_chunk_0.rdf"}, want: []string{"data_chunk_0.rdf", "data_chunk_1.rdf"}},
+		{name: "no data", want: []string{"data.rdf"}},
+		{name: "json batches", format: "json", files: []string{"batch_0002.json", "batch_0001.json", "data.rdf"},
+			want: []string{"batch_0001.json", "batch_0002.json"}},
+		{name: "no json batches", format: "json", files: []string{"data.rdf"}, errText: "no JSON batch files"},
+		{
+			name:        "import files",
+			files:       []string{"data.rdf", "a.nquads", "b.NQ", "extra.json"},
+			importFiles: []string{"*.nquads", "b.NQ", "extra.json"},
+			want:        []string{"a.nquads", "b.NQ", "extra.json"},
+		},
+		{name: "unknown extension", files: []string{"notes.txt"}, importFiles: []string{"notes.txt"}, errText: "cannot import"},
+		{name: "no match", importFiles: []string{"dump/*.rdf"}, errText: "no files match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			if tt.format != "" {
+				cfg.Output.Format = tt.format
+			}
+			for _, pattern := range tt.importFiles {
+				cfg.Dgraph.ImportFiles = append(cfg.Dgraph.ImportFiles, filepath.Join(dir, pattern))
+			}
+
+			paths, err := NewWithTransport(cfg, logger.New("error", "text"), &fakeTransport{}).dataFiles()
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("dataFiles error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dataFiles: %v", err)
+			}
+			var names []string
+			for _, path := range paths {
+				names = append(names, filepath.Base(path))
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("dataFiles = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+// TestImportByExtension imports an RDF chunk, an N-Quads file and a JSON
+// batch and checks each is sent as the mutation its extension calls for
+func TestImportByExtension(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"data_chunk_0.rdf": "_:a <name> \"a\" .\n",
+		"extra.nquads":     "_:b <name> \"b\" .\n",
+		"batch_0001.json":  `{"set": [{"uid": "_:c", "name": "c"}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = dir
+	cfg.Dgraph.ImportFiles = []string{
+		filepath.Join(dir, "data_chunk_0.rdf"),
+		filepath.Join(dir, "extra.nquads"),
+		filepath.Join(dir, "batch_0001.json"),
+	}
+	cfg.Pipeline.ProgressReportInterval = 0
+
+	transport := &streamTransport{}
+	summary, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	wantNQuads := [][]string{{`_:a <name> "a" .`}, {`_:b <name> "b" .`}}
+	if !reflect.DeepEqual(transport.batches, wantNQuads) {
+		t.Errorf("N-Quads mutations %q, want %q", transport.batches, wantNQuads)
+	}
+	if len(transport.bodies) != 1 || transport.bodies[0] != files["batch_0001.json"] {
+		t.Errorf("JSON mutations %q, want the batch file", transport.bodies)
+	}
+	if summary.Batches != 3 || summary.FailedBatches != 0 {
+		t.Errorf("summary %+v, want 3 batches", summary)
+	}
+
+	// Upsert mode cannot import the JSON batch
+	cfg.Dgraph.ImportMode = "upsert"
+	_, err = NewWithTransport(cfg, logger.New("error", "text"), &streamTransport{}).Run(context.Background(), true)
+	if err == nil || !strings.Contains(err.Error(), "can only be imported with set") {
+		t.Errorf("upsert Run = %v, want the JSON batch rejected", err)
+	}
+}
+
+// TestImportCompressed imports gzipped output and checks it is read as the
+// plain files would be
+func TestImportCompressed(t *testing.T) {
+	rdf := "_:users_1 <xid> \"users:1\" .\n_:users_1 <name> \"Ada\" .\n"
+	tests := []struct {
+		name   string
+		format string
+		mode   string
+		files  map[string]string // Written gzipped, with .gz appended
+		nquads [][]string
+		json   []string
+	}{
+		{name: "rdf file", files: map[string]string{"data.rdf": rdf},
+			nquads: [][]string{{`_:users_1 <xid> "users:1" .`, `_:users_1 <name> "Ada" .`}}},
+		{name: "chunks", files: map[string]string{"data_chunk_0.rdf": rdf, "data_chunk_1.rdf": "_:b <name> \"b\" .\n"},
+			nquads: [][]string{{`_:users_1 <xid> "users:1" .`, `_:users_1 <name> "Ada" .`}, {`_:b <name> "b" .`}}},
+		{name: "json batches", format: "json", files: map[string]string{"batch_0001.json": `{"set": [{"uid": "_:a"}]}`},
+			json: []string{`{"set": [{"uid": "_:a"}]}`}},
+		{name: "upsert", mode: "upsert", files: map[string]string{"data.rdf": rdf}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				file, err := os.Create(filepath.Join(dir, name+compress.Extension(compress.Gzip)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := compress.NewWriter(file, compress.Gzip)
+				if _, err := w.Write([]byte(content)); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			cfg.Output.Compression = compress.Gzip
+			if tt.format != "" {
+				cfg.Output.Format = tt.format
+			}
+			if tt.mode != "" {
+				cfg.Dgraph.ImportMode = tt.mode
+			}
+			cfg.Dgraph.Parallel = 1
+			cfg.Pipeline.ProgressReportInterval = 0
+
+			transport := &upsertRecorder{}
+			if _, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !reflect.DeepEqual(transport.batches, tt.nquads) {
+				t.Errorf("N-Quads mutations %q, want %q", transport.batches, tt.nquads)
+			}
+			if !reflect.DeepEqual(transport.bodies, tt.json) {
+				t.Errorf("JSON mutations %q, want %q", transport.bodies, tt.json)
+			}
+			if tt.mode == "upsert" && !strings.Contains(transport.query, `eq(xid, "users:1")`) {
+				t.Errorf("upsert query %q does not look up users:1 from the gzipped file", transport.query)
+			}
+		})
+	}
+}
+
+// upsertRecorder records JSON mutations and the last upsert query
+type upsertRecorder struct {
+	streamTransport
+	query string
+}
+
+func (u *upsertRecorder) Upsert(_ context.Context, query string, _ []string) error {
+	u.mu.Lock()
+	u.query = query
+	u.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+)
+
+// jsonBatchPaths returns the batch_NNNN.json files written by output.format
+// json, in the order they were written
+func (im *Importer) jsonBatchPaths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(im.cfg.Output.Directory, im.cfg.Output.CompressedName("batch_*.json")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list JSON batch files: %w", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// loadJSONFile checks that a batch file is a valid mutation and sends it as
+// one batch; invalid files count as failed batches. Neither step holds more
+// than one node of the file in memory.
+func (im *Importer) loadJSONFile(l *loader, path string) error {
+	file, err := compress.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open JSON batch file: %w", err)
+	}
+	nodes, err := countJSONNodes(file)
+	file.Close()
+
+	b := &batch{file: path, json: true, nodes: nodes}
+	if err != nil {
+		l.fail(l.next(), b, fmt.Errorf("invalid JSON mutation: %w", err))
+		return nil
+	}
+	return l.send(b)
+}
+
+// countJSONNodes reads a {"set":[...], "delete":[...]} mutation, or an upsert
+// block that adds a "query", token by token and returns the number of nodes
+// it holds
+func countJSONNodes(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+
+	nodes := 0
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return 0, err
+		}
+		key := token.(string)
+		if key == "query" {
+			if token, err = dec.Token(); err != nil {
+				return 0, err
+			}
+			if _, ok := token.(string); !ok {
+				return 0, fmt.Errorf("query must be a string")
+			}
+			continue
+		}
+		if key != "set" && key != "delete" {
+			return 0, fmt.Errorf("unexpected key %q, want set, delete or query", key)
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return 0, err
+		}
+		for dec.More() {
+			var node json.RawMessage
+			if err := dec.Decode(&node); err != nil {
+				return 0, err
+			}
+			nodes++
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return 0, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return 0, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return 0, fmt.Errorf("unexpected data after the mutation")
+	}
+	return nodes, nil
+}
+
+// expectDelim reads the next token and checks that it is delim
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// mutateJSONFile streams a JSON batch file to Dgraph. The file is reopened
+// for every attempt, since a failed request may have consumed part of it.
+func (im *Importer) mutateJSONFile(ctx context.Context, path string) error {
+	file, err := compress.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open JSON batch file: %w", err)
+	}
+	defer file.Close()
+	return im.transport.MutateJSON(ctx, file)
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestCountJSONNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		nodes   int
+		errText string
+	}{
+		{name: "set", json: `{"set": [{"uid": "_:a"}, {"uid": "_:b", "friend": {"uid": "_:a"}}]}`, nodes: 2},
+		{name: "set and delete", json: `{"set": [{"uid": "_:a"}], "delete": [{"uid": "0x1"}]}`, nodes: 2},
+		{name: "upsert block", json: `{"query": "{ v as var(func: eq(xid, \"a\")) }", "set": [{"uid": "uid(v)"}]}`, nodes: 1},
+		{name: "empty set", json: `{"set": []}`},
+		{name: "unknown key", json: `{"nodes": []}`, errText: `unexpected key "nodes"`},
+		{name: "set is not a list", json: `{"set": {"uid": "_:a"}}`, errText: "expected"},
+		{name: "query is not a string", json: `{"query": 1, "set": []}`, errText: "query must be a string"},
+		{name: "truncated", json: `{"set": [{"uid": "_:a"}`, errText: "unexpected end of JSON input"},
+		{name: "trailing data", json: `{"set": []} {"set": []}`, errText: "unexpected data after the mutation"},
+		{name: "not an object", json: `[]`, errText: "expected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := countJSONNodes(strings.NewReader(tt.json))
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("countJSONNodes error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("countJSONNodes: %v", err)
+			}
+			if nodes != tt.nodes {
+				t.Errorf("countJSONNodes = %d, want %d", nodes, tt.nodes)
+			}
+		})
+	}
+}
+
+// syntheticBatch generates a JSON mutation of n nodes as it is read, so the
+// test holds none of it, and records the most heap in use while it is read
+type syntheticBatch struct {
+	n, next  int
+	buf      bytes.Buffer
+	baseHeap uint64
+	peakHeap uint64
+}
+
+func (s *syntheticBatch) Read(p []byte) (int, error) {
+	for s.buf.Len() < len(p) && s.next <= s.n {
+		switch {
+		case s.next == 0:
+			s.buf.WriteString(`{"set": [`)
+		case s.next == s.n:
+			s.buf.WriteString(`{"uid": "_:last"}]}`)
+		default:
+			fmt.Fprintf(&s.buf, `{"uid": "_:n%d", "name": "%s", "dgraph.type": "users"},`, s.next, strings.Repeat("x", 200))
+		}
+		s.next++
+		if s.next%1000 == 0 {
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			s.peakHeap = max(s.peakHeap, mem.HeapAlloc)
+		}
+	}
+	if s.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.buf.Read(p)
+}
+
+// TestCountJSONNodesStreams counts a batch far larger than the heap it may
+// use, so it cannot be read whole
+func TestCountJSONNodesStreams(t *testing.T) {
+	const nodes = 150000 // About 40 MB
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	batch := &syntheticBatch{n: nodes, baseHeap: mem.HeapAlloc}
+
+	got, err := countJSONNodes(batch)
+	if err != nil {
+		t.Fatalf("countJSONNodes: %v", err)
+	}
+	if got != nodes {
+		t.Errorf("countJSONNodes = %d, want %d", got, nodes)
+	}
+	grown := int64(batch.peakHeap) - int64(batch.baseHeap)
+	if grown > 16<<20 {
+		t.Errorf("heap grew by %d MB reading a 40 MB batch", grown>>20)
+	}
+}
+
+// streamTransport records the JSON mutations it is sent
+type streamTransport struct {
+	fakeTransport
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (s *streamTransport) MutateJSON(_ context.Context, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.bodies = append(s.bodies, string(data))
+	s.mu.Unlock()
+	return nil
+}
+
+// TestImportJSONBatches imports JSON batch files and checks valid ones are
+// sent as they are and invalid ones counted as failed
+func TestImportJSONBatches(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"batch_0001.json": `{"set": [{"uid": "_:a"}, {"uid": "_:b"}]}`,
+		"batch_0002.json": `{"set": [{"uid": "_:c"}`,
+		"batch_0003.json": `{"set": [{"uid": "_:d"}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = dir
+	cfg.Dgraph.ImportFiles = []string{filepath.Join(dir, "batch_*.json")}
+	cfg.Pipeline.ProgressReportInterval = 0
+
+	transport := &streamTransport{}
+	summary, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true)
+	if err == nil || !strings.Contains(err.Error(), "1/3 failed batches") {
+		t.Errorf("Run = %v, want the invalid batch reported", err)
+	}
+	if summary.Nodes != 3 || summary.Batches != 3 || summary.FailedBatches != 1 {
+		t.Errorf("summary %+v, want 3 nodes in 3 batches, 1 failed", summary)
+	}
+	want := []string{files["batch_0001.json"], files["batch_0003.json"]}
+	if strings.Join(transport.bodies, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q, want %q", transport.bodies, want)
+	}
+}
+
+// TestJSONUpsertAcrossBatches imports upsert block batches where an order's
+// edge and the user it references are written by different batches, and
+// checks the edge resolves to the one user node in either import order
+func TestJSONUpsertAcrossBatches(t *testing.T) {
+	order := `{"query": "{\n  v0 as var(func: eq(xid, \"orders:1\"))\n  v1 as var(func: eq(xid, \"users:1\"))\n}",` +
+		` "set": [{"uid": "uid(v0)", "xid": "orders:1", "orders.user": {"uid": "uid(v1)", "xid": "users:1"}}]}`
+	user := `{"query": "{\n  v0 as var(func: eq(xid, \"users:1\"))\n}", "set": [{"uid": "uid(v0)", "xid": "users:1", "users.name": "Ada"}]}`
+	tests := []struct {
+		name    string
+		batches []string
+	}{
+		{name: "reference first", batches: []string{order, user}},
+		{name: "node first", batches: []string{user, order}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, batch := range tt.batches {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("batch_%04d.json", i+1)), []byte(batch), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			cfg.Dgraph.ImportFiles = []string{filepath.Join(dir, "batch_*.json")}
+			cfg.Pipeline.ProgressReportInterval = 0
+
+			graph := newGraphTransport()
+			if _, err := NewWithTransport(cfg, logger.New("error", "text"), graph).Run(context.Background(), true); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if len(graph.nodes) != 2 {
+				t.Errorf("%d nodes, want the order and the user: %v", len(graph.nodes), graph.nodes)
+			}
+			userUID := graph.byXID[`"users:1"`]
+			if name := graph.nodes[userUID]["<users.name>"]; name != `"Ada"` {
+				t.Errorf("users:1 name %s, want \"Ada\"", name)
+			}
+			if linked := graph.nodes[graph.byXID[`"orders:1"`]]["<orders.user>"]; linked != userUID {
+				t.Errorf("orders:1 links %q, want users:1 %q", linked, userUID)
+			}
+		})
+	}
+}
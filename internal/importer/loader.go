@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loader commits batches on up to dgraph.parallel goroutines, each batch in
+// its own transaction, and collects the results in one summary
+type loader struct {
+	im      *Importer
+	ctx     context.Context
+	batches chan *batch // nil when batches are committed in order
+	wg      sync.WaitGroup
+	stop    chan struct{}
+
+	nodes map[string]*blankNode // Blank nodes of the batches sent so far, by label
+
+	mu      sync.Mutex // Guards summary
+	summary *Summary
+}
+
+// newLoader starts the workers and the progress reporter
+func (im *Importer) newLoader(ctx context.Context, summary *Summary) *loader {
+	l := &loader{
+		im:      im,
+		ctx:     ctx,
+		stop:    make(chan struct{}),
+		nodes:   make(map[string]*blankNode),
+		summary: summary,
+	}
+
+	if workers := im.cfg.Dgraph.Parallel; workers > 1 {
+		l.batches = make(chan *batch, workers)
+		for i := 0; i < workers; i++ {
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				for b := range l.batches {
+					// A cancelled context fails the remaining batches
+					// quickly; wait reports it
+					_ = l.commit(b)
+				}
+			}()
+		}
+	}
+
+	if interval := im.cfg.Pipeline.ProgressReportInterval; interval > 0 {
+		go l.reportProgress(interval, time.Now())
+	}
+	return l
+}
+
+// send commits b, or hands it to a worker when loading in parallel. Upsert
+// mode finds nodes by external ID instead of carrying their UIDs.
+func (l *loader) send(b *batch) error {
+	if !b.json && l.im.xids == nil {
+		l.track(b)
+	}
+	if l.batches == nil {
+		return l.commit(b)
+	}
+	select {
+	case l.batches <- b:
+		return nil
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+}
+
+// wait blocks until every sent batch has been committed or failed
+func (l *loader) wait() error {
+	if l.batches != nil {
+		close(l.batches)
+		l.wg.Wait()
+	}
+	close(l.stop)
+	return l.ctx.Err()
+}
+
+// commit sends one batch. Batches that fail after all retries are counted,
+// logged and kept for the failed batches file; only a cancelled context
+// aborts the import.
+func (l *loader) commit(b *batch) error {
+	var assigned map[string]string
+	defer func() { b.assign(assigned) }()
+
+	ctx := l.ctx
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nquads, err := l.resolve(b)
+	if err != nil {
+		return err
+	}
+
+	number := l.next()
+	err = l.im.withRetry(ctx, "mutate", func() error {
+		if b.json {
+			return l.im.mutateJSONFile(ctx, b.file)
+		}
+		if l.im.xids != nil {
+			if query, set := l.im.upsertBlock(b.nquads); query != "" {
+				return l.im.transport.Upsert(ctx, query, set)
+			}
+		}
+		var err error
+		assigned, err = l.im.transport.Mutate(ctx, nquads)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l.fail(number, b, err)
+		return nil
+	}
+
+	l.mu.Lock()
+	l.summary.Triples += int64(len(b.nquads))
+	l.summary.Nodes += int64(b.nodes)
+	l.mu.Unlock()
+	l.im.logger.Debug("Imported batch", "batch", number, "triples", len(b.nquads), "nodes", b.nodes)
+	return nil
+}
+
+// next counts a batch and returns its number
+func (l *loader) next() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.summary.Batches++
+	return l.summary.Batches
+}
+
+// fail records a batch for the failed batches file
+func (l *loader) fail(number int, b *batch, err error) {
+	l.mu.Lock()
+	l.summary.FailedBatches++
+	l.summary.failed = append(l.summary.failed, FailedBatch{
+		File:      b.file,
+		FirstLine: b.firstLine,
+		LastLine:  b.lastLine,
+		Triples:   len(b.nquads),
+		Nodes:     b.nodes,
+		Error:     err.Error(),
+	})
+	l.mu.Unlock()
+
+	l.im.logger.Error("Failed to import batch",
+		"batch", number,
+		"file", b.file,
+		"lines", fmt.Sprintf("%d-%d", b.firstLine, b.lastLine),
+		"triples", len(b.nquads),
+		"error", err)
+}
+
+// reportProgress logs the totals across all workers every interval
+func (l *loader) reportProgress(interval time.Duration, start time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			batches, failed, triples, nodes := l.summary.Batches, l.summary.FailedBatches, l.summary.Triples, l.summary.Nodes
+			l.mu.Unlock()
+			l.im.logger.Info("Import progress",
+				"batches", batches,
+				"failed_batches", failed,
+				"triples", triples,
+				"nodes", nodes,
+				"triples_per_second", int64(float64(triples)/time.Since(start).Seconds()))
+		case <-l.stop:
+			return
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
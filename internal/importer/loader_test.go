@@ -0,0 +1,247 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// fakeTransport commits mutations in memory, assigning a new UID to every
+// blank node of a batch
+type fakeTransport struct {
+	mu       sync.Mutex
+	batches  [][]string
+	assigned int
+}
+
+func (f *fakeTransport) Alter(context.Context, string) error { return nil }
+
+func (f *fakeTransport) Mutate(_ context.Context, nquads []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, nquads)
+	uids := make(map[string]string)
+	for _, nquad := range nquads {
+		for _, label := range BlankNodes(nquad) {
+			if _, ok := uids[label]; !ok {
+				f.assigned++
+				uids[label] = fmt.Sprintf("0x%x", f.assigned)
+			}
+		}
+	}
+	return uids, nil
+}
+
+func (f *fakeTransport) Upsert(context.Context, string, []string) error { return nil }
+func (f *fakeTransport) Delete(context.Context, string, []string) error { return nil }
+func (f *fakeTransport) MutateJSON(context.Context, io.Reader) error    { return nil }
+func (f *fakeTransport) Query(context.Context, string) (json.RawMessage, error) {
+	return json.RawMessage(`{}`), nil
+}
+func (f *fakeTransport) Close() error { return nil }
+
+// importLines imports lines as one RDF file in batches of batchSize
+func importLines(t *testing.T, lines []string, batchSize, parallel int) *fakeTransport {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.rdf")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = dir
+	cfg.Dgraph.ImportFiles = []string{path}
+
+	cfg.Dgraph.BatchSize = batchSize
+	cfg.Dgraph.Parallel = parallel
+	cfg.Pipeline.ProgressReportInterval = 0
+
+	transport := &fakeTransport{}
+	im := NewWithTransport(cfg, logger.New("error", "text"), transport)
+	if _, err := im.Run(context.Background(), true); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return transport
+}
+
+func TestLoaderCarriesUIDsAcrossBatches(t *testing.T) {
+	lines := []string{
+		`_:users_1 <dgraph.type> "users" .`,
+		`_:companies_9 <dgraph.type> "companies" .`,
+		`_:users_1 <users.company> _:companies_9 .`,
+		`_:users_2 <users.company> _:companies_9 (since=2020-01-01T00:00:00Z) .`,
+		`_:users_2 <users.manager> _:users_1 .`,
+		`_:users_2 <dgraph.type> "users" .`,
+	}
+	for _, parallel := range []int{1, 4} {
+		t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+			transport := importLines(t, lines, 2, parallel)
+
+			if len(transport.batches) != 3 {
+				t.Fatalf("got %d batches, want 3", len(transport.batches))
+			}
+			// users_1, companies_9 and users_2 are each created once
+			if transport.assigned != 3 {
+				t.Errorf("%d nodes created, want 3: %v", transport.assigned, transport.batches)
+			}
+			var all []string
+			for _, batch := range transport.batches {
+				all = append(all, batch...)
+			}
+			for _, nquad := range all {
+				if strings.Contains(nquad, "_:users_1") && !strings.HasPrefix(nquad, "_:users_1 <dgraph.type>") {
+					t.Errorf("users_1 was not resolved to its UID in %q", nquad)
+				}
+			}
+			if !contains(all, `<0x2> (since=2020-01-01T00:00:00Z) .`) {
+				t.Errorf("facets were not kept after the resolved object: %v", all)
+			}
+		})
+	}
+}
+
+// concurrentTransport holds each mutation for a while and records the most
+// mutations in flight at once
+type concurrentTransport struct {
+	fakeTransport
+	failOn string // Mutations holding this N-Quad fail
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (c *concurrentTransport) Mutate(ctx context.Context, nquads []string) (map[string]string, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		most := c.maxInFlight.Load()
+		if n <= most || c.maxInFlight.CompareAndSwap(most, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	for _, nquad := range nquads {
+		if nquad == c.failOn {
+			return nil, errors.New("invalid N-Quad")
+		}
+	}
+	return c.fakeTransport.Mutate(ctx, nquads)
+}
+
+// TestParallelImport loads independent batches with and without parallel
+// workers and checks how many were committed at once and the summary
+func TestParallelImport(t *testing.T) {
+	var lines []string
+	for i := 0; i < 16; i++ {
+		lines = append(lines, fmt.Sprintf(`_:n%d <name> "n%d" .`, i, i))
+	}
+	tests := []struct {
+		name          string
+		parallel      int
+		failOn        string
+		atLeast, most int32 // Bounds of the mutations in flight at once
+		failed        int
+	}{
+		{name: "ordered", parallel: 1, atLeast: 1, most: 1},
+		{name: "parallel", parallel: 4, atLeast: 2, most: 4},
+		{name: "parallel with a failing batch", parallel: 4, failOn: lines[5], atLeast: 2, most: 4, failed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data.rdf")
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			cfg.Dgraph.ImportFiles = []string{path}
+			cfg.Dgraph.BatchSize = 2
+			cfg.Dgraph.Parallel = tt.parallel
+			cfg.Dgraph.MaxRetries = 0
+			cfg.Pipeline.ProgressReportInterval = 0
+
+			transport := &concurrentTransport{failOn: tt.failOn}
+			summary, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true)
+			if (err != nil) != (tt.failed > 0) {
+				t.Errorf("Run = %v, want an error: %v", err, tt.failed > 0)
+			}
+			if most := transport.maxInFlight.Load(); most < tt.atLeast || most > tt.most {
+				t.Errorf("%d mutations in flight at once, want %d to %d", most, tt.atLeast, tt.most)
+			}
+			if summary.Batches != 8 || summary.FailedBatches != tt.failed || summary.Triples != int64(16-2*tt.failed) {
+				t.Errorf("summary %+v, want 8 batches, %d failed, %d triples", summary, tt.failed, 16-2*tt.failed)
+			}
+			if got := len(transport.batches); got != 8-tt.failed {
+				t.Errorf("%d batches committed, want %d", got, 8-tt.failed)
+			}
+		})
+	}
+}
+
+// contains reports whether any line ends with suffix
+func contains(lines []string, suffix string) bool {
+	for _, line := range lines {
+		if strings.HasSuffix(line, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBlankNodes(t *testing.T) {
+	tests := []struct {
+		nquad  string
+		labels []string
+	}{
+		{`_:a <name> "A" .`, []string{"a"}},
+		{`_:a <friend> _:b .`, []string{"a", "b"}},
+		{`_:a <friend> _:b (since=2020) .`, []string{"a", "b"}},
+		{`_:a <note> "_:b is not a node" .`, []string{"a"}},
+		{`<0x1> <friend> _:b .`, []string{"b"}},
+		{`uid(v0) <friend> <0x2> .`, nil},
+		{`not an nquad`, nil},
+	}
+	for _, tt := range tests {
+		got := BlankNodes(tt.nquad)
+		if strings.Join(got, ",") != strings.Join(tt.labels, ",") {
+			t.Errorf("BlankNodes(%q) = %v, want %v", tt.nquad, got, tt.labels)
+		}
+	}
+}
+
+func TestResolveBlankNodes(t *testing.T) {
+	uids := map[string]string{"a": "0x1", "b": "0x2"}
+	lookup := func(label string) (string, bool) {
+		uid, ok := uids[label]
+		return uid, ok
+	}
+	tests := []struct {
+		nquad string
+		want  string
+	}{
+		{`_:a <name> "A" .`, `<0x1> <name> "A" .`},
+		{`_:a <friend> _:b .`, `<0x1> <friend> <0x2> .`},
+		{`_:c <friend> _:b (since=2020, weight=0.5) .`, `_:c <friend> <0x2> (since=2020, weight=0.5) .`},
+		{`_:c <note> "_:a" .`, `_:c <note> "_:a" .`},
+		{`_:c <friend> _:d .`, `_:c <friend> _:d .`},
+	}
+	for _, tt := range tests {
+		if got := ResolveBlankNodes(tt.nquad, lookup); got != tt.want {
+			t.Errorf("ResolveBlankNodes(%q) = %q, want %q", tt.nquad, got, tt.want)
+		}
+	}
+}
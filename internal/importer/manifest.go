@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// manifestChunk is a file entry of the manifest the chunked exporter writes
+type manifestChunk struct {
+	File     string `json:"file"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// verifyChecksums checks every file against output.manifest_file before any
+// is loaded. A file missing from the manifest, or whose size or checksum
+// differs, fails the import.
+func (im *Importer) verifyChecksums(paths []string) error {
+	manifestPath := filepath.Join(im.cfg.Output.Directory, im.cfg.Output.ManifestFile)
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest struct {
+		Chunks []manifestChunk `json:"chunks"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+	}
+
+	chunks := make(map[string]manifestChunk, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		chunks[filepath.Clean(filepath.Join(im.cfg.Output.Directory, chunk.File))] = chunk
+	}
+
+	for _, path := range paths {
+		chunk, ok := chunks[filepath.Clean(path)]
+		if !ok {
+			return fmt.Errorf("%s is not listed in manifest %s", path, manifestPath)
+		}
+		size, checksum, err := fileChecksum(path)
+		if err != nil {
+			return fmt.Errorf("failed to checksum %s: %w", path, err)
+		}
+		if size != chunk.Size || checksum != chunk.Checksum {
+			return fmt.Errorf("%s does not match manifest: %d bytes %s, want %d bytes %s",
+				path, size, checksum, chunk.Size, chunk.Checksum)
+		}
+	}
+
+	im.logger.Info("Checksums verified", "manifest", manifestPath, "files", len(paths))
+	return nil
+}
+
+// fileChecksum returns the size and sha256:<hex> checksum of a file as stored
+func fileChecksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
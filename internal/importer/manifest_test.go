@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	chunks := map[string]string{
+		"data_chunk_1.rdf": "_:a <name> \"a\" .\n",
+		"data_chunk_2.rdf": "_:b <name> \"b\" .\n",
+	}
+	entry := func(name, content string) string {
+		return fmt.Sprintf(`{"file": %q, "size": %d, "checksum": "sha256:%x"}`, name, len(content), sha256.Sum256([]byte(content)))
+	}
+	intact := fmt.Sprintf(`{"chunks": [%s, %s]}`,
+		entry("data_chunk_1.rdf", chunks["data_chunk_1.rdf"]), entry("data_chunk_2.rdf", chunks["data_chunk_2.rdf"]))
+
+	tests := []struct {
+		name     string
+		manifest string // Empty = no manifest
+		tamper   string // Content written over data_chunk_2.rdf
+		errText  string
+	}{
+		{name: "intact", manifest: intact},
+		{name: "changed chunk", manifest: intact, tamper: "_:c <name> \"c\" .\n", errText: "data_chunk_2.rdf does not match manifest"},
+		{name: "truncated chunk", manifest: intact, tamper: "_:b <name>", errText: "data_chunk_2.rdf does not match manifest"},
+		{name: "chunk not listed", manifest: fmt.Sprintf(`{"chunks": [%s]}`, entry("data_chunk_1.rdf", chunks["data_chunk_1.rdf"])),
+			errText: "data_chunk_2.rdf is not listed in manifest"},
+		{name: "no manifest", errText: "failed to read manifest"},
+		{name: "invalid manifest", manifest: `{"chunks": `, errText: "invalid manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range chunks {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tamper != "" {
+				if err := os.WriteFile(filepath.Join(dir, "data_chunk_2.rdf"), []byte(tt.tamper), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			cfg.Dgraph.VerifyChecksums = true
+			cfg.Pipeline.ProgressReportInterval = 0
+			if tt.manifest != "" {
+				if err := os.WriteFile(filepath.Join(dir, cfg.Output.ManifestFile), []byte(tt.manifest), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			transport := &fakeTransport{}
+			_, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Run(context.Background(), true)
+			if tt.errText == "" {
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+				if len(transport.batches) != 2 {
+					t.Errorf("loaded %d batches, want both chunks", len(transport.batches))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Fatalf("Run error = %v, want it to contain %q", err, tt.errText)
+			}
+			if len(transport.batches) != 0 {
+				t.Errorf("loaded %d batches before the checksums were verified", len(transport.batches))
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// Transport applies schema and mutations to a Dgraph cluster
+type Transport interface {
+	// Alter applies a schema definition
+	Alter(ctx context.Context, schema string) error
+	// Mutate commits a batch of RDF N-Quads in a single transaction and
+	// returns the UIDs assigned to its blank nodes, keyed without the "_:" prefix
+	Mutate(ctx context.Context, nquads []string) (map[string]string, error)
+	// Upsert runs query and then commits nquads, which may refer to the
+	// query's variables as uid(v), in a single transaction
+	Upsert(ctx context.Context, query string, nquads []string) error
+	// Delete runs query and then deletes nquads, which may refer to the
+	// query's variables as uid(v), in a single transaction
+	Delete(ctx context.Context, query string, nquads []string) error
+	// MutateJSON commits a JSON mutation ({"set":[...]}) read from body in
+	// a single transaction
+	MutateJSON(ctx context.Context, body io.Reader) error
+	// Query runs a read-only DQL query and returns the "data" member of
+	// the response
+	Query(ctx context.Context, query string) (json.RawMessage, error)
+	// Close releases any resources held by the transport
+	Close() error
+}
+
+// NewTransport builds the transport selected by dgraph.transport
+func NewTransport(cfg *config.Config) (Transport, error) {
+	switch cfg.Dgraph.Transport {
+	case "http":
+		return newConfiguredHTTPTransport(&cfg.Dgraph)
+	case "grpc":
+		options, err := grpcDialOptions(&cfg.Dgraph)
+		if err != nil {
+			return nil, err
+		}
+		return NewGRPCTransport(cfg.Dgraph.Alpha, cfg.Dgraph.Timeout, options...)
+	default:
+		return nil, fmt.Errorf("unknown dgraph transport: %s", cfg.Dgraph.Transport)
+	}
+}
+
+// CheckHealth runs a trivial read-only query, confirming the transport
+// reaches an Alpha that accepts its credentials
+func CheckHealth(ctx context.Context, transport Transport) error {
+	_, err := transport.Query(ctx, "{ health(func: uid(0x1)) { uid } }")
+	return err
+}
+
+// newConfiguredHTTPTransport builds the http transport with the TLS and
+// auth token settings of the dgraph section
+func newConfiguredHTTPTransport(cfg *config.DgraphConfig) (*HTTPTransport, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := cfg.HTTPAlpha
+	if tlsConfig != nil && !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	t := NewHTTPTransport(endpoint, cfg.Timeout)
+	if tlsConfig != nil {
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.TLSClientConfig = tlsConfig
+		t.client.Transport = base
+	}
+	t.authHeader = cfg.AuthHeader
+	t.authToken = cfg.AuthToken
+	return t, nil
+}
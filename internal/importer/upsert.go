@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+)
+
+// loadXIDs maps every blank node in the files to the quoted value of its
+// dgraph.upsert_predicate triple, so upsert mode can find nodes created by
+// earlier imports
+func (im *Importer) loadXIDs(files []string) error {
+	predicate := "<" + im.cfg.Dgraph.UpsertPredicate + ">"
+	im.xids = make(map[string]string)
+
+	for _, path := range files {
+		file, err := compress.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open RDF file: %w", err)
+		}
+		err = scanLines(file, func(_ int, line string) error {
+			subject, pred, object := splitNQuad(line)
+			if pred == predicate && strings.HasPrefix(subject, "_:") && strings.HasPrefix(object, `"`) {
+				im.xids[subject] = literalToken(object)
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(im.xids) == 0 {
+		im.logger.Warn("No external IDs found for upsert mode, every node will be created anew; export with output.emit_xid",
+			"predicate", im.cfg.Dgraph.UpsertPredicate)
+	} else {
+		im.logger.Info("Loaded external IDs for upsert mode", "nodes", len(im.xids))
+	}
+	return nil
+}
+
+// upsertBlock rewrites a batch into the query and N-Quads of an upsert block.
+// Every blank node with an external ID becomes uid(vN), bound to the node that
+// already carries that ID, and gets its ID set again so a node created by this
+// batch is found by the next import. Blank nodes without an ID stay blank.
+func (im *Importer) upsertBlock(nquads []string) (string, []string) {
+	predicate := "<" + im.cfg.Dgraph.UpsertPredicate + ">"
+	vars := make(map[string]string)
+	var query strings.Builder
+	var set []string
+
+	resolve := func(label string) string {
+		if v, ok := vars[label]; ok {
+			return "uid(" + v + ")"
+		}
+		xid, ok := im.xids[label]
+		if !ok {
+			return label
+		}
+		v := fmt.Sprintf("v%d", len(vars))
+		vars[label] = v
+		fmt.Fprintf(&query, "  %s as var(func: eq(%s, %s))\n", v, im.cfg.Dgraph.UpsertPredicate, xid)
+		set = append(set, fmt.Sprintf("uid(%s) %s %s .", v, predicate, xid))
+		return "uid(" + v + ")"
+	}
+
+	for _, nquad := range nquads {
+		subject, pred, object := splitNQuad(nquad)
+		switch {
+		case pred == "":
+			set = append(set, nquad)
+			continue
+		case pred == predicate && strings.HasPrefix(subject, "_:"):
+			// resolve sets the ID once per node
+			if resolved := resolve(subject); resolved == subject {
+				set = append(set, nquad)
+			}
+			continue
+		}
+
+		rest := strings.TrimPrefix(nquad, subject)
+		if strings.HasPrefix(subject, "_:") {
+			subject = resolve(subject)
+		}
+		if strings.HasPrefix(object, "_:") {
+			label := blankToken(object)
+			rest = strings.Replace(rest, label, resolve(label), 1)
+		}
+		set = append(set, subject+rest)
+	}
+
+	if query.Len() == 0 {
+		return "", set
+	}
+	return "{\n" + query.String() + "}", set
+}
+
+// splitNQuad returns the subject, the predicate and the remainder of an
+// N-Quad, starting at the object. The predicate is empty for lines it cannot
+// split.
+func splitNQuad(line string) (subject, predicate, object string) {
+	subject, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return line, "", ""
+	}
+	predicate, object, ok = strings.Cut(strings.TrimLeft(rest, " "), " ")
+	if !ok || !strings.HasPrefix(predicate, "<") {
+		return subject, "", ""
+	}
+	return subject, predicate, strings.TrimLeft(object, " ")
+}
+
+// blankToken returns the blank node label at the start of s
+func blankToken(s string) string {
+	if end := strings.IndexAny(s, " \t"); end >= 0 {
+		return s[:end]
+	}
+	return s
+}
+
+// literalToken returns the quoted literal at the start of s, without any
+// language tag, datatype or facets
+func literalToken(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,278 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestUpsertBlock(t *testing.T) {
+	im := &Importer{
+		cfg:  config.DefaultConfig(),
+		xids: map[string]string{"_:users_1": `"users:1"`, "_:orders_7": `"orders:7"`},
+	}
+	tests := []struct {
+		name  string
+		batch []string
+		query string
+		set   []string
+	}{
+		{
+			name:  "no external IDs",
+			batch: []string{`_:tags_1 <tags.name> "go" .`},
+			set:   []string{`_:tags_1 <tags.name> "go" .`},
+		},
+		{
+			name: "nodes and an edge",
+			batch: []string{
+				`_:users_1 <xid> "users:1" .`,
+				`_:users_1 <users.name> "Ada" .`,
+				`_:orders_7 <orders.user> _:users_1 (since=2020) .`,
+				`_:orders_7 <orders.note> "_:users_1" .`,
+			},
+			query: "{\n  v0 as var(func: eq(xid, \"users:1\"))\n  v1 as var(func: eq(xid, \"orders:7\"))\n}",
+			set: []string{
+				`uid(v0) <xid> "users:1" .`,
+				`uid(v0) <users.name> "Ada" .`,
+				`uid(v1) <xid> "orders:7" .`,
+				`uid(v1) <orders.user> uid(v0) (since=2020) .`,
+				`uid(v1) <orders.note> "_:users_1" .`,
+			},
+		},
+		{
+			name:  "edge to a node without an external ID",
+			batch: []string{`_:users_1 <users.tag> _:tags_1 .`},
+			query: "{\n  v0 as var(func: eq(xid, \"users:1\"))\n}",
+			set:   []string{`uid(v0) <xid> "users:1" .`, `uid(v0) <users.tag> _:tags_1 .`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, set := im.upsertBlock(tt.batch)
+			if query != tt.query {
+				t.Errorf("query:\n%s\nwant:\n%s", query, tt.query)
+			}
+			if strings.Join(set, "\n") != strings.Join(tt.set, "\n") {
+				t.Errorf("set:\n%s\nwant:\n%s", strings.Join(set, "\n"), strings.Join(tt.set, "\n"))
+			}
+		})
+	}
+}
+
+// varPattern matches a query block binding a variable to a node by ID
+var varPattern = regexp.MustCompile(`(v\d+) as var\(func: eq\(xid, ("[^"]*")\)\)`)
+
+// graphTransport is an in-memory Dgraph that runs mutations and upsert
+// blocks, indexing nodes by their xid
+type graphTransport struct {
+	fakeTransport
+	mu    sync.Mutex
+	nodes map[string]map[string]string // UID -> predicate -> object
+	byXID map[string]string
+}
+
+func newGraphTransport() *graphTransport {
+	return &graphTransport{nodes: make(map[string]map[string]string), byXID: make(map[string]string)}
+}
+
+func (g *graphTransport) Mutate(_ context.Context, nquads []string) (map[string]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.apply(nil, nquads), nil
+}
+
+func (g *graphTransport) Upsert(_ context.Context, query string, set []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	vars := make(map[string]string)
+	for _, match := range varPattern.FindAllStringSubmatch(query, -1) {
+		vars[match[1]] = g.byXID[match[2]]
+	}
+	g.apply(vars, set)
+	return nil
+}
+
+func (g *graphTransport) Delete(_ context.Context, query string, nquads []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	vars := make(map[string]string)
+	for _, match := range varPattern.FindAllStringSubmatch(query, -1) {
+		vars[match[1]] = g.byXID[match[2]]
+	}
+	for _, nquad := range nquads {
+		subject, predicate, _ := splitNQuad(nquad)
+		v := strings.TrimSuffix(strings.TrimPrefix(subject, "uid("), ")")
+		if uid := vars[v]; uid != "" {
+			delete(g.nodes[uid], predicate)
+		}
+	}
+	return nil
+}
+
+func (g *graphTransport) MutateJSON(_ context.Context, body io.Reader) error {
+	var mutation struct {
+		Query string                   `json:"query"`
+		Set   []map[string]interface{} `json:"set"`
+	}
+	if err := json.NewDecoder(body).Decode(&mutation); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	vars := make(map[string]string)
+	for _, match := range varPattern.FindAllStringSubmatch(mutation.Query, -1) {
+		vars[match[1]] = g.byXID[match[2]]
+	}
+	blanks := make(map[string]string)
+	for _, node := range mutation.Set {
+		g.applyJSON(vars, blanks, node)
+	}
+	return nil
+}
+
+// applyJSON writes a JSON mutation's node and the nodes nested in it, and
+// returns its UID
+func (g *graphTransport) applyJSON(vars, blanks map[string]string, node map[string]interface{}) string {
+	label, _ := node["uid"].(string)
+	var uid string
+	switch {
+	case strings.HasPrefix(label, "uid("):
+		v := strings.TrimSuffix(strings.TrimPrefix(label, "uid("), ")")
+		if vars[v] == "" {
+			vars[v] = g.newNode()
+		}
+		uid = vars[v]
+	case strings.HasPrefix(label, "_:"):
+		if blanks[label] == "" {
+			blanks[label] = g.newNode()
+		}
+		uid = blanks[label]
+	default:
+		uid = g.newNode()
+	}
+	for predicate, value := range node {
+		predicate = "<" + predicate + ">"
+		switch value := value.(type) {
+		case map[string]interface{}:
+			g.nodes[uid][predicate] = g.applyJSON(vars, blanks, value)
+		case string:
+			g.nodes[uid][predicate] = strconv.Quote(value)
+			if predicate == "<xid>" {
+				g.byXID[strconv.Quote(value)] = uid
+			}
+		}
+	}
+	delete(g.nodes[uid], "<uid>")
+	return uid
+}
+
+// apply writes N-Quads, creating a node for every blank node and for every
+// variable that matched none
+func (g *graphTransport) apply(vars map[string]string, nquads []string) map[string]string {
+	blanks := make(map[string]string)
+	node := func(term string) string {
+		switch {
+		case strings.HasPrefix(term, "uid("):
+			v := strings.TrimSuffix(strings.TrimPrefix(term, "uid("), ")")
+			if vars[v] == "" {
+				vars[v] = g.newNode()
+			}
+			return vars[v]
+		case strings.HasPrefix(term, "_:"):
+			if blanks[term] == "" {
+				blanks[term] = g.newNode()
+			}
+			return blanks[term]
+		}
+		return strings.Trim(term, "<>")
+	}
+	for _, nquad := range nquads {
+		subject, predicate, object := splitNQuad(nquad)
+		uid := node(subject)
+		if strings.HasPrefix(object, "_:") || strings.HasPrefix(object, "uid(") {
+			object = node(blankToken(object))
+		} else {
+			object = literalToken(object)
+		}
+		g.nodes[uid][predicate] = object
+		if predicate == "<xid>" {
+			g.byXID[object] = uid
+		}
+	}
+	assigned := make(map[string]string)
+	for label, uid := range blanks {
+		assigned[strings.TrimPrefix(label, "_:")] = uid
+	}
+	return assigned
+}
+
+func (g *graphTransport) newNode() string {
+	uid := fmt.Sprintf("0x%x", len(g.nodes)+1)
+	g.nodes[uid] = make(map[string]string)
+	return uid
+}
+
+// TestUpsertImportTwice imports the same export twice and checks upsert mode
+// updates the nodes of the first import instead of duplicating them
+func TestUpsertImportTwice(t *testing.T) {
+	lines := []string{
+		`_:users_1 <xid> "users:1" .`,
+		`_:users_1 <users.name> "Ada" .`,
+		`_:users_2 <xid> "users:2" .`,
+		`_:users_2 <users.name> "Grace" .`,
+		`_:orders_1 <xid> "orders:1" .`,
+		`_:orders_1 <orders.user> _:users_2 .`,
+	}
+	tests := []struct {
+		mode  string
+		nodes []int // Nodes after each import
+	}{
+		{mode: "set", nodes: []int{3, 6}},
+		{mode: "upsert", nodes: []int{3, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data.rdf")
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = dir
+			cfg.Dgraph.ImportFiles = []string{path}
+			cfg.Dgraph.ImportMode = tt.mode
+			// The edge and its target fall in different batches
+			cfg.Dgraph.BatchSize = 4
+			cfg.Pipeline.ProgressReportInterval = 0
+
+			graph := newGraphTransport()
+			for i, want := range tt.nodes {
+				if _, err := NewWithTransport(cfg, logger.New("error", "text"), graph).Run(context.Background(), true); err != nil {
+					t.Fatalf("import %d: %v", i+1, err)
+				}
+				if got := len(graph.nodes); got != want {
+					t.Errorf("import %d: %d nodes, want %d", i+1, got, want)
+				}
+			}
+
+			if tt.mode != "upsert" {
+				return
+			}
+			order := graph.nodes[graph.byXID[`"orders:1"`]]
+			if user := order["<orders.user>"]; user != graph.byXID[`"users:2"`] {
+				t.Errorf("orders:1 links %q, want users:2 %q", user, graph.byXID[`"users:2"`])
+			}
+		})
+	}
+}
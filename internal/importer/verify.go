@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Verification holds the node counts Dgraph reports after an import
+type Verification struct {
+	TypeCounts map[string]int64 // Nodes of each type declared in the schema file
+	Orphans    int64            // Typed nodes whose types are all missing from the schema file
+}
+
+// Verify counts the nodes of every type declared in the schema file, and the
+// typed nodes that belong to none of them, such as leftovers from an import
+// of another database
+func (im *Importer) Verify(ctx context.Context) (*Verification, error) {
+	schemaPath := im.schemaPath()
+	types, err := schemaTypes(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema types: %w", err)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("schema file %s declares no types", schemaPath)
+	}
+
+	var data json.RawMessage
+	err = im.withRetry(ctx, "query", func() error {
+		var err error
+		data, err = im.transport.Query(ctx, verifyQuery(types))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verification query failed: %w", err)
+	}
+
+	var counts map[string][]struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, fmt.Errorf("failed to decode verification result: %w", err)
+	}
+	count := func(block string) int64 {
+		if rows := counts[block]; len(rows) > 0 {
+			return rows[0].Count
+		}
+		return 0
+	}
+
+	result := &Verification{TypeCounts: make(map[string]int64, len(types))}
+	for i, typeName := range types {
+		result.TypeCounts[typeName] = count(fmt.Sprintf("t%d", i))
+		im.logger.Info("Verified type", "type", typeName, "nodes", result.TypeCounts[typeName])
+	}
+	result.Orphans = count("orphans")
+	if result.Orphans > 0 {
+		im.logger.Warn("Nodes with types missing from the schema file", "nodes", result.Orphans)
+	}
+	return result, nil
+}
+
+// verifyQuery builds one query counting the nodes of each type, as blocks
+// t0..tN in the order of types, and the typed nodes of none of them as
+// block orphans
+func verifyQuery(types []string) string {
+	var query strings.Builder
+	query.WriteString("{\n")
+	filters := make([]string, len(types))
+	for i, typeName := range types {
+		fmt.Fprintf(&query, "  t%d(func: type(%s)) { count(uid) }\n", i, typeName)
+		filters[i] = fmt.Sprintf("NOT type(%s)", typeName)
+	}
+	fmt.Fprintf(&query, "  orphans(func: has(dgraph.type)) @filter(%s) { count(uid) }\n", strings.Join(filters, " AND "))
+	query.WriteString("}")
+	return query.String()
+}
+
+// schemaTypes returns the names of the types declared in a schema file,
+// sorted
+func schemaTypes(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "type ")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, "{")
+		if name = strings.Trim(strings.TrimSpace(name), "<>"); name != "" {
+			types = append(types, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(types)
+	return types, nil
+}
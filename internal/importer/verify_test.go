@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// customSchema declares types unlike any fixed list
+const customSchema = `invoice.id: int @index(int) @upsert .
+invoice.total: float .
+line_item.invoice: uid @reverse .
+
+type invoice {
+  invoice.id
+  invoice.total
+}
+type <line_item> {
+  line_item.invoice
+}
+type warehouse{
+}
+`
+
+func TestSchemaTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.dql")
+	if err := os.WriteFile(path, []byte(customSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	types, err := schemaTypes(path)
+	if err != nil {
+		t.Fatalf("schemaTypes: %v", err)
+	}
+	if want := []string{"invoice", "line_item", "warehouse"}; !slices.Equal(types, want) {
+		t.Errorf("schemaTypes = %v, want %v", types, want)
+	}
+	if _, err := schemaTypes(filepath.Join(t.TempDir(), "missing.dql")); err == nil {
+		t.Error("schemaTypes of a missing file succeeded")
+	}
+}
+
+var (
+	typeBlockPattern  = regexp.MustCompile(`t\d+\(func: type\((\w+)\)\)`)
+	notTypePattern    = regexp.MustCompile(`NOT type\((\w+)\)`)
+	orphanBlockFilter = regexp.MustCompile(`orphans\(func: has\(dgraph.type\)\) @filter\(([^\n]*)\)`)
+)
+
+func TestVerifyQuery(t *testing.T) {
+	tests := [][]string{
+		{"invoice"},
+		{"invoice", "line_item", "warehouse"},
+	}
+	for _, types := range tests {
+		query := verifyQuery(types)
+		var counted, excluded []string
+		for _, match := range typeBlockPattern.FindAllStringSubmatch(query, -1) {
+			counted = append(counted, match[1])
+		}
+		filter := orphanBlockFilter.FindStringSubmatch(query)
+		if filter == nil {
+			t.Fatalf("no orphans block in\n%s", query)
+		}
+		for _, match := range notTypePattern.FindAllStringSubmatch(filter[1], -1) {
+			excluded = append(excluded, match[1])
+		}
+		if !slices.Equal(counted, types) || !slices.Equal(excluded, types) {
+			t.Errorf("query counts %v and excludes %v, want %v:\n%s", counted, excluded, types, query)
+		}
+	}
+}
+
+// queryTransport answers every query with response
+type queryTransport struct {
+	fakeTransport
+	response string
+	queries  []string
+}
+
+func (q *queryTransport) Query(_ context.Context, query string) (json.RawMessage, error) {
+	q.queries = append(q.queries, query)
+	return json.RawMessage(q.response), nil
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		response string
+		want     *Verification
+		errText  string
+	}{
+		{
+			name:     "counts",
+			schema:   customSchema,
+			response: `{"t0": [{"count": 12}], "t1": [{"count": 40}], "t2": [], "orphans": [{"count": 3}]}`,
+			want: &Verification{
+				TypeCounts: map[string]int64{"invoice": 12, "line_item": 40, "warehouse": 0},
+				Orphans:    3,
+			},
+		},
+		{name: "no types", schema: "invoice.id: int .\n", errText: "declares no types"},
+		{name: "malformed response", schema: customSchema, response: `[]`, errText: "failed to decode verification result"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Output.Directory = t.TempDir()
+			if err := os.WriteFile(filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile), []byte(tt.schema), 0644); err != nil {
+				t.Fatal(err)
+			}
+			transport := &queryTransport{response: tt.response}
+			got, err := NewWithTransport(cfg, logger.New("error", "text"), transport).Verify(context.Background())
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("Verify error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify = %+v, want %+v", got, tt.want)
+			}
+			if len(transport.queries) != 1 || transport.queries[0] != verifyQuery([]string{"invoice", "line_item", "warehouse"}) {
+				t.Errorf("queries %q", transport.queries)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// largestTablesShown is how many tables the analysis lists by row count
+const largestTablesShown = 10
+
+// TableProfile describes one table in an analysis report
+type TableProfile struct {
+	Table            string   `json:"table"`
+	Rows             int64    `json:"rows"`
+	Columns          int      `json:"columns"`
+	PrimaryKey       []string `json:"primary_key,omitempty"`
+	ForeignKeys      int      `json:"foreign_keys"` // Outgoing relationships, declared or inferred
+	EstimatedTriples int64    `json:"estimated_triples"`
+	EstimatedBytes   int64    `json:"estimated_bytes"`
+}
+
+// AnalysisReport profiles the database before a migration. It is built from
+// the schema and row counts only; no rows are exported.
+type AnalysisReport struct {
+	Tables               []TableProfile `json:"tables"`
+	TotalRows            int64          `json:"total_rows"`
+	TotalTriples         int64          `json:"total_estimated_triples"`
+	TotalBytes           int64          `json:"total_estimated_bytes"`
+	DeclaredForeignKeys  []ForeignKey   `json:"declared_foreign_keys"`
+	InferredForeignKeys  []ForeignKey   `json:"inferred_foreign_keys"` // Found by naming convention or data sampling
+	TablesWithoutPrimary []string       `json:"tables_without_primary_key"`
+	LargestTables        []string       `json:"largest_tables"` // By row count, largest first
+	JunctionTables       []string       `json:"junction_tables,omitempty"`
+}
+
+// BuildAnalysis profiles tables using the extracted schema and the row count
+// and size estimates of a dry run
+func BuildAnalysis(plan *MigrationPlan, schema *Schema, tables []string) *AnalysisReport {
+	report := &AnalysisReport{
+		TotalRows:    plan.TotalRows,
+		TotalTriples: plan.TotalTriples,
+		TotalBytes:   plan.TotalBytes,
+	}
+
+	// Convention detection also finds declared keys; those count as declared
+	declared := make(map[string]bool)
+	for _, fk := range plan.Relationships {
+		if fk.Inferred == "" {
+			declared[fk.TableName+"."+fk.ColumnName] = true
+		}
+	}
+
+	outgoing := make(map[string]int)
+	for _, fk := range plan.Relationships {
+		if fk.Inferred != "" && declared[fk.TableName+"."+fk.ColumnName] {
+			continue
+		}
+		outgoing[fk.TableName]++
+		if fk.Inferred == "" {
+			report.DeclaredForeignKeys = append(report.DeclaredForeignKeys, fk)
+		} else {
+			report.InferredForeignKeys = append(report.InferredForeignKeys, fk)
+		}
+	}
+
+	estimates := make(map[string]TablePlan, len(plan.Tables))
+	for _, tp := range plan.Tables {
+		estimates[tp.Table] = tp
+	}
+
+	for _, tableName := range tables {
+		table := schema.Tables[tableName]
+		if table == nil {
+			continue
+		}
+		report.Tables = append(report.Tables, TableProfile{
+			Table:            tableName,
+			Rows:             table.RowCount,
+			Columns:          len(table.Columns),
+			PrimaryKey:       table.PrimaryKeys,
+			ForeignKeys:      outgoing[tableName],
+			EstimatedTriples: estimates[tableName].Triples,
+			EstimatedBytes:   estimates[tableName].Bytes,
+		})
+		if len(table.PrimaryKeys) == 0 {
+			report.TablesWithoutPrimary = append(report.TablesWithoutPrimary, tableName)
+		}
+		if table.Junction != nil {
+			report.JunctionTables = append(report.JunctionTables, tableName)
+		}
+	}
+
+	bySize := make([]TableProfile, len(report.Tables))
+	copy(bySize, report.Tables)
+	sort.SliceStable(bySize, func(i, j int) bool {
+		return bySize[i].Rows > bySize[j].Rows
+	})
+	for i := 0; i < len(bySize) && i < largestTablesShown; i++ {
+		report.LargestTables = append(report.LargestTables, bySize[i].Table)
+	}
+
+	return report
+}
+
+// WriteText writes the report as a table followed by the notable findings
+func (r *AnalysisReport) WriteText(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tROWS\tCOLUMNS\tFKS\tEST. TRIPLES\tEST. SIZE")
+	for _, tp := range r.Tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n",
+			tp.Table, tp.Rows, tp.Columns, tp.ForeignKeys, tp.EstimatedTriples, formatBytes(tp.EstimatedBytes))
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t\t%d\t%d\t%s\n",
+		r.TotalRows, len(r.DeclaredForeignKeys)+len(r.InferredForeignKeys), r.TotalTriples, formatBytes(r.TotalBytes))
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nForeign keys: %d declared, %d inferred\n", len(r.DeclaredForeignKeys), len(r.InferredForeignKeys))
+	for _, fk := range r.InferredForeignKeys {
+		fmt.Fprintf(w, "  %s.%s -> %s.%s (%s)\n", fk.TableName, fk.ColumnName, fk.RefTableName, fk.RefColumnName, fk.Inferred)
+	}
+	if len(r.TablesWithoutPrimary) > 0 {
+		fmt.Fprintf(w, "Tables without a primary key (%d): %s\n",
+			len(r.TablesWithoutPrimary), strings.Join(r.TablesWithoutPrimary, ", "))
+	}
+	if len(r.JunctionTables) > 0 {
+		fmt.Fprintf(w, "Junction tables (%d): %s\n", len(r.JunctionTables), strings.Join(r.JunctionTables, ", "))
+	}
+	if len(r.LargestTables) > 0 {
+		fmt.Fprintf(w, "Largest tables: %s\n", strings.Join(r.LargestTables, ", "))
+	}
+}
+
+// Analyze profiles the selected tables without exporting anything and
+// writes the report as JSON to output.analysis_file
+func (p *Pipeline) Analyze(tables string) (*AnalysisReport, error) {
+	schema, err := p.loadSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract schema: %w", err)
+	}
+	tablesToProcess := p.determineTablesToProcess(schema, tables)
+
+	report := BuildAnalysis(BuildPlan(p.cfg, schema, tablesToProcess), schema, tablesToProcess)
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	if err := os.MkdirAll(p.cfg.Output.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	reportPath := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.AnalysisFile)
+	if err := os.WriteFile(reportPath, encoded, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write analysis: %w", err)
+	}
+
+	p.logger.Info("Analysis written",
+		"file", reportPath,
+		"tables", len(report.Tables),
+		"rows", report.TotalRows,
+		"estimated_triples", report.TotalTriples,
+		"declared_foreign_keys", len(report.DeclaredForeignKeys),
+		"inferred_foreign_keys", len(report.InferredForeignKeys),
+		"tables_without_primary_key", len(report.TablesWithoutPrimary))
+	return report, nil
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildAnalysis(t *testing.T) {
+	declared := ForeignKey{TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id"}
+	inferred := ForeignKey{TableName: "orders", ColumnName: "shop_id", RefTableName: "shops", RefColumnName: "id", Inferred: "convention"}
+	redundant := ForeignKey{TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id", Inferred: "convention"}
+	schema := &Schema{Tables: map[string]*Table{
+		"users":  {Name: "users", Columns: map[string]*Column{"id": {}, "name": {}}, PrimaryKeys: []string{"id"}, RowCount: 20},
+		"orders": {Name: "orders", Columns: map[string]*Column{"id": {}, "user_id": {}, "shop_id": {}}, PrimaryKeys: []string{"id"}, RowCount: 50},
+		"shops":  {Name: "shops", Columns: map[string]*Column{"id": {}}, PrimaryKeys: []string{"id"}, RowCount: 5},
+		"logs":   {Name: "logs", Columns: map[string]*Column{"line": {}}, RowCount: 50},
+		"user_shops": {Name: "user_shops", Columns: map[string]*Column{"user_id": {}, "shop_id": {}},
+			PrimaryKeys: []string{"user_id", "shop_id"}, Junction: &Junction{}},
+	}}
+	plan := &MigrationPlan{
+		Tables:        []TablePlan{{Table: "users", Triples: 60, Bytes: 3000}, {Table: "orders", Triples: 250, Bytes: 9000}},
+		Relationships: []ForeignKey{redundant, declared, inferred},
+		TotalRows:     125,
+		TotalTriples:  310,
+		TotalBytes:    12000,
+	}
+
+	tests := []struct {
+		name    string
+		tables  []string
+		profile map[string]TableProfile
+		want    AnalysisReport // Without Tables, checked through profile
+	}{
+		{
+			name:   "all tables",
+			tables: []string{"logs", "orders", "shops", "user_shops", "users"},
+			profile: map[string]TableProfile{
+				"orders": {Table: "orders", Rows: 50, Columns: 3, PrimaryKey: []string{"id"}, ForeignKeys: 2, EstimatedTriples: 250, EstimatedBytes: 9000},
+				"users":  {Table: "users", Rows: 20, Columns: 2, PrimaryKey: []string{"id"}, EstimatedTriples: 60, EstimatedBytes: 3000},
+				"logs":   {Table: "logs", Rows: 50, Columns: 1},
+			},
+			want: AnalysisReport{
+				TotalRows:            125,
+				TotalTriples:         310,
+				TotalBytes:           12000,
+				DeclaredForeignKeys:  []ForeignKey{declared},
+				InferredForeignKeys:  []ForeignKey{inferred},
+				TablesWithoutPrimary: []string{"logs"},
+				LargestTables:        []string{"logs", "orders", "users", "shops", "user_shops"},
+				JunctionTables:       []string{"user_shops"},
+			},
+		},
+		{
+			name:   "unknown table skipped",
+			tables: []string{"users", "missing"},
+			want: AnalysisReport{
+				TotalRows:           125,
+				TotalTriples:        310,
+				TotalBytes:          12000,
+				DeclaredForeignKeys: []ForeignKey{declared},
+				InferredForeignKeys: []ForeignKey{inferred},
+				LargestTables:       []string{"users"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := BuildAnalysis(plan, schema, tt.tables)
+			var names []string
+			for _, tp := range report.Tables {
+				names = append(names, tp.Table)
+				if want, ok := tt.profile[tp.Table]; ok && !reflect.DeepEqual(tp, want) {
+					t.Errorf("profile %+v, want %+v", tp, want)
+				}
+			}
+			if want := tt.want.LargestTables; len(names) != len(want) {
+				t.Errorf("profiled %v, want %d tables", names, len(want))
+			}
+			report.Tables = nil
+			if !reflect.DeepEqual(*report, tt.want) {
+				t.Errorf("report %+v, want %+v", *report, tt.want)
+			}
+		})
+	}
+}
+
+// TestAnalyze runs analyze mode and checks the report covers every table
+// while nothing is exported
+func TestAnalyze(t *testing.T) {
+	info := shopSchema()
+	info.columns["logs"] = []fakeColumn{{name: "line", dataType: "text", columnType: "text"}}
+	info.rows["logs"] = &fakeTable{columns: []string{"line"}, rows: [][]driver.Value{{"a"}, {"b"}, {"c"}, {"d"}}}
+
+	cfg := testConfig(t)
+	result := runPipeline(t, cfg, info, ModeAnalyze, RunOptions{})
+	report := result.Analysis
+	if report == nil {
+		t.Fatal("no analysis in the result")
+	}
+
+	rows := make(map[string]int64)
+	for _, tp := range report.Tables {
+		rows[tp.Table] = tp.Rows
+	}
+	if want := map[string]int64{"logs": 4, "orders": 3, "users": 2}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("table rows %v, want %v", rows, want)
+	}
+	if report.TotalRows != 9 || report.TotalTriples == 0 {
+		t.Errorf("totals: %d rows, %d triples", report.TotalRows, report.TotalTriples)
+	}
+	if len(report.DeclaredForeignKeys) != 1 || report.DeclaredForeignKeys[0].ConstraintName != "orders_user" {
+		t.Errorf("declared foreign keys %+v", report.DeclaredForeignKeys)
+	}
+	if !reflect.DeepEqual(report.TablesWithoutPrimary, []string{"logs"}) {
+		t.Errorf("tables without a primary key %v", report.TablesWithoutPrimary)
+	}
+	if !reflect.DeepEqual(report.LargestTables, []string{"logs", "orders", "users"}) {
+		t.Errorf("largest tables %v", report.LargestTables)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, cfg.Output.AnalysisFile))
+	if err != nil {
+		t.Fatalf("no analysis file: %v", err)
+	}
+	var written AnalysisReport
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Tables) != 3 {
+		t.Errorf("analysis file lists %d tables, want 3", len(written.Tables))
+	}
+	entries, err := os.ReadDir(cfg.Output.Directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("analyze wrote %d files, want only the analysis", len(entries))
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	for _, want := range []string{"logs", "orders", "users", "TOTAL", "1 declared, 0 inferred", "without a primary key (1): logs"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report lacks %q:\n%s", want, text.String())
+		}
+	}
+}
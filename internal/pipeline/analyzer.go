@@ -0,0 +1,385 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// DataAnalyzer discovers relationships by checking whether sampled column
+// values exist as primary keys in candidate target tables
+type DataAnalyzer struct {
+	db      *sql.DB
+	cfg     *config.Config
+	logger  *logger.Logger
+	limiter *QueryLimiter
+}
+
+// DataRelationship is a relationship inferred from data together with its evidence
+type DataRelationship struct {
+	ForeignKey
+	SampledValues int     // Distinct non-NULL values sampled from the source column
+	MatchedValues int     // Sampled values found in the target primary key
+	Confidence    float64 // MatchedValues / SampledValues
+}
+
+// analysisCandidate is a source column and the target tables it may reference
+type analysisCandidate struct {
+	table      string
+	column     string
+	targets    []string
+	convention string      // Target of the key detected by naming convention, which sampling may replace
+	known      *ForeignKey // Existing key on the column, set when discovering
+}
+
+func NewDataAnalyzer(db *sql.DB, cfg *config.Config, logger *logger.Logger, limiter *QueryLimiter) *DataAnalyzer {
+	return &DataAnalyzer{
+		db:      db,
+		cfg:     cfg,
+		logger:  logger,
+		limiter: limiter,
+	}
+}
+
+// AnalyzeDataRelationships evaluates FK-like columns that have no known
+// relationship. Candidates are evaluated concurrently by pipeline.workers
+// goroutines, each sampling at most pipeline.analysis_sample_size distinct
+// values. When pipeline.analysis_time_budget expires the relationships found
+// so far are returned without error.
+func (da *DataAnalyzer) AnalyzeDataRelationships(ctx context.Context, schema *Schema) ([]DataRelationship, error) {
+	candidates := da.findCandidates(schema, nil)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	if budget := da.cfg.Pipeline.AnalysisTimeBudget; budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	da.logger.Info("Analyzing data relationships",
+		"candidates", len(candidates),
+		"sample_size", da.cfg.Pipeline.AnalysisSampleSize,
+		"time_budget", da.cfg.Pipeline.AnalysisTimeBudget)
+
+	var (
+		mu      sync.Mutex
+		results []DataRelationship
+	)
+	evaluated := da.forEachCandidate(ctx, candidates, func(candidate analysisCandidate) {
+		rel, found := da.evaluateCandidate(ctx, schema, candidate)
+		if !found {
+			return
+		}
+		mu.Lock()
+		results = append(results, rel)
+		mu.Unlock()
+	})
+
+	if ctx.Err() != nil {
+		da.logger.Warn("Data relationship analysis stopped early, returning partial results",
+			"evaluated", evaluated,
+			"candidates", len(candidates),
+			"found", len(results))
+	}
+
+	// Workers finish in any order, so sort for stable output
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].TableName != results[j].TableName {
+			return results[i].TableName < results[j].TableName
+		}
+		return results[i].ColumnName < results[j].ColumnName
+	})
+
+	da.logger.Info("Data relationship analysis completed", "relationships", len(results))
+	return results, nil
+}
+
+// forEachCandidate runs fn for the candidates on pipeline.workers goroutines
+// until ctx ends, and returns how many candidates were handed out
+func (da *DataAnalyzer) forEachCandidate(ctx context.Context, candidates []analysisCandidate, fn func(analysisCandidate)) int {
+	jobChan := make(chan analysisCandidate)
+	var wg sync.WaitGroup
+	for i := 0; i < da.cfg.Pipeline.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for candidate := range jobChan {
+				fn(candidate)
+			}
+		}()
+	}
+
+	submitted := 0
+submit:
+	for _, candidate := range candidates {
+		select {
+		case jobChan <- candidate:
+			submitted++
+		case <-ctx.Done():
+			break submit
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+	return submitted
+}
+
+// findCandidates lists FK-named columns without a known relationship, paired
+// with every single-PK table whose key type matches the column type. With
+// pipeline.relationship_override_confidence set, columns whose key was only
+// detected by naming convention are candidates too. When discovering, every
+// FK-named or related column of the source tables is a candidate, carrying
+// its existing key. Tables estimated above pipeline.relationship_max_table_rows
+// are left out.
+func (da *DataAnalyzer) findCandidates(schema *Schema, discover map[string]bool) []analysisCandidate {
+	known := make(map[string]*ForeignKey)
+	conventions := make(map[string]string)
+	for i, fk := range schema.Relationships {
+		key := fk.TableName + "." + fk.ColumnName
+		if fk.Inferred == "convention" && (discover != nil || da.cfg.Pipeline.RelationshipOverrideConfidence > 0) {
+			conventions[key] = fk.RefTableName
+		}
+		known[key] = &schema.Relationships[i]
+	}
+
+	var tableNames []string
+	for tableName := range schema.Tables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	var candidates []analysisCandidate
+	for _, tableName := range tableNames {
+		table := schema.Tables[tableName]
+
+		var columnNames []string
+		for columnName := range table.Columns {
+			columnNames = append(columnNames, columnName)
+		}
+		sort.Strings(columnNames)
+
+		if discover != nil && !discover[tableName] {
+			continue
+		}
+		if limit := da.cfg.Pipeline.RelationshipMaxTableRows; limit > 0 && table.RowCount > limit {
+			da.logger.Info("Skipping relationship analysis for large table",
+				"table", tableName,
+				"estimated_rows", table.RowCount,
+				"max_rows", limit)
+			continue
+		}
+
+		for _, columnName := range columnNames {
+			key := tableName + "." + columnName
+			switch {
+			case discover != nil:
+				if !IsForeignKey(columnName) && known[key] == nil {
+					continue
+				}
+			case !IsForeignKey(columnName):
+				continue
+			case known[key] != nil && conventions[key] == "":
+				continue
+			}
+			if da.cfg.Output.IsBooleanColumn(tableName, columnName) {
+				continue
+			}
+
+			columnType := MySQLToDgraphType(table.Columns[columnName].FullType())
+			var targets []string
+			for _, targetName := range tableNames {
+				target := schema.Tables[targetName]
+				if len(target.PrimaryKeys) != 1 {
+					continue
+				}
+				pkColumn := target.Columns[target.PrimaryKeys[0]]
+				if pkColumn == nil || MySQLToDgraphType(pkColumn.FullType()) != columnType {
+					continue
+				}
+				targets = append(targets, targetName)
+			}
+
+			if len(targets) > 0 {
+				candidates = append(candidates, analysisCandidate{
+					table:      tableName,
+					column:     columnName,
+					targets:    targets,
+					convention: conventions[key],
+				})
+				if discover != nil {
+					candidates[len(candidates)-1].known = known[key]
+				}
+			}
+		}
+	}
+
+	return candidates
+}
+
+// evaluateCandidate samples the source column once and returns the target with
+// the highest match rate, provided it reaches pipeline.relationship_confidence,
+// or for a convention key pipeline.relationship_override_confidence and a
+// different target
+func (da *DataAnalyzer) evaluateCandidate(ctx context.Context, schema *Schema, candidate analysisCandidate) (DataRelationship, bool) {
+	best, _, ok := da.scoreCandidate(ctx, schema, candidate)
+	if !ok || best.MatchedValues == 0 || best.Confidence < da.cfg.Pipeline.RelationshipConfidence {
+		return DataRelationship{}, false
+	}
+	if candidate.convention != "" {
+		if best.RefTableName == candidate.convention || best.Confidence < da.cfg.Pipeline.RelationshipOverrideConfidence {
+			return DataRelationship{}, false
+		}
+		da.logger.Info("Replacing foreign key detected by convention",
+			"table", best.TableName,
+			"column", best.ColumnName,
+			"convention", candidate.convention,
+			"data", best.RefTableName,
+			"confidence", fmt.Sprintf("%.2f", best.Confidence))
+	}
+
+	da.logger.Info("Detected foreign key from data",
+		"table", best.TableName,
+		"column", best.ColumnName,
+		"references", fmt.Sprintf("%s.%s", best.RefTableName, best.RefColumnName),
+		"confidence", fmt.Sprintf("%.2f", best.Confidence))
+	return best, true
+}
+
+// sampleValues returns up to analysis_sample_size distinct non-NULL values,
+// taken from the first relationship_sample_size rows when that is set
+func (da *DataAnalyzer) sampleValues(ctx context.Context, tableName, columnName string) ([]string, error) {
+	column := quoteIdent(columnName)
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL LIMIT %d",
+		column, quoteTable(tableName), column, da.cfg.Pipeline.AnalysisSampleSize)
+	if rows := da.cfg.Pipeline.RelationshipSampleSize; rows > 0 {
+		query = fmt.Sprintf("SELECT DISTINCT %s FROM (SELECT %s FROM %s WHERE %s IS NOT NULL LIMIT %d) AS sampled LIMIT %d",
+			column, column, quoteTable(tableName), column, rows, da.cfg.Pipeline.AnalysisSampleSize)
+	}
+
+	if err := da.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer da.limiter.Release()
+
+	rows, err := da.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// scoreCandidate samples the source column once and returns the target with
+// the highest match rate, together with the sampled values and which of them
+// that target holds. ok is false when nothing could be sampled or matched.
+func (da *DataAnalyzer) scoreCandidate(ctx context.Context, schema *Schema, candidate analysisCandidate) (best DataRelationship, sample valueSample, ok bool) {
+	values, err := da.sampleValues(ctx, candidate.table, candidate.column)
+	if err != nil {
+		if ctx.Err() == nil {
+			da.logger.Warn("Failed to sample column values",
+				"table", candidate.table,
+				"column", candidate.column,
+				"error", err)
+		}
+		return best, sample, false
+	}
+	if len(values) == 0 {
+		return best, sample, false
+	}
+	sample.values = values
+
+	for _, targetName := range candidate.targets {
+		pk := schema.Tables[targetName].PrimaryKeys[0]
+
+		matched, err := da.matchingValues(ctx, targetName, pk, values)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			da.logger.Debug("Failed to match sampled values",
+				"table", candidate.table,
+				"column", candidate.column,
+				"target", targetName,
+				"error", err)
+			continue
+		}
+
+		confidence := float64(len(matched)) / float64(len(values))
+		if !ok || confidence > best.Confidence {
+			ok = true
+			sample.matched = matched
+			best = DataRelationship{
+				ForeignKey: ForeignKey{
+					ConstraintName: fmt.Sprintf("fk_%s_%s", candidate.table, candidate.column),
+					TableName:      candidate.table,
+					ColumnName:     candidate.column,
+					RefTableName:   targetName,
+					RefColumnName:  pk,
+					Inferred:       "data",
+				},
+				SampledValues: len(values),
+				MatchedValues: len(matched),
+				Confidence:    confidence,
+			}
+		}
+	}
+	return best, sample, ok
+}
+
+// valueSample holds the values sampled from a source column and those found
+// in the best target
+type valueSample struct {
+	values  []string
+	matched []string
+}
+
+// matchingValues returns the values that exist in the target column
+func (da *DataAnalyzer) matchingValues(ctx context.Context, tableName, columnName string, values []string) ([]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	column := quoteIdent(columnName)
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IN (%s)",
+		column, quoteTable(tableName), column, placeholders)
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+
+	if err := da.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer da.limiter.Release()
+
+	rows, err := da.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matched []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		matched = append(matched, value)
+	}
+	return matched, rows.Err()
+}
@@ -0,0 +1,346 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+var (
+	distinctPattern = regexp.MustCompile("^SELECT DISTINCT `([^`]+)` FROM ")
+	rowLimitPattern = regexp.MustCompile(`IS NOT NULL LIMIT (\d+)\) AS sampled`)
+	lastLimit       = regexp.MustCompile(`LIMIT (\d+)$`)
+)
+
+// analysisHandler answers the analyzer's sampling and matching queries from
+// tables, waiting delay before each answer. It records the most values any
+// sampling query returned.
+type analysisHandler struct {
+	tables map[string]*fakeTable
+	delay  time.Duration
+
+	mu         sync.Mutex
+	samples    int
+	maxSampled int
+}
+
+func (h *analysisHandler) serve(query string, args []driver.NamedValue) (*fakeResult, error) {
+	time.Sleep(h.delay)
+	column, from := distinctPattern.FindStringSubmatch(query), fromPattern.FindStringSubmatch(query)
+	if column == nil || from == nil || h.tables[from[1]] == nil {
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	table := h.tables[from[1]]
+	index := slices.Index(table.columns, column[1])
+
+	rows := table.rows
+	if match := rowLimitPattern.FindStringSubmatch(query); match != nil {
+		limit, _ := strconv.Atoi(match[1])
+		rows = rows[:min(limit, len(rows))]
+	}
+	var wanted []string
+	for _, arg := range args {
+		wanted = append(wanted, fmt.Sprint(arg.Value))
+	}
+
+	result := &fakeResult{columns: []string{column[1]}}
+	var seen []string
+	for _, row := range rows {
+		value := fmt.Sprint(row[index])
+		if row[index] == nil || slices.Contains(seen, value) {
+			continue
+		}
+		if strings.Contains(query, " IN (") && !slices.Contains(wanted, value) {
+			continue
+		}
+		seen = append(seen, value)
+		result.rows = append(result.rows, []driver.Value{value})
+	}
+
+	if match := lastLimit.FindStringSubmatch(query); match != nil {
+		limit, _ := strconv.Atoi(match[1])
+		result.rows = result.rows[:min(limit, len(result.rows))]
+		h.mu.Lock()
+		h.samples++
+		h.maxSampled = max(h.maxSampled, len(result.rows))
+		h.mu.Unlock()
+	}
+	return result, nil
+}
+
+// idTable serves the single id column with ids from 1 to n
+func idTable(n int) *fakeTable {
+	table := &fakeTable{columns: []string{"id"}}
+	for i := 1; i <= n; i++ {
+		table.rows = append(table.rows, []driver.Value{int64(i)})
+	}
+	return table
+}
+
+// refTable serves id and column, where row i references values[i]
+func refTable(column string, values ...interface{}) *fakeTable {
+	table := &fakeTable{columns: []string{"id", column}}
+	for i, value := range values {
+		table.rows = append(table.rows, []driver.Value{int64(i + 1), value})
+	}
+	return table
+}
+
+func TestAnalyzeDataRelationships(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleSize int
+		rowSample  int
+		orders     *fakeTable
+		want       []string // table.column -> target (sampled/matched)
+		maxSampled int
+	}{
+		{
+			name:       "every value found",
+			sampleSize: 100,
+			orders:     refTable("buyer_id", int64(1), int64(2), int64(3), nil),
+			want:       []string{"orders.buyer_id -> customers (3/3)"},
+			maxSampled: 3,
+		},
+		{
+			name:       "sample size bounds the distinct values read",
+			sampleSize: 4,
+			orders:     refTable("buyer_id", int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7), int64(8)),
+			want:       []string{"orders.buyer_id -> customers (4/4)"},
+			maxSampled: 4,
+		},
+		{
+			name:       "row sample bounds the rows read",
+			sampleSize: 100,
+			rowSample:  2,
+			orders:     refTable("buyer_id", int64(1), int64(1), int64(2), int64(3)),
+			want:       []string{"orders.buyer_id -> customers (1/1)"},
+			maxSampled: 1,
+		},
+		{
+			name:       "below relationship_confidence",
+			sampleSize: 100,
+			orders:     refTable("buyer_id", int64(1), int64(20), int64(30)),
+			maxSampled: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.Workers = 4
+			cfg.Pipeline.AnalysisSampleSize = tt.sampleSize
+			cfg.Pipeline.RelationshipSampleSize = tt.rowSample
+			handler := &analysisHandler{tables: map[string]*fakeTable{"customers": idTable(10), "orders": tt.orders}}
+			db, fake := newFakeDB(t, handler.serve)
+			schema := fkSchema(map[string][]string{"customers": nil, "orders": {"buyer_id"}}, nil)
+
+			analyzer := NewDataAnalyzer(db, cfg, logger.New("error", "text"), nil)
+			found, err := analyzer.AnalyzeDataRelationships(context.Background(), schema)
+			if err != nil {
+				t.Fatalf("AnalyzeDataRelationships: %v", err)
+			}
+			var got []string
+			for _, rel := range found {
+				got = append(got, fmt.Sprintf("%s.%s -> %s (%d/%d)", rel.TableName, rel.ColumnName, rel.RefTableName, rel.MatchedValues, rel.SampledValues))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("found %q, want %q", got, tt.want)
+			}
+			if handler.maxSampled != tt.maxSampled {
+				t.Errorf("a sample returned %d values, want at most %d", handler.maxSampled, tt.maxSampled)
+			}
+			for _, query := range fake.Queries() {
+				if strings.HasPrefix(query, "SELECT DISTINCT `buyer_id`") && !strings.HasSuffix(query, fmt.Sprintf("LIMIT %d", tt.sampleSize)) {
+					t.Errorf("sampling query not limited to %d values: %s", tt.sampleSize, query)
+				}
+			}
+		})
+	}
+}
+
+// TestRelationshipMaxTableRows checks tables estimated above
+// pipeline.relationship_max_table_rows are not sampled at all
+func TestRelationshipMaxTableRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxRows int64
+		want    []string
+		queried bool
+	}{
+		{name: "no limit", want: []string{"orders.buyer_id -> customers"}, queried: true},
+		{name: "at the limit", maxRows: 5000000, want: []string{"orders.buyer_id -> customers"}, queried: true},
+		{name: "above the limit", maxRows: 4999999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.RelationshipMaxTableRows = tt.maxRows
+			handler := &analysisHandler{tables: map[string]*fakeTable{
+				"customers": idTable(10),
+				"orders":    refTable("buyer_id", int64(1), int64(2)),
+			}}
+			db, fake := newFakeDB(t, handler.serve)
+			schema := fkSchema(map[string][]string{"customers": nil, "orders": {"buyer_id"}}, nil)
+			schema.Tables["orders"].RowCount = 5000000
+
+			found, err := NewDataAnalyzer(db, cfg, logger.New("error", "text"), nil).AnalyzeDataRelationships(context.Background(), schema)
+			if err != nil {
+				t.Fatalf("AnalyzeDataRelationships: %v", err)
+			}
+			var got []string
+			for _, rel := range found {
+				got = append(got, fmt.Sprintf("%s.%s -> %s", rel.TableName, rel.ColumnName, rel.RefTableName))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("found %q, want %q", got, tt.want)
+			}
+			if queried := len(fake.Queries()) > 0; queried != tt.queried {
+				t.Errorf("orders queried: %v, want %v (%q)", queried, tt.queried, fake.Queries())
+			}
+		})
+	}
+}
+
+// TestRelationshipConfidence checks a sampled relationship, or one replacing
+// a convention key, is applied at its threshold and not just below it
+func TestRelationshipConfidence(t *testing.T) {
+	clients := &fakeTable{columns: []string{"id"}}
+	for id := 100; id < 110; id++ {
+		clients.rows = append(clients.rows, []driver.Value{int64(id)})
+	}
+	tests := []struct {
+		name       string
+		confidence float64
+		override   float64
+		convention bool // orders.buyer_id -> customers was detected by naming convention
+		buyers     []interface{}
+		want       []string
+	}{
+		{
+			name:       "at relationship_confidence",
+			confidence: 0.75,
+			buyers:     []interface{}{int64(1), int64(2), int64(3), int64(50)},
+			want:       []string{"orders.buyer_id -> customers (3/4)"},
+		},
+		{
+			name:       "just below relationship_confidence",
+			confidence: 0.76,
+			buyers:     []interface{}{int64(1), int64(2), int64(3), int64(50)},
+		},
+		{
+			name:       "convention key kept without an override confidence",
+			confidence: 0.5,
+			convention: true,
+			buyers:     []interface{}{int64(100), int64(101), int64(102), int64(103)},
+		},
+		{
+			name:       "convention key replaced",
+			confidence: 0.5,
+			override:   0.75,
+			convention: true,
+			buyers:     []interface{}{int64(100), int64(101), int64(102), int64(1)},
+			want:       []string{"orders.buyer_id -> clients (3/4)"},
+		},
+		{
+			name:       "just below relationship_override_confidence",
+			confidence: 0.5,
+			override:   0.76,
+			convention: true,
+			buyers:     []interface{}{int64(100), int64(101), int64(102), int64(1)},
+		},
+		{
+			name:       "data agrees with the convention key",
+			confidence: 0.5,
+			override:   0.5,
+			convention: true,
+			buyers:     []interface{}{int64(1), int64(2), int64(3)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.RelationshipConfidence = tt.confidence
+			cfg.Pipeline.RelationshipOverrideConfidence = tt.override
+			handler := &analysisHandler{tables: map[string]*fakeTable{
+				"customers": idTable(10),
+				"clients":   clients,
+				"orders":    refTable("buyer_id", tt.buyers...),
+			}}
+			db, _ := newFakeDB(t, handler.serve)
+			schema := fkSchema(map[string][]string{"customers": nil, "clients": nil, "orders": {"buyer_id"}}, nil)
+			if tt.convention {
+				schema.Relationships = []ForeignKey{{TableName: "orders", ColumnName: "buyer_id",
+					RefTableName: "customers", RefColumnName: "id", Inferred: "convention"}}
+			}
+
+			found, err := NewDataAnalyzer(db, cfg, logger.New("error", "text"), nil).AnalyzeDataRelationships(context.Background(), schema)
+			if err != nil {
+				t.Fatalf("AnalyzeDataRelationships: %v", err)
+			}
+			var got []string
+			for _, rel := range found {
+				got = append(got, fmt.Sprintf("%s.%s -> %s (%d/%d)", rel.TableName, rel.ColumnName, rel.RefTableName, rel.MatchedValues, rel.SampledValues))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeDataRelationshipsTimeBudget(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.Workers = 1
+	cfg.Pipeline.AnalysisTimeBudget = 100 * time.Millisecond
+
+	// 20 candidate columns take 2 queries of 20ms each, 800ms in all
+	columns := []string{"id"}
+	tables := map[string]*fakeTable{"customers": idTable(3)}
+	var names []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("c%02d_id", i)
+		names = append(names, name)
+		columns = append(columns, name)
+	}
+	orders := &fakeTable{columns: columns}
+	for id := 1; id <= 3; id++ {
+		row := []driver.Value{int64(id)}
+		for range names {
+			row = append(row, int64(id))
+		}
+		orders.rows = append(orders.rows, row)
+	}
+	tables["orders"] = orders
+	handler := &analysisHandler{tables: tables, delay: 20 * time.Millisecond}
+	db, _ := newFakeDB(t, handler.serve)
+
+	start := time.Now()
+	analyzer := NewDataAnalyzer(db, cfg, logger.New("error", "text"), nil)
+	found, err := analyzer.AnalyzeDataRelationships(context.Background(), fkSchema(map[string][]string{"customers": nil, "orders": names}, nil))
+	if err != nil {
+		t.Fatalf("AnalyzeDataRelationships: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("analysis took %s with a 100ms budget", elapsed)
+	}
+	if len(found) == 0 || len(found) >= len(names) {
+		t.Errorf("found %d of %d relationships, want a partial result", len(found), len(names))
+	}
+	for i, rel := range found {
+		if rel.RefTableName != "customers" || rel.Confidence != 1 {
+			t.Errorf("relationship %+v", rel)
+		}
+		if i > 0 && found[i-1].ColumnName >= rel.ColumnName {
+			t.Errorf("results not sorted: %s before %s", found[i-1].ColumnName, rel.ColumnName)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Checkpoint records how far an interrupted export got. It is written when
+// the data phase is cancelled, and a run with -resume skips what it records
+// and appends the remaining rows to the existing output.
+type Checkpoint struct {
+	Tables map[string]*TableCheckpoint `json:"tables"`
+}
+
+// TableCheckpoint is the part of a table that reached the output. Tables
+// read by LIMIT/OFFSET record the rows written in that order, keyset-paged
+// tables the key of the last row written, and partitioned tables the
+// partitions written in full; a partly written partition is read again.
+type TableCheckpoint struct {
+	Done       bool     `json:"done,omitempty"`       // Every row was written
+	Offset     int64    `json:"offset,omitempty"`     // Rows written from the start, in LIMIT/OFFSET order
+	LastKey    string   `json:"last_key,omitempty"`   // Key column value of the last row written
+	Partitions []string `json:"partitions,omitempty"` // Partitions written in full
+}
+
+func NewCheckpoint() *Checkpoint {
+	return &Checkpoint{Tables: make(map[string]*TableCheckpoint)}
+}
+
+// LoadCheckpoint reads the checkpoint of an interrupted run
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	checkpoint := NewCheckpoint()
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Tables == nil {
+		checkpoint.Tables = make(map[string]*TableCheckpoint)
+	}
+	return checkpoint, nil
+}
+
+// Save writes the checkpoint
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Table returns a table's checkpoint, or an empty one if nothing of the
+// table was written. A nil checkpoint records nothing.
+func (c *Checkpoint) Table(tableName string) TableCheckpoint {
+	if c == nil || c.Tables[tableName] == nil {
+		return TableCheckpoint{}
+	}
+	return *c.Tables[tableName]
+}
+
+// partitionDone reports whether a partition was written in full
+func (tc TableCheckpoint) partitionDone(partition string) bool {
+	for _, done := range tc.Partitions {
+		if done == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// advanceCheckpoint extends the previous checkpoint with the jobs finished in
+// an interrupted run and returns it with the sequence numbers of the jobs
+// whose part files belong in the output. Only output the checkpoint accounts
+// for is kept: a LIMIT/OFFSET table keeps the jobs that continue its written
+// prefix, up to and including the first one that stopped early. submitted
+// holds the job count of each table whose jobs were all submitted.
+func advanceCheckpoint(previous *Checkpoint, results []ProcessingResult, submitted map[string]int) (*Checkpoint, map[int]bool) {
+	checkpoint := NewCheckpoint()
+	if previous != nil {
+		for tableName, tc := range previous.Tables {
+			copied := *tc
+			checkpoint.Tables[tableName] = &copied
+		}
+	}
+
+	byTable := make(map[string][]ProcessingResult)
+	for _, result := range results {
+		byTable[result.TableName] = append(byTable[result.TableName], result)
+	}
+
+	tableNames := make(map[string]bool)
+	for tableName := range submitted {
+		tableNames[tableName] = true
+	}
+	for tableName := range byTable {
+		tableNames[tableName] = true
+	}
+
+	keep := make(map[int]bool)
+	for tableName := range tableNames {
+		tableResults := byTable[tableName]
+		tc := checkpoint.Tables[tableName]
+		if tc == nil {
+			tc = &TableCheckpoint{}
+			checkpoint.Tables[tableName] = tc
+		}
+
+		// Done once all of the table's jobs were submitted and have finished
+		// without error
+		jobs, ok := submitted[tableName]
+		complete := ok && len(tableResults) == jobs
+		contiguous := true
+		sort.Slice(tableResults, func(i, j int) bool {
+			return tableResults[i].Job.Offset < tableResults[j].Job.Offset
+		})
+		for _, result := range tableResults {
+			job := result.Job
+			complete = complete && result.Error == nil
+
+			switch {
+			case job.Partition != "":
+				if result.Error == nil {
+					tc.Partitions = append(tc.Partitions, job.Partition)
+					keep[job.Sequence] = true
+				}
+
+			case job.KeyColumn != "":
+				if result.LastKey != "" {
+					tc.LastKey = result.LastKey
+				}
+				keep[job.Sequence] = true
+
+			case contiguous && job.Offset == tc.Offset:
+				keep[job.Sequence] = true
+				if result.Error == nil {
+					tc.Offset = job.Offset + job.Limit
+				} else {
+					tc.Offset = job.Offset + result.Read
+					contiguous = false
+				}
+
+			default:
+				// Beyond a gap; read again on resume
+				contiguous = false
+			}
+		}
+		sort.Strings(tc.Partitions)
+		tc.Done = complete
+	}
+
+	return checkpoint, keep
+}
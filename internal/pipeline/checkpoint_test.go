@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAdvanceCheckpoint(t *testing.T) {
+	failed := errors.New("interrupted")
+	offsetJob := func(sequence int, offset int64) TableJob {
+		return TableJob{TableName: "t", Offset: offset, Limit: 10, Sequence: sequence}
+	}
+	tests := []struct {
+		name      string
+		previous  *Checkpoint
+		results   []ProcessingResult
+		submitted map[string]int
+		want      TableCheckpoint
+		keep      []int
+	}{
+		{
+			name: "all jobs finished",
+			results: []ProcessingResult{
+				{TableName: "t", Job: offsetJob(1, 10)},
+				{TableName: "t", Job: offsetJob(0, 0)},
+			},
+			submitted: map[string]int{"t": 2},
+			want:      TableCheckpoint{Done: true, Offset: 20},
+			keep:      []int{0, 1},
+		},
+		{
+			name: "jobs still to submit",
+			results: []ProcessingResult{
+				{TableName: "t", Job: offsetJob(0, 0)},
+			},
+			want: TableCheckpoint{Offset: 10},
+			keep: []int{0},
+		},
+		{
+			name: "stopped part way through a job",
+			results: []ProcessingResult{
+				{TableName: "t", Job: offsetJob(0, 0)},
+				{TableName: "t", Job: offsetJob(1, 10), Read: 4, Error: failed},
+				{TableName: "t", Job: offsetJob(2, 20)},
+			},
+			submitted: map[string]int{"t": 3},
+			want:      TableCheckpoint{Offset: 14},
+			keep:      []int{0, 1},
+		},
+		{
+			name: "job beyond a gap",
+			results: []ProcessingResult{
+				{TableName: "t", Job: offsetJob(0, 0)},
+				{TableName: "t", Job: offsetJob(2, 20)},
+			},
+			want: TableCheckpoint{Offset: 10},
+			keep: []int{0},
+		},
+		{
+			name:     "continues the previous checkpoint",
+			previous: &Checkpoint{Tables: map[string]*TableCheckpoint{"t": {Offset: 10}}},
+			results: []ProcessingResult{
+				{TableName: "t", Job: offsetJob(5, 10)},
+			},
+			want: TableCheckpoint{Offset: 20},
+			keep: []int{5},
+		},
+		{
+			name: "keyset pages",
+			results: []ProcessingResult{
+				{TableName: "t", Job: TableJob{KeyColumn: "id", Sequence: 0}, LastKey: "42", Error: failed},
+			},
+			submitted: map[string]int{"t": 1},
+			want:      TableCheckpoint{LastKey: "42"},
+			keep:      []int{0},
+		},
+		{
+			name: "partitions",
+			results: []ProcessingResult{
+				{TableName: "t", Job: TableJob{Partition: "p2", Sequence: 1}},
+				{TableName: "t", Job: TableJob{Partition: "p1", Sequence: 0}},
+				{TableName: "t", Job: TableJob{Partition: "p3", Sequence: 2}, Error: failed},
+			},
+			submitted: map[string]int{"t": 3},
+			want:      TableCheckpoint{Partitions: []string{"p1", "p2"}},
+			keep:      []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint, keep := advanceCheckpoint(tt.previous, tt.results, tt.submitted)
+			if got := checkpoint.Table("t"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkpoint = %+v, want %+v", got, tt.want)
+			}
+			want := make(map[int]bool)
+			for _, sequence := range tt.keep {
+				want[sequence] = true
+			}
+			if !reflect.DeepEqual(keep, want) {
+				t.Errorf("kept parts %v, want %v", keep, want)
+			}
+			if tt.previous != nil && tt.previous.Tables["t"].Offset != 10 {
+				t.Error("the previous checkpoint was changed")
+			}
+		})
+	}
+}
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := &Checkpoint{Tables: map[string]*TableCheckpoint{
+		"users":  {Done: true, Offset: 100},
+		"orders": {LastKey: "17"},
+		"events": {Partitions: []string{"p0"}},
+	}}
+	if err := checkpoint.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, checkpoint) {
+		t.Errorf("loaded %+v, want %+v", loaded.Tables, checkpoint.Tables)
+	}
+	if got := loaded.Table("missing"); !reflect.DeepEqual(got, TableCheckpoint{}) {
+		t.Errorf("Table(missing) = %+v", got)
+	}
+	if got := (*Checkpoint)(nil).Table("users"); !reflect.DeepEqual(got, TableCheckpoint{}) {
+		t.Errorf("nil checkpoint Table = %+v", got)
+	}
+
+	if _, err := LoadCheckpoint(filepath.Join(t.TempDir(), "none.json")); err == nil {
+		t.Error("LoadCheckpoint of a missing file succeeded")
+	}
+	writeFile(t, path, "{")
+	if _, err := LoadCheckpoint(path); err == nil {
+		t.Error("LoadCheckpoint of malformed JSON succeeded")
+	}
+}
+
+// TestInterruptedExport cancels an export part way through, checks the
+// output ends on a complete triple and resumes it from the checkpoint
+func TestInterruptedExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string // Type of the id column; varchar pages by OFFSET
+	}{
+		{name: "keyset pages", keyType: "int"},
+		{name: "offset pages", keyType: "varchar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.BatchSize = 5
+			schema := func() *Schema {
+				schema := usersSchema(20)
+				schema.Tables["users"].Columns["id"].Type = tt.keyType
+				schema.Tables["users"].Columns["id"].ColumnType = tt.keyType
+				return schema
+			}
+			table := &fakeTable{columns: []string{"id", "name"}}
+			for i := 1; i <= 20; i++ {
+				table.rows = append(table.rows, []driver.Value{int64(i), "n"})
+			}
+			handler := tablesHandler(map[string]*fakeTable{"users": table})
+
+			// Cancel once the second batch has been read
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var batches atomic.Int32
+			db, _ := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				result, err := handler(query, args)
+				if !strings.HasPrefix(query, "SELECT COUNT") && batches.Add(1) == 2 {
+					cancel()
+				}
+				return result, err
+			})
+			err := testProcessor(cfg).ProcessTables(ctx, db, schema(), []string{"users"})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("ProcessTables = %v, want it cancelled", err)
+			}
+
+			output := filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)
+			data := readFile(t, output)
+			if data != "" && !strings.HasSuffix(data, " .\n") {
+				t.Fatalf("output ends on a partial triple: %q", data[max(0, len(data)-40):])
+			}
+			written := 0
+			for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+				if line != "" && !strings.HasSuffix(line, " .") {
+					t.Errorf("partial triple %q", line)
+				}
+				if strings.Contains(line, "<users.id>") {
+					written++
+				}
+			}
+			if written == 0 || written == 20 {
+				t.Fatalf("interrupted export wrote %d of 20 rows, want some", written)
+			}
+			checkpointPath := filepath.Join(cfg.Output.Directory, cfg.Output.CheckpointFile)
+			checkpoint, err := LoadCheckpoint(checkpointPath)
+			if err != nil {
+				t.Fatalf("no checkpoint after the interruption: %v", err)
+			}
+			if checkpoint.Table("users").Done {
+				t.Errorf("checkpoint records the interrupted table as done: %+v", checkpoint.Table("users"))
+			}
+
+			cfg.Pipeline.Resume = true
+			db, _ = newFakeDB(t, handler)
+			if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema(), []string{"users"}); err != nil {
+				t.Fatalf("resumed ProcessTables: %v", err)
+			}
+			ids := make(map[string]int)
+			for _, line := range strings.Split(readFile(t, output), "\n") {
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "users.id" {
+					ids[match[3]]++
+				}
+			}
+			if len(ids) != 20 {
+				t.Errorf("resumed output has %d of 20 rows", len(ids))
+			}
+			for id, n := range ids {
+				if n != 1 {
+					t.Errorf("row %s written %d times", id, n)
+				}
+			}
+			if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+				t.Errorf("checkpoint left after a completed export: %v", err)
+			}
+		})
+	}
+}
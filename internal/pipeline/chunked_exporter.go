@@ -3,71 +3,115 @@ package pipeline
 import (
 	"bufio"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/sink"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
+// chunkFilePrefix starts the name of every chunk file, data_chunk_N.rdf
+const chunkFilePrefix = "data_chunk_"
+
 // ChunkedExporter handles large-scale data export in chunks
 type ChunkedExporter struct {
 	cfg          *config.Config
 	logger       *logger.Logger
 	outputDir    string
 	chunkSize    int64
+	sink         sink.Sink // Stores the chunk files and manifest
 	currentChunk int
 	mu           sync.Mutex
 }
 
 // ChunkInfo contains information about an export chunk
 type ChunkInfo struct {
-	Index    int
-	Filename string
-	Size     int64
-	Records  int64
+	Index    int    `json:"index"`
+	Filename string `json:"file"`     // Relative to the output directory
+	Size     int64  `json:"size"`     // Bytes on disk
+	Records  int64  `json:"records"`  // Rows written to the chunk
+	Checksum string `json:"checksum"` // sha256:<hex> of the file as stored
+}
+
+// ChunkManifest lists the chunks of an export, written to
+// output.manifest_file so the importer can check the files are intact
+type ChunkManifest struct {
+	CreatedAt time.Time                       `json:"created_at"`
+	Records   int64                           `json:"records"`
+	Chunks    []ChunkInfo                     `json:"chunks"`
+	Skipped   map[string]map[SkipReason]int64 `json:"skipped,omitempty"` // Values and rows not emitted, per table and reason
 }
 
 func NewChunkedExporter(cfg *config.Config, logger *logger.Logger, outputDir string, chunkSize int64) *ChunkedExporter {
+	sinkOptions := cfg.Output.SinkOptions()
+	sinkOptions.Directory = outputDir
 	return &ChunkedExporter{
 		cfg:          cfg,
 		logger:       logger,
 		outputDir:    outputDir,
 		chunkSize:    chunkSize,
+		sink:         sink.New(sinkOptions),
 		currentChunk: 0,
 	}
 }
 
-// CreateChunk creates a new chunk file for export
-func (ce *ChunkedExporter) CreateChunk(format string) (*os.File, string, error) {
+// CreateChunk creates a new chunk file for export, written through
+// output.compression
+func (ce *ChunkedExporter) CreateChunk(format string) (io.WriteCloser, string, error) {
 	ce.mu.Lock()
 	defer ce.mu.Unlock()
 
 	ce.currentChunk++
-	filename := fmt.Sprintf("data_chunk_%d.%s", ce.currentChunk, format)
-	filepath := filepath.Join(ce.outputDir, filename)
+	filename := ce.cfg.Output.CompressedName(fmt.Sprintf(chunkFilePrefix+"%d.%s", ce.currentChunk, format))
 
-	file, err := os.Create(filepath)
+	file, err := ce.sink.Create(filename, false)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create chunk file %s: %w", filepath, err)
+		return nil, "", fmt.Errorf("failed to create chunk file %s: %w", filepath.Join(ce.outputDir, filename), err)
 	}
 
 	ce.logger.Info("Created new chunk file", "file", filename, "chunk", ce.currentChunk)
-	return file, filename, nil
+	return compress.NewWriter(file, ce.cfg.Output.Compression), filename, nil
 }
 
-// ExportInChunks exports data in manageable chunks
-func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataProcessor, schema *Schema, tables []string) ([]ChunkInfo, error) {
+// ExportInChunks exports data in manageable chunks. Rows are read and
+// converted the way ProcessTables does it, through db, and the same files are
+// left for the next run.
+func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataProcessor, db *sql.DB, schema *Schema, tables []string) ([]ChunkInfo, error) {
 	var chunks []ChunkInfo
 	totalRecords := int64(0)
 
+	// Chunks left by an earlier, larger export would be read as part of this one
+	if err := os.MkdirAll(ce.outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, name := range ChunkFiles(ce.cfg) {
+		if err := os.Remove(filepath.Join(ce.outputDir, name)); err != nil {
+			return nil, fmt.Errorf("failed to remove old chunk file %s: %w", name, err)
+		}
+	}
+
+	if err := processor.prepareRun(); err != nil {
+		return nil, err
+	}
+	if err := processor.loadIdentities(ctx, db, schema); err != nil {
+		return nil, err
+	}
+
 	// Estimate total records first
 	ce.logger.Info("Estimating total records to process...")
 	for _, tableName := range tables {
-		count, err := processor.getTableRowCount(tableName)
+		count, err := processor.getTableRowCount(ctx, db, tableName)
 		if err != nil {
 			ce.logger.Warn("Failed to get row count for table", "table", tableName, "error", err)
 			continue
@@ -78,27 +122,26 @@ func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataPr
 
 	processor.metrics.TotalRows = totalRecords
 	processor.metrics.TablesCount = len(tables)
+	processor.progress.mu.Lock()
+	processor.progress.TotalRows = totalRecords
+	processor.progress.mu.Unlock()
 
 	ce.logger.Info("Starting chunked export", "total_records", totalRecords, "chunk_size", ce.chunkSize)
 
 	// Process tables in chunks
 	currentRecords := int64(0)
-	chunkRecords := int64(0)
-
-	var currentFile *os.File
-	var currentWriter *bufio.Writer
-	var currentFilename string
-	var err error
 
-	// Create first chunk
-	currentFile, currentFilename, err = ce.CreateChunk("rdf")
+	// Only the chunk being written is open; each is closed as soon as it is
+	// full, and an early return closes the last one
+	current, err := ce.openChunk()
 	if err != nil {
 		return nil, err
 	}
-	defer currentFile.Close()
-
-	currentWriter = bufio.NewWriterSize(currentFile, 1024*1024) // 1MB buffer
-	defer currentWriter.Flush()
+	defer func() {
+		if current != nil {
+			current.close()
+		}
+	}()
 
 	for tableIndex, tableName := range tables {
 		processor.metrics.ProcessedTables = tableIndex
@@ -110,61 +153,53 @@ func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataPr
 			continue
 		}
 
-		// Process table in batches
-		offset := int64(0)
-		batchSize := int64(ce.cfg.Pipeline.BatchSize)
+		// Walk the table by primary key when possible, as ProcessTables does
+		job := TableJob{
+			TableName: tableName,
+			Schema:    schema,
+			BatchSize: ce.cfg.Pipeline.BatchSize,
+			KeyColumn: keysetColumn(table),
+		}
+		var lastKey string
+		var offset int64
 
-		for {
-			select {
-			case <-ctx.Done():
-				return chunks, ctx.Err()
-			default:
+		for first := true; ; first = false {
+			if err := ctx.Err(); err != nil {
+				processor.finishRun(true)
+				return chunks, err
 			}
 
-			// Check if we need a new chunk
-			if chunkRecords >= ce.chunkSize {
-				// Finalize current chunk
-				currentWriter.Flush()
-				currentFile.Close()
-
-				chunks = append(chunks, ChunkInfo{
-					Index:    ce.currentChunk,
-					Filename: currentFilename,
-					Records:  chunkRecords,
-				})
-
-				// Create new chunk
-				currentFile, currentFilename, err = ce.CreateChunk("rdf")
+			// Rotate to a new chunk once the current one is full
+			if current.records >= ce.chunkSize {
+				chunk, err := ce.finishChunk(current)
+				current = nil
 				if err != nil {
 					return chunks, err
 				}
-				defer currentFile.Close()
+				chunks = append(chunks, chunk)
 
-				currentWriter = bufio.NewWriterSize(currentFile, 1024*1024)
-				defer currentWriter.Flush()
-				chunkRecords = 0
+				if current, err = ce.openChunk(); err != nil {
+					return chunks, err
+				}
 			}
 
-			// Process batch from table
-			batchProcessed, err := processor.processTableBatchToWriter(ctx, tableName, table, offset, batchSize, currentWriter, schema)
+			batch, err := processor.streamBatch(ctx, db, job, current.writer, first, lastKey, offset)
 			if err != nil {
-				ce.logger.Error("Failed to process batch", "table", tableName, "offset", offset, "error", err)
-				break
+				return chunks, fmt.Errorf("table %s: %w", tableName, err)
 			}
 
-			if batchProcessed == 0 {
-				break // No more data
+			currentRecords += batch.processed
+			current.records += batch.processed
+			offset += batch.read
+			if batch.lastKey != "" {
+				lastKey = batch.lastKey
 			}
 
-			currentRecords += batchProcessed
-			chunkRecords += batchProcessed
-			offset += batchSize
-
 			// Update metrics
 			processor.metrics.UpdateProgress(currentRecords, tableName)
 
 			// Log progress every 10k records
-			if currentRecords%10000 == 0 {
+			if batch.processed > 0 && currentRecords%10000 == 0 {
 				processed, rps, memMB, _ := processor.metrics.GetStats()
 				eta := processor.metrics.EstimateCompletion()
 
@@ -177,21 +212,38 @@ func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataPr
 					"eta", eta.String(),
 				)
 			}
+
+			if batch.last(job) {
+				break
+			}
 		}
 	}
 
-	// Finalize last chunk
-	if chunkRecords > 0 {
-		currentWriter.Flush()
-		currentFile.Close()
+	// Finalize last chunk; an empty one is removed rather than listed
+	last := current
+	current = nil
+	if last.records > 0 {
+		chunk, err := ce.finishChunk(last)
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, chunk)
+	} else {
+		last.close()
+		if err := os.Remove(filepath.Join(ce.outputDir, last.filename)); err != nil {
+			ce.logger.Warn("Failed to remove empty chunk file", "file", last.filename, "error", err)
+		}
+	}
 
-		chunks = append(chunks, ChunkInfo{
-			Index:    ce.currentChunk,
-			Filename: currentFilename,
-			Records:  chunkRecords,
-		})
+	processor.countOrphanedForeignKeys(ctx, db, schema, tables)
+	if err := ce.WriteManifest(chunks, processor.SkipStats().Snapshot()); err != nil {
+		return chunks, err
 	}
 
+	// Chunks share the single-file export's UID map, name map, profile,
+	// fingerprints and watermarks
+	processor.finishRun(false)
+
 	ce.logger.Info("Chunked export completed",
 		"total_chunks", len(chunks),
 		"total_records", currentRecords,
@@ -200,3 +252,167 @@ func (ce *ChunkedExporter) ExportInChunks(ctx context.Context, processor *DataPr
 
 	return chunks, nil
 }
+
+// chunkFile is the chunk being written
+type chunkFile struct {
+	index    int
+	filename string
+	file     io.WriteCloser
+	writer   *bufio.Writer
+	records  int64
+}
+
+// close flushes the buffered triples and closes the file, returning the
+// first error
+func (c *chunkFile) close() error {
+	err := c.writer.Flush()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openChunk creates the next chunk file with a 1MB write buffer
+func (ce *ChunkedExporter) openChunk() (*chunkFile, error) {
+	file, filename, err := ce.CreateChunk("rdf")
+	if err != nil {
+		return nil, err
+	}
+	ce.mu.Lock()
+	index := ce.currentChunk
+	ce.mu.Unlock()
+
+	return &chunkFile{
+		index:    index,
+		filename: filename,
+		file:     file,
+		writer:   bufio.NewWriterSize(file, 1024*1024),
+	}, nil
+}
+
+// finishChunk closes a chunk and describes it, reading back its size
+// and checksum
+func (ce *ChunkedExporter) finishChunk(c *chunkFile) (ChunkInfo, error) {
+	path := filepath.Join(ce.outputDir, c.filename)
+	if err := c.close(); err != nil {
+		return ChunkInfo{}, fmt.Errorf("failed to write chunk file %s: %w", path, err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return ChunkInfo{}, fmt.Errorf("failed to stat chunk file %s: %w", path, err)
+	}
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		return ChunkInfo{}, fmt.Errorf("failed to checksum chunk file %s: %w", path, err)
+	}
+
+	return ChunkInfo{
+		Index:    c.index,
+		Filename: c.filename,
+		Size:     stat.Size(),
+		Records:  c.records,
+		Checksum: checksum,
+	}, nil
+}
+
+// WriteManifest writes the chunks and the skip tallies to
+// output.manifest_file in the output directory
+func (ce *ChunkedExporter) WriteManifest(chunks []ChunkInfo, skipped map[string]map[SkipReason]int64) error {
+	manifest := ChunkManifest{CreatedAt: time.Now(), Chunks: chunks, Skipped: skipped}
+	for _, chunk := range chunks {
+		manifest.Records += chunk.Records
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode chunk manifest: %w", err)
+	}
+	path := filepath.Join(ce.outputDir, ce.cfg.Output.ManifestFile)
+	file, err := ce.sink.Create(ce.cfg.Output.ManifestFile, false)
+	if err != nil {
+		return fmt.Errorf("failed to write chunk manifest: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write chunk manifest: %w", err)
+	}
+
+	ce.logger.Info("Chunk manifest written", "file", path, "chunks", len(chunks))
+	return nil
+}
+
+// RefreshManifest re-reads the size and checksum of every chunk listed in
+// output.manifest_file and rewrites it, for chunks changed after the export
+func (ce *ChunkedExporter) RefreshManifest() error {
+	manifest, err := LoadChunkManifest(filepath.Join(ce.outputDir, ce.cfg.Output.ManifestFile))
+	if err != nil {
+		return err
+	}
+
+	for i, chunk := range manifest.Chunks {
+		path := filepath.Join(ce.outputDir, chunk.Filename)
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat chunk file %s: %w", path, err)
+		}
+		checksum, err := FileChecksum(path)
+		if err != nil {
+			return fmt.Errorf("failed to checksum chunk file %s: %w", path, err)
+		}
+		manifest.Chunks[i].Size = stat.Size()
+		manifest.Chunks[i].Checksum = checksum
+	}
+	return ce.WriteManifest(manifest.Chunks, manifest.Skipped)
+}
+
+// LoadChunkManifest reads a manifest written by WriteManifest
+func LoadChunkManifest(path string) (*ChunkManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk manifest: %w", err)
+	}
+	var manifest ChunkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid chunk manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// ChunkFiles returns the names of the chunk files in output.directory in
+// chunk order
+func ChunkFiles(cfg *config.Config) []string {
+	pattern := cfg.Output.CompressedName(chunkFilePrefix + "*.rdf")
+	paths, _ := filepath.Glob(filepath.Join(cfg.Output.Directory, pattern))
+
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = filepath.Base(path)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return chunkIndex(names[i]) < chunkIndex(names[j])
+	})
+	return names
+}
+
+// chunkIndex returns the N of data_chunk_N.rdf
+func chunkIndex(name string) int {
+	index, _ := strconv.Atoi(strings.SplitN(strings.TrimPrefix(name, chunkFilePrefix), ".", 2)[0])
+	return index
+}
+
+// rdfDataFiles returns the names of the RDF files the data phase writes: the
+// chunk files when output.chunk_size is set, the per-table files with
+// output.split_by_table, else output.RDFFiles
+func rdfDataFiles(cfg *config.Config) []string {
+	switch {
+	case cfg.Output.ChunkSize > 0:
+		return ChunkFiles(cfg)
+	case cfg.Output.SplitByTable:
+		return TableFiles(cfg)
+	}
+	return cfg.Output.RDFFiles()
+}
@@ -0,0 +1,374 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// testConfig returns the default configuration writing to a temporary
+// directory
+func testConfig(t testing.TB) *config.Config {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Output.Directory = t.TempDir()
+	cfg.Pipeline.Workers = 1
+	return cfg
+}
+
+// testProcessor returns a data processor that logs only errors
+func testProcessor(cfg *config.Config) *DataProcessor {
+	return NewDataProcessor(cfg, logger.New("error", "text"), &ProgressTracker{}, nil)
+}
+
+// usersSchema is a users table with an integer primary key and a name
+func usersSchema(rows int64) *Schema {
+	return &Schema{Tables: map[string]*Table{
+		"users": {
+			Name: "users",
+			Columns: map[string]*Column{
+				"id":   {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+				"name": {Name: "name", Type: "varchar", ColumnType: "varchar(50)", Position: 2},
+			},
+			PrimaryKeys: []string{"id"},
+			RowCount:    rows,
+		},
+	}}
+}
+
+// usersTable serves n users named user1, user2, ...
+func usersTable(n int) *fakeTable {
+	table := &fakeTable{columns: []string{"id", "name"}}
+	for i := 1; i <= n; i++ {
+		table.rows = append(table.rows, []driver.Value{int64(i), "user" + strconv.Itoa(i)})
+	}
+	return table
+}
+
+// countingHandler answers COUNT(*) with the table's size and batch queries
+// from the table
+func countingHandler(table *fakeTable) fakeHandler {
+	return func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(len(table.rows))}}}, nil
+		}
+		return table.serve(query, args)
+	}
+}
+
+func TestExportInChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		chunkSize int64
+		batchSize int
+		chunks    []int64 // Records per chunk
+	}{
+		{name: "one chunk", rows: 3, chunkSize: 10, batchSize: 2, chunks: []int64{3}},
+		{name: "rotates when full", rows: 5, chunkSize: 2, batchSize: 2, chunks: []int64{2, 2, 1}},
+		{name: "exact multiple", rows: 4, chunkSize: 2, batchSize: 2, chunks: []int64{2, 2}},
+		{name: "empty table", rows: 0, chunkSize: 2, batchSize: 2, chunks: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.ChunkSize = tt.chunkSize
+			cfg.Pipeline.BatchSize = tt.batchSize
+			db, _ := newFakeDB(t, countingHandler(usersTable(tt.rows)))
+
+			exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, tt.chunkSize)
+			chunks, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(int64(tt.rows)), []string{"users"})
+			if err != nil {
+				t.Fatalf("ExportInChunks: %v", err)
+			}
+			if len(chunks) != len(tt.chunks) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(tt.chunks))
+			}
+			for i, chunk := range chunks {
+				if chunk.Records != tt.chunks[i] {
+					t.Errorf("chunk %d holds %d records, want %d", i, chunk.Records, tt.chunks[i])
+				}
+			}
+			if got := ChunkFiles(cfg); len(got) != len(tt.chunks) {
+				t.Errorf("chunk files %v, want %d", got, len(tt.chunks))
+			}
+		})
+	}
+}
+
+// TestChunkManifest exports chunks and checks the manifest lists each file
+// on disk with its size, records and checksum
+func TestChunkManifest(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        int
+		compression string
+		records     []int64
+	}{
+		{name: "plain", rows: 5, compression: compress.None, records: []int64{2, 2, 1}},
+		{name: "gzip", rows: 5, compression: compress.Gzip, records: []int64{2, 2, 1}},
+		{name: "no rows", rows: 0, compression: compress.None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.ChunkSize = 2
+			cfg.Output.Compression = tt.compression
+			cfg.Pipeline.BatchSize = 2
+			db, _ := newFakeDB(t, countingHandler(usersTable(tt.rows)))
+			exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 2)
+			if _, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(int64(tt.rows)), []string{"users"}); err != nil {
+				t.Fatalf("ExportInChunks: %v", err)
+			}
+
+			manifestPath := filepath.Join(cfg.Output.Directory, cfg.Output.ManifestFile)
+			manifest, err := LoadChunkManifest(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := ChunkFiles(cfg)
+			if len(manifest.Chunks) != len(files) || len(files) != len(tt.records) {
+				t.Fatalf("manifest lists %d chunks, %d on disk, want %d", len(manifest.Chunks), len(files), len(tt.records))
+			}
+			var total int64
+			for i, chunk := range manifest.Chunks {
+				if chunk.Filename != files[i] || chunk.Index != i+1 || chunk.Records != tt.records[i] {
+					t.Errorf("chunk %d: %+v, want %s with %d records", i, chunk, files[i], tt.records[i])
+				}
+				data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, chunk.Filename))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); chunk.Size != int64(len(data)) || chunk.Checksum != want {
+					t.Errorf("%s listed as %d bytes %s, is %d bytes %s", chunk.Filename, chunk.Size, chunk.Checksum, len(data), want)
+				}
+				total += chunk.Records
+			}
+			if manifest.Records != total {
+				t.Errorf("manifest records %d, chunks hold %d", manifest.Records, total)
+			}
+			if len(files) == 0 {
+				return
+			}
+
+			// A chunk changed after the export is picked up by RefreshManifest
+			changed := filepath.Join(cfg.Output.Directory, files[0])
+			if err := os.WriteFile(changed, []byte("_:a <name> \"a\" .\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.RefreshManifest(); err != nil {
+				t.Fatalf("RefreshManifest: %v", err)
+			}
+			refreshed, err := LoadChunkManifest(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum, err := FileChecksum(changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first := refreshed.Chunks[0]; first.Size != 17 || first.Checksum != sum || first.Records != tt.records[0] {
+				t.Errorf("refreshed chunk %+v, want 17 bytes %s", first, sum)
+			}
+		})
+	}
+}
+
+// openFiles returns the number of file descriptors the process holds
+func openFiles(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count open files: %v", err)
+	}
+	return len(entries)
+}
+
+// TestExportInChunksClosesChunks writes many small chunks and checks the
+// files open while exporting stay bounded instead of growing per chunk
+func TestExportInChunksClosesChunks(t *testing.T) {
+	for _, compression := range []string{compress.None, compress.Gzip} {
+		t.Run(compression, func(t *testing.T) {
+			const rows = 200
+			cfg := testConfig(t)
+			cfg.Output.ChunkSize = 1
+			cfg.Output.Compression = compression
+			cfg.Pipeline.BatchSize = 1
+			table := usersTable(rows)
+			counting := countingHandler(table)
+			baseline := openFiles(t)
+			peak := 0
+			handler := func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				peak = max(peak, openFiles(t))
+				return counting(query, args)
+			}
+			db, _ := newFakeDB(t, handler)
+
+			exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 1)
+			chunks, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(rows), []string{"users"})
+			if err != nil {
+				t.Fatalf("ExportInChunks: %v", err)
+			}
+			if len(chunks) != rows {
+				t.Fatalf("got %d chunks, want %d", len(chunks), rows)
+			}
+			if peak-baseline > 10 {
+				t.Errorf("%d files open while writing %d chunks, %d before", peak, rows, baseline)
+			}
+			if after := openFiles(t); after > baseline {
+				t.Errorf("%d files open after the export, %d before", after, baseline)
+			}
+
+			// Every chunk was flushed and closed whole
+			for _, name := range ChunkFiles(cfg) {
+				file, err := compress.Open(filepath.Join(cfg.Output.Directory, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(file)
+				file.Close()
+				if err != nil {
+					t.Fatalf("read %s: %v", name, err)
+				}
+				if !strings.HasSuffix(string(data), " .\n") {
+					t.Errorf("%s ends in %q", name, data[max(0, len(data)-20):])
+				}
+			}
+		})
+	}
+}
+
+// TestExportInChunksConvertsLikeProcessTables checks that chunks carry
+// derived predicates and that the chunked path leaves fingerprints and the
+// profile for the next run
+func TestExportInChunksConvertsLikeProcessTables(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.ChunkSize = 10
+	cfg.Output.DerivedPredicates = map[string]string{"users.label": "upper(name)"}
+	cfg.Pipeline.DeltaColumns = true
+	cfg.Pipeline.Profile = true
+	db, _ := newFakeDB(t, countingHandler(usersTable(2)))
+
+	exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 10)
+	if _, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(2), []string{"users"}); err != nil {
+		t.Fatalf("ExportInChunks: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, ChunkFiles(cfg)[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `_:users_1 <users.label> "USER1" .`) {
+		t.Errorf("chunk has no derived predicate:\n%s", data)
+	}
+	for _, name := range []string{cfg.Output.FingerprintFile, cfg.Output.ProfileFile} {
+		if _, err := os.Stat(filepath.Join(cfg.Output.Directory, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+
+	// A second delta run over unchanged rows emits nothing
+	exporter = NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 10)
+	chunks, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(2), []string{"users"})
+	if err != nil {
+		t.Fatalf("second ExportInChunks: %v", err)
+	}
+	for _, chunk := range chunks {
+		data, _ := os.ReadFile(filepath.Join(cfg.Output.Directory, chunk.Filename))
+		if len(data) > 0 {
+			t.Errorf("unchanged rows were written again:\n%s", data)
+		}
+	}
+}
+
+func TestExportInChunksFailsOnBatchError(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.ChunkSize = 10
+	cfg.Retry.MaxRetries = 0
+	queryErr := errors.New("lost connection")
+	db, _ := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(2)}}}, nil
+		}
+		return nil, queryErr
+	})
+
+	exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 10)
+	_, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(2), []string{"users"})
+	if !errors.Is(err, queryErr) {
+		t.Fatalf("got error %v, want %v", err, queryErr)
+	}
+}
+
+func TestExportInChunksPagesByKey(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.ChunkSize = 10
+	cfg.Pipeline.BatchSize = 2
+	db, fake := newFakeDB(t, countingHandler(usersTable(3)))
+
+	exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 10)
+	if _, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(3), []string{"users"}); err != nil {
+		t.Fatalf("ExportInChunks: %v", err)
+	}
+	for _, query := range fake.Queries() {
+		if strings.Contains(query, "OFFSET") {
+			t.Errorf("integer key table paged by offset: %s", query)
+		}
+	}
+}
+
+func TestBatchQueryRetries(t *testing.T) {
+	lockWait := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   int
+		wantErr    bool
+	}{
+		{name: "retried up to retry.max_retries", maxRetries: 2, failures: 2},
+		{name: "fails once retries run out", maxRetries: 2, failures: 3, wantErr: true},
+		{name: "no retries", maxRetries: 0, failures: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.ChunkSize = 10
+			cfg.Retry.MaxRetries = tt.maxRetries
+			cfg.Retry.Delay = 0
+			// Dgraph's retry settings do not apply to MySQL queries
+			cfg.Dgraph.MaxRetries = 10
+
+			table := usersTable(2)
+			failures := tt.failures
+			db, _ := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				if strings.HasPrefix(query, "SELECT COUNT(*)") {
+					return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(2)}}}, nil
+				}
+				if failures > 0 {
+					failures--
+					return nil, lockWait
+				}
+				return table.serve(query, args)
+			})
+
+			exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, 10)
+			_, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, usersSchema(2), []string{"users"})
+			if tt.wantErr != errors.Is(err, lockWait) || (!tt.wantErr && err != nil) {
+				t.Fatalf("ExportInChunks = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// collationLanguages maps the language part of MySQL collation names to
+// BCP 47 tags. MySQL 8 collations name the language by its ISO code, as in
+// utf8mb4_de_pb_0900_ai_ci; older ones spell it out, as in
+// utf8mb4_german2_ci.
+var collationLanguages = map[string]string{
+	"bs": "bs", "cs": "cs", "da": "da", "de": "de", "eo": "eo", "es": "es",
+	"et": "et", "gl": "gl", "hr": "hr", "hu": "hu", "is": "is", "ja": "ja",
+	"la": "la", "lt": "lt", "lv": "lv", "mn": "mn", "nb": "nb", "nn": "nn",
+	"pl": "pl", "ro": "ro", "ru": "ru", "sk": "sk", "sl": "sl", "sr": "sr",
+	"sv": "sv", "tr": "tr", "vi": "vi", "zh": "zh",
+
+	"croatian": "hr", "czech": "cs", "danish": "da", "esperanto": "eo",
+	"estonian": "et", "german1": "de", "german2": "de", "hungarian": "hu",
+	"icelandic": "is", "latvian": "lv", "lithuanian": "lt", "persian": "fa",
+	"polish": "pl", "romanian": "ro", "sinhala": "si", "slovak": "sk",
+	"slovenian": "sl", "spanish": "es", "spanish2": "es", "swedish": "sv",
+	"turkish": "tr", "vietnamese": "vi",
+}
+
+// CollationLanguage returns the language tag a MySQL collation implies, or
+// "" for language-neutral collations such as utf8mb4_0900_ai_ci. The server
+// default latin1_swedish_ci says nothing about the data, so it is neutral.
+func CollationLanguage(collation string) string {
+	collation = strings.ToLower(collation)
+	if collation == "" || collation == "latin1_swedish_ci" {
+		return ""
+	}
+	parts := strings.Split(collation, "_")
+	if len(parts) < 2 {
+		return ""
+	}
+	// The first part is the character set
+	return collationLanguages[parts[1]]
+}
+
+// columnLanguage returns the language tag of a string column's values when
+// pipeline.detect_language_from_collation is enabled. Values that are not
+// plain strings, such as SET members and base64-encoded binary, get none.
+func columnLanguage(cfg *config.Config, tableName string, column *Column, dgraphType string) string {
+	if !cfg.Pipeline.DetectLanguageFromCollation || column == nil || dgraphType != "string" {
+		return ""
+	}
+	if IsSetType(column.Type) || isBase64Column(cfg, tableName, column) {
+		return ""
+	}
+	return CollationLanguage(column.Collation)
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollationLanguage(t *testing.T) {
+	tests := map[string]string{
+		"utf8mb4_de_0900_ai_ci":    "de",
+		"utf8mb4_de_pb_0900_ai_ci": "de",
+		"UTF8MB4_SV_0900_AS_CS":    "sv",
+		"utf8mb4_german2_ci":       "de",
+		"latin1_spanish_ci":        "es",
+		"utf8mb4_persian_ci":       "fa",
+		"utf8mb4_0900_ai_ci":       "",
+		"utf8mb4_general_ci":       "",
+		"utf8mb4_bin":              "",
+		"latin1_swedish_ci":        "",
+		"binary":                   "",
+		"":                         "",
+	}
+	for collation, want := range tests {
+		if got := CollationLanguage(collation); got != want {
+			t.Errorf("CollationLanguage(%q) = %q, want %q", collation, got, want)
+		}
+	}
+}
+
+func TestColumnLanguage(t *testing.T) {
+	german := "utf8mb4_de_0900_ai_ci"
+	tests := []struct {
+		name       string
+		disabled   bool
+		column     *Column
+		dgraphType string
+		want       string
+	}{
+		{name: "german varchar", column: &Column{Name: "name", Type: "varchar", Collation: german}, dgraphType: "string", want: "de"},
+		{name: "detection disabled", disabled: true, column: &Column{Name: "name", Type: "varchar", Collation: german}, dgraphType: "string"},
+		{name: "neutral collation", column: &Column{Name: "name", Type: "varchar", Collation: "utf8mb4_0900_ai_ci"}, dgraphType: "string"},
+		{name: "set members", column: &Column{Name: "tags", Type: "set", Collation: german}, dgraphType: "string"},
+		{name: "base64 binary", column: &Column{Name: "photo", Type: "blob", Collation: german}, dgraphType: "string"},
+		{name: "not a string", column: &Column{Name: "id", Type: "int", Collation: german}, dgraphType: "int"},
+		{name: "no column", dgraphType: "string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.DetectLanguageFromCollation = !tt.disabled
+			if got := columnLanguage(cfg, "users", tt.column, tt.dgraphType); got != tt.want {
+				t.Errorf("columnLanguage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGermanCollation exports a German-collated column and checks its
+// predicate is marked @lang and its values tagged @de
+func TestGermanCollation(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		detect   bool
+		schema   string // Schema of users.name
+		contains string // Part of the data output
+		lacks    string
+	}{
+		{name: "rdf", format: "rdf", detect: true, schema: "users.name: string @index(term) @lang .", contains: `<users.name> "Müller"@de .`},
+		{name: "json", format: "json", detect: true, schema: "users.name: string @index(term) @lang .", contains: `"users.name@de":"Müller"`},
+		{name: "detection off", format: "rdf", schema: "users.name: string @index(term) .", contains: `<users.name> "Müller" .`, lacks: "@de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.Format = tt.format
+			cfg.Pipeline.DetectLanguageFromCollation = tt.detect
+			cfg.Pipeline.SkipValidation = true
+			info := shopSchema()
+			info.columns["users"][1].collation = "utf8mb4_de_0900_ai_ci"
+			info.rows["users"].rows[0][1] = "Müller"
+			runPipeline(t, cfg, info, ModeFull, RunOptions{})
+
+			schema := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+			var schemaLine string
+			for _, line := range strings.Split(schema, "\n") {
+				if strings.HasPrefix(line, "users.name:") {
+					schemaLine = line
+				}
+			}
+			if schemaLine != tt.schema {
+				t.Errorf("schema line %q, want %q", schemaLine, tt.schema)
+			}
+
+			var data string
+			entries, err := os.ReadDir(cfg.Output.Directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".rdf") || strings.HasSuffix(entry.Name(), ".json") {
+					data += readFile(t, filepath.Join(cfg.Output.Directory, entry.Name()))
+				}
+			}
+			if tt.format == "json" {
+				data = compactJSON(t, data)
+			}
+			if !strings.Contains(data, tt.contains) {
+				t.Errorf("output lacks %s:\n%s", tt.contains, data)
+			}
+			if tt.lacks != "" && strings.Contains(data, tt.lacks) {
+				t.Errorf("output holds %s:\n%s", tt.lacks, data)
+			}
+		})
+	}
+}
+
+// compactJSON removes the insignificant whitespace of concatenated JSON
+// documents
+func compactJSON(t *testing.T, data string) string {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(data))
+	var out strings.Builder
+	for dec.More() {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, data)
+		}
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write(encoded)
+	}
+	return out.String()
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// selectTableColumns applies pipeline.table_columns. Columns left out of a
+// table's list are removed from the schema, so they are neither read nor
+// given predicates. Primary key and key_columns columns are still read to
+// identify rows, as is the incremental watermark column to advance the
+// watermark, but they get a drop rule unless listed. Listing a table or
+// column the schema does not have is an error.
+func selectTableColumns(cfg *config.Config, schema *Schema) error {
+	if len(cfg.Pipeline.TableColumns) == 0 {
+		return nil
+	}
+
+	for tableName, columns := range cfg.Pipeline.TableColumns {
+		table := schema.Tables[tableName]
+		if table == nil {
+			return fmt.Errorf("pipeline table_columns: unknown table %s", tableName)
+		}
+
+		selected := make(map[string]bool, len(columns))
+		for _, columnName := range columns {
+			if table.Columns[columnName] == nil {
+				return fmt.Errorf("pipeline table_columns: table %s has no column %s", tableName, columnName)
+			}
+			selected[columnName] = true
+		}
+
+		identity := identityColumns(cfg, tableName, table)
+		for columnName := range table.Columns {
+			switch {
+			case selected[columnName]:
+			case identity[columnName]:
+				dropColumn(cfg, tableName, columnName)
+			default:
+				delete(table.Columns, columnName)
+			}
+		}
+	}
+
+	removeColumnRelationships(schema)
+	return nil
+}
+
+// skipGeneratedColumns applies pipeline.skip_generated_columns: virtual
+// generated columns are removed from the schema, since MySQL computes them
+// from columns that are exported anyway. One that identifies rows is still
+// read, under a drop rule. Stored generated columns are kept. It returns how
+// many columns were skipped.
+func skipGeneratedColumns(cfg *config.Config, schema *Schema) int {
+	if !cfg.Pipeline.SkipGeneratedColumns {
+		return 0
+	}
+
+	skipped := 0
+	for tableName, table := range schema.Tables {
+		identity := identityColumns(cfg, tableName, table)
+		for columnName, column := range table.Columns {
+			if !column.Virtual {
+				continue
+			}
+			if identity[columnName] {
+				dropColumn(cfg, tableName, columnName)
+			} else {
+				delete(table.Columns, columnName)
+			}
+			skipped++
+		}
+	}
+
+	removeColumnRelationships(schema)
+	return skipped
+}
+
+// identityColumns returns the columns that must be read to identify a
+// table's rows: its primary key and key_columns, and the incremental
+// watermark column
+func identityColumns(cfg *config.Config, tableName string, table *Table) map[string]bool {
+	identity := make(map[string]bool)
+	for _, columnName := range table.PrimaryKeys {
+		identity[columnName] = true
+	}
+	for _, columnName := range cfg.Output.KeyColumns[tableName] {
+		identity[columnName] = true
+	}
+	if cfg.Pipeline.Incremental.Enabled {
+		identity[cfg.Pipeline.Incremental.WatermarkColumn] = true
+	}
+	return identity
+}
+
+// dropColumn gives a column that is read but not exported a drop rule,
+// unless it has a rule of its own
+func dropColumn(cfg *config.Config, tableName, columnName string) {
+	if cfg.Pipeline.ColumnRule(tableName, columnName) != "" {
+		return
+	}
+	if cfg.Pipeline.ColumnRules == nil {
+		cfg.Pipeline.ColumnRules = make(map[string]string)
+	}
+	cfg.Pipeline.ColumnRules[tableName+"."+columnName] = "drop"
+}
+
+// removeColumnRelationships drops the foreign keys of removed columns, which
+// no longer produce edges
+func removeColumnRelationships(schema *Schema) {
+	relationships := schema.Relationships[:0]
+	for _, fk := range schema.Relationships {
+		if table := schema.Tables[fk.TableName]; table != nil && table.Columns[fk.ColumnName] == nil {
+			continue
+		}
+		relationships = append(relationships, fk)
+	}
+	schema.Relationships = relationships
+}
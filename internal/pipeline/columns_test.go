@@ -0,0 +1,326 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestSelectTableColumns(t *testing.T) {
+	tests := []struct {
+		name          string
+		tableColumns  map[string][]string
+		keyColumns    map[string][]string
+		columns       map[string][]string // Columns left per table
+		drops         []string            // Drop rules added, as table.column
+		relationships int
+		errText       string
+	}{
+		{
+			name:          "no selection",
+			columns:       map[string][]string{"users": {"email", "group_id", "id", "name"}, "groups": {"id"}},
+			relationships: 1,
+		},
+		{
+			name:          "primary key kept but dropped",
+			tableColumns:  map[string][]string{"users": {"name"}},
+			columns:       map[string][]string{"users": {"id", "name"}, "groups": {"id"}},
+			drops:         []string{"users.id"},
+			relationships: 0,
+		},
+		{
+			name:          "listed primary key and foreign key",
+			tableColumns:  map[string][]string{"users": {"id", "group_id"}},
+			columns:       map[string][]string{"users": {"group_id", "id"}, "groups": {"id"}},
+			relationships: 1,
+		},
+		{
+			name:          "key columns kept",
+			tableColumns:  map[string][]string{"users": {"name"}},
+			keyColumns:    map[string][]string{"users": {"email"}},
+			columns:       map[string][]string{"users": {"email", "id", "name"}, "groups": {"id"}},
+			drops:         []string{"users.email", "users.id"},
+			relationships: 0,
+		},
+		{
+			name:         "unknown table",
+			tableColumns: map[string][]string{"accounts": {"id"}},
+			errText:      "pipeline table_columns: unknown table accounts",
+		},
+		{
+			name:         "unknown column",
+			tableColumns: map[string][]string{"users": {"name", "nickname"}},
+			errText:      "pipeline table_columns: table users has no column nickname",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.TableColumns = tt.tableColumns
+			cfg.Output.KeyColumns = tt.keyColumns
+			schema := fkSchema(map[string][]string{"users": {"name", "email", "group_id"}, "groups": nil},
+				[][3]string{{"users", "group_id", "groups"}})
+
+			err := selectTableColumns(cfg, schema)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("selectTableColumns error = %v, want %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectTableColumns: %v", err)
+			}
+
+			for tableName, want := range tt.columns {
+				var got []string
+				for columnName := range schema.Tables[tableName].Columns {
+					got = append(got, columnName)
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, want) {
+					t.Errorf("%s columns = %v, want %v", tableName, got, want)
+				}
+			}
+			var drops []string
+			for column, rule := range cfg.Pipeline.ColumnRules {
+				if rule == "drop" {
+					drops = append(drops, column)
+				}
+			}
+			slices.Sort(drops)
+			if !slices.Equal(drops, tt.drops) {
+				t.Errorf("drop rules = %v, want %v", drops, tt.drops)
+			}
+			if len(schema.Relationships) != tt.relationships {
+				t.Errorf("relationships = %+v, want %d", schema.Relationships, tt.relationships)
+			}
+		})
+	}
+}
+
+// TestTableColumnsExport restricts a table of five columns to two and checks
+// the query, the RDF and the schema only carry those
+func TestTableColumnsExport(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MySQL.Database = "shop"
+	cfg.Pipeline.SkipValidation = true
+	cfg.Pipeline.TableColumns = map[string][]string{"users": {"name", "email"}}
+	info := &infoSchema{
+		columns: map[string][]fakeColumn{"users": {
+			{name: "id", dataType: "int", columnType: "int"},
+			{name: "name", dataType: "varchar", columnType: "varchar(50)"},
+			{name: "email", dataType: "varchar", columnType: "varchar(100)"},
+			{name: "phone", dataType: "varchar", columnType: "varchar(20)"},
+			{name: "bio", dataType: "text", columnType: "text"},
+		}},
+		primaryKeys: map[string][]string{"users": {"id"}},
+		rows: map[string]*fakeTable{"users": {
+			columns: []string{"id", "name", "email", "phone", "bio"},
+			rows:    [][]driver.Value{{int64(1), "Ada", "ada@example.com", "555", "Mathematician"}},
+		}},
+	}
+	db, fake := newFakeDB(t, info.serve)
+	p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+	if err != nil {
+		t.Fatalf("NewWithDB: %v", err)
+	}
+	defer p.Stop()
+	if _, err := p.Run(context.Background(), ModeFull, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	for _, query := range fake.Queries() {
+		if strings.Contains(query, "FROM `users`") && !strings.HasPrefix(query, "SELECT COUNT") &&
+			(strings.Contains(query, "`phone`") || strings.Contains(query, "`bio`") || strings.Contains(query, "*")) {
+			t.Errorf("unselected columns read: %s", query)
+		}
+	}
+
+	var predicates []string
+	for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)), "\n") {
+		if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] != "dgraph.type" {
+			predicates = append(predicates, match[2])
+		}
+	}
+	slices.Sort(predicates)
+	if want := []string{"users.email", "users.name"}; !slices.Equal(predicates, want) {
+		t.Errorf("RDF predicates = %v, want %v", predicates, want)
+	}
+
+	schema := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+	for _, column := range []string{"id", "phone", "bio"} {
+		if strings.Contains(schema, "users."+column) {
+			t.Errorf("schema declares users.%s:\n%s", column, schema)
+		}
+	}
+	for _, column := range []string{"name", "email"} {
+		if !strings.Contains(schema, "users."+column+":") {
+			t.Errorf("schema lacks users.%s:\n%s", column, schema)
+		}
+	}
+}
+
+func TestSkipGeneratedColumns(t *testing.T) {
+	tests := []struct {
+		name          string
+		skip          bool
+		virtual       []string // Virtual generated users columns
+		keyColumns    map[string][]string
+		skipped       int
+		columns       []string // users columns left
+		drops         []string // Drop rules added, as table.column
+		relationships int
+	}{
+		{
+			name:          "disabled",
+			virtual:       []string{"name"},
+			columns:       []string{"email", "group_id", "id", "name"},
+			relationships: 1,
+		},
+		{
+			name:          "virtual column removed",
+			skip:          true,
+			virtual:       []string{"name"},
+			skipped:       1,
+			columns:       []string{"email", "group_id", "id"},
+			relationships: 1,
+		},
+		{
+			name:          "virtual key column kept but dropped",
+			skip:          true,
+			virtual:       []string{"email"},
+			keyColumns:    map[string][]string{"users": {"email"}},
+			skipped:       1,
+			columns:       []string{"email", "group_id", "id", "name"},
+			drops:         []string{"users.email"},
+			relationships: 1,
+		},
+		{
+			name:          "virtual foreign key loses its edge",
+			skip:          true,
+			virtual:       []string{"group_id"},
+			skipped:       1,
+			columns:       []string{"email", "id", "name"},
+			relationships: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.SkipGeneratedColumns = tt.skip
+			cfg.Output.KeyColumns = tt.keyColumns
+			schema := fkSchema(map[string][]string{"users": {"name", "email", "group_id"}, "groups": nil},
+				[][3]string{{"users", "group_id", "groups"}})
+			// A stored generated column is always kept
+			schema.Tables["users"].Columns["slug"] = &Column{Name: "slug", Type: "varchar", Generated: true}
+			for _, columnName := range tt.virtual {
+				column := schema.Tables["users"].Columns[columnName]
+				column.Generated, column.Virtual = true, true
+			}
+
+			if skipped := skipGeneratedColumns(cfg, schema); skipped != tt.skipped {
+				t.Errorf("skipped %d columns, want %d", skipped, tt.skipped)
+			}
+			var got []string
+			for columnName := range schema.Tables["users"].Columns {
+				if columnName != "slug" {
+					got = append(got, columnName)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.columns) {
+				t.Errorf("users columns = %v, want %v", got, tt.columns)
+			}
+			if schema.Tables["users"].Columns["slug"] == nil {
+				t.Error("stored generated column removed")
+			}
+			var drops []string
+			for column, rule := range cfg.Pipeline.ColumnRules {
+				if rule == "drop" {
+					drops = append(drops, column)
+				}
+			}
+			slices.Sort(drops)
+			if !slices.Equal(drops, tt.drops) {
+				t.Errorf("drop rules = %v, want %v", drops, tt.drops)
+			}
+			if len(schema.Relationships) != tt.relationships {
+				t.Errorf("relationships = %+v, want %d", schema.Relationships, tt.relationships)
+			}
+		})
+	}
+}
+
+// TestGeneratedColumnsExport exports a table with a stored and a virtual
+// generated column and checks only the virtual one is left out, and only
+// when skip_generated_columns is set
+func TestGeneratedColumnsExport(t *testing.T) {
+	tests := []struct {
+		skip       bool
+		predicates []string
+	}{
+		{skip: false, predicates: []string{"users.full_name", "users.name", "users.name_length"}},
+		{skip: true, predicates: []string{"users.name", "users.name_length"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("skip=%v", tt.skip), func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			cfg.Pipeline.SkipValidation = true
+			cfg.Pipeline.SkipGeneratedColumns = tt.skip
+			info := &infoSchema{
+				columns: map[string][]fakeColumn{"users": {
+					{name: "id", dataType: "int", columnType: "int"},
+					{name: "name", dataType: "varchar", columnType: "varchar(50)"},
+					{name: "full_name", dataType: "varchar", columnType: "varchar(60)",
+						extra: "VIRTUAL GENERATED", generation: "concat(`name`,_utf8mb4' (user)')"},
+					{name: "name_length", dataType: "int", columnType: "int",
+						extra: "STORED GENERATED", generation: "char_length(`name`)"},
+				}},
+				primaryKeys: map[string][]string{"users": {"id"}},
+				rows: map[string]*fakeTable{"users": {
+					columns: []string{"id", "name", "full_name", "name_length"},
+					rows:    [][]driver.Value{{int64(1), "Ada", "Ada (user)", int64(3)}},
+				}},
+			}
+			db, fake := newFakeDB(t, info.serve)
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+			if _, err := p.Run(context.Background(), ModeFull, RunOptions{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			var predicates []string
+			for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)), "\n") {
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] != "dgraph.type" && match[2] != "users.id" {
+					predicates = append(predicates, match[2])
+				}
+			}
+			slices.Sort(predicates)
+			if !slices.Equal(predicates, tt.predicates) {
+				t.Errorf("RDF predicates = %v, want %v", predicates, tt.predicates)
+			}
+			if !tt.skip {
+				return
+			}
+			for _, query := range fake.Queries() {
+				if strings.Contains(query, "FROM `users`") && strings.Contains(query, "`full_name`") {
+					t.Errorf("virtual column read: %s", query)
+				}
+			}
+			if schema := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile)); strings.Contains(schema, "users.full_name") {
+				t.Errorf("schema declares users.full_name:\n%s", schema)
+			}
+		})
+	}
+}
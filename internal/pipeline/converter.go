@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// Errors returned by converters for values that are dropped on purpose rather
+// than because they failed to convert
+var (
+	errInvalidDate = errors.New("invalid date")
+	errNullValue   = errors.New("value treated as NULL")
+	errOutputWrite = errors.New("output write failed")
+)
+
+// Converter turns a raw MySQL column value into output values for one Dgraph type
+type Converter interface {
+	// Convert returns the escaped body of an RDF string literal
+	Convert(raw []byte, col *Column) (string, error)
+	// ConvertJSON returns the value written to a JSON mutation
+	ConvertJSON(raw []byte, col *Column) (interface{}, error)
+}
+
+// ConverterRegistry maps Dgraph types to converters. Types without a
+// registered converter use the string converter.
+type ConverterRegistry struct {
+	mu         sync.RWMutex
+	converters map[string]Converter
+	fallback   Converter
+}
+
+// NewConverterRegistry returns a registry with the built-in converters for
+// string, int, float, bool and datetime
+func NewConverterRegistry() *ConverterRegistry {
+	r := &ConverterRegistry{
+		converters: make(map[string]Converter),
+		fallback:   stringConverter{},
+	}
+	r.Register("string", stringConverter{})
+	r.Register("int", intConverter{})
+	r.Register("float", floatConverter{})
+	r.Register("bool", boolConverter{})
+	r.Register("datetime", datetimeConverter{policy: "skip"})
+	return r
+}
+
+// Register adds or replaces the converter for a Dgraph type
+func (r *ConverterRegistry) Register(dgraphType string, converter Converter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.converters[dgraphType] = converter
+}
+
+// Lookup returns the converter for a Dgraph type
+func (r *ConverterRegistry) Lookup(dgraphType string) Converter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if converter, ok := r.converters[dgraphType]; ok {
+		return converter
+	}
+	return r.fallback
+}
+
+// ForColumn returns the converter for a column's effective Dgraph type. An
+// unknown column (nil) is converted as a string.
+func (r *ConverterRegistry) ForColumn(cfg *config.Config, tableName string, column *Column) Converter {
+	if column == nil {
+		return r.fallback
+	}
+	return r.Lookup(columnDgraphType(cfg, tableName, column))
+}
+
+// columnDgraphType returns the Dgraph type for a column after applying the
+// column_rules, boolean_columns and decimal_as_string options
+func columnDgraphType(cfg *config.Config, tableName string, column *Column) string {
+	switch cfg.Pipeline.ColumnRule(tableName, column.Name) {
+	case "hash", "redact":
+		return "string"
+	}
+	if cfg.Output.IsBooleanColumn(tableName, column.Name) {
+		return "bool"
+	}
+	if cfg.MySQL.DecimalAsString && IsDecimalType(column.Type) {
+		return "string"
+	}
+	return MySQLToDgraphType(column.FullType())
+}
+
+// stringConverter escapes text. DECIMAL values stored as strings keep their
+// exact digits in plain notation.
+type stringConverter struct{}
+
+func (stringConverter) Convert(raw []byte, col *Column) (string, error) {
+	return escapeRDFLiteral(stringValue(raw, col)), nil
+}
+
+func (stringConverter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	return stringValue(raw, col), nil
+}
+
+func stringValue(raw []byte, col *Column) string {
+	if col != nil && IsDecimalType(col.Type) {
+		return formatDecimal(string(raw))
+	}
+	return string(raw)
+}
+
+// base64Converter encodes the raw bytes of BINARY and BLOB columns, which
+// are not valid UTF-8 in general, as a base64 string
+type base64Converter struct{}
+
+func (base64Converter) Convert(raw []byte, col *Column) (string, error) {
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func (base64Converter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// isBase64Column reports whether a column's values are base64-encoded: a
+// BINARY or BLOB column whose bytes are not replaced by a hash or redact rule
+func isBase64Column(cfg *config.Config, tableName string, column *Column) bool {
+	return column != nil && IsBinaryType(column.Type) && cfg.Pipeline.ColumnRule(tableName, column.Name) == ""
+}
+
+// intConverter validates integers
+type intConverter struct{}
+
+func (intConverter) Convert(raw []byte, col *Column) (string, error) {
+	n, err := parseInt(raw)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func (intConverter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	return parseInt(raw)
+}
+
+func parseInt(raw []byte) (int64, error) {
+	text := strings.TrimSpace(string(raw))
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		// BIGINT UNSIGNED values above MaxInt64 cannot be stored in a Dgraph int
+		return 0, fmt.Errorf("%q is not a 64-bit integer", text)
+	}
+	return n, nil
+}
+
+// floatConverter validates floats, writing DECIMAL values in plain notation
+type floatConverter struct{}
+
+func (floatConverter) Convert(raw []byte, col *Column) (string, error) {
+	text := strings.TrimSpace(stringValue(raw, col))
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		return "", fmt.Errorf("%q is not a number", text)
+	}
+	return text, nil
+}
+
+func (floatConverter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	text := strings.TrimSpace(string(raw))
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", text)
+	}
+	return f, nil
+}
+
+// boolConverter accepts MySQL's 0/1 as well as common boolean spellings
+type boolConverter struct{}
+
+func (boolConverter) Convert(raw []byte, col *Column) (string, error) {
+	value, ok := toBoolLiteral(string(raw))
+	if !ok {
+		return "", fmt.Errorf("%q is not a boolean", raw)
+	}
+	return value, nil
+}
+
+func (boolConverter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	value, ok := toBoolLiteral(string(raw))
+	if !ok {
+		return nil, fmt.Errorf("%q is not a boolean", raw)
+	}
+	return value == "true", nil
+}
+
+// datetimeConverter formats MySQL DATE, DATETIME and TIMESTAMP text as
+// RFC 3339, reading values without an offset in mysql.default_timezone.
+// Values MySQL accepts but that are not real dates, such as 0000-00-00 or
+// 2023-02-30, are handled by mysql.invalid_date_policy.
+type datetimeConverter struct {
+	policy   string         // skip, null, epoch or string
+	location *time.Location // Zone of values without an offset; nil means UTC
+}
+
+// datetimeLayouts are the text forms MySQL returns for date and time columns
+var datetimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+func (c datetimeConverter) Convert(raw []byte, col *Column) (string, error) {
+	value, err := c.convert(raw)
+	if err != nil {
+		return "", err
+	}
+	return escapeRDFLiteral(value), nil
+}
+
+func (c datetimeConverter) ConvertJSON(raw []byte, col *Column) (interface{}, error) {
+	return c.convert(raw)
+}
+
+func (c datetimeConverter) convert(raw []byte) (string, error) {
+	text := strings.TrimSpace(string(raw))
+	if t, ok := parseDatetimeIn(text, c.location); ok {
+		return t.Format(time.RFC3339Nano), nil
+	}
+
+	switch c.policy {
+	case "null":
+		return "", errNullValue
+	case "epoch":
+		return time.Unix(0, 0).UTC().Format(time.RFC3339Nano), nil
+	case "string":
+		return text, nil
+	default:
+		return "", fmt.Errorf("%w %q", errInvalidDate, text)
+	}
+}
+
+// xsdTypes maps Dgraph types to the XSD datatypes of typed RDF literals
+var xsdTypes = map[string]string{
+	"int":      "xs:int",
+	"float":    "xs:float",
+	"bool":     "xs:boolean",
+	"datetime": "xs:dateTime",
+}
+
+// typedLiteral returns the RDF literal for a converted value, annotated with
+// the XSD datatype of its Dgraph type. Dates kept as text by
+// invalid_date_policy string are not in xs:dateTime form and stay plain.
+func typedLiteral(dgraphType, body string) string {
+	xsdType, ok := xsdTypes[dgraphType]
+	if !ok {
+		return `"` + body + `"`
+	}
+	if dgraphType == "datetime" {
+		if _, err := time.Parse(time.RFC3339Nano, body); err != nil {
+			return `"` + body + `"`
+		}
+	}
+	return fmt.Sprintf(`"%s"^^<%s>`, body, xsdType)
+}
+
+// toBoolLiteral normalizes a boolean-like value to "true" or "false"
+func toBoolLiteral(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "t", "yes", "y", "on":
+		return "true", true
+	case "0", "false", "f", "no", "n", "off":
+		return "false", true
+	}
+
+	// Treat any other numeric value as a C-style boolean
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatBool(n != 0), true
+	}
+	return "", false
+}
+
+// escapeRDFLiteral escapes a value for use inside a quoted RDF literal
+func escapeRDFLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, "\r", `\r`)
+	value = strings.ReplaceAll(value, "\t", `\t`)
+	return value
+}
+
+// skipReason classifies a conversion error for skip accounting
+func skipReason(err error) SkipReason {
+	switch {
+	case errors.Is(err, errNullValue):
+		return SkipNullValue
+	case errors.Is(err, errInvalidDate):
+		return SkipInvalidDate
+	default:
+		return SkipConversionFailed
+	}
+}
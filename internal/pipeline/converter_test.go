@@ -0,0 +1,373 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+func TestConverters(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	decimal := &Column{Name: "price", Type: "decimal", ColumnType: "decimal(10,2)"}
+
+	tests := []struct {
+		name      string
+		converter Converter
+		raw       string
+		col       *Column
+		rdf       string      // Body of the RDF literal
+		json      interface{} // Value of the JSON mutation
+		err       error       // Wrapped error, or errConversion for any other
+	}{
+		{name: "string", converter: stringConverter{}, raw: "Ada", rdf: "Ada", json: "Ada"},
+		{name: "string with quotes and newlines", converter: stringConverter{}, raw: "say \"hi\"\n\tback\\slash",
+			rdf: `say \"hi\"\n\tback\\slash`, json: "say \"hi\"\n\tback\\slash"},
+		{name: "decimal as string", converter: stringConverter{}, raw: "1.5E3", col: decimal, rdf: "1500", json: "1500"},
+		{name: "int", converter: intConverter{}, raw: " 42 ", rdf: "42", json: int64(42)},
+		{name: "negative int", converter: intConverter{}, raw: "-7", rdf: "-7", json: int64(-7)},
+		{name: "unsigned bigint beyond int64", converter: intConverter{}, raw: "18446744073709551615", err: errConversion},
+		{name: "int from text", converter: intConverter{}, raw: "seven", err: errConversion},
+		{name: "float", converter: floatConverter{}, raw: "2.5", rdf: "2.5", json: 2.5},
+		{name: "decimal float in plain notation", converter: floatConverter{}, raw: "-1E-6", col: decimal, rdf: "-0.000001", json: -0.000001},
+		{name: "float from text", converter: floatConverter{}, raw: "n/a", err: errConversion},
+		{name: "bool from 1", converter: boolConverter{}, raw: "1", rdf: "true", json: true},
+		{name: "bool from no", converter: boolConverter{}, raw: "no", rdf: "false", json: false},
+		{name: "bool from another number", converter: boolConverter{}, raw: "7", rdf: "true", json: true},
+		{name: "bool from text", converter: boolConverter{}, raw: "maybe", err: errConversion},
+		{name: "datetime", converter: datetimeConverter{policy: "skip"}, raw: "2024-03-01 12:30:00",
+			rdf: "2024-03-01T12:30:00Z", json: "2024-03-01T12:30:00Z"},
+		{name: "date", converter: datetimeConverter{policy: "skip"}, raw: "2024-03-01",
+			rdf: "2024-03-01T00:00:00Z", json: "2024-03-01T00:00:00Z"},
+		{name: "datetime in the default time zone", converter: datetimeConverter{policy: "skip", location: newYork},
+			raw: "2024-03-01 12:30:00.5", rdf: "2024-03-01T12:30:00.5-05:00", json: "2024-03-01T12:30:00.5-05:00"},
+		{name: "zero date skipped", converter: datetimeConverter{policy: "skip"}, raw: "0000-00-00", err: errInvalidDate},
+		{name: "zero date as null", converter: datetimeConverter{policy: "null"}, raw: "0000-00-00", err: errNullValue},
+		{name: "zero date as epoch", converter: datetimeConverter{policy: "epoch"}, raw: "0000-00-00",
+			rdf: "1970-01-01T00:00:00Z", json: "1970-01-01T00:00:00Z"},
+		{name: "impossible date as string", converter: datetimeConverter{policy: "string"}, raw: "2023-02-30",
+			rdf: "2023-02-30", json: "2023-02-30"},
+		{name: "binary", converter: base64Converter{}, raw: "\x00\xff\"", rdf: "AP8i", json: "AP8i"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdf, rdfErr := tt.converter.Convert([]byte(tt.raw), tt.col)
+			value, jsonErr := tt.converter.ConvertJSON([]byte(tt.raw), tt.col)
+
+			if tt.err != nil {
+				for _, err := range []error{rdfErr, jsonErr} {
+					if err == nil || (tt.err != errConversion && !errors.Is(err, tt.err)) {
+						t.Errorf("error = %v, want %v", err, tt.err)
+					}
+				}
+				if skipReason(rdfErr) != skipReason(jsonErr) {
+					t.Errorf("RDF is skipped as %s, JSON as %s", skipReason(rdfErr), skipReason(jsonErr))
+				}
+				return
+			}
+			if rdfErr != nil || jsonErr != nil {
+				t.Fatalf("Convert: %v, ConvertJSON: %v", rdfErr, jsonErr)
+			}
+			if rdf != tt.rdf {
+				t.Errorf("Convert = %q, want %q", rdf, tt.rdf)
+			}
+			if value != tt.json {
+				t.Errorf("ConvertJSON = %#v, want %#v", value, tt.json)
+			}
+		})
+	}
+}
+
+// errConversion stands for any conversion failure in TestConverters
+var errConversion = errors.New("conversion failed")
+
+func TestConverterRegistry(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Pipeline.ColumnRules = map[string]string{"users.age": "hash"}
+	cfg.Output.BooleanColumns = []string{"users.flag"}
+
+	tests := []struct {
+		name   string
+		column *Column
+		decStr bool
+		want   Converter
+	}{
+		{"int column", &Column{Name: "id", Type: "int", ColumnType: "int"}, false, intConverter{}},
+		{"tinyint(1)", &Column{Name: "active", Type: "tinyint", ColumnType: "tinyint(1)"}, false, boolConverter{}},
+		{"boolean_columns", &Column{Name: "flag", Type: "int", ColumnType: "int"}, false, boolConverter{}},
+		{"hashed column", &Column{Name: "age", Type: "int", ColumnType: "int"}, false, stringConverter{}},
+		{"decimal", &Column{Name: "price", Type: "decimal", ColumnType: "decimal(10,2)"}, false, floatConverter{}},
+		{"decimal_as_string", &Column{Name: "price", Type: "decimal", ColumnType: "decimal(10,2)"}, true, stringConverter{}},
+		{"datetime", &Column{Name: "created", Type: "datetime", ColumnType: "datetime"}, false, datetimeConverter{policy: "skip"}},
+		{"unknown type", &Column{Name: "shape", Type: "geometry", ColumnType: "geometry"}, false, stringConverter{}},
+		{"unknown column", nil, false, stringConverter{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.MySQL.DecimalAsString = tt.decStr
+			if got := NewConverterRegistry().ForColumn(cfg, "users", tt.column); got != tt.want {
+				t.Errorf("ForColumn = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	registry := NewConverterRegistry()
+	registry.Register("geo", base64Converter{})
+	if got := registry.Lookup("geo"); got != (base64Converter{}) {
+		t.Errorf("Lookup(geo) = %#v after Register", got)
+	}
+}
+
+// TestRDFAndJSONAgree exports the same rows as RDF and as JSON mutations and
+// checks both carry the same values
+func TestRDFAndJSONAgree(t *testing.T) {
+	columns := []*Column{
+		{Name: "id", Type: "int", ColumnType: "int", Position: 1},
+		{Name: "name", Type: "varchar", ColumnType: "varchar(50)", Position: 2},
+		{Name: "score", Type: "double", ColumnType: "double", Position: 3},
+		{Name: "price", Type: "decimal", ColumnType: "decimal(10,2)", Position: 4},
+		{Name: "active", Type: "tinyint", ColumnType: "tinyint(1)", Position: 5},
+		{Name: "created", Type: "datetime", ColumnType: "datetime", Position: 6},
+		{Name: "avatar", Type: "blob", ColumnType: "blob", Position: 7},
+	}
+	table := &fakeTable{columns: []string{"id", "name", "score", "price", "active", "created", "avatar"}, rows: [][]driver.Value{
+		{int64(1), "Ada \"the first\"", "2.5", "12.50", int64(1), "2024-03-01 12:30:00", []byte{0, 255}},
+		{int64(2), "line\nbreak", "-1e3", "0.05", int64(0), "0000-00-00", nil},
+	}}
+	schemaFor := func() *Schema {
+		t := &Table{Name: "users", Columns: map[string]*Column{}, PrimaryKeys: []string{"id"}}
+		for _, col := range columns {
+			copied := *col
+			t.Columns[col.Name] = &copied
+		}
+		return &Schema{Tables: map[string]*Table{"users": t}}
+	}
+
+	rdfCfg := testConfig(t)
+	rdf := make(map[string]interface{}) // subject predicate -> value, typed like JSON
+	for _, line := range processRDF(t, rdfCfg, schemaFor(), map[string]*fakeTable{"users": table}) {
+		match := literalPattern.FindStringSubmatch(line)
+		if match == nil || match[2] == "dgraph.type" {
+			continue
+		}
+		rdf[match[1]+" "+match[2]] = rdfJSONValue(t, match[3], match[4])
+	}
+
+	jsonCfg := testConfig(t)
+	jsonCfg.Output.Format = "json"
+	db, _ := newFakeDB(t, tablesHandler(map[string]*fakeTable{"users": table}))
+	schema := schemaFor()
+	schema.Tables["users"].RowCount = int64(len(table.rows))
+	if err := testProcessor(jsonCfg).ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+		t.Fatalf("ProcessTables: %v", err)
+	}
+	got := make(map[string]interface{})
+	files, _ := filepath.Glob(filepath.Join(jsonCfg.Output.Directory, "batch_*.json"))
+	if len(files) == 0 {
+		t.Fatal("no JSON batch files written")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mutation struct {
+			Set []map[string]interface{} `json:"set"`
+		}
+		if err := json.Unmarshal(data, &mutation); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range mutation.Set {
+			for predicate, value := range node {
+				if predicate != "uid" && predicate != "dgraph.type" {
+					got[fmt.Sprintf("%s %s", node["uid"], predicate)] = value
+				}
+			}
+		}
+	}
+
+	// Seven values of the first row; the second has no avatar and a zero date
+	if len(rdf) != 12 || len(got) != 12 {
+		t.Errorf("RDF has %d values, JSON %d, want 12", len(rdf), len(got))
+	}
+	for key, want := range rdf {
+		if got[key] != want {
+			t.Errorf("%s: JSON has %#v, RDF %#v", key, got[key], want)
+		}
+	}
+	// The zero date is skipped by both
+	if _, ok := rdf["_:users_2 users.created"]; ok {
+		t.Error("RDF has the zero date")
+	}
+}
+
+// literalPattern matches a literal triple: subject, predicate, the body of
+// the literal and its datatype, if any
+var literalPattern = regexp.MustCompile(`^(\S+) <([^>]+)> "(.*)"(?:\^\^<([^>]+)>)? \.$`)
+
+// rdfJSONValue decodes the body of an RDF literal into the value
+// encoding/json decodes its JSON counterpart to
+func rdfJSONValue(t *testing.T, body, xsdType string) interface{} {
+	t.Helper()
+	value := unescapeRDFValue(body)
+	switch xsdType {
+	case "xs:int", "xs:float":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("literal %q: %v", body, err)
+		}
+		return n
+	case "xs:boolean":
+		return value == "true"
+	}
+	return value
+}
+
+func TestDatetimeTimezone(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		raw      string
+		want     string // "" when the value is skipped
+	}{
+		{"zero datetime", "UTC", "0000-00-00 00:00:00", ""},
+		{"zero date", "Europe/Berlin", "0000-00-00", ""},
+		{"naive datetime in UTC", "UTC", "2021-06-01 13:00:00", "2021-06-01T13:00:00Z"},
+		{"naive datetime without a zone", "", "2021-06-01 13:00:00", "2021-06-01T13:00:00Z"},
+		{"naive datetime in Berlin summer", "Europe/Berlin", "2021-06-01 13:00:00", "2021-06-01T13:00:00+02:00"},
+		{"naive datetime in Berlin winter", "Europe/Berlin", "2021-01-01 13:00:00", "2021-01-01T13:00:00+01:00"},
+		{"naive datetime in Kolkata", "Asia/Kolkata", "2021-06-01 13:00:00", "2021-06-01T13:00:00+05:30"},
+		{"fractional seconds", "UTC", "2021-06-01 13:00:00.123456", "2021-06-01T13:00:00.123456Z"},
+		{"fractional seconds in New York", "America/New_York", "2021-06-01 13:00:00.123456", "2021-06-01T13:00:00.123456-04:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.MySQL.DefaultTimezone = tt.timezone
+			location, err := cfg.MySQL.Location()
+			if err != nil {
+				t.Skipf("no time zone database: %v", err)
+			}
+			got, err := datetimeConverter{policy: "skip", location: location}.Convert([]byte(tt.raw), nil)
+			if tt.want == "" {
+				if !errors.Is(err, errInvalidDate) {
+					t.Errorf("Convert(%q) = %q, %v; want it skipped as an invalid date", tt.raw, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Convert(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestDefaultTimezoneExport checks the data phase reads naive DATETIME values
+// in mysql.default_timezone and drops zero dates
+func TestDefaultTimezoneExport(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MySQL.DefaultTimezone = "Asia/Tokyo"
+	if _, err := cfg.MySQL.Location(); err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	schema := &Schema{Tables: map[string]*Table{"events": {
+		Name: "events",
+		Columns: map[string]*Column{
+			"id":      {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+			"created": {Name: "created", Type: "datetime", ColumnType: "datetime(6)", Position: 2},
+		},
+		PrimaryKeys: []string{"id"},
+	}}}
+	lines := processRDF(t, cfg, schema, map[string]*fakeTable{"events": {columns: []string{"id", "created"}, rows: [][]driver.Value{
+		{int64(1), "2021-06-01 13:00:00.123456"},
+		{int64(2), "0000-00-00 00:00:00"},
+	}}})
+
+	var created []string
+	for _, line := range lines {
+		if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "events.created" {
+			created = append(created, match[1]+" "+match[3])
+		}
+	}
+	if want := []string{"_:events_1 2021-06-01T13:00:00.123456+09:00"}; !slices.Equal(created, want) {
+		t.Errorf("created = %v, want %v", created, want)
+	}
+}
+
+// TestBinaryColumns exports a BLOB of bytes that are not valid UTF-8 under
+// each mysql.binary_policy
+func TestBinaryColumns(t *testing.T) {
+	avatar := []byte{0xff, 0x00, 0xfe, '"', '\n', 0x80}
+	tests := []struct {
+		name    string
+		policy  string
+		rule    string // Column rule for users.avatar
+		want    string // The avatar triple's value; "" for none
+		comment bool   // Whether the schema notes the base64 encoding
+	}{
+		{name: "base64", policy: "base64", want: base64.StdEncoding.EncodeToString(avatar), comment: true},
+		{name: "skip", policy: "skip"},
+		{name: "redact rule wins", policy: "skip", rule: "redact", want: "***"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.BinaryPolicy = tt.policy
+			if tt.rule != "" {
+				cfg.Pipeline.ColumnRules = map[string]string{"users.avatar": tt.rule}
+			}
+			cfg.Pipeline.SkipValidation = true
+			info := shopSchema()
+			info.columns["users"] = append(info.columns["users"], fakeColumn{name: "avatar", dataType: "blob", columnType: "blob"})
+			info.rows["users"] = &fakeTable{columns: []string{"id", "name", "avatar"}, rows: [][]driver.Value{
+				{int64(1), "Ada", avatar},
+			}}
+			runPipeline(t, cfg, info, ModeFull, RunOptions{})
+
+			var values []string
+			for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)), "\n") {
+				if !utf8.ValidString(line) {
+					t.Errorf("invalid UTF-8 written: %q", line)
+				}
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "users.avatar" {
+					values = append(values, match[3])
+				}
+			}
+			switch {
+			case tt.want == "" && len(values) > 0:
+				t.Errorf("avatar triples %v, want none", values)
+			case tt.want != "" && (len(values) != 1 || values[0] != tt.want):
+				t.Errorf("avatar triples %v, want %q", values, tt.want)
+			}
+			if tt.policy == "base64" && len(values) == 1 {
+				if decoded, err := base64.StdEncoding.DecodeString(values[0]); err != nil || string(decoded) != string(avatar) {
+					t.Errorf("avatar decodes to %q, %v", decoded, err)
+				}
+			}
+
+			schema := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+			if got := strings.Contains(schema, "# users.avatar is BLOB, stored base64-encoded\nusers.avatar: string .\n"); got != tt.comment {
+				t.Errorf("schema notes base64 avatar: %v, want %v\n%s", got, tt.comment, schema)
+			}
+			if tt.want == "" && strings.Contains(schema, "users.avatar") {
+				t.Errorf("skipped column in the schema:\n%s", schema)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/expr"
+)
+
+// derivedPredicate is a predicate computed per row from an expression over
+// the row's columns
+type derivedPredicate struct {
+	Table     string     // Source table
+	Predicate string     // Full predicate name, e.g. users.full_name
+	Expr      *expr.Expr // Compiled expression
+}
+
+// compileDerivedPredicates parses output.derived_predicates and groups the
+// result by table, sorted by predicate name
+func compileDerivedPredicates(cfg *config.Config) (map[string][]derivedPredicate, error) {
+	result := make(map[string][]derivedPredicate)
+
+	for name, source := range cfg.Output.DerivedPredicates {
+		table, _, ok := strings.Cut(name, ".")
+		if !ok {
+			return nil, fmt.Errorf("derived predicate %s must be named table.predicate", name)
+		}
+
+		compiled, err := expr.Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("derived predicate %s: %w", name, err)
+		}
+
+		result[table] = append(result[table], derivedPredicate{
+			Table:     table,
+			Predicate: name,
+			Expr:      compiled,
+		})
+	}
+
+	for _, preds := range result {
+		sort.Slice(preds, func(i, j int) bool { return preds[i].Predicate < preds[j].Predicate })
+	}
+
+	return result, nil
+}
+
+// derivedRow converts a scanned row into expression values, typing numeric
+// columns as numbers so "+" adds rather than concatenates
+func derivedRow(table *Table, cols []string, values []sql.RawBytes) expr.Row {
+	row := make(expr.Row, len(cols))
+	for i, col := range cols {
+		if values[i] == nil {
+			row[col] = expr.Null
+			continue
+		}
+
+		val := string(values[i])
+		if column := table.Columns[col]; column != nil {
+			switch MySQLToDgraphType(column.FullType()) {
+			case "int", "float":
+				if n, err := strconv.ParseFloat(val, 64); err == nil {
+					row[col] = expr.NumberValue(n)
+					continue
+				}
+			}
+		}
+		row[col] = expr.StringValue(val)
+	}
+	return row
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/retry"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// DgraphSink sends the processor's triples straight to Dgraph instead of a
+// file, committing every dgraph.batch_size triples in its own transaction
+// through the importer transport: /mutate?commitNow=true over http, or
+// api.Dgraph/Query with CommitNow over grpc, as dgo's Txn.Mutate does. Blank
+// nodes are resolved to the UIDs assigned by earlier batches, so a node
+// referenced across batches is not created twice.
+type DgraphSink struct {
+	transport  importer.Transport
+	logger     *logger.Logger
+	progress   *ProgressTracker
+	batchSize  int
+	maxRetries int
+	retryDelay time.Duration
+	retries    *retry.Classifier
+
+	pending []string
+	uids    map[string]string // Blank node name (without "_:") -> assigned UID
+}
+
+func NewDgraphSink(cfg *config.Config, logger *logger.Logger, progress *ProgressTracker, transport importer.Transport, retries *retry.Classifier) *DgraphSink {
+	return &DgraphSink{
+		transport:  transport,
+		logger:     logger,
+		progress:   progress,
+		batchSize:  cfg.Dgraph.BatchSize,
+		maxRetries: cfg.Dgraph.MaxRetries,
+		retryDelay: cfg.Dgraph.RetryDelay,
+		retries:    retries,
+		uids:       make(map[string]string),
+	}
+}
+
+// Add queues triples, committing a batch whenever batch_size are pending
+func (s *DgraphSink) Add(ctx context.Context, lines []string) error {
+	for _, line := range lines {
+		s.pending = append(s.pending, line)
+		if len(s.pending) >= s.batchSize {
+			if err := s.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush commits the pending triples, retrying retryable errors up to
+// dgraph.max_retries times
+func (s *DgraphSink) Flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	batch := make([]string, len(s.pending))
+	for i, line := range s.pending {
+		batch[i] = importer.ResolveBlankNodes(line, s.uid)
+	}
+
+	var assigned map[string]string
+	err := s.retries.Do(ctx, s.maxRetries, s.retryDelay,
+		func(attempt int, err error) {
+			s.logger.Warn("Retrying mutation batch", "attempt", attempt, "error", err)
+		},
+		func() error {
+			var err error
+			assigned, err = s.transport.Mutate(ctx, batch)
+			return err
+		})
+	if err != nil {
+		return fmt.Errorf("mutation of %d triples failed: %w", len(batch), err)
+	}
+
+	for blank, uid := range assigned {
+		s.uids[blank] = uid
+	}
+	s.pending = s.pending[:0]
+
+	s.progress.mu.Lock()
+	s.progress.MutationBatches++
+	s.progress.AssignedUIDs += int64(len(assigned))
+	batches := s.progress.MutationBatches
+	s.progress.mu.Unlock()
+
+	s.logger.Debug("Committed mutation batch",
+		"batch", batches,
+		"triples", len(batch),
+		"assigned_uids", len(assigned))
+	return nil
+}
+
+// uid returns the UID an earlier batch assigned to a blank node
+func (s *DgraphSink) uid(label string) (string, bool) {
+	uid, ok := s.uids[label]
+	return uid, ok
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/retry"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// sinkTransport records mutations, assigning a new UID to every blank node
+// and failing the first failures calls with err
+type sinkTransport struct {
+	batches  [][]string
+	assigned int
+	failures int
+	err      error
+}
+
+func (f *sinkTransport) Alter(context.Context, string) error { return nil }
+
+func (f *sinkTransport) Mutate(_ context.Context, nquads []string) (map[string]string, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, f.err
+	}
+	f.batches = append(f.batches, nquads)
+	uids := make(map[string]string)
+	for _, nquad := range nquads {
+		for _, label := range importer.BlankNodes(nquad) {
+			if _, ok := uids[label]; !ok {
+				f.assigned++
+				uids[label] = fmt.Sprintf("0x%x", f.assigned)
+			}
+		}
+	}
+	return uids, nil
+}
+
+func (f *sinkTransport) Upsert(context.Context, string, []string) error { return nil }
+func (f *sinkTransport) Delete(context.Context, string, []string) error { return nil }
+func (f *sinkTransport) MutateJSON(context.Context, io.Reader) error    { return nil }
+func (f *sinkTransport) Query(context.Context, string) (json.RawMessage, error) {
+	return json.RawMessage(`{}`), nil
+}
+func (f *sinkTransport) Close() error { return nil }
+
+func TestDgraphSink(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		batchSize int
+		failures  int
+		err       error
+		batches   [][]string
+		errText   string
+	}{
+		{
+			name: "blank nodes of earlier batches become UIDs",
+			lines: []string{
+				`_:companies_9 <dgraph.type> "companies" .`,
+				`_:users_1 <users.company> _:companies_9 .`,
+				`_:users_2 <users.manager> _:users_1 .`,
+			},
+			batchSize: 1,
+			batches: [][]string{
+				{`_:companies_9 <dgraph.type> "companies" .`},
+				{`_:users_1 <users.company> <0x1> .`},
+				{`_:users_2 <users.manager> <0x2> .`},
+			},
+		},
+		{
+			name: "facets stay after a resolved object",
+			lines: []string{
+				`_:companies_9 <dgraph.type> "companies" .`,
+				`_:users_1 <users.company> _:companies_9 (since=2020-01-01T00:00:00Z, weight=0.5) .`,
+			},
+			batchSize: 1,
+			batches: [][]string{
+				{`_:companies_9 <dgraph.type> "companies" .`},
+				{`_:users_1 <users.company> <0x1> (since=2020-01-01T00:00:00Z, weight=0.5) .`},
+			},
+		},
+		{
+			name: "blank nodes in literals are left alone",
+			lines: []string{
+				`_:a <dgraph.type> "notes" .`,
+				`_:b <notes.text> "see _:a" .`,
+			},
+			batchSize: 1,
+			batches: [][]string{
+				{`_:a <dgraph.type> "notes" .`},
+				{`_:b <notes.text> "see _:a" .`},
+			},
+		},
+		{
+			name:      "retryable failures are retried",
+			lines:     []string{`_:a <name> "A" .`},
+			batchSize: 10,
+			failures:  2,
+			err:       errors.New("Transaction has been aborted. Please retry"),
+			batches:   [][]string{{`_:a <name> "A" .`}},
+		},
+		{
+			name:      "other failures stop the export",
+			lines:     []string{`_:a <name> "A" .`},
+			batchSize: 10,
+			failures:  1,
+			err:       errors.New("invalid N-Quad"),
+			errText:   "mutation of 1 triples failed: invalid N-Quad",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Dgraph.BatchSize = tt.batchSize
+			cfg.Dgraph.RetryDelay = 0
+			transport := &sinkTransport{failures: tt.failures, err: tt.err}
+			sink := NewDgraphSink(cfg, logger.New("error", "text"), &ProgressTracker{}, transport, retry.NewClassifier(cfg.Retry))
+
+			err := sink.Add(context.Background(), tt.lines)
+			if err == nil {
+				err = sink.Flush(context.Background())
+			}
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sink failed: %v", err)
+			}
+			if fmt.Sprint(transport.batches) != fmt.Sprint(tt.batches) {
+				t.Errorf("batches = %q, want %q", transport.batches, tt.batches)
+			}
+		})
+	}
+}
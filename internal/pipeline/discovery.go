@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// discoveryExamples is how many matched and unmatched sample values a
+// discovered relationship lists
+const discoveryExamples = 5
+
+// DiscoveredRelationship is the best-scoring target of one column, with the
+// evidence a reviewer needs to accept or reject it
+type DiscoveredRelationship struct {
+	Table             string   `json:"table"`
+	Column            string   `json:"column"`
+	Target            string   `json:"target"`
+	TargetColumn      string   `json:"target_column"`
+	Confidence        float64  `json:"confidence"`
+	SampledValues     int      `json:"sampled_values"`
+	MatchedValues     int      `json:"matched_values"`
+	MatchedExamples   []string `json:"matched_examples,omitempty"`
+	UnmatchedExamples []string `json:"unmatched_examples,omitempty"`
+	Accepted          bool     `json:"accepted"` // Reaches pipeline.relationship_confidence
+
+	// Existing key on the column: declared, convention or data (empty = none)
+	Existing       string `json:"existing,omitempty"`
+	ExistingTarget string `json:"existing_target,omitempty"`
+	// new (no existing key), agrees or disagrees with the existing key
+	Agreement string `json:"agreement"`
+}
+
+// RelationshipDiscovery is the result of discover-relationships mode
+type RelationshipDiscovery struct {
+	Relationships []DiscoveredRelationship `json:"relationships"`
+	Candidates    int                      `json:"candidates"` // Columns considered
+	Evaluated     int                      `json:"evaluated"`  // Columns sampled before the time budget ran out
+}
+
+// DiscoverRelationships scores every FK-named or related column of the given
+// tables against each table it could reference, whether or not a key is
+// already known, and reports the best target of each
+func (da *DataAnalyzer) DiscoverRelationships(ctx context.Context, schema *Schema, tables []string) *RelationshipDiscovery {
+	selected := make(map[string]bool, len(tables))
+	for _, tableName := range tables {
+		selected[tableName] = true
+	}
+	candidates := da.findCandidates(schema, selected)
+	report := &RelationshipDiscovery{Candidates: len(candidates)}
+
+	if budget := da.cfg.Pipeline.AnalysisTimeBudget; budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	var mu sync.Mutex
+	report.Evaluated = da.forEachCandidate(ctx, candidates, func(candidate analysisCandidate) {
+		best, sample, ok := da.scoreCandidate(ctx, schema, candidate)
+		if !ok {
+			return
+		}
+		found := discovered(best, sample, candidate.known)
+		found.Accepted = best.MatchedValues > 0 && best.Confidence >= da.cfg.Pipeline.RelationshipConfidence
+
+		mu.Lock()
+		report.Relationships = append(report.Relationships, found)
+		mu.Unlock()
+	})
+
+	if ctx.Err() != nil {
+		da.logger.Warn("Relationship discovery stopped early, returning partial results",
+			"evaluated", report.Evaluated,
+			"candidates", len(candidates))
+	}
+
+	sort.Slice(report.Relationships, func(i, j int) bool {
+		a, b := report.Relationships[i], report.Relationships[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Column < b.Column
+	})
+	return report
+}
+
+// discovered builds the report entry for a scored column
+func discovered(best DataRelationship, sample valueSample, known *ForeignKey) DiscoveredRelationship {
+	found := DiscoveredRelationship{
+		Table:         best.TableName,
+		Column:        best.ColumnName,
+		Target:        best.RefTableName,
+		TargetColumn:  best.RefColumnName,
+		Confidence:    best.Confidence,
+		SampledValues: best.SampledValues,
+		MatchedValues: best.MatchedValues,
+		Agreement:     "new",
+	}
+
+	matched := make(map[string]bool, len(sample.matched))
+	for _, value := range sample.matched {
+		matched[value] = true
+	}
+	for _, value := range sample.values {
+		switch {
+		case matched[value] && len(found.MatchedExamples) < discoveryExamples:
+			found.MatchedExamples = append(found.MatchedExamples, value)
+		case !matched[value] && len(found.UnmatchedExamples) < discoveryExamples:
+			found.UnmatchedExamples = append(found.UnmatchedExamples, value)
+		}
+	}
+
+	if known != nil {
+		found.Existing = known.Inferred
+		if found.Existing == "" {
+			found.Existing = "declared"
+		}
+		found.ExistingTarget = known.RefTableName
+		found.Agreement = "disagrees"
+		if known.RefTableName == best.RefTableName {
+			found.Agreement = "agrees"
+		}
+	}
+	return found
+}
+
+// WriteText writes the discovered relationships, one block per column
+func (d *RelationshipDiscovery) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Relationship discovery: %d of %d candidate columns evaluated\n", d.Evaluated, d.Candidates)
+	for _, r := range d.Relationships {
+		verdict := "rejected"
+		if r.Accepted {
+			verdict = "accepted"
+		}
+		fmt.Fprintf(w, "%s.%s -> %s.%s  confidence %.2f (%d/%d)  %s, %s",
+			r.Table, r.Column, r.Target, r.TargetColumn, r.Confidence, r.MatchedValues, r.SampledValues, verdict, r.Agreement)
+		if r.Existing != "" {
+			fmt.Fprintf(w, " with %s key to %s", r.Existing, r.ExistingTarget)
+		}
+		fmt.Fprintln(w)
+		if len(r.UnmatchedExamples) > 0 {
+			fmt.Fprintf(w, "  unmatched: %v\n", r.UnmatchedExamples)
+		}
+	}
+}
+
+// DiscoverRelationships runs only the data analyzer over the selected tables
+// and writes its report as JSON to output.discovery_report_file
+func (p *Pipeline) DiscoverRelationships(tables string) (*RelationshipDiscovery, error) {
+	schema, err := p.loadSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract schema: %w", err)
+	}
+	tablesToProcess := p.determineTablesToProcess(schema, tables)
+
+	report := p.analyzer.DiscoverRelationships(p.ctx, schema, tablesToProcess)
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode relationship discovery: %w", err)
+	}
+	if err := os.MkdirAll(p.cfg.Output.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	reportPath := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.DiscoveryReportFile)
+	if err := os.WriteFile(reportPath, encoded, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write relationship discovery: %w", err)
+	}
+
+	accepted, disagreements := 0, 0
+	for _, r := range report.Relationships {
+		if r.Accepted {
+			accepted++
+		}
+		if r.Agreement == "disagrees" {
+			disagreements++
+		}
+	}
+	p.logger.Info("Relationship discovery written",
+		"file", reportPath,
+		"candidates", report.Candidates,
+		"scored", len(report.Relationships),
+		"accepted", accepted,
+		"disagreements", disagreements)
+	return report, nil
+}
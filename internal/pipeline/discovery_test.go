@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestDiscoverRelationships(t *testing.T) {
+	clients := &fakeTable{columns: []string{"id"}}
+	for id := 100; id < 110; id++ {
+		clients.rows = append(clients.rows, []driver.Value{int64(id)})
+	}
+	tests := []struct {
+		name       string
+		confidence float64
+		known      *ForeignKey // Key already on orders.buyer_id
+		buyers     []interface{}
+		want       DiscoveredRelationship
+	}{
+		{
+			name:       "new and accepted",
+			confidence: 0.75,
+			buyers:     []interface{}{int64(1), int64(50), int64(2), int64(3), nil},
+			want: DiscoveredRelationship{Target: "customers", Confidence: 0.75, SampledValues: 4, MatchedValues: 3,
+				MatchedExamples: []string{"1", "2", "3"}, UnmatchedExamples: []string{"50"}, Accepted: true, Agreement: "new"},
+		},
+		{
+			name:       "below relationship_confidence",
+			confidence: 0.9,
+			buyers:     []interface{}{int64(1), int64(50), int64(2), int64(3)},
+			want: DiscoveredRelationship{Target: "customers", Confidence: 0.75, SampledValues: 4, MatchedValues: 3,
+				MatchedExamples: []string{"1", "2", "3"}, UnmatchedExamples: []string{"50"}, Agreement: "new"},
+		},
+		{
+			name:       "agrees with a declared key",
+			confidence: 0.9,
+			known:      &ForeignKey{TableName: "orders", ColumnName: "buyer_id", RefTableName: "customers", RefColumnName: "id"},
+			buyers:     []interface{}{int64(1), int64(2)},
+			want: DiscoveredRelationship{Target: "customers", Confidence: 1, SampledValues: 2, MatchedValues: 2,
+				MatchedExamples: []string{"1", "2"}, Accepted: true, Existing: "declared", ExistingTarget: "customers", Agreement: "agrees"},
+		},
+		{
+			name:       "disagrees with a convention key",
+			confidence: 0.9,
+			known: &ForeignKey{TableName: "orders", ColumnName: "buyer_id", RefTableName: "customers", RefColumnName: "id",
+				Inferred: "convention"},
+			buyers: []interface{}{int64(100), int64(101)},
+			want: DiscoveredRelationship{Target: "clients", Confidence: 1, SampledValues: 2, MatchedValues: 2,
+				MatchedExamples: []string{"100", "101"}, Accepted: true, Existing: "convention", ExistingTarget: "customers",
+				Agreement: "disagrees"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.RelationshipConfidence = tt.confidence
+			handler := &analysisHandler{tables: map[string]*fakeTable{
+				"customers": idTable(10),
+				"clients":   clients,
+				"orders":    refTable("buyer_id", tt.buyers...),
+			}}
+			db, _ := newFakeDB(t, handler.serve)
+			schema := fkSchema(map[string][]string{"customers": nil, "clients": nil, "orders": {"buyer_id"}}, nil)
+			if tt.known != nil {
+				schema.Relationships = []ForeignKey{*tt.known}
+			}
+
+			analyzer := NewDataAnalyzer(db, cfg, logger.New("error", "text"), nil)
+			report := analyzer.DiscoverRelationships(context.Background(), schema, []string{"orders"})
+			if report.Candidates != 1 || report.Evaluated != 1 || len(report.Relationships) != 1 {
+				t.Fatalf("report %+v, want one relationship of one candidate", report)
+			}
+			want := tt.want
+			want.Table, want.Column, want.TargetColumn = "orders", "buyer_id", "id"
+			if got := report.Relationships[0]; !reflect.DeepEqual(got, want) {
+				t.Errorf("discovered %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestDiscoverRelationshipsMode runs discover-relationships mode and checks
+// the report is written as JSON and text without exporting anything
+func TestDiscoverRelationshipsMode(t *testing.T) {
+	info := shopSchema()
+	info.foreignKeys = nil
+	// Order ids that no user_id could match
+	for i, row := range info.rows["orders"].rows {
+		row[0] = int64(11 + i)
+	}
+	analysis := &analysisHandler{tables: info.rows}
+	handler := func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		if distinctPattern.MatchString(query) {
+			return analysis.serve(query, args)
+		}
+		return info.serve(query, args)
+	}
+
+	cfg := testConfig(t)
+	cfg.MySQL.Database = "shop"
+	cfg.Pipeline.RelationshipConfidence = 0.5
+	db, _ := newFakeDB(t, handler)
+	p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+	if err != nil {
+		t.Fatalf("NewWithDB: %v", err)
+	}
+	defer p.Stop()
+	result, err := p.Run(context.Background(), ModeDiscoverRelationships, RunOptions{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	report := result.Discovery
+	if report == nil || len(report.Relationships) != 1 {
+		t.Fatalf("discovery %+v, want one relationship", report)
+	}
+	// orders.user_id holds 1, 2 and 9; users has ids 1 and 2
+	got := report.Relationships[0]
+	if got.Table != "orders" || got.Column != "user_id" || got.Target != "users" || got.MatchedValues != 2 || got.SampledValues != 3 ||
+		!got.Accepted || got.Existing != "convention" || got.Agreement != "agrees" {
+		t.Errorf("discovered %+v", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, cfg.Output.DiscoveryReportFile))
+	if err != nil {
+		t.Fatalf("no discovery report: %v", err)
+	}
+	var written RelationshipDiscovery
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&written, report) {
+		t.Errorf("report file %+v, want %+v", written, *report)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)); !os.IsNotExist(err) {
+		t.Errorf("discover-relationships exported data: %v", err)
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	for _, want := range []string{
+		"1 of 1 candidate columns evaluated",
+		"orders.user_id -> users.id  confidence 0.67 (2/3)  accepted, agrees with convention key to users",
+		"unmatched: [9]",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report lacks %q:\n%s", want, text.String())
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResult is the result set a fake query returns
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// fakeHandler answers one query sent to a fake database
+type fakeHandler func(query string, args []driver.NamedValue) (*fakeResult, error)
+
+// fakeDB is a database/sql connection whose queries are answered by handler
+// and recorded in order, along with the statements prepared and the
+// connections opened
+type fakeDB struct {
+	handler fakeHandler
+	prepare func(query string) // Called before a statement is prepared, if set
+
+	mu       sync.Mutex
+	queries  []string
+	prepares []string
+	connects int
+}
+
+// newFakeDB opens a *sql.DB answered by handler, closed when the test ends
+func newFakeDB(t testing.TB, handler fakeHandler) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{handler: handler}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// Queries returns the queries received so far
+func (f *fakeDB) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
+
+// Prepares returns the queries prepared so far
+func (f *fakeDB) Prepares() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prepares...)
+}
+
+// Connects returns the number of connections opened so far
+func (f *fakeDB) Connects() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connects
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	f.mu.Lock()
+	f.connects++
+	f.mu.Unlock()
+	return &fakeConn{db: f}, nil
+}
+func (f *fakeDB) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("fake driver is only opened through a connector")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if c.db.prepare != nil {
+		c.db.prepare(query)
+	}
+	c.db.mu.Lock()
+	c.db.prepares = append(c.db.prepares, query)
+	c.db.mu.Unlock()
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("fake database has no transactions")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	c.db.queries = append(c.db.queries, query)
+	c.db.mu.Unlock()
+
+	result, err := c.db.handler(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("fake database has no answer for %q", query)
+	}
+	return &fakeRows{result: result}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("fake database is read-only")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.conn.QueryContext(context.Background(), s.query, named)
+}
+
+type fakeRows struct {
+	result *fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string { return r.result.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
+
+// fakeTable holds the rows of one table, sorted by its first column
+type fakeTable struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+var limitPattern = regexp.MustCompile(`LIMIT \?( OFFSET \?)?$`)
+
+// serve answers the batch queries of the data phase: LIMIT/OFFSET pages and
+// keyset pages after a key in the first column, which must be an integer
+func (ft *fakeTable) serve(query string, args []driver.NamedValue) (*fakeResult, error) {
+	rows := ft.rows
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	if strings.Contains(query, " > ?") {
+		after, err := strconv.ParseInt(fmt.Sprint(values[0]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = values[1:]
+		var later [][]driver.Value
+		for _, row := range rows {
+			if key, _ := strconv.ParseInt(fmt.Sprint(row[0]), 10, 64); key > after {
+				later = append(later, row)
+			}
+		}
+		rows = later
+	}
+
+	match := limitPattern.FindStringSubmatch(query)
+	if match == nil {
+		return ft.project(query, rows), nil
+	}
+	limit, _ := strconv.Atoi(fmt.Sprint(values[0]))
+	offset := 0
+	if match[1] != "" {
+		offset, _ = strconv.Atoi(fmt.Sprint(values[1]))
+	}
+	offset = min(offset, len(rows))
+	return ft.project(query, rows[offset:min(offset+limit, len(rows))]), nil
+}
+
+var selectPattern = regexp.MustCompile("^SELECT (.+?) FROM ")
+
+// project returns the columns a query selects by name, in its order, or
+// every column when it selects anything else
+func (ft *fakeTable) project(query string, rows [][]driver.Value) *fakeResult {
+	all := &fakeResult{columns: ft.columns, rows: rows}
+	match := selectPattern.FindStringSubmatch(query)
+	if match == nil {
+		return all
+	}
+	var names []string
+	var indexes []int
+	for _, expr := range strings.Split(match[1], ", ") {
+		name := strings.Trim(expr, "`")
+		index := slices.Index(ft.columns, name)
+		if index < 0 || strings.Contains(name, "`") {
+			return all
+		}
+		names = append(names, name)
+		indexes = append(indexes, index)
+	}
+
+	projected := &fakeResult{columns: names}
+	for _, row := range rows {
+		values := make([]driver.Value, len(indexes))
+		for i, index := range indexes {
+			values[i] = row[index]
+		}
+		projected.rows = append(projected.rows, values)
+	}
+	return projected
+}
+
+var (
+	fromPattern   = regexp.MustCompile("FROM `([^`]+)`")
+	orphanPattern = regexp.MustCompile("^SELECT COUNT\\(\\*\\) FROM \\(SELECT `([^`]+)` AS fk FROM `([^`]+)`\\) child LEFT JOIN `([^`]+)` parent ON child.fk = parent.`([^`]+)`")
+)
+
+// orphans counts the non-empty values of column in child that no row of
+// parent holds in refColumn
+func orphans(child *fakeTable, column string, parent *fakeTable, refColumn string) int64 {
+	index, refIndex := slices.Index(child.columns, column), slices.Index(parent.columns, refColumn)
+	var count int64
+	for _, row := range child.rows {
+		if row[index] == nil || fmt.Sprint(row[index]) == "" {
+			continue
+		}
+		found := false
+		for _, parentRow := range parent.rows {
+			if fmt.Sprint(parentRow[refIndex]) == fmt.Sprint(row[index]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			count++
+		}
+	}
+	return count
+}
+
+// tablesHandler answers COUNT(*) and row queries from the table named in
+// each query's FROM clause, and the orphaned foreign key counts
+func tablesHandler(tables map[string]*fakeTable) fakeHandler {
+	return func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		if match := orphanPattern.FindStringSubmatch(query); match != nil {
+			child, parent := tables[match[2]], tables[match[3]]
+			if child == nil || parent == nil {
+				return nil, fmt.Errorf("unexpected query %s", query)
+			}
+			count := orphans(child, match[1], parent, match[4])
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{count}}}, nil
+		}
+
+		match := fromPattern.FindStringSubmatch(query)
+		if match == nil || tables[match[1]] == nil {
+			return nil, fmt.Errorf("unexpected query %s", query)
+		}
+		table := tables[match[1]]
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(len(table.rows))}}}, nil
+		}
+		return table.serve(query, args)
+	}
+}
+
+// fakeColumn is a column as information_schema.columns describes it
+type fakeColumn struct {
+	name       string
+	dataType   string
+	columnType string
+	collation  string
+	extra      string // e.g. "STORED GENERATED"
+	generation string // Generation expression of a generated column
+}
+
+// infoSchema answers the schema extractor's information_schema queries for
+// one database, and row counts from rows
+type infoSchema struct {
+	columns     map[string][]fakeColumn // Table -> columns in ordinal order
+	primaryKeys map[string][]string
+	foreignKeys []ForeignKey
+	partitions  map[string][]Partition
+	rows        map[string]*fakeTable
+}
+
+func (s *infoSchema) serve(query string, args []driver.NamedValue) (*fakeResult, error) {
+	arg := func(i int) string { return fmt.Sprint(args[i].Value) }
+	switch {
+	case strings.Contains(query, "table_type IN"):
+		result := &fakeResult{columns: []string{"table_name"}}
+		var names []string
+		for name := range s.columns {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			result.rows = append(result.rows, []driver.Value{name})
+		}
+		return result, nil
+	case strings.Contains(query, "information_schema.columns"):
+		result := &fakeResult{columns: []string{"column_name", "data_type", "column_type", "is_nullable", "column_default",
+			"auto_increment", "column_comment", "ordinal_position", "collation_name", "extra", "generation_expression"}}
+		for i, col := range s.columns[arg(1)] {
+			result.rows = append(result.rows, []driver.Value{col.name, col.dataType, col.columnType, "YES", "",
+				int64(0), "", int64(i + 1), col.collation, col.extra, col.generation})
+		}
+		return result, nil
+	case strings.Contains(query, "constraint_name = 'PRIMARY'"):
+		result := &fakeResult{columns: []string{"column_name"}}
+		for _, pk := range s.primaryKeys[arg(1)] {
+			result.rows = append(result.rows, []driver.Value{pk})
+		}
+		return result, nil
+	case strings.Contains(query, "SELECT engine"):
+		return &fakeResult{columns: []string{"engine"}, rows: [][]driver.Value{{"InnoDB"}}}, nil
+	case strings.Contains(query, "information_schema.partitions"):
+		result := &fakeResult{columns: []string{"partition_name", "table_rows"}}
+		for _, partition := range s.partitions[arg(1)] {
+			result.rows = append(result.rows, []driver.Value{partition.Name, partition.RowCount})
+		}
+		return result, nil
+	case strings.Contains(query, "referenced_table_name IS NOT NULL"):
+		result := &fakeResult{columns: []string{"constraint_name", "table_name", "column_name", "referenced_table_name",
+			"referenced_column_name", "referenced_table_schema", "update_rule", "delete_rule"}}
+		for _, fk := range s.foreignKeys {
+			result.rows = append(result.rows, []driver.Value{fk.ConstraintName, fk.TableName, fk.ColumnName, fk.RefTableName,
+				fk.RefColumnName, arg(0), "RESTRICT", "RESTRICT"})
+		}
+		return result, nil
+	case strings.Contains(query, "information_schema.statistics"):
+		return &fakeResult{columns: []string{"table_name", "index_name", "column_name", "non_unique", "index_type"}}, nil
+	}
+	return tablesHandler(s.rows)(query, args)
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestWhereClause(t *testing.T) {
+	tests := []struct {
+		filter     string
+		conditions []string
+		want       string
+	}{
+		{"", nil, ""},
+		{"deleted_at IS NULL", nil, " WHERE (deleted_at IS NULL)"},
+		{"", []string{"`id` > ?"}, " WHERE `id` > ?"},
+		{"deleted_at IS NULL", []string{"`id` > ?"}, " WHERE (deleted_at IS NULL) AND `id` > ?"},
+		// An OR in the filter stays inside its parentheses
+		{"a = 1 OR b = 2", []string{"`id` > ?"}, " WHERE (a = 1 OR b = 2) AND `id` > ?"},
+	}
+	for _, tt := range tests {
+		if got := whereClause(tt.filter, tt.conditions...); got != tt.want {
+			t.Errorf("whereClause(%q, %q) = %q, want %q", tt.filter, tt.conditions, got, tt.want)
+		}
+	}
+}
+
+// TestTableFilters exports users without their soft-deleted rows, in
+// batches of two, and checks the row counts and the RDF honor the filter
+func TestTableFilters(t *testing.T) {
+	const filter = "deleted_at IS NULL"
+	tests := []struct {
+		name    string
+		keyType string // int pages by key, varchar by OFFSET
+	}{
+		{name: "keyset pages", keyType: "int"},
+		{name: "offset pages", keyType: "varchar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			cfg.Pipeline.SkipValidation = true
+			cfg.Pipeline.BatchSize = 2
+			cfg.Pipeline.TableFilters = map[string]string{"users": filter}
+
+			columns := []string{"id", "name", "deleted_at"}
+			all := [][]driver.Value{
+				{int64(1), "Ada", nil},
+				{int64(2), "Bob", "2024-01-01 00:00:00"},
+				{int64(3), "Cy", nil},
+				{int64(4), "Di", "2024-02-01 00:00:00"},
+				{int64(5), "Ed", nil},
+			}
+			var kept [][]driver.Value
+			for _, row := range all {
+				if row[2] == nil {
+					kept = append(kept, row)
+				}
+			}
+			schema := func(rows [][]driver.Value) *infoSchema {
+				info := shopSchema()
+				info.columns["users"] = []fakeColumn{
+					{name: "id", dataType: tt.keyType, columnType: tt.keyType},
+					{name: "name", dataType: "varchar", columnType: "varchar(50)"},
+					{name: "deleted_at", dataType: "datetime", columnType: "datetime"},
+				}
+				info.rows["users"] = &fakeTable{columns: columns, rows: rows}
+				return info
+			}
+			// The fake database applies the filter by serving only the kept rows
+			unfiltered, filtered := schema(all), schema(kept)
+			db, fake := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				if strings.Contains(query, "WHERE ("+filter+")") {
+					return filtered.serve(query, args)
+				}
+				return unfiltered.serve(query, args)
+			})
+
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+			result, err := p.Run(context.Background(), ModeData, RunOptions{})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			// 3 kept users and 3 orders
+			if result.ProcessedRows != 6 || p.progress.TotalRows != 6 {
+				t.Errorf("processed %d of %d rows, want 6 of 6", result.ProcessedRows, p.progress.TotalRows)
+			}
+			for _, query := range fake.Queries() {
+				users := strings.Contains(query, "FROM `users`")
+				if users != strings.Contains(query, filter) {
+					t.Errorf("filter applied to the wrong query: %s", query)
+				}
+			}
+
+			var exported []string
+			for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)), "\n") {
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "users.name" {
+					exported = append(exported, match[3])
+				}
+			}
+			slices.Sort(exported)
+			if want := []string{"Ada", "Cy", "Ed"}; !slices.Equal(exported, want) {
+				t.Errorf("exported users %v, want %v", exported, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FingerprintCache stores per-predicate value hashes for every exported node so
+// that a later run can emit only the predicates whose values have changed
+type FingerprintCache struct {
+	mu       sync.Mutex
+	previous map[string]map[string]uint64 // node UID -> predicate -> value hash from the prior run
+	current  map[string]map[string]uint64 // node UID -> predicate -> value hash from this run
+}
+
+func NewFingerprintCache() *FingerprintCache {
+	return &FingerprintCache{
+		previous: make(map[string]map[string]uint64),
+		current:  make(map[string]map[string]uint64),
+	}
+}
+
+// LoadFingerprintCache reads a cache written by a previous run. A missing file
+// yields an empty cache so the first run performs a full export.
+func LoadFingerprintCache(path string) (*FingerprintCache, error) {
+	fc := NewFingerprintCache()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fingerprint file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// Each line has the form: <node>\t<predicate>\t<hash>
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 3 {
+			continue
+		}
+
+		hash, err := strconv.ParseUint(parts[2], 16, 64)
+		if err != nil {
+			continue
+		}
+
+		if fc.previous[parts[0]] == nil {
+			fc.previous[parts[0]] = make(map[string]uint64)
+		}
+		fc.previous[parts[0]][parts[1]] = hash
+	}
+
+	return fc, scanner.Err()
+}
+
+// Changed records the value of a predicate for this run and reports whether it
+// differs from the value seen for the same node in the previous run
+func (fc *FingerprintCache) Changed(node, predicate, value string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	hash := h.Sum64()
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.current[node] == nil {
+		fc.current[node] = make(map[string]uint64)
+	}
+	fc.current[node][predicate] = hash
+
+	prev, exists := fc.previous[node][predicate]
+	return !exists || prev != hash
+}
+
+// Removed returns the predicates a node had in the previous run that this
+// run has not recorded for it, in order. Called once a node's row has been
+// converted, they are the values that became NULL or stopped being written.
+func (fc *FingerprintCache) Removed(node string) []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	var removed []string
+	for predicate := range fc.previous[node] {
+		if _, ok := fc.current[node][predicate]; !ok {
+			removed = append(removed, predicate)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// Save writes the merged fingerprints to disk. Nodes exported in this run
+// replace their previous entries; nodes not touched are carried over as-is.
+// The file is replaced only once it is written in full.
+func (fc *FingerprintCache) Save(path string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create fingerprint file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	writer := bufio.NewWriter(file)
+
+	for node, preds := range fc.previous {
+		if _, touched := fc.current[node]; touched {
+			continue
+		}
+		for pred, hash := range preds {
+			fmt.Fprintf(writer, "%s\t%s\t%x\n", node, pred, hash)
+		}
+	}
+	for node, preds := range fc.current {
+		for pred, hash := range preds {
+			fmt.Fprintf(writer, "%s\t%s\t%x\n", node, pred, hash)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDeltaColumns(t *testing.T) {
+	first := [][]driver.Value{{int64(1), "user1"}, {int64(2), "user2"}}
+	tests := []struct {
+		name  string
+		delta bool
+		rows  [][]driver.Value // Rows of the second run
+		want  []string         // Lines the second run writes
+	}{
+		{
+			name:  "one changed column",
+			delta: true,
+			rows:  [][]driver.Value{{int64(1), "user1"}, {int64(2), "renamed"}},
+			want:  []string{`_:users_2 <users.name> "renamed" .`},
+		},
+		{
+			name:  "nothing changed",
+			delta: true,
+			rows:  first,
+		},
+		{
+			name:  "a new row is written whole",
+			delta: true,
+			rows:  [][]driver.Value{{int64(1), "user1"}, {int64(2), "user2"}, {int64(3), "user3"}},
+			want: []string{
+				`_:users_3 <dgraph.type> "users" .`,
+				`_:users_3 <users.id> "3"^^<xs:int> .`,
+				`_:users_3 <users.name> "user3" .`,
+			},
+		},
+		{
+			name: "without delta_columns every row is written",
+			rows: [][]driver.Value{{int64(1), "user1"}, {int64(2), "renamed"}},
+			want: []string{
+				`_:users_1 <dgraph.type> "users" .`,
+				`_:users_1 <users.id> "1"^^<xs:int> .`,
+				`_:users_1 <users.name> "user1" .`,
+				`_:users_2 <dgraph.type> "users" .`,
+				`_:users_2 <users.id> "2"^^<xs:int> .`,
+				`_:users_2 <users.name> "renamed" .`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.DeltaColumns = tt.delta
+			columns := []string{"id", "name"}
+
+			processRDF(t, cfg, usersSchema(2), map[string]*fakeTable{"users": {columns: columns, rows: first}})
+			got := processRDF(t, cfg, usersSchema(int64(len(tt.rows))), map[string]*fakeTable{"users": {columns: columns, rows: tt.rows}})
+
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("second run wrote\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeltaColumnsDeletesNullValues checks that a value turning NULL is
+// listed in the delete file, with the xid the importer finds the node by, and
+// that a value coming back is written again
+func TestDeltaColumnsDeletesNullValues(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.DeltaColumns = true
+	cfg.Output.EmitXID = true
+	columns := []string{"id", "name"}
+	run := func(rows ...[]driver.Value) (data, deletions []string) {
+		t.Helper()
+		data = processRDF(t, cfg, usersSchema(int64(len(rows))), map[string]*fakeTable{"users": {columns: columns, rows: rows}})
+		slices.Sort(data)
+		for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.DeleteFile)), "\n") {
+			if line != "" {
+				deletions = append(deletions, line)
+			}
+		}
+		return data, deletions
+	}
+
+	run([]driver.Value{int64(1), "user1"}, []driver.Value{int64(2), "user2"})
+
+	data, deletions := run([]driver.Value{int64(1), "user1"}, []driver.Value{int64(2), nil})
+	if len(data) != 0 {
+		t.Errorf("NULL run wrote %q, want nothing", data)
+	}
+	want := []string{`_:users_2 <xid> "users:2" .`, `_:users_2 <users.name> * .`}
+	if !slices.Equal(deletions, want) {
+		t.Errorf("NULL run deletes %q, want %q", deletions, want)
+	}
+
+	data, deletions = run([]driver.Value{int64(1), "user1"}, []driver.Value{int64(2), "back"})
+	want = []string{`_:users_2 <users.name> "back" .`, `_:users_2 <xid> "users:2" .`}
+	if !slices.Equal(data, want) {
+		t.Errorf("third run wrote %q, want %q", data, want)
+	}
+	if len(deletions) != 0 {
+		t.Errorf("third run deletes %q, want nothing", deletions)
+	}
+}
+
+func TestFingerprintCacheRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprints.txt")
+	first := NewFingerprintCache()
+	first.Changed("_:users_1", "users.name", "ann")
+	first.Changed("_:users_1", "users.email", "ann@example.com")
+	first.Changed("_:users_1", "users.phone", "555")
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := LoadFingerprintCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Changed("_:users_1", "users.name", "ann")
+	if got, want := second.Removed("_:users_1"), []string{"users.email", "users.phone"}; !slices.Equal(got, want) {
+		t.Errorf("Removed = %q, want %q", got, want)
+	}
+	if got := second.Removed("_:users_2"); len(got) != 0 {
+		t.Errorf("Removed of a new node = %q, want none", got)
+	}
+}
+
+func TestFingerprintCacheSaveReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fingerprints.txt")
+	cache := NewFingerprintCache()
+	cache.Changed("_:users_1", "users.name", "ann")
+	if err := cache.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "fingerprints.txt" {
+		t.Errorf("directory holds %v, want only fingerprints.txt", entries)
+	}
+
+	// A failed save leaves the previous file alone
+	saved := readFile(t, path)
+	cache.Changed("_:users_2", "users.name", "bob")
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(path); err == nil {
+		t.Fatal("Save succeeded without its temporary file")
+	}
+	if got := readFile(t, path); got != saved {
+		t.Errorf("fingerprints after a failed save = %q, want %q", got, saved)
+	}
+}
+
+func TestFingerprintCacheSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprints.txt")
+	first := NewFingerprintCache()
+	first.Changed("_:users_1", "users.name", "ann")
+	first.Changed("_:users_2", "users.name", "bob")
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run exports only users_1; users_2 is carried over
+	second, err := LoadFingerprintCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Changed("_:users_1", "users.name", "ann") {
+		t.Error("unchanged value reported as changed")
+	}
+	if err := second.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := LoadFingerprintCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		node, predicate, value string
+		changed                bool
+	}{
+		{"_:users_1", "users.name", "ann", false},
+		{"_:users_2", "users.name", "bob", false},
+		{"_:users_2", "users.name", "bobby", true},
+		{"_:users_2", "users.email", "b@example.com", true},
+		{"_:users_3", "users.name", "cy", true},
+	}
+	for _, tt := range tests {
+		if got := third.Changed(tt.node, tt.predicate, tt.value); got != tt.changed {
+			t.Errorf("Changed(%s, %s, %q) = %v, want %v", tt.node, tt.predicate, tt.value, got, tt.changed)
+		}
+	}
+}
+
+func TestLoadFingerprintCacheMissingFile(t *testing.T) {
+	cache, err := LoadFingerprintCache(filepath.Join(t.TempDir(), "none.txt"))
+	if err != nil {
+		t.Fatalf("LoadFingerprintCache: %v", err)
+	}
+	if !cache.Changed("_:users_1", "users.name", "ann") {
+		t.Error("first run reported a value as unchanged")
+	}
+}
@@ -2,6 +2,8 @@ package pipeline
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/sink"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
@@ -16,6 +19,7 @@ import (
 type SchemaGenerator struct {
 	cfg    *config.Config
 	logger *logger.Logger
+	names  *NameMapper // Shortens names longer than output.max_name_length
 }
 
 // PredicateInfo holds information about a predicate
@@ -27,12 +31,15 @@ type PredicateInfo struct {
 	List    bool
 	Count   bool
 	Upsert  bool
+	Lang    bool   // Values carry language tags
+	Comment string // Written on the line above the predicate
 }
 
 func NewSchemaGenerator(cfg *config.Config, logger *logger.Logger) *SchemaGenerator {
 	return &SchemaGenerator{
 		cfg:    cfg,
 		logger: logger,
+		names:  NewNameMapper(cfg.Output.MaxNameLength),
 	}
 }
 
@@ -42,18 +49,33 @@ func (sg *SchemaGenerator) Generate(schema *Schema) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Generate predicates
-	predicates := sg.generatePredicates(schema)
-
-	// Generate types
-	types := sg.generateTypes(schema, predicates)
+	predicates, types, err := sg.build(schema)
+	if err != nil {
+		return err
+	}
 
-	// Write schema file
+	// Write schema file, stored next to the data for the bulk loader
 	schemaPath := filepath.Join(sg.cfg.Output.Directory, sg.cfg.Output.SchemaFile)
-	if err := sg.writeSchemaFile(schemaPath, predicates, types); err != nil {
+	if err := sg.writeSchemaFile(sg.cfg.Output.SchemaFile, predicates, types); err != nil {
 		return fmt.Errorf("failed to write schema file: %w", err)
 	}
 
+	// Write the GraphQL schema over the same types and predicates
+	if sg.cfg.Output.GenerateGraphQL {
+		if err := sg.GenerateGraphQL(schema); err != nil {
+			return err
+		}
+	}
+
+	// Record escaped and shortened names so they can be traced back to their columns
+	if sg.names.Len() > 0 {
+		nameMapPath := filepath.Join(sg.cfg.Output.Directory, sg.cfg.Output.NameMapFile)
+		if err := sg.names.Save(nameMapPath); err != nil {
+			return fmt.Errorf("failed to write name map: %w", err)
+		}
+		sg.logger.Info("Renamed predicates and types", "count", sg.names.Len(), "file", nameMapPath)
+	}
+
 	sg.logger.Info("Dgraph schema generated successfully",
 		"predicates", len(predicates),
 		"types", len(types),
@@ -62,14 +84,77 @@ func (sg *SchemaGenerator) Generate(schema *Schema) error {
 	return nil
 }
 
-func (sg *SchemaGenerator) generatePredicates(schema *Schema) map[string]*PredicateInfo {
+// Render returns the schema file content for schema without writing it
+func (sg *SchemaGenerator) Render(schema *Schema) (string, error) {
+	predicates, types, err := sg.build(schema)
+	if err != nil {
+		return "", err
+	}
+	content, err := sg.renderSchema(predicates, types)
+	return string(content), err
+}
+
+// build collects the predicates and types of the schema file
+func (sg *SchemaGenerator) build(schema *Schema) (map[string]*PredicateInfo, map[string][]string, error) {
+	// Name the semantic reverse edges once so predicates and types agree
+	reverseNames := sg.semanticReverseNames(schema)
+
+	// Generate predicates
+	predicates := sg.generatePredicates(schema, reverseNames)
+
+	// Generate types
+	types := sg.generateTypes(schema, reverseNames)
+
+	// Declare derived predicates on their tables
+	if err := sg.addDerivedPredicates(schema, predicates, types); err != nil {
+		return nil, nil, err
+	}
+
+	// Every node carries its external ID so upserts can find it again
+	if sg.cfg.Output.EmitXID {
+		predicates[xidPredicate] = &PredicateInfo{
+			Name:   xidPredicate,
+			Type:   "string",
+			Index:  "@index(exact)",
+			Upsert: true,
+		}
+		for typeName := range types {
+			types[typeName] = append(types[typeName], xidPredicate)
+			sort.Strings(types[typeName])
+		}
+	}
+	return predicates, types, nil
+}
+
+func (sg *SchemaGenerator) generatePredicates(schema *Schema, reverseNames map[string]string) map[string]*PredicateInfo {
 	predicates := make(map[string]*PredicateInfo)
+	forwardNames := sg.forwardNames(schema)
 
 	// Generate predicates for table columns
 	for tableName, table := range schema.Tables {
+		if junction := collapsedJunction(sg.cfg, table); junction != nil {
+			// Junction rows become edges between the tables they link
+			forward, backward := junction.Predicates()
+			for _, name := range []string{forward, backward} {
+				predicates[name] = &PredicateInfo{
+					Name:  name,
+					Type:  "uid",
+					List:  true,
+					Count: true,
+				}
+			}
+			continue
+		}
+
 		for columnName, column := range table.Columns {
+			if sg.cfg.Pipeline.ColumnRule(tableName, columnName) == "drop" {
+				continue
+			}
 			predicateName := fmt.Sprintf("%s.%s", tableName, columnName)
-			dgraphType := MySQLToDgraphType(column.Type)
+			if name, ok := forwardNames[predicateName]; ok {
+				predicateName = name
+			}
+			dgraphType := sg.columnDgraphType(tableName, column)
 
 			predicate := &PredicateInfo{
 				Name: predicateName,
@@ -77,42 +162,61 @@ func (sg *SchemaGenerator) generatePredicates(schema *Schema) map[string]*Predic
 			}
 
 			// Add appropriate index
-			predicate.Index = sg.getIndexType(dgraphType, column)
+			predicate.Index = sg.getIndexType(tableName, dgraphType, column)
+
+			// SET columns hold several members, so they become a list
+			if dgraphType == "string" && IsSetType(column.Type) {
+				predicate.List = true
+			}
 
 			// Check if it's a upsert candidate (unique columns)
 			predicate.Upsert = sg.isUpsertCandidate(tableName, columnName, schema)
 
+			// Language-specific collations make the values language-tagged
+			predicate.Lang = columnLanguage(sg.cfg, tableName, column, dgraphType) != ""
+
+			if isBase64Column(sg.cfg, tableName, column) {
+				predicate.Comment = fmt.Sprintf("%s is %s, stored base64-encoded", predicateName, strings.ToUpper(column.Type))
+			}
+
 			predicates[predicateName] = predicate
 		}
 	}
 
-	// Generate predicates for foreign key relationships
-	for _, fk := range schema.Relationships {
+	// Generate predicates for foreign key relationships. Reverse edges are
+	// either explicit predicates or @reverse on the forward edge, not both.
+	manual := sg.cfg.Output.ManualReverseEdges()
+	for _, fk := range sg.relationships(schema) {
 		// Forward relationship
-		fkPredicateName := fmt.Sprintf("%s.%s", fk.TableName, fk.ColumnName)
+		fkPredicateName := ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName)
 		if pred, exists := predicates[fkPredicateName]; exists {
 			pred.Type = "uid"
-			pred.Reverse = true
+			pred.Reverse = !manual
 			pred.Index = "" // UID predicates don't need index specification
+			pred.Comment = ""
 		} else {
 			predicates[fkPredicateName] = &PredicateInfo{
 				Name:    fkPredicateName,
 				Type:    "uid",
-				Reverse: true,
+				Reverse: !manual,
 			}
 		}
 
-		// Reverse relationship (collection)
-		reversePredicateName := fmt.Sprintf("%s.%s_reverse", fk.TableName, fk.ColumnName)
-		predicates[reversePredicateName] = &PredicateInfo{
-			Name:    reversePredicateName,
-			Type:    "uid",
-			List:    true,
-			Reverse: true,
+		// Reverse relationship (collection), unless Dgraph maintains it
+		if manual {
+			reversePredicateName := ReversePredicateName(fk.TableName, fk.ColumnName, fk.RefTableName)
+			predicates[reversePredicateName] = &PredicateInfo{
+				Name: reversePredicateName,
+				Type: "uid",
+				List: true,
+			}
 		}
 
 		// Also create a semantic reverse relationship
-		semanticReverseName := fmt.Sprintf("%s.%s", fk.RefTableName, sg.pluralize(fk.TableName))
+		semanticReverseName, ok := reverseNames[fk.TableName+"."+fk.ColumnName]
+		if !ok {
+			continue
+		}
 		if _, exists := predicates[semanticReverseName]; !exists {
 			predicates[semanticReverseName] = &PredicateInfo{
 				Name:    semanticReverseName,
@@ -126,22 +230,33 @@ func (sg *SchemaGenerator) generatePredicates(schema *Schema) map[string]*Predic
 	return predicates
 }
 
-func (sg *SchemaGenerator) generateTypes(schema *Schema, predicates map[string]*PredicateInfo) map[string][]string {
+func (sg *SchemaGenerator) generateTypes(schema *Schema, reverseNames map[string]string) map[string][]string {
 	types := make(map[string][]string)
+	forwardNames := sg.forwardNames(schema)
 
 	for tableName, table := range schema.Tables {
+		if collapsedJunction(sg.cfg, table) != nil {
+			continue
+		}
+
 		var typePredicates []string
 
 		// Add column predicates
 		for columnName := range table.Columns {
+			if sg.cfg.Pipeline.ColumnRule(tableName, columnName) == "drop" {
+				continue
+			}
 			predicateName := fmt.Sprintf("%s.%s", tableName, columnName)
+			if name, ok := forwardNames[predicateName]; ok {
+				predicateName = name
+			}
 			typePredicates = append(typePredicates, predicateName)
 		}
 
 		// Add outgoing foreign key predicates
-		for _, fk := range schema.Relationships {
+		for _, fk := range sg.relationships(schema) {
 			if fk.TableName == tableName {
-				predicateName := fmt.Sprintf("%s.%s", fk.TableName, fk.ColumnName)
+				predicateName := ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName)
 				if !sg.containsString(typePredicates, predicateName) {
 					typePredicates = append(typePredicates, predicateName)
 				}
@@ -149,22 +264,36 @@ func (sg *SchemaGenerator) generateTypes(schema *Schema, predicates map[string]*
 		}
 
 		// Add incoming foreign key predicates (reverse relationships)
-		for _, fk := range schema.Relationships {
+		for _, fk := range sg.relationships(schema) {
 			if fk.RefTableName == tableName {
 				// Add reverse predicates
-				reversePredicateName := fmt.Sprintf("%s.%s_reverse", fk.TableName, fk.ColumnName)
-				if !sg.containsString(typePredicates, reversePredicateName) {
+				reversePredicateName := ReversePredicateName(fk.TableName, fk.ColumnName, fk.RefTableName)
+				if sg.cfg.Output.ManualReverseEdges() && !sg.containsString(typePredicates, reversePredicateName) {
 					typePredicates = append(typePredicates, reversePredicateName)
 				}
-
 				// Add semantic reverse relationship
-				semanticReverseName := fmt.Sprintf("%s.%s", tableName, sg.pluralize(fk.TableName))
-				if !sg.containsString(typePredicates, semanticReverseName) {
+				semanticReverseName, ok := reverseNames[fk.TableName+"."+fk.ColumnName]
+				if ok && !sg.containsString(typePredicates, semanticReverseName) {
 					typePredicates = append(typePredicates, semanticReverseName)
 				}
 			}
 		}
 
+		// Add edges from collapsed junction tables
+		for _, other := range schema.Tables {
+			junction := collapsedJunction(sg.cfg, other)
+			if junction == nil {
+				continue
+			}
+			forward, backward := junction.Predicates()
+			if junction.Left.RefTableName == tableName && !sg.containsString(typePredicates, forward) {
+				typePredicates = append(typePredicates, forward)
+			}
+			if junction.Right.RefTableName == tableName && !sg.containsString(typePredicates, backward) {
+				typePredicates = append(typePredicates, backward)
+			}
+		}
+
 		sort.Strings(typePredicates)
 		types[tableName] = typePredicates
 	}
@@ -172,15 +301,166 @@ func (sg *SchemaGenerator) generateTypes(schema *Schema, predicates map[string]*
 	return types
 }
 
-func (sg *SchemaGenerator) writeSchemaFile(filePath string, predicates map[string]*PredicateInfo, types map[string][]string) error {
-	file, err := os.Create(filePath)
+// addDerivedPredicates declares each configured derived predicate with a type
+// inferred from its expression and adds it to its table's type
+func (sg *SchemaGenerator) addDerivedPredicates(schema *Schema, predicates map[string]*PredicateInfo, types map[string][]string) error {
+	derived, err := compileDerivedPredicates(sg.cfg)
+	if err != nil {
+		return err
+	}
+
+	for tableName, preds := range derived {
+		table := schema.Tables[tableName]
+		if table == nil {
+			sg.logger.Warn("Derived predicate references unknown table", "table", tableName)
+			continue
+		}
+
+		columnType := func(columnName string) string {
+			if column := table.Columns[columnName]; column != nil {
+				return sg.columnDgraphType(tableName, column)
+			}
+			return "string"
+		}
+
+		for _, dpred := range preds {
+			dgraphType := dpred.Expr.Type(columnType)
+			_, name, _ := strings.Cut(dpred.Predicate, ".")
+
+			predicates[dpred.Predicate] = &PredicateInfo{
+				Name:  dpred.Predicate,
+				Type:  dgraphType,
+				Index: sg.getIndexType(tableName, dgraphType, &Column{Name: name}),
+			}
+			if !sg.containsString(types[tableName], dpred.Predicate) {
+				types[tableName] = append(types[tableName], dpred.Predicate)
+			}
+		}
+		sort.Strings(types[tableName])
+	}
+
+	return nil
+}
+
+// semanticReverseNames names the semantic reverse edge of each foreign key,
+// keyed by table.column: posts.comments for comments.post_id. The name is
+// suffixed with the column when it is already taken by a column, another
+// edge, or the semantic reverse of an earlier foreign key, e.g.
+// users.orders_by_seller for orders.seller_id next to orders.buyer_id.
+// Self-references already get a children predicate and are left out.
+func (sg *SchemaGenerator) semanticReverseNames(schema *Schema) map[string]string {
+	relationships := sg.relationships(schema)
+	sort.Slice(relationships, func(i, j int) bool {
+		if relationships[i].TableName != relationships[j].TableName {
+			return relationships[i].TableName < relationships[j].TableName
+		}
+		return relationships[i].ColumnName < relationships[j].ColumnName
+	})
+
+	// Predicates other than semantic reverses, and what declares them
+	sources := make(map[string]string)
+	for tableName, table := range schema.Tables {
+		if junction := collapsedJunction(sg.cfg, table); junction != nil {
+			forward, backward := junction.Predicates()
+			sources[forward] = "junction table " + tableName
+			sources[backward] = "junction table " + tableName
+			continue
+		}
+		for columnName := range table.Columns {
+			if sg.cfg.Pipeline.ColumnRule(tableName, columnName) != "drop" {
+				name := fmt.Sprintf("%s.%s", tableName, columnName)
+				sources[name] = "column " + name
+			}
+		}
+	}
+	for _, fk := range relationships {
+		sources[ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName)] =
+			fmt.Sprintf("edge of %s.%s", fk.TableName, fk.ColumnName)
+		sources[ReversePredicateName(fk.TableName, fk.ColumnName, fk.RefTableName)] =
+			fmt.Sprintf("reverse of %s.%s", fk.TableName, fk.ColumnName)
+	}
+
+	names := make(map[string]string)
+	for _, fk := range relationships {
+		if fk.TableName == fk.RefTableName {
+			continue
+		}
+		source := fmt.Sprintf("%s.%s", fk.TableName, fk.ColumnName)
+		name := fmt.Sprintf("%s.%s", fk.RefTableName, sg.pluralize(relativeTableName(fk.TableName, fk.RefTableName)))
+		if existing, taken := sources[name]; taken {
+			base := fmt.Sprintf("%s_by_%s", name, strings.TrimSuffix(strings.ToLower(fk.ColumnName), "_id"))
+			suffixed := base
+			for n := 2; sources[suffixed] != ""; n++ {
+				suffixed = fmt.Sprintf("%s%d", base, n)
+			}
+			sg.logger.Warn("Semantic reverse predicate collides, using a suffixed name",
+				"predicate", name,
+				"taken_by", existing,
+				"foreign_key", source,
+				"renamed_to", suffixed)
+			name = suffixed
+		}
+		sources[name] = "semantic reverse of " + source
+		names[source] = name
+	}
+	return names
+}
+
+// forwardNames maps the table.column of each foreign key whose edge is not
+// named after its column, i.e. self-references, to its edge predicate
+func (sg *SchemaGenerator) forwardNames(schema *Schema) map[string]string {
+	names := make(map[string]string)
+	for _, fk := range sg.relationships(schema) {
+		column := fmt.Sprintf("%s.%s", fk.TableName, fk.ColumnName)
+		if name := ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName); name != column {
+			names[column] = name
+		}
+	}
+	return names
+}
+
+// relationships returns the schema relationships, excluding columns forced to
+// bool typing so they are never emitted as uid edges
+func (sg *SchemaGenerator) relationships(schema *Schema) []ForeignKey {
+	var result []ForeignKey
+	for _, fk := range schema.Relationships {
+		if sg.cfg.Output.IsBooleanColumn(fk.TableName, fk.ColumnName) {
+			continue
+		}
+		// Dropped or masked columns carry no edge
+		if sg.cfg.Pipeline.ColumnRule(fk.TableName, fk.ColumnName) != "" {
+			continue
+		}
+		// Collapsed junction tables are replaced by direct edges
+		if collapsedJunction(sg.cfg, schema.Tables[fk.TableName]) != nil {
+			continue
+		}
+		result = append(result, fk)
+	}
+	return result
+}
+
+func (sg *SchemaGenerator) writeSchemaFile(name string, predicates map[string]*PredicateInfo, types map[string][]string) error {
+	content, err := sg.renderSchema(predicates, types)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	file, err := sink.New(sg.cfg.Output.SinkOptions()).Create(name, false)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// renderSchema writes the schema file content and checks it with validateSchema
+func (sg *SchemaGenerator) renderSchema(predicates map[string]*PredicateInfo, types map[string][]string) ([]byte, error) {
+	var content bytes.Buffer
+	writer := bufio.NewWriter(&content)
 
 	// Write header
 	sg.writeHeader(writer)
@@ -191,6 +471,127 @@ func (sg *SchemaGenerator) writeSchemaFile(filePath string, predicates map[strin
 	// Write types
 	sg.writeTypes(writer, types)
 
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Refuse to write a schema Dgraph would reject
+	if err := validateSchema(content.String()); err != nil {
+		return nil, fmt.Errorf("generated schema is invalid: %w", err)
+	}
+
+	return content.Bytes(), nil
+}
+
+// dgraphScalarTypes are the types a predicate may be declared with
+var dgraphScalarTypes = map[string]bool{
+	"default": true, "bool": true, "datetime": true, "float": true, "geo": true,
+	"int": true, "password": true, "string": true, "uid": true,
+}
+
+// validateSchema checks a rendered schema: every predicate line must match
+// "name: type [directives] .", each predicate is declared once, and type
+// blocks are closed and list only declared predicates. All problems are
+// returned together.
+func validateSchema(content string) error {
+	var errs []error
+	declared := make(map[string]SchemaPredicate)
+	typeLines := make(map[string]int)
+	typeName, typeLine := "", 0
+
+	lineNum := 0
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Inside a type block: fields up to the closing brace
+		if typeName != "" {
+			switch field := strings.Trim(line, "<>"); {
+			case line == "}":
+				typeName = ""
+			case strings.ContainsAny(line, "{}:"):
+				errs = append(errs, fmt.Errorf("line %d: unexpected %q in type %s opened on line %d",
+					lineNum, line, typeName, typeLine))
+			case field != "dgraph.type" && declared[field].Name == "":
+				errs = append(errs, fmt.Errorf("line %d: type %s lists undeclared predicate %s",
+					lineNum, typeName, field))
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "type ") {
+			name, ok := strings.CutSuffix(strings.TrimPrefix(line, "type "), "{")
+			name = strings.Trim(strings.TrimSpace(name), "<>")
+			if !ok || name == "" {
+				errs = append(errs, fmt.Errorf("line %d: malformed type header %q", lineNum, line))
+				continue
+			}
+			if first, dup := typeLines[name]; dup {
+				errs = append(errs, fmt.Errorf("line %d: type %s already defined on line %d", lineNum, name, first))
+			}
+			typeLines[name] = lineNum
+			typeName, typeLine = name, lineNum
+			continue
+		}
+		if line == "}" {
+			errs = append(errs, fmt.Errorf("line %d: '}' without an open type", lineNum))
+			continue
+		}
+
+		pred, err := parsePredicateLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		pred.Line = lineNum
+		if !dgraphScalarTypes[pred.Type] {
+			errs = append(errs, fmt.Errorf("line %d: predicate %s has unknown type %q", lineNum, pred.Name, pred.Type))
+		}
+		if err := checkDirectives(pred.Directives); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: predicate %s: %w", lineNum, pred.Name, err))
+		}
+		if first, dup := declared[pred.Name]; dup {
+			if first.Type != pred.Type || first.List != pred.List {
+				errs = append(errs, fmt.Errorf("line %d: predicate %s redeclared as %s, was %s on line %d",
+					lineNum, pred.Name, pred.Type, first.Type, first.Line))
+			} else {
+				errs = append(errs, fmt.Errorf("line %d: predicate %s already declared on line %d",
+					lineNum, pred.Name, first.Line))
+			}
+			continue
+		}
+		declared[pred.Name] = pred
+	}
+	if typeName != "" {
+		errs = append(errs, fmt.Errorf("line %d: type %s is never closed", typeLine, typeName))
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// checkDirectives checks that directive tokens start with '@' and their
+// parentheses balance. Tokens inside parentheses, like the "term)" of
+// "@index(exact, term)", are arguments.
+func checkDirectives(tokens []string) error {
+	depth := 0
+	for _, token := range tokens {
+		if depth == 0 && !strings.HasPrefix(token, "@") {
+			return fmt.Errorf("directive %q does not start with '@'", token)
+		}
+		depth += strings.Count(token, "(") - strings.Count(token, ")")
+		if depth < 0 {
+			return fmt.Errorf("unbalanced ')' in directive %q", token)
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unclosed '(' in directives")
+	}
 	return nil
 }
 
@@ -203,7 +604,7 @@ func (sg *SchemaGenerator) writeHeader(writer *bufio.Writer) {
 	fmt.Fprintln(writer, "#")
 	fmt.Fprintln(writer, "# This schema includes:")
 	fmt.Fprintln(writer, "# - All table columns as predicates")
-	fmt.Fprintln(writer, "# - Foreign key relationships with @reverse")
+	fmt.Fprintln(writer, "# - Foreign key relationships with reverse edges")
 	fmt.Fprintln(writer, "# - Appropriate indexes for performance")
 	fmt.Fprintln(writer, "# - Type definitions for all tables")
 	fmt.Fprintln(writer, "# ==============================================")
@@ -226,8 +627,12 @@ func (sg *SchemaGenerator) writePredicates(writer *bufio.Writer, predicates map[
 	})
 
 	for _, pred := range sortedPredicates {
+		if pred.Comment != "" {
+			fmt.Fprintln(writer, "# "+pred.Comment)
+		}
+
 		var line strings.Builder
-		line.WriteString(pred.Name)
+		line.WriteString(schemaName(sg.names.Name(pred.Name)))
 		line.WriteString(": ")
 
 		// Handle list types
@@ -258,6 +663,10 @@ func (sg *SchemaGenerator) writePredicates(writer *bufio.Writer, predicates map[
 			directives = append(directives, "@upsert")
 		}
 
+		if pred.Lang {
+			directives = append(directives, "@lang")
+		}
+
 		if len(directives) > 0 {
 			line.WriteString(" ")
 			line.WriteString(strings.Join(directives, " "))
@@ -285,11 +694,11 @@ func (sg *SchemaGenerator) writeTypes(writer *bufio.Writer, types map[string][]s
 	for _, typeName := range sortedTypeNames {
 		predicateList := types[typeName]
 
-		fmt.Fprintf(writer, "type %s {\n", typeName)
+		fmt.Fprintf(writer, "type %s {\n", schemaName(sg.names.Name(typeName)))
 		fmt.Fprintln(writer, "  dgraph.type")
 
 		for _, predicate := range predicateList {
-			fmt.Fprintf(writer, "  %s\n", predicate)
+			fmt.Fprintf(writer, "  %s\n", schemaName(sg.names.Name(predicate)))
 		}
 
 		fmt.Fprintln(writer, "}")
@@ -297,9 +706,33 @@ func (sg *SchemaGenerator) writeTypes(writer *bufio.Writer, types map[string][]s
 	}
 }
 
-func (sg *SchemaGenerator) getIndexType(dgraphType string, column *Column) string {
+// columnDgraphType returns the Dgraph type for a column after applying the
+// configured overrides on top of MySQLToDgraphType
+func (sg *SchemaGenerator) columnDgraphType(tableName string, column *Column) string {
+	return columnDgraphType(sg.cfg, tableName, column)
+}
+
+func (sg *SchemaGenerator) getIndexType(tableName, dgraphType string, column *Column) string {
 	switch dgraphType {
 	case "string":
+		// Base64 text of binary data is not worth indexing
+		if isBase64Column(sg.cfg, tableName, column) {
+			return ""
+		}
+
+		// Decimals kept as strings are compared as whole values
+		if IsDecimalType(column.Type) {
+			return "@index(exact)"
+		}
+
+		// ENUM values are matched exactly; SET members are searched as terms
+		if IsEnumType(column.Type) {
+			return "@index(hash)"
+		}
+		if IsSetType(column.Type) {
+			return "@index(term)"
+		}
+
 		// Use term index for most strings, exact for IDs and unique fields
 		if strings.Contains(strings.ToLower(column.Name), "id") ||
 			strings.Contains(strings.ToLower(column.Name), "email") ||
@@ -314,7 +747,7 @@ func (sg *SchemaGenerator) getIndexType(dgraphType string, column *Column) strin
 	case "bool":
 		return "@index(bool)"
 	case "dateTime", "datetime":
-		return "@index(hour)"
+		return fmt.Sprintf("@index(%s)", sg.cfg.Output.DatetimeGranularity(tableName, column.Name))
 	default:
 		return ""
 	}
@@ -347,33 +780,10 @@ func (sg *SchemaGenerator) isUpsertCandidate(tableName, columnName string, schem
 	return false
 }
 
+// pluralize names the reverse edge from a table's point of view, honoring
+// output.pluralization_overrides
 func (sg *SchemaGenerator) pluralize(name string) string {
-	name = strings.ToLower(name)
-
-	// Simple pluralization rules
-	if strings.HasSuffix(name, "s") || strings.HasSuffix(name, "x") ||
-		strings.HasSuffix(name, "z") || strings.HasSuffix(name, "ch") ||
-		strings.HasSuffix(name, "sh") {
-		return name + "es"
-	}
-
-	if strings.HasSuffix(name, "y") && len(name) > 1 {
-		secondLast := name[len(name)-2]
-		if secondLast != 'a' && secondLast != 'e' && secondLast != 'i' &&
-			secondLast != 'o' && secondLast != 'u' {
-			return name[:len(name)-1] + "ies"
-		}
-	}
-
-	if strings.HasSuffix(name, "f") {
-		return name[:len(name)-1] + "ves"
-	}
-
-	if strings.HasSuffix(name, "fe") {
-		return name[:len(name)-2] + "ves"
-	}
-
-	return name + "s"
+	return pluralForm(name, sg.cfg.Output.PluralizationOverrides)
 }
 
 func (sg *SchemaGenerator) containsString(slice []string, item string) bool {
@@ -0,0 +1,519 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// fkSchema returns tables with an id column each, plus the given extra
+// columns, and a foreign key for every child.column -> parent pair
+func fkSchema(columns map[string][]string, fks [][3]string) *Schema {
+	schema := &Schema{Tables: make(map[string]*Table)}
+	for tableName, extra := range columns {
+		table := &Table{
+			Name:        tableName,
+			Columns:     map[string]*Column{"id": {Name: "id", Type: "int", ColumnType: "int", Position: 1}},
+			PrimaryKeys: []string{"id"},
+		}
+		for i, name := range extra {
+			table.Columns[name] = &Column{Name: name, Type: "int", ColumnType: "int", Position: i + 2}
+		}
+		schema.Tables[tableName] = table
+	}
+	for _, fk := range fks {
+		schema.Relationships = append(schema.Relationships, ForeignKey{
+			TableName: fk[0], ColumnName: fk[1], RefTableName: fk[2], RefColumnName: "id",
+		})
+	}
+	return schema
+}
+
+func TestSemanticReverseNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		columns   map[string][]string
+		fks       [][3]string
+		overrides map[string]string // output.pluralization_overrides
+		want      map[string]string // table.column -> semantic reverse predicate
+	}{
+		{
+			name:    "comment and comments_archive without a collision",
+			columns: map[string][]string{"post": nil, "comment": {"post_id"}, "comments_archive": {"post_id"}},
+			fks:     [][3]string{{"comment", "post_id", "post"}, {"comments_archive", "post_id", "post"}},
+			want: map[string]string{
+				"comment.post_id":          "post.comments",
+				"comments_archive.post_id": "post.comments_archives",
+			},
+		},
+		{
+			name:      "comment and comments_archive pluralized to the same name",
+			columns:   map[string][]string{"post": nil, "comment": {"post_id"}, "comments_archive": {"post_id"}},
+			fks:       [][3]string{{"comment", "post_id", "post"}, {"comments_archive", "post_id", "post"}},
+			overrides: map[string]string{"comments_archive": "comments"},
+			want: map[string]string{
+				"comment.post_id":          "post.comments",
+				"comments_archive.post_id": "post.comments_by_post",
+			},
+		},
+		{
+			name:    "taken by a column of the parent",
+			columns: map[string][]string{"post": {"comments"}, "comment": {"post_id"}},
+			fks:     [][3]string{{"comment", "post_id", "post"}},
+			want:    map[string]string{"comment.post_id": "post.comments_by_post"},
+		},
+		{
+			name:    "two foreign keys of one table",
+			columns: map[string][]string{"users": nil, "order": {"buyer_id", "seller_id"}},
+			fks:     [][3]string{{"order", "buyer_id", "users"}, {"order", "seller_id", "users"}},
+			want: map[string]string{
+				"order.buyer_id":  "users.orders",
+				"order.seller_id": "users.orders_by_seller",
+			},
+		},
+		{
+			name:      "suffixed name also taken",
+			columns:   map[string][]string{"post": {"comments_by_post"}, "comment": {"post_id"}, "comments_archive": {"post_id"}},
+			fks:       [][3]string{{"comment", "post_id", "post"}, {"comments_archive", "post_id", "post"}},
+			overrides: map[string]string{"comments_archive": "comments"},
+			want: map[string]string{
+				"comment.post_id":          "post.comments",
+				"comments_archive.post_id": "post.comments_by_post2",
+			},
+		},
+		{
+			name:    "self-references are left out",
+			columns: map[string][]string{"category": {"parent_id"}},
+			fks:     [][3]string{{"category", "parent_id", "category"}},
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.PluralizationOverrides = tt.overrides
+			sg := NewSchemaGenerator(cfg, logger.New("error", "text"))
+			schema := fkSchema(tt.columns, tt.fks)
+
+			got := sg.semanticReverseNames(schema)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d names %v, want %v", len(got), got, tt.want)
+			}
+			for source, name := range tt.want {
+				if got[source] != name {
+					t.Errorf("%s reverse = %q, want %q", source, got[source], name)
+				}
+			}
+
+			// Each name is declared once, as its own predicate on the parent
+			predicates, types, err := sg.build(schema)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			for _, name := range tt.want {
+				if predicates[name] == nil || predicates[name].Type != "uid" {
+					t.Errorf("predicate %s = %+v, want a uid edge", name, predicates[name])
+				}
+				parent, _, _ := strings.Cut(name, ".")
+				if !sg.containsString(types[parent], name) {
+					t.Errorf("type %s lacks %s: %v", parent, name, types[parent])
+				}
+			}
+		})
+	}
+}
+
+func TestBooleanColumnsAreNotEdges(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.BooleanColumns = []string{"posts.flag_id", "is_*"}
+	sg := NewSchemaGenerator(cfg, logger.New("error", "text"))
+	schema := fkSchema(map[string][]string{"flag": nil, "users": nil, "posts": {"flag_id", "user_id", "is_deleted"}},
+		[][3]string{{"posts", "flag_id", "flag"}, {"posts", "user_id", "users"}})
+
+	predicates, types, err := sg.build(schema)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	tests := []struct {
+		predicate string
+		typ       string
+	}{
+		{"posts.flag_id", "bool"},
+		{"posts.is_deleted", "bool"},
+		{"posts.user_id", "uid"},
+	}
+	for _, tt := range tests {
+		if predicates[tt.predicate] == nil || predicates[tt.predicate].Type != tt.typ {
+			t.Errorf("predicate %s = %+v, want type %s", tt.predicate, predicates[tt.predicate], tt.typ)
+		}
+	}
+	for name, predicate := range predicates {
+		if strings.HasPrefix(name, "flag.") && predicate.Type == "uid" {
+			t.Errorf("flag has reverse edge %s from a boolean column", name)
+		}
+	}
+	if !sg.containsString(types["posts"], "posts.flag_id") {
+		t.Errorf("type posts lacks posts.flag_id: %v", types["posts"])
+	}
+}
+
+func TestDatetimeIndexGranularity(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallback  string
+		overrides map[string]string
+		want      map[string]string // Predicate -> index
+	}{
+		{
+			name:     "default granularity",
+			fallback: "hour",
+			want:     map[string]string{"users.birth_date": "@index(hour)", "users.created_at": "@index(hour)"},
+		},
+		{
+			name:      "override takes precedence",
+			fallback:  "day",
+			overrides: map[string]string{"users.birth_date": "year"},
+			want:      map[string]string{"users.birth_date": "@index(year)", "users.created_at": "@index(day)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.DatetimeIndexGranularity = tt.fallback
+			cfg.Output.DatetimeIndexOverrides = tt.overrides
+			schema := fkSchema(map[string][]string{"users": nil}, nil)
+			schema.Tables["users"].Columns["birth_date"] = &Column{Name: "birth_date", Type: "date", ColumnType: "date"}
+			schema.Tables["users"].Columns["created_at"] = &Column{Name: "created_at", Type: "datetime", ColumnType: "datetime"}
+
+			predicates, _, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			for name, index := range tt.want {
+				if predicates[name] == nil || predicates[name].Type != "datetime" || predicates[name].Index != index {
+					t.Errorf("predicate %s = %+v, want a datetime with %s", name, predicates[name], index)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectJunctionTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		columns  []string // Columns of user_roles besides user_id and role_id
+		types    map[string]string
+		fks      [][3]string
+		junction bool
+		facets   []string
+	}{
+		{name: "classic", junction: true},
+		{name: "with an auto-increment id", columns: []string{"id"}, junction: true},
+		{name: "with a timestamp", columns: []string{"assigned_at"}, types: map[string]string{"assigned_at": "datetime"},
+			junction: true, facets: []string{"assigned_at"}},
+		{name: "with a payload column", columns: []string{"note"}, types: map[string]string{"note": "varchar"}},
+		{name: "one foreign key", fks: [][3]string{{"user_roles", "user_id", "users"}}},
+		{name: "three foreign keys", columns: []string{"group_id"}, fks: [][3]string{
+			{"user_roles", "user_id", "users"}, {"user_roles", "role_id", "roles"}, {"user_roles", "group_id", "groups"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fks := tt.fks
+			if fks == nil {
+				fks = [][3]string{{"user_roles", "user_id", "users"}, {"user_roles", "role_id", "roles"}}
+			}
+			schema := fkSchema(map[string][]string{"users": nil, "roles": nil, "groups": nil, "user_roles": {"user_id", "role_id"}}, fks)
+			table := schema.Tables["user_roles"]
+			delete(table.Columns, "id")
+			table.PrimaryKeys = []string{"user_id", "role_id"}
+			for _, name := range tt.columns {
+				col := &Column{Name: name, Type: "int", ColumnType: "int"}
+				if typ := tt.types[name]; typ != "" {
+					col.Type, col.ColumnType = typ, typ
+				}
+				col.AutoIncrement = name == "id"
+				table.Columns[name] = col
+			}
+
+			found := detectJunctionTables(schema)
+			if got := table.Junction != nil; got != tt.junction {
+				t.Fatalf("junction = %+v, want one: %v", table.Junction, tt.junction)
+			}
+			if !tt.junction {
+				if found != 0 {
+					t.Errorf("found %d junction tables, want 0", found)
+				}
+				return
+			}
+			if found != 1 {
+				t.Errorf("found %d junction tables, want 1", found)
+			}
+			if table.Junction.Left.ColumnName != "role_id" || table.Junction.Right.ColumnName != "user_id" {
+				t.Errorf("sides = %s, %s; want them ordered by column", table.Junction.Left.ColumnName, table.Junction.Right.ColumnName)
+			}
+			if !slices.Equal(table.Junction.Facets, tt.facets) {
+				t.Errorf("facets = %v, want %v", table.Junction.Facets, tt.facets)
+			}
+		})
+	}
+}
+
+// TestCollapseJunctionTables exports a classic many-to-many table with and
+// without pipeline.collapse_junction_tables
+func TestCollapseJunctionTables(t *testing.T) {
+	tests := []struct {
+		collapse bool
+		edges    []string
+	}{
+		{
+			collapse: true,
+			edges: []string{
+				"_:roles_10 <roles.users> _:users_1 .",
+				"_:roles_10 <roles.users> _:users_2 .",
+				"_:roles_20 <roles.users> _:users_1 .",
+				"_:users_1 <users.roles> _:roles_10 .",
+				"_:users_1 <users.roles> _:roles_20 .",
+				"_:users_2 <users.roles> _:roles_10 .",
+			},
+		},
+		{collapse: false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("collapse %v", tt.collapse), func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.CollapseJunctionTables = tt.collapse
+			schema := fkSchema(map[string][]string{"users": nil, "roles": nil, "user_roles": {"user_id", "role_id"}},
+				[][3]string{{"user_roles", "user_id", "users"}, {"user_roles", "role_id", "roles"}})
+			delete(schema.Tables["user_roles"].Columns, "id")
+			schema.Tables["user_roles"].PrimaryKeys = []string{"user_id", "role_id"}
+			detectJunctionTables(schema)
+
+			predicates, types, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			for _, name := range []string{"users.roles", "roles.users"} {
+				p := predicates[name]
+				if tt.collapse && (p == nil || p.Type != "uid" || !p.List) {
+					t.Errorf("predicate %s = %+v, want a list edge", name, p)
+				}
+				if !tt.collapse && p != nil {
+					t.Errorf("predicate %s declared without collapsing", name)
+				}
+			}
+			if got := slices.Contains(types["users"], "users.roles") && slices.Contains(types["roles"], "roles.users"); got != tt.collapse {
+				t.Errorf("types list the junction edges: %v, want %v", got, tt.collapse)
+			}
+			if _, ok := types["user_roles"]; ok == tt.collapse {
+				t.Errorf("type user_roles declared: %v, want %v", ok, !tt.collapse)
+			}
+
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+				"users": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}},
+				"roles": {columns: []string{"id"}, rows: [][]driver.Value{{int64(10)}, {int64(20)}}},
+				"user_roles": {columns: []string{"user_id", "role_id"}, rows: [][]driver.Value{
+					{int64(1), int64(10)}, {int64(1), int64(20)}, {int64(2), int64(10)},
+				}},
+			})
+			var edges []string
+			junctionNodes := false
+			for _, line := range lines {
+				if strings.Contains(line, "<users.roles>") || strings.Contains(line, "<roles.users>") {
+					edges = append(edges, line)
+				}
+				junctionNodes = junctionNodes || strings.HasPrefix(line, "_:user_roles")
+			}
+			slices.Sort(edges)
+			if !slices.Equal(edges, tt.edges) {
+				t.Errorf("edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(tt.edges, "\n"))
+			}
+			if junctionNodes == tt.collapse {
+				t.Errorf("junction rows written as nodes: %v, want %v", junctionNodes, !tt.collapse)
+			}
+		})
+	}
+}
+
+// TestJunctionFacets exports a junction table with timestamps and checks they
+// are written as facets on both edges, in syntax the JSON writer parses back
+func TestJunctionFacets(t *testing.T) {
+	tests := []struct {
+		name       string
+		assignedAt driver.Value
+		rule       string
+		facets     string // Facet list of both edges; "" for none
+	}{
+		{name: "datetime", assignedAt: "2024-01-01 00:00:00", facets: " (assigned_at=2024-01-01T00:00:00Z)"},
+		{name: "null", assignedAt: nil},
+		{name: "dropped", assignedAt: "2024-01-01 00:00:00", rule: "drop"},
+		{name: "redacted", assignedAt: "2024-01-01 00:00:00", rule: "redact", facets: ` (assigned_at="***")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.CollapseJunctionTables = true
+			if tt.rule != "" {
+				cfg.Pipeline.ColumnRules = map[string]string{"user_roles.assigned_at": tt.rule}
+			}
+			schema := fkSchema(map[string][]string{"users": nil, "roles": nil, "user_roles": {"user_id", "role_id"}},
+				[][3]string{{"user_roles", "user_id", "users"}, {"user_roles", "role_id", "roles"}})
+			table := schema.Tables["user_roles"]
+			delete(table.Columns, "id")
+			table.PrimaryKeys = []string{"user_id", "role_id"}
+			table.Columns["assigned_at"] = &Column{Name: "assigned_at", Type: "datetime", ColumnType: "datetime", Position: 3}
+			detectJunctionTables(schema)
+
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+				"users": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}},
+				"roles": {columns: []string{"id"}, rows: [][]driver.Value{{int64(2)}}},
+				"user_roles": {columns: []string{"user_id", "role_id", "assigned_at"}, rows: [][]driver.Value{
+					{int64(1), int64(2), tt.assignedAt},
+				}},
+			})
+			want := []string{
+				"_:roles_2 <roles.users> _:users_1" + tt.facets + " .",
+				"_:users_1 <users.roles> _:roles_2" + tt.facets + " .",
+			}
+			var edges []string
+			for _, line := range lines {
+				if strings.Contains(line, "<users.roles>") || strings.Contains(line, "<roles.users>") {
+					edges = append(edges, line)
+				}
+			}
+			slices.Sort(edges)
+			if !slices.Equal(edges, want) {
+				t.Fatalf("edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(want, "\n"))
+			}
+
+			for _, edge := range edges {
+				_, _, object, facets, isUID, ok := parseTriple(edge)
+				if !ok || !isUID || !strings.HasPrefix(object, "_:") {
+					t.Errorf("parseTriple(%q) = %q, uid %v, ok %v", edge, object, isUID, ok)
+				}
+				if got := len(facets); got != strings.Count(tt.facets, "=") {
+					t.Errorf("%q parses to facets %v", edge, facets)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSchemaRejectsMalformedPredicates(t *testing.T) {
+	valid := func() map[string]*PredicateInfo {
+		return map[string]*PredicateInfo{
+			"users.name":  {Name: "users.name", Type: "string", Index: "@index(exact, term)"},
+			"users.age":   {Name: "users.age", Type: "int"},
+			"orders.user": {Name: "orders.user", Type: "uid", Reverse: true, Count: true},
+		}
+	}
+	tests := []struct {
+		name     string
+		change   func(predicates map[string]*PredicateInfo, types map[string][]string)
+		errTexts []string // Every one must appear; none means the schema is valid
+	}{
+		{name: "valid", change: func(map[string]*PredicateInfo, map[string][]string) {}},
+		{
+			name: "unknown type",
+			change: func(p map[string]*PredicateInfo, _ map[string][]string) {
+				p["users.age"].Type = "varchar"
+			},
+			errTexts: []string{`predicate users.age has unknown type "varchar"`},
+		},
+		{
+			name: "directive without @",
+			change: func(p map[string]*PredicateInfo, _ map[string][]string) {
+				p["users.name"].Index = "index(exact)"
+			},
+			errTexts: []string{`directive "index(exact)" does not start with '@'`},
+		},
+		{
+			name: "unclosed directive",
+			change: func(p map[string]*PredicateInfo, _ map[string][]string) {
+				p["users.name"].Index = "@index(exact"
+			},
+			errTexts: []string{"unclosed '(' in directives"},
+		},
+		{
+			name: "missing type",
+			change: func(p map[string]*PredicateInfo, _ map[string][]string) {
+				p["users.age"].Type = ""
+			},
+			errTexts: []string{"predicate users.age has no type"},
+		},
+		{
+			name: "type listing an undeclared predicate",
+			change: func(_ map[string]*PredicateInfo, types map[string][]string) {
+				types["users"] = append(types["users"], "users.email")
+			},
+			errTexts: []string{"type users lists undeclared predicate users.email"},
+		},
+		{
+			name: "several problems are reported together",
+			change: func(p map[string]*PredicateInfo, _ map[string][]string) {
+				p["users.age"].Type = "number"
+				p["orders.user"].Index = "@index(hash))"
+			},
+			errTexts: []string{`unknown type "number"`, "unbalanced ')'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicates := valid()
+			types := map[string][]string{"users": {"users.name", "users.age"}, "orders": {"orders.user"}}
+			tt.change(predicates, types)
+
+			content, err := NewSchemaGenerator(testConfig(t), logger.New("error", "text")).renderSchema(predicates, types)
+			if len(tt.errTexts) == 0 {
+				if err != nil || len(content) == 0 {
+					t.Fatalf("renderSchema: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("renderSchema accepted:\n%s", content)
+			}
+			for _, text := range tt.errTexts {
+				if !strings.Contains(err.Error(), text) {
+					t.Errorf("error %q does not contain %q", err, text)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errText string
+	}{
+		{name: "valid", content: "a: int .\n<b%20c>: [string] @index(exact) .\ntype T {\n  dgraph.type\n  a\n  <b%20c>\n}\n"},
+		{name: "missing dot", content: "a: int\n", errText: "line 1: predicate a is not terminated by '.'"},
+		{name: "missing colon", content: "a int .\n", errText: "line 1: missing ':'"},
+		{name: "conflicting redeclaration", content: "a: int .\na: uid .\n", errText: "line 2: predicate a redeclared as uid, was int on line 1"},
+		{name: "duplicate declaration", content: "a: int .\na: int .\n", errText: "line 2: predicate a already declared on line 1"},
+		{name: "unclosed type", content: "a: int .\ntype T {\n  a\n", errText: "line 2: type T is never closed"},
+		{name: "stray brace", content: "a: int .\n}\n", errText: "line 2: '}' without an open type"},
+		{name: "duplicate type", content: "type T {\n}\ntype T {\n}\n", errText: "line 3: type T already defined on line 1"},
+		{name: "malformed type header", content: "type T\n", errText: "line 1: malformed type header"},
+		{name: "nested type", content: "type T {\ntype U {\n}\n", errText: "line 2: unexpected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSchema(tt.content)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateSchema: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.errText)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// graphQLScalars maps Dgraph types to GraphQL scalars
+var graphQLScalars = map[string]string{
+	"int":      "Int",
+	"float":    "Float",
+	"bool":     "Boolean",
+	"datetime": "DateTime",
+	"string":   "String",
+}
+
+// graphQLField is one field of a generated GraphQL type
+type graphQLField struct {
+	name       string
+	typ        string
+	predicate  string // Dgraph predicate the field reads, empty for the ID field
+	hasInverse string // Field on the target type that mirrors this edge
+	reverse    bool   // Reads the @reverse edge of predicate (~predicate)
+}
+
+// GenerateGraphQL writes a Dgraph GraphQL schema for the tables to
+// output.graphql_file. Types and fields are bound to the generated DQL types
+// and predicates with @dgraph, so the GraphQL API reads the migrated data.
+// Foreign keys become typed references with a list field on the referenced
+// type; the pair is linked with @hasInverse, or reads the ~ edge when
+// output.reverse_edges is directive.
+func (sg *SchemaGenerator) GenerateGraphQL(schema *Schema) error {
+	typeNames := sg.graphQLTypeNames(schema)
+	fields := make(map[string][]graphQLField, len(typeNames))
+	used := make(map[string]map[string]bool, len(typeNames))
+
+	// addField adds a field under a name not yet used in the type. Scalars
+	// are added first and keep their names; a clashing edge gets a suffix.
+	addField := func(tableName string, field graphQLField, suffix string) string {
+		if used[tableName] == nil {
+			used[tableName] = map[string]bool{"id": true}
+		}
+		name := field.name
+		if used[tableName][name] {
+			name = field.name + suffix
+			for n := 2; used[tableName][name]; n++ {
+				name = fmt.Sprintf("%s%s%d", field.name, suffix, n)
+			}
+		}
+		used[tableName][name] = true
+		field.name = name
+		fields[tableName] = append(fields[tableName], field)
+		return name
+	}
+
+	tableNames := make([]string, 0, len(typeNames))
+	for tableName := range typeNames {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	relationships := sg.relationships(schema)
+	isEdge := make(map[string]bool)
+	for _, fk := range relationships {
+		isEdge[fk.TableName+"."+fk.ColumnName] = true
+	}
+
+	// Scalar fields
+	for _, tableName := range tableNames {
+		table := schema.Tables[tableName]
+		columnNames := make([]string, 0, len(table.Columns))
+		for columnName := range table.Columns {
+			columnNames = append(columnNames, columnName)
+		}
+		sort.Strings(columnNames)
+
+		for _, columnName := range columnNames {
+			column := table.Columns[columnName]
+			if isEdge[tableName+"."+columnName] || sg.cfg.Pipeline.ColumnRule(tableName, columnName) == "drop" {
+				continue
+			}
+
+			typ := graphQLScalars[sg.columnDgraphType(tableName, column)]
+			if typ == "" {
+				typ = "String"
+			}
+			if IsSetType(column.Type) {
+				typ = "[" + typ + "]"
+			} else if !column.Nullable {
+				typ += "!"
+			}
+			addField(tableName, graphQLField{
+				name:      graphQLName(columnName),
+				typ:       typ,
+				predicate: fmt.Sprintf("%s.%s", tableName, columnName),
+			}, "_value")
+		}
+	}
+
+	// Foreign key edges and their inverse lists
+	for _, fk := range relationships {
+		if typeNames[fk.TableName] == "" || typeNames[fk.RefTableName] == "" {
+			continue
+		}
+		forward := graphQLField{
+			name:      graphQLName(strings.TrimSuffix(strings.ToLower(fk.ColumnName), "_id")),
+			typ:       typeNames[fk.RefTableName],
+			predicate: ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName),
+		}
+		backward := graphQLField{
+			name: graphQLName(sg.pluralize(relativeTableName(fk.TableName, fk.RefTableName))),
+			typ:  "[" + typeNames[fk.TableName] + "]",
+		}
+		if fk.TableName == fk.RefTableName {
+			// Hierarchies read as parent and children rather than categories
+			_, children, _ := strings.Cut(ReversePredicateName(fk.TableName, fk.ColumnName, fk.RefTableName), ".")
+			backward.name = graphQLName(children)
+		}
+		if !sg.cfg.Output.ManualReverseEdges() {
+			// Dgraph rejects @hasInverse on reverse predicates
+			backward.predicate, backward.reverse = forward.predicate, true
+			addField(fk.TableName, forward, "_ref")
+			addField(fk.RefTableName, backward, "_ref")
+			continue
+		}
+		backward.predicate = ReversePredicateName(fk.TableName, fk.ColumnName, fk.RefTableName)
+		sg.addInversePair(addField, fk.TableName, forward, fk.RefTableName, backward)
+	}
+
+	// Edges of collapsed junction tables
+	for _, table := range schema.Tables {
+		junction := collapsedJunction(sg.cfg, table)
+		if junction == nil {
+			continue
+		}
+		left, right := junction.Left.RefTableName, junction.Right.RefTableName
+		if typeNames[left] == "" || typeNames[right] == "" {
+			continue
+		}
+		forwardPred, backwardPred := junction.Predicates()
+		forward := graphQLField{
+			name:      graphQLName(strings.TrimPrefix(forwardPred, left+".")),
+			typ:       "[" + typeNames[right] + "]",
+			predicate: forwardPred,
+		}
+		backward := graphQLField{
+			name:      graphQLName(strings.TrimPrefix(backwardPred, right+".")),
+			typ:       "[" + typeNames[left] + "]",
+			predicate: backwardPred,
+		}
+		sg.addInversePair(addField, left, forward, right, backward)
+	}
+
+	graphQLPath := filepath.Join(sg.cfg.Output.Directory, sg.cfg.Output.GraphQLFile)
+	if err := sg.writeGraphQL(graphQLPath, tableNames, typeNames, fields); err != nil {
+		return fmt.Errorf("failed to write GraphQL schema: %w", err)
+	}
+
+	sg.logger.Info("GraphQL schema generated", "types", len(tableNames), "file", graphQLPath)
+	return nil
+}
+
+// addInversePair adds an edge field and its inverse. Only the inverse names
+// its partner in @hasInverse; Dgraph needs one side, and declaring both is
+// rejected when the edge references its own type.
+func (sg *SchemaGenerator) addInversePair(addField func(string, graphQLField, string) string,
+	fromTable string, forward graphQLField, toTable string, backward graphQLField) {
+
+	forwardName := addField(fromTable, forward, "_ref")
+	backward.hasInverse = forwardName
+	addField(toTable, backward, "_ref")
+}
+
+// graphQLTypeNames returns a distinct GraphQL type name for every table that
+// becomes a node type
+func (sg *SchemaGenerator) graphQLTypeNames(schema *Schema) map[string]string {
+	tableNames := make([]string, 0, len(schema.Tables))
+	for tableName, table := range schema.Tables {
+		if collapsedJunction(sg.cfg, table) == nil {
+			tableNames = append(tableNames, tableName)
+		}
+	}
+	sort.Strings(tableNames)
+
+	typeNames := make(map[string]string, len(tableNames))
+	taken := make(map[string]bool)
+	for _, tableName := range tableNames {
+		base := graphQLTypeName(tableName, sg.cfg.Output.PluralizationOverrides)
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		taken[name] = true
+		typeNames[tableName] = name
+	}
+	return typeNames
+}
+
+func (sg *SchemaGenerator) writeGraphQL(path string, tableNames []string, typeNames map[string]string, fields map[string][]graphQLField) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintln(writer, "# Dgraph GraphQL schema generated from MySQL")
+	fmt.Fprintln(writer, "# Types and fields are bound to the DQL schema with @dgraph")
+	fmt.Fprintln(writer)
+
+	for _, tableName := range tableNames {
+		fmt.Fprintf(writer, "type %s @dgraph(type: %q) {\n", typeNames[tableName], sg.names.Name(tableName))
+		fmt.Fprintln(writer, "  id: ID!")
+		for _, field := range fields[tableName] {
+			fmt.Fprintf(writer, "  %s: %s", field.name, field.typ)
+			if field.hasInverse != "" {
+				fmt.Fprintf(writer, " @hasInverse(field: %s)", field.hasInverse)
+			}
+			predicate := sg.names.Name(field.predicate)
+			if field.reverse {
+				predicate = "~" + predicate
+			}
+			fmt.Fprintf(writer, " @dgraph(pred: %q)\n", predicate)
+		}
+		fmt.Fprintln(writer, "}")
+		fmt.Fprintln(writer)
+	}
+	return writer.Flush()
+}
+
+// graphQLTypeName turns a table name into a singular PascalCase type name:
+// order_items -> OrderItem
+func graphQLTypeName(tableName string, overrides map[string]string) string {
+	parts := strings.FieldsFunc(tableName, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(parts) == 0 {
+		return "Type"
+	}
+	parts[len(parts)-1] = singularForm(parts[len(parts)-1], overrides)
+
+	var b strings.Builder
+	for _, part := range parts {
+		runes := []rune(strings.ToLower(part))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return graphQLName(b.String())
+}
+
+// graphQLName replaces characters GraphQL names do not allow with "_"
+func graphQLName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+)
+
+// SchemaChecksum returns the sha256 checksum of a schema file
+func SchemaChecksum(schemaPath string) (string, error) {
+	return FileChecksum(schemaPath)
+}
+
+// FileChecksum returns the sha256 checksum of a file's bytes as stored, so a
+// compressed file is checked without decompressing it
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// EmbedSchemaHeader rewrites an RDF file so it begins with a commented header
+// listing the predicates the file uses and the checksum of the schema it was
+// generated against. An existing header is replaced, so the call is idempotent.
+// A compressed file is rewritten compressed.
+func EmbedSchemaHeader(rdfPath, checksum string) error {
+	predicates, err := collectPredicates(rdfPath)
+	if err != nil {
+		return fmt.Errorf("failed to collect predicates: %w", err)
+	}
+
+	src, err := compress.Open(rdfPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := rdfPath + ".tmp"
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	dst := compress.NewWriter(tmpFile, compress.ForPath(rdfPath))
+
+	writer := bufio.NewWriterSize(dst, 1024*1024)
+
+	fmt.Fprintln(writer, "# ==============================================")
+	fmt.Fprintf(writer, "# Schema checksum: %s\n", checksum)
+	fmt.Fprintf(writer, "# Predicates (%d):\n", len(predicates))
+	for _, predicate := range predicates {
+		fmt.Fprintf(writer, "#   %s\n", predicate)
+	}
+	fmt.Fprintln(writer, "# ==============================================")
+
+	// Copy the data, dropping any header left by a previous run
+	reader := bufio.NewReaderSize(src, 1024*1024)
+	inHeader := true
+	for {
+		line, readErr := reader.ReadString('\n')
+		if inHeader && strings.HasPrefix(line, "#") {
+			if readErr != nil {
+				break
+			}
+			continue
+		}
+		inHeader = false
+
+		if _, err := writer.WriteString(line); err != nil {
+			dst.Close()
+			return err
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			dst.Close()
+			return readErr
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, rdfPath)
+}
+
+// collectPredicates returns the sorted set of predicates used in an RDF file
+func collectPredicates(rdfPath string) ([]string, error) {
+	file, err := compress.Open(rdfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRDFLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) >= 2 && strings.HasPrefix(parts[1], "<") && strings.HasSuffix(parts[1], ">") {
+			seen[strings.Trim(parts[1], "<>")] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	predicates := make([]string, 0, len(seen))
+	for predicate := range seen {
+		predicates = append(predicates, predicate)
+	}
+	sort.Strings(predicates)
+	return predicates, nil
+}
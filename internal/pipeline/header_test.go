@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"bufio"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// readHeader returns the checksum and predicates of an RDF file's header,
+// and the predicates its triples use
+func readHeader(t *testing.T, path string) (checksum string, listed, used []string) {
+	t.Helper()
+	file, err := compress.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first && line != "# ==============================================" {
+			t.Fatalf("%s begins with %q", filepath.Base(path), line)
+		}
+		first = false
+		switch {
+		case strings.HasPrefix(line, "# Schema checksum: "):
+			checksum = strings.TrimPrefix(line, "# Schema checksum: ")
+		case strings.HasPrefix(line, "#   "):
+			listed = append(listed, strings.TrimPrefix(line, "#   "))
+		case strings.HasPrefix(line, "_:"):
+			if predicate := strings.Trim(strings.Fields(line)[1], "<>"); !slices.Contains(used, predicate) {
+				used = append(used, predicate)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(used)
+	return checksum, listed, used
+}
+
+func TestEmbedSchemaHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+		files  int
+	}{
+		{name: "one file", files: 1},
+		{name: "chunks", change: func(c *config.Config) { c.Output.ChunkSize, c.Pipeline.BatchSize = 2, 1 }, files: 3},
+		{name: "split by table", change: func(c *config.Config) { c.Output.SplitByTable = true }, files: 2},
+		{name: "compressed", change: func(c *config.Config) { c.Output.Compression = "gzip" }, files: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.EmbedSchemaHeader = true
+			cfg.Pipeline.SkipValidation = true
+			if tt.change != nil {
+				tt.change(cfg)
+			}
+			runPipeline(t, cfg, shopSchema(), ModeFull, RunOptions{})
+
+			want, err := SchemaChecksum(filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := rdfDataFiles(cfg)
+			if len(files) != tt.files {
+				t.Fatalf("wrote %v, want %d files", files, tt.files)
+			}
+			for _, name := range files {
+				checksum, listed, used := readHeader(t, filepath.Join(cfg.Output.Directory, name))
+				if checksum != want {
+					t.Errorf("%s checksum = %q, want %q", name, checksum, want)
+				}
+				if len(used) == 0 || !slices.Equal(listed, used) {
+					t.Errorf("%s lists predicates %q, uses %q", name, listed, used)
+				}
+			}
+
+			// A chunk manifest describes the files with their headers
+			if cfg.Output.ChunkSize > 0 {
+				manifest, err := LoadChunkManifest(filepath.Join(cfg.Output.Directory, cfg.Output.ManifestFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, chunk := range manifest.Chunks {
+					sum, err := FileChecksum(filepath.Join(cfg.Output.Directory, chunk.Filename))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if chunk.Checksum != sum {
+						t.Errorf("manifest checksum of %s = %s, file has %s", chunk.Filename, chunk.Checksum, sum)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedSchemaHeaderReplacesHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	writeFile(t, path, "_:a <users.name> \"A\" .\n_:a <dgraph.type> \"users\" .\n")
+	for _, checksum := range []string{"sha256:first", "sha256:second"} {
+		if err := EmbedSchemaHeader(path, checksum); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum, listed, used := readHeader(t, path)
+	if checksum != "sha256:second" {
+		t.Errorf("checksum = %q, want the second", checksum)
+	}
+	if want := []string{"dgraph.type", "users.name"}; !slices.Equal(listed, want) || !slices.Equal(used, want) {
+		t.Errorf("listed %q, used %q, want %q", listed, used, want)
+	}
+	if got := readFile(t, path); strings.Count(got, "# Schema checksum") != 1 || !strings.HasSuffix(got, "_:a <dgraph.type> \"users\" .\n") {
+		t.Errorf("file after two headers:\n%s", got)
+	}
+}
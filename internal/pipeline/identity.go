@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// keyLabel builds a row's identity from the table's output.key_columns. It
+// returns false when the table has no override or a key column is missing or
+// NULL, in which case the primary key heuristic applies.
+func (dp *DataProcessor) keyLabel(tableName string, cols []string, valueAt func(i int) []byte) (string, bool) {
+	keyColumns := dp.cfg.Output.KeyColumns[tableName]
+	if len(keyColumns) == 0 {
+		return "", false
+	}
+
+	parts := make([]string, len(keyColumns))
+	for k, keyColumn := range keyColumns {
+		found := false
+		for i, col := range cols {
+			if col != keyColumn {
+				continue
+			}
+			value := valueAt(i)
+			if value == nil {
+				return "", false
+			}
+			parts[k] = string(value)
+			found = true
+			break
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return joinKey(parts), true
+}
+
+// loadIdentities reads the primary key -> key_columns label of every row in
+// tables with a key override, so foreign keys holding the primary key resolve
+// to the same node as the row itself
+func (dp *DataProcessor) loadIdentities(ctx context.Context, db *sql.DB, schema *Schema) error {
+	dp.identities = make(map[string]map[string]string)
+
+	for tableName, keyColumns := range dp.cfg.Output.KeyColumns {
+		table := schema.Tables[tableName]
+		if table == nil {
+			dp.logger.Warn("Key columns configured for unknown table", "table", tableName)
+			continue
+		}
+		for _, keyColumn := range keyColumns {
+			if table.Columns[keyColumn] == nil {
+				return fmt.Errorf("key column %s.%s does not exist", tableName, keyColumn)
+			}
+		}
+		if len(table.PrimaryKeys) != 1 {
+			// Foreign keys are matched on a single primary key column; without
+			// one only references to the key columns themselves resolve
+			continue
+		}
+
+		cols := append([]string{table.PrimaryKeys[0]}, keyColumns...)
+		quoted := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = quoteIdent(col)
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), quoteTable(tableName))
+
+		labels, err := dp.queryIdentities(ctx, db, tableName, cols, query)
+		if err != nil {
+			return fmt.Errorf("failed to load key columns for %s: %w", tableName, err)
+		}
+		dp.identities[tableName] = labels
+		dp.logger.Debug("Loaded row identities", "table", tableName, "rows", len(labels))
+	}
+	return nil
+}
+
+func (dp *DataProcessor) queryIdentities(ctx context.Context, db *sql.DB, tableName string, cols []string, query string) (map[string]string, error) {
+	if err := dp.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer dp.limiter.Release()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	labels := make(map[string]string)
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		if label, ok := dp.keyLabel(tableName, cols, func(i int) []byte { return values[i] }); ok {
+			labels[string(values[0])] = label
+		}
+	}
+	return labels, rows.Err()
+}
+
+// refUID returns the node a foreign key value points at
+func (dp *DataProcessor) refUID(schema *Schema, tableName, columnName, refTable, value string) string {
+	return dp.getOrCreateUID(refTable, dp.refKey(schema, tableName, columnName, refTable, value))
+}
+
+// refKey returns the key of the row a foreign key value points at. For tables
+// with key columns the value is translated to the referenced row's key label,
+// unless the foreign key references the single key column directly.
+func (dp *DataProcessor) refKey(schema *Schema, tableName, columnName, refTable, value string) string {
+	keyColumns := dp.cfg.Output.KeyColumns[refTable]
+	if len(keyColumns) == 0 {
+		return value
+	}
+
+	for _, fk := range schema.Relationships {
+		if fk.TableName == tableName && fk.ColumnName == columnName && fk.RefTableName == refTable {
+			if len(keyColumns) == 1 && fk.RefColumnName == keyColumns[0] {
+				return value
+			}
+			break
+		}
+	}
+
+	if label, ok := dp.identities[refTable][value]; ok {
+		return label
+	}
+	dp.logger.Debug("Foreign key value has no keyed row", "table", tableName, "column", columnName, "value", value)
+	return value
+}
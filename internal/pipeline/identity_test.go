@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// exportRDF exports tables of schema through the chunked exporter and
+// returns the triples written
+func exportRDF(t *testing.T, cfg *config.Config, schema *Schema, tables map[string]*fakeTable) []string {
+	t.Helper()
+	cfg.Output.ChunkSize = 1000
+	db, _ := newFakeDB(t, tablesHandler(tables))
+
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, cfg.Output.ChunkSize)
+	chunks, err := exporter.ExportInChunks(context.Background(), testProcessor(cfg), db, schema, names)
+	if err != nil {
+		t.Fatalf("ExportInChunks: %v", err)
+	}
+
+	var lines []string
+	for _, chunk := range chunks {
+		data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, chunk.Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+	}
+	return lines
+}
+
+// blankLabelPattern is Dgraph's grammar for blank node labels
+var blankLabelPattern = regexp.MustCompile(`^_:[A-Za-z0-9_-]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?$`)
+
+// checkBlankLabels fails for every subject or object blank node Dgraph would
+// reject
+func checkBlankLabels(t *testing.T, lines []string) {
+	t.Helper()
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		for _, term := range []string{fields[0], fields[2]} {
+			if strings.HasPrefix(term, "_:") && !blankLabelPattern.MatchString(term) {
+				t.Errorf("invalid blank node %s in %q", term, line)
+			}
+		}
+	}
+}
+
+func TestBusinessKeyReferences(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.KeyColumns = map[string][]string{"users": {"email"}}
+	schema := &Schema{
+		Tables: map[string]*Table{
+			"users": {
+				Name: "users",
+				Columns: map[string]*Column{
+					"id":    {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+					"email": {Name: "email", Type: "varchar", ColumnType: "varchar(100)", Position: 2},
+				},
+				PrimaryKeys: []string{"id"},
+			},
+			"orders": {
+				Name: "orders",
+				Columns: map[string]*Column{
+					"id":      {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+					"user_id": {Name: "user_id", Type: "int", ColumnType: "int", Position: 2},
+				},
+				PrimaryKeys: []string{"id"},
+			},
+		},
+		Relationships: []ForeignKey{
+			{TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id"},
+		},
+	}
+	users := &fakeTable{columns: []string{"id", "email"}, rows: [][]driver.Value{
+		{int64(1), "ann@example.com"},
+		{int64(2), "ops/bob o'neil:1"},
+		{int64(3), "ann.40example.2Ecom"},
+	}}
+	orders := &fakeTable{columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+		{int64(10), int64(1)},
+		{int64(11), int64(2)},
+	}}
+
+	lines := exportRDF(t, cfg, schema, map[string]*fakeTable{"users": users, "orders": orders})
+	checkBlankLabels(t, lines)
+
+	tests := []struct {
+		email string
+		label string
+		order string
+	}{
+		{"ann@example.com", "_:users_ann.40example.2Ecom", "_:orders_10"},
+		{"ops/bob o'neil:1", "_:users_ops.2Fbob.20o.27neil.3A1", "_:orders_11"},
+		{"ann.40example.2Ecom", "_:users_ann.2E40example.2E2Ecom", ""},
+	}
+	for _, tt := range tests {
+		if !hasLine(lines, tt.label+" <dgraph.type> \"users\" .") {
+			t.Errorf("no users node %s for %q:\n%s", tt.label, tt.email, strings.Join(lines, "\n"))
+		}
+		if tt.order != "" && !hasPrefixSuffix(lines, tt.order+" ", " "+tt.label+" .") {
+			t.Errorf("%s does not reference %s:\n%s", tt.order, tt.label, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestEscapeBlankKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"42", "42"},
+		{"user_1-a", "user_1-a"},
+		{"a@b.c", "a.40b.2Ec"},
+		{"a.40b.2Ec", "a.2E40b.2E2Ec"},
+		{"key with spaces", "key.20with.20spaces"},
+		{"x:y/z", "x.3Ay.2Fz"},
+		{"é", ".C3.A9"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeBlankKey(tt.key); got != tt.want {
+			t.Errorf("escapeBlankKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+// hasLine reports whether lines holds line
+func hasLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrefixSuffix reports whether a line starts with prefix and ends with
+// suffix
+func hasPrefixSuffix(lines []string, prefix, suffix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) && strings.HasSuffix(l, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompositeKeys(t *testing.T) {
+	columns := map[string]*Column{
+		"region": {Name: "region", Type: "varchar", ColumnType: "varchar(20)", Position: 1},
+		"code":   {Name: "code", Type: "varchar", ColumnType: "varchar(20)", Position: 2},
+		"name":   {Name: "name", Type: "varchar", ColumnType: "varchar(20)", Position: 3},
+	}
+	rows := [][]driver.Value{
+		{"a_b", "c", "first"},
+		{"a", "b_c", "second"},
+	}
+	tests := []struct {
+		name       string
+		keyColumns map[string][]string
+		primary    []string
+	}{
+		{name: "composite primary key", primary: []string{"region", "code"}},
+		{name: "composite key columns", keyColumns: map[string][]string{"sites": {"region", "code"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.KeyColumns = tt.keyColumns
+			schema := &Schema{Tables: map[string]*Table{
+				"sites": {Name: "sites", Columns: columns, PrimaryKeys: tt.primary},
+			}}
+			table := &fakeTable{columns: []string{"region", "code", "name"}, rows: rows}
+
+			lines := exportRDF(t, cfg, schema, map[string]*fakeTable{"sites": table})
+			checkBlankLabels(t, lines)
+			for _, want := range []string{
+				`_:sites_3_a_b_1_c <sites.name> "first" .`,
+				`_:sites_1_a_3_b_c <sites.name> "second" .`,
+			} {
+				if !hasLine(lines, want) {
+					t.Errorf("missing %s in:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+		})
+	}
+}
+
+func TestJoinKey(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"42"}, "42"},
+		{[]string{"a_b"}, "a_b"},
+		{[]string{"7", "2"}, "1_7_1_2"},
+		{[]string{"a_b", "c"}, "3_a_b_1_c"},
+		{[]string{"a", "b_c"}, "1_a_3_b_c"},
+		{[]string{"", "x"}, "0__1_x"},
+	}
+	for _, tt := range tests {
+		if got := joinKey(tt.parts); got != tt.want {
+			t.Errorf("joinKey(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
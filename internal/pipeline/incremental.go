@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// Watermarks tracks the highest value of pipeline.incremental's watermark
+// column per table. The values saved by one run restrict the next run to
+// rows with a later watermark. A nil Watermarks, used when incremental
+// export is off, filters and records nothing.
+type Watermarks struct {
+	column string
+
+	mu       sync.Mutex
+	previous map[string]string // table -> watermark saved by the last run
+	current  map[string]string // table -> highest watermark read in this run
+}
+
+// LoadWatermarks reads the watermarks saved by a previous run. A missing file
+// yields no watermarks, so the first run exports every row.
+func LoadWatermarks(path, column string) (*Watermarks, error) {
+	w := &Watermarks{
+		column:   column,
+		previous: make(map[string]string),
+		current:  make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watermark file: %w", err)
+	}
+	if err := json.Unmarshal(data, &w.previous); err != nil {
+		return nil, fmt.Errorf("failed to parse watermark file %s: %w", path, err)
+	}
+	return w, nil
+}
+
+// Filters returns the table_filters with each watermarked table further
+// restricted to rows past its watermark
+func (w *Watermarks) Filters(tableFilters map[string]string) map[string]string {
+	if w == nil || len(w.previous) == 0 {
+		return tableFilters
+	}
+
+	filters := make(map[string]string, len(tableFilters)+len(w.previous))
+	for table, filter := range tableFilters {
+		filters[table] = filter
+	}
+	for table, mark := range w.previous {
+		condition := fmt.Sprintf("%s > %s", quoteIdent(w.column), quoteSQLString(mark))
+		if filter, ok := filters[table]; ok {
+			condition = "(" + filter + ") AND " + condition
+		}
+		filters[table] = condition
+	}
+	return filters
+}
+
+// Column returns the watermark column, or "" when incremental export is off
+func (w *Watermarks) Column() string {
+	if w == nil {
+		return ""
+	}
+	return w.column
+}
+
+// Observe records a watermark value read from a table
+func (w *Watermarks) Observe(table, value string) {
+	if w == nil || value == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if current, ok := w.current[table]; !ok || laterWatermark(value, current) {
+		w.current[table] = value
+	}
+}
+
+// Save writes the watermarks for the next run: this run's highest values,
+// and the previous ones of tables that had no new rows or were not exported
+func (w *Watermarks) Save(path string) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	merged := make(map[string]string, len(w.previous)+len(w.current))
+	for table, mark := range w.previous {
+		merged[table] = mark
+	}
+	for table, mark := range w.current {
+		merged[table] = mark
+	}
+	w.mu.Unlock()
+
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Tables returns the tables with a watermark from this run, sorted
+func (w *Watermarks) Tables() []string {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tables := make([]string, 0, len(w.current))
+	for table := range w.current {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// checkIncremental warns about tables an incremental run cannot update in
+// place. Rows are matched across runs by their blank node label, which comes
+// from key_columns or the primary key; rows of tables with neither are
+// labeled by a hash of their values, so an updated row becomes a new node.
+// Tables without the watermark column are exported in full on every run.
+func checkIncremental(cfg *config.Config, schema *Schema, logger *logger.Logger) {
+	if !cfg.Pipeline.Incremental.Enabled {
+		return
+	}
+	column := cfg.Pipeline.Incremental.WatermarkColumn
+
+	tableNames := make([]string, 0, len(schema.Tables))
+	for tableName := range schema.Tables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		table := schema.Tables[tableName]
+		if table.Columns[column] == nil {
+			logger.Info("Table has no watermark column, exporting all rows", "table", tableName, "column", column)
+			continue
+		}
+		if len(table.PrimaryKeys) == 0 && len(cfg.Output.KeyColumns[tableName]) == 0 {
+			logger.Warn("Table has no primary key or key_columns; updated rows will be exported as new nodes",
+				"table", tableName)
+		}
+	}
+}
+
+// laterWatermark reports whether a is after b. Numbers compare numerically;
+// anything else, including MySQL's DATETIME text, compares as a string.
+func laterWatermark(a, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return x > y
+	}
+	return a > b
+}
+
+// quoteSQLString quotes a value as a MySQL string literal
+func quoteSQLString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `''`)
+	return "'" + value + "'"
+}
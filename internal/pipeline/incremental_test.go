@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestWatermarksFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous map[string]string
+		filters  map[string]string // table_filters
+		want     map[string]string
+	}{
+		{name: "first run", filters: map[string]string{"users": "deleted_at IS NULL"}, want: map[string]string{"users": "deleted_at IS NULL"}},
+		{
+			name:     "watermarked table",
+			previous: map[string]string{"users": "2024-01-01 10:00:00"},
+			want:     map[string]string{"users": "`updated_at` > '2024-01-01 10:00:00'"},
+		},
+		{
+			name:     "combined with a table filter",
+			previous: map[string]string{"users": "2024-01-01 10:00:00"},
+			filters:  map[string]string{"users": "a = 1 OR b = 2", "orders": "total > 0"},
+			want: map[string]string{
+				"users":  "(a = 1 OR b = 2) AND `updated_at` > '2024-01-01 10:00:00'",
+				"orders": "total > 0",
+			},
+		},
+		{
+			name:     "quoted watermark",
+			previous: map[string]string{"notes": `it's \ odd`},
+			want:     map[string]string{"notes": `` + "`updated_at`" + ` > 'it''s \\ odd'`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "watermarks.json")
+			if tt.previous != nil {
+				data, _ := json.Marshal(tt.previous)
+				writeFile(t, path, string(data))
+			}
+			w, err := LoadWatermarks(path, "updated_at")
+			if err != nil {
+				t.Fatalf("LoadWatermarks: %v", err)
+			}
+			got := w.Filters(tt.filters)
+			if len(got) != len(tt.want) {
+				t.Errorf("Filters = %v, want %v", got, tt.want)
+			}
+			for table, want := range tt.want {
+				if got[table] != want {
+					t.Errorf("%s filter = %q, want %q", table, got[table], want)
+				}
+			}
+		})
+	}
+
+	var off *Watermarks
+	if got := off.Filters(map[string]string{"users": "x"}); got["users"] != "x" || off.Column() != "" {
+		t.Errorf("nil watermarks: Filters = %v, Column = %q", got, off.Column())
+	}
+}
+
+func TestWatermarksObserveAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	writeFile(t, path, `{"users": "2024-01-01 00:00:00", "archived": "2020-01-01 00:00:00"}`)
+	w, err := LoadWatermarks(path, "updated_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observed := []struct{ table, value string }{
+		{"users", "2024-03-01 00:00:00"},
+		{"users", "2024-05-01 12:00:00"},
+		{"users", "2024-02-01 00:00:00"},
+		{"users", ""},
+		// Numbers compare numerically, not as text
+		{"events", "9"},
+		{"events", "10"},
+		{"events", "2"},
+	}
+	for _, o := range observed {
+		w.Observe(o.table, o.value)
+	}
+	if got := w.Tables(); !slices.Equal(got, []string{"events", "users"}) {
+		t.Errorf("Tables = %v", got)
+	}
+	if err := w.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var saved map[string]string
+	if err := json.Unmarshal([]byte(readFile(t, path)), &saved); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"users": "2024-05-01 12:00:00", "events": "10", "archived": "2020-01-01 00:00:00"}
+	if len(saved) != len(want) {
+		t.Errorf("saved %v, want %v", saved, want)
+	}
+	for table, mark := range want {
+		if saved[table] != mark {
+			t.Errorf("saved %s = %q, want %q", table, saved[table], mark)
+		}
+	}
+
+	writeFile(t, path, "{not json")
+	if _, err := LoadWatermarks(path, "updated_at"); err == nil || !strings.Contains(err.Error(), "failed to parse watermark file") {
+		t.Errorf("LoadWatermarks of a corrupt file = %v", err)
+	}
+}
+
+func TestLaterWatermark(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"10", "9", true},
+		{"9", "10", false},
+		{"1.5", "1.25", true},
+		{"2024-05-01 00:00:00", "2024-04-30 23:59:59", true},
+		{"2024-05-01 00:00:00", "2024-05-01 00:00:00", false},
+		{"2024-05-01 00:00:00.5", "2024-05-01 00:00:00", true},
+	}
+	for _, tt := range tests {
+		if got := laterWatermark(tt.a, tt.b); got != tt.want {
+			t.Errorf("laterWatermark(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// watermarkPattern finds the incremental condition of a row or count query
+var watermarkPattern = regexp.MustCompile("`updated_at` > '([^']*)'")
+
+// incrementalServe serves info, keeping only rows of a table past the
+// watermark its query asks for, as MySQL would
+func incrementalServe(info func() *infoSchema) fakeHandler {
+	return func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		current := info()
+		if match := watermarkPattern.FindStringSubmatch(query); match != nil {
+			for _, table := range current.rows {
+				at := slices.Index(table.columns, "updated_at")
+				if at < 0 {
+					continue
+				}
+				var later [][]driver.Value
+				for _, row := range table.rows {
+					if fmt.Sprint(row[at]) > match[1] {
+						later = append(later, row)
+					}
+				}
+				table.rows = later
+			}
+		}
+		return current.serve(query, args)
+	}
+}
+
+// TestIncrementalRuns runs two incremental exports into the same directory,
+// updating one user and adding another in between
+func TestIncrementalRuns(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.SkipValidation = true
+	cfg.Pipeline.Incremental.Enabled = true
+	cfg.Pipeline.Incremental.WatermarkColumn = "updated_at"
+
+	users := [][]driver.Value{
+		{int64(1), "Ada", "2024-01-01 10:00:00"},
+		{int64(2), "Bob", "2024-01-02 10:00:00"},
+	}
+	info := func() *infoSchema {
+		s := shopSchema()
+		s.columns["users"] = append(s.columns["users"], fakeColumn{name: "updated_at", dataType: "datetime", columnType: "datetime"})
+		rows := make([][]driver.Value, len(users))
+		for i, row := range users {
+			rows[i] = slices.Clone(row)
+		}
+		s.rows["users"] = &fakeTable{columns: []string{"id", "name", "updated_at"}, rows: rows}
+		return s
+	}
+	run := func() (int64, []string) {
+		t.Helper()
+		cfg.MySQL.Database = "shop"
+		db, _ := newFakeDB(t, incrementalServe(info))
+		p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+		if err != nil {
+			t.Fatalf("NewWithDB: %v", err)
+		}
+		defer p.Stop()
+		result, err := p.Run(context.Background(), ModeData, RunOptions{})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		var names []string
+		for _, line := range strings.Split(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)), "\n") {
+			if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "users.name" {
+				names = append(names, match[1]+" "+match[3])
+			}
+		}
+		slices.Sort(names)
+		return result.ProcessedRows, names
+	}
+	watermarks := func() map[string]string {
+		var saved map[string]string
+		if err := json.Unmarshal([]byte(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.WatermarkFile))), &saved); err != nil {
+			t.Fatal(err)
+		}
+		return saved
+	}
+
+	// Orders have no watermark column and are exported in full both times
+	rows, names := run()
+	if want := []string{"_:users_1 Ada", "_:users_2 Bob"}; rows != 5 || !slices.Equal(names, want) {
+		t.Errorf("first run: %d rows, users %v, want 5 rows and %v", rows, names, want)
+	}
+	if got := watermarks(); len(got) != 1 || got["users"] != "2024-01-02 10:00:00" {
+		t.Errorf("first run watermarks = %v", got)
+	}
+
+	users[0][1], users[0][2] = "Ada Lovelace", "2024-02-01 09:00:00"
+	users = append(users, []driver.Value{int64(3), "Cy", "2024-02-01 08:00:00"})
+	rows, names = run()
+	// The updated user keeps its label, so loading it overwrites the node
+	if want := []string{"_:users_1 Ada Lovelace", "_:users_3 Cy"}; rows != 5 || !slices.Equal(names, want) {
+		t.Errorf("second run: %d rows, users %v, want 5 rows and %v", rows, names, want)
+	}
+	if got := watermarks(); got["users"] != "2024-02-01 09:00:00" {
+		t.Errorf("second run watermarks = %v", got)
+	}
+
+	// Nothing changed since
+	rows, names = run()
+	if rows != 3 || len(names) != 0 {
+		t.Errorf("third run: %d rows, users %v, want only the 3 orders", rows, names)
+	}
+	if got := watermarks(); got["users"] != "2024-02-01 09:00:00" {
+		t.Errorf("third run watermarks = %v", got)
+	}
+}
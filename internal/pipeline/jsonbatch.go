@@ -0,0 +1,369 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/sink"
+)
+
+// JSONBatchWriter converts the processor's triples into Dgraph JSON mutations
+// and writes them as batch_NNNN.json files, each holding {"set":[...]}.
+// Triples are grouped by subject so one row becomes one object; an edge is
+// written as {"uid": "_:target"}, with its facets as "predicate|facet" keys.
+// With an upsert predicate each file is an upsert block instead, holding a
+// "query" beside "set" that finds the batch's nodes by that predicate.
+type JSONBatchWriter struct {
+	directory string
+	batchSize int
+
+	literal     func(predicate, value string) interface{} // Types literal values; nil keeps strings
+	compression string                                    // output.compression applied to each batch file
+	sink        sink.Sink                                 // Stores the batch files; nil writes them to directory
+	upsert      string                                    // Predicate upsert blocks match nodes by; empty writes plain mutations
+	xids        map[string]string                         // Upsert predicate value of every node seen, so later batches still match it
+
+	nodes   map[string]map[string]interface{}
+	order   []string
+	batches int
+}
+
+func NewJSONBatchWriter(directory string, batchSize int) *JSONBatchWriter {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &JSONBatchWriter{
+		directory: directory,
+		batchSize: batchSize,
+		nodes:     make(map[string]map[string]interface{}),
+	}
+}
+
+// SetLiteralConverter sets the function that converts literal values to
+// typed JSON values
+func (w *JSONBatchWriter) SetLiteralConverter(literal func(predicate, value string) interface{}) {
+	w.literal = literal
+}
+
+// SetCompression sets the output.compression method batch files are
+// written with
+func (w *JSONBatchWriter) SetCompression(method string) {
+	w.compression = method
+}
+
+// SetSink sets the sink batch files are stored through
+func (w *JSONBatchWriter) SetSink(s sink.Sink) {
+	w.sink = s
+}
+
+// SetUpsertPredicate makes every batch an upsert block matching nodes by
+// predicate, so edges to nodes written by other batch files resolve
+func (w *JSONBatchWriter) SetUpsertPredicate(predicate string) {
+	w.upsert = predicate
+	w.xids = make(map[string]string)
+}
+
+// Batches returns the number of batch files written so far
+func (w *JSONBatchWriter) Batches() int {
+	return w.batches
+}
+
+// Add groups RDF triples into node objects, writing a batch file whenever
+// batch_size nodes are pending
+func (w *JSONBatchWriter) Add(lines []string) error {
+	for _, line := range lines {
+		subject, predicate, object, facets, isUID, ok := parseTriple(line)
+		if !ok {
+			continue
+		}
+
+		node := w.nodes[subject]
+		if node == nil {
+			if len(w.order) >= w.batchSize {
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			node = map[string]interface{}{"uid": subject}
+			w.nodes[subject] = node
+			w.order = append(w.order, subject)
+		}
+
+		// A node's ID is single-valued, however many rows reference the node
+		if predicate == w.upsert {
+			w.xids[subject] = object
+			if node[predicate] != nil {
+				continue
+			}
+		}
+
+		var value interface{} = object
+		switch {
+		case isUID:
+			edge := map[string]interface{}{"uid": object}
+			for key, facet := range facets {
+				edge[predicate+"|"+key] = facet
+			}
+			value = edge
+		case w.literal != nil:
+			value = w.literal(predicate, object)
+		}
+
+		// Repeated predicates (reverse edges, SET members) become lists
+		switch existing := node[predicate].(type) {
+		case nil:
+			node[predicate] = value
+		case []interface{}:
+			node[predicate] = append(existing, value)
+		default:
+			node[predicate] = []interface{}{existing, value}
+		}
+	}
+	return nil
+}
+
+// Flush writes the pending nodes as the next batch file
+func (w *JSONBatchWriter) Flush() error {
+	if len(w.order) == 0 {
+		return nil
+	}
+
+	set := make([]map[string]interface{}, 0, len(w.order))
+	for _, subject := range w.order {
+		set = append(set, w.nodes[subject])
+	}
+
+	mutation := map[string]interface{}{"set": set}
+	if w.upsert != "" {
+		if query := w.upsertQuery(set); query != "" {
+			mutation["query"] = query
+		}
+	}
+	data, err := json.Marshal(mutation)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON batch: %w", err)
+	}
+
+	w.batches++
+	name := fmt.Sprintf("batch_%04d.json%s", w.batches, compress.Extension(w.compression))
+	if err := w.writeBatch(name, data); err != nil {
+		return fmt.Errorf("failed to write JSON batch: %w", err)
+	}
+
+	w.nodes = make(map[string]map[string]interface{})
+	w.order = w.order[:0]
+	return nil
+}
+
+// upsertQuery builds the query of a batch's upsert block. Every node whose
+// upsert predicate value is known, from this batch or an earlier one, is bound
+// to a variable matching the node with the same value, and the node and every
+// edge pointing at it become uid(vN) carrying that value: a node already
+// imported by another batch is updated and linked, and a missing one is
+// created with its value so the batch writing it later finds it.
+func (w *JSONBatchWriter) upsertQuery(set []map[string]interface{}) string {
+	vars := make(map[string]string)
+	inSet := make(map[string]bool, len(set))
+	var query strings.Builder
+	bind := func(object map[string]interface{}) {
+		label, ok := object["uid"].(string)
+		if !ok {
+			return
+		}
+		id, ok := w.xids[label]
+		if !ok {
+			return
+		}
+		uid, ok := vars[label]
+		if !ok {
+			v := fmt.Sprintf("v%d", len(vars))
+			uid = "uid(" + v + ")"
+			vars[label] = uid
+			fmt.Fprintf(&query, "  %s as var(func: eq(%s, \"%s\"))\n", v, w.upsert, escapeRDFLiteral(id))
+		}
+		object["uid"] = uid
+		if !inSet[label] {
+			object[w.upsert] = id
+		}
+	}
+
+	// Nodes of the batch hold their value; edges to other nodes carry it
+	for _, node := range set {
+		label := node["uid"].(string)
+		bind(node)
+		inSet[label] = true
+	}
+	for _, node := range set {
+		predicates := make([]string, 0, len(node))
+		for predicate := range node {
+			predicates = append(predicates, predicate)
+		}
+		sort.Strings(predicates)
+		for _, predicate := range predicates {
+			resolveEdges(node[predicate], bind)
+		}
+	}
+	if len(vars) == 0 {
+		return ""
+	}
+	return "{\n" + query.String() + "}"
+}
+
+// resolveEdges binds the edges held in a node's value to their variables
+func resolveEdges(value interface{}, bind func(map[string]interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		bind(v)
+	case []interface{}:
+		for _, item := range v {
+			resolveEdges(item, bind)
+		}
+	}
+}
+
+// parseTriple splits a triple produced by convertRowToRDF into its parts.
+// isUID reports whether the object is a node reference rather than a literal;
+// facets are those of an edge, if any.
+func parseTriple(line string) (subject, predicate, object string, facets map[string]interface{}, isUID, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", "", nil, false, false
+	}
+	line = strings.TrimSpace(strings.TrimSuffix(line, "."))
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "<") || !strings.HasSuffix(parts[1], ">") {
+		return "", "", "", nil, false, false
+	}
+	subject = parts[0]
+	predicate = strings.Trim(parts[1], "<>")
+	object = strings.TrimSpace(parts[2])
+
+	if strings.HasPrefix(object, "\"") {
+		end := strings.LastIndex(object, "\"")
+		if end <= 0 {
+			return "", "", "", nil, false, false
+		}
+		// A language tag moves to the key, as in {"name@de": "..."}
+		if lang := object[end+1:]; strings.HasPrefix(lang, "@") {
+			predicate += lang
+		}
+		return subject, predicate, unescapeRDFValue(object[1:end]), nil, false, true
+	}
+	if node, list, found := strings.Cut(object, " "); found {
+		facets, ok = parseFacets(strings.TrimSpace(list))
+		if !ok {
+			return "", "", "", nil, false, false
+		}
+		object = node
+	}
+	return subject, predicate, object, facets, true, true
+}
+
+// parseFacets parses an edge's facet list, "(key=value, ...)". Quoted values
+// are strings; bare values are numbers or booleans when they parse as one and
+// strings, such as datetimes, otherwise.
+func parseFacets(list string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return nil, false
+	}
+	list = list[1 : len(list)-1]
+
+	facets := make(map[string]interface{})
+	for strings.TrimSpace(list) != "" {
+		key, rest, found := strings.Cut(list, "=")
+		if !found {
+			return nil, false
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimLeft(rest, " ")
+
+		if !strings.HasPrefix(rest, "\"") {
+			var value string
+			value, list, _ = strings.Cut(rest, ",")
+			facets[key] = facetJSONValue(strings.TrimSpace(value))
+			continue
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return nil, false
+		}
+		facets[key] = unescapeRDFValue(rest[1:end])
+
+		rest = strings.TrimSpace(rest[end+1:])
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return nil, false
+		}
+		list = strings.TrimPrefix(rest, ",")
+	}
+	return facets, true
+}
+
+// facetJSONValue types a bare facet value
+func facetJSONValue(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+	return value
+}
+
+// unescapeRDFValue reverses escapeRDFValue
+func unescapeRDFValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		default:
+			sb.WriteByte(value[i])
+		}
+	}
+	return sb.String()
+}
+
+// writeBatch writes a batch file through the sink and compression method
+func (w *JSONBatchWriter) writeBatch(name string, data []byte) error {
+	s := w.sink
+	if s == nil {
+		s = sink.New(sink.Options{Kind: sink.Local, Directory: w.directory})
+	}
+	file, err := s.Create(name, false)
+	if err != nil {
+		return err
+	}
+	writer := compress.NewWriter(file, w.compression)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
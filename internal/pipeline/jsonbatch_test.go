@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTriple(t *testing.T) {
+	tests := []struct {
+		line      string
+		subject   string
+		predicate string
+		object    string
+		facets    map[string]interface{}
+		isUID     bool
+		ok        bool
+	}{
+		{line: `_:users_1 <users.name> "Ada \"A\"" .`, subject: "_:users_1", predicate: "users.name", object: `Ada "A"`, ok: true},
+		{line: `_:users_1 <users.age> "36"^^<xs:int> .`, subject: "_:users_1", predicate: "users.age", object: "36", ok: true},
+		{line: `_:orders_1 <orders.user> _:users_1 .`, subject: "_:orders_1", predicate: "orders.user", object: "_:users_1", isUID: true, ok: true},
+		{
+			line:    `_:users_1 <users.roles> _:roles_2 (assigned_at=2024-01-01T00:00:00Z) .`,
+			subject: "_:users_1", predicate: "users.roles", object: "_:roles_2",
+			facets: map[string]interface{}{"assigned_at": "2024-01-01T00:00:00Z"},
+			isUID:  true, ok: true,
+		},
+		{line: `_:users_1 <users.roles> _:roles_2 (assigned_at=) junk .`},
+		{line: `_:users_1 <users.name> "unterminated .`},
+		{line: `_:users_1 .`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			subject, predicate, object, facets, isUID, ok := parseTriple(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if subject != tt.subject || predicate != tt.predicate || object != tt.object || isUID != tt.isUID {
+				t.Errorf("parsed %q %q %q uid %v, want %q %q %q uid %v",
+					subject, predicate, object, isUID, tt.subject, tt.predicate, tt.object, tt.isUID)
+			}
+			if !reflect.DeepEqual(facets, tt.facets) {
+				t.Errorf("facets = %v, want %v", facets, tt.facets)
+			}
+		})
+	}
+}
+
+func TestParseFacets(t *testing.T) {
+	tests := []struct {
+		list   string
+		facets map[string]interface{}
+		ok     bool
+	}{
+		{list: "()", facets: map[string]interface{}{}, ok: true},
+		{list: "(since=2024-01-01T00:00:00Z)", facets: map[string]interface{}{"since": "2024-01-01T00:00:00Z"}, ok: true},
+		{
+			list:   `(weight=3, ratio=0.5, active=true, note="a, \"b\"")`,
+			facets: map[string]interface{}{"weight": int64(3), "ratio": 0.5, "active": true, "note": `a, "b"`},
+			ok:     true,
+		},
+		{list: "since=2024"},
+		{list: "(since)"},
+		{list: `(note="unterminated)`},
+		{list: `(note="a" b)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			facets, ok := parseFacets(tt.list)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(facets, tt.facets) {
+				t.Errorf("facets = %#v, want %#v", facets, tt.facets)
+			}
+		})
+	}
+}
+
+// TestJSONBatchUpsert writes an order referencing a user, in one batch and
+// split across batches, and checks every node and edge with an xid is
+// matched by it, whichever batch wrote the xid
+func TestJSONBatchUpsert(t *testing.T) {
+	// Lines as the processor writes them with json_upsert: the referenced
+	// node's xid precedes the edge
+	lines := []string{
+		`_:orders_1 <xid> "orders:1" .`,
+		`_:users_1 <xid> "users:1" .`,
+		`_:orders_1 <orders.user> _:users_1 .`,
+		`_:orders_1 <orders.tag> _:tags_1 .`,
+		`_:users_1 <xid> "users:1" .`,
+		`_:users_1 <users.name> "Ada" .`,
+	}
+	tests := []struct {
+		name      string
+		batchSize int
+		batches   []string
+	}{
+		{
+			name:      "one batch",
+			batchSize: 2,
+			batches: []string{`{
+				"query": "{\n  v0 as var(func: eq(xid, \"orders:1\"))\n  v1 as var(func: eq(xid, \"users:1\"))\n}",
+				"set": [
+					{"uid": "uid(v0)", "xid": "orders:1", "orders.user": {"uid": "uid(v1)"}, "orders.tag": {"uid": "_:tags_1"}},
+					{"uid": "uid(v1)", "xid": "users:1", "users.name": "Ada"}]}`},
+		},
+		{
+			name:      "batch per node",
+			batchSize: 1,
+			batches: []string{
+				`{"query": "{\n  v0 as var(func: eq(xid, \"orders:1\"))\n}", "set": [{"uid": "uid(v0)", "xid": "orders:1"}]}`,
+				`{"query": "{\n  v0 as var(func: eq(xid, \"users:1\"))\n}", "set": [{"uid": "uid(v0)", "xid": "users:1"}]}`,
+				// The order's xid and the user's came in earlier batches
+				`{
+					"query": "{\n  v0 as var(func: eq(xid, \"orders:1\"))\n  v1 as var(func: eq(xid, \"users:1\"))\n}",
+					"set": [{"uid": "uid(v0)", "xid": "orders:1", "orders.user": {"uid": "uid(v1)", "xid": "users:1"}, "orders.tag": {"uid": "_:tags_1"}}]}`,
+				`{"query": "{\n  v0 as var(func: eq(xid, \"users:1\"))\n}", "set": [{"uid": "uid(v0)", "xid": "users:1", "users.name": "Ada"}]}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w := NewJSONBatchWriter(dir, tt.batchSize)
+			w.SetUpsertPredicate(xidPredicate)
+			if err := w.Add(lines); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+			if w.Batches() != len(tt.batches) {
+				t.Fatalf("%d batches, want %d", w.Batches(), len(tt.batches))
+			}
+			for i, want := range tt.batches {
+				data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("batch_%04d.json", i+1)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got, wantBatch interface{}
+				if err := json.Unmarshal(data, &got); err != nil {
+					t.Fatalf("batch %d: %v", i+1, err)
+				}
+				if err := json.Unmarshal([]byte(want), &wantBatch); err != nil {
+					t.Fatalf("want %d: %v", i+1, err)
+				}
+				if !reflect.DeepEqual(got, wantBatch) {
+					t.Errorf("batch %d:\n%s\nwant:\n%s", i+1, data, want)
+				}
+			}
+		})
+	}
+}
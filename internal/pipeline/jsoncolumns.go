@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// jsonField is one top-level key of an expanded JSON column value
+type jsonField struct {
+	Key     string
+	Literal string // Typed RDF literal
+}
+
+// expandJSONObject returns a literal for each top-level key of a JSON object,
+// sorted by key, for pipeline.expand_json_columns. Strings, numbers and
+// booleans become typed literals; nested objects and arrays are kept as
+// compact JSON strings and null keys are left out. It returns false for
+// values that are not a JSON object, which are written as a plain string.
+func expandJSONObject(raw []byte) ([]jsonField, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil || decoder.More() {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]jsonField, 0, len(keys))
+	for _, key := range keys {
+		var literal string
+		switch v := object[key].(type) {
+		case nil:
+			continue
+		case string:
+			literal = `"` + escapeRDFLiteral(v) + `"`
+		case bool:
+			literal = typedLiteral("bool", strconv.FormatBool(v))
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				literal = typedLiteral("int", v.String())
+			} else {
+				literal = typedLiteral("float", v.String())
+			}
+		default:
+			nested, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			literal = `"` + escapeRDFLiteral(string(nested)) + `"`
+		}
+		fields = append(fields, jsonField{Key: key, Literal: literal})
+	}
+	return fields, true
+}
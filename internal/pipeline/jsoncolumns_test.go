@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandJSONObject(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []jsonField // nil when the value is not expanded
+	}{
+		{
+			name: "scalars",
+			raw:  `{"name": "Ada", "age": 36, "score": 9.5, "admin": true, "big": 12345678901234567890}`,
+			want: []jsonField{
+				{"admin", `"true"^^<xs:boolean>`},
+				{"age", `"36"^^<xs:int>`},
+				{"big", `"12345678901234567890"^^<xs:float>`},
+				{"name", `"Ada"`},
+				{"score", `"9.5"^^<xs:float>`},
+			},
+		},
+		{
+			name: "nested objects and arrays stay JSON",
+			raw:  `{"address": {"city": "London", "zip": "N1"}, "tags": ["a", "b"], "matrix": [[1, 2], [3]], "empty": {}}`,
+			want: []jsonField{
+				{"address", `"{\"city\":\"London\",\"zip\":\"N1\"}"`},
+				{"empty", `"{}"`},
+				{"matrix", `"[[1,2],[3]]"`},
+				{"tags", `"[\"a\",\"b\"]"`},
+			},
+		},
+		{
+			name: "null keys are left out",
+			raw:  `{"a": null, "b": "x"}`,
+			want: []jsonField{{"b", `"x"`}},
+		},
+		{
+			name: "strings are escaped",
+			raw:  `{"quote": "say \"hi\"\nbye"}`,
+			want: []jsonField{{"quote", `"say \"hi\"\nbye"`}},
+		},
+		{name: "empty object", raw: `{}`, want: []jsonField{}},
+		{name: "array", raw: `[1, 2]`},
+		{name: "string", raw: `"text"`},
+		{name: "number", raw: `42`},
+		{name: "null", raw: `null`},
+		{name: "invalid", raw: `{"a": `},
+		{name: "trailing value", raw: `{"a": 1} {"b": 2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := expandJSONObject([]byte(tt.raw))
+			if ok != (tt.want != nil) {
+				t.Fatalf("expandJSONObject(%s) expanded: %v, want %v", tt.raw, ok, tt.want != nil)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandJSONObject(%s) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpandJSONColumns exports a JSON column with and without
+// expand_json_columns
+func TestExpandJSONColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		expand bool
+		rule   string // Column rule for users.profile
+		raw    string
+		want   []string // Triples of user 1 besides its type, id and name
+	}{
+		{
+			name:   "expanded object",
+			expand: true,
+			raw:    `{"city": "London", "age": 36, "langs": ["en", "fr"], "meta": {"vip": true}}`,
+			want: []string{
+				`_:users_1 <users.profile.age> "36"^^<xs:int> .`,
+				`_:users_1 <users.profile.city> "London" .`,
+				`_:users_1 <users.profile.langs> "[\"en\",\"fr\"]" .`,
+				`_:users_1 <users.profile.meta> "{\"vip\":true}" .`,
+			},
+		},
+		{
+			name:   "array stays a string",
+			expand: true,
+			raw:    `["en", "fr"]`,
+			want:   []string{`_:users_1 <users.profile> "[\"en\", \"fr\"]" .`},
+		},
+		{
+			name:   "invalid JSON stays a string",
+			expand: true,
+			raw:    `{"city": "Lon`,
+			want:   []string{`_:users_1 <users.profile> "{\"city\": \"Lon" .`},
+		},
+		{
+			name: "disabled",
+			raw:  `{"city": "London"}`,
+			want: []string{`_:users_1 <users.profile> "{\"city\": \"London\"}" .`},
+		},
+		{
+			name:   "column rule wins",
+			expand: true,
+			rule:   "redact",
+			raw:    `{"city": "London"}`,
+			want:   []string{`_:users_1 <users.profile> "***" .`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.ExpandJSONColumns = tt.expand
+			if tt.rule != "" {
+				cfg.Pipeline.ColumnRules = map[string]string{"users.profile": tt.rule}
+			}
+			schema := usersSchema(1)
+			schema.Tables["users"].Columns["profile"] = &Column{Name: "profile", Type: "json", ColumnType: "json", Position: 3}
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{"users": {
+				columns: []string{"id", "name", "profile"},
+				rows:    [][]driver.Value{{int64(1), "Ada", []byte(tt.raw)}},
+			}})
+
+			var got []string
+			for _, line := range lines {
+				if strings.Contains(line, "<users.profile") {
+					got = append(got, line)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("profile triples:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
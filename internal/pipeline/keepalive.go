@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// pinger is the part of *sql.DB the keepalive uses
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// keepAlive pings db every interval until ctx is cancelled, so a pooled
+// connection is not dropped by the server's wait_timeout during long phases
+// without queries, such as schema extraction. The pool discards a connection
+// whose ping fails; the ping is retried at once on a fresh connection.
+func keepAlive(ctx context.Context, db pinger, interval time.Duration, name string, logger *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := db.PingContext(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("MySQL keepalive ping failed, reconnecting", "connection", name, "error", err)
+			err = db.PingContext(ctx)
+		}
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			failed = true
+			logger.Error("MySQL reconnect failed", "connection", name, "error", err)
+		case failed:
+			failed = false
+			logger.Info("MySQL connection restored", "connection", name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// fakePinger fails its first pings with errs and counts every ping
+type fakePinger struct {
+	mu    sync.Mutex
+	errs  []error
+	pings int
+}
+
+func (p *fakePinger) PingContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pings++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (p *fakePinger) Pings() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pings
+}
+
+// TestKeepAlive idles for a few intervals and checks the pings made and the
+// reconnects logged
+func TestKeepAlive(t *testing.T) {
+	dropped := errors.New("invalid connection")
+	tests := []struct {
+		name  string
+		errs  []error
+		pings int      // Wait for this many pings before stopping
+		logs  []string // Messages logged, in order
+		quiet []string // Messages not logged
+	}{
+		{
+			name:  "healthy",
+			pings: 3,
+			quiet: []string{"reconnecting", "reconnect failed"},
+		},
+		{
+			name:  "dropped connection is replaced",
+			errs:  []error{dropped},
+			pings: 3,
+			logs:  []string{"MySQL keepalive ping failed, reconnecting"},
+			quiet: []string{"reconnect failed", "connection restored"},
+		},
+		{
+			name:  "failed reconnect is retried next interval",
+			errs:  []error{dropped, dropped},
+			pings: 3,
+			logs:  []string{"MySQL keepalive ping failed, reconnecting", "MySQL reconnect failed", "MySQL connection restored"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakePinger{errs: tt.errs}
+			var logged syncBuffer
+			log := logger.New("info", "text")
+			log.SetOutput(&logged)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				keepAlive(ctx, db, 5*time.Millisecond, "primary", log)
+			}()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for db.Pings() < tt.pings && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("keepAlive did not stop when cancelled")
+			}
+
+			if db.Pings() < tt.pings {
+				t.Fatalf("%d pings, want at least %d", db.Pings(), tt.pings)
+			}
+			output := logged.String()
+			last := -1
+			for _, msg := range tt.logs {
+				at := strings.Index(output, msg)
+				if at <= last {
+					t.Errorf("%q not logged after the previous message:\n%s", msg, output)
+				}
+				last = at
+			}
+			for _, msg := range tt.quiet {
+				if strings.Contains(output, msg) {
+					t.Errorf("%q logged:\n%s", msg, output)
+				}
+			}
+		})
+	}
+}
+
+// TestKeepAliveIdleBeforeFirstInterval checks nothing is pinged until an
+// interval has passed
+func TestKeepAliveIdleBeforeFirstInterval(t *testing.T) {
+	db := &fakePinger{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	keepAlive(ctx, db, time.Hour, "primary", logger.New("error", "text"))
+	if db.Pings() != 0 {
+		t.Errorf("%d pings within the first interval", db.Pings())
+	}
+}
+
+// syncBuffer is a strings.Builder safe to write from the keepalive goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,39 @@
+package pipeline
+
+import "context"
+
+// QueryLimiter bounds the number of MySQL queries in flight across all
+// workers, independently of the connection pool size. A nil limiter or one
+// created with a non-positive limit never blocks.
+type QueryLimiter struct {
+	slots chan struct{}
+}
+
+func NewQueryLimiter(limit int) *QueryLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &QueryLimiter{slots: make(chan struct{}, limit)}
+}
+
+// Acquire blocks until a query slot is free or the context is cancelled.
+// Callers hold the slot until the query's rows are fully consumed.
+func (ql *QueryLimiter) Acquire(ctx context.Context) error {
+	if ql == nil {
+		return nil
+	}
+	select {
+	case ql.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (ql *QueryLimiter) Release() {
+	if ql == nil {
+		return
+	}
+	<-ql.slots
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// concurrencyHandler wraps a handler, holding each query for a moment and
+// recording the most queries answered at once
+type concurrencyHandler struct {
+	handler fakeHandler
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *concurrencyHandler) serve(query string, args []driver.NamedValue) (*fakeResult, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+
+	time.Sleep(2 * time.Millisecond)
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	return c.handler(query, args)
+}
+
+func TestQueryLimiterBoundsConcurrentQueries(t *testing.T) {
+	for _, limit := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.Workers = 8
+			cfg.Pipeline.BatchSize = 3
+			cfg.MySQL.MaxConcurrentQueries = limit
+
+			schema := &Schema{Tables: make(map[string]*Table)}
+			tables := make(map[string]*fakeTable)
+			var names []string
+			for i := 1; i <= 8; i++ {
+				name := fmt.Sprintf("t%d", i)
+				table := usersSchema(10).Tables["users"]
+				table.Name = name
+				schema.Tables[name] = table
+				tables[name] = usersTable(10)
+				names = append(names, name)
+			}
+			counter := &concurrencyHandler{handler: tablesHandler(tables)}
+			db, fake := newFakeDB(t, counter.serve)
+
+			processor := NewDataProcessor(cfg, logger.New("error", "text"), &ProgressTracker{}, NewQueryLimiter(limit))
+			if err := processor.ProcessTables(context.Background(), db, schema, names); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+			if counter.peak > limit {
+				t.Errorf("%d queries ran at once, want at most %d", counter.peak, limit)
+			}
+			if len(fake.Queries()) < len(names)*4 {
+				t.Errorf("only %d queries ran", len(fake.Queries()))
+			}
+		})
+	}
+}
+
+func TestGetTableRowCountCancelledWhileWaiting(t *testing.T) {
+	cfg := testConfig(t)
+	limiter := NewQueryLimiter(1)
+	processor := NewDataProcessor(cfg, logger.New("error", "text"), &ProgressTracker{}, limiter)
+	db, fake := newFakeDB(t, countingHandler(usersTable(3)))
+
+	// Hold the only slot, so the count waits until cancelled
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := processor.getTableRowCount(ctx, db, "users"); err == nil {
+		t.Fatal("count succeeded without a query slot")
+	}
+	if len(fake.Queries()) != 0 {
+		t.Errorf("queries ran without a slot: %v", fake.Queries())
+	}
+
+	// The slot is still ours: the failed count released nothing
+	limiter.Release()
+	count, err := processor.getTableRowCount(context.Background(), db, "users")
+	if err != nil || count != 3 {
+		t.Fatalf("count = %d, %v; want 3", count, err)
+	}
+	if len(limiter.slots) != 0 {
+		t.Errorf("%d slots held after the count", len(limiter.slots))
+	}
+}
+
+func BenchmarkQueryLimiter(b *testing.B) {
+	for _, limit := range []int{0, 1, 8} {
+		b.Run(fmt.Sprintf("limit %d", limit), func(b *testing.B) {
+			limiter := NewQueryLimiter(limit)
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := limiter.Acquire(ctx); err != nil {
+						b.Fatal(err)
+					}
+					limiter.Release()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLimitedExport(b *testing.B) {
+	for _, limit := range []int{0, 2} {
+		b.Run(fmt.Sprintf("limit %d", limit), func(b *testing.B) {
+			cfg := testConfig(b)
+			cfg.Pipeline.Workers = 4
+			cfg.Pipeline.BatchSize = 100
+			cfg.MySQL.MaxConcurrentQueries = limit
+			schema := usersSchema(1000)
+			db, _ := newFakeDB(b, countingHandler(usersTable(1000)))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				processor := NewDataProcessor(cfg, logger.New("error", "text"), &ProgressTracker{}, NewQueryLimiter(limit))
+				if err := processor.ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
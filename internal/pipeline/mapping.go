@@ -0,0 +1,245 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Supported UID mapping file formats
+const (
+	MappingFormatText   = "text"   // One key=uid pair per line, with \, = and line breaks escaped
+	MappingFormatJSON   = "json"   // A flat JSON object of key to uid
+	MappingFormatCSV    = "csv"    // A key,uid header followed by one pair per row
+	MappingFormatBinary = "binary" // Magic header, then length-prefixed key and uid strings
+)
+
+// mappingMagic identifies binary mapping files and their version
+var mappingMagic = []byte("UIDM\x01")
+
+// WriteUIDMapping writes the mapping in the given format with keys in sorted order
+func WriteUIDMapping(path, format string, mapping map[string]string) error {
+	keys := sortedKeys(mapping)
+	return WriteUIDMappingFrom(path, format, func(fn func(key, uid string) error) error {
+		for _, key := range keys {
+			if err := fn(key, mapping[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteUIDMappingFrom writes the mappings produced by each, which must call
+// fn in sorted key order and may be called more than once. Nothing is held
+// in memory, so it suits mappings spilled to disk by a UIDStore.
+func WriteUIDMappingFrom(path, format string, each func(fn func(key, uid string) error) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create mapping file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+
+	switch format {
+	case MappingFormatText:
+		err = each(func(key, uid string) error {
+			_, err := fmt.Fprintf(writer, "%s=%s\n", textEscaper.Replace(key), textEscaper.Replace(uid))
+			return err
+		})
+	case MappingFormatJSON:
+		// Same layout as an indented json.Encoder, written one pair at a time
+		count := 0
+		writer.WriteString("{")
+		err = each(func(key, uid string) error {
+			keyJSON, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			uidJSON, err := json.Marshal(uid)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				writer.WriteString(",")
+			}
+			count++
+			_, err = fmt.Fprintf(writer, "\n  %s: %s", keyJSON, uidJSON)
+			return err
+		})
+		if count > 0 {
+			writer.WriteString("\n")
+		}
+		writer.WriteString("}\n")
+	case MappingFormatCSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write([]string{"key", "uid"})
+		err = each(func(key, uid string) error {
+			return csvWriter.Write([]string{key, uid})
+		})
+		csvWriter.Flush()
+		if err == nil {
+			err = csvWriter.Error()
+		}
+	case MappingFormatBinary:
+		// The entry count comes first, so count in a separate pass
+		var count uint64
+		if err := each(func(key, uid string) error {
+			count++
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to encode mapping: %w", err)
+		}
+		writer.Write(mappingMagic)
+		writeUvarint(writer, count)
+		err = each(func(key, uid string) error {
+			writeBinaryString(writer, key)
+			writeBinaryString(writer, uid)
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown mapping format: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode mapping: %w", err)
+	}
+
+	return writer.Flush()
+}
+
+// LoadUIDMapping reads a mapping file written by WriteUIDMapping
+func LoadUIDMapping(path, format string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapping file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat mapping file: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	mapping := make(map[string]string)
+
+	switch format {
+	case MappingFormatText:
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			key, uid, ok := splitTextMapping(scanner.Text())
+			if !ok {
+				continue
+			}
+			mapping[key] = uid
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read mapping: %w", err)
+		}
+	case MappingFormatJSON:
+		if err := json.NewDecoder(reader).Decode(&mapping); err != nil {
+			return nil, fmt.Errorf("failed to decode mapping: %w", err)
+		}
+	case MappingFormatCSV:
+		records, err := csv.NewReader(reader).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode mapping: %w", err)
+		}
+		for i, record := range records {
+			if i == 0 || len(record) != 2 {
+				continue // Header row
+			}
+			mapping[record[0]] = record[1]
+		}
+	case MappingFormatBinary:
+		magic := make([]byte, len(mappingMagic))
+		if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != string(mappingMagic) {
+			return nil, fmt.Errorf("not a binary mapping file: %s", path)
+		}
+		count, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode mapping: %w", err)
+		}
+		for i := uint64(0); i < count; i++ {
+			key, err := readBinaryString(reader, info.Size())
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode mapping: %w", err)
+			}
+			uid, err := readBinaryString(reader, info.Size())
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode mapping: %w", err)
+			}
+			mapping[key] = uid
+		}
+	default:
+		return nil, fmt.Errorf("unknown mapping format: %s", format)
+	}
+
+	return mapping, nil
+}
+
+func writeUvarint(writer *bufio.Writer, value uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, value)
+	writer.Write(buf[:n])
+}
+
+func writeBinaryString(writer *bufio.Writer, value string) {
+	writeUvarint(writer, uint64(len(value)))
+	writer.WriteString(value)
+}
+
+// readBinaryString reads a length-prefixed string. A string cannot be longer
+// than the file holding it, so a larger length means the file is corrupt and
+// is rejected before anything is allocated.
+func readBinaryString(reader *bufio.Reader, fileSize int64) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+	if length > uint64(fileSize) {
+		return "", fmt.Errorf("string length %d exceeds the file size %d", length, fileSize)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// textEscaper escapes the characters that would split a text mapping line
+var textEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+
+// splitTextMapping splits a text mapping line at its first unescaped "=" and
+// unescapes both halves. Lines without a separator are reported as not ok.
+func splitTextMapping(line string) (key, uid string, ok bool) {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+			switch line[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(line[i])
+			}
+		case c == '=' && !ok:
+			key, ok = b.String(), true
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return key, b.String(), ok
+}
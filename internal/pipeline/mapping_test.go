@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUIDMappingRoundTrip(t *testing.T) {
+	mapping := map[string]string{
+		"users_1":                  "0x1",
+		"users_ann@example.com":    "0x2",
+		"settings_a=b":             "0x3",
+		"settings_a=b=c":           "0x4",
+		"notes_line\nbreak":        "0x5",
+		"notes_carriage\rreturn":   "0x6",
+		`paths_C:\temp\n`:          "0x7",
+		"trailing_backslash\\":     "0x8",
+		"comma,and\"quote":         "0x9",
+		"":                         "0xa",
+		"unicode_名前":               "0xb",
+		"uid_with_separator":       "a=b",
+		"uid_with_line_break":      "a\nb",
+		"both=sides":               "c=d",
+		"escaped_separator_\\=end": "0xc",
+	}
+	for _, format := range []string{MappingFormatText, MappingFormatJSON, MappingFormatCSV, MappingFormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "uid_mapping")
+			if err := WriteUIDMapping(path, format, mapping); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			got, err := LoadUIDMapping(path, format)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if len(got) != len(mapping) {
+				t.Errorf("loaded %d entries, want %d", len(got), len(mapping))
+			}
+			for key, uid := range mapping {
+				if got[key] != uid {
+					t.Errorf("%q = %q, want %q", key, got[key], uid)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitTextMapping(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		uid  string
+		ok   bool
+	}{
+		{"users_1=0x1", "users_1", "0x1", true},
+		{`settings_a\=b=0x3`, "settings_a=b", "0x3", true},
+		{`notes_a\nb=0x5`, "notes_a\nb", "0x5", true},
+		{`paths_C:\\temp=0x7`, `paths_C:\temp`, "0x7", true},
+		{`key=a\=b`, "key", "a=b", true},
+		{"=0xa", "", "0xa", true},
+		{"no separator", "", "", false},
+		{`only\=escaped`, "", "", false},
+	}
+	for _, tt := range tests {
+		key, uid, ok := splitTextMapping(tt.line)
+		if ok != tt.ok || (ok && (key != tt.key || uid != tt.uid)) {
+			t.Errorf("splitTextMapping(%q) = %q, %q, %v; want %q, %q, %v", tt.line, key, uid, ok, tt.key, tt.uid, tt.ok)
+		}
+	}
+}
+
+func TestLoadBinaryMappingRejectsOversizedStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"key length beyond the file", "UIDM\x01\x01\xff\xff\xff\xff\x0f"},
+		{"uid length beyond the file", "UIDM\x01\x01\x01k\xff\xff\xff\xff\xff\xff\xff\xff\x7f"},
+		{"truncated string", "UIDM\x01\x01\x05ab"},
+		{"wrong magic", "UIDM\x02\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "uid_mapping.bin")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadUIDMapping(path, MappingFormatBinary); err == nil {
+				t.Fatal("corrupt mapping loaded without error")
+			}
+		})
+	}
+}
+
+func TestTextMappingLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uid_mapping.txt")
+	mapping := map[string]string{"settings_a=b": "0x1", "users_1": "0x2"}
+	if err := WriteUIDMapping(path, MappingFormatText, mapping); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "settings_a\\=b=0x1\nusers_1=0x2\n"
+	if string(data) != want {
+		t.Errorf("file =\n%s\nwant\n%s", data, want)
+	}
+	if strings.Count(string(data), "\n") != len(mapping) {
+		t.Errorf("file has %d lines, want %d", strings.Count(string(data), "\n"), len(mapping))
+	}
+}
@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// redactedValue replaces the values of columns with the redact rule
+const redactedValue = "***"
+
+// maskValue applies a hash or redact column rule to a value. NULLs stay
+// NULL, and values of columns without such a rule are returned unchanged.
+func maskValue(rule string, raw []byte) []byte {
+	if raw == nil {
+		return nil
+	}
+	switch rule {
+	case "hash":
+		sum := sha256.Sum256(raw)
+		return []byte(hex.EncodeToString(sum[:]))
+	case "redact":
+		return []byte(redactedValue)
+	}
+	return raw
+}
+
+// dropBinaryColumns adds a drop column rule for every BINARY and BLOB column
+// without a rule of its own when mysql.binary_policy is skip, and returns
+// how many were added
+func dropBinaryColumns(cfg *config.Config, schema *Schema) int {
+	if cfg.MySQL.BinaryPolicy != "skip" {
+		return 0
+	}
+	dropped := 0
+	for tableName, table := range schema.Tables {
+		for columnName, column := range table.Columns {
+			if !IsBinaryType(column.Type) || cfg.Pipeline.ColumnRule(tableName, columnName) != "" {
+				continue
+			}
+			if cfg.Pipeline.ColumnRules == nil {
+				cfg.Pipeline.ColumnRules = make(map[string]string)
+			}
+			cfg.Pipeline.ColumnRules[tableName+"."+columnName] = "drop"
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// applyColumnRules masks hashed and redacted columns of a row in place and
+// clears dropped ones, so neither the triples nor derived predicates see the
+// original values
+func (dp *DataProcessor) applyColumnRules(tableName string, cols []string, values []sql.RawBytes) {
+	if len(dp.cfg.Pipeline.ColumnRules) == 0 {
+		return
+	}
+	for i, col := range cols {
+		switch rule := dp.cfg.Pipeline.ColumnRule(tableName, col); rule {
+		case "":
+		case "drop":
+			values[i] = nil
+		default:
+			values[i] = maskValue(rule, values[i])
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestMaskValue(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	tests := []struct {
+		rule string
+		raw  []byte
+		want []byte
+	}{
+		{"hash", []byte("s3cret"), []byte(hex.EncodeToString(sum[:]))},
+		{"redact", []byte("s3cret"), []byte("***")},
+		{"", []byte("s3cret"), []byte("s3cret")},
+		{"hash", nil, nil},
+		{"redact", nil, nil},
+	}
+	for _, tt := range tests {
+		got := maskValue(tt.rule, tt.raw)
+		if string(got) != string(tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("maskValue(%q, %q) = %q, want %q", tt.rule, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestColumnRules(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	tests := []struct {
+		rule      string
+		predicate bool   // Whether the schema declares users.password
+		value     string // The password triple's value; "" for none
+	}{
+		{rule: "drop"},
+		{rule: "hash", predicate: true, value: hex.EncodeToString(sum[:])},
+		{rule: "redact", predicate: true, value: "***"},
+		{rule: "", predicate: true, value: "s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run("rule "+tt.rule, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.rule != "" {
+				cfg.Pipeline.ColumnRules = map[string]string{"users.password": tt.rule}
+			}
+			schema := func() *Schema {
+				return &Schema{Tables: map[string]*Table{"users": {
+					Name: "users",
+					Columns: map[string]*Column{
+						"id":       {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+						"name":     {Name: "name", Type: "varchar", ColumnType: "varchar(50)", Position: 2},
+						"password": {Name: "password", Type: "varchar", ColumnType: "varchar(64)", Position: 3},
+					},
+					PrimaryKeys: []string{"id"},
+				}}}
+			}
+
+			predicates, types, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema())
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if _, ok := predicates["users.password"]; ok != tt.predicate {
+				t.Errorf("schema declares users.password: %v, want %v", ok, tt.predicate)
+			}
+			inType := false
+			for _, name := range types["users"] {
+				inType = inType || name == "users.password"
+			}
+			if inType != tt.predicate {
+				t.Errorf("type users lists users.password: %v, want %v", inType, tt.predicate)
+			}
+
+			lines := processRDF(t, cfg, schema(), map[string]*fakeTable{"users": {
+				columns: []string{"id", "name", "password"},
+				rows:    [][]driver.Value{{int64(1), "Ada", "s3cret"}},
+			}})
+			var passwords []string
+			for _, line := range lines {
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == "users.password" {
+					passwords = append(passwords, match[3])
+				}
+				if tt.rule != "" && strings.Contains(line, "s3cret") {
+					t.Errorf("the original value is written: %s", line)
+				}
+				if strings.Contains(line, "users.name") && !strings.Contains(line, `"Ada"`) {
+					t.Errorf("a column without a rule is changed: %s", line)
+				}
+			}
+			switch {
+			case tt.value == "" && len(passwords) > 0:
+				t.Errorf("password triples %v, want none", passwords)
+			case tt.value != "" && (len(passwords) != 1 || passwords[0] != tt.value):
+				t.Errorf("password triples %v, want %q", passwords, tt.value)
+			}
+		})
+	}
+}
+
+// TestMaskedForeignKey checks a masked foreign key column is written as a
+// value, not an edge to a row it no longer identifies
+func TestMaskedForeignKey(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.ColumnRules = map[string]string{"orders.user_id": "hash"}
+	schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+	lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+		"users":  {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}},
+		"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(1), int64(1)}}},
+	})
+	for _, line := range lines {
+		if fields := strings.Fields(line); strings.HasPrefix(fields[0], "_:orders") && strings.HasPrefix(fields[2], "_:users") {
+			t.Errorf("masked key is written as an edge: %s", line)
+		}
+	}
+}
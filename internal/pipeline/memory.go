@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// memoryPollInterval is how often a throttled submitter rechecks memory
+const memoryPollInterval = 250 * time.Millisecond
+
+// MemoryGuard holds back job submission while the heap is above
+// pipeline.memory_limit_mb, letting in-flight jobs drain. A nil guard, or one
+// created with a non-positive limit, never blocks.
+type MemoryGuard struct {
+	limit  uint64 // Bytes
+	logger *logger.Logger
+
+	heapAlloc func() uint64 // Reads the heap size; replaceable for tests
+
+	active    atomic.Int64 // Jobs currently being processed
+	throttles atomic.Int64 // Times submission was paused
+}
+
+func NewMemoryGuard(limitMB int64, logger *logger.Logger) *MemoryGuard {
+	if limitMB <= 0 {
+		return nil
+	}
+	return &MemoryGuard{
+		limit:     uint64(limitMB) * 1024 * 1024,
+		logger:    logger,
+		heapAlloc: readHeapAlloc,
+	}
+}
+
+func readHeapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// Wait returns once the heap is under the limit. Over the limit it first
+// forces a collection, then waits for running jobs to finish. When no job is
+// running, waiting cannot free anything, so the next job starts anyway.
+func (g *MemoryGuard) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	alloc := g.heapAlloc()
+	if alloc <= g.limit {
+		return nil
+	}
+
+	// Return freed memory before deciding to pause; with nothing running
+	// there is nothing to wait for
+	debug.FreeOSMemory()
+	if alloc = g.heapAlloc(); alloc <= g.limit || g.active.Load() == 0 {
+		return nil
+	}
+
+	g.throttles.Add(1)
+	g.logger.Warn("Memory limit exceeded, pausing job submission",
+		"heap_mb", alloc/1024/1024,
+		"limit_mb", g.limit/1024/1024,
+		"active_jobs", g.active.Load())
+
+	start := time.Now()
+	ticker := time.NewTicker(memoryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if g.active.Load() == 0 {
+			runtime.GC()
+		}
+		alloc = g.heapAlloc()
+		if alloc <= g.limit {
+			g.logger.Info("Memory back under limit, resuming job submission",
+				"heap_mb", alloc/1024/1024,
+				"paused", time.Since(start).String())
+			return nil
+		}
+		if g.active.Load() == 0 {
+			g.logger.Warn("Memory still above limit with no jobs running, continuing",
+				"heap_mb", alloc/1024/1024,
+				"limit_mb", g.limit/1024/1024)
+			return nil
+		}
+	}
+}
+
+// Begin marks a job as running
+func (g *MemoryGuard) Begin() {
+	if g != nil {
+		g.active.Add(1)
+	}
+}
+
+// End marks a job started with Begin as finished
+func (g *MemoryGuard) End() {
+	if g != nil {
+		g.active.Add(-1)
+	}
+}
+
+// Throttles returns how many times submission was paused
+func (g *MemoryGuard) Throttles() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.throttles.Load()
+}
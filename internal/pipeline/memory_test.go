@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestMemoryGuardWait(t *testing.T) {
+	const limit = 1024 * 1024
+	tests := []struct {
+		name      string
+		limitMB   int64
+		heap      uint64
+		active    int64
+		release   bool // End the active job and shrink the heap while waiting
+		cancel    bool
+		err       error
+		throttles int64
+	}{
+		{name: "unlimited", limitMB: 0, heap: 10 * limit},
+		{name: "under the limit", limitMB: 1, heap: limit / 2, active: 1},
+		{name: "over the limit with nothing running", limitMB: 1, heap: 2 * limit},
+		{name: "over the limit until the running job ends", limitMB: 1, heap: 2 * limit, active: 1, release: true, throttles: 1},
+		{name: "cancelled while paused", limitMB: 1, heap: 2 * limit, active: 1, cancel: true,
+			err: context.Canceled, throttles: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewMemoryGuard(tt.limitMB, logger.New("error", "text"))
+			if tt.limitMB <= 0 {
+				if guard != nil {
+					t.Fatalf("NewMemoryGuard(%d) = %+v, want nil", tt.limitMB, guard)
+				}
+				if err := guard.Wait(context.Background()); err != nil || guard.Throttles() != 0 {
+					t.Errorf("nil guard: Wait = %v, Throttles = %d", err, guard.Throttles())
+				}
+				return
+			}
+
+			var heap atomic.Uint64
+			heap.Store(tt.heap)
+			guard.heapAlloc = heap.Load
+			for i := int64(0); i < tt.active; i++ {
+				guard.Begin()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				time.Sleep(memoryPollInterval / 2)
+				switch {
+				case tt.release:
+					heap.Store(limit / 2)
+					guard.End()
+				case tt.cancel:
+					cancel()
+				}
+			}()
+
+			if err := guard.Wait(ctx); !errors.Is(err, tt.err) {
+				t.Errorf("Wait = %v, want %v", err, tt.err)
+			}
+			if got := guard.Throttles(); got != tt.throttles {
+				t.Errorf("Throttles = %d, want %d", got, tt.throttles)
+			}
+		})
+	}
+}
+
+// TestMemoryLimitThrottlesSubmission exports several tables with a heap
+// reported over a tiny limit while jobs run, and checks submission pauses
+// without losing rows
+func TestMemoryLimitThrottlesSubmission(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.Workers = 2
+	cfg.Pipeline.MemoryLimit = 1
+
+	tables := make(map[string]*fakeTable)
+	schema := &Schema{Tables: make(map[string]*Table)}
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		tables[name] = usersTable(3)
+		table := *usersSchema(3).Tables["users"]
+		table.Name = name
+		schema.Tables[name] = &table
+		names = append(names, name)
+	}
+	handler := tablesHandler(tables)
+	db, _ := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		// Keep jobs running long enough to be seen by the next submission
+		if !strings.HasPrefix(query, "SELECT COUNT") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return handler(query, args)
+	})
+
+	processor := testProcessor(cfg)
+	guard := processor.memory
+	if guard == nil {
+		t.Fatal("no memory guard with memory_limit_mb set")
+	}
+	// The heap is over the limit while any job runs
+	guard.heapAlloc = func() uint64 {
+		if guard.active.Load() > 0 {
+			return 2 * guard.limit
+		}
+		return guard.limit / 2
+	}
+
+	if err := processor.ProcessTables(context.Background(), db, schema, names); err != nil {
+		t.Fatalf("ProcessTables: %v", err)
+	}
+	if guard.Throttles() == 0 {
+		t.Error("job submission was never paused")
+	}
+	if got := processor.progress.ProcessedRows; got != 15 {
+		t.Errorf("processed %d rows, want 15", got)
+	}
+}
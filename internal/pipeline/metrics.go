@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// MetricsServer serves pipeline progress on /metrics in the Prometheus text
+// exposition format
+type MetricsServer struct {
+	server   *http.Server
+	progress *ProgressTracker
+	logger   *logger.Logger
+}
+
+func NewMetricsServer(port int, progress *ProgressTracker, logger *logger.Logger) *MetricsServer {
+	ms := &MetricsServer{
+		progress: progress,
+		logger:   logger,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", ms.handleMetrics)
+	ms.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return ms
+}
+
+// Start binds the port and serves in the background. Binding errors, such
+// as the port being in use, are returned.
+func (ms *MetricsServer) Start() error {
+	listener, err := net.Listen("tcp", ms.server.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := ms.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ms.logger.Error("Metrics server failed", "error", err)
+		}
+	}()
+	ms.logger.Info("Metrics server started", "addr", listener.Addr().String())
+	return nil
+}
+
+// Shutdown stops the server, waiting for in-flight scrapes
+func (ms *MetricsServer) Shutdown(ctx context.Context) error {
+	return ms.server.Shutdown(ctx)
+}
+
+func (ms *MetricsServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, ms.progress)
+}
+
+// writeMetrics writes a snapshot of the progress tracker and heap size
+func writeMetrics(w io.Writer, progress *ProgressTracker) {
+	progress.mu.RLock()
+	processedRows := progress.ProcessedRows
+	processedTables := progress.ProcessedTables
+	errorCount := progress.ErrorCount
+	elapsed := time.Since(progress.StartTime).Seconds()
+	progress.mu.RUnlock()
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(processedRows) / elapsed
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(w, "%s %v\n", name, value)
+	}
+	metric("rows_processed_total", "counter", "Rows converted from MySQL.", processedRows)
+	metric("tables_processed_total", "counter", "Tables whose jobs have all finished.", processedTables)
+	metric("records_per_second", "gauge", "Average rows converted per second since the start.", rate)
+	metric("errors_total", "counter", "Failed jobs and mutation batches.", errorCount)
+	metric("memory_bytes", "gauge", "Heap bytes in use.", m.HeapAlloc)
+}
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// exposition is a parsed metric family of the Prometheus text format
+type exposition struct {
+	kind  string
+	help  string
+	value float64
+}
+
+// parseExposition parses unlabelled samples with their HELP and TYPE lines,
+// failing the test on anything else
+func parseExposition(t *testing.T, r io.Reader) map[string]*exposition {
+	t.Helper()
+	metrics := make(map[string]*exposition)
+	family := func(name string) *exposition {
+		if metrics[name] == nil {
+			metrics[name] = &exposition{}
+		}
+		return metrics[name]
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) != 4 {
+				t.Fatalf("malformed comment line %q", line)
+			}
+			switch fields[1] {
+			case "HELP":
+				family(fields[2]).help = fields[3]
+			case "TYPE":
+				family(fields[2]).kind = fields[3]
+			default:
+				t.Fatalf("unexpected comment line %q", line)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		m := family(fields[0])
+		if m.kind == "" {
+			t.Fatalf("sample %q comes before its TYPE line", line)
+		}
+		m.value = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return metrics
+}
+
+func TestWriteMetrics(t *testing.T) {
+	progress := &ProgressTracker{
+		ProcessedRows:   1200,
+		ProcessedTables: 3,
+		ErrorCount:      2,
+		StartTime:       time.Now().Add(-time.Minute),
+	}
+	var out strings.Builder
+	writeMetrics(&out, progress)
+	metrics := parseExposition(t, strings.NewReader(out.String()))
+
+	tests := []struct {
+		name     string
+		kind     string
+		min, max float64
+	}{
+		{"rows_processed_total", "counter", 1200, 1200},
+		{"tables_processed_total", "counter", 3, 3},
+		{"errors_total", "counter", 2, 2},
+		// 1200 rows in a little over a minute
+		{"records_per_second", "gauge", 15, 20},
+		{"memory_bytes", "gauge", 1, 1 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrics[tt.name]
+			if m == nil {
+				t.Fatalf("%s is missing from\n%s", tt.name, out.String())
+			}
+			if m.kind != tt.kind || m.help == "" {
+				t.Errorf("%s: TYPE %q, HELP %q, want a %s with help", tt.name, m.kind, m.help, tt.kind)
+			}
+			if m.value < tt.min || m.value > tt.max {
+				t.Errorf("%s = %v, want between %v and %v", tt.name, m.value, tt.min, tt.max)
+			}
+		})
+	}
+	if len(metrics) != len(tests) {
+		t.Errorf("exposed %d metrics, want %d", len(metrics), len(tests))
+	}
+}
+
+// TestMetricsServer scrapes a running server and checks it follows the
+// tracker and stops serving after Shutdown
+func TestMetricsServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	progress := &ProgressTracker{StartTime: time.Now()}
+	server := NewMetricsServer(port, progress, logger.New("error", "text"))
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/metrics", port)
+
+	scrape := func() map[string]*exposition {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET /metrics: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /metrics: %s", resp.Status)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		return parseExposition(t, resp.Body)
+	}
+
+	if got := scrape()["rows_processed_total"].value; got != 0 {
+		t.Errorf("rows_processed_total = %v before any rows", got)
+	}
+	progress.mu.Lock()
+	progress.ProcessedRows = 42
+	progress.ProcessedTables = 1
+	progress.mu.Unlock()
+	metrics := scrape()
+	if got := metrics["rows_processed_total"].value; got != 42 {
+		t.Errorf("rows_processed_total = %v, want 42", got)
+	}
+	if got := metrics["tables_processed_total"].value; got != 1 {
+		t.Errorf("tables_processed_total = %v, want 1", got)
+	}
+
+	if err := NewMetricsServer(port, progress, logger.New("error", "text")).Start(); err == nil {
+		t.Error("a second server started on a port in use")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if resp, err := http.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("server still answers after Shutdown")
+	}
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NameMapper turns original predicate and type names into names Dgraph
+// accepts. Characters other than ASCII letters, digits, "_", "." and "-" are
+// percent-escaped, and a name longer than the maximum length keeps its first
+// characters and gets a hash of the full name as suffix, so the schema
+// generator and the data writers derive the same name independently. Every
+// name that changed is recorded for the name map file.
+type NameMapper struct {
+	maxLen int
+
+	mu        sync.Mutex
+	originals map[string]string // written name -> original name
+}
+
+// NewNameMapper returns a mapper for names up to maxLen characters. A maxLen
+// of zero or less disables shortening.
+func NewNameMapper(maxLen int) *NameMapper {
+	return &NameMapper{
+		maxLen:    maxLen,
+		originals: make(map[string]string),
+	}
+}
+
+// Name returns the name to write for an original predicate or type name
+func (m *NameMapper) Name(name string) string {
+	written := m.written(name)
+	if m == nil || written == name {
+		return written
+	}
+
+	m.mu.Lock()
+	m.originals[written] = name
+	m.mu.Unlock()
+
+	return written
+}
+
+// written returns the name Name writes for name, without recording it
+func (m *NameMapper) written(name string) string {
+	written := sanitizePredicate(name)
+	if m != nil && m.maxLen > 0 && len(written) > m.maxLen {
+		written = shortenName(name, written, m.maxLen)
+	}
+	return written
+}
+
+// Original returns the original name of a changed name, or the name itself
+func (m *NameMapper) Original(name string) string {
+	if m == nil {
+		return name
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if original, ok := m.originals[name]; ok {
+		return original
+	}
+	return name
+}
+
+// Len returns the number of changed names recorded
+func (m *NameMapper) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.originals)
+}
+
+// Save merges the recorded names into a tab-separated "short<TAB>original"
+// file, so names recorded by the generator and the data writers end up together
+func (m *NameMapper) Save(path string) error {
+	if m.Len() == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string)
+	if existing, err := LoadNameMap(path); err == nil {
+		for short, original := range existing {
+			merged[short] = original
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	m.mu.Lock()
+	for short, original := range m.originals {
+		merged[short] = original
+	}
+	m.mu.Unlock()
+
+	shorts := make([]string, 0, len(merged))
+	for short := range merged {
+		shorts = append(shorts, short)
+	}
+	sort.Strings(shorts)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, short := range shorts {
+		fmt.Fprintf(writer, "%s\t%s\n", short, merged[short])
+	}
+	return writer.Flush()
+}
+
+// LoadNameMap reads a name map file written by Save
+func LoadNameMap(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		short, original, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		names[short] = original
+	}
+	return names, scanner.Err()
+}
+
+// shortenName truncates an escaped name to maxLen characters, the last nine
+// of which are "_" and the hex fnv-32a hash of the original name
+func shortenName(original, escaped string, maxLen int) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(original))
+	suffix := fmt.Sprintf("_%08x", hash.Sum32())
+
+	keep := maxLen - len(suffix)
+	if keep < 1 {
+		keep = 1
+	}
+	// Never cut a percent escape in half
+	if cut := strings.LastIndexByte(escaped[:keep], '%'); cut >= 0 && cut > keep-3 {
+		keep = cut
+	}
+	return escaped[:keep] + suffix
+}
+
+// sanitizePredicate percent-escapes the bytes of a name that are not ASCII
+// letters, digits, "_", "." or "-", so names with spaces, punctuation or
+// Unicode can be written inside <...> and in type definitions
+func sanitizePredicate(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// schemaName wraps an escaped name in angle brackets for the schema file,
+// where bare names may not contain "%"
+func schemaName(name string) string {
+	if strings.Contains(name, "%") {
+		return "<" + name + ">"
+	}
+	return name
+}
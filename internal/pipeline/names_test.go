@@ -0,0 +1,229 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestNameMapper(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxLen int
+		input  string
+		want   string
+	}{
+		{"short name", 24, "users.name", "users.name"},
+		{"exactly the limit", 24, "users.abcdefghijklmnopqr", "users.abcdefghijklmnopqr"},
+		{"long name", 24, "customer_orders.shipping_address_line_two", "customer_orders_9d6cd594"},
+		{"same prefix, different name", 24, "customer_orders.shipping_address_line_one", "customer_orders_d415668e"},
+		{"escaped name", 0, "users.unit price", "users.unit%20price"},
+		{"escape is not cut in half", 20, "users.abc def ghijk", "users.abc_abababcf"},
+		{"unlimited", 0, "customer_orders.shipping_address_line_two", "customer_orders.shipping_address_line_two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := NewNameMapper(tt.maxLen)
+			got := mapper.Name(tt.input)
+			if got != tt.want {
+				t.Errorf("Name(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if tt.maxLen > 0 && len(got) > tt.maxLen {
+				t.Errorf("Name(%q) has %d characters, over %d", tt.input, len(got), tt.maxLen)
+			}
+			if again := NewNameMapper(tt.maxLen).Name(tt.input); again != got {
+				t.Errorf("a second mapper names %q %q, not %q", tt.input, again, got)
+			}
+			if original := mapper.Original(got); original != tt.input {
+				t.Errorf("Original(%q) = %q, want %q", got, original, tt.input)
+			}
+		})
+	}
+}
+
+func TestNameMapSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "name_map.txt")
+
+	// The generator and the data writers each save the names they changed
+	generator := NewNameMapper(24)
+	generator.Name("customer_orders.shipping_address_line_two")
+	generator.Name("users.name")
+	if err := generator.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	writer := NewNameMapper(24)
+	writer.Name("users.unit price")
+	if err := writer.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := LoadNameMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"customer_orders_9d6cd594": "customer_orders.shipping_address_line_two",
+		"users.unit%20price":       "users.unit price",
+	}
+	if !maps.Equal(names, want) {
+		t.Errorf("name map = %v, want %v", names, want)
+	}
+}
+
+func TestLongNamesMatchBetweenSchemaAndData(t *testing.T) {
+	const table = "customer_shipping_addresses"
+	info := &infoSchema{
+		columns: map[string][]fakeColumn{table: {
+			{name: "id", dataType: "int", columnType: "int"},
+			{name: "delivery_instructions_for_courier", dataType: "varchar", columnType: "varchar(200)"},
+			{name: "zip", dataType: "varchar", columnType: "varchar(10)"},
+		}},
+		primaryKeys: map[string][]string{table: {"id"}},
+		rows: map[string]*fakeTable{table: {columns: []string{"id", "delivery_instructions_for_courier", "zip"}, rows: [][]driver.Value{
+			{int64(1), "ring twice", "12345"},
+		}}},
+	}
+	cfg := testConfig(t)
+	cfg.Output.MaxNameLength = 24
+	db, _ := newFakeDB(t, info.serve)
+	log := logger.New("error", "text")
+	schema, err := NewSchemaExtractor(db, log, nil, nil).ExtractSchema(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("ExtractSchema: %v", err)
+	}
+	if err := NewSchemaGenerator(cfg, log).Generate(schema); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{table}); err != nil {
+		t.Fatalf("ProcessTables: %v", err)
+	}
+
+	schemaText := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+	data := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile))
+
+	declared := make(map[string]bool)
+	for _, match := range regexp.MustCompile(`(?m)^<?([^\s<>:]+)>?: `).FindAllStringSubmatch(schemaText, -1) {
+		declared[match[1]] = true
+	}
+	written := make(map[string]bool)
+	for _, match := range regexp.MustCompile(`(?m)^\S+ <([^>]+)> `).FindAllStringSubmatch(data, -1) {
+		written[match[1]] = true
+	}
+	for predicate := range written {
+		if predicate != "dgraph.type" && !declared[predicate] {
+			t.Errorf("data writes %s, which the schema does not declare", predicate)
+		}
+		if len(predicate) > cfg.Output.MaxNameLength {
+			t.Errorf("predicate %s is longer than %d", predicate, cfg.Output.MaxNameLength)
+		}
+	}
+	if len(written) < 3 {
+		t.Errorf("data writes only %v", written)
+	}
+
+	names, err := LoadNameMap(filepath.Join(cfg.Output.Directory, cfg.Output.NameMapFile))
+	if err != nil {
+		t.Fatalf("LoadNameMap: %v", err)
+	}
+	originals := make(map[string]bool)
+	for short, original := range names {
+		originals[original] = true
+		if !declared[short] && !strings.Contains(schemaText, "type <"+short+">") && !strings.Contains(schemaText, "type "+short+" ") {
+			t.Errorf("name map entry %s is neither a predicate nor a type of the schema", short)
+		}
+	}
+	for _, original := range []string{
+		table,
+		table + ".delivery_instructions_for_courier",
+		table + ".zip",
+		table + ".id",
+	} {
+		if !originals[original] {
+			t.Errorf("name map does not record %s: %v", original, names)
+		}
+	}
+}
+
+func TestSanitizePredicate(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"users.name", "users.name"},
+		{"order items.id", "order%20items.id"},
+		{"orders.customer-ref", "orders.customer-ref"},
+		{"orders.größe", "orders.gr%C3%B6%C3%9Fe"},
+		{"a<b>.c\"d", "a%3Cb%3E.c%22d"},
+		{"100%", "100%25"},
+	}
+	for _, tt := range tests {
+		if got := sanitizePredicate(tt.name); got != tt.want {
+			t.Errorf("sanitizePredicate(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSpecialCharacterNames writes the schema and a row of a table whose
+// name holds a space and checks both name its predicates and type alike
+func TestSpecialCharacterNames(t *testing.T) {
+	const table = "order items"
+	schema := &Schema{Tables: map[string]*Table{table: {
+		Name: table,
+		Columns: map[string]*Column{
+			"id":           {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+			"customer-ref": {Name: "customer-ref", Type: "varchar", ColumnType: "varchar(20)", Position: 2},
+			"unit price":   {Name: "unit price", Type: "double", ColumnType: "double", Position: 3},
+		},
+		PrimaryKeys: []string{"id"},
+	}}}
+	cfg := testConfig(t)
+	if err := NewSchemaGenerator(cfg, logger.New("error", "text")).Generate(schema); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	lines, err := testProcessor(cfg).convertRowToRDF(table, []string{"id", "customer-ref", "unit price"},
+		[]sql.RawBytes{sql.RawBytes("1"), sql.RawBytes("C-1"), sql.RawBytes("2.5")}, schema)
+	if err != nil {
+		t.Fatalf("convertRowToRDF: %v", err)
+	}
+
+	schemaText := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+	for _, want := range []string{
+		"<order%20items.customer-ref>: string",
+		"<order%20items.unit%20price>: float",
+		"type <order%20items> {",
+	} {
+		if !strings.Contains(schemaText, want) {
+			t.Errorf("schema has no %q:\n%s", want, schemaText)
+		}
+	}
+	data := strings.Join(lines, "\n")
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) < 4 || !nodePattern.MatchString(fields[0]) || !strings.HasPrefix(fields[1], "<") {
+			t.Errorf("malformed triple %q", line)
+		}
+	}
+	for _, want := range []string{
+		`<order%20items.customer-ref> "C-1"`,
+		`<order%20items.unit%20price> "2.5"`,
+		`<dgraph.type> "order%20items"`,
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("data has no %q:\n%s", want, data)
+		}
+	}
+
+	names, err := LoadNameMap(filepath.Join(cfg.Output.Directory, cfg.Output.NameMapFile))
+	if err != nil {
+		t.Fatalf("LoadNameMap: %v", err)
+	}
+	if names["order%20items.unit%20price"] != "order items.unit price" || names["order%20items"] != table {
+		t.Errorf("name map = %v", names)
+	}
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RelationshipUsage reports how often a relationship occurs in the data
+type RelationshipUsage struct {
+	ForeignKey
+	Edges    int64 `json:"edges"`    // Edges emitted for this relationship
+	Declared bool  `json:"declared"` // Known from constraints, conventions or analysis
+}
+
+// RelationshipReport compares known relationships with the edges found in the data
+type RelationshipReport struct {
+	Exercised   []RelationshipUsage `json:"exercised"`   // Known relationships with at least one edge
+	Unexercised []RelationshipUsage `json:"unexercised"` // Known relationships no row uses
+	Undeclared  []RelationshipUsage `json:"undeclared"`  // Edges on columns with no known relationship
+}
+
+// buildRelationshipReport matches observed edges against the schema's
+// relationships. Observed predicates that are not schema columns, such as
+// reverse edges, are ignored.
+func buildRelationshipReport(schema *Schema, observed []RelationshipUsage) *RelationshipReport {
+	// Self-references are written as table.parent rather than table.parent_id
+	columns := make(map[string]string)
+	for _, fk := range schema.Relationships {
+		columns[ForwardPredicateName(schema, fk.TableName, fk.ColumnName, fk.RefTableName)] = fk.ColumnName
+	}
+	for i, usage := range observed {
+		if column, ok := columns[usage.TableName+"."+usage.ColumnName]; ok {
+			observed[i].ColumnName = column
+		}
+	}
+
+	edges := make(map[string]int64)
+	for _, usage := range observed {
+		edges[relationshipKey(usage.ForeignKey)] += usage.Edges
+	}
+
+	report := &RelationshipReport{}
+	declared := make(map[string]bool)
+	for _, fk := range schema.Relationships {
+		key := relationshipKey(fk)
+		if declared[key] {
+			continue
+		}
+		declared[key] = true
+
+		usage := RelationshipUsage{ForeignKey: fk, Edges: edges[key], Declared: true}
+		if usage.Edges > 0 {
+			report.Exercised = append(report.Exercised, usage)
+		} else {
+			report.Unexercised = append(report.Unexercised, usage)
+		}
+	}
+
+	for _, usage := range observed {
+		if declared[relationshipKey(usage.ForeignKey)] {
+			continue
+		}
+		table := schema.Tables[usage.TableName]
+		if table == nil || table.Columns[usage.ColumnName] == nil {
+			continue
+		}
+		report.Undeclared = append(report.Undeclared, usage)
+	}
+
+	for _, list := range [][]RelationshipUsage{report.Exercised, report.Unexercised, report.Undeclared} {
+		sort.Slice(list, func(i, j int) bool {
+			return relationshipKey(list[i].ForeignKey) < relationshipKey(list[j].ForeignKey)
+		})
+	}
+
+	return report
+}
+
+func relationshipKey(fk ForeignKey) string {
+	return fmt.Sprintf("%s.%s->%s", fk.TableName, fk.ColumnName, fk.RefTableName)
+}
+
+// ObserveRelationships runs the data pass and reports which relationships
+// actually occur in the data, with edge counts, and which known relationships
+// no row exercises. The report is written to output.relationship_report_file.
+func (p *Pipeline) ObserveRelationships(tables string) error {
+	if !p.writesRDFFile() {
+		return fmt.Errorf("relationship observation requires rdf output to a file")
+	}
+
+	if err := p.ExtractSchema(); err != nil {
+		return fmt.Errorf("schema extraction failed: %w", err)
+	}
+	if err := p.MigrateData(tables); err != nil {
+		return fmt.Errorf("data migration failed: %w", err)
+	}
+
+	observed, err := observeRDFRelationships(p.rdfOutputFiles(), p.extractedSchema, p.nameMap(), p.cfg.Output.UIDNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to parse RDF for relationships: %w", err)
+	}
+
+	report := buildRelationshipReport(p.extractedSchema, observed)
+	for _, usage := range report.Unexercised {
+		p.logger.Warn("Relationship never used in data",
+			"table", usage.TableName,
+			"column", usage.ColumnName,
+			"references", usage.RefTableName)
+	}
+	for _, usage := range report.Undeclared {
+		p.logger.Info("Relationship found only in data",
+			"table", usage.TableName,
+			"column", usage.ColumnName,
+			"references", usage.RefTableName,
+			"edges", usage.Edges)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode relationship report: %w", err)
+	}
+	reportPath := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.RelationshipReportFile)
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write relationship report: %w", err)
+	}
+
+	p.logger.Info("Relationship report written",
+		"file", reportPath,
+		"exercised", len(report.Exercised),
+		"unexercised", len(report.Unexercised),
+		"undeclared", len(report.Undeclared))
+	return nil
+}
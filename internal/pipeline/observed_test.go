@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestObserveRelationships(t *testing.T) {
+	tests := []struct {
+		name        string
+		coupons     []driver.Value // coupon_id of each order
+		exercised   map[string]int64
+		unexercised []string
+	}{
+		{
+			name:        "a convention foreign key no row uses",
+			coupons:     []driver.Value{nil, nil, nil},
+			exercised:   map[string]int64{"orders.user_id->users": 3},
+			unexercised: []string{"orders.coupon_id->coupons"},
+		},
+		{
+			name:      "a convention foreign key in use",
+			coupons:   []driver.Value{int64(1), nil, int64(1)},
+			exercised: map[string]int64{"orders.coupon_id->coupons": 2, "orders.user_id->users": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			schema := fkSchema(map[string][]string{"users": nil, "coupons": nil, "orders": {"user_id", "coupon_id"}},
+				[][3]string{{"orders", "user_id", "users"}, {"orders", "coupon_id", "coupons"}})
+			orders := &fakeTable{columns: []string{"id", "user_id", "coupon_id"}}
+			for i, coupon := range tt.coupons {
+				orders.rows = append(orders.rows, []driver.Value{int64(i + 1), int64(i%2 + 1), coupon})
+			}
+			processRDF(t, cfg, schema, map[string]*fakeTable{
+				"users":   {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}},
+				"coupons": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}},
+				"orders":  orders,
+			})
+
+			observed, err := observeRDFRelationships([]string{filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)}, schema, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			report := buildRelationshipReport(schema, observed)
+
+			exercised := make(map[string]int64)
+			for _, usage := range report.Exercised {
+				exercised[relationshipKey(usage.ForeignKey)] = usage.Edges
+			}
+			var unexercised []string
+			for _, usage := range report.Unexercised {
+				unexercised = append(unexercised, relationshipKey(usage.ForeignKey))
+			}
+			if !maps.Equal(exercised, tt.exercised) {
+				t.Errorf("exercised = %v, want %v", exercised, tt.exercised)
+			}
+			if !slices.Equal(unexercised, tt.unexercised) {
+				t.Errorf("unexercised = %v, want %v", unexercised, tt.unexercised)
+			}
+			if len(report.Undeclared) != 0 {
+				t.Errorf("undeclared = %+v", report.Undeclared)
+			}
+		})
+	}
+}
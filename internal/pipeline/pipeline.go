@@ -9,12 +9,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
@@ -26,11 +30,13 @@ type Pipeline struct {
 
 	// Database connections
 	mysqlDB *sql.DB
+	readDB  *sql.DB // Row reads; the replica when mysql.read_host is set, else mysqlDB
 
 	// Execution context and control
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup // Background goroutines and the data phase, which Stop waits for
+	stopOnce sync.Once
 
 	// Progress tracking and monitoring
 	progress *ProgressTracker
@@ -40,6 +46,10 @@ type Pipeline struct {
 	extractedSchema *Schema          // Cached extracted schema
 	processor       *DataProcessor   // Handles data processing and conversion
 	validator       *DataValidator   // Handles data validation
+	analyzer        *DataAnalyzer    // Discovers relationships from sampled data
+	metrics         *MetricsServer   // Serves /metrics when pipeline.enable_metrics is set
+	migratedTables  []string         // Tables selected by the last data phase
+	chunks          []ChunkInfo      // Chunk files written by the last data phase when output.chunk_size is set
 }
 
 // ProgressTracker monitors and reports migration progress
@@ -53,6 +63,8 @@ type ProgressTracker struct {
 	StartTime       time.Time    // Pipeline start time
 	LastReportTime  time.Time    // Last progress report time
 	ErrorCount      int64        // Number of errors encountered
+	MutationBatches int64        // Batches committed to Dgraph when output.target is dgraph
+	AssignedUIDs    int64        // UIDs Dgraph assigned to blank nodes in those batches
 }
 
 // New creates and initializes a new Pipeline instance
@@ -61,17 +73,53 @@ func New(cfg *config.Config, logger *logger.Logger) (*Pipeline, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("Questionable configuration", "warning", warning)
+	}
 
 	// Create cancellable context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Establish MySQL database connection
-	mysqlDB, err := connectToMySQL(cfg, ctx)
+	mysqlDB, err := connectToMySQL(cfg, ctx, cfg.MySQL.ConnectionString())
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
 	}
 
+	// Heavy SELECTs go to the read replica; schema metadata stays on the primary
+	readDB := mysqlDB
+	if cfg.MySQL.HasReadReplica() {
+		readDB, err = connectToMySQL(cfg, ctx, cfg.MySQL.ReadConnectionString())
+		if err != nil {
+			mysqlDB.Close()
+			cancel()
+			return nil, fmt.Errorf("failed to connect to MySQL read replica: %w", err)
+		}
+		logger.Info("Reading rows from MySQL replica", "host", cfg.MySQL.ReadHost)
+	}
+
+	return newPipeline(cfg, logger, ctx, cancel, mysqlDB, readDB)
+}
+
+// NewWithDB validates the configuration and runs the pipeline over an open
+// database instead of connecting to mysql.host, for tests and programs that
+// manage their own connections. Rows are read from db as well; Stop closes it.
+func NewWithDB(cfg *config.Config, logger *logger.Logger, db *sql.DB) (*Pipeline, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("Questionable configuration", "warning", warning)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return newPipeline(cfg, logger, ctx, cancel, db, db)
+}
+
+// newPipeline builds the pipeline components over connected databases
+func newPipeline(cfg *config.Config, logger *logger.Logger, ctx context.Context, cancel context.CancelFunc,
+	mysqlDB, readDB *sql.DB) (*Pipeline, error) {
 	// Initialize progress tracking
 	progress := &ProgressTracker{
 		StartTime:      time.Now(),
@@ -83,25 +131,80 @@ func New(cfg *config.Config, logger *logger.Logger) (*Pipeline, error) {
 		cfg:      cfg,
 		logger:   logger,
 		mysqlDB:  mysqlDB,
+		readDB:   readDB,
 		ctx:      ctx,
 		cancel:   cancel,
 		progress: progress,
 	}
 
-	// Initialize core components
-	p.schema = NewSchemaExtractor(mysqlDB, logger)
-	p.processor = NewDataProcessor(cfg, logger, progress)
-	p.validator = NewDataValidator(mysqlDB, cfg, logger)
+	// Initialize core components, sharing one limiter so the source database
+	// never sees more than mysql.max_concurrent_queries queries at once
+	limiter := NewQueryLimiter(cfg.MySQL.MaxConcurrentQueries)
+	p.processor = NewDataProcessor(cfg, logger, progress, limiter)
+
+	// Incremental runs read only rows past the previous run's watermarks;
+	// row counts and validation see the same rows
+	filters := cfg.Pipeline.TableFilters
+	if cfg.Pipeline.Incremental.Enabled {
+		watermarkPath := filepath.Join(cfg.Output.Directory, cfg.Output.WatermarkFile)
+		watermarks, err := LoadWatermarks(watermarkPath, cfg.Pipeline.Incremental.WatermarkColumn)
+		if err != nil {
+			p.Stop()
+			return nil, fmt.Errorf("failed to load watermarks: %w", err)
+		}
+		p.processor.SetWatermarks(watermarks)
+		filters = watermarks.Filters(filters)
+		logger.Info("Incremental export enabled",
+			"watermark_column", cfg.Pipeline.Incremental.WatermarkColumn,
+			"watermark_file", watermarkPath)
+	}
+	p.schema = NewSchemaExtractor(mysqlDB, logger, limiter, filters)
+	p.validator = NewDataValidator(readDB, cfg, logger, filters)
+	p.analyzer = NewDataAnalyzer(readDB, cfg, logger, limiter)
+
+	// Keep pooled connections alive through phases that run no queries
+	if interval := cfg.MySQL.ConnMaxIdleTime / 2; interval > 0 {
+		p.startKeepAlive(mysqlDB, interval, "primary")
+		if readDB != mysqlDB {
+			p.startKeepAlive(readDB, interval, "replica")
+		}
+	}
+
+	// Expose progress to Prometheus; the migration runs without it if the
+	// port cannot be bound
+	if cfg.Pipeline.EnableMetrics {
+		metrics := NewMetricsServer(cfg.Pipeline.MetricsPort, progress, logger)
+		if err := metrics.Start(); err != nil {
+			logger.Warn("Failed to start metrics server", "port", cfg.Pipeline.MetricsPort, "error", err)
+		} else {
+			p.metrics = metrics
+		}
+	}
 
 	return p, nil
 }
 
-// connectToMySQL establishes and configures MySQL database connection
-func connectToMySQL(cfg *config.Config, ctx context.Context) (*sql.DB, error) {
-	// Build connection string
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&timeout=%s",
-		cfg.MySQL.User, cfg.MySQL.Password, cfg.MySQL.Host, cfg.MySQL.Port,
-		cfg.MySQL.Database, cfg.MySQL.Timeout)
+// startKeepAlive pings db in the background until Stop
+func (p *Pipeline) startKeepAlive(db *sql.DB, interval time.Duration, name string) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		keepAlive(p.ctx, db, interval, name, p.logger)
+	}()
+}
+
+// connectToMySQL establishes and configures a MySQL database connection to dsn
+func connectToMySQL(cfg *config.Config, ctx context.Context, dsn string) (*sql.DB, error) {
+	// Register the custom TLS configuration referenced by the DSN
+	tlsConfig, err := cfg.MySQL.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if err := mysql.RegisterTLSConfig(config.MySQLTLSConfigName, tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to register TLS config: %w", err)
+		}
+	}
 
 	// Open database connection
 	mysqlDB, err := sql.Open("mysql", dsn)
@@ -111,7 +214,7 @@ func connectToMySQL(cfg *config.Config, ctx context.Context) (*sql.DB, error) {
 
 	// Configure connection pool for optimal performance
 	mysqlDB.SetMaxOpenConns(cfg.MySQL.MaxConnections)
-	mysqlDB.SetMaxIdleConns(cfg.MySQL.MaxConnections / 2)
+	mysqlDB.SetMaxIdleConns(max(cfg.MySQL.MaxConnections/2, cfg.MySQL.WarmupConnections))
 	mysqlDB.SetConnMaxLifetime(cfg.MySQL.ConnMaxLifetime)
 	mysqlDB.SetConnMaxIdleTime(cfg.MySQL.ConnMaxIdleTime)
 
@@ -121,14 +224,37 @@ func connectToMySQL(cfg *config.Config, ctx context.Context) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
 	}
 
+	if cfg.MySQL.WarmupConnections > 0 {
+		if err := warmUpConnections(ctx, mysqlDB, cfg.MySQL.WarmupConnections); err != nil {
+			mysqlDB.Close()
+			return nil, fmt.Errorf("failed to warm up MySQL connections: %w", err)
+		}
+	}
+
 	return mysqlDB, nil
 }
 
-// Stop gracefully shuts down the pipeline
+// Stop gracefully shuts down the pipeline. A running data phase stops after
+// the rows being converted, writes the output so far and a checkpoint, and
+// only then are the connections closed. Concurrent calls wait for the first.
 func (p *Pipeline) Stop() {
+	p.stopOnce.Do(p.stop)
+}
+
+func (p *Pipeline) stop() {
 	p.logger.Info("Stopping pipeline...")
 	p.cancel()
 	p.wg.Wait()
+	if p.metrics != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := p.metrics.Shutdown(ctx); err != nil {
+			p.logger.Warn("Failed to stop metrics server", "error", err)
+		}
+		cancel()
+	}
+	if p.readDB != nil && p.readDB != p.mysqlDB {
+		p.readDB.Close()
+	}
 	if p.mysqlDB != nil {
 		p.mysqlDB.Close()
 	}
@@ -137,7 +263,7 @@ func (p *Pipeline) Stop() {
 
 func (p *Pipeline) ExtractSchema() error {
 	p.logger.Info("Starting schema extraction")
-	schema, err := p.schema.ExtractSchema(p.ctx, p.cfg.MySQL.Database)
+	schema, err := p.loadSchema()
 	if err != nil {
 		return fmt.Errorf("schema extraction failed: %w", err)
 	}
@@ -152,14 +278,72 @@ func (p *Pipeline) ExtractSchema() error {
 	return nil
 }
 
+// loadSchema extracts the MySQL schema and, when enabled, adds relationships
+// discovered by sampling column data. Columns outside pipeline.table_columns
+// are removed, and binary columns dropped when mysql.binary_policy is skip.
+// With mysql.databases every listed database is extracted into one schema.
+func (p *Pipeline) loadSchema() (*Schema, error) {
+	var schema *Schema
+	var err error
+	if p.cfg.MySQL.QualifiedNames() {
+		schema, err = p.schema.ExtractSchemas(p.ctx, p.cfg.MySQL.Databases)
+	} else {
+		schema, err = p.schema.ExtractSchema(p.ctx, p.cfg.MySQL.Database)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.cfg.Pipeline.AnalyzeRelationships {
+		dataRelationships, err := p.analyzer.AnalyzeDataRelationships(p.ctx, schema)
+		if err != nil {
+			p.logger.Warn("Data relationship analysis failed", "error", err)
+		}
+		// A relationship on a column with a convention key replaces it
+		conventions := make(map[string]int)
+		for i, fk := range schema.Relationships {
+			if fk.Inferred == "convention" {
+				conventions[fk.TableName+"."+fk.ColumnName] = i
+			}
+		}
+		for _, rel := range dataRelationships {
+			if i, ok := conventions[rel.TableName+"."+rel.ColumnName]; ok {
+				schema.Relationships[i] = rel.ForeignKey
+				continue
+			}
+			schema.Relationships = append(schema.Relationships, rel.ForeignKey)
+		}
+	}
+
+	if err := selectTableColumns(p.cfg, schema); err != nil {
+		return nil, err
+	}
+	if skipped := skipGeneratedColumns(p.cfg, schema); skipped > 0 {
+		p.logger.Info("Skipping virtual generated columns", "columns", skipped)
+	}
+	if dropped := dropBinaryColumns(p.cfg, schema); dropped > 0 {
+		p.logger.Info("Skipping binary columns", "columns", dropped)
+	}
+	checkIncremental(p.cfg, schema, p.logger)
+
+	return schema, nil
+}
+
 func (p *Pipeline) GenerateDgraphSchema() error {
 	p.logger.Info("Generating Dgraph schema")
 
-	schema, err := p.schema.ExtractSchema(p.ctx, p.cfg.MySQL.Database)
+	schema, err := p.loadSchema()
 	if err != nil {
 		return fmt.Errorf("failed to extract schema: %w", err)
 	}
 
+	if p.cfg.Pipeline.DryRun {
+		p.logger.Info("Dry run: skipping schema file",
+			"tables", len(schema.Tables),
+			"relationships", len(schema.Relationships))
+		return nil
+	}
+
 	generator := NewSchemaGenerator(p.cfg, p.logger)
 	if err := generator.Generate(schema); err != nil {
 		return fmt.Errorf("schema generation failed: %w", err)
@@ -170,10 +354,14 @@ func (p *Pipeline) GenerateDgraphSchema() error {
 }
 
 func (p *Pipeline) MigrateData(tables string) error {
+	// Stop waits for the output and checkpoint to be written
+	p.wg.Add(1)
+	defer p.wg.Done()
+
 	p.logger.Info("Starting data migration")
 
 	// Extract schema first
-	schema, err := p.schema.ExtractSchema(p.ctx, p.cfg.MySQL.Database)
+	schema, err := p.loadSchema()
 	if err != nil {
 		return fmt.Errorf("failed to extract schema: %w", err)
 	}
@@ -181,16 +369,44 @@ func (p *Pipeline) MigrateData(tables string) error {
 	// Determine tables to process
 	tablesToProcess := p.determineTablesToProcess(schema, tables)
 	p.progress.TotalTables = len(tablesToProcess)
+	p.migratedTables = tablesToProcess
+
+	// A dry run reports what would be produced and writes nothing
+	if p.cfg.Pipeline.DryRun {
+		BuildPlan(p.cfg, schema, tablesToProcess).Log(p.logger)
+		return nil
+	}
 
 	p.logger.Info("Starting data processing",
 		"tables", len(tablesToProcess),
 		"workers", p.cfg.Pipeline.Workers)
 
+	// Send mutations straight to Dgraph instead of writing files
+	if p.cfg.Output.Target == "dgraph" {
+		transport, err := p.prepareDgraphTarget(schema)
+		if err != nil {
+			return err
+		}
+		defer transport.Close()
+	}
+
 	// Start progress reporter
 	go p.reportProgress()
 
+	// Split the RDF output into data_chunk_N.rdf files instead of one file
+	if p.cfg.Output.ChunkSize > 0 {
+		exporter := NewChunkedExporter(p.cfg, p.logger, p.cfg.Output.Directory, p.cfg.Output.ChunkSize)
+		chunks, err := exporter.ExportInChunks(p.ctx, p.processor, p.readDB, schema, tablesToProcess)
+		p.chunks = chunks
+		if err != nil {
+			return fmt.Errorf("chunked export failed: %w", err)
+		}
+		p.logger.Info("Data migration completed successfully", "chunks", len(chunks))
+		return nil
+	}
+
 	// Process tables
-	if err := p.processor.ProcessTables(p.ctx, p.mysqlDB, schema, tablesToProcess); err != nil {
+	if err := p.processor.ProcessTables(p.ctx, p.readDB, schema, tablesToProcess); err != nil {
 		return fmt.Errorf("data processing failed: %w", err)
 	}
 
@@ -198,6 +414,46 @@ func (p *Pipeline) MigrateData(tables string) error {
 	return nil
 }
 
+// prepareDgraphTarget connects to Dgraph, applies the schema generated from
+// the extracted MySQL schema so predicates are typed before data arrives, and
+// points the processor at a mutation sink
+func (p *Pipeline) prepareDgraphTarget(schema *Schema) (importer.Transport, error) {
+	transport, err := importer.NewTransport(p.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Dgraph: %w", err)
+	}
+
+	generator := NewSchemaGenerator(p.cfg, p.logger)
+	if err := generator.Generate(schema); err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	schemaData, err := os.ReadFile(filepath.Join(p.cfg.Output.Directory, p.cfg.Output.SchemaFile))
+	if err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	err = p.processor.retries.Do(p.ctx, p.cfg.Dgraph.MaxRetries, p.cfg.Dgraph.RetryDelay,
+		func(attempt int, err error) {
+			p.logger.Warn("Retrying schema alter", "attempt", attempt, "error", err)
+		},
+		func() error {
+			return transport.Alter(p.ctx, string(schemaData))
+		})
+	if err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	p.processor.SetDgraphSink(NewDgraphSink(p.cfg, p.logger, p.progress, transport, p.processor.retries))
+	return transport, nil
+}
+
+// writesRDFFile reports whether the data phase produces the RDF file
+func (p *Pipeline) writesRDFFile() bool {
+	return p.cfg.Output.Target == "file" && p.cfg.Output.Format == "rdf"
+}
+
 func (p *Pipeline) ValidateData() error {
 	p.logger.Info("Starting data validation")
 
@@ -223,6 +479,12 @@ func (p *Pipeline) RunFull(tables string) error {
 		return fmt.Errorf("data migration failed: %w", err)
 	}
 
+	// A dry run has no output to build a schema from or validate
+	if p.cfg.Pipeline.DryRun {
+		p.logger.Info("Dry run completed, no files written")
+		return nil
+	}
+
 	// Step 3: Generate final schema with discovered relationships
 	if err := p.GenerateDgraphSchemaFromData(); err != nil {
 		return fmt.Errorf("schema generation failed: %w", err)
@@ -241,34 +503,51 @@ func (p *Pipeline) RunFull(tables string) error {
 
 // determineTablesToProcess returns the list of tables to process based on input
 func (p *Pipeline) determineTablesToProcess(schema *Schema, tables string) []string {
+	var candidates []string
 	if tables == "" {
 		// Process all tables in the schema
-		var allTables []string
 		for tableName := range schema.Tables {
-			allTables = append(allTables, tableName)
+			candidates = append(candidates, tableName)
 		}
-		return allTables
-	}
+		sort.Strings(candidates)
+	} else {
+		// Parse and validate specified tables
+		for _, table := range strings.Split(tables, ",") {
+			table = strings.TrimSpace(table)
+			if table == "" {
+				continue
+			}
 
-	// Parse and validate specified tables
-	var result []string
-	for _, table := range strings.Split(tables, ",") {
-		table = strings.TrimSpace(table)
-		if table == "" {
-			continue
+			if _, exists := schema.Tables[table]; exists {
+				candidates = append(candidates, table)
+			} else {
+				p.logger.Warn("Table not found in schema", "table", table)
+			}
 		}
+	}
 
-		if _, exists := schema.Tables[table]; exists {
+	// Apply include_tables and exclude_tables
+	var result []string
+	for _, table := range candidates {
+		if p.cfg.Pipeline.IncludesTable(table) {
 			result = append(result, table)
-		} else {
-			p.logger.Warn("Table not found in schema", "table", table)
 		}
 	}
+
+	p.logger.Info("Resolved tables to process",
+		"count", len(result),
+		"excluded", len(candidates)-len(result),
+		"tables", result)
 	return result
 }
 
-// reportProgress runs a background goroutine to report pipeline progress
+// reportProgress logs pipeline progress every progress_report_interval until
+// the pipeline stops. It is the only progress reporter; an interval of 0
+// turns reporting off.
 func (p *Pipeline) reportProgress() {
+	if p.cfg.Pipeline.ProgressReportInterval <= 0 {
+		return
+	}
 	ticker := time.NewTicker(p.cfg.Pipeline.ProgressReportInterval)
 	defer ticker.Stop()
 
@@ -304,6 +583,9 @@ func (p *Pipeline) logProgress() {
 		}
 	}
 
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
 	p.logger.Info("Pipeline progress report",
 		"current_table", p.progress.CurrentTable,
 		"processed_tables", p.progress.ProcessedTables,
@@ -314,6 +596,9 @@ func (p *Pipeline) logProgress() {
 		"elapsed", elapsed.Round(time.Second),
 		"eta", eta.Round(time.Second),
 		"errors", p.progress.ErrorCount,
+		"mutation_batches", p.progress.MutationBatches,
+		"assigned_uids", p.progress.AssignedUIDs,
+		"memory_mb", fmt.Sprintf("%.2f", float64(mem.Alloc)/1024/1024),
 	)
 }
 
@@ -326,18 +611,32 @@ func (p *Pipeline) GenerateDgraphSchemaFromData() error {
 		return fmt.Errorf("no schema available - run ExtractSchema first")
 	}
 
-	// Read the RDF file to discover actual relationships
-	rdfFile := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.RDFFile)
-	if _, err := os.Stat(rdfFile); os.IsNotExist(err) {
-		return fmt.Errorf("RDF file not found: %s", rdfFile)
-	}
+	// JSON batches carry the same edges, but discovery reads the RDF file, so
+	// JSON output relies on the extracted relationships alone
+	var discoveredRelationships []ForeignKey
+	if !p.writesRDFFile() {
+		p.logger.Info("Skipping relationship discovery, no RDF file was written")
+	} else {
+		// Read the RDF files to discover actual relationships
+		rdfFiles := p.rdfOutputFiles()
+		for _, rdfFile := range rdfFiles {
+			if _, err := os.Stat(rdfFile); os.IsNotExist(err) {
+				return fmt.Errorf("RDF file not found: %s", rdfFile)
+			}
+		}
 
-	// Parse RDF to discover relationships
-	discoveredRelationships, err := p.parseRDFForRelationships(rdfFile)
-	if err != nil {
-		return fmt.Errorf("failed to parse RDF for relationships: %w", err)
+		// Parse RDF to discover relationships
+		var err error
+		discoveredRelationships, err = p.parseRDFForRelationships(rdfFiles)
+		if err != nil {
+			return fmt.Errorf("failed to parse RDF for relationships: %w", err)
+		}
 	}
 
+	// Edges written for collapsed junction tables look like relationships
+	// but are already declared
+	discoveredRelationships = withoutJunctionEdges(p.cfg, p.extractedSchema, discoveredRelationships)
+
 	// Update schema with discovered relationships
 	p.extractedSchema.Relationships = append(p.extractedSchema.Relationships, discoveredRelationships...)
 
@@ -347,23 +646,179 @@ func (p *Pipeline) GenerateDgraphSchemaFromData() error {
 		return fmt.Errorf("failed to generate schema: %w", err)
 	}
 
+	// Stamp the data files with the schema they were generated against
+	if p.cfg.Output.EmbedSchemaHeader && p.writesRDFFile() {
+		if err := p.embedSchemaHeaders(); err != nil {
+			return fmt.Errorf("failed to embed schema headers: %w", err)
+		}
+	}
+
 	p.logger.Info("Dgraph schema generated from data successfully",
 		"discovered_relationships", len(discoveredRelationships))
 	return nil
 }
 
+// withoutJunctionEdges drops discovered relationships that are the edges of
+// collapsed junction tables
+func withoutJunctionEdges(cfg *config.Config, schema *Schema, relationships []ForeignKey) []ForeignKey {
+	edges := make(map[string]bool)
+	for _, table := range schema.Tables {
+		if junction := collapsedJunction(cfg, table); junction != nil {
+			forward, backward := junction.Predicates()
+			edges[forward] = true
+			edges[backward] = true
+		}
+	}
+	if len(edges) == 0 {
+		return relationships
+	}
+
+	var result []ForeignKey
+	for _, fk := range relationships {
+		if !edges[fk.TableName+"."+fk.ColumnName] {
+			result = append(result, fk)
+		}
+	}
+	return result
+}
+
+// rdfOutputFiles returns the RDF data files produced by the data phase
+func (p *Pipeline) rdfOutputFiles() []string {
+	var files []string
+	for _, name := range rdfDataFiles(p.cfg) {
+		files = append(files, filepath.Join(p.cfg.Output.Directory, name))
+	}
+	return files
+}
+
+// embedSchemaHeaders prepends each RDF file with its predicate list and the
+// checksum of the generated schema file
+func (p *Pipeline) embedSchemaHeaders() error {
+	schemaPath := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.SchemaFile)
+	checksum, err := SchemaChecksum(schemaPath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum schema: %w", err)
+	}
+
+	for _, rdfPath := range p.rdfOutputFiles() {
+		if err := EmbedSchemaHeader(rdfPath, checksum); err != nil {
+			return fmt.Errorf("%s: %w", rdfPath, err)
+		}
+		p.logger.Debug("Embedded schema header", "file", rdfPath, "checksum", checksum)
+	}
+
+	// The headers change the chunk files the manifest describes
+	if p.cfg.Output.ChunkSize > 0 {
+		exporter := NewChunkedExporter(p.cfg, p.logger, p.cfg.Output.Directory, p.cfg.Output.ChunkSize)
+		if err := exporter.RefreshManifest(); err != nil {
+			return fmt.Errorf("failed to update chunk manifest: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // parseRDFForRelationships parses the RDF file to discover actual relationships used
-func (p *Pipeline) parseRDFForRelationships(rdfFile string) ([]ForeignKey, error) {
-	file, err := os.Open(rdfFile)
+func (p *Pipeline) parseRDFForRelationships(rdfFiles []string) ([]ForeignKey, error) {
+	observed, err := observeRDFRelationships(rdfFiles, p.extractedSchema, p.nameMap(), p.cfg.Output.UIDNamespace)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	var relationships []ForeignKey
-	relationshipMap := make(map[string]ForeignKey) // To avoid duplicates
+	relationships := make([]ForeignKey, 0, len(observed))
+	for _, usage := range observed {
+		relationships = append(relationships, usage.ForeignKey)
+	}
+	return relationships, nil
+}
+
+// splitTablePrefix splits a predicate (table.column) or blank node label
+// (table_key) at the separator following the longest known table name it
+// starts with. Names of unknown tables are split at the only "." of a
+// predicate or the last "_" of a label, as both kinds of name may hold the
+// separator themselves.
+func splitTablePrefix(name, sep string, tables []string) (table, rest string, ok bool) {
+	for _, tableName := range tables {
+		if strings.HasPrefix(name, tableName+sep) {
+			return tableName, name[len(tableName)+len(sep):], true
+		}
+	}
+
+	if sep == "." {
+		if strings.Count(name, ".") != 1 {
+			return "", "", false
+		}
+		table, rest, _ = strings.Cut(name, ".")
+		return table, rest, true
+	}
+	i := strings.LastIndex(name, sep)
+	if i <= 0 {
+		return "", "", false
+	}
+	return name[:i], name[i+len(sep):], true
+}
+
+// nameMap returns the shortened-to-original names recorded in the name map
+// file, or nil if no names were shortened
+func (p *Pipeline) nameMap() map[string]string {
+	names, err := LoadNameMap(filepath.Join(p.cfg.Output.Directory, p.cfg.Output.NameMapFile))
+	if err != nil && !os.IsNotExist(err) {
+		p.logger.Warn("Failed to read name map", "error", err)
+	}
+	return names
+}
+
+// observeRDFRelationships counts the edges of each table.column -> table
+// relationship in RDF files. Shortened predicates are resolved through
+// originals, and blank nodes carry the given uid_namespace prefix. Tables are
+// recognized by the schema's table names. Results are sorted by relationship.
+func observeRDFRelationships(rdfFiles []string, schema *Schema, originals map[string]string, namespace string) ([]RelationshipUsage, error) {
+	// Longest names first, so order_items_2024 wins over order_items
+	var tables []string
+	if schema != nil {
+		for tableName := range schema.Tables {
+			tables = append(tables, tableName)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if len(tables[i]) != len(tables[j]) {
+			return len(tables[i]) > len(tables[j])
+		}
+		return tables[i] < tables[j]
+	})
+
+	relationshipMap := make(map[string]*RelationshipUsage) // To avoid duplicates
+	for _, rdfFile := range rdfFiles {
+		if err := countRDFRelationships(rdfFile, tables, originals, namespace, relationshipMap); err != nil {
+			return nil, err
+		}
+	}
+
+	// Convert map to slice in key order so repeated runs yield the same result
+	var keys []string
+	for key := range relationshipMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	relationships := make([]RelationshipUsage, 0, len(keys))
+	for _, key := range keys {
+		relationships = append(relationships, *relationshipMap[key])
+	}
+	return relationships, nil
+}
+
+// countRDFRelationships adds the relationship edges in one RDF file to
+// relationshipMap. tables are the known table names, longest first.
+func countRDFRelationships(rdfFile string, tables []string, originals map[string]string, namespace string, relationshipMap map[string]*RelationshipUsage) error {
+	file, err := compress.Open(rdfFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRDFLineBytes)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -371,50 +826,54 @@ func (p *Pipeline) parseRDFForRelationships(rdfFile string) ([]ForeignKey, error
 		}
 
 		// Look for relationship patterns: _:table_id <table.column> _:ref_table_id
-		if strings.Contains(line, "_:") && strings.Contains(line, ">") && strings.Contains(line, "<") {
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				// subject := parts[0]  // _:table_id (not needed for relationship discovery)
-				predicate := parts[1] // <table.column>
-				object := parts[2]    // _:ref_table_id or "value"
-
-				// Check if this is a relationship (object is a blank node)
-				if strings.HasPrefix(object, "_:") && strings.HasPrefix(predicate, "<") && strings.HasSuffix(predicate, ">") {
-					// Extract table and column from predicate
-					pred := strings.Trim(predicate, "<>")
-					predParts := strings.Split(pred, ".")
-					if len(predParts) == 2 {
-						tableName := predParts[0]
-						columnName := predParts[1]
-
-						// Extract referenced table from object
-						refTableName := strings.TrimPrefix(object, "_:")
-						if underscoreIdx := strings.LastIndex(refTableName, "_"); underscoreIdx > 0 {
-							refTableName = refTableName[:underscoreIdx]
-						}
-
-						// Create relationship key to avoid duplicates
-						relationshipKey := fmt.Sprintf("%s.%s->%s", tableName, columnName, refTableName)
-
-						if _, exists := relationshipMap[relationshipKey]; !exists {
-							relationshipMap[relationshipKey] = ForeignKey{
-								TableName:      tableName,
-								ColumnName:     columnName,
-								RefTableName:   refTableName,
-								RefColumnName:  "id", // Assume primary key is 'id'
-								ConstraintName: fmt.Sprintf("fk_%s_%s", tableName, columnName),
-							}
-						}
-					}
-				}
-			}
+		if !strings.Contains(line, "_:") || !strings.Contains(line, ">") || !strings.Contains(line, "<") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			continue
+		}
+		predicate := parts[1] // <table.column>
+		object := parts[2]    // _:ref_table_id or "value"
+
+		// Check if this is a relationship (object is a blank node)
+		if !strings.HasPrefix(object, "_:") || !strings.HasPrefix(predicate, "<") || !strings.HasSuffix(predicate, ">") {
+			continue
+		}
+
+		// Extract table and column from predicate
+		pred := strings.Trim(predicate, "<>")
+		if original, ok := originals[pred]; ok {
+			pred = original
+		}
+		tableName, columnName, ok := splitTablePrefix(pred, ".", tables)
+		if !ok {
+			continue
 		}
-	}
 
-	// Convert map to slice
-	for _, rel := range relationshipMap {
-		relationships = append(relationships, rel)
+		// Extract referenced table from object
+		label := strings.TrimPrefix(strings.TrimPrefix(object, "_:"), uidPrefix(namespace))
+		refTableName, _, ok := splitTablePrefix(label, "_", tables)
+		if !ok {
+			continue
+		}
+
+		relationshipKey := fmt.Sprintf("%s.%s->%s", tableName, columnName, refTableName)
+		usage, exists := relationshipMap[relationshipKey]
+		if !exists {
+			usage = &RelationshipUsage{
+				ForeignKey: ForeignKey{
+					TableName:      tableName,
+					ColumnName:     columnName,
+					RefTableName:   refTableName,
+					RefColumnName:  "id", // Assume primary key is 'id'
+					ConstraintName: fmt.Sprintf("fk_%s_%s", tableName, columnName),
+				},
+			}
+			relationshipMap[relationshipKey] = usage
+		}
+		usage.Edges++
 	}
 
-	return relationships, scanner.Err()
+	return scanner.Err()
 }
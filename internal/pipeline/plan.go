@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// literalSizes is the assumed average size of a quoted object per Dgraph
+// type, used to estimate output size without reading any rows
+var literalSizes = map[string]int64{
+	"int":      8,
+	"float":    12,
+	"bool":     6,
+	"datetime": 27,
+	"string":   24,
+}
+
+// TablePlan is what a dry run expects one table to produce
+type TablePlan struct {
+	Table   string
+	Rows    int64
+	Triples int64 // Type and xid triples, column triples and reverse edges over all rows
+	Bytes   int64 // Estimated RDF size
+}
+
+// MigrationPlan is printed by a dry run instead of writing any output
+type MigrationPlan struct {
+	Tables        []TablePlan
+	Relationships []ForeignKey
+	TotalRows     int64
+	TotalTriples  int64
+	TotalBytes    int64
+}
+
+// BuildPlan estimates the output of migrating tables from the extracted row
+// counts. Every row is assumed to have all of its columns set, so the
+// estimates are upper bounds for tables with NULLs.
+func BuildPlan(cfg *config.Config, schema *Schema, tables []string) *MigrationPlan {
+	plan := &MigrationPlan{}
+
+	fks := make(map[string]string)
+	for _, fk := range schema.Relationships {
+		fks[fk.TableName+"."+fk.ColumnName] = fk.RefTableName
+	}
+
+	for _, tableName := range tables {
+		table := schema.Tables[tableName]
+		if table == nil {
+			continue
+		}
+
+		subjectSize := int64(len(makeUID(cfg.Output.UIDNamespace, tableName, "00000000")))
+		// Type triple
+		rowTriples := int64(1)
+		rowBytes := subjectSize + int64(len(" <dgraph.type> \"\" .\n")+len(tableName))
+		if cfg.Output.EmitXID {
+			// xid triple holding table:key
+			rowTriples++
+			rowBytes += subjectSize + int64(len(" <xid> \"\" .\n")+len(tableName)+len(":00000000"))
+		}
+
+		for columnName, column := range table.Columns {
+			rule := cfg.Pipeline.ColumnRule(tableName, columnName)
+			if rule == "drop" {
+				continue
+			}
+			predicateSize := int64(len(tableName) + len(columnName) + 3) // <table.column>
+
+			if refTable, ok := fks[tableName+"."+columnName]; ok && rule == "" {
+				// Forward edge and, with manual reverse edges, its reverse
+				edges := int64(1)
+				if cfg.Output.ManualReverseEdges() {
+					edges = 2
+				}
+				refSize := int64(len(makeUID(cfg.Output.UIDNamespace, refTable, "00000000")))
+				rowTriples += edges
+				rowBytes += edges * (subjectSize + predicateSize + refSize + 4)
+				continue
+			}
+
+			size, ok := literalSizes[columnDgraphType(cfg, tableName, column)]
+			if !ok {
+				size = literalSizes["string"]
+			}
+			rowTriples++
+			rowBytes += subjectSize + predicateSize + size + 4
+		}
+
+		tp := TablePlan{
+			Table:   tableName,
+			Rows:    table.RowCount,
+			Triples: rowTriples * table.RowCount,
+			Bytes:   rowBytes * table.RowCount,
+		}
+		plan.Tables = append(plan.Tables, tp)
+		plan.TotalRows += tp.Rows
+		plan.TotalTriples += tp.Triples
+		plan.TotalBytes += tp.Bytes
+	}
+
+	selected := make(map[string]bool, len(tables))
+	for _, tableName := range tables {
+		selected[tableName] = true
+	}
+	for _, fk := range schema.Relationships {
+		if selected[fk.TableName] {
+			plan.Relationships = append(plan.Relationships, fk)
+		}
+	}
+	sort.Slice(plan.Relationships, func(i, j int) bool {
+		a, b := plan.Relationships[i], plan.Relationships[j]
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		return a.ColumnName < b.ColumnName
+	})
+
+	return plan
+}
+
+// Log prints the plan, one line per table and relationship
+func (mp *MigrationPlan) Log(logger *logger.Logger) {
+	for _, tp := range mp.Tables {
+		logger.Info("Dry run: table plan",
+			"table", tp.Table,
+			"rows", tp.Rows,
+			"estimated_triples", tp.Triples,
+			"estimated_bytes", formatBytes(tp.Bytes))
+	}
+	for _, fk := range mp.Relationships {
+		logger.Info("Dry run: relationship",
+			"from", fk.TableName+"."+fk.ColumnName,
+			"to", fk.RefTableName)
+	}
+	logger.Info("Dry run: migration plan",
+		"tables", len(mp.Tables),
+		"relationships", len(mp.Relationships),
+		"rows", mp.TotalRows,
+		"estimated_triples", mp.TotalTriples,
+		"estimated_bytes", formatBytes(mp.TotalBytes))
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
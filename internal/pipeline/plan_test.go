@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestBuildPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		tables        []string
+		rules         map[string]string // pipeline.column_rules
+		triples       map[string]int64
+		relationships int
+	}{
+		{
+			// users: type, id, name; orders: type, id, edge and its reverse
+			name:          "all tables",
+			tables:        []string{"users", "orders"},
+			triples:       map[string]int64{"users": 3 * 2, "orders": 4 * 3},
+			relationships: 1,
+		},
+		{
+			name:    "selected tables only",
+			tables:  []string{"users"},
+			triples: map[string]int64{"users": 3 * 2},
+		},
+		{
+			name:    "unknown tables are left out",
+			tables:  []string{"users", "missing"},
+			triples: map[string]int64{"users": 3 * 2},
+		},
+		{
+			name:          "dropped columns",
+			tables:        []string{"users", "orders"},
+			rules:         map[string]string{"users.name": "drop"},
+			triples:       map[string]int64{"users": 2 * 2, "orders": 4 * 3},
+			relationships: 1,
+		},
+		{
+			// A masked key is a value, not an edge
+			name:          "masked foreign key",
+			tables:        []string{"users", "orders"},
+			rules:         map[string]string{"orders.user_id": "hash"},
+			triples:       map[string]int64{"users": 3 * 2, "orders": 3 * 3},
+			relationships: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.ColumnRules = tt.rules
+			schema := planSchema()
+			plan := BuildPlan(cfg, schema, tt.tables)
+
+			if len(plan.Tables) != len(tt.triples) {
+				t.Fatalf("planned %+v, want %d tables", plan.Tables, len(tt.triples))
+			}
+			var rows, triples, bytes int64
+			for _, tp := range plan.Tables {
+				if tp.Triples != tt.triples[tp.Table] {
+					t.Errorf("%s: %d triples, want %d", tp.Table, tp.Triples, tt.triples[tp.Table])
+				}
+				if tp.Rows != schema.Tables[tp.Table].RowCount || tp.Bytes <= 0 {
+					t.Errorf("%s: %d rows, %d bytes", tp.Table, tp.Rows, tp.Bytes)
+				}
+				rows += tp.Rows
+				triples += tp.Triples
+				bytes += tp.Bytes
+			}
+			if plan.TotalRows != rows || plan.TotalTriples != triples || plan.TotalBytes != bytes {
+				t.Errorf("totals %d rows, %d triples, %d bytes, want %d, %d, %d",
+					plan.TotalRows, plan.TotalTriples, plan.TotalBytes, rows, triples, bytes)
+			}
+			if len(plan.Relationships) != tt.relationships {
+				t.Errorf("relationships %+v, want %d", plan.Relationships, tt.relationships)
+			}
+		})
+	}
+}
+
+// TestPlanEstimatesOutput compares the plan with the RDF actually written
+// for the same rows
+func TestPlanEstimatesOutput(t *testing.T) {
+	cfg := testConfig(t)
+	schema := planSchema()
+	plan := BuildPlan(cfg, schema, []string{"users", "orders"})
+
+	lines := processRDF(t, cfg, planSchema(), map[string]*fakeTable{
+		"users": {columns: []string{"id", "name"}, rows: [][]driver.Value{
+			{int64(1), "Ada Lovelace"}, {int64(2), "Grace Hopper"},
+		}},
+		"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+			{int64(1), int64(1)}, {int64(2), int64(1)}, {int64(3), int64(2)},
+		}},
+	})
+	var bytes int64
+	for _, line := range lines {
+		bytes += int64(len(line)) + 1
+	}
+	if plan.TotalTriples != int64(len(lines)) {
+		t.Errorf("estimated %d triples, wrote %d", plan.TotalTriples, len(lines))
+	}
+	if plan.TotalBytes < bytes/2 || plan.TotalBytes > bytes*2 {
+		t.Errorf("estimated %d bytes, wrote %d", plan.TotalBytes, bytes)
+	}
+}
+
+// planSchema is 2 users and 3 orders referencing them
+func planSchema() *Schema {
+	schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+	schema.Tables["users"].Columns["name"] = &Column{Name: "name", Type: "varchar", ColumnType: "varchar(50)"}
+	schema.Tables["users"].RowCount = 2
+	schema.Tables["orders"].RowCount = 3
+	return schema
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestDryRun checks a dry run of each mode writes no files and reads no rows
+// beyond the row counts of schema extraction
+func TestDryRun(t *testing.T) {
+	for _, mode := range []string{ModeSchema, ModeData, ModeFull} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			cfg.Pipeline.DryRun = true
+			db, fake := newFakeDB(t, shopSchema().serve)
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+			if _, err := p.Run(context.Background(), mode, RunOptions{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			filepath.WalkDir(cfg.Output.Directory, func(path string, d os.DirEntry, err error) error {
+				if err == nil && path != cfg.Output.Directory {
+					t.Errorf("dry run created %s", path)
+				}
+				return err
+			})
+			for _, query := range fake.Queries() {
+				if strings.HasPrefix(query, "SELECT COUNT") {
+					continue
+				}
+				if strings.Contains(query, "FROM `users`") || strings.Contains(query, "FROM `orders`") {
+					t.Errorf("dry run read rows: %s", query)
+				}
+			}
+		})
+	}
+}
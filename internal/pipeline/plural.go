@@ -0,0 +1,125 @@
+package pipeline
+
+import "strings"
+
+// irregularPlurals lists nouns the suffix rules get wrong. Uncountable nouns
+// map to themselves.
+var irregularPlurals = map[string]string{
+	"person":      "people",
+	"child":       "children",
+	"man":         "men",
+	"woman":       "women",
+	"mouse":       "mice",
+	"goose":       "geese",
+	"foot":        "feet",
+	"tooth":       "teeth",
+	"ox":          "oxen",
+	"datum":       "data",
+	"criterion":   "criteria",
+	"medium":      "media",
+	"analysis":    "analyses",
+	"chef":        "chefs",
+	"roof":        "roofs",
+	"belief":      "beliefs",
+	"data":        "data",
+	"metadata":    "metadata",
+	"series":      "series",
+	"species":     "species",
+	"news":        "news",
+	"information": "information",
+	"equipment":   "equipment",
+	"feedback":    "feedback",
+	"software":    "software",
+	"sheep":       "sheep",
+	"fish":        "fish",
+	"deer":        "deer",
+}
+
+// irregularSingulars is irregularPlurals inverted
+var irregularSingulars = func() map[string]string {
+	singulars := make(map[string]string, len(irregularPlurals))
+	for singular, plural := range irregularPlurals {
+		if _, ok := singulars[plural]; !ok || singular == plural {
+			singulars[plural] = singular
+		}
+	}
+	return singulars
+}()
+
+// pluralForm returns the lowercase plural of a word. Overrides are checked
+// first, then the irregular nouns, then the suffix rules. For snake_case
+// names only the last word is inflected: order_item -> order_items.
+func pluralForm(word string, overrides map[string]string) string {
+	word = strings.ToLower(word)
+	if plural, ok := lookupOverride(overrides, word); ok {
+		return plural
+	}
+
+	prefix, last := splitLastWord(word)
+	if plural, ok := irregularPlurals[last]; ok {
+		return prefix + plural
+	}
+
+	switch {
+	case strings.HasSuffix(last, "s") || strings.HasSuffix(last, "x") ||
+		strings.HasSuffix(last, "z") || strings.HasSuffix(last, "ch") ||
+		strings.HasSuffix(last, "sh"):
+		return word + "es"
+	case strings.HasSuffix(last, "y") && len(last) > 1 && !strings.ContainsRune("aeiou", rune(last[len(last)-2])):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(last, "fe"):
+		return word[:len(word)-2] + "ves"
+	case strings.HasSuffix(last, "f"):
+		return word[:len(word)-1] + "ves"
+	}
+	return word + "s"
+}
+
+// singularForm undoes pluralForm: the overrides and irregular nouns are looked
+// up in reverse, then the common plural endings are removed. The case of the
+// remaining letters is kept.
+func singularForm(word string, overrides map[string]string) string {
+	lower := strings.ToLower(word)
+	for singular, plural := range overrides {
+		if strings.ToLower(plural) == lower {
+			return singular
+		}
+	}
+
+	prefix, last := splitLastWord(lower)
+	if singular, ok := irregularSingulars[last]; ok {
+		return word[:len(prefix)] + singular
+	}
+
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(word) > 3:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"),
+		strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(lower, "ss"):
+		return word
+	case strings.HasSuffix(lower, "s") && len(word) > 1:
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// lookupOverride finds a word in overrides regardless of the case of its keys
+func lookupOverride(overrides map[string]string, word string) (string, bool) {
+	if plural, ok := overrides[word]; ok {
+		return plural, true
+	}
+	for singular, plural := range overrides {
+		if strings.ToLower(singular) == word {
+			return plural, true
+		}
+	}
+	return "", false
+}
+
+// splitLastWord splits a snake_case name before its last word
+func splitLastWord(name string) (prefix, last string) {
+	i := strings.LastIndex(name, "_")
+	return name[:i+1], name[i+1:]
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestPluralForm(t *testing.T) {
+	overrides := map[string]string{"cactus": "cacti", "Octopus": "octopodes"}
+	tests := []struct {
+		word string
+		want string
+	}{
+		// Irregular nouns
+		{"person", "people"},
+		{"child", "children"},
+		{"man", "men"},
+		{"woman", "women"},
+		{"mouse", "mice"},
+		{"datum", "data"},
+		{"criterion", "criteria"},
+		{"analysis", "analyses"},
+		{"data", "data"},
+		{"metadata", "metadata"},
+		{"series", "series"},
+		{"chef", "chefs"},
+		// Suffix rules
+		{"user", "users"},
+		{"category", "categories"},
+		{"company", "companies"},
+		{"day", "days"},
+		{"box", "boxes"},
+		{"address", "addresses"},
+		{"batch", "batches"},
+		{"wish", "wishes"},
+		{"knife", "knives"},
+		{"leaf", "leaves"},
+		// Only the last word of a snake_case name is inflected
+		{"order_item", "order_items"},
+		{"sales_person", "sales_people"},
+		{"parent_child", "parent_children"},
+		{"user_category", "user_categories"},
+		// Case is folded
+		{"Person", "people"},
+		// Overrides come first, whatever the case of their keys
+		{"cactus", "cacti"},
+		{"octopus", "octopodes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := pluralForm(tt.word, overrides); got != tt.want {
+				t.Errorf("pluralForm(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSingularForm(t *testing.T) {
+	overrides := map[string]string{"cactus": "cacti"}
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"people", "person"},
+		{"children", "child"},
+		{"data", "data"},
+		{"series", "series"},
+		{"users", "user"},
+		{"categories", "category"},
+		{"boxes", "box"},
+		{"addresses", "address"},
+		{"address", "address"},
+		{"order_items", "order_item"},
+		{"sales_people", "sales_person"},
+		{"Users", "User"},
+		{"cacti", "cactus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := singularForm(tt.word, overrides); got != tt.want {
+				t.Errorf("singularForm(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPluralReverseEdges checks reverse edges are named with irregular plurals
+// and pluralization_overrides
+func TestPluralReverseEdges(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		child     string
+		want      string
+	}{
+		{name: "regular", child: "company", want: "users.companies"},
+		{name: "irregular", child: "person", want: "users.people"},
+		{name: "uncountable", child: "metadata", want: "users.metadata"},
+		{name: "override", overrides: map[string]string{"person": "persons"}, child: "person", want: "users.persons"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.PluralizationOverrides = tt.overrides
+			schema := fkSchema(map[string][]string{"users": nil, tt.child: {"user_id"}}, [][3]string{{tt.child, "user_id", "users"}})
+			names := NewSchemaGenerator(cfg, logger.New("error", "text")).semanticReverseNames(schema)
+			if got := names[tt.child+".user_id"]; got != tt.want {
+				t.Errorf("reverse of %s.user_id = %q, want %q", tt.child, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// PreflightCheck is the outcome of one preflight check
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"` // What was confirmed, or what to fix
+}
+
+// PreflightReport is the result of preflight mode
+type PreflightReport struct {
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// Passed reports whether every check passed
+func (r *PreflightReport) Passed() bool {
+	return r.Failed() == 0
+}
+
+// Failed returns the number of failed checks
+func (r *PreflightReport) Failed() int {
+	failed := 0
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteText writes the checks as a human-readable report
+func (r *PreflightReport) WriteText(w io.Writer) {
+	for _, check := range r.Checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, check.Name, check.Message)
+	}
+	fmt.Fprintf(w, "%d of %d checks passed\n", len(r.Checks)-r.Failed(), len(r.Checks))
+}
+
+func (r *PreflightReport) pass(name, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Passed: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *PreflightReport) fail(name, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// Preflight confirms, before a long run, that MySQL and Dgraph are reachable
+// with the configured credentials and TLS and that the output directory is
+// writable. Every check runs, and is reported, even after another fails.
+func Preflight(ctx context.Context, cfg *config.Config, logger *logger.Logger) *PreflightReport {
+	report := &PreflightReport{}
+
+	preflightMySQL(ctx, cfg, report, "MySQL", cfg.MySQL.Host, cfg.MySQL.Port, cfg.MySQL.ConnectionString())
+	if cfg.MySQL.HasReadReplica() {
+		port := cfg.MySQL.ReadPort
+		if port == 0 {
+			port = cfg.MySQL.Port
+		}
+		preflightMySQL(ctx, cfg, report, "MySQL replica", cfg.MySQL.ReadHost, port, cfg.MySQL.ReadConnectionString())
+	}
+
+	for _, alpha := range cfg.Dgraph.Alpha {
+		preflightAlpha(ctx, cfg, report, alpha)
+	}
+	preflightDgraphQuery(ctx, cfg, report)
+	preflightOutput(cfg, report)
+
+	logger.Info("Preflight checks completed",
+		"checks", len(report.Checks),
+		"failed", report.Failed())
+	return report
+}
+
+// preflightMySQL connects to one MySQL server, then checks each source
+// database exists and its tables can be read
+func preflightMySQL(ctx context.Context, cfg *config.Config, report *PreflightReport, name, host string, port int, dsn string) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	db, err := connectToMySQL(cfg, ctx, dsn)
+	if err != nil {
+		report.fail(name+" connection", "cannot connect to %s as %s: %v; check mysql.host, mysql.port, "+
+			"mysql.user, the password and mysql.tls, and that the server accepts connections from this host",
+			address, cfg.MySQL.User, err)
+		return
+	}
+	defer db.Close()
+	report.pass(name+" connection", "connected to %s as %s", address, cfg.MySQL.User)
+
+	for _, database := range cfg.MySQL.SourceDatabases() {
+		check := fmt.Sprintf("%s database %s", name, database)
+		if err := checkDatabaseReadable(ctx, db, database); err != nil {
+			report.fail(check, "%v", err)
+			continue
+		}
+		report.pass(check, "exists and %s can SELECT from it", cfg.MySQL.User)
+	}
+}
+
+// checkDatabaseReadable confirms database exists and one of its tables can
+// be read. A user without privileges on a database does not see it in
+// information_schema, so both cases are reported together.
+func checkDatabaseReadable(ctx context.Context, db *sql.DB, database string) error {
+	var found int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?", database).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("cannot read information_schema: %v", err)
+	}
+	if found == 0 {
+		return fmt.Errorf("database does not exist or the user has no privileges on it; " +
+			"check the database name and GRANT SELECT on it to the user")
+	}
+
+	var table string
+	err = db.QueryRowContext(ctx,
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE' ORDER BY table_name LIMIT 1",
+		database).Scan(&table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no tables are visible to the user; the database is empty or needs GRANT SELECT")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot list tables: %v", err)
+	}
+	if err := checkIdentifier("table", table); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", quoteTable(database+"."+table)))
+	if err != nil {
+		return fmt.Errorf("cannot SELECT from %s: %v; GRANT SELECT on the database to the user", table, err)
+	}
+	rows.Close()
+	return nil
+}
+
+// preflightAlpha opens a connection to a Dgraph Alpha endpoint, completing
+// the TLS handshake when dgraph.tls is configured
+func preflightAlpha(ctx context.Context, cfg *config.Config, report *PreflightReport, alpha string) {
+	check := "Dgraph alpha " + alpha
+	tlsConfig, err := cfg.Dgraph.TLSConfig()
+	if err != nil {
+		report.fail(check, "invalid dgraph.tls settings: %v", err)
+		return
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Dgraph.Timeout}
+	var conn net.Conn
+	if tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", alpha)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", alpha)
+	}
+	if err != nil {
+		report.fail(check, "cannot connect: %v; check dgraph.alpha, dgraph.tls and that the Alpha is running", err)
+		return
+	}
+	conn.Close()
+	if tlsConfig != nil {
+		report.pass(check, "reachable, TLS handshake succeeded")
+		return
+	}
+	report.pass(check, "reachable")
+}
+
+// preflightDgraphQuery runs a trivial query through the importer transport,
+// which exercises its endpoint, TLS and the auth token
+func preflightDgraphQuery(ctx context.Context, cfg *config.Config, report *PreflightReport) {
+	check := "Dgraph query " + cfg.Dgraph.Endpoint()
+	endpointKey := "dgraph.http_alpha"
+	if cfg.Dgraph.Transport == "grpc" {
+		endpointKey = "dgraph.alpha"
+	}
+	transport, err := importer.NewTransport(cfg)
+	if err != nil {
+		report.fail(check, "%v; check dgraph.transport and dgraph.tls", err)
+		return
+	}
+	defer transport.Close()
+
+	if err := importer.CheckHealth(ctx, transport); err != nil {
+		// Both transports report the status as an HTTP status code
+		var statusErr interface{ StatusCode() int }
+		if errors.As(err, &statusErr) &&
+			(statusErr.StatusCode() == http.StatusUnauthorized || statusErr.StatusCode() == http.StatusForbidden) {
+			report.fail(check, "%v; check dgraph.auth_token and dgraph.auth_header", err)
+			return
+		}
+		report.fail(check, "%v; check %s, dgraph.tls and that the Alpha is running", err, endpointKey)
+		return
+	}
+	report.pass(check, "query succeeded")
+}
+
+// preflightOutput creates the output directory if needed and writes a file
+// in it
+func preflightOutput(cfg *config.Config, report *PreflightReport) {
+	check := "Output directory " + cfg.Output.Directory
+	if err := os.MkdirAll(cfg.Output.Directory, 0755); err != nil {
+		report.fail(check, "cannot create it: %v; check output.directory and its permissions", err)
+		return
+	}
+	file, err := os.CreateTemp(cfg.Output.Directory, ".preflight-*")
+	if err != nil {
+		report.fail(check, "not writable: %v; check output.directory and its permissions", err)
+		return
+	}
+	file.Close()
+	os.Remove(file.Name())
+	report.pass(check, "writable")
+}
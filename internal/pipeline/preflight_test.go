@@ -0,0 +1,259 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestCheckDatabaseReadable(t *testing.T) {
+	tests := []struct {
+		name    string
+		exists  bool
+		table   string // First table listed, "" = none
+		denied  bool   // SELECT from the table fails
+		errText string
+	}{
+		{name: "readable", exists: true, table: "users"},
+		{name: "missing database", errText: "database does not exist or the user has no privileges on it"},
+		{name: "no tables", exists: true, errText: "no tables are visible to the user"},
+		{name: "select denied", exists: true, table: "users", denied: true, errText: "cannot SELECT from users"},
+		{name: "adversarial table", exists: true, table: "users`; DROP TABLE x; --", errText: "is not allowed in queries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				switch {
+				case strings.Contains(query, "information_schema.schemata"):
+					found := int64(0)
+					if tt.exists {
+						found = 1
+					}
+					return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{found}}}, nil
+				case strings.Contains(query, "information_schema.tables"):
+					result := &fakeResult{columns: []string{"table_name"}}
+					if tt.table != "" {
+						result.rows = [][]driver.Value{{tt.table}}
+					}
+					return result, nil
+				case query == "SELECT 1 FROM `shop`.`users` LIMIT 1":
+					if tt.denied {
+						return nil, errors.New("Error 1142: SELECT command denied to user")
+					}
+					return &fakeResult{columns: []string{"1"}, rows: [][]driver.Value{{int64(1)}}}, nil
+				}
+				return nil, errors.New("unexpected query " + query)
+			}
+			db, _ := newFakeDB(t, handler)
+			err := checkDatabaseReadable(context.Background(), db, "shop")
+			if tt.errText == "" {
+				if err != nil {
+					t.Fatalf("checkDatabaseReadable: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("checkDatabaseReadable error = %v, want it to contain %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// closedAddress returns a local address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestPreflightAlpha(t *testing.T) {
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.NotFoundHandler())
+	defer secure.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secure.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		alpha   string
+		tls     config.DgraphTLSConfig
+		passed  bool
+		message string
+	}{
+		{name: "plain", alpha: plain.Listener.Addr().String(), passed: true, message: "reachable"},
+		{name: "tls", alpha: secure.Listener.Addr().String(), tls: config.DgraphTLSConfig{CACert: caPath, ServerName: "example.com"},
+			passed: true, message: "reachable, TLS handshake succeeded"},
+		{name: "untrusted certificate", alpha: secure.Listener.Addr().String(), tls: config.DgraphTLSConfig{Enabled: true},
+			message: "cannot connect"},
+		{name: "nothing listening", alpha: closedAddress(t), message: "check dgraph.alpha, dgraph.tls and that the Alpha is running"},
+		{name: "invalid tls settings", alpha: plain.Listener.Addr().String(), tls: config.DgraphTLSConfig{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+			message: "invalid dgraph.tls settings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Dgraph.TLS = tt.tls
+			report := &PreflightReport{}
+			preflightAlpha(context.Background(), cfg, report, tt.alpha)
+			if len(report.Checks) != 1 {
+				t.Fatalf("checks %+v, want one", report.Checks)
+			}
+			check := report.Checks[0]
+			if check.Name != "Dgraph alpha "+tt.alpha || check.Passed != tt.passed || !strings.Contains(check.Message, tt.message) {
+				t.Errorf("check %+v, want passed %v with %q", check, tt.passed, tt.message)
+			}
+		})
+	}
+}
+
+func TestPreflightDgraphQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		passed  bool
+		message string
+	}{
+		{name: "healthy", status: http.StatusOK, passed: true, message: "query succeeded"},
+		{name: "unauthorized", status: http.StatusUnauthorized, message: "check dgraph.auth_token and dgraph.auth_header"},
+		{name: "forbidden", status: http.StatusForbidden, message: "check dgraph.auth_token and dgraph.auth_header"},
+		{name: "server error", status: http.StatusInternalServerError, message: "check dgraph.http_alpha, dgraph.tls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			alpha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				queries = append(queries, r.URL.Path+" "+string(body))
+				w.WriteHeader(tt.status)
+				io.WriteString(w, `{"data": {"health": []}}`)
+			}))
+			defer alpha.Close()
+
+			cfg := testConfig(t)
+			cfg.Dgraph.Transport = "http"
+			cfg.Dgraph.HTTPAlpha = alpha.URL
+			report := &PreflightReport{}
+			preflightDgraphQuery(context.Background(), cfg, report)
+			if len(report.Checks) != 1 {
+				t.Fatalf("checks %+v, want one", report.Checks)
+			}
+			check := report.Checks[0]
+			if check.Name != "Dgraph query "+alpha.URL || check.Passed != tt.passed || !strings.Contains(check.Message, tt.message) {
+				t.Errorf("check %+v, want passed %v with %q", check, tt.passed, tt.message)
+			}
+			if len(queries) == 0 || !strings.HasPrefix(queries[0], "/query ") || !strings.Contains(queries[0], "health") {
+				t.Errorf("queries %q, want the health query", queries)
+			}
+		})
+	}
+}
+
+func TestPreflightOutput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		dir     string
+		passed  bool
+		message string
+	}{
+		{name: "existing", dir: t.TempDir(), passed: true, message: "writable"},
+		{name: "created", dir: filepath.Join(t.TempDir(), "new", "output"), passed: true, message: "writable"},
+		{name: "under a file", dir: filepath.Join(file, "output"), message: "cannot create it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.Directory = tt.dir
+			report := &PreflightReport{}
+			preflightOutput(cfg, report)
+			check := report.Checks[0]
+			if check.Passed != tt.passed || !strings.Contains(check.Message, tt.message) {
+				t.Errorf("check %+v, want passed %v with %q", check, tt.passed, tt.message)
+			}
+			if !tt.passed {
+				return
+			}
+			// The probe file is removed
+			entries, err := os.ReadDir(tt.dir)
+			if err != nil || len(entries) != 0 {
+				t.Errorf("output directory holds %v (%v)", entries, err)
+			}
+		})
+	}
+}
+
+// TestPreflight runs every check against a MySQL server that is down and a
+// healthy Dgraph, and checks the rest still run and are reported
+func TestPreflight(t *testing.T) {
+	alpha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": {"health": []}}`)
+	}))
+	defer alpha.Close()
+
+	cfg := testConfig(t)
+	host, port, _ := net.SplitHostPort(closedAddress(t))
+	cfg.MySQL.Host = host
+	cfg.MySQL.Port, _ = strconv.Atoi(port)
+	cfg.Dgraph.Transport = "http"
+	cfg.Dgraph.HTTPAlpha = alpha.URL
+	cfg.Dgraph.Alpha = []string{alpha.Listener.Addr().String()}
+
+	report := Preflight(context.Background(), cfg, logger.New("error", "text"))
+	var got []string
+	for _, check := range report.Checks {
+		status := "pass"
+		if !check.Passed {
+			status = "fail"
+		}
+		got = append(got, check.Name+": "+status)
+	}
+	want := []string{
+		"MySQL connection: fail",
+		"Dgraph alpha " + cfg.Dgraph.Alpha[0] + ": pass",
+		"Dgraph query " + alpha.URL + ": pass",
+		"Output directory " + cfg.Output.Directory + ": pass",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("checks:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if report.Passed() || report.Failed() != 1 {
+		t.Errorf("Passed %v, Failed %d; want one failure", report.Passed(), report.Failed())
+	}
+	if message := report.Checks[0].Message; !strings.Contains(message, "check mysql.host, mysql.port") {
+		t.Errorf("MySQL message %q lacks what to check", message)
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	for _, line := range []string{"[FAIL] MySQL connection: cannot connect to " + net.JoinHostPort(host, port), "[PASS] Dgraph query", "3 of 4 checks passed"} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("report lacks %q:\n%s", line, text.String())
+		}
+	}
+}
@@ -4,18 +4,31 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/retry"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/sink"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
+// maxRDFLineBytes is the longest line the readers of the RDF output, such as
+// sharding, validation and the importer, accept. Rows with a longer triple
+// are skipped rather than written.
+var maxRDFLineBytes = 16 * 1024 * 1024
+
 // PerformanceMetrics tracks processing performance
 type PerformanceMetrics struct {
 	StartTime       time.Time
@@ -72,11 +85,78 @@ type DataProcessor struct {
 	cfg        *config.Config
 	logger     *logger.Logger
 	progress   *ProgressTracker
+	limiter    *QueryLimiter
 	metrics    *PerformanceMetrics
-	uidMap     map[string]string // Global UID mapping
-	uidMapMu   sync.RWMutex
-	outputFile *os.File
+	uids       *UIDStore // table:id -> uid mappings for the mapping file; nil with deterministic_uids
+	sink       sink.Sink // Stores the data files locally or in object storage
+	outputFile io.WriteCloser
 	outputMu   sync.Mutex
+
+	fingerprints *FingerprintCache // Prior-run value hashes, set when delta_columns is enabled
+	skipStats    *SkipStats        // Tally of values and rows that were not emitted
+
+	deletionsMu sync.Mutex
+	deletions   []string // Deletions of the predicates delta rows no longer have, for output.delete_file
+
+	derived map[string][]derivedPredicate // Derived predicates keyed by table
+
+	jsonBatches *JSONBatchWriter // Receives triples instead of the RDF file when output.format is json
+	dgraphSink  *DgraphSink      // Receives triples instead of any file when output.target is dgraph
+
+	converters *ConverterRegistry // Value conversion per Dgraph type, shared by every output path
+
+	jobSeq int // Next TableJob sequence number; only touched by the submitting goroutine
+
+	names *NameMapper // Shortens predicate and type names the same way the schema generator does
+
+	profiler *Profiler // Per-predicate statistics, set when pipeline.profile is enabled
+
+	retries *retry.Classifier // Decides which MySQL and Dgraph errors are retried
+
+	identities map[string]map[string]string // Primary key -> key_columns label for tables with key overrides
+
+	statements *StatementCache // Prepared batch queries, set when mysql.prepared_statements is enabled
+
+	memory *MemoryGuard // Pauses job submission above pipeline.memory_limit_mb; nil when unlimited
+
+	filters    map[string]string // WHERE predicate per table: table_filters plus incremental watermarks
+	watermarks *Watermarks       // Highest watermark read per table; nil unless pipeline.incremental is enabled
+
+	checkpoint *Checkpoint        // What an interrupted run wrote, set when resuming
+	results    []ProcessingResult // Finished jobs, kept to checkpoint an interrupted run
+
+	tableJobsMu sync.Mutex
+	tableJobs   map[string]*tableJobCount // Outstanding jobs per table, for counting finished tables
+}
+
+// tableJobCount tracks a table's jobs until all of them have finished
+type tableJobCount struct {
+	pending   int
+	submitted bool // All of the table's jobs have been submitted
+}
+
+// SetDgraphSink makes ProcessTables send triples to Dgraph instead of writing files
+func (dp *DataProcessor) SetDgraphSink(sink *DgraphSink) {
+	dp.dgraphSink = sink
+}
+
+// SetWatermarks restricts every table to rows past the previous run's
+// watermark and records the watermarks read in this run
+func (dp *DataProcessor) SetWatermarks(watermarks *Watermarks) {
+	dp.watermarks = watermarks
+	dp.filters = watermarks.Filters(dp.cfg.Pipeline.TableFilters)
+}
+
+// sharedOutput reports whether all jobs write to one shared sink rather than
+// their own part files
+func (dp *DataProcessor) sharedOutput() bool {
+	return dp.jsonBatches != nil || dp.dgraphSink != nil
+}
+
+// Converters returns the registry used to convert column values, so callers
+// can register converters for additional Dgraph types
+func (dp *DataProcessor) Converters() *ConverterRegistry {
+	return dp.converters
 }
 
 // TableJob represents a table processing job
@@ -86,6 +166,51 @@ type TableJob struct {
 	BatchSize int
 	Offset    int64
 	Limit     int64
+	KeyColumn string // Numeric primary key for keyset pagination; empty means LIMIT/OFFSET
+	Partition string // Restricts the job to one partition when partition_aware is enabled
+	Sequence  int    // Submission order, used to assemble part files deterministically
+	ResumeKey string // Keyset jobs start after this key when resuming from a checkpoint
+}
+
+// partName returns the name of the job's part file. The zero-padded sequence
+// makes name order match submission order.
+func (job TableJob) partName() string {
+	return fmt.Sprintf("%08d.rdf", job.Sequence)
+}
+
+// columns returns the select list of the job's queries
+func (job TableJob) columns() string {
+	table := job.Schema.Tables[job.TableName]
+	if table == nil {
+		return "*"
+	}
+	return table.SelectList()
+}
+
+// whereClause combines a table_filters predicate with further conditions
+// into a " WHERE ..." clause, or returns "" when there are none. The filter
+// is parenthesized so an OR inside it cannot escape the conjunction.
+func whereClause(filter string, conditions ...string) string {
+	if filter != "" {
+		conditions = append([]string{"(" + filter + ")"}, conditions...)
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// where returns the job's WHERE clause: its table filter and conditions
+func (dp *DataProcessor) where(tableName string, conditions ...string) string {
+	return whereClause(dp.filters[tableName], conditions...)
+}
+
+// source returns the FROM target of the job's queries
+func (job TableJob) source() string {
+	if job.Partition != "" {
+		return fmt.Sprintf("%s PARTITION (%s)", quoteTable(job.TableName), quoteIdent(job.Partition))
+	}
+	return quoteTable(job.TableName)
 }
 
 // ProcessingResult contains the results of table processing
@@ -94,68 +219,147 @@ type ProcessingResult struct {
 	RowsProcessed int64
 	Error         error
 	Duration      time.Duration
+
+	Job     TableJob // The job the result is for
+	Read    int64    // Rows read from the start of the job, including rows that failed to convert
+	LastKey string   // Key column value of the last row read, for keyset-paged jobs
 }
 
-func NewDataProcessor(cfg *config.Config, logger *logger.Logger, progress *ProgressTracker) *DataProcessor {
-	return &DataProcessor{
+func NewDataProcessor(cfg *config.Config, logger *logger.Logger, progress *ProgressTracker, limiter *QueryLimiter) *DataProcessor {
+	dp := &DataProcessor{
 		cfg:      cfg,
 		logger:   logger,
 		progress: progress,
+		limiter:  limiter,
 		metrics: &PerformanceMetrics{
 			StartTime: time.Now(),
 		},
-		uidMap: make(map[string]string),
+		skipStats:  NewSkipStats(),
+		converters: NewConverterRegistry(),
+		names:      NewNameMapper(cfg.Output.MaxNameLength),
+		retries:    retry.NewClassifier(cfg.Retry),
+		memory:     NewMemoryGuard(cfg.Pipeline.MemoryLimit, logger),
+		filters:    cfg.Pipeline.TableFilters,
+		tableJobs:  make(map[string]*tableJobCount),
+		sink:       sink.New(cfg.Output.SinkOptions()),
+	}
+	// Validate has already rejected unknown zones
+	location, _ := cfg.MySQL.Location()
+	dp.converters.Register("datetime", datetimeConverter{
+		policy:   cfg.MySQL.InvalidDatePolicy,
+		location: location,
+	})
+	if cfg.Pipeline.Profile {
+		dp.profiler = NewProfiler()
 	}
+	if !cfg.Pipeline.DeterministicUIDs {
+		dp.uids = NewUIDStore(filepath.Join(cfg.Output.Directory, ".uidmap"), cfg.Pipeline.UIDMapSpillThreshold)
+	}
+	return dp
 }
 
-// StartPerformanceMonitoring starts a goroutine to periodically log performance metrics
-func (dp *DataProcessor) StartPerformanceMonitoring(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second) // Log every 10 seconds
-	defer ticker.Stop()
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				processed, rps, memMB, currentTable := dp.metrics.GetStats()
-				eta := dp.metrics.EstimateCompletion()
-
-				dp.logger.Info("Performance metrics",
-					"processed_rows", processed,
-					"records_per_second", fmt.Sprintf("%.2f", rps),
-					"memory_mb", fmt.Sprintf("%.2f", memMB),
-					"current_table", currentTable,
-					"eta", eta.String(),
-				)
-			}
-		}
-	}()
+// SkipStats returns the collector tracking data that was not emitted
+func (dp *DataProcessor) SkipStats() *SkipStats {
+	return dp.skipStats
 }
 
 func (dp *DataProcessor) ProcessTables(ctx context.Context, db *sql.DB, schema *Schema, tables []string) error {
+	// Dry runs stop at the plan; nothing is read or written
+	if dp.cfg.Pipeline.DryRun {
+		return nil
+	}
+
 	// Create output directory
 	if err := os.MkdirAll(dp.cfg.Output.Directory, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Open output file
-	outputPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.RDFFile)
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	if err := dp.prepareRun(); err != nil {
+		return err
+	}
+
+	// Pick up where an interrupted run stopped
+	checkpointPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.CheckpointFile)
+	if dp.cfg.Pipeline.Resume {
+		checkpoint, err := LoadCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+		dp.checkpoint = checkpoint
+		if err := dp.loadUIDMappings(); err != nil {
+			return err
+		}
+		dp.logger.Info("Resuming interrupted export", "checkpoint", checkpointPath, "tables", len(checkpoint.Tables))
 	}
-	defer outputFile.Close()
 
-	dp.outputFile = outputFile
+	// Open output file. JSON batch files and direct Dgraph mutations leave the
+	// RDF writer unused.
+	var output io.Writer = io.Discard
+	if dp.dgraphSink != nil {
+		dp.logger.Info("Sending mutations directly to Dgraph")
+	} else if dp.cfg.Output.Format == "json" {
+		dp.jsonBatches = NewJSONBatchWriter(dp.cfg.Output.Directory, dp.cfg.Output.JSONBatchSize)
+		dp.jsonBatches.SetLiteralConverter(dp.jsonLiteral(schema))
+		dp.jsonBatches.SetCompression(dp.cfg.Output.Compression)
+		dp.jsonBatches.SetSink(dp.sink)
+		if dp.cfg.Output.JSONUpsert {
+			dp.jsonBatches.SetUpsertPredicate(xidPredicate)
+		}
+	} else if dp.cfg.Output.Shards > 1 {
+		dp.logger.Info("Sharding RDF output", "shards", dp.cfg.Output.Shards)
+	} else if dp.cfg.Output.SplitByTable {
+		// Files of tables left out of this run would be read as part of it
+		if dp.checkpoint == nil {
+			if err := removeTableFiles(dp.cfg); err != nil {
+				return fmt.Errorf("failed to remove old table files: %w", err)
+			}
+		}
+		dp.logger.Info("Writing one RDF file per table", "pattern", dp.cfg.Output.TableRDFPattern())
+	} else {
+		outputFile, err := dp.openOutput(dp.cfg.Output.RDFFiles()[0])
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer outputFile.Close()
+
+		dp.outputFile = outputFile
+		output = outputFile
+	}
 
 	// Create buffered writer for better performance
-	writer := bufio.NewWriterSize(outputFile, 64*1024) // 64KB buffer
-	defer writer.Flush()
+	writer := bufio.NewWriterSize(output, 64*1024) // 64KB buffer
+
+	// Each job writes its own part file so workers never contend for the
+	// output; parts are concatenated in submission order once all finish
+	partsDir := filepath.Join(dp.cfg.Output.Directory, ".parts")
+	if !dp.sharedOutput() {
+		if err := os.RemoveAll(partsDir); err != nil {
+			return fmt.Errorf("failed to clear part files: %w", err)
+		}
+		if err := os.MkdirAll(partsDir, 0755); err != nil {
+			return fmt.Errorf("failed to create part directory: %w", err)
+		}
+		defer os.RemoveAll(partsDir)
+	}
+	dp.jobSeq = 0
+
+	// Prepare each table's batch query once for all of its batches
+	if dp.cfg.MySQL.PreparedStatements {
+		dp.statements = NewStatementCache(db)
+		defer func() {
+			dp.logger.Debug("Closing prepared statements", "prepared", dp.statements.Prepares())
+			dp.statements.Close()
+			dp.statements = nil
+		}()
+	}
+
+	// Resolve key_columns identities before any foreign key refers to them
+	if err := dp.loadIdentities(ctx, db, schema); err != nil {
+		return err
+	}
 
 	// Calculate total rows for progress tracking
-	totalRows, err := dp.calculateTotalRows(ctx, db, tables)
+	totalRows, err := dp.calculateTotalRows(ctx, db, schema, tables)
 	if err != nil {
 		dp.logger.Warn("Failed to calculate total rows", "error", err)
 	} else {
@@ -173,507 +377,1661 @@ func (dp *DataProcessor) ProcessTables(ctx context.Context, db *sql.DB, schema *
 	// Start workers
 	for i := 0; i < dp.cfg.Pipeline.Workers; i++ {
 		wg.Add(1)
-		go dp.worker(ctx, &wg, db, schema, jobChan, resultChan, writer)
+		go dp.worker(ctx, &wg, db, jobChan, resultChan, partsDir)
 	}
 
 	// Start result collector
-	go dp.collectResults(resultChan)
+	collected := make(chan error, 1)
+	go func() {
+		collected <- dp.collectResults(resultChan)
+	}()
 
-	// Submit jobs
+	// Submit jobs, counting the jobs of each table submitted in full
+	submitted := make(chan map[string]int, 1)
 	go func() {
 		defer close(jobChan)
+		jobs := make(map[string]int)
 		for _, tableName := range tables {
+			first := dp.jobSeq
 			if err := dp.submitTableJobs(ctx, db, schema, tableName, jobChan); err != nil {
 				dp.logger.Error("Failed to submit jobs for table", "table", tableName, "error", err)
+			} else {
+				jobs[tableName] = dp.jobSeq - first
 			}
+			dp.tableJobUpdate(tableName, 0, true)
 		}
+		submitted <- jobs
 	}()
 
 	// Wait for all workers to complete
 	wg.Wait()
 	close(resultChan)
+	tableJobs := <-submitted
 
-	// Write UID mappings to separate file
-	if err := dp.writeUIDMappings(); err != nil {
-		dp.logger.Error("Failed to write UID mappings", "error", err)
+	// A failed write leaves the output incomplete; stop before assembling it
+	if err := <-collected; err != nil {
+		return err
 	}
 
-	dp.logger.Info("Data processing completed", "tables", len(tables))
-	return nil
-}
-
-func (dp *DataProcessor) worker(ctx context.Context, wg *sync.WaitGroup, db *sql.DB, schema *Schema,
-	jobChan <-chan TableJob, resultChan chan<- ProcessingResult, writer *bufio.Writer) {
-
-	defer wg.Done()
-
-	for job := range jobChan {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			result := dp.processTableBatch(ctx, db, job, writer)
-			resultChan <- result
+	// An interrupted export keeps only the part files its checkpoint
+	// accounts for, so a resumed run neither repeats nor skips rows
+	interrupted := ctx.Err() != nil
+	var checkpoint *Checkpoint
+	if interrupted && !dp.sharedOutput() {
+		var keep map[int]bool
+		checkpoint, keep = advanceCheckpoint(dp.checkpoint, dp.results, tableJobs)
+		if err := removeParts(partsDir, keep); err != nil {
+			return fmt.Errorf("failed to discard part files: %w", err)
 		}
 	}
-}
-
-func (dp *DataProcessor) processTableBatch(ctx context.Context, db *sql.DB, job TableJob, writer *bufio.Writer) ProcessingResult {
-	startTime := time.Now()
-
-	dp.progress.mu.Lock()
-	dp.progress.CurrentTable = job.TableName
-	dp.progress.mu.Unlock()
 
-	table := job.Schema.Tables[job.TableName]
-	if table == nil {
-		return ProcessingResult{
-			TableName: job.TableName,
-			Error:     fmt.Errorf("table schema not found"),
-			Duration:  time.Since(startTime),
+	// Assemble the RDF file, or the shard files, from the part files
+	switch {
+	case dp.sharedOutput():
+		// Nothing to assemble, the shared sink received the triples
+	case dp.cfg.Output.Shards > 1:
+		if err := dp.writeShards(partsDir); err != nil {
+			return fmt.Errorf("failed to assemble shard files: %w", err)
+		}
+	case dp.cfg.Output.SplitByTable:
+		if err := dp.writeTableFiles(partsDir); err != nil {
+			return fmt.Errorf("failed to assemble table files: %w", err)
+		}
+	default:
+		if err := concatParts(writer, partsDir); err != nil {
+			return fmt.Errorf("failed to assemble output file: %w", err)
+		}
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		// Closing ends a compressed stream, which can still fail
+		if err := dp.outputFile.Close(); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
 		}
 	}
 
-	// Build query
-	query := fmt.Sprintf("SELECT * FROM `%s` LIMIT %d OFFSET %d",
-		job.TableName, job.Limit, job.Offset)
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return ProcessingResult{
-			TableName: job.TableName,
-			Error:     fmt.Errorf("query failed: %w", err),
-			Duration:  time.Since(startTime),
+	// Write the last partial JSON batch
+	if dp.jsonBatches != nil {
+		if err := dp.jsonBatches.Flush(); err != nil {
+			return err
 		}
+		dp.logger.Info("JSON batches written", "batches", dp.jsonBatches.Batches())
 	}
-	defer rows.Close()
 
-	cols, err := rows.Columns()
-	if err != nil {
-		return ProcessingResult{
-			TableName: job.TableName,
-			Error:     fmt.Errorf("failed to get columns: %w", err),
-			Duration:  time.Since(startTime),
+	// Commit the last partial mutation batch
+	if dp.dgraphSink != nil {
+		if err := dp.dgraphSink.Flush(ctx); err != nil {
+			return err
 		}
 	}
 
-	// Prepare scan arguments
-	values := make([]sql.RawBytes, len(cols))
-	scanArgs := make([]interface{}, len(cols))
-	for i := range values {
-		scanArgs[i] = &values[i]
+	if !interrupted {
+		dp.countOrphanedForeignKeys(ctx, db, schema, tables)
 	}
+	dp.finishRun(interrupted)
 
-	var processedRows int64
-	var rdfLines []string
-
-	for rows.Next() {
-		if err := rows.Scan(scanArgs...); err != nil {
-			dp.logger.Error("Failed to scan row", "table", job.TableName, "error", err)
-			continue
-		}
+	if throttles := dp.memory.Throttles(); throttles > 0 {
+		dp.logger.Warn("Job submission was paused by the memory limit",
+			"times", throttles,
+			"limit_mb", dp.cfg.Pipeline.MemoryLimit)
+	}
 
-		rdfData, err := dp.convertRowToRDF(job.TableName, cols, values, job.Schema)
-		if err != nil {
-			dp.logger.Error("Failed to convert row to RDF", "table", job.TableName, "error", err)
-			continue
+	if interrupted {
+		if checkpoint == nil {
+			return fmt.Errorf("export interrupted: %w", ctx.Err())
 		}
-
-		rdfLines = append(rdfLines, rdfData...)
-		processedRows++
-
-		// Memory management - write in batches
-		if len(rdfLines) >= 100 {
-			dp.writeRDFLines(writer, rdfLines)
-			rdfLines = rdfLines[:0] // Clear slice but keep capacity
+		if err := checkpoint.Save(checkpointPath); err != nil {
+			return fmt.Errorf("export interrupted, failed to write checkpoint: %w", err)
 		}
+		dp.logger.Warn("Export interrupted, rerun with -resume to continue", "checkpoint", checkpointPath)
+		return fmt.Errorf("export interrupted: %w", ctx.Err())
 	}
 
-	// Write remaining lines
-	if len(rdfLines) > 0 {
-		dp.writeRDFLines(writer, rdfLines)
+	// A finished export leaves nothing to resume
+	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		dp.logger.Warn("Failed to remove checkpoint", "error", err)
 	}
 
-	// Update progress
-	dp.progress.mu.Lock()
-	dp.progress.ProcessedRows += processedRows
-	dp.progress.mu.Unlock()
+	dp.logger.Info("Data processing completed", "tables", len(tables))
+	return nil
+}
 
-	// Force garbage collection periodically
-	if processedRows > 0 && processedRows%1000 == 0 {
-		runtime.GC()
+// prepareRun compiles derived predicates and loads the previous run's
+// fingerprints. Every export path calls it before reading rows.
+func (dp *DataProcessor) prepareRun() error {
+	derived, err := compileDerivedPredicates(dp.cfg)
+	if err != nil {
+		return err
 	}
+	dp.derived = derived
 
-	return ProcessingResult{
-		TableName:     job.TableName,
-		RowsProcessed: processedRows,
-		Duration:      time.Since(startTime),
+	// Load fingerprints from the previous run so only changed predicates are emitted
+	if dp.cfg.Pipeline.DeltaColumns {
+		fingerprints, err := LoadFingerprintCache(filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.FingerprintFile))
+		if err != nil {
+			return fmt.Errorf("failed to load fingerprints: %w", err)
+		}
+		dp.fingerprints = fingerprints
 	}
+	return nil
 }
 
-func (dp *DataProcessor) convertRowToRDF(tableName string, cols []string, values []sql.RawBytes, schema *Schema) ([]string, error) {
-	var rdfLines []string
-
-	// Generate UID for this row
-	rowUID := dp.generateRowUID(tableName, cols, values)
-
-	// Add type declaration
-	rdfLines = append(rdfLines, fmt.Sprintf("%s <dgraph.type> \"%s\" .", rowUID, tableName))
-
-	// Process each column
-	for i, col := range cols {
-		val := string(values[i])
-		if val == "" || strings.ToLower(val) == "null" {
-			continue
-		}
-
-		predicate := fmt.Sprintf("%s.%s", tableName, col)
-
-		// Check if this is a foreign key
-		isFK, refTable := dp.isForeignKey(tableName, col, schema)
-
-		if isFK {
-			// Create reference to foreign entity
-			refUID := dp.getOrCreateUID(refTable, val)
-			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", rowUID, predicate, refUID))
+// finishRun writes the files every export path leaves next to its output:
+// the UID mappings, profile, name map, deletions, fingerprints and watermarks. An
+// interrupted run may have fingerprinted or read rows whose output was
+// discarded, so it keeps the previous fingerprints and watermarks.
+func (dp *DataProcessor) finishRun(interrupted bool) {
+	if err := dp.writeUIDMappings(); err != nil {
+		dp.logger.Error("Failed to write UID mappings", "error", err)
+	}
 
-			// Add reverse edge
-			reversePredicate := fmt.Sprintf("%s.%s_reverse", tableName, col)
-			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", refUID, reversePredicate, rowUID))
+	// Write per-predicate statistics
+	if dp.profiler != nil {
+		profilePath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.ProfileFile)
+		if err := dp.profiler.Write(profilePath); err != nil {
+			dp.logger.Error("Failed to write profile", "error", err)
 		} else {
-			// Regular data predicate
-			escapedVal := dp.escapeRDFValue(val)
-			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> \"%s\" .", rowUID, predicate, escapedVal))
+			dp.logger.Info("Predicate profile written", "file", profilePath)
 		}
 	}
 
-	return rdfLines, nil
-}
+	// Record shortened names next to the ones the schema generator records
+	if err := dp.names.Save(filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.NameMapFile)); err != nil {
+		dp.logger.Error("Failed to write name map", "error", err)
+	}
 
-func (dp *DataProcessor) generateRowUID(tableName string, cols []string, values []sql.RawBytes) string {
-	// Try to find primary key
-	var pkValue string
-	for i, col := range cols {
-		if strings.ToLower(col) == "id" || strings.HasSuffix(strings.ToLower(col), "_id") {
-			pkValue = string(values[i])
-			break
+	// Persist fingerprints for the next delta run, once the deletions they no
+	// longer record are written
+	if dp.fingerprints != nil && !interrupted {
+		if err := dp.writeDeletions(); err != nil {
+			dp.logger.Error("Failed to write deletions, keeping the previous fingerprints", "error", err)
+		} else if err := dp.fingerprints.Save(filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.FingerprintFile)); err != nil {
+			dp.logger.Error("Failed to write fingerprints", "error", err)
 		}
 	}
 
-	// If no primary key found, use first column
-	if pkValue == "" && len(values) > 0 {
-		pkValue = string(values[0])
+	// Persist watermarks for the next incremental run
+	if dp.watermarks != nil && !interrupted {
+		watermarkPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.WatermarkFile)
+		if err := dp.watermarks.Save(watermarkPath); err != nil {
+			dp.logger.Error("Failed to write watermarks", "error", err)
+		} else {
+			dp.logger.Info("Watermarks written", "file", watermarkPath, "tables", len(dp.watermarks.Tables()))
+		}
 	}
 
-	return fmt.Sprintf("_:%s_%s", tableName, pkValue)
+	dp.skipStats.LogSummary(dp.logger)
 }
 
-func (dp *DataProcessor) isForeignKey(tableName, columnName string, schema *Schema) (bool, string) {
-	// Check explicit foreign key relationships
-	for _, fk := range schema.Relationships {
-		if fk.TableName == tableName && fk.ColumnName == columnName {
-			return true, fk.RefTableName
-		}
+// writeDeletions writes the deletions of this delta run to output.delete_file,
+// replacing those of the previous run even when there are none
+func (dp *DataProcessor) writeDeletions() error {
+	dp.deletionsMu.Lock()
+	defer dp.deletionsMu.Unlock()
+
+	var data strings.Builder
+	for _, line := range dp.deletions {
+		data.WriteString(line)
+		data.WriteString("\n")
+	}
+	deletePath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.DeleteFile)
+	if err := os.WriteFile(deletePath, []byte(data.String()), 0644); err != nil {
+		return err
 	}
+	if len(dp.deletions) > 0 {
+		dp.logger.Info("Deletions written", "file", deletePath, "lines", len(dp.deletions))
+	}
+	return nil
+}
 
-	// Check naming conventions
-	if IsForeignKey(columnName) {
-		// Extract potential table name from column name
-		refTableName := strings.TrimSuffix(strings.ToLower(columnName), "_id")
+func (dp *DataProcessor) worker(ctx context.Context, wg *sync.WaitGroup, db *sql.DB,
+	jobChan <-chan TableJob, resultChan chan<- ProcessingResult, partsDir string) {
 
-		// Check if referenced table exists
-		if _, exists := schema.Tables[refTableName]; exists {
-			return true, refTableName
-		}
+	defer wg.Done()
 
-		// Try plural form
-		pluralTableName := refTableName + "s"
-		if _, exists := schema.Tables[pluralTableName]; exists {
-			return true, pluralTableName
+	for job := range jobChan {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			dp.memory.Begin()
+			result := dp.processJob(ctx, db, job, partsDir)
+			dp.memory.End()
+			resultChan <- result
 		}
 	}
-
-	return false, ""
 }
 
-func (dp *DataProcessor) getOrCreateUID(tableName, id string) string {
-	key := fmt.Sprintf("%s:%s", tableName, id)
-
-	dp.uidMapMu.RLock()
-	if uid, exists := dp.uidMap[key]; exists {
-		dp.uidMapMu.RUnlock()
-		return uid
+// processJob runs a job against its own part file. JSON and direct Dgraph
+// output is collected by the shared sink instead.
+func (dp *DataProcessor) processJob(ctx context.Context, db *sql.DB, job TableJob, partsDir string) ProcessingResult {
+	if dp.sharedOutput() {
+		result := dp.processTableBatch(ctx, db, job, nil)
+		result.Job = job
+		return result
 	}
-	dp.uidMapMu.RUnlock()
-
-	dp.uidMapMu.Lock()
-	defer dp.uidMapMu.Unlock()
 
-	// Double-check after acquiring write lock
-	if uid, exists := dp.uidMap[key]; exists {
-		return uid
+	partFile, err := os.Create(filepath.Join(partsDir, job.partName()))
+	if err != nil {
+		return ProcessingResult{
+			TableName: job.TableName,
+			Error:     fmt.Errorf("failed to create part file: %w", err),
+			Job:       job,
+		}
 	}
-
-	uid := fmt.Sprintf("_:%s_%s", tableName, id)
-	dp.uidMap[key] = uid
-	return uid
+	defer partFile.Close()
+
+	// Rows are written whole, so a job stopped by cancellation still leaves
+	// a part file ending on a complete triple
+	writer := bufio.NewWriterSize(partFile, 64*1024)
+	result := dp.processTableBatch(ctx, db, job, writer)
+	result.Job = job
+	if err := writer.Flush(); err != nil && result.Error == nil {
+		result.Error = fmt.Errorf("%w: failed to write part file: %w", errOutputWrite, err)
+	}
+	return result
 }
 
-func (dp *DataProcessor) escapeRDFValue(value string) string {
-	value = strings.ReplaceAll(value, `\`, `\\`)
-	value = strings.ReplaceAll(value, `"`, `\"`)
-	value = strings.ReplaceAll(value, "\n", `\n`)
-	value = strings.ReplaceAll(value, "\r", `\r`)
-	value = strings.ReplaceAll(value, "\t", `\t`)
-	return value
+// openOutput creates an output file in the sink, or opens it for appending
+// when resuming so the rows written before the interruption are kept. The
+// file is written through output.compression; a resumed gzip file gains a
+// second stream.
+func (dp *DataProcessor) openOutput(name string) (io.WriteCloser, error) {
+	file, err := dp.sink.Create(name, dp.checkpoint != nil)
+	if err != nil {
+		return nil, err
+	}
+	return compress.NewWriter(file, dp.cfg.Output.Compression), nil
 }
 
-func (dp *DataProcessor) writeRDFLines(writer *bufio.Writer, lines []string) {
-	dp.outputMu.Lock()
-	defer dp.outputMu.Unlock()
-
-	for _, line := range lines {
-		writer.WriteString(line + "\n")
+// loadUIDMappings seeds the UID store with the mapping file of the
+// interrupted run, which is rewritten in full at the end
+func (dp *DataProcessor) loadUIDMappings() error {
+	if dp.uids == nil {
+		return nil
 	}
+	mappingPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.MappingFile)
+	mappings, err := LoadUIDMapping(mappingPath, dp.cfg.Output.MappingFormat)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load UID mappings: %w", err)
+	}
+	for key, uid := range mappings {
+		if err := dp.uids.Put(key, uid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (dp *DataProcessor) submitTableJobs(ctx context.Context, db *sql.DB, schema *Schema, tableName string, jobChan chan<- TableJob) error {
-	table := schema.Tables[tableName]
-	if table == nil {
-		return fmt.Errorf("table %s not found in schema", tableName)
+// removeParts deletes the part files of jobs not in keep
+func removeParts(partsDir string, keep map[int]bool) error {
+	kept := make(map[string]bool, len(keep))
+	for sequence := range keep {
+		kept[TableJob{Sequence: sequence}.partName()] = true
 	}
 
-	batchSize := int64(dp.cfg.Pipeline.BatchSize)
-	totalRows := table.RowCount
-
-	// If table is small, process in single batch
-	if totalRows <= batchSize {
-		select {
-		case jobChan <- TableJob{
-			TableName: tableName,
-			Schema:    schema,
-			BatchSize: int(batchSize),
-			Offset:    0,
-			Limit:     totalRows,
-		}:
-		case <-ctx.Done():
-			return ctx.Err()
+	entries, err := os.ReadDir(partsDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !kept[entry.Name()] {
+			if err := os.Remove(filepath.Join(partsDir, entry.Name())); err != nil {
+				return err
+			}
 		}
-		return nil
 	}
+	return nil
+}
 
-	// Split into batches for large tables
-	for offset := int64(0); offset < totalRows; offset += batchSize {
-		limit := batchSize
-		if offset+batchSize > totalRows {
-			limit = totalRows - offset
+// concatParts appends the part files to the output in name order, which is
+// the order their jobs were submitted
+func concatParts(writer *bufio.Writer, partsDir string) error {
+	entries, err := os.ReadDir(partsDir)
+	if err != nil {
+		return err
+	}
+
+	// ReadDir returns entries sorted by file name
+	for _, entry := range entries {
+		part, err := os.Open(filepath.Join(partsDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, part)
+		part.Close()
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		select {
-		case jobChan <- TableJob{
-			TableName: tableName,
-			Schema:    schema,
-			BatchSize: int(batchSize),
-			Offset:    offset,
-			Limit:     limit,
-		}:
-		case <-ctx.Done():
-			return ctx.Err()
+// writeShards distributes the part files' triples across the shard files by
+// a hash of each triple's subject, so all triples of a node share a shard
+func (dp *DataProcessor) writeShards(partsDir string) error {
+	var files []io.WriteCloser
+	var writers []*bufio.Writer
+	for _, name := range dp.cfg.Output.RDFFiles() {
+		file, err := dp.openOutput(name)
+		if err != nil {
+			return fmt.Errorf("failed to create shard file: %w", err)
+		}
+		defer file.Close()
+
+		writer := bufio.NewWriterSize(file, 64*1024)
+		defer writer.Flush()
+		files = append(files, file)
+		writers = append(writers, writer)
+	}
+
+	entries, err := os.ReadDir(partsDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := shardPart(filepath.Join(partsDir, entry.Name()), writers); err != nil {
+			return err
 		}
 	}
 
+	for i, writer := range writers {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if err := files[i].Close(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (dp *DataProcessor) calculateTotalRows(ctx context.Context, db *sql.DB, tables []string) (int64, error) {
-	var total int64
-
-	for _, tableName := range tables {
-		var count int64
-		query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
+// writeTableFiles appends the part files of each table, in submission
+// order, to the table's own RDF file. Tables whose parts are all empty get
+// no file.
+func (dp *DataProcessor) writeTableFiles(partsDir string) error {
+	tableOf := make(map[string]string, len(dp.results))
+	for _, result := range dp.results {
+		tableOf[result.Job.partName()] = result.TableName
+	}
 
-		if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
-			dp.logger.Warn("Failed to count rows", "table", tableName, "error", err)
+	entries, err := os.ReadDir(partsDir)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	parts := make(map[string][]string)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		table, ok := tableOf[entry.Name()]
+		if !ok || info.Size() == 0 {
 			continue
 		}
-
-		total += count
+		if parts[table] == nil {
+			tables = append(tables, table)
+		}
+		parts[table] = append(parts[table], filepath.Join(partsDir, entry.Name()))
 	}
 
-	return total, nil
+	for _, table := range tables {
+		if err := dp.writeTableFile(table, parts[table]); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	dp.logger.Info("Table RDF files written", "files", len(tables))
+	return nil
 }
 
-func (dp *DataProcessor) collectResults(resultChan <-chan ProcessingResult) {
-	for result := range resultChan {
-		if result.Error != nil {
-			dp.logger.Error("Table processing failed",
-				"table", result.TableName,
-				"error", result.Error,
-				"duration", result.Duration)
+// writeTableFile concatenates part files into a table's RDF file
+func (dp *DataProcessor) writeTableFile(table string, partPaths []string) error {
+	file, err := dp.openOutput(dp.cfg.Output.TableRDFFile(table))
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriterSize(file, 64*1024)
+	for _, partPath := range partPaths {
+		part, err := os.Open(partPath)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		_, err = io.Copy(writer, part)
+		part.Close()
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
 
-			dp.progress.mu.Lock()
-			dp.progress.ErrorCount++
-			dp.progress.mu.Unlock()
-		} else {
-			dp.logger.Debug("Table batch processed successfully",
-				"table", result.TableName,
-				"rows", result.RowsProcessed,
-				"duration", result.Duration)
+// removeTableFiles deletes the per-table RDF files in the output directory
+func removeTableFiles(cfg *config.Config) error {
+	for _, name := range TableFiles(cfg) {
+		if err := os.Remove(filepath.Join(cfg.Output.Directory, name)); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func (dp *DataProcessor) writeUIDMappings() error {
-	mappingPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.MappingFile)
+// TableFiles returns the names of the per-table RDF files in
+// output.directory, sorted
+func TableFiles(cfg *config.Config) []string {
+	paths, _ := filepath.Glob(filepath.Join(cfg.Output.Directory, cfg.Output.TableRDFPattern()))
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = filepath.Base(path)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	file, err := os.Create(mappingPath)
+// shardPart appends each line of a part file to the shard chosen by its subject
+func shardPart(partPath string, writers []*bufio.Writer) error {
+	part, err := os.Open(partPath)
 	if err != nil {
-		return fmt.Errorf("failed to create mapping file: %w", err)
+		return err
+	}
+	defer part.Close()
+
+	scanner := bufio.NewScanner(part)
+	scanner.Buffer(make([]byte, 64*1024), maxRDFLineBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		subject, _, _ := strings.Cut(line, " ")
+
+		writer := writers[shardIndex(subject, len(writers))]
+		writer.WriteString(line)
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
+	return scanner.Err()
+}
+
+// shardIndex maps a node to one of n shards
+func shardIndex(subject string, n int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(subject))
+	return int(hash.Sum32() % uint32(n))
+}
 
-	dp.uidMapMu.RLock()
-	defer dp.uidMapMu.RUnlock()
+func (dp *DataProcessor) processTableBatch(ctx context.Context, db *sql.DB, job TableJob, writer *bufio.Writer) ProcessingResult {
+	startTime := time.Now()
+
+	dp.progress.mu.Lock()
+	dp.progress.CurrentTable = job.TableName
+	dp.progress.mu.Unlock()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	table := job.Schema.Tables[job.TableName]
+	if table == nil {
+		return ProcessingResult{
+			TableName: job.TableName,
+			Error:     fmt.Errorf("table schema not found"),
+			Duration:  time.Since(startTime),
+		}
+	}
 
-	// Write as simple key=value format for efficiency
-	for key, uid := range dp.uidMap {
-		fmt.Fprintf(writer, "%s=%s\n", key, uid)
+	if job.KeyColumn != "" || job.Partition != "" {
+		return dp.processTableStream(ctx, db, job, writer, startTime)
 	}
 
-	dp.logger.Info("UID mappings written", "count", len(dp.uidMap), "file", mappingPath)
-	return nil
+	// Build query
+	query := fmt.Sprintf("SELECT %s FROM %s%s LIMIT ? OFFSET ?", job.columns(), job.source(), dp.where(job.TableName))
+
+	batch, err := dp.runBatchQuery(ctx, db, job, writer, query, job.Limit, job.Offset)
+	return ProcessingResult{
+		TableName:     job.TableName,
+		RowsProcessed: batch.processed,
+		Error:         err,
+		Duration:      time.Since(startTime),
+		Read:          batch.read,
+	}
 }
 
-// getTableRowCount returns the total number of rows in a table
-func (dp *DataProcessor) getTableRowCount(tableName string) (int64, error) {
-	db, err := sql.Open("mysql", dp.cfg.MySQL.ConnectionString())
-	if err != nil {
-		return 0, fmt.Errorf("failed to open database: %w", err)
+// processTableStream walks a whole table or partition one batch per query
+// until a short batch marks the end. With a key column it pages by keyset
+// (WHERE pk > last ORDER BY pk LIMIT n), so each query is an index range scan
+// no matter how deep into the table it starts; otherwise it pages by OFFSET.
+func (dp *DataProcessor) processTableStream(ctx context.Context, db *sql.DB, job TableJob, writer *bufio.Writer, startTime time.Time) ProcessingResult {
+	var processed int64
+	lastKey := job.ResumeKey
+	var offset int64
+
+	for first := lastKey == ""; ; first = false {
+		if err := ctx.Err(); err != nil {
+			return ProcessingResult{
+				TableName:     job.TableName,
+				RowsProcessed: processed,
+				Error:         err,
+				Duration:      time.Since(startTime),
+				Read:          offset,
+				LastKey:       lastKey,
+			}
+		}
+
+		batch, err := dp.streamBatch(ctx, db, job, writer, first, lastKey, offset)
+		processed += batch.processed
+		offset += batch.read
+		if batch.lastKey != "" {
+			lastKey = batch.lastKey
+		}
+		if err != nil {
+			return ProcessingResult{
+				TableName:     job.TableName,
+				RowsProcessed: processed,
+				Error:         err,
+				Duration:      time.Since(startTime),
+				Read:          offset,
+				LastKey:       lastKey,
+			}
+		}
+
+		if batch.last(job) {
+			break
+		}
 	}
-	defer db.Close()
 
-	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
-	var count int64
-	err = db.QueryRow(query).Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to count rows in table %s: %w", tableName, err)
+	if job.Partition != "" {
+		dp.logger.Debug("Partition completed",
+			"table", job.TableName,
+			"partition", job.Partition,
+			"rows", processed)
 	}
 
-	return count, nil
+	return ProcessingResult{
+		TableName:     job.TableName,
+		RowsProcessed: processed,
+		Duration:      time.Since(startTime),
+		Read:          offset,
+		LastKey:       lastKey,
+	}
 }
 
-// processTableBatchToWriter processes a batch from a table and writes to the provided writer
-func (dp *DataProcessor) processTableBatchToWriter(ctx context.Context, tableName string, table *Table, offset, limit int64, writer *bufio.Writer, schema *Schema) (int64, error) {
-	db, err := sql.Open("mysql", dp.cfg.MySQL.ConnectionString())
-	if err != nil {
-		return 0, fmt.Errorf("failed to open database: %w", err)
+// streamBatch reads the next batch of a streamed job: the first batch, the
+// batch after lastKey for keyset-paged jobs, else the batch at offset
+func (dp *DataProcessor) streamBatch(ctx context.Context, db *sql.DB, job TableJob, writer *bufio.Writer, first bool, lastKey string, offset int64) (batchResult, error) {
+	switch {
+	case job.KeyColumn == "":
+		query := fmt.Sprintf("SELECT %s FROM %s%s LIMIT ? OFFSET ?", job.columns(), job.source(), dp.where(job.TableName))
+		return dp.runBatchQuery(ctx, db, job, writer, query, job.BatchSize, offset)
+	case first:
+		query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT ?",
+			job.columns(), job.source(), dp.where(job.TableName), quoteIdent(job.KeyColumn))
+		return dp.runBatchQuery(ctx, db, job, writer, query, job.BatchSize)
+	default:
+		query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT ?",
+			job.columns(), job.source(), dp.where(job.TableName, quoteIdent(job.KeyColumn)+" > ?"), quoteIdent(job.KeyColumn))
+		return dp.runBatchQuery(ctx, db, job, writer, query, lastKey, job.BatchSize)
 	}
-	defer db.Close()
+}
 
-	// Build query
-	query := fmt.Sprintf("SELECT * FROM `%s` LIMIT %d OFFSET %d", tableName, limit, offset)
+// batchResult describes the rows returned by one batch query
+type batchResult struct {
+	read      int64  // Rows returned by MySQL
+	processed int64  // Rows converted and written
+	lastKey   string // Key column value of the last row, when the job has a key column
+}
 
-	rows, err := db.QueryContext(ctx, query)
+// last reports whether a streamed job has no rows after this batch: the
+// batch was short, or a keyset-paged batch held no key to continue from
+func (batch batchResult) last(job TableJob) bool {
+	return batch.read < int64(job.BatchSize) || (job.KeyColumn != "" && batch.lastKey == "")
+}
+
+// runBatchQuery executes one batch query and writes the converted rows
+func (dp *DataProcessor) runBatchQuery(ctx context.Context, db *sql.DB, job TableJob, writer *bufio.Writer, query string, args ...interface{}) (batchResult, error) {
+	var result batchResult
+
+	if err := dp.limiter.Acquire(ctx); err != nil {
+		return result, err
+	}
+	defer dp.limiter.Release()
+
+	// Only opening the query is retried: once rows have been converted the
+	// batch may already be partly written
+	var rows *sql.Rows
+	err := dp.retries.Do(ctx, dp.cfg.Retry.MaxRetries, dp.cfg.Retry.Delay,
+		func(attempt int, err error) {
+			dp.logger.Warn("Retrying batch query", "table", job.TableName, "attempt", attempt, "error", err)
+		},
+		func() error {
+			var err error
+			rows, err = dp.query(ctx, db, query, args...)
+			return err
+		})
 	if err != nil {
-		return 0, fmt.Errorf("failed to query table %s: %w", tableName, err)
+		return result, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
-	// Process rows
-	var processedCount int64
-	for rows.Next() {
-		select {
-		case <-ctx.Done():
-			return processedCount, ctx.Err()
-		default:
+	cols, err := rows.Columns()
+	if err != nil {
+		return result, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	keyIndex, watermarkIndex := -1, -1
+	for i, col := range cols {
+		if job.KeyColumn != "" && col == job.KeyColumn {
+			keyIndex = i
 		}
+		if col == dp.watermarks.Column() {
+			watermarkIndex = i
+		}
+	}
+	var watermark string
 
-		// Get row data
-		columns, err := rows.Columns()
-		if err != nil {
-			return processedCount, fmt.Errorf("failed to get columns: %w", err)
+	// Prepare scan arguments
+	values := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	var rdfLines []string
+
+	for rows.Next() {
+		result.read++
+
+		if err := rows.Scan(scanArgs...); err != nil {
+			dp.logger.Error("Failed to scan row", "table", job.TableName, "error", err)
+			dp.skipStats.Add(job.TableName, SkipScanFailed)
+			continue
 		}
 
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
+		if keyIndex >= 0 {
+			result.lastKey = string(values[keyIndex])
+		}
+		if watermarkIndex >= 0 && values[watermarkIndex] != nil {
+			if value := string(values[watermarkIndex]); watermark == "" || laterWatermark(value, watermark) {
+				watermark = value
+			}
 		}
 
-		err = rows.Scan(valuePtrs...)
+		rdfData, err := dp.convertRowToRDF(job.TableName, cols, values, job.Schema)
 		if err != nil {
-			return processedCount, fmt.Errorf("failed to scan row: %w", err)
+			dp.logger.Error("Failed to convert row to RDF", "table", job.TableName, "error", err)
+			dp.skipStats.Add(job.TableName, SkipRowConversion)
+			continue
+		}
+		if oversizedRow(rdfData) {
+			dp.logger.Warn("Skipping row with a triple too long to read back", "table", job.TableName, "limit_bytes", maxRDFLineBytes)
+			dp.skipStats.Add(job.TableName, SkipOversizedRow)
+			continue
 		}
 
-		// Convert to RDF
-		err = dp.writeRowAsRDF(writer, tableName, table, columns, values, schema)
-		if err != nil {
-			return processedCount, fmt.Errorf("failed to write RDF: %w", err)
+		rdfLines = append(rdfLines, rdfData...)
+		result.processed++
+
+		// Memory management - write in batches
+		if len(rdfLines) >= 100 {
+			if err := dp.writeRDFLines(ctx, writer, rdfLines); err != nil {
+				return result, err
+			}
+			rdfLines = rdfLines[:0] // Clear slice but keep capacity
+		}
+	}
+
+	// Write remaining lines
+	if len(rdfLines) > 0 {
+		if err := dp.writeRDFLines(ctx, writer, rdfLines); err != nil {
+			return result, err
 		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+	dp.watermarks.Observe(job.TableName, watermark)
+
+	// Update progress
+	dp.progress.mu.Lock()
+	dp.progress.ProcessedRows += result.processed
+	dp.progress.mu.Unlock()
 
-		processedCount++
+	// Force garbage collection periodically
+	if result.processed > 0 && result.processed%1000 == 0 {
+		runtime.GC()
 	}
 
-	return processedCount, rows.Err()
+	return result, rows.Err()
 }
 
-// writeRowAsRDF writes a single row as RDF triples
-func (dp *DataProcessor) writeRowAsRDF(writer *bufio.Writer, tableName string, table *Table, columns []string, values []interface{}, schema *Schema) error {
-	// Generate blank node ID
-	var pkValue string
-	for i, col := range columns {
-		if len(table.PrimaryKeys) > 0 && col == table.PrimaryKeys[0] {
-			pkValue = fmt.Sprintf("%v", values[i])
-			break
-		}
+func (dp *DataProcessor) convertRowToRDF(tableName string, cols []string, values []sql.RawBytes, schema *Schema) ([]string, error) {
+	var rdfLines []string
+
+	// Rows of collapsed junction tables become edges between their targets
+	if junction := collapsedJunction(dp.cfg, schema.Tables[tableName]); junction != nil {
+		return dp.junctionEdges(schema, tableName, junction, cols, func(i int) []byte { return values[i] }), nil
 	}
 
-	if pkValue == "" {
-		return fmt.Errorf("primary key not found for table %s", tableName)
+	// A NULL primary key would give every such row the same node
+	if dp.primaryKeyMissing(tableName, schema.Tables[tableName], cols, func(i int) []byte { return values[i] }) {
+		dp.skipStats.Add(tableName, SkipMissingPrimaryKey)
+		return nil, nil
 	}
 
-	blankNodeID := fmt.Sprintf("_%s_%s", tableName, pkValue)
+	// Generate UID for this row
+	rowUID, rowKey := dp.generateRowUID(tableName, cols, values, schema)
+
+	// Mask PII only after the row's identity has been taken from its key
+	dp.applyColumnRules(tableName, cols, values)
 
-	// Store UID mapping
-	dp.uidMapMu.Lock()
-	dp.uidMap[fmt.Sprintf("%s:%s", tableName, pkValue)] = blankNodeID
-	dp.uidMapMu.Unlock()
+	// Add type declaration
+	if dp.changed(rowUID, "dgraph.type", tableName) {
+		rdfLines = append(rdfLines, fmt.Sprintf("%s <dgraph.type> \"%s\" .", rowUID, dp.names.Name(tableName)))
+	}
+	// A delta row is found by its xid on import, so an unchanged xid is
+	// still written once anything else of the row is
+	var xidLine string
+	if dp.cfg.Output.EmitXID {
+		xidLine = dp.xidTriple(rowUID, tableName, rowKey)
+		if dp.changed(rowUID, xidPredicate, dp.xid(tableName, rowKey)) {
+			rdfLines = append(rdfLines, xidLine)
+			xidLine = ""
+		}
+	}
 
-	// Write type
-	fmt.Fprintf(writer, "%s <dgraph.type> \"%s\" .\n", blankNodeID, tableName)
+	// Process each column
+	for i, col := range cols {
+		if dp.cfg.Pipeline.ColumnRule(tableName, col) == "drop" {
+			continue
+		}
+		if dp.profiler != nil {
+			dp.profileValue(schema, tableName, col, values[i])
+		}
 
-	// Write properties
-	for i, col := range columns {
+		// Only SQL NULL scans as nil; empty strings and the text "null" are values
 		if values[i] == nil {
+			dp.skipStats.Add(tableName, SkipNullValue)
 			continue
 		}
+		val := string(values[i])
 
-		predicate := fmt.Sprintf("%s.%s", tableName, col)
+		predicate := dp.names.Name(fmt.Sprintf("%s.%s", tableName, col))
+		column := dp.lookupColumn(schema, tableName, col)
 
-		// Check if this is a foreign key by looking in schema relationships
-		var refTable string
-		isForeignKey := false
-		for _, fk := range schema.Relationships {
-			if fk.TableName == tableName && fk.ColumnName == col {
-				refTable = fk.RefTableName
-				isForeignKey = true
-				break
+		// Predicates whose value is unchanged since the previous run are
+		// skipped. Each is checked under the predicate it is written as, so
+		// one that is no longer written can be deleted.
+
+		// Columns forced to bool are converted and never treated as foreign keys
+		if dp.cfg.Output.IsBooleanColumn(tableName, col) {
+			if !dp.changed(rowUID, predicate, val) {
+				continue
+			}
+			literal, err := dp.rdfLiteral(tableName, col, "bool", column, values[i])
+			if err != nil {
+				dp.skipStats.Add(tableName, skipReason(err))
+				continue
 			}
+			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", rowUID, predicate, literal))
+			continue
 		}
 
-		if isForeignKey {
-			// This is a foreign key - create edge
-			refBlankNodeID := fmt.Sprintf("_%s_%v", refTable, values[i])
-			fmt.Fprintf(writer, "%s <%s> %s .\n", blankNodeID, predicate, refBlankNodeID)
+		// Check if this is a foreign key
+		isFK, refTable := dp.isForeignKey(tableName, col, schema)
+
+		if isFK {
+			// An empty key references nothing
+			if val == "" {
+				dp.skipStats.Add(tableName, SkipEmptyString)
+				continue
+			}
+
+			// Create reference to foreign entity
+			forwardPredicate := dp.names.Name(ForwardPredicateName(schema, tableName, col, refTable))
+			if !dp.changed(rowUID, forwardPredicate, val) {
+				continue
+			}
+			refKey := dp.refKey(schema, tableName, col, refTable, val)
+			refUID := dp.getOrCreateUID(refTable, refKey)
+			if dp.cfg.Output.JSONUpsert {
+				rdfLines = append(rdfLines, dp.xidTriple(refUID, refTable, refKey))
+			}
+			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", rowUID, forwardPredicate, refUID))
+
+			// Add reverse edge, unless the schema's @reverse provides it
+			if dp.cfg.Output.ManualReverseEdges() {
+				reversePredicate := dp.names.Name(ReversePredicateName(tableName, col, refTable))
+				rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", refUID, reversePredicate, rowUID))
+			}
 		} else {
-			// Regular property
-			value := fmt.Sprintf("%v", values[i])
-			fmt.Fprintf(writer, "%s <%s> \"%s\" .\n", blankNodeID, predicate, value)
+			// SET values become one triple per member of a [string] predicate
+			if column != nil && IsSetType(column.Type) {
+				if !dp.changed(rowUID, predicate, val) {
+					continue
+				}
+				for _, member := range splitSetValue(val) {
+					rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> \"%s\" .", rowUID, predicate, escapeRDFLiteral(member)))
+				}
+				continue
+			}
+
+			// JSON objects become one predicate per top-level key
+			if fields, ok := dp.expandJSON(tableName, column, values[i]); ok {
+				for _, field := range fields {
+					fieldPredicate := dp.jsonFieldPredicate(tableName, col, field.Key)
+					if dp.changed(rowUID, fieldPredicate, field.Literal) {
+						rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", rowUID, fieldPredicate, field.Literal))
+					}
+				}
+				continue
+			}
+
+			// Regular data predicate
+			if !dp.changed(rowUID, predicate, val) {
+				continue
+			}
+			literal, err := dp.rdfLiteral(tableName, col, dp.dgraphType(tableName, column), column, values[i])
+			if err != nil {
+				dp.logger.Debug("Skipping value", "table", tableName, "column", col, "error", err)
+				dp.skipStats.Add(tableName, skipReason(err))
+				continue
+			}
+			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> %s .", rowUID, predicate, literal))
 		}
 	}
 
-	return nil
+	// Materialize derived predicates configured for this table
+	if derived := dp.derived[tableName]; len(derived) > 0 {
+		row := derivedRow(schema.Tables[tableName], cols, values)
+		for _, dpred := range derived {
+			result, err := dpred.Expr.Eval(row)
+			if err != nil {
+				dp.logger.Debug("Failed to evaluate derived predicate",
+					"predicate", dpred.Predicate,
+					"error", err)
+				dp.skipStats.Add(tableName, SkipConversionFailed)
+				continue
+			}
+			if result.IsNull() {
+				dp.skipStats.Add(tableName, SkipNullValue)
+				continue
+			}
+
+			val := result.String()
+			derivedPredicate := dp.names.Name(dpred.Predicate)
+			if !dp.changed(rowUID, derivedPredicate, val) {
+				continue
+			}
+			rdfLines = append(rdfLines, fmt.Sprintf("%s <%s> \"%s\" .", rowUID, derivedPredicate, dp.escapeRDFValue(val)))
+		}
+	}
+
+	if xidLine != "" && len(rdfLines) > 0 {
+		rdfLines = append(rdfLines, xidLine)
+	}
+	if dp.fingerprints != nil {
+		dp.recordDeletions(rowUID, dp.xidTriple(rowUID, tableName, rowKey), dp.fingerprints.Removed(rowUID))
+	}
+
+	return rdfLines, nil
+}
+
+// recordDeletions queues the deletion of the predicates a delta row no longer
+// has: values that became NULL, or are no longer written at all. The row's
+// xid triple goes first, so the importer can find the node to delete from.
+func (dp *DataProcessor) recordDeletions(rowUID, xidLine string, predicates []string) {
+	if len(predicates) == 0 {
+		return
+	}
+	dp.deletionsMu.Lock()
+	defer dp.deletionsMu.Unlock()
+	dp.deletions = append(dp.deletions, xidLine)
+	for _, predicate := range predicates {
+		dp.deletions = append(dp.deletions, fmt.Sprintf("%s <%s> * .", rowUID, predicate))
+	}
+}
+
+// primaryKeyMissing reports whether a row of a table with a primary key has
+// a NULL primary key value and no key_columns label to identify it instead
+func (dp *DataProcessor) primaryKeyMissing(tableName string, table *Table, cols []string, valueAt func(i int) []byte) bool {
+	if table == nil || len(table.PrimaryKeys) == 0 {
+		return false
+	}
+	if _, ok := dp.keyLabel(tableName, cols, valueAt); ok {
+		return false
+	}
+	for _, pk := range table.PrimaryKeys {
+		for i, col := range cols {
+			if col == pk && valueAt(i) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oversizedRow reports whether any of a row's triples is too long for the
+// RDF readers, which scan lines of at most maxRDFLineBytes
+func oversizedRow(lines []string) bool {
+	for _, line := range lines {
+		if len(line) >= maxRDFLineBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// profileValue records a column value with the profiler
+func (dp *DataProcessor) profileValue(schema *Schema, tableName, col string, value sql.RawBytes) {
+	dgraphType := "string"
+	if column := dp.lookupColumn(schema, tableName, col); column != nil {
+		dgraphType = columnDgraphType(dp.cfg, tableName, column)
+	}
+	dp.profiler.Observe(tableName+"."+col, dgraphType, value)
+}
+
+// changed reports whether a predicate value must be emitted. Without delta
+// tracking every value is considered changed.
+func (dp *DataProcessor) changed(node, predicate, value string) bool {
+	if dp.fingerprints == nil {
+		return true
+	}
+	return dp.fingerprints.Changed(node, predicate, value)
+}
+
+// generateRowUID returns a row's blank node and the key it was derived from
+func (dp *DataProcessor) generateRowUID(tableName string, cols []string, values []sql.RawBytes, schema *Schema) (string, string) {
+	key := dp.rowKey(tableName, schema.Tables[tableName], cols, func(i int) []byte { return values[i] })
+	return makeUID(dp.cfg.Output.UIDNamespace, tableName, key), key
+}
+
+// xid returns the external ID written to a row's xid predicate: table:key,
+// prefixed with output.uid_namespace when set
+func (dp *DataProcessor) xid(tableName, key string) string {
+	if dp.cfg.Output.UIDNamespace != "" {
+		return dp.cfg.Output.UIDNamespace + ":" + tableName + ":" + key
+	}
+	return tableName + ":" + key
+}
+
+// rowKey returns the identity of a row: its key_columns label, else all of
+// its primary key values joined by "_", else a hash of the whole row for
+// tables without a primary key
+func (dp *DataProcessor) rowKey(tableName string, table *Table, cols []string, valueAt func(i int) []byte) string {
+	// Configured key columns take precedence over the primary key
+	if label, ok := dp.keyLabel(tableName, cols, valueAt); ok {
+		return label
+	}
+
+	if table != nil && len(table.PrimaryKeys) > 0 {
+		parts := make([]string, 0, len(table.PrimaryKeys))
+		for _, pk := range table.PrimaryKeys {
+			for i, col := range cols {
+				if col == pk {
+					parts = append(parts, string(valueAt(i)))
+					break
+				}
+			}
+		}
+		if len(parts) == len(table.PrimaryKeys) {
+			return joinKey(parts)
+		}
+	}
+
+	return rowHash(cols, valueAt)
+}
+
+// joinKey combines the values of a multi-column key. Each value is prefixed
+// with its length, so ("a_b", "c") and ("a", "b_c") give different keys: the
+// first is 3_a_b_1_c, the second 1_a_3_b_c. A single value is used as is.
+func joinKey(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	prefixed := make([]string, len(parts))
+	for i, part := range parts {
+		prefixed[i] = strconv.Itoa(len(part)) + "_" + part
+	}
+	return strings.Join(prefixed, "_")
+}
+
+// rowHash identifies a row by a hash of all of its values
+func rowHash(cols []string, valueAt func(i int) []byte) string {
+	hash := fnv.New64a()
+	for i := range cols {
+		value := valueAt(i)
+		if value == nil {
+			hash.Write([]byte{0xff})
+		} else {
+			fmt.Fprintf(hash, "%d:", len(value))
+			hash.Write(value)
+		}
+	}
+	return fmt.Sprintf("row%016x", hash.Sum64())
+}
+
+// junctionEdges returns the forward and backward edges for a junction row,
+// both carrying the row's facet columns. Rows with a NULL side link nothing
+// and produce no edges.
+func (dp *DataProcessor) junctionEdges(schema *Schema, tableName string, junction *Junction, cols []string, valueAt func(i int) []byte) []string {
+	var left, right []byte
+	for i, col := range cols {
+		switch col {
+		case junction.Left.ColumnName:
+			left = valueAt(i)
+		case junction.Right.ColumnName:
+			right = valueAt(i)
+		}
+	}
+	if left == nil || right == nil {
+		dp.skipStats.Add(tableName, SkipNullValue)
+		return nil
+	}
+
+	leftKey := dp.refKey(schema, tableName, junction.Left.ColumnName, junction.Left.RefTableName, string(left))
+	rightKey := dp.refKey(schema, tableName, junction.Right.ColumnName, junction.Right.RefTableName, string(right))
+	leftUID := dp.getOrCreateUID(junction.Left.RefTableName, leftKey)
+	rightUID := dp.getOrCreateUID(junction.Right.RefTableName, rightKey)
+	forward, backward := junction.Predicates()
+	facets := dp.edgeFacets(schema, tableName, junction, cols, valueAt)
+	var lines []string
+	if dp.cfg.Output.JSONUpsert {
+		lines = append(lines,
+			dp.xidTriple(leftUID, junction.Left.RefTableName, leftKey),
+			dp.xidTriple(rightUID, junction.Right.RefTableName, rightKey))
+	}
+	return append(lines,
+		fmt.Sprintf("%s <%s> %s%s .", leftUID, dp.names.Name(forward), rightUID, facets),
+		fmt.Sprintf("%s <%s> %s%s .", rightUID, dp.names.Name(backward), leftUID, facets))
+}
+
+// edgeFacets returns a junction row's facet columns in RDF facet syntax,
+// " (assigned_at=2024-01-01T00:00:00Z)", or "" when there are none. NULL
+// values, invalid dates and dropped columns are left out, and hashed or
+// redacted columns are masked.
+func (dp *DataProcessor) edgeFacets(schema *Schema, tableName string, junction *Junction, cols []string, valueAt func(i int) []byte) string {
+	var facets []string
+	for _, facet := range junction.Facets {
+		rule := dp.cfg.Pipeline.ColumnRule(tableName, facet)
+		if rule == "drop" {
+			continue
+		}
+		for i, col := range cols {
+			if col != facet {
+				continue
+			}
+			raw := valueAt(i)
+			if raw == nil {
+				break
+			}
+			if rule != "" {
+				raw = maskValue(rule, raw)
+			}
+			if value, ok := dp.facetValue(schema, tableName, facet, raw); ok {
+				facets = append(facets, fmt.Sprintf("%s=%s", facet, value))
+			}
+			break
+		}
+	}
+	if len(facets) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(facets, ", ") + ")"
+}
+
+// facetValue formats a facet value, reporting false for values skipped the
+// way rdfLiteral skips them. Numbers, booleans and datetimes are written bare
+// so Dgraph stores them typed; anything else is a quoted string.
+func (dp *DataProcessor) facetValue(schema *Schema, tableName, columnName string, raw []byte) (string, bool) {
+	column := dp.lookupColumn(schema, tableName, columnName)
+	if column == nil {
+		return `"` + escapeRDFLiteral(string(raw)) + `"`, true
+	}
+	dgraphType := columnDgraphType(dp.cfg, tableName, column)
+	body, err := dp.converters.Lookup(dgraphType).Convert(raw, column)
+	if errors.Is(err, errNullValue) || errors.Is(err, errInvalidDate) {
+		dp.skipStats.Add(tableName, skipReason(err))
+		return "", false
+	}
+	if err != nil {
+		return `"` + escapeRDFLiteral(string(raw)) + `"`, true
+	}
+	switch dgraphType {
+	case "int", "float", "bool":
+		return body, true
+	case "datetime":
+		if _, err := time.Parse(time.RFC3339Nano, body); err == nil {
+			return body, true
+		}
+	}
+	return `"` + body + `"`, true
+}
+
+// xidPredicate holds each node's table:key external ID when output.emit_xid
+// is enabled
+const xidPredicate = "xid"
+
+// xidTriple returns the triple giving a row's node its external ID. With
+// output.json_upsert the nodes an edge points at get one as well, written
+// before the edge, so a JSON batch holding only the reference can find a node
+// another batch wrote.
+func (dp *DataProcessor) xidTriple(uid, tableName, key string) string {
+	return fmt.Sprintf("%s <%s> \"%s\" .", uid, xidPredicate, escapeRDFLiteral(dp.xid(tableName, key)))
+}
+
+// makeUID returns the blank node for a table row, prefixed with
+// output.uid_namespace when set so databases loaded into one Dgraph do not
+// share nodes. Every output path names nodes this way so edges written by
+// one resolve to nodes written by another.
+func makeUID(namespace, tableName, id string) string {
+	return fmt.Sprintf("_:%s%s_%s", uidPrefix(namespace), escapeBlankTable(tableName), escapeBlankKey(id))
+}
+
+// uidPrefix returns what output.uid_namespace puts in front of the table of
+// a blank node label. The "_" of the namespace are escaped like the bytes
+// escapeBlankKey escapes, so the prefix ends at its only "_" and namespace
+// prod with table eu_users never shares a label with prod_eu and users.
+func uidPrefix(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return strings.ReplaceAll(namespace, "_", ".5F") + "_"
+}
+
+// escapeBlankTable escapes the bytes of a table name that may not appear in
+// a blank node label, such as spaces, like escapeBlankKey. The "." of a name
+// qualified with its database is kept.
+func escapeBlankTable(tableName string) string {
+	database, table, ok := strings.Cut(tableName, ".")
+	if ok {
+		return escapeBlankKey(database) + "." + escapeBlankKey(table)
+	}
+	return escapeBlankKey(tableName)
+}
+
+// escapeBlankKey escapes the bytes of a row key that may not appear in a
+// blank node label as "." and two hex digits, so business keys such as
+// e-mail addresses or paths make valid labels. Keys of letters, digits, "_"
+// and "-" are kept as they are; since "." is escaped as well, two different
+// keys never share a label.
+func escapeBlankKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, ".%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (dp *DataProcessor) isForeignKey(tableName, columnName string, schema *Schema) (bool, string) {
+	// Masked values no longer identify the referenced row
+	if dp.cfg.Pipeline.ColumnRule(tableName, columnName) != "" {
+		return false, ""
+	}
+
+	// Check explicit foreign key relationships
+	for _, fk := range schema.Relationships {
+		if fk.TableName == tableName && fk.ColumnName == columnName {
+			return true, fk.RefTableName
+		}
+	}
+
+	// Check naming conventions
+	if IsForeignKey(columnName) {
+		// Extract potential table name from column name
+		refTableName := strings.TrimSuffix(strings.ToLower(columnName), "_id")
+		if database, _, ok := strings.Cut(tableName, "."); ok {
+			refTableName = database + "." + refTableName
+		}
+
+		// Check if referenced table exists
+		if _, exists := schema.Tables[refTableName]; exists {
+			return true, refTableName
+		}
+
+		// Try plural form
+		pluralTableName := pluralForm(refTableName, dp.cfg.Output.PluralizationOverrides)
+		if _, exists := schema.Tables[pluralTableName]; exists {
+			return true, pluralTableName
+		}
+	}
+
+	return false, ""
+}
+
+// lookupColumn returns the schema column for a table, or nil if unknown
+func (dp *DataProcessor) lookupColumn(schema *Schema, tableName, columnName string) *Column {
+	table := schema.Tables[tableName]
+	if table == nil {
+		return nil
+	}
+	return table.Columns[columnName]
+}
+
+func (dp *DataProcessor) getOrCreateUID(tableName, id string) string {
+	// Blank nodes derive from the key, so the mapping is only kept to be
+	// written out
+	if dp.uids == nil {
+		return makeUID(dp.cfg.Output.UIDNamespace, tableName, id)
+	}
+
+	key := fmt.Sprintf("%s:%s", tableName, id)
+	if uid, exists := dp.uids.Get(key); exists {
+		return uid
+	}
+
+	uid := makeUID(dp.cfg.Output.UIDNamespace, tableName, id)
+	if err := dp.uids.Put(key, uid); err != nil {
+		dp.logger.Error("Failed to record UID mapping", "key", key, "error", err)
+	}
+	return uid
+}
+
+// query runs a batch query, through a prepared statement when enabled
+func (dp *DataProcessor) query(ctx context.Context, db *sql.DB, query string, args ...interface{}) (*sql.Rows, error) {
+	if dp.statements != nil {
+		return dp.statements.Query(ctx, query, args...)
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+// dgraphType returns a column's Dgraph type; unknown columns are strings
+func (dp *DataProcessor) dgraphType(tableName string, column *Column) string {
+	if column == nil {
+		return "string"
+	}
+	return columnDgraphType(dp.cfg, tableName, column)
+}
+
+// expandJSON splits a JSON column value into its top-level fields when
+// pipeline.expand_json_columns is set. Values that are not a JSON object,
+// including invalid JSON, return false and are written as a string.
+func (dp *DataProcessor) expandJSON(tableName string, column *Column, raw []byte) ([]jsonField, bool) {
+	if !dp.cfg.Pipeline.ExpandJSONColumns || column == nil || !IsJSONType(column.Type) ||
+		dp.cfg.Pipeline.ColumnRule(tableName, column.Name) != "" {
+		return nil, false
+	}
+	return expandJSONObject(raw)
+}
+
+// jsonFieldPredicate names the predicate of a JSON field: table.column.key
+func (dp *DataProcessor) jsonFieldPredicate(tableName, columnName, key string) string {
+	return dp.names.Name(fmt.Sprintf("%s.%s.%s", tableName, columnName, key))
+}
+
+// rdfLiteral converts a value to a typed RDF literal. A value the type's
+// converter rejects is written as a plain string with a warning; only values
+// dropped on purpose (NULLs and invalid dates) return an error.
+func (dp *DataProcessor) rdfLiteral(tableName, columnName, dgraphType string, column *Column, raw []byte) (string, error) {
+	converter := dp.converters.Lookup(dgraphType)
+	if dgraphType == "string" && isBase64Column(dp.cfg, tableName, column) {
+		converter = base64Converter{}
+	}
+	body, err := converter.Convert(raw, column)
+	if err == nil {
+		if lang := columnLanguage(dp.cfg, tableName, column, dgraphType); lang != "" {
+			return typedLiteral(dgraphType, body) + "@" + lang, nil
+		}
+		return typedLiteral(dgraphType, body), nil
+	}
+	if errors.Is(err, errNullValue) || errors.Is(err, errInvalidDate) {
+		return "", err
+	}
+
+	dp.logger.Warn("Writing unconvertible value as string",
+		"table", tableName,
+		"column", columnName,
+		"type", dgraphType,
+		"error", err)
+	return `"` + escapeRDFLiteral(string(raw)) + `"`, nil
+}
+
+func (dp *DataProcessor) escapeRDFValue(value string) string {
+	return escapeRDFLiteral(value)
+}
+
+// jsonLiteral returns a function that types a literal for JSON output using
+// the converter of the predicate's column. Columns are looked up by the name
+// their predicate is written under, so database-qualified, escaped and
+// shortened names find their table and column. Predicates that are not
+// columns, such as derived predicates and dgraph.type, stay strings.
+func (dp *DataProcessor) jsonLiteral(schema *Schema) func(predicate, value string) interface{} {
+	type columnRef struct {
+		table  string
+		column *Column
+	}
+	columns := make(map[string]columnRef)
+	for tableName, table := range schema.Tables {
+		for _, column := range table.Columns {
+			columns[dp.names.written(tableName+"."+column.Name)] = columnRef{table: tableName, column: column}
+		}
+	}
+
+	return func(predicate, value string) interface{} {
+		ref, ok := columns[predicate]
+		if !ok || IsSetType(ref.column.Type) {
+			return value
+		}
+		converted, err := dp.converters.ForColumn(dp.cfg, ref.table, ref.column).ConvertJSON([]byte(value), ref.column)
+		if err != nil {
+			return value
+		}
+		return converted
+	}
+}
+
+// writeRDFLines writes to the job's own part file, so only the shared JSON
+// and Dgraph sinks need locking. Failures wrap errOutputWrite.
+func (dp *DataProcessor) writeRDFLines(ctx context.Context, writer *bufio.Writer, lines []string) error {
+	if dp.cfg.Pipeline.DryRun {
+		return nil
+	}
+
+	if dp.dgraphSink != nil {
+		dp.outputMu.Lock()
+		defer dp.outputMu.Unlock()
+		if err := dp.dgraphSink.Add(ctx, lines); err != nil {
+			return fmt.Errorf("%w: failed to send mutation batch: %w", errOutputWrite, err)
+		}
+		return nil
+	}
+
+	if dp.jsonBatches != nil {
+		dp.outputMu.Lock()
+		defer dp.outputMu.Unlock()
+		if err := dp.jsonBatches.Add(lines); err != nil {
+			return fmt.Errorf("%w: failed to write JSON batch: %w", errOutputWrite, err)
+		}
+		return nil
+	}
+
+	for _, line := range lines {
+		if _, err := writer.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("%w: %w", errOutputWrite, err)
+		}
+	}
+	return nil
+}
+
+func (dp *DataProcessor) submitTableJobs(ctx context.Context, db *sql.DB, schema *Schema, tableName string, jobChan chan<- TableJob) error {
+	table := schema.Tables[tableName]
+	if table == nil {
+		return fmt.Errorf("table %s not found in schema", tableName)
+	}
+
+	batchSize := int64(dp.cfg.Pipeline.BatchSize)
+	totalRows := table.RowCount
+
+	// Skip what an interrupted run already wrote
+	resume := dp.checkpoint.Table(tableName)
+	if resume.Done {
+		dp.logger.Info("Skipping table completed before the interruption", "table", tableName)
+		return nil
+	}
+
+	// Stream each partition separately so partitions are read in parallel
+	if dp.cfg.Pipeline.PartitionAware && len(table.Partitions) > 0 {
+		keyColumn := keysetColumn(table)
+		for _, partition := range table.Partitions {
+			if resume.partitionDone(partition.Name) {
+				continue
+			}
+			if err := dp.submitJob(ctx, jobChan, TableJob{
+				TableName: tableName,
+				Schema:    schema,
+				BatchSize: int(batchSize),
+				KeyColumn: keyColumn,
+				Partition: partition.Name,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// If table is small, process in single batch
+	if totalRows <= batchSize && resume.LastKey == "" {
+		return dp.submitJob(ctx, jobChan, TableJob{
+			TableName: tableName,
+			Schema:    schema,
+			BatchSize: int(batchSize),
+			Offset:    resume.Offset,
+			Limit:     max(totalRows-resume.Offset, 0),
+		})
+	}
+
+	// Walk large tables by primary key when possible; deep OFFSETs make MySQL
+	// scan and discard every skipped row
+	if keyColumn := keysetColumn(table); keyColumn != "" {
+		return dp.submitJob(ctx, jobChan, TableJob{
+			TableName: tableName,
+			Schema:    schema,
+			BatchSize: int(batchSize),
+			KeyColumn: keyColumn,
+			ResumeKey: resume.LastKey,
+		})
+	}
+
+	// Split into batches for large tables
+	for offset := resume.Offset; offset < totalRows; offset += batchSize {
+		limit := batchSize
+		if offset+batchSize > totalRows {
+			limit = totalRows - offset
+		}
+
+		if err := dp.submitJob(ctx, jobChan, TableJob{
+			TableName: tableName,
+			Schema:    schema,
+			BatchSize: int(batchSize),
+			Offset:    offset,
+			Limit:     limit,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submitJob numbers a job and sends it to the workers
+func (dp *DataProcessor) submitJob(ctx context.Context, jobChan chan<- TableJob, job TableJob) error {
+	// Let running jobs drain while memory is over the limit
+	if err := dp.memory.Wait(ctx); err != nil {
+		return err
+	}
+
+	job.Sequence = dp.jobSeq
+	dp.jobSeq++
+	dp.tableJobUpdate(job.TableName, 1, false)
+
+	select {
+	case jobChan <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// keysetColumn returns the table's primary key column if it is a single
+// integer column usable for keyset pagination, or "" otherwise
+func keysetColumn(table *Table) string {
+	if len(table.PrimaryKeys) != 1 {
+		return ""
+	}
+	column := table.Columns[table.PrimaryKeys[0]]
+	if column == nil || MySQLToDgraphType(column.FullType()) != "int" {
+		return ""
+	}
+	return column.Name
+}
+
+// calculateTotalRows sums the row counts taken during schema extraction, so
+// tables are not counted a second time. With pipeline.use_approximate_counts
+// the total comes from information_schema's estimates instead, which ignore
+// table_filters; it only drives progress reporting.
+func (dp *DataProcessor) calculateTotalRows(ctx context.Context, db *sql.DB, schema *Schema, tables []string) (int64, error) {
+	if dp.cfg.Pipeline.UseApproximateCounts {
+		return dp.approximateTotalRows(ctx, db, tables)
+	}
+
+	var total int64
+	for _, tableName := range tables {
+		if table := schema.Tables[tableName]; table != nil {
+			total += table.RowCount
+		}
+	}
+	return total, nil
+}
+
+// approximateTotalRows sums information_schema.tables.table_rows, which
+// InnoDB keeps as an estimate, in one query instead of scanning each table
+func (dp *DataProcessor) approximateTotalRows(ctx context.Context, db *sql.DB, tables []string) (int64, error) {
+	if err := dp.limiter.Acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer dp.limiter.Release()
+
+	databases := dp.cfg.MySQL.SourceDatabases()
+	args := make([]interface{}, len(databases))
+	for i, database := range databases {
+		args[i] = database
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(databases)), ",")
+	rows, err := db.QueryContext(ctx,
+		"SELECT table_schema, table_name, table_rows FROM information_schema.tables WHERE table_schema IN ("+placeholders+")",
+		args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read table row estimates: %w", err)
+	}
+	defer rows.Close()
+
+	estimates := make(map[string]int64)
+	for rows.Next() {
+		var database, name string
+		var tableRows sql.NullInt64
+		if err := rows.Scan(&database, &name, &tableRows); err != nil {
+			return 0, err
+		}
+		if dp.cfg.MySQL.QualifiedNames() {
+			name = database + "." + name
+		}
+		estimates[name] = tableRows.Int64
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, tableName := range tables {
+		total += estimates[tableName]
+	}
+	return total, nil
+}
+
+// tableJobUpdate adjusts a table's outstanding job count and counts the table
+// as processed once all of its jobs are submitted and finished
+func (dp *DataProcessor) tableJobUpdate(tableName string, delta int, submitted bool) {
+	dp.tableJobsMu.Lock()
+	defer dp.tableJobsMu.Unlock()
+
+	count := dp.tableJobs[tableName]
+	if count == nil {
+		count = &tableJobCount{}
+		dp.tableJobs[tableName] = count
+	}
+	count.pending += delta
+	count.submitted = count.submitted || submitted
+
+	if count.submitted && count.pending == 0 {
+		delete(dp.tableJobs, tableName)
+		dp.progress.mu.Lock()
+		dp.progress.ProcessedTables++
+		dp.progress.mu.Unlock()
+	}
+}
+
+// collectResults logs and records job outcomes and returns the first output
+// write failure. Jobs that fail to read their rows are only logged.
+func (dp *DataProcessor) collectResults(resultChan <-chan ProcessingResult) error {
+	var writeErr error
+	for result := range resultChan {
+		dp.results = append(dp.results, result)
+		dp.tableJobUpdate(result.TableName, -1, false)
+		if result.Error != nil {
+			if writeErr == nil && errors.Is(result.Error, errOutputWrite) {
+				writeErr = fmt.Errorf("table %s: %w", result.TableName, result.Error)
+			}
+
+			dp.logger.Error("Table processing failed",
+				"table", result.TableName,
+				"error", result.Error,
+				"duration", result.Duration)
+
+			dp.progress.mu.Lock()
+			dp.progress.ErrorCount++
+			dp.progress.mu.Unlock()
+		} else {
+			dp.logger.Debug("Table batch processed successfully",
+				"table", result.TableName,
+				"rows", result.RowsProcessed,
+				"duration", result.Duration)
+		}
+	}
+	return writeErr
+}
+
+func (dp *DataProcessor) writeUIDMappings() error {
+	if dp.uids == nil {
+		dp.logger.Info("Skipping UID mapping file, blank nodes are derived from table and key")
+		return nil
+	}
+	defer dp.uids.Close()
+
+	mappingPath := filepath.Join(dp.cfg.Output.Directory, dp.cfg.Output.MappingFile)
+
+	var count int64
+	err := WriteUIDMappingFrom(mappingPath, dp.cfg.Output.MappingFormat, func(fn func(key, uid string) error) error {
+		count = 0
+		return dp.uids.Each(func(key, uid string) error {
+			count++
+			return fn(key, uid)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	dp.logger.Info("UID mappings written",
+		"count", count,
+		"spill_files", dp.uids.Spilled(),
+		"file", mappingPath,
+		"format", dp.cfg.Output.MappingFormat)
+	return nil
+}
+
+// getTableRowCount returns the number of rows a table's filter selects
+func (dp *DataProcessor) getTableRowCount(ctx context.Context, db *sql.DB, tableName string) (int64, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteTable(tableName), dp.where(tableName))
+	var count int64
+	if err := dp.limiter.Acquire(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count rows in table %s: %w", tableName, err)
+	}
+	err := db.QueryRowContext(ctx, query).Scan(&count)
+	dp.limiter.Release()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows in table %s: %w", tableName, err)
+	}
+
+	return count, nil
 }
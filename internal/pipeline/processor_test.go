@@ -0,0 +1,1417 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// processRDF exports every table of tables through ProcessTables and returns
+// the non-empty lines of the RDF files written. Row counts of the schema are
+// set from tables, as schema extraction would.
+func processRDF(t *testing.T, cfg *config.Config, schema *Schema, tables map[string]*fakeTable) []string {
+	t.Helper()
+	db, _ := newFakeDB(t, tablesHandler(tables))
+
+	var names []string
+	for name, table := range tables {
+		names = append(names, name)
+		if schema.Tables[name] != nil {
+			schema.Tables[name].RowCount = int64(len(table.rows))
+		}
+	}
+	if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, names); err != nil {
+		t.Fatalf("ProcessTables: %v", err)
+	}
+
+	var lines []string
+	for _, name := range rdfDataFiles(cfg) {
+		data, err := os.ReadFile(filepath.Join(cfg.Output.Directory, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// writeFile writes content to path
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of path
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJSONLiteral(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.MaxNameLength = 24
+	schema := &Schema{Tables: map[string]*Table{
+		"users": {Name: "users", Columns: map[string]*Column{
+			"age": {Name: "age", Type: "int", ColumnType: "int"},
+		}},
+		"shop.orders": {Name: "orders", Columns: map[string]*Column{
+			"total":                       {Name: "total", Type: "decimal", ColumnType: "decimal(10,2)"},
+			"unit price":                  {Name: "unit price", Type: "double", ColumnType: "double"},
+			"paid":                        {Name: "paid", Type: "tinyint", ColumnType: "tinyint(1)"},
+			"a_very_long_quantity_column": {Name: "a_very_long_quantity_column", Type: "int", ColumnType: "int"},
+		}},
+	}}
+	dp := testProcessor(cfg)
+	literal := dp.jsonLiteral(schema)
+
+	tests := []struct {
+		name      string
+		predicate string
+		value     string
+		want      string // JSON encoding of the converted value
+	}{
+		{"plain column", "users.age", "42", `42`},
+		{"database-qualified column", "shop.orders.total", "12.50", `12.5`},
+		{"escaped column name", "shop.orders.unit%20price", "2.25", `2.25`},
+		{"shortened column name", dp.names.Name("shop.orders.a_very_long_quantity_column"), "7", `7`},
+		{"unknown predicate stays a string", "users.nickname", "42", `"42"`},
+		{"derived-looking name is not split at its first dot", "shop.orders", "42", `"42"`},
+		{"dgraph.type", "dgraph.type", "users", `"users"`},
+		{"unconvertible value stays a string", "users.age", "forty", `"forty"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(literal(tt.predicate, tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("literal(%q, %q) = %s, want %s", tt.predicate, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBooleanColumns(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.BooleanColumns = []string{"posts.flag_id", "is_*"}
+	schema := fkSchema(map[string][]string{"flag": nil, "posts": {"flag_id"}}, [][3]string{{"posts", "flag_id", "flag"}})
+	schema.Tables["posts"].Columns["is_deleted"] = &Column{Name: "is_deleted", Type: "varchar"}
+
+	lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+		"flag": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}},
+		"posts": {columns: []string{"id", "flag_id", "is_deleted"}, rows: [][]driver.Value{
+			{int64(1), int64(1), "yes"},
+			{int64(2), int64(0), "no"},
+			{int64(3), int64(7), "maybe"},
+		}},
+	})
+
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`_:posts_1 <posts.flag_id> "true"^^<xs:boolean> .`, true},
+		{`_:posts_2 <posts.flag_id> "false"^^<xs:boolean> .`, true},
+		{`_:posts_1 <posts.is_deleted> "true"^^<xs:boolean> .`, true},
+		{`_:posts_2 <posts.is_deleted> "false"^^<xs:boolean> .`, true},
+		{`_:posts_3 <posts.flag_id> "true"^^<xs:boolean> .`, true}, // Any other number is C-style
+		{`_:posts_3 <posts.is_deleted> "maybe" .`, true},           // Unconvertible values stay strings
+		{`_:posts_1 <posts.flag_id> _:flag_1 .`, false},
+		{`_:posts_3 <posts.flag_id> _:flag_7 .`, false},
+	}
+	for _, tt := range tests {
+		if got := slices.Contains(lines, tt.line); got != tt.want {
+			t.Errorf("output contains %s = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSelfReferenceEdges(t *testing.T) {
+	cfg := testConfig(t)
+	schema := fkSchema(map[string][]string{"categories": {"parent_id", "original_id"}}, [][3]string{
+		{"categories", "parent_id", "categories"},
+		{"categories", "original_id", "categories"},
+	})
+	lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+		"categories": {columns: []string{"id", "parent_id", "original_id"}, rows: [][]driver.Value{
+			{int64(1), nil, nil},
+			{int64(2), int64(1), nil},
+			{int64(3), int64(1), int64(2)},
+			{int64(4), int64(2), nil},
+		}},
+	})
+
+	// Every link is written once forward and once reversed
+	var edges []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 4 && strings.HasPrefix(fields[2], "_:") {
+			edges = append(edges, line)
+		}
+	}
+	want := []string{
+		"_:categories_1 <categories.children> _:categories_2 .",
+		"_:categories_1 <categories.children> _:categories_3 .",
+		"_:categories_2 <categories.children> _:categories_4 .",
+		"_:categories_2 <categories.original_children> _:categories_3 .",
+		"_:categories_2 <categories.parent> _:categories_1 .",
+		"_:categories_3 <categories.original> _:categories_2 .",
+		"_:categories_3 <categories.parent> _:categories_1 .",
+		"_:categories_4 <categories.parent> _:categories_2 .",
+	}
+	slices.Sort(edges)
+	if !slices.Equal(edges, want) {
+		t.Errorf("edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The schema declares the same predicates and no semantic reverse
+	predicates, _, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for _, name := range []string{"categories.parent", "categories.children", "categories.original", "categories.original_children"} {
+		if predicates[name] == nil || predicates[name].Type != "uid" {
+			t.Errorf("predicate %s = %+v, want a uid edge", name, predicates[name])
+		}
+	}
+	for name, predicate := range predicates {
+		if predicate.Type == "uid" && !slices.Contains([]string{"categories.parent", "categories.children", "categories.original", "categories.original_children"}, name) {
+			t.Errorf("unexpected edge predicate %s", name)
+		}
+	}
+}
+
+func TestDecimalColumns(t *testing.T) {
+	rows := [][]driver.Value{
+		{int64(1), "12345678.90", "123456789012.123456"},
+		{int64(2), "-0.05", "-1E-6"},
+	}
+	tests := []struct {
+		name     string
+		asString bool
+		typ      string
+		want     []string
+	}{
+		{
+			name: "float",
+			typ:  "float",
+			want: []string{
+				`_:accounts_1 <accounts.price> "12345678.90"^^<xs:float> .`,
+				`_:accounts_1 <accounts.rate> "123456789012.123456"^^<xs:float> .`,
+				`_:accounts_2 <accounts.price> "-0.05"^^<xs:float> .`,
+				`_:accounts_2 <accounts.rate> "-0.000001"^^<xs:float> .`,
+			},
+		},
+		{
+			name:     "decimal_as_string keeps every digit",
+			asString: true,
+			typ:      "string",
+			want: []string{
+				`_:accounts_1 <accounts.price> "12345678.90" .`,
+				`_:accounts_1 <accounts.rate> "123456789012.123456" .`,
+				`_:accounts_2 <accounts.price> "-0.05" .`,
+				`_:accounts_2 <accounts.rate> "-0.000001" .`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.DecimalAsString = tt.asString
+			schema := fkSchema(map[string][]string{"accounts": nil}, nil)
+			schema.Tables["accounts"].Columns["price"] = &Column{Name: "price", Type: "decimal", ColumnType: "decimal(10,2)"}
+			schema.Tables["accounts"].Columns["rate"] = &Column{Name: "rate", Type: "decimal", ColumnType: "decimal(18,6)"}
+
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+				"accounts": {columns: []string{"id", "price", "rate"}, rows: rows},
+			})
+			for _, line := range tt.want {
+				if !slices.Contains(lines, line) {
+					t.Errorf("output lacks %s", line)
+				}
+			}
+
+			predicates, _, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			for _, name := range []string{"accounts.price", "accounts.rate"} {
+				if predicates[name] == nil || predicates[name].Type != tt.typ {
+					t.Errorf("predicate %s = %+v, want type %s", name, predicates[name], tt.typ)
+				}
+			}
+		})
+	}
+}
+
+func TestDerivedPredicates(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Output.DerivedPredicates = map[string]string{
+		"users.full_name": "first_name + ' ' + last_name",
+		"users.age":       "2024 - birth_year",
+	}
+	schema := fkSchema(map[string][]string{"users": nil}, nil)
+	for _, name := range []string{"first_name", "last_name"} {
+		schema.Tables["users"].Columns[name] = &Column{Name: name, Type: "varchar", ColumnType: "varchar(50)"}
+	}
+	schema.Tables["users"].Columns["birth_year"] = &Column{Name: "birth_year", Type: "int", ColumnType: "int"}
+
+	lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+		"users": {columns: []string{"id", "first_name", "last_name", "birth_year"}, rows: [][]driver.Value{
+			{int64(1), "Ada", "Lovelace", int64(1815)},
+			{int64(2), "Grace", "Hopper", int64(1906)},
+			{int64(3), "Alan", nil, nil},
+		}},
+	})
+
+	for _, line := range []string{
+		`_:users_1 <users.full_name> "Ada Lovelace" .`,
+		`_:users_2 <users.full_name> "Grace Hopper" .`,
+		`_:users_1 <users.age> "209" .`,
+		`_:users_2 <users.age> "118" .`,
+	} {
+		if !slices.Contains(lines, line) {
+			t.Errorf("output lacks %s", line)
+		}
+	}
+	// NULL operands make the result NULL, which is not written
+	for _, line := range lines {
+		if strings.HasPrefix(line, "_:users_3 <users.full_name>") || strings.HasPrefix(line, "_:users_3 <users.age>") {
+			t.Errorf("derived predicate written for NULL operands: %s", line)
+		}
+	}
+
+	predicates, types, err := NewSchemaGenerator(cfg, logger.New("error", "text")).build(schema)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for name, typ := range map[string]string{"users.full_name": "string", "users.age": "int"} {
+		if predicates[name] == nil || predicates[name].Type != typ {
+			t.Errorf("predicate %s = %+v, want type %s", name, predicates[name], typ)
+		}
+		if !slices.Contains(types["users"], name) {
+			t.Errorf("type users lacks %s: %v", name, types["users"])
+		}
+	}
+}
+
+// recordingHandler answers queries from table and records the arguments of
+// every batch query, in order
+func recordingHandler(table *fakeTable, args *[]string) fakeHandler {
+	var mu sync.Mutex
+	return func(query string, queryArgs []driver.NamedValue) (*fakeResult, error) {
+		if !strings.HasPrefix(query, "SELECT COUNT(*)") {
+			var values []string
+			for _, arg := range queryArgs {
+				values = append(values, fmt.Sprint(arg.Value))
+			}
+			mu.Lock()
+			*args = append(*args, strings.Join(values, ","))
+			mu.Unlock()
+		}
+		return countingHandler(table)(query, queryArgs)
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	sparse := &fakeTable{columns: []string{"id", "name"}}
+	for _, id := range []int64{10, 20, 35, 36, 90} {
+		sparse.rows = append(sparse.rows, []driver.Value{id, "user" + strconv.FormatInt(id, 10)})
+	}
+
+	tests := []struct {
+		name        string
+		table       *fakeTable
+		change      func(*Table)
+		queries     []string
+		args        []string // Arguments of each batch query
+		wantWritten int
+	}{
+		{
+			name:  "numeric primary key pages by key",
+			table: usersTable(5),
+			queries: []string{
+				"SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT ?",
+				"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?",
+				"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?",
+			},
+			args:        []string{"2", "2,2", "4,2"},
+			wantWritten: 5,
+		},
+		{
+			name:  "the last key seen is tracked across gaps",
+			table: sparse,
+			queries: []string{
+				"SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT ?",
+				"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?",
+				"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?",
+			},
+			args:        []string{"2", "20,2", "36,2"},
+			wantWritten: 5,
+		},
+		{
+			name:  "a string primary key falls back to OFFSET",
+			table: usersTable(5),
+			change: func(table *Table) {
+				table.Columns["id"].Type, table.Columns["id"].ColumnType = "varchar", "varchar(36)"
+			},
+			queries: []string{
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+			},
+			args:        []string{"2,0", "2,2", "1,4"},
+			wantWritten: 5,
+		},
+		{
+			name:  "a composite primary key falls back to OFFSET",
+			table: usersTable(5),
+			change: func(table *Table) {
+				table.PrimaryKeys = []string{"id", "name"}
+			},
+			queries: []string{
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+				"SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?",
+			},
+			args:        []string{"2,0", "2,2", "1,4"},
+			wantWritten: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.BatchSize = 2
+			schema := usersSchema(int64(len(tt.table.rows)))
+			if tt.change != nil {
+				tt.change(schema.Tables["users"])
+			}
+			var args []string
+			db, fake := newFakeDB(t, recordingHandler(tt.table, &args))
+
+			if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+
+			var queries []string
+			for _, query := range fake.Queries() {
+				if !strings.HasPrefix(query, "SELECT COUNT(*)") {
+					queries = append(queries, query)
+				}
+			}
+			if !slices.Equal(queries, tt.queries) {
+				t.Errorf("queries:\n%s\nwant:\n%s", strings.Join(queries, "\n"), strings.Join(tt.queries, "\n"))
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("arguments = %q, want %q", args, tt.args)
+			}
+
+			data := readFile(t, filepath.Join(cfg.Output.Directory, rdfDataFiles(cfg)[0]))
+			if got := strings.Count(data, "<users.name>"); got != tt.wantWritten {
+				t.Errorf("wrote %d names, want %d", got, tt.wantWritten)
+			}
+		})
+	}
+}
+
+// generatedTable serves a users table of n rows with ids 1..n without
+// holding them. Like MySQL, an OFFSET page steps over every skipped row,
+// while a keyset page seeks straight to its first key.
+type generatedTable struct {
+	n       int64
+	scanned int64 // Rows stepped over by OFFSET pages
+}
+
+func (g *generatedTable) serve(query string, args []driver.NamedValue) (*fakeResult, error) {
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{g.n}}}, nil
+	}
+
+	var first, limit int64
+	switch {
+	case strings.HasSuffix(query, "OFFSET ?"):
+		limit, first = args[0].Value.(int64), args[1].Value.(int64)
+		for skipped := int64(0); skipped < first; skipped++ {
+			g.scanned++
+		}
+	case strings.Contains(query, " > ?"):
+		after, err := strconv.ParseInt(fmt.Sprint(args[0].Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		first, limit = after, args[1].Value.(int64)
+	default:
+		limit = args[0].Value.(int64)
+	}
+
+	result := &fakeResult{columns: []string{"id", "name"}}
+	for id := first + 1; id <= min(first+limit, g.n); id++ {
+		result.rows = append(result.rows, []driver.Value{id, "user"})
+	}
+	return result, nil
+}
+
+// BenchmarkPagination exports a 5M-row table paged by keyset and by OFFSET
+func BenchmarkPagination(b *testing.B) {
+	const rows = 5_000_000
+	for _, keyset := range []bool{true, false} {
+		name := "keyset"
+		if !keyset {
+			name = "offset"
+		}
+		b.Run(name, func(b *testing.B) {
+			cfg := testConfig(b)
+			cfg.Pipeline.BatchSize = 10000
+			schema := usersSchema(rows)
+			if !keyset {
+				schema.Tables["users"].PrimaryKeys = nil
+			}
+			table := &generatedTable{n: rows}
+			db, _ := newFakeDB(b, table.serve)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(table.scanned)/float64(b.N), "skipped-rows/op")
+		})
+	}
+}
+
+var partitionPattern = regexp.MustCompile("PARTITION \\(`([^`]+)`\\)")
+
+// partitionedHandler serves a table split into partitions: queries naming a
+// partition read its rows, other queries the rows of every partition
+func partitionedHandler(partitions map[string]*fakeTable) fakeHandler {
+	whole := &fakeTable{columns: []string{"id", "name"}}
+	for _, partition := range partitions {
+		whole.rows = append(whole.rows, partition.rows...)
+	}
+	slices.SortFunc(whole.rows, func(a, b []driver.Value) int { return int(a[0].(int64) - b[0].(int64)) })
+
+	return func(query string, args []driver.NamedValue) (*fakeResult, error) {
+		if match := partitionPattern.FindStringSubmatch(query); match != nil {
+			partition := partitions[match[1]]
+			if partition == nil {
+				return nil, fmt.Errorf("unknown partition %s", match[1])
+			}
+			return countingHandler(partition)(query, args)
+		}
+		return countingHandler(whole)(query, args)
+	}
+}
+
+func TestPartitionAwareJobs(t *testing.T) {
+	partitions := map[string]*fakeTable{
+		"p0":   {columns: []string{"id", "name"}},
+		"p1":   {columns: []string{"id", "name"}},
+		"pmax": {columns: []string{"id", "name"}},
+	}
+	for id := int64(1); id <= 7; id++ {
+		name := "p0"
+		if id > 3 {
+			name = "p1"
+		}
+		partitions[name].rows = append(partitions[name].rows, []driver.Value{id, "user" + strconv.FormatInt(id, 10)})
+	}
+
+	tests := []struct {
+		name           string
+		partitionAware bool
+		partitions     []string // Partitions read, in order of their first query
+	}{
+		{name: "one stream per partition", partitionAware: true, partitions: []string{"p0", "p1", "pmax"}},
+		{name: "partition_aware off reads the whole table", partitionAware: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.BatchSize = 2
+			cfg.Pipeline.PartitionAware = tt.partitionAware
+			schema := usersSchema(7)
+			schema.Tables["users"].Partitions = []Partition{{Name: "p0", RowCount: 3}, {Name: "p1", RowCount: 4}, {Name: "pmax"}}
+			db, fake := newFakeDB(t, partitionedHandler(partitions))
+
+			if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+
+			var read []string
+			for _, query := range fake.Queries() {
+				if match := partitionPattern.FindStringSubmatch(query); match != nil && !slices.Contains(read, match[1]) {
+					read = append(read, match[1])
+				}
+			}
+			if !slices.Equal(read, tt.partitions) {
+				t.Errorf("partitions read = %v, want %v", read, tt.partitions)
+			}
+
+			// Every row of every partition is written exactly once
+			data := readFile(t, filepath.Join(cfg.Output.Directory, rdfDataFiles(cfg)[0]))
+			for id := 1; id <= 7; id++ {
+				line := fmt.Sprintf("_:users_%d <users.name> \"user%d\" .", id, id)
+				if got := strings.Count(data, line); got != 1 {
+					t.Errorf("%s written %d times", line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidDatePolicy(t *testing.T) {
+	rows := [][]driver.Value{
+		{int64(1), "2024-03-01 12:30:00"},
+		{int64(2), "0000-00-00 00:00:00"},
+		{int64(3), "2023-02-30"},
+		{int64(4), "2024-03-02"},
+	}
+	valid := []string{
+		`_:events_1 <events.created> "2024-03-01T12:30:00Z"^^<xs:dateTime> .`,
+		`_:events_4 <events.created> "2024-03-02T00:00:00Z"^^<xs:dateTime> .`,
+	}
+	tests := []struct {
+		policy  string
+		want    []string // Triples of the invalid dates
+		skipped map[SkipReason]int64
+	}{
+		{policy: "skip", skipped: map[SkipReason]int64{SkipInvalidDate: 2}},
+		{policy: "null", skipped: map[SkipReason]int64{SkipNullValue: 2}},
+		{
+			policy: "epoch",
+			want: []string{
+				`_:events_2 <events.created> "1970-01-01T00:00:00Z"^^<xs:dateTime> .`,
+				`_:events_3 <events.created> "1970-01-01T00:00:00Z"^^<xs:dateTime> .`,
+			},
+		},
+		{
+			policy: "string",
+			want: []string{
+				`_:events_2 <events.created> "0000-00-00 00:00:00" .`,
+				`_:events_3 <events.created> "2023-02-30" .`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.InvalidDatePolicy = tt.policy
+			schema := fkSchema(map[string][]string{"events": nil}, nil)
+			schema.Tables["events"].Columns["created"] = &Column{Name: "created", Type: "datetime", ColumnType: "datetime"}
+			schema.Tables["events"].RowCount = int64(len(rows))
+			db, _ := newFakeDB(t, tablesHandler(map[string]*fakeTable{"events": {columns: []string{"id", "created"}, rows: rows}}))
+
+			processor := testProcessor(cfg)
+			if err := processor.ProcessTables(context.Background(), db, schema, []string{"events"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+			data := readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile))
+
+			// The invalid dates do not abort the batch: the rows after them are written
+			for _, line := range append(valid, tt.want...) {
+				if !strings.Contains(data, line+"\n") {
+					t.Errorf("output lacks %s", line)
+				}
+			}
+			if got := strings.Count(data, "<events.created>"); got != len(valid)+len(tt.want) {
+				t.Errorf("wrote %d dates, want %d", got, len(valid)+len(tt.want))
+			}
+			for _, reason := range []SkipReason{SkipInvalidDate, SkipNullValue} {
+				if got := processor.SkipStats().Count("events", reason); got != tt.skipped[reason] {
+					t.Errorf("skipped %d values as %s, want %d", got, reason, tt.skipped[reason])
+				}
+			}
+		})
+	}
+}
+func TestShards(t *testing.T) {
+	schema := func() *Schema {
+		return fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+	}
+	tables := func() map[string]*fakeTable {
+		users := &fakeTable{columns: []string{"id"}}
+		for i := 1; i <= 500; i++ {
+			users.rows = append(users.rows, []driver.Value{int64(i)})
+		}
+		orders := &fakeTable{columns: []string{"id", "user_id"}}
+		for i := 1; i <= 1500; i++ {
+			orders.rows = append(orders.rows, []driver.Value{int64(i), int64(i%500 + 1)})
+		}
+		return map[string]*fakeTable{"users": users, "orders": orders}
+	}
+	unsharded := processRDF(t, testConfig(t), schema(), tables())
+	slices.Sort(unsharded)
+
+	for _, shards := range []int{2, 4, 7} {
+		t.Run(strconv.Itoa(shards)+" shards", func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.Shards = shards
+			processRDF(t, cfg, schema(), tables())
+
+			files := rdfDataFiles(cfg)
+			if len(files) != shards {
+				t.Fatalf("shard files = %v, want %d", files, shards)
+			}
+			shardOf := make(map[string]int) // subject -> shard holding its triples
+			var all []string
+			for i, name := range files {
+				if want := fmt.Sprintf("data_shard_%d.rdf", i); name != want {
+					t.Errorf("shard %d is %s, want %s", i, name, want)
+				}
+				subjects := make(map[string]bool)
+				for _, line := range strings.Split(strings.TrimSpace(readFile(t, filepath.Join(cfg.Output.Directory, name))), "\n") {
+					subject, _, _ := strings.Cut(line, " ")
+					if shard, ok := shardOf[subject]; ok && shard != i {
+						t.Errorf("%s has triples in shards %d and %d", subject, shard, i)
+					}
+					shardOf[subject] = i
+					subjects[subject] = true
+					all = append(all, line)
+				}
+				// 2000 nodes spread evenly put 2000/shards in each
+				mean := 2000 / float64(shards)
+				if n := float64(len(subjects)); n < mean*0.75 || n > mean*1.25 {
+					t.Errorf("shard %d has %d nodes, want about %.0f", i, len(subjects), mean)
+				}
+			}
+			slices.Sort(all)
+			if !slices.Equal(all, unsharded) {
+				t.Errorf("shards hold %d triples, unsharded output %d; want the same triples once each", len(all), len(unsharded))
+			}
+		})
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 7} {
+		for _, subject := range []string{"_:users_1", "_:orders_42", "<0x1f>"} {
+			got := shardIndex(subject, n)
+			if got < 0 || got >= n {
+				t.Errorf("shardIndex(%s, %d) = %d, out of range", subject, n, got)
+			}
+			if again := shardIndex(subject, n); again != got {
+				t.Errorf("shardIndex(%s, %d) = %d, then %d", subject, n, got, again)
+			}
+		}
+	}
+}
+
+func TestMakeUID(t *testing.T) {
+	tests := []struct {
+		namespace, table, id string
+		want                 string
+	}{
+		{"", "users", "1", "_:users_1"},
+		{"shop", "users", "1", "_:shop_users_1"},
+		{"", "users", "ada@example.com", "_:users_ada.40example.2Ecom"},
+		{"", "order_items", "3_7", "_:order_items_3_7"},
+		{"", "order items", "1", "_:order.20items_1"},
+		{"", "shop.users", "1", "_:shop.users_1"},
+		{"crm", "shop.order items", "1", "_:crm_shop.order.20items_1"},
+	}
+	for _, tt := range tests {
+		if got := makeUID(tt.namespace, tt.table, tt.id); got != tt.want {
+			t.Errorf("makeUID(%q, %q, %q) = %s, want %s", tt.namespace, tt.table, tt.id, got, tt.want)
+		}
+	}
+}
+
+// nodePattern matches the blank nodes and UIDs Dgraph accepts as subject or
+// object of a triple
+var nodePattern = regexp.MustCompile(`^(_:[A-Za-z0-9_.-]+|<0x[0-9a-f]+>)$`)
+
+// TestGeneratedNodes parses exported RDF and checks every subject, and every
+// object that is not a literal, is a valid blank node or UID
+func TestGeneratedNodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *config.Config)
+	}{
+		{name: "defaults", change: func(c *config.Config) {}},
+		{name: "uid namespace", change: func(c *config.Config) { c.Output.UIDNamespace = "shop" }},
+		{name: "business keys", change: func(c *config.Config) { c.Output.KeyColumns = map[string][]string{"users": {"email"}} }},
+		{name: "shards", change: func(c *config.Config) { c.Output.Shards = 3 }},
+		{name: "xid", change: func(c *config.Config) { c.Output.EmitXID = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			tt.change(cfg)
+			schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+			schema.Tables["users"].Columns["email"] = &Column{Name: "email", Type: "varchar", ColumnType: "varchar(100)"}
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+				"users": {columns: []string{"id", "email"}, rows: [][]driver.Value{
+					{int64(1), "ada@example.com"},
+					{int64(2), "grace hopper@example.com"},
+				}},
+				"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+					{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(1)},
+				}},
+			})
+			if len(lines) == 0 {
+				t.Fatal("no RDF written")
+			}
+			for _, line := range lines {
+				subject, rest, _ := strings.Cut(line, " ")
+				if !nodePattern.MatchString(subject) {
+					t.Errorf("subject %s is not a blank node or UID: %s", subject, line)
+				}
+				_, object, _ := strings.Cut(rest, " ")
+				object = strings.TrimSuffix(object, " .")
+				if !strings.HasPrefix(object, `"`) && !nodePattern.MatchString(object) {
+					t.Errorf("object %s is not a literal, blank node or UID: %s", object, line)
+				}
+			}
+		})
+	}
+}
+
+// TestTotalRows checks the progress total comes from the row counts taken
+// during schema extraction, or from information_schema's estimates with
+// pipeline.use_approximate_counts, without counting any table again
+func TestTotalRows(t *testing.T) {
+	tests := []struct {
+		name        string
+		approximate bool
+		want        int64
+	}{
+		{name: "extracted counts", want: 5},
+		{name: "approximate counts", approximate: true, want: 1200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			cfg.Pipeline.UseApproximateCounts = tt.approximate
+
+			tables := tablesHandler(map[string]*fakeTable{"users": usersTable(3), "groups": usersTable(2)})
+			db, fake := newFakeDB(t, func(query string, args []driver.NamedValue) (*fakeResult, error) {
+				if strings.Contains(query, "information_schema.tables") {
+					if len(args) != 1 || args[0].Value != "shop" {
+						return nil, fmt.Errorf("estimates asked for %v", args)
+					}
+					return &fakeResult{columns: []string{"table_schema", "table_name", "table_rows"}, rows: [][]driver.Value{
+						{"shop", "users", int64(1000)}, {"shop", "groups", int64(200)}, {"shop", "other", int64(50)},
+					}}, nil
+				}
+				return tables(query, args)
+			})
+			schema := usersSchema(3)
+			groups := *schema.Tables["users"]
+			groups.Name, groups.RowCount = "groups", 2
+			schema.Tables["groups"] = &groups
+
+			progress := &ProgressTracker{}
+			processor := NewDataProcessor(cfg, logger.New("error", "text"), progress, nil)
+			if err := processor.ProcessTables(context.Background(), db, schema, []string{"groups", "users"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+			if progress.TotalRows != tt.want {
+				t.Errorf("TotalRows = %d, want %d", progress.TotalRows, tt.want)
+			}
+			if progress.ProcessedRows != 5 {
+				t.Errorf("ProcessedRows = %d, want 5", progress.ProcessedRows)
+			}
+			for _, query := range fake.Queries() {
+				if strings.HasPrefix(query, "SELECT COUNT(*)") {
+					t.Errorf("table counted again: %s", query)
+				}
+			}
+		})
+	}
+}
+
+// TestNullAndEmptyValues checks only SQL NULLs are skipped: empty strings and
+// the text "null" are written as values
+func TestNullAndEmptyValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		nickname driver.Value
+		groupID  driver.Value
+		want     []string // Triples besides the id and type
+		skipped  map[SkipReason]int64
+	}{
+		{name: "NULL", nickname: nil, groupID: nil, skipped: map[SkipReason]int64{SkipNullValue: 2}},
+		// The MySQL driver returns text as []byte; database/sql may scan an
+		// empty string into nil RawBytes
+		{name: "empty string", nickname: []byte{}, groupID: []byte{}, want: []string{`_:users_1 <users.nickname> "" .`},
+			skipped: map[SkipReason]int64{SkipEmptyString: 1}},
+		{name: "text null", nickname: "null", groupID: int64(7), want: []string{
+			`_:users_1 <users.group_id> _:groups_7 .`,
+			`_:users_1 <users.nickname> "null" .`,
+		}},
+		{name: "text NULL", nickname: "NULL", want: []string{`_:users_1 <users.nickname> "NULL" .`},
+			skipped: map[SkipReason]int64{SkipNullValue: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.ReverseEdges = "directive"
+			schema := fkSchema(map[string][]string{"groups": nil, "users": {"group_id"}}, [][3]string{{"users", "group_id", "groups"}})
+			schema.Tables["users"].Columns["nickname"] = &Column{Name: "nickname", Type: "varchar", ColumnType: "varchar(50)"}
+
+			db, _ := newFakeDB(t, tablesHandler(map[string]*fakeTable{"users": {
+				columns: []string{"id", "nickname", "group_id"},
+				rows:    [][]driver.Value{{int64(1), tt.nickname, tt.groupID}},
+			}}))
+			schema.Tables["users"].RowCount = 1
+			processor := testProcessor(cfg)
+			if err := processor.ProcessTables(context.Background(), db, schema, []string{"users"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile))), "\n") {
+				if !strings.Contains(line, "<users.id>") && !strings.Contains(line, "<dgraph.type>") {
+					got = append(got, line)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("triples:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for _, reason := range []SkipReason{SkipNullValue, SkipEmptyString} {
+				if got := processor.SkipStats().Count("users", reason); got != tt.skipped[reason] {
+					t.Errorf("skipped %d values as %s, want %d", got, reason, tt.skipped[reason])
+				}
+			}
+		})
+	}
+}
+
+// failingWriter accepts limit bytes, then fails every write
+type failingWriter struct {
+	limit   int
+	written strings.Builder
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written.Len()+len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	return w.written.Write(p)
+}
+
+func TestWriteRDFLinesErrors(t *testing.T) {
+	lines := []string{`_:users_1 <users.name> "Ada" .`, `_:users_2 <users.name> "Grace" .`}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dp *DataProcessor) *bufio.Writer
+		fails bool
+	}{
+		{name: "rdf", setup: func(t *testing.T, dp *DataProcessor) *bufio.Writer {
+			return bufio.NewWriterSize(&failingWriter{limit: 1 << 20}, 16)
+		}},
+		{name: "rdf write fails", fails: true, setup: func(t *testing.T, dp *DataProcessor) *bufio.Writer {
+			return bufio.NewWriterSize(&failingWriter{}, 16)
+		}},
+		{name: "json batch fails", fails: true, setup: func(t *testing.T, dp *DataProcessor) *bufio.Writer {
+			dp.jsonBatches = NewJSONBatchWriter(filepath.Join(t.TempDir(), "missing"), 1)
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := testProcessor(testConfig(t))
+			err := dp.writeRDFLines(context.Background(), tt.setup(t, dp), lines)
+			if tt.fails != errors.Is(err, errOutputWrite) {
+				t.Errorf("writeRDFLines = %v, want an output write error: %v", err, tt.fails)
+			}
+		})
+	}
+}
+
+// TestCollectResultsReturnsWriteErrors checks a failed write is returned
+// once all results are recorded, while failed reads are only counted
+func TestCollectResultsReturnsWriteErrors(t *testing.T) {
+	writeErr := fmt.Errorf("%w: failed to write part file: disk full", errOutputWrite)
+	tests := []struct {
+		name    string
+		results []ProcessingResult
+		errText string
+	}{
+		{name: "success", results: []ProcessingResult{{TableName: "users"}, {TableName: "groups"}}},
+		{name: "read failure", results: []ProcessingResult{{TableName: "users", Error: errors.New("connection reset")}}},
+		{name: "write failure", errText: "table groups: output write failed", results: []ProcessingResult{
+			{TableName: "users", Error: errors.New("connection reset")},
+			{TableName: "groups", Error: writeErr},
+			{TableName: "orders", Error: fmt.Errorf("%w: second", errOutputWrite)},
+			{TableName: "items"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := testProcessor(testConfig(t))
+			results := make(chan ProcessingResult, len(tt.results))
+			var failed int64
+			for _, result := range tt.results {
+				results <- result
+				if result.Error != nil {
+					failed++
+				}
+			}
+			close(results)
+
+			err := dp.collectResults(results)
+			if tt.errText == "" && err != nil || tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Errorf("collectResults = %v, want %q", err, tt.errText)
+			}
+			if len(dp.results) != len(tt.results) || dp.progress.ErrorCount != failed {
+				t.Errorf("recorded %d results and %d errors, want %d and %d", len(dp.results), dp.progress.ErrorCount, len(tt.results), failed)
+			}
+		})
+	}
+}
+
+// TestUIDNamespaceCollision checks a namespace ending where a table name
+// would otherwise continue gets labels of its own
+func TestUIDNamespaceCollision(t *testing.T) {
+	first := makeUID("prod", "eu_users", "1")
+	second := makeUID("prod_eu", "users", "1")
+	if first == second {
+		t.Fatalf("namespace prod, table eu_users and namespace prod_eu, table users share %s", first)
+	}
+	if first != "_:prod_eu_users_1" || second != "_:prod.5Feu_users_1" {
+		t.Errorf("labels = %s and %s, want _:prod_eu_users_1 and _:prod.5Feu_users_1", first, second)
+	}
+}
+
+// TestUIDNamespace checks output.uid_namespace prefixes every blank node of
+// an export, the UID mapping and the xids, and that observed relationships
+// still resolve to their tables
+func TestUIDNamespace(t *testing.T) {
+	tests := []struct {
+		namespace, prefix, xidPrefix string
+	}{
+		{"", "_:", ""},
+		{"shop", "_:shop_", "shop:"},
+		{"crm-eu", "_:crm-eu_", "crm-eu:"},
+		{"shop_eu", "_:shop.5Feu_", "shop_eu:"},
+	}
+	for _, tt := range tests {
+		namespace, prefix, xidPrefix := tt.namespace, tt.prefix, tt.xidPrefix
+		t.Run("namespace "+namespace, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.UIDNamespace = namespace
+			cfg.Output.EmitXID = true
+
+			schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+			lines := processRDF(t, cfg, schema, map[string]*fakeTable{
+				"users": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}},
+				"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+					{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(1)},
+				}},
+			})
+			nodes := 0
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				for _, term := range []string{fields[0], fields[2]} {
+					if !strings.HasPrefix(term, "_:") {
+						continue
+					}
+					nodes++
+					if !strings.HasPrefix(term, prefix+"users_") && !strings.HasPrefix(term, prefix+"orders_") {
+						t.Errorf("blank node %s lacks the %q prefix: %s", term, prefix, line)
+					}
+				}
+				if match := literalPattern.FindStringSubmatch(line); match != nil && match[2] == xidPredicate &&
+					!strings.HasPrefix(match[3], xidPrefix+"users:") && !strings.HasPrefix(match[3], xidPrefix+"orders:") {
+					t.Errorf("xid %q of %s lacks the %q prefix", match[3], match[1], xidPrefix)
+				}
+			}
+			if nodes == 0 {
+				t.Fatal("no blank nodes written")
+			}
+
+			mapping, err := LoadUIDMapping(filepath.Join(cfg.Output.Directory, cfg.Output.MappingFile), cfg.Output.MappingFormat)
+			if err != nil {
+				t.Fatalf("LoadUIDMapping: %v", err)
+			}
+			// The referenced users
+			if len(mapping) != 2 {
+				t.Errorf("mapping has %d entries, want 2", len(mapping))
+			}
+			for key, uid := range mapping {
+				if !strings.HasPrefix(uid, prefix) {
+					t.Errorf("mapping %s = %s lacks the %q prefix", key, uid, prefix)
+				}
+			}
+
+			observed, err := observeRDFRelationships([]string{filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)}, schema, nil, namespace)
+			if err != nil {
+				t.Fatalf("observeRDFRelationships: %v", err)
+			}
+			found := false
+			for _, usage := range observed {
+				if usage.TableName == "orders" && usage.ColumnName == "user_id" && usage.RefTableName == "users" {
+					found = usage.Edges == 3
+				}
+			}
+			if !found {
+				t.Errorf("observed %+v, want 3 orders.user_id -> users edges", observed)
+			}
+		})
+	}
+}
+
+// TestEmitXID checks every node gets exactly one xid triple holding its
+// table and business key, and that the schema declares xid for upserts
+func TestEmitXID(t *testing.T) {
+	tests := []struct {
+		name      string
+		emit      bool
+		namespace string
+		keys      map[string][]string // output.key_columns
+		want      map[string]string   // node -> xid
+	}{
+		{name: "disabled"},
+		{
+			name: "primary keys",
+			emit: true,
+			want: map[string]string{
+				"_:users_1": "users:1", "_:users_2": "users:2",
+				"_:orders_1": "orders:1", "_:orders_2": "orders:2",
+			},
+		},
+		{
+			name: "business keys",
+			emit: true,
+			keys: map[string][]string{"users": {"email"}},
+			want: map[string]string{
+				"_:users_ada.40example.2Ecom": "users:ada@example.com", "_:users_bob.40example.2Ecom": "users:bob@example.com",
+				"_:orders_1": "orders:1", "_:orders_2": "orders:2",
+			},
+		},
+		{
+			name:      "namespace",
+			emit:      true,
+			namespace: "shop",
+			want: map[string]string{
+				"_:shop_users_1": "shop:users:1", "_:shop_users_2": "shop:users:2",
+				"_:shop_orders_1": "shop:orders:1", "_:shop_orders_2": "shop:orders:2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.EmitXID = tt.emit
+			cfg.Output.UIDNamespace = tt.namespace
+			cfg.Output.KeyColumns = tt.keys
+			schema := func() *Schema {
+				s := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+				s.Tables["users"].Columns["email"] = &Column{Name: "email", Type: "varchar", ColumnType: "varchar(100)"}
+				return s
+			}
+			lines := processRDF(t, cfg, schema(), map[string]*fakeTable{
+				"users": {columns: []string{"id", "email"}, rows: [][]driver.Value{
+					{int64(1), "ada@example.com"}, {int64(2), "bob@example.com"},
+				}},
+				"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(1), int64(1)}, {int64(2), int64(2)}}},
+			})
+
+			xids := make(map[string][]string)
+			nodes := 0
+			for _, line := range lines {
+				match := literalPattern.FindStringSubmatch(line)
+				switch {
+				case match == nil:
+				case match[2] == "dgraph.type":
+					nodes++
+				case match[2] == xidPredicate:
+					xids[match[1]] = append(xids[match[1]], match[3])
+				}
+			}
+			if !tt.emit {
+				if len(xids) > 0 {
+					t.Errorf("xids written while disabled: %v", xids)
+				}
+			} else if nodes != len(tt.want) || len(xids) != len(tt.want) {
+				t.Errorf("%d nodes with xids %v, want %v", nodes, xids, tt.want)
+			}
+			for node, want := range tt.want {
+				if got := xids[node]; len(got) != 1 || got[0] != want {
+					t.Errorf("%s xids = %v, want [%s]", node, got, want)
+				}
+			}
+
+			generator := NewSchemaGenerator(cfg, logger.New("error", "text"))
+			predicates, types, err := generator.build(schema())
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			rendered, err := generator.renderSchema(predicates, types)
+			if err != nil {
+				t.Fatalf("renderSchema: %v", err)
+			}
+			if declared := strings.Contains(string(rendered), "\nxid: string @index(exact) @upsert .\n"); declared != tt.emit {
+				t.Fatalf("xid declared: %v, want %v\n%s", declared, tt.emit, rendered)
+			}
+			if tt.emit {
+				for typeName, fields := range types {
+					if !slices.Contains(fields, xidPredicate) {
+						t.Errorf("type %s lacks xid: %v", typeName, fields)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestJSONUpsertBatches exports orders referencing users as upsert block
+// batches of several sizes and checks every edge is matched by the xid of the
+// node it points at, even when that node's row is in another batch
+func TestJSONUpsertBatches(t *testing.T) {
+	varPattern := regexp.MustCompile(`(v\d+) as var\(func: eq\(xid, "([^"]*)"\)\)`)
+	for _, batchSize := range []int{1, 2, 100} {
+		t.Run(strconv.Itoa(batchSize), func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.Format = "json"
+			cfg.Output.EmitXID = true
+			cfg.Output.JSONUpsert = true
+			cfg.Output.JSONBatchSize = batchSize
+			schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+			schema.Tables["users"].RowCount, schema.Tables["orders"].RowCount = 2, 2
+			db, _ := newFakeDB(t, tablesHandler(map[string]*fakeTable{
+				"users":  {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}},
+				"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(1), int64(2)}, {int64(2), int64(1)}}},
+			}))
+			if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{"users", "orders"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+
+			names, err := filepath.Glob(filepath.Join(cfg.Output.Directory, "batch_*.json"))
+			if err != nil || len(names) == 0 {
+				t.Fatalf("no batches written: %v", err)
+			}
+			links := make(map[string]string) // Order xid -> user xid
+			for _, name := range names {
+				var batch struct {
+					Query string                   `json:"query"`
+					Set   []map[string]interface{} `json:"set"`
+				}
+				if err := json.Unmarshal([]byte(readFile(t, name)), &batch); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				vars := make(map[string]string)
+				for _, match := range varPattern.FindAllStringSubmatch(batch.Query, -1) {
+					vars["uid("+match[1]+")"] = match[2]
+				}
+				for _, node := range batch.Set {
+					if xid := vars[node["uid"].(string)]; xid == "" || node[xidPredicate] != xid {
+						t.Errorf("%s: node %v not matched by its xid", name, node)
+					}
+					for predicate, value := range node {
+						edges, _ := value.([]interface{})
+						if edge, ok := value.(map[string]interface{}); ok {
+							edges = append(edges, edge)
+						}
+						for _, edge := range edges {
+							target := vars[edge.(map[string]interface{})["uid"].(string)]
+							if target == "" {
+								t.Errorf("%s: %s edge %v not matched by an xid", name, predicate, edge)
+							}
+							if predicate == "orders.user_id" {
+								links[node[xidPredicate].(string)] = target
+							}
+						}
+					}
+				}
+			}
+			if want := map[string]string{"orders:1": "users:2", "orders:2": "users:1"}; !reflect.DeepEqual(links, want) {
+				t.Errorf("links %v, want %v", links, want)
+			}
+		})
+	}
+}
+
+// TestCompressedOutput exports with and without output.compression and checks
+// the gzipped data files decompress to exactly the plain ones
+func TestCompressedOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+	}{
+		{name: "one file"},
+		{name: "chunks", change: func(c *config.Config) { c.Output.ChunkSize, c.Pipeline.BatchSize = 2, 1 }},
+		{name: "split by table", change: func(c *config.Config) { c.Output.SplitByTable = true }},
+		{name: "json batches", change: func(c *config.Config) { c.Output.Format, c.Pipeline.BatchSize = "json", 2 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := func(compression string) (string, []string) {
+				cfg := testConfig(t)
+				cfg.Pipeline.SkipValidation = true
+				cfg.Output.Compression = compression
+				if tt.change != nil {
+					tt.change(cfg)
+				}
+				runPipeline(t, cfg, shopSchema(), ModeData, RunOptions{})
+				entries, err := os.ReadDir(cfg.Output.Directory)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var names []string
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				return cfg.Output.Directory, names
+			}
+			plainDir, plain := export(compress.None)
+			gzipDir, gzipped := export(compress.Gzip)
+
+			compressed := 0
+			for _, name := range gzipped {
+				if compress.ForPath(name) == compress.None {
+					continue
+				}
+				compressed++
+				plainName := compress.TrimExtension(name)
+				if !slices.Contains(plain, plainName) {
+					t.Errorf("%s has no plain counterpart in %v", name, plain)
+					continue
+				}
+				file, err := compress.Open(filepath.Join(gzipDir, name))
+				if err != nil {
+					t.Fatalf("open %s: %v", name, err)
+				}
+				data, err := io.ReadAll(file)
+				file.Close()
+				if err != nil {
+					t.Fatalf("read %s: %v", name, err)
+				}
+				if want := readFile(t, filepath.Join(plainDir, plainName)); string(data) != want {
+					t.Errorf("%s decompresses to\n%s\nwant\n%s", name, data, want)
+				}
+			}
+			if compressed == 0 || len(gzipped) != len(plain) {
+				t.Errorf("gzip export wrote %v, plain export %v", gzipped, plain)
+			}
+		})
+	}
+}
+
+// TestSplitByTable checks output.split_by_table writes one file per table
+// with rows, that edges use the same node labels across files, and that
+// validation reads every file
+func TestSplitByTable(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		dangling    bool // Keep the order referencing a missing user
+		files       []string
+		errText     string
+	}{
+		{name: "one file per table", files: []string{"data_orders.rdf", "data_users.rdf"}},
+		{name: "gzip", compression: compress.Gzip, files: []string{"data_orders.rdf.gz", "data_users.rdf.gz"}},
+		{name: "dangling reference across files", dangling: true, errText: "data validation failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			cfg.Output.SplitByTable = true
+			if tt.compression != "" {
+				cfg.Output.Compression = tt.compression
+			}
+			info := shopSchema()
+			info.columns["tags"] = []fakeColumn{{name: "id", dataType: "int", columnType: "int"}}
+			info.primaryKeys["tags"] = []string{"id"}
+			info.rows["tags"] = &fakeTable{columns: []string{"id"}}
+			if !tt.dangling {
+				info.rows["orders"].rows = info.rows["orders"].rows[:2]
+			}
+			// A file left by an earlier run is not read as part of this one
+			writeFile(t, filepath.Join(cfg.Output.Directory, "data_old.rdf"), "_:old_1 <old.id> \"1\" .\n")
+
+			db, _ := newFakeDB(t, info.serve)
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+			_, err = p.Run(context.Background(), ModeFull, RunOptions{})
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("Run error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if files := TableFiles(cfg); !slices.Equal(files, tt.files) {
+				t.Fatalf("table files %v, want %v", files, tt.files)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)); !os.IsNotExist(err) {
+				t.Errorf("%s written alongside the table files: %v", cfg.Output.RDFFile, err)
+			}
+
+			// Node labels by table, from the subjects of every file
+			nodes := make(map[string][]string)
+			var edges []string
+			for _, name := range tt.files {
+				file, err := compress.Open(filepath.Join(cfg.Output.Directory, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				scanner := bufio.NewScanner(file)
+				for scanner.Scan() {
+					fields := strings.Fields(scanner.Text())
+					if len(fields) < 3 || !strings.HasPrefix(fields[0], "_:") {
+						continue
+					}
+					table, _, _ := strings.Cut(strings.TrimPrefix(name, "data_"), ".")
+					if strings.HasPrefix(fields[0], "_:"+table+"_") && !slices.Contains(nodes[table], fields[0]) {
+						nodes[table] = append(nodes[table], fields[0])
+					}
+					if strings.HasPrefix(fields[2], "_:") {
+						edges = append(edges, fields[2])
+					}
+				}
+				file.Close()
+			}
+			orders, users := nodes["orders"], nodes["users"]
+			if len(orders) != 2 || len(users) != 2 {
+				t.Errorf("orders file holds orders %v, users file users %v", orders, users)
+			}
+			for _, target := range edges {
+				if !slices.Contains(users, target) && !slices.Contains(orders, target) {
+					t.Errorf("edge to %s, which no table file defines", target)
+				}
+			}
+			if len(edges) == 0 {
+				t.Error("no edges between the table files")
+			}
+		})
+	}
+}
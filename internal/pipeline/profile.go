@@ -0,0 +1,220 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profiler accumulates per-predicate statistics while rows are exported:
+// value and NULL counts, min/max for numbers and datetimes, and an estimate
+// of distinct values
+type Profiler struct {
+	mu         sync.Mutex
+	predicates map[string]*predicateProfile
+}
+
+type predicateProfile struct {
+	dgraphType string
+	count      int64 // Values seen, including NULLs
+	nulls      int64
+
+	min, max         float64
+	hasNumber        bool
+	minTime, maxTime time.Time
+	hasTime          bool
+
+	distinct *hyperLogLog
+}
+
+// PredicateProfile is the summary written to the profile file
+type PredicateProfile struct {
+	Type     string   `json:"type"`
+	Count    int64    `json:"count"`
+	Nulls    int64    `json:"nulls"`
+	NullRate float64  `json:"null_rate"`
+	Distinct uint64   `json:"distinct_estimate"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	MinTime  string   `json:"min_time,omitempty"`
+	MaxTime  string   `json:"max_time,omitempty"`
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		predicates: make(map[string]*predicateProfile),
+	}
+}
+
+// Observe records one value of a predicate. A nil raw value is a NULL.
+func (p *Profiler) Observe(predicate, dgraphType string, raw []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prof := p.predicates[predicate]
+	if prof == nil {
+		prof = &predicateProfile{
+			dgraphType: dgraphType,
+			distinct:   newHyperLogLog(),
+		}
+		p.predicates[predicate] = prof
+	}
+
+	prof.count++
+	if raw == nil {
+		prof.nulls++
+		return
+	}
+
+	prof.distinct.Add(raw)
+
+	switch dgraphType {
+	case "int", "float":
+		n, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+		if err != nil {
+			return
+		}
+		if !prof.hasNumber || n < prof.min {
+			prof.min = n
+		}
+		if !prof.hasNumber || n > prof.max {
+			prof.max = n
+		}
+		prof.hasNumber = true
+	case "datetime":
+		t, ok := parseDatetime(string(raw))
+		if !ok {
+			return
+		}
+		if !prof.hasTime || t.Before(prof.minTime) {
+			prof.minTime = t
+		}
+		if !prof.hasTime || t.After(prof.maxTime) {
+			prof.maxTime = t
+		}
+		prof.hasTime = true
+	}
+}
+
+// Snapshot returns the summaries keyed by predicate
+func (p *Profiler) Snapshot() map[string]PredicateProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make(map[string]PredicateProfile, len(p.predicates))
+	for predicate, prof := range p.predicates {
+		summary := PredicateProfile{
+			Type:     prof.dgraphType,
+			Count:    prof.count,
+			Nulls:    prof.nulls,
+			Distinct: prof.distinct.Estimate(),
+		}
+		if prof.count > 0 {
+			summary.NullRate = float64(prof.nulls) / float64(prof.count)
+		}
+		if prof.hasNumber {
+			min, max := prof.min, prof.max
+			summary.Min = &min
+			summary.Max = &max
+		}
+		if prof.hasTime {
+			summary.MinTime = prof.minTime.Format(time.RFC3339Nano)
+			summary.MaxTime = prof.maxTime.Format(time.RFC3339Nano)
+		}
+		result[predicate] = summary
+	}
+	return result
+}
+
+// Write saves the summaries as JSON
+func (p *Profiler) Write(path string) error {
+	data, err := json.MarshalIndent(p.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// parseDatetime parses the text forms MySQL returns for date and time columns
+func parseDatetime(text string) (time.Time, bool) {
+	return parseDatetimeIn(text, time.UTC)
+}
+
+// parseDatetimeIn parses like parseDatetime, reading values without an offset
+// in loc
+func parseDatetimeIn(text string, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	text = strings.TrimSpace(text)
+	for _, layout := range datetimeLayouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hyperLogLog estimates the number of distinct values in a stream using
+// 2^hllPrecision one-byte registers
+type hyperLogLog struct {
+	registers []uint8
+}
+
+const hllPrecision = 12
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Add records a value
+func (h *hyperLogLog) Add(value []byte) {
+	hasher := fnv.New64a()
+	hasher.Write(value)
+	x := mix64(hasher.Sum64())
+
+	index := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Estimate returns the approximate number of distinct values added
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha * m * m / sum
+
+	// Linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits vary too little for
+// register selection on short inputs
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			h := newHyperLogLog()
+			for i := 0; i < n; i++ {
+				// Every value twice: duplicates do not count
+				h.Add([]byte("value" + strconv.Itoa(i)))
+				h.Add([]byte("value" + strconv.Itoa(i)))
+			}
+			got := h.Estimate()
+			// 2^12 registers give a standard error of about 1.6%
+			if diff := math.Abs(float64(got) - float64(n)); diff > math.Max(1, 0.05*float64(n)) {
+				t.Errorf("Estimate = %d, want %d within 5%%", got, n)
+			}
+		})
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	p := NewProfiler()
+	for i := 1; i <= 5000; i++ {
+		p.Observe("orders.amount", "float", []byte(fmt.Sprintf("%d.25", i%1000-100)))
+		p.Observe("orders.status", "string", []byte([]string{"new", "paid", "shipped"}[i%3]))
+		if i%4 == 0 {
+			p.Observe("orders.note", "string", nil)
+		} else {
+			p.Observe("orders.note", "string", []byte("note "+strconv.Itoa(i)))
+		}
+	}
+	p.Observe("orders.created", "datetime", []byte("2024-03-01 12:00:00"))
+	p.Observe("orders.created", "datetime", []byte("2021-01-31"))
+	p.Observe("orders.created", "datetime", []byte("2023-07-15 08:30:00.5"))
+	p.Observe("orders.created", "datetime", []byte("0000-00-00"))
+	p.Observe("orders.quantity", "int", []byte("not a number"))
+
+	tests := []struct {
+		predicate string
+		want      PredicateProfile
+		tolerance float64 // Relative error allowed in the distinct estimate
+	}{
+		{
+			predicate: "orders.amount",
+			want:      PredicateProfile{Type: "float", Count: 5000, Distinct: 1000, Min: ptr(-100.25), Max: ptr(899.25)},
+			tolerance: 0.05,
+		},
+		{
+			predicate: "orders.status",
+			want:      PredicateProfile{Type: "string", Count: 5000, Distinct: 3},
+		},
+		{
+			predicate: "orders.note",
+			want:      PredicateProfile{Type: "string", Count: 5000, Nulls: 1250, NullRate: 0.25, Distinct: 3750},
+			tolerance: 0.05,
+		},
+		{
+			predicate: "orders.created",
+			want: PredicateProfile{Type: "datetime", Count: 4, Distinct: 4,
+				MinTime: "2021-01-31T00:00:00Z", MaxTime: "2024-03-01T12:00:00Z"},
+		},
+		{
+			predicate: "orders.quantity",
+			want:      PredicateProfile{Type: "int", Count: 1, Distinct: 1},
+		},
+	}
+	snapshot := p.Snapshot()
+	for _, tt := range tests {
+		t.Run(tt.predicate, func(t *testing.T) {
+			got, ok := snapshot[tt.predicate]
+			if !ok {
+				t.Fatal("not profiled")
+			}
+			if diff := math.Abs(float64(got.Distinct) - float64(tt.want.Distinct)); diff > tt.tolerance*float64(tt.want.Distinct) {
+				t.Errorf("distinct estimate = %d, want %d", got.Distinct, tt.want.Distinct)
+			}
+			got.Distinct = tt.want.Distinct
+			if got.Type != tt.want.Type || got.Count != tt.want.Count || got.Nulls != tt.want.Nulls || got.NullRate != tt.want.NullRate ||
+				got.MinTime != tt.want.MinTime || got.MaxTime != tt.want.MaxTime {
+				t.Errorf("profile = %+v, want %+v", got, tt.want)
+			}
+			if !sameBound(got.Min, tt.want.Min) || !sameBound(got.Max, tt.want.Max) {
+				t.Errorf("min, max = %v, %v; want %v, %v", deref(got.Min), deref(got.Max), deref(tt.want.Min), deref(tt.want.Max))
+			}
+		})
+	}
+}
+
+// TestProfileFile exports a table with pipeline.profile and reads the
+// profile file it writes
+func TestProfileFile(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.Profile = true
+	schema := fkSchema(map[string][]string{"users": {"age"}}, nil)
+	schema.Tables["users"].Columns["born"] = &Column{Name: "born", Type: "date", ColumnType: "date"}
+	processRDF(t, cfg, schema, map[string]*fakeTable{
+		"users": {columns: []string{"id", "age", "born"}, rows: [][]driver.Value{
+			{int64(1), int64(36), "1988-05-01"},
+			{int64(2), nil, "1990-01-01"},
+			{int64(3), int64(19), nil},
+			{int64(4), int64(61), "1963-11-22"},
+		}},
+	})
+
+	var profiles map[string]PredicateProfile
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.ProfileFile))), &profiles); err != nil {
+		t.Fatal(err)
+	}
+	age, born := profiles["users.age"], profiles["users.born"]
+	if age.Count != 4 || age.Nulls != 1 || deref(age.Min) != 19 || deref(age.Max) != 61 || age.Distinct != 3 {
+		t.Errorf("users.age = %+v, want 4 values, 1 NULL, 3 distinct from 19 to 61", age)
+	}
+	if born.Count != 4 || born.Nulls != 1 || born.MinTime != "1963-11-22T00:00:00Z" || born.MaxTime != "1990-01-01T00:00:00Z" {
+		t.Errorf("users.born = %+v, want 4 values, 1 NULL, from 1963-11-22 to 1990-01-01", born)
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+func deref(f *float64) float64 {
+	if f == nil {
+		return math.NaN()
+	}
+	return *f
+}
+
+func sameBound(a, b *float64) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
@@ -0,0 +1,281 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// SchemaPredicate is a predicate declaration parsed from a Dgraph schema file
+type SchemaPredicate struct {
+	Name       string
+	Type       string // Scalar type or uid, without list brackets
+	List       bool
+	Directives []string
+	Line       int
+}
+
+// RDFTypeMismatch is a triple whose object does not fit its predicate's
+// declared type
+type RDFTypeMismatch struct {
+	File      string
+	Line      int
+	Predicate string
+	Expected  string
+	Object    string
+	Reason    string
+}
+
+// ParseSchemaFile reads the predicate declarations of a Dgraph schema file.
+// Type definitions and comments are skipped.
+func ParseSchemaFile(path string) (map[string]SchemaPredicate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	predicates, _, err := ParseSchema(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return predicates, nil
+}
+
+// ParseSchema reads the predicate declarations and type definitions of a
+// Dgraph schema. Types map to their field names in order; comments are
+// skipped.
+func ParseSchema(r io.Reader) (map[string]SchemaPredicate, map[string][]string, error) {
+	predicates := make(map[string]SchemaPredicate)
+	types := make(map[string][]string)
+	typeName := ""
+	lineNum := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if typeName != "" {
+			if strings.HasPrefix(line, "}") {
+				typeName = ""
+			} else {
+				types[typeName] = append(types[typeName], strings.Trim(line, "<>"))
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "type "); ok {
+			name, _, _ := strings.Cut(rest, "{")
+			name = strings.Trim(strings.TrimSpace(name), "<>")
+			types[name] = []string{}
+			if !strings.HasSuffix(line, "}") {
+				typeName = name
+			}
+			continue
+		}
+
+		pred, err := parsePredicateLine(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		pred.Line = lineNum
+		predicates[pred.Name] = pred
+	}
+	return predicates, types, scanner.Err()
+}
+
+// parsePredicateLine parses "name: type @directive ... ." or "<name>: [type] ."
+func parsePredicateLine(line string) (SchemaPredicate, error) {
+	var pred SchemaPredicate
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return pred, fmt.Errorf("missing ':' in predicate declaration %q", line)
+	}
+	pred.Name = strings.Trim(strings.TrimSpace(name), "<>")
+	if pred.Name == "" {
+		return pred, fmt.Errorf("empty predicate name in %q", line)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasSuffix(rest, ".") {
+		return pred, fmt.Errorf("predicate %s is not terminated by '.'", pred.Name)
+	}
+	fields := strings.Fields(strings.TrimSuffix(rest, "."))
+	if len(fields) == 0 {
+		return pred, fmt.Errorf("predicate %s has no type", pred.Name)
+	}
+
+	typ := fields[0]
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		pred.List = true
+		typ = strings.Trim(typ, "[]")
+	}
+	pred.Type = typ
+	pred.Directives = fields[1:]
+	return pred, nil
+}
+
+// CheckRDFTypes checks each triple in an RDF file against the declared type
+// of its predicate. Predicates missing from the schema are not checked.
+func CheckRDFTypes(predicates map[string]SchemaPredicate, rdfFile string) ([]RDFTypeMismatch, error) {
+	file, err := compress.Open(rdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mismatches []RDFTypeMismatch
+	lineNum := 0
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRDFLineBytes)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		mismatch := func(predicate, expected, object, reason string) {
+			mismatches = append(mismatches, RDFTypeMismatch{
+				File:      rdfFile,
+				Line:      lineNum,
+				Predicate: predicate,
+				Expected:  expected,
+				Object:    object,
+				Reason:    reason,
+			})
+		}
+
+		subject, rest, _ := strings.Cut(line, " ")
+		predicate, object, ok := strings.Cut(rest, " ")
+		object = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(object), "."))
+		if !ok || !strings.HasPrefix(predicate, "<") || !strings.HasSuffix(predicate, ">") {
+			mismatch("", "", line, "not a triple")
+			continue
+		}
+		predicate = strings.Trim(predicate, "<>")
+		if !isNodeRef(subject) {
+			mismatch(predicate, "", subject, "subject is not a blank node or uid")
+			continue
+		}
+
+		pred, declared := predicates[predicate]
+		if !declared {
+			continue
+		}
+
+		if isNodeRef(object) {
+			if pred.Type != "uid" {
+				mismatch(predicate, pred.Type, object, "edge on a scalar predicate")
+			}
+			continue
+		}
+
+		value, ok := literalValue(object)
+		if !ok {
+			mismatch(predicate, pred.Type, object, "object is neither a literal nor a node")
+			continue
+		}
+		if reason := checkScalar(pred.Type, value); reason != "" {
+			mismatch(predicate, pred.Type, object, reason)
+		}
+	}
+	return mismatches, scanner.Err()
+}
+
+// isNodeRef reports whether a term is a blank node or a <0x...> uid
+func isNodeRef(term string) bool {
+	return strings.HasPrefix(term, "_:") || strings.HasPrefix(term, "<0x")
+}
+
+// literalValue returns the unescaped value of a quoted literal, ignoring any
+// ^^<datatype> or @lang suffix
+func literalValue(object string) (string, bool) {
+	if !strings.HasPrefix(object, "\"") {
+		return "", false
+	}
+	for i := 1; i < len(object); i++ {
+		switch object[i] {
+		case '\\':
+			i++
+		case '"':
+			return unescapeRDFValue(object[1:i]), true
+		}
+	}
+	return "", false
+}
+
+// checkScalar returns why a literal value does not fit a Dgraph type, or ""
+func checkScalar(dgraphType, value string) string {
+	switch dgraphType {
+	case "uid":
+		return "literal on a uid predicate"
+	case "int":
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil {
+			return "not an integer"
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return "not a number"
+		}
+	case "bool":
+		if _, ok := toBoolLiteral(value); !ok {
+			return "not a boolean"
+		}
+	case "datetime":
+		if _, ok := parseDatetime(value); !ok {
+			return "not a datetime"
+		}
+	}
+	return ""
+}
+
+// ValidateRDF checks the RDF output files against the generated schema file
+// without a running Dgraph, logging every mismatch with its line number
+func ValidateRDF(cfg *config.Config, logger *logger.Logger) error {
+	schemaPath := filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile)
+	predicates, err := ParseSchemaFile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	var total int
+	for _, name := range rdfDataFiles(cfg) {
+		rdfPath := filepath.Join(cfg.Output.Directory, name)
+		mismatches, err := CheckRDFTypes(predicates, rdfPath)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", rdfPath, err)
+		}
+
+		for _, m := range mismatches {
+			logger.Warn("RDF type mismatch",
+				"file", m.File,
+				"line", m.Line,
+				"predicate", m.Predicate,
+				"expected", m.Expected,
+				"object", m.Object,
+				"reason", m.Reason)
+		}
+		total += len(mismatches)
+	}
+
+	logger.Info("RDF validation completed",
+		"predicates", len(predicates),
+		"mismatches", total)
+	if total > 0 {
+		return fmt.Errorf("found %d RDF type mismatches", total)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+const checkSchema = `# Generated schema
+users.age: int @index(int) .
+users.score: float .
+users.active: bool .
+users.created: datetime .
+users.tags: [string] .
+<order%20items.qty>: int .
+orders.user: uid @reverse .
+
+type users {
+  users.age
+  users.score
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	predicates, types, err := ParseSchema(strings.NewReader(checkSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+	tests := []SchemaPredicate{
+		{Name: "users.age", Type: "int", Directives: []string{"@index(int)"}, Line: 2},
+		{Name: "users.tags", Type: "string", List: true, Line: 6},
+		{Name: "order%20items.qty", Type: "int", Line: 7},
+		{Name: "orders.user", Type: "uid", Directives: []string{"@reverse"}, Line: 8},
+	}
+	for _, want := range tests {
+		got := predicates[want.Name]
+		if got.Name != want.Name || got.Type != want.Type || got.List != want.List || got.Line != want.Line ||
+			!slices.Equal(got.Directives, want.Directives) {
+			t.Errorf("predicate %s = %+v, want %+v", want.Name, got, want)
+		}
+	}
+	if len(predicates) != 7 {
+		t.Errorf("parsed %d predicates, want 7", len(predicates))
+	}
+	if !slices.Equal(types["users"], []string{"users.age", "users.score"}) {
+		t.Errorf("type users = %v", types["users"])
+	}
+
+	for _, bad := range []string{"users.age int .", "users.age: int", ": int ."} {
+		if _, _, err := ParseSchema(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("ParseSchema(%q) error = %v, want a line 1 error", bad, err)
+		}
+	}
+}
+
+func TestCheckRDFTypes(t *testing.T) {
+	predicates, _, err := ParseSchema(strings.NewReader(checkSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		triple string
+		reason string // "" when the triple fits its predicate
+	}{
+		{"int", `_:users_1 <users.age> "42"^^<xs:int> .`, ""},
+		{"non-numeric int", `_:users_1 <users.age> "forty-two"^^<xs:int> .`, "not an integer"},
+		{"float in an int", `_:users_1 <users.age> "4.2" .`, "not an integer"},
+		{"float", `_:users_1 <users.score> "-1.5e3" .`, ""},
+		{"non-numeric float", `_:users_1 <users.score> "high" .`, "not a number"},
+		{"bool", `_:users_1 <users.active> "true" .`, ""},
+		{"non-boolean", `_:users_1 <users.active> "maybe" .`, "not a boolean"},
+		{"datetime", `_:users_1 <users.created> "2024-03-01T12:30:00Z" .`, ""},
+		{"impossible datetime", `_:users_1 <users.created> "2023-02-30" .`, "not a datetime"},
+		{"escaped name", `_:order.20items_1 <order%20items.qty> "x" .`, "not an integer"},
+		{"edge", `_:orders_1 <orders.user> _:users_1 .`, ""},
+		{"edge to a uid", `_:orders_1 <orders.user> <0x1f> .`, ""},
+		{"literal on an edge", `_:orders_1 <orders.user> "1" .`, "literal on a uid predicate"},
+		{"edge on a scalar", `_:users_1 <users.age> _:users_2 .`, "edge on a scalar predicate"},
+		{"undeclared predicate", `_:users_1 <users.nickname> "x" .`, ""},
+		{"bad subject", `users_1 <users.age> "1" .`, "subject is not a blank node or uid"},
+		{"not a triple", `_:users_1 users.age "1" .`, "not a triple"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.rdf")
+			writeFile(t, path, "# header\n\n"+tt.triple+"\n")
+			mismatches, err := CheckRDFTypes(predicates, path)
+			if err != nil {
+				t.Fatalf("CheckRDFTypes: %v", err)
+			}
+			if tt.reason == "" {
+				if len(mismatches) > 0 {
+					t.Errorf("mismatches = %+v, want none", mismatches)
+				}
+				return
+			}
+			if len(mismatches) != 1 || mismatches[0].Reason != tt.reason || mismatches[0].Line != 3 {
+				t.Errorf("mismatches = %+v, want %q on line 3", mismatches, tt.reason)
+			}
+		})
+	}
+}
+
+// TestValidateRDF flags a non-numeric value of an int predicate with the line
+// it is on
+func TestValidateRDF(t *testing.T) {
+	cfg := testConfig(t)
+	writeFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile), checkSchema)
+	writeFile(t, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile), strings.Join([]string{
+		`_:users_1 <users.age> "36"^^<xs:int> .`,
+		`_:users_1 <users.score> "2.5" .`,
+		`_:users_2 <users.age> "unknown"^^<xs:int> .`,
+		`_:orders_1 <orders.user> _:users_1 .`,
+	}, "\n")+"\n")
+
+	predicates, err := ParseSchemaFile(filepath.Join(cfg.Output.Directory, cfg.Output.SchemaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := CheckRDFTypes(predicates, filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Line != 3 || mismatches[0].Predicate != "users.age" || mismatches[0].Expected != "int" {
+		t.Errorf("mismatches = %+v, want users.age on line 3", mismatches)
+	}
+
+	err = ValidateRDF(cfg, logger.New("error", "text"))
+	if err == nil || !strings.Contains(err.Error(), "found 1 RDF type mismatches") {
+		t.Errorf("ValidateRDF error = %v, want one mismatch", err)
+	}
+}
+
+// TestValidateRDFExport checks the pipeline's own output passes validation
+func TestValidateRDFExport(t *testing.T) {
+	cfg := testConfig(t)
+	schema := fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}})
+	schema.Tables["users"].Columns["name"] = &Column{Name: "name", Type: "varchar", ColumnType: "varchar(50)", Position: 2}
+	schema.Tables["users"].Columns["created"] = &Column{Name: "created", Type: "datetime", ColumnType: "datetime", Position: 3}
+	if err := NewSchemaGenerator(cfg, logger.New("error", "text")).Generate(schema); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	processRDF(t, cfg, schema, map[string]*fakeTable{
+		"users": {columns: []string{"id", "name", "created"}, rows: [][]driver.Value{
+			{int64(1), "Ada", "2024-03-01 12:30:00"},
+			{int64(2), "Grace", nil},
+		}},
+		"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(1), int64(1)}, {int64(2), int64(2)}}},
+	})
+	if err := ValidateRDF(cfg, logger.New("error", "text")); err != nil {
+		t.Errorf("ValidateRDF: %v", err)
+	}
+}
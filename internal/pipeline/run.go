@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Pipeline modes accepted by Run
+const (
+	ModeSchema                = "schema"
+	ModeData                  = "data"
+	ModeFull                  = "full"
+	ModeValidate              = "validate"
+	ModeRelationshipsObserved = "relationships-observed"
+	ModeSchemaDiff            = "schema-diff"
+	ModeAnalyze               = "analyze"
+	ModeDiscoverRelationships = "discover-relationships"
+)
+
+// Modes lists the modes Run accepts
+var Modes = []string{ModeSchema, ModeData, ModeFull, ModeValidate, ModeRelationshipsObserved, ModeSchemaDiff, ModeAnalyze, ModeDiscoverRelationships}
+
+// RunOptions are the per-run settings of Run
+type RunOptions struct {
+	Tables []string // Tables to migrate (empty = all)
+}
+
+// Result summarizes a run for programs embedding the pipeline
+type Result struct {
+	Mode          string                          `json:"mode"`
+	Tables        []string                        `json:"tables,omitempty"`       // Tables the data phase processed
+	ProcessedRows int64                           `json:"processed_rows"`         // Rows read from MySQL
+	Errors        int64                           `json:"errors"`                 // Table jobs that failed
+	SkippedValues int64                           `json:"skipped_values"`         // Values and rows not emitted, such as NULLs and orphaned foreign keys
+	Skipped       map[string]map[SkipReason]int64 `json:"skipped,omitempty"`      // SkippedValues per table and reason
+	OutputFiles   []string                        `json:"output_files,omitempty"` // Files written by this run
+	Chunks        []ChunkInfo                     `json:"chunks,omitempty"`       // Chunk files written when output.chunk_size is set
+	Elapsed       time.Duration                   `json:"elapsed"`
+
+	// Reports, set by the modes that produce one
+	SchemaDiff *SchemaDiff            `json:"schema_diff,omitempty"` // schema-diff
+	Analysis   *AnalysisReport        `json:"analysis,omitempty"`    // analyze
+	Discovery  *RelationshipDiscovery `json:"discovery,omitempty"`   // discover-relationships
+}
+
+// Run executes one pipeline mode and returns what it did. Cancelling ctx
+// stops the run the way Stop does, but leaves the connections open; call
+// Stop once the pipeline is no longer needed.
+func (p *Pipeline) Run(ctx context.Context, mode string, opts RunOptions) (*Result, error) {
+	start := time.Now()
+	result := &Result{Mode: mode}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.cancel()
+		case <-done:
+		}
+	}()
+
+	tables := strings.Join(opts.Tables, ",")
+	var err error
+	switch mode {
+	case ModeSchema:
+		// Extract MySQL schema and generate Dgraph schema
+		p.logger.Info("Running schema extraction and generation")
+		if err = p.ExtractSchema(); err == nil {
+			err = p.GenerateDgraphSchema()
+		}
+
+	case ModeData:
+		// Migrate data from MySQL to RDF format
+		p.logger.Info("Running data migration")
+		err = p.MigrateData(tables)
+
+	case ModeFull:
+		// Complete pipeline: schema + data + validation
+		p.logger.Info("Running complete pipeline")
+		err = p.RunFull(tables)
+
+	case ModeValidate:
+		// Validate migrated data integrity
+		p.logger.Info("Running data validation")
+		err = p.ValidateData()
+
+	case ModeRelationshipsObserved:
+		// Report which relationships the data actually uses
+		p.logger.Info("Running relationship observation")
+		err = p.ObserveRelationships(tables)
+
+	case ModeSchemaDiff:
+		// Compare the MySQL-derived schema with the one live in Dgraph
+		p.logger.Info("Running schema diff")
+		result.SchemaDiff, err = p.DiffSchema()
+
+	case ModeAnalyze:
+		// Profile the database without exporting anything
+		p.logger.Info("Running database analysis")
+		result.Analysis, err = p.Analyze(tables)
+
+	case ModeDiscoverRelationships:
+		// Score candidate relationships from sampled data for review
+		p.logger.Info("Running relationship discovery")
+		result.Discovery, err = p.DiscoverRelationships(tables)
+
+	default:
+		return nil, fmt.Errorf("invalid pipeline mode %q, valid modes: %s", mode, strings.Join(Modes, ", "))
+	}
+
+	p.progress.mu.RLock()
+	result.ProcessedRows = p.progress.ProcessedRows
+	result.Errors = p.progress.ErrorCount
+	p.progress.mu.RUnlock()
+	result.Tables = p.migratedTables
+	result.Chunks = p.chunks
+	result.SkippedValues = p.processor.SkipStats().Total()
+	if result.SkippedValues > 0 {
+		result.Skipped = p.processor.SkipStats().Snapshot()
+	}
+	result.OutputFiles = p.writtenFiles(start)
+	result.Elapsed = time.Since(start)
+	return result, err
+}
+
+// writtenFiles returns the output files modified since start
+func (p *Pipeline) writtenFiles(start time.Time) []string {
+	out := p.cfg.Output
+	candidates := []string{out.SchemaFile, out.GraphQLFile}
+	candidates = append(candidates, rdfDataFiles(p.cfg)...)
+	candidates = append(candidates, out.MappingFile, out.NameMapFile, out.ProfileFile,
+		out.RelationshipReportFile, out.SchemaDiffFile, out.AnalysisFile, out.DiscoveryReportFile, out.ManifestFile, out.CheckpointFile)
+	if batches, err := filepath.Glob(filepath.Join(out.Directory, out.CompressedName("batch_*.json"))); err == nil {
+		for _, batch := range batches {
+			candidates = append(candidates, filepath.Base(batch))
+		}
+	}
+
+	// File systems with coarse timestamps may date a file before start
+	since := start.Truncate(time.Second)
+	seen := make(map[string]bool)
+	var files []string
+	for _, name := range candidates {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		path := filepath.Join(out.Directory, name)
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Before(since) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
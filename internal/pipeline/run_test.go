@@ -0,0 +1,488 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// shopSchema is a users table and an orders table referencing it, where one
+// order references a user that does not exist
+func shopSchema() *infoSchema {
+	return &infoSchema{
+		columns: map[string][]fakeColumn{
+			"users":  {{name: "id", dataType: "int", columnType: "int"}, {name: "name", dataType: "varchar", columnType: "varchar(50)"}},
+			"orders": {{name: "id", dataType: "int", columnType: "int"}, {name: "user_id", dataType: "int", columnType: "int"}},
+		},
+		primaryKeys: map[string][]string{"users": {"id"}, "orders": {"id"}},
+		foreignKeys: []ForeignKey{
+			{ConstraintName: "orders_user", TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id"},
+		},
+		rows: map[string]*fakeTable{
+			"users": {columns: []string{"id", "name"}, rows: [][]driver.Value{
+				{int64(1), "Ada"}, {int64(2), nil},
+			}},
+			"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+				{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(9)},
+			}},
+		},
+	}
+}
+
+// runPipeline runs mode over info through NewWithDB and fails the test if
+// the run fails
+func runPipeline(t *testing.T, cfg *config.Config, info *infoSchema, mode string, opts RunOptions) *Result {
+	t.Helper()
+	if cfg.MySQL.Database == "" {
+		cfg.MySQL.Database = "shop"
+	}
+	db, _ := newFakeDB(t, info.serve)
+	p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+	if err != nil {
+		t.Fatalf("NewWithDB: %v", err)
+	}
+	defer p.Stop()
+
+	result, err := p.Run(context.Background(), mode, opts)
+	if err != nil {
+		t.Fatalf("Run %s: %v", mode, err)
+	}
+	return result
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		opts    RunOptions
+		data    func(*infoSchema)
+		tables  []string
+		rows    int64
+		skipped map[string]map[SkipReason]int64
+		files   []string // Base names of the files written
+		errText string
+	}{
+		{
+			name:  "schema",
+			mode:  ModeSchema,
+			files: []string{"schema.txt"},
+		},
+		{
+			name:   "data",
+			mode:   ModeData,
+			tables: []string{"orders", "users"},
+			rows:   5,
+			skipped: map[string]map[SkipReason]int64{
+				"users":  {SkipNullValue: 1},
+				"orders": {SkipOrphanedForeignKey: 1},
+			},
+			files: []string{"data.rdf", "uid_mapping.txt"},
+		},
+		{
+			name:   "data of one table",
+			mode:   ModeData,
+			opts:   RunOptions{Tables: []string{"users"}},
+			tables: []string{"users"},
+			rows:   2,
+			skipped: map[string]map[SkipReason]int64{
+				"users": {SkipNullValue: 1},
+			},
+			files: []string{"data.rdf", "uid_mapping.txt"},
+		},
+		{
+			name: "full",
+			mode: ModeFull,
+			data: func(s *infoSchema) {
+				orders := s.rows["orders"]
+				orders.rows = orders.rows[:2]
+			},
+			tables: []string{"orders", "users"},
+			rows:   4,
+			skipped: map[string]map[SkipReason]int64{
+				"users": {SkipNullValue: 1},
+			},
+			files: []string{"data.rdf", "schema.txt", "uid_mapping.txt"},
+		},
+		{
+			name:    "full with a dangling reference",
+			mode:    ModeFull,
+			errText: "data validation failed",
+		},
+		{
+			name:    "an unknown mode",
+			mode:    "export",
+			errText: `invalid pipeline mode "export"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			info := shopSchema()
+			if tt.data != nil {
+				tt.data(info)
+			}
+			db, _ := newFakeDB(t, info.serve)
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+
+			result, err := p.Run(context.Background(), tt.mode, tt.opts)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("Run error = %v, want it to contain %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if result.Mode != tt.mode || result.Errors != 0 || result.Elapsed <= 0 {
+				t.Errorf("result = %+v", result)
+			}
+			tables := slices.Clone(result.Tables)
+			slices.Sort(tables)
+			if !slices.Equal(tables, tt.tables) {
+				t.Errorf("Tables = %v, want %v", tables, tt.tables)
+			}
+			if result.ProcessedRows != tt.rows {
+				t.Errorf("ProcessedRows = %d, want %d", result.ProcessedRows, tt.rows)
+			}
+			var total int64
+			for table, reasons := range tt.skipped {
+				for reason, want := range reasons {
+					total += want
+					if got := result.Skipped[table][reason]; got != want {
+						t.Errorf("Skipped[%s][%s] = %d, want %d", table, reason, got, want)
+					}
+				}
+			}
+			if result.SkippedValues != total {
+				t.Errorf("SkippedValues = %d, want %d (%v)", result.SkippedValues, total, result.Skipped)
+			}
+
+			var files []string
+			for _, path := range result.OutputFiles {
+				if filepath.Dir(path) != cfg.Output.Directory {
+					t.Errorf("output file %s outside %s", path, cfg.Output.Directory)
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("output file: %v", err)
+				}
+				files = append(files, filepath.Base(path))
+			}
+			slices.Sort(files)
+			if !slices.Equal(files, tt.files) {
+				t.Errorf("OutputFiles = %v, want %v", files, tt.files)
+			}
+		})
+	}
+}
+
+func TestNewWithDBValidatesConfig(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pipeline.Workers = 0
+	db, _ := newFakeDB(t, shopSchema().serve)
+	if _, err := NewWithDB(cfg, logger.New("error", "text"), db); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Fatalf("NewWithDB error = %v, want an invalid configuration", err)
+	}
+}
+
+func TestDetermineTablesToProcess(t *testing.T) {
+	schema := &Schema{Tables: make(map[string]*Table)}
+	for _, name := range []string{"audit_log", "users", "wp_cache", "wp_log", "wp_posts", "wp_users"} {
+		schema.Tables[name] = &Table{Name: name}
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		tables  string // -tables flag
+		want    []string
+	}{
+		{name: "all", want: []string{"audit_log", "users", "wp_cache", "wp_log", "wp_posts", "wp_users"}},
+		{name: "include", include: []string{"wp_*"}, want: []string{"wp_cache", "wp_log", "wp_posts", "wp_users"}},
+		{name: "overlapping exclude", include: []string{"wp_*"}, exclude: []string{"*_log", "wp_cache"},
+			want: []string{"wp_posts", "wp_users"}},
+		{name: "negated include", include: []string{"!wp_*"}, want: []string{"audit_log", "users"}},
+		{name: "flag narrowed by patterns", tables: "users, wp_log,wp_posts,missing", exclude: []string{"*_log"},
+			want: []string{"users", "wp_posts"}},
+		{name: "nothing left", include: []string{"orders*"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.IncludeTables, cfg.Pipeline.ExcludeTables = tt.include, tt.exclude
+			p := &Pipeline{cfg: cfg, logger: logger.New("error", "text")}
+			if got := p.determineTablesToProcess(schema, tt.tables); !slices.Equal(got, tt.want) {
+				t.Errorf("tables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadReplica checks rows are read from the replica connection while
+// schema metadata is read from the primary
+func TestReadReplica(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MySQL.Database = "shop"
+	cfg.Pipeline.SkipValidation = true
+	primary, primaryFake := newFakeDB(t, shopSchema().serve)
+	replica, replicaFake := newFakeDB(t, shopSchema().serve)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := newPipeline(cfg, logger.New("error", "text"), ctx, cancel, primary, replica)
+	if err != nil {
+		t.Fatalf("newPipeline: %v", err)
+	}
+	defer p.Stop()
+	if _, err := p.Run(context.Background(), ModeData, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	isRowRead := func(query string) bool {
+		return strings.HasPrefix(query, "SELECT `") && strings.Contains(query, "FROM `")
+	}
+	replicaReads := 0
+	for _, query := range replicaFake.Queries() {
+		if isRowRead(query) {
+			replicaReads++
+		}
+		if strings.Contains(query, "information_schema") {
+			t.Errorf("replica read schema metadata: %s", query)
+		}
+	}
+	if replicaReads == 0 {
+		t.Errorf("no rows read from the replica: %v", replicaFake.Queries())
+	}
+	metadata := 0
+	for _, query := range primaryFake.Queries() {
+		if isRowRead(query) {
+			t.Errorf("primary read rows: %s", query)
+		}
+		if strings.Contains(query, "information_schema") {
+			metadata++
+		}
+	}
+	if metadata == 0 {
+		t.Error("no schema metadata read from the primary")
+	}
+}
+
+// TestReportProgress runs the progress reporter for a while and counts the
+// reports logged at the configured interval
+func TestReportProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		min, max int
+	}{
+		{name: "off", interval: 0},
+		{name: "every 20ms", interval: 20 * time.Millisecond, min: 3, max: 8},
+		{name: "longer than the run", interval: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.ProgressReportInterval = tt.interval
+			var logged syncBuffer
+			log := logger.New("info", "text")
+			log.SetOutput(&logged)
+			ctx, cancel := context.WithCancel(context.Background())
+			p := &Pipeline{cfg: cfg, logger: log, ctx: ctx, cancel: cancel,
+				progress: &ProgressTracker{StartTime: time.Now(), ProcessedRows: 10, TotalRows: 100}}
+
+			done := make(chan struct{})
+			go func() {
+				p.reportProgress()
+				close(done)
+			}()
+			time.Sleep(110 * time.Millisecond)
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("reportProgress did not stop when cancelled")
+			}
+
+			reports := strings.Count(logged.String(), "Pipeline progress report")
+			if reports < tt.min || reports > tt.max {
+				t.Errorf("logged %d reports, want between %d and %d:\n%s", reports, tt.min, tt.max, logged.String())
+			}
+			if reports > 0 && !strings.Contains(logged.String(), "memory_mb=") {
+				t.Errorf("report lacks memory_mb:\n%s", logged.String())
+			}
+		})
+	}
+}
+
+func TestSplitTablePrefix(t *testing.T) {
+	tables := []string{"order_items_2024", "order_items", "orders", "users"}
+	tests := []struct {
+		name, sep   string
+		table, rest string
+		ok          bool
+	}{
+		{name: "order_items_2024_7", sep: "_", table: "order_items_2024", rest: "7", ok: true},
+		{name: "order_items_7", sep: "_", table: "order_items", rest: "7", ok: true},
+		{name: "users_ada_l", sep: "_", table: "users", rest: "ada_l", ok: true},
+		{name: "order_items_2024.order_id", sep: ".", table: "order_items_2024", rest: "order_id", ok: true},
+		{name: "users.v1.name", sep: ".", table: "users", rest: "v1.name", ok: true},
+		// Unknown tables
+		{name: "audit_log_3", sep: "_", table: "audit_log", rest: "3", ok: true},
+		{name: "audit_log.user_id", sep: ".", table: "audit_log", rest: "user_id", ok: true},
+		{name: "audit.log.user_id", sep: "."},
+		{name: "audit", sep: "_"},
+		{name: "_3", sep: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, rest, ok := splitTablePrefix(tt.name, tt.sep, tables)
+			if table != tt.table || rest != tt.rest || ok != tt.ok {
+				t.Errorf("splitTablePrefix(%q, %q) = %q, %q, %v; want %q, %q, %v",
+					tt.name, tt.sep, table, rest, ok, tt.table, tt.rest, tt.ok)
+			}
+		})
+	}
+}
+
+// TestObserveRDFRelationships counts the edges of tables whose names hold
+// underscores, with and without the schema's table names
+func TestObserveRDFRelationships(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	writeFile(t, path, `_:order_items_2024_1 <dgraph.type> "order_items_2024" .
+_:order_items_2024_1 <order_items_2024.order_id> _:orders_2024_5 .
+_:order_items_2024_2 <order_items_2024.order_id> _:orders_2024_5 .
+_:order_items_1 <order_items.order_id> _:orders_5 .
+_:order_items_1 <order_items.note> "_:orders_5" .
+_:user_roles_1 <user_roles.user_id> _:users_ada_l .
+`)
+	schema := &Schema{Tables: make(map[string]*Table)}
+	for _, name := range []string{"order_items_2024", "orders_2024", "order_items", "orders", "user_roles", "users"} {
+		schema.Tables[name] = &Table{Name: name}
+	}
+	tests := []struct {
+		name   string
+		schema *Schema
+		want   []string // table.column->table:edges
+	}{
+		{
+			name:   "known tables",
+			schema: schema,
+			want: []string{
+				"order_items.order_id->orders:1",
+				"order_items_2024.order_id->orders_2024:2",
+				"user_roles.user_id->users:1",
+			},
+		},
+		{
+			name: "no schema",
+			want: []string{
+				"order_items.order_id->orders:1",
+				"order_items_2024.order_id->orders_2024:2",
+				// Split at the key's own underscore
+				"user_roles.user_id->users_ada:1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed, err := observeRDFRelationships([]string{path}, tt.schema, nil, "")
+			if err != nil {
+				t.Fatalf("observeRDFRelationships: %v", err)
+			}
+			var got []string
+			for _, usage := range observed {
+				got = append(got, fmt.Sprintf("%s.%s->%s:%d", usage.TableName, usage.ColumnName, usage.RefTableName, usage.Edges))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("observed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// bareReservedWord matches the reserved-word names of
+// TestReservedWordNames where they are not quoted
+var bareReservedWord = regexp.MustCompile("(^|[^`])\\b(order|group|select)\\b([^`]|$)")
+
+// TestReservedWordNames migrates tables and columns named after reserved
+// words, which only succeeds when every query quotes them
+func TestReservedWordNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+		files  []string
+	}{
+		{name: "full", files: []string{"data.rdf", "schema.txt", "uid_mapping.txt"}},
+		{name: "chunks", change: func(c *config.Config) { c.Output.ChunkSize, c.Pipeline.BatchSize = 2, 1 },
+			files: []string{"data_chunk_1.rdf", "data_chunk_2.rdf", "manifest.json", "schema.txt", "uid_mapping.txt"}},
+		// The validator reads RDF only
+		{name: "json", change: func(c *config.Config) { c.Output.Format, c.Pipeline.SkipValidation = "json", true },
+			files: []string{"batch_0001.json", "schema.txt", "uid_mapping.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &infoSchema{
+				columns: map[string][]fakeColumn{
+					"group": {{name: "id", dataType: "int", columnType: "int"}, {name: "select", dataType: "varchar", columnType: "varchar(10)"}},
+					"order": {{name: "id", dataType: "int", columnType: "int"}, {name: "group_id", dataType: "int", columnType: "int"}},
+				},
+				primaryKeys: map[string][]string{"group": {"id"}, "order": {"id"}},
+				foreignKeys: []ForeignKey{
+					{ConstraintName: "order_group", TableName: "order", ColumnName: "group_id", RefTableName: "group", RefColumnName: "id"},
+				},
+				rows: map[string]*fakeTable{
+					"group": {columns: []string{"id", "select"}, rows: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}},
+					"order": {columns: []string{"id", "group_id"}, rows: [][]driver.Value{{int64(1), int64(1)}, {int64(2), int64(2)}}},
+				},
+			}
+			cfg := testConfig(t)
+			cfg.MySQL.Database = "shop"
+			if tt.change != nil {
+				tt.change(cfg)
+			}
+			db, fake := newFakeDB(t, info.serve)
+			p, err := NewWithDB(cfg, logger.New("error", "text"), db)
+			if err != nil {
+				t.Fatalf("NewWithDB: %v", err)
+			}
+			defer p.Stop()
+
+			result, err := p.Run(context.Background(), ModeFull, RunOptions{})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if result.ProcessedRows != 4 {
+				t.Errorf("ProcessedRows = %d, want 4", result.ProcessedRows)
+			}
+			var files []string
+			for _, path := range result.OutputFiles {
+				files = append(files, filepath.Base(path))
+			}
+			slices.Sort(files)
+			if !slices.Equal(files, tt.files) {
+				t.Errorf("OutputFiles = %v, want %v", files, tt.files)
+			}
+			for _, query := range fake.Queries() {
+				if bareReservedWord.MatchString(query) {
+					t.Errorf("unquoted name in %s", query)
+				}
+			}
+		})
+	}
+}
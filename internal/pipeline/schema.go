@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
@@ -24,16 +28,74 @@ type Table struct {
 	PrimaryKeys []string           `json:"primary_keys"`
 	RowCount    int64              `json:"row_count"`
 	Engine      string             `json:"engine"`
+	Partitions  []Partition        `json:"partitions,omitempty"`
+	Junction    *Junction          `json:"junction,omitempty"` // Set for many-to-many link tables
+}
+
+// Junction describes a many-to-many table: its rows only link a row of one
+// table to a row of another, so they can become edges instead of nodes
+type Junction struct {
+	Left   ForeignKey `json:"left"`
+	Right  ForeignKey `json:"right"`
+	Facets []string   `json:"facets,omitempty"` // Timestamp columns, e.g. assigned_at, written as facets on the edges
+}
+
+// Predicates returns the list edges a collapsed junction becomes: forward
+// from the left table to the right one and backward from right to left.
+// Edges are named after the target table, or after the foreign key column
+// when both sides are the same table.
+func (j *Junction) Predicates() (forward, backward string) {
+	if j.Left.RefTableName == j.Right.RefTableName {
+		return fmt.Sprintf("%s.%s", j.Left.RefTableName, strings.TrimSuffix(strings.ToLower(j.Right.ColumnName), "_id")),
+			fmt.Sprintf("%s.%s", j.Right.RefTableName, strings.TrimSuffix(strings.ToLower(j.Left.ColumnName), "_id"))
+	}
+	return fmt.Sprintf("%s.%s", j.Left.RefTableName, relativeTableName(j.Right.RefTableName, j.Left.RefTableName)),
+		fmt.Sprintf("%s.%s", j.Right.RefTableName, relativeTableName(j.Left.RefTableName, j.Right.RefTableName))
+}
+
+// Partition is a partition, or subpartition, of a partitioned table
+type Partition struct {
+	Name     string `json:"name"`
+	RowCount int64  `json:"row_count"` // Estimate from information_schema
 }
 
 // Column represents a MySQL column
 type Column struct {
 	Name          string `json:"name"`
 	Type          string `json:"type"`
+	ColumnType    string `json:"column_type"` // Full type including qualifiers, e.g. set('a','b')
 	Nullable      bool   `json:"nullable"`
 	Default       string `json:"default"`
 	AutoIncrement bool   `json:"auto_increment"`
 	Comment       string `json:"comment"`
+	Position      int    `json:"position"`            // Ordinal position in the table
+	Collation     string `json:"collation,omitempty"` // Collation of string columns, e.g. utf8mb4_de_0900_ai_ci
+
+	Generated            bool   `json:"generated,omitempty"`             // Computed by a GENERATED ALWAYS AS expression
+	Virtual              bool   `json:"virtual,omitempty"`               // Generated column computed on read rather than stored
+	GenerationExpression string `json:"generation_expression,omitempty"` // Expression of a generated column
+}
+
+// generatedColumn reads the extra of information_schema.columns, which is
+// "VIRTUAL GENERATED" or "STORED GENERATED" (MariaDB: "PERSISTENT GENERATED")
+// for generated columns. DEFAULT_GENERATED only marks an expression default.
+func generatedColumn(extra string) (generated, virtual bool) {
+	extra = strings.ToUpper(extra)
+	switch {
+	case strings.Contains(extra, "VIRTUAL GENERATED"):
+		return true, true
+	case strings.Contains(extra, "STORED GENERATED"), strings.Contains(extra, "PERSISTENT GENERATED"):
+		return true, false
+	}
+	return false, false
+}
+
+// FullType returns the column_type when known, falling back to the data_type
+func (c *Column) FullType() string {
+	if c.ColumnType != "" {
+		return c.ColumnType
+	}
+	return c.Type
 }
 
 // ForeignKey represents a foreign key relationship
@@ -43,6 +105,8 @@ type ForeignKey struct {
 	ColumnName     string `json:"column_name"`
 	RefTableName   string `json:"referenced_table_name"`
 	RefColumnName  string `json:"referenced_column_name"`
+	RefDatabase    string `json:"referenced_database,omitempty"` // Database of the referenced table, when read from MySQL
+	Inferred       string `json:"inferred,omitempty"`            // How an undeclared key was found: convention or data
 	UpdateRule     string `json:"update_rule"`
 	DeleteRule     string `json:"delete_rule"`
 }
@@ -58,18 +122,62 @@ type Index struct {
 
 // SchemaExtractor handles MySQL schema extraction
 type SchemaExtractor struct {
-	db     *sql.DB
-	logger *logger.Logger
+	db      *sql.DB
+	logger  *logger.Logger
+	limiter *QueryLimiter
+	filters map[string]string // table -> WHERE predicate the row counts honor
 }
 
-func NewSchemaExtractor(db *sql.DB, logger *logger.Logger) *SchemaExtractor {
+func NewSchemaExtractor(db *sql.DB, logger *logger.Logger, limiter *QueryLimiter, filters map[string]string) *SchemaExtractor {
 	return &SchemaExtractor{
-		db:     db,
-		logger: logger,
+		db:      db,
+		logger:  logger,
+		limiter: limiter,
+		filters: filters,
 	}
 }
 
 func (se *SchemaExtractor) ExtractSchema(ctx context.Context, database string) (*Schema, error) {
+	schema, err := se.extractDatabase(ctx, database, false)
+	if err != nil {
+		return nil, err
+	}
+	return se.finishSchema(schema), nil
+}
+
+// ExtractSchemas extracts several databases into one schema whose tables are
+// named "database.table", so the types and predicates generated from it are
+// prefixed with the database, e.g. sales.orders.id
+func (se *SchemaExtractor) ExtractSchemas(ctx context.Context, databases []string) (*Schema, error) {
+	schema := &Schema{
+		Database: strings.Join(databases, ","),
+		Tables:   make(map[string]*Table),
+		Indexes:  make(map[string][]Index),
+	}
+
+	for _, database := range databases {
+		extracted, err := se.extractDatabase(ctx, database, true)
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", database, err)
+		}
+		extracted.qualify(database)
+
+		for tableName, table := range extracted.Tables {
+			schema.Tables[tableName] = table
+		}
+		schema.Relationships = append(schema.Relationships, extracted.Relationships...)
+		for tableName, indexes := range extracted.Indexes {
+			schema.Indexes[tableName] = indexes
+		}
+	}
+
+	return se.finishSchema(schema), nil
+}
+
+// extractDatabase reads one database's tables, foreign keys and indexes under
+// their own names. qualified only tells the row counts which filters apply
+// and to name the database in their queries.
+func (se *SchemaExtractor) extractDatabase(ctx context.Context, database string, qualified bool) (*Schema, error) {
 	schema := &Schema{
 		Database: database,
 		Tables:   make(map[string]*Table),
@@ -82,11 +190,15 @@ func (se *SchemaExtractor) ExtractSchema(ctx context.Context, database string) (
 		return nil, fmt.Errorf("failed to get tables: %w", err)
 	}
 
-	se.logger.Info("Found tables", "count", len(tables))
+	se.logger.Info("Found tables", "database", database, "count", len(tables))
 
 	// Extract table details
 	for _, tableName := range tables {
-		table, err := se.extractTableSchema(ctx, database, tableName)
+		countName := tableName
+		if qualified {
+			countName = database + "." + tableName
+		}
+		table, err := se.extractTableSchema(ctx, database, tableName, countName)
 		if err != nil {
 			se.logger.Error("Failed to extract table schema", "table", tableName, "error", err)
 			continue
@@ -117,12 +229,103 @@ func (se *SchemaExtractor) ExtractSchema(ctx context.Context, database string) (
 		schema.Indexes = indexes
 	}
 
+	return schema, nil
+}
+
+// finishSchema flags junction tables once every table and foreign key is known
+func (se *SchemaExtractor) finishSchema(schema *Schema) *Schema {
+	// Flag many-to-many link tables
+	if junctions := detectJunctionTables(schema); junctions > 0 {
+		se.logger.Info("Found junction tables", "count", junctions)
+	}
+
 	se.logger.Info("Schema extraction completed",
 		"tables", len(schema.Tables),
 		"relationships", len(schema.Relationships),
 		"indexes", len(schema.Indexes))
 
-	return schema, nil
+	return schema
+}
+
+// qualify prefixes the schema's table names with its database. Foreign keys
+// into another database name that database instead.
+func (s *Schema) qualify(database string) {
+	qualified := func(name string) string {
+		return database + "." + name
+	}
+
+	tables := make(map[string]*Table, len(s.Tables))
+	for tableName, table := range s.Tables {
+		table.Name = qualified(tableName)
+		tables[table.Name] = table
+	}
+	s.Tables = tables
+
+	for i := range s.Relationships {
+		fk := &s.Relationships[i]
+		fk.TableName = qualified(fk.TableName)
+		if fk.RefDatabase != "" && fk.RefDatabase != database {
+			fk.RefTableName = fk.RefDatabase + "." + fk.RefTableName
+		} else {
+			fk.RefTableName = qualified(fk.RefTableName)
+		}
+	}
+
+	indexes := make(map[string][]Index, len(s.Indexes))
+	for tableName, tableIndexes := range s.Indexes {
+		for i := range tableIndexes {
+			tableIndexes[i].TableName = qualified(tableIndexes[i].TableName)
+		}
+		indexes[qualified(tableName)] = tableIndexes
+	}
+	s.Indexes = indexes
+}
+
+// relativeTableName returns a table's name as seen from another table:
+// without the database prefix when both are in the same database
+func relativeTableName(tableName, fromTable string) string {
+	database, table, ok := strings.Cut(tableName, ".")
+	if ok && strings.HasPrefix(fromTable, database+".") {
+		return table
+	}
+	return tableName
+}
+
+// quoteIdent quotes a table, column or partition name for a query,
+// doubling any backticks it contains so reserved words such as order and
+// names with special characters are read as identifiers.
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// checkIdentifier rejects a name that is not a plain identifier before it
+// reaches a query. quoteIdent copes with any name, but table and column names
+// come from information_schema, and one crafted to break out of its quotes
+// must never shape a query.
+func checkIdentifier(kind, name string) error {
+	if !config.IsIdentifier(name) {
+		return fmt.Errorf("%s name %q is not allowed in queries: only letters, digits, '_' and '$' are accepted", kind, name)
+	}
+	return nil
+}
+
+// checkIdentifiers checks several names, such as those a foreign key joins on
+func checkIdentifiers(names ...string) error {
+	for _, name := range names {
+		if err := checkIdentifier("identifier", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteTable quotes a table name for a query. A name qualified with its
+// database, as with mysql.databases, is quoted as `database`.`table`.
+func quoteTable(tableName string) string {
+	if database, table, ok := strings.Cut(tableName, "."); ok {
+		return quoteIdent(database) + "." + quoteIdent(table)
+	}
+	return quoteIdent(tableName)
 }
 
 func (se *SchemaExtractor) getTables(ctx context.Context, database string) ([]string, error) {
@@ -133,6 +336,11 @@ func (se *SchemaExtractor) getTables(ctx context.Context, database string) ([]st
 		AND table_type IN ('BASE TABLE', 'VIEW')
 		ORDER BY table_name`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
 	rows, err := se.db.QueryContext(ctx, query, database)
 	if err != nil {
 		return nil, err
@@ -150,7 +358,11 @@ func (se *SchemaExtractor) getTables(ctx context.Context, database string) ([]st
 	return tables, rows.Err()
 }
 
-func (se *SchemaExtractor) extractTableSchema(ctx context.Context, database, tableName string) (*Table, error) {
+func (se *SchemaExtractor) extractTableSchema(ctx context.Context, database, tableName, countName string) (*Table, error) {
+	if err := checkIdentifier("table", tableName); err != nil {
+		return nil, err
+	}
+
 	table := &Table{
 		Name:    tableName,
 		Columns: make(map[string]*Column),
@@ -171,8 +383,8 @@ func (se *SchemaExtractor) extractTableSchema(ctx context.Context, database, tab
 		table.PrimaryKeys = pks
 	}
 
-	// Get row count
-	rowCount, err := se.getRowCount(ctx, tableName)
+	// Get row count, of the filtered rows when the table has a filter
+	rowCount, err := se.getRowCount(ctx, countName)
 	if err != nil {
 		se.logger.Warn("Failed to get row count", "table", tableName, "error", err)
 	} else {
@@ -187,6 +399,14 @@ func (se *SchemaExtractor) extractTableSchema(ctx context.Context, database, tab
 		table.Engine = engine
 	}
 
+	// Get partitions
+	partitions, err := se.getPartitions(ctx, database, tableName)
+	if err != nil {
+		se.logger.Warn("Failed to get partitions", "table", tableName, "error", err)
+	} else {
+		table.Partitions = partitions
+	}
+
 	return table, nil
 }
 
@@ -195,14 +415,24 @@ func (se *SchemaExtractor) getColumns(ctx context.Context, database, tableName s
 		SELECT 
 			column_name, 
 			data_type, 
+			column_type,
 			is_nullable, 
 			COALESCE(column_default, '') as column_default,
 			CASE WHEN extra = 'auto_increment' THEN 1 ELSE 0 END as auto_increment,
-			COALESCE(column_comment, '') as column_comment
+			COALESCE(column_comment, '') as column_comment,
+			ordinal_position,
+			COALESCE(collation_name, '') as collation_name,
+			COALESCE(extra, '') as extra,
+			COALESCE(generation_expression, '') as generation_expression
 		FROM information_schema.columns
 		WHERE table_schema = ? AND table_name = ?
 		ORDER BY ordinal_position`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
 	rows, err := se.db.QueryContext(ctx, query, database, tableName)
 	if err != nil {
 		return nil, err
@@ -212,16 +442,22 @@ func (se *SchemaExtractor) getColumns(ctx context.Context, database, tableName s
 	columns := make(map[string]*Column)
 	for rows.Next() {
 		var col Column
-		var nullable string
+		var nullable, extra string
 		var autoInc int
 
-		err := rows.Scan(&col.Name, &col.Type, &nullable, &col.Default, &autoInc, &col.Comment)
+		err := rows.Scan(&col.Name, &col.Type, &col.ColumnType, &nullable, &col.Default, &autoInc, &col.Comment, &col.Position, &col.Collation,
+			&extra, &col.GenerationExpression)
 		if err != nil {
 			return nil, err
 		}
 
+		if err := checkIdentifier("column", col.Name); err != nil {
+			return nil, err
+		}
+
 		col.Nullable = nullable == "YES"
 		col.AutoIncrement = autoInc == 1
+		col.Generated, col.Virtual = generatedColumn(extra)
 
 		columns[col.Name] = &col
 	}
@@ -236,6 +472,11 @@ func (se *SchemaExtractor) getPrimaryKeys(ctx context.Context, database, tableNa
 		WHERE table_schema = ? AND table_name = ? AND constraint_name = 'PRIMARY'
 		ORDER BY ordinal_position`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
 	rows, err := se.db.QueryContext(ctx, query, database, tableName)
 	if err != nil {
 		return nil, err
@@ -255,7 +496,12 @@ func (se *SchemaExtractor) getPrimaryKeys(ctx context.Context, database, tableNa
 }
 
 func (se *SchemaExtractor) getRowCount(ctx context.Context, tableName string) (int64, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteTable(tableName), whereClause(se.filters[tableName]))
+
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer se.limiter.Release()
 
 	var count int64
 	err := se.db.QueryRowContext(ctx, query).Scan(&count)
@@ -268,11 +514,52 @@ func (se *SchemaExtractor) getTableEngine(ctx context.Context, database, tableNa
 		FROM information_schema.tables
 		WHERE table_schema = ? AND table_name = ?`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return "", err
+	}
+	defer se.limiter.Release()
+
 	var engine string
 	err := se.db.QueryRowContext(ctx, query, database, tableName).Scan(&engine)
 	return engine, err
 }
 
+// getPartitions lists a table's partitions in definition order. Subpartitions
+// are listed instead of their parent partition so every name can be scanned
+// on its own.
+func (se *SchemaExtractor) getPartitions(ctx context.Context, database, tableName string) ([]Partition, error) {
+	query := `
+		SELECT COALESCE(subpartition_name, partition_name), COALESCE(table_rows, 0)
+		FROM information_schema.partitions
+		WHERE table_schema = ? AND table_name = ? AND partition_name IS NOT NULL
+		ORDER BY partition_ordinal_position, subpartition_ordinal_position`
+
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
+	rows, err := se.db.QueryContext(ctx, query, database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var partition Partition
+		if err := rows.Scan(&partition.Name, &partition.RowCount); err != nil {
+			return nil, err
+		}
+		if err := checkIdentifier("partition", partition.Name); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
 func (se *SchemaExtractor) getForeignKeys(ctx context.Context, database string) ([]ForeignKey, error) {
 	query := `
 		SELECT 
@@ -281,6 +568,7 @@ func (se *SchemaExtractor) getForeignKeys(ctx context.Context, database string)
 			kcu.column_name,
 			kcu.referenced_table_name, 
 			kcu.referenced_column_name,
+			kcu.referenced_table_schema,
 			COALESCE(rc.update_rule, '') as update_rule,
 			COALESCE(rc.delete_rule, '') as delete_rule
 		FROM information_schema.key_column_usage kcu
@@ -291,6 +579,11 @@ func (se *SchemaExtractor) getForeignKeys(ctx context.Context, database string)
 		AND kcu.referenced_table_name IS NOT NULL
 		ORDER BY kcu.table_name, kcu.ordinal_position`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
 	rows, err := se.db.QueryContext(ctx, query, database)
 	if err != nil {
 		return nil, err
@@ -301,10 +594,14 @@ func (se *SchemaExtractor) getForeignKeys(ctx context.Context, database string)
 	for rows.Next() {
 		var fk ForeignKey
 		err := rows.Scan(&fk.ConstraintName, &fk.TableName, &fk.ColumnName,
-			&fk.RefTableName, &fk.RefColumnName, &fk.UpdateRule, &fk.DeleteRule)
+			&fk.RefTableName, &fk.RefColumnName, &fk.RefDatabase, &fk.UpdateRule, &fk.DeleteRule)
 		if err != nil {
 			return nil, err
 		}
+		if err := checkIdentifiers(fk.TableName, fk.ColumnName, fk.RefDatabase, fk.RefTableName, fk.RefColumnName); err != nil {
+			se.logger.Warn("Skipping foreign key", "constraint", fk.ConstraintName, "error", err)
+			continue
+		}
 		fks = append(fks, fk)
 	}
 
@@ -323,6 +620,11 @@ func (se *SchemaExtractor) getIndexes(ctx context.Context, database string) (map
 		WHERE table_schema = ?
 		ORDER BY table_name, index_name, seq_in_index`
 
+	if err := se.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer se.limiter.Release()
+
 	rows, err := se.db.QueryContext(ctx, query, database)
 	if err != nil {
 		return nil, err
@@ -367,49 +669,268 @@ func (se *SchemaExtractor) getIndexes(ctx context.Context, database string) (map
 	return result, rows.Err()
 }
 
-// MySQLToDgraphType converts MySQL data types to Dgraph types
+// MySQLToDgraphType converts MySQL data types to Dgraph types. It accepts either
+// the bare data_type or the full column_type, whose qualifiers are needed to
+// tell tinyint(1) booleans apart from other tinyint columns.
 func MySQLToDgraphType(mysqlType string) string {
-	mysqlType = strings.ToLower(mysqlType)
+	mysqlType = strings.ToLower(strings.TrimSpace(mysqlType))
+
+	// Strip length and attributes: "int(10) unsigned" -> "int"
+	baseType := mysqlType
+	if idx := strings.IndexAny(baseType, "( "); idx >= 0 {
+		baseType = baseType[:idx]
+	}
 
 	switch {
-	case strings.Contains(mysqlType, "int") || strings.Contains(mysqlType, "bigint") ||
-		strings.Contains(mysqlType, "smallint") || strings.Contains(mysqlType, "mediumint"):
+	case baseType == "bool" || baseType == "boolean" || strings.HasPrefix(mysqlType, "tinyint(1)"):
+		return "bool"
+	case baseType == "tinyint" || baseType == "smallint" || baseType == "mediumint" ||
+		baseType == "int" || baseType == "integer" || baseType == "bigint":
 		return "int"
-	case strings.Contains(mysqlType, "float") || strings.Contains(mysqlType, "double") ||
-		strings.Contains(mysqlType, "decimal"):
+	case baseType == "float" || baseType == "double" || baseType == "real" ||
+		baseType == "decimal" || baseType == "numeric":
 		return "float"
-	case strings.Contains(mysqlType, "bool") || mysqlType == "tinyint(1)":
-		return "bool"
-	case mysqlType == "date":
-		return "datetime"
-	case strings.Contains(mysqlType, "datetime") || strings.Contains(mysqlType, "timestamp"):
+	case baseType == "date" || baseType == "datetime" || baseType == "timestamp":
 		return "datetime"
-	case strings.Contains(mysqlType, "json"):
+	case baseType == "json":
 		return "string" // JSON stored as string in Dgraph
 	default:
 		return "string"
 	}
 }
 
+// ForwardPredicateName returns the predicate carrying a foreign key edge,
+// named after its column. Self-references drop the _id suffix so hierarchies
+// read naturally: categories.parent_id becomes categories.parent, the
+// counterpart of categories.children. A self-reference keeps its column name
+// when the shorter name is itself a column of the table.
+func ForwardPredicateName(schema *Schema, tableName, columnName, refTableName string) string {
+	if tableName == refTableName {
+		base := strings.TrimSuffix(strings.ToLower(columnName), "_id")
+		if table := schema.Tables[tableName]; base != strings.ToLower(columnName) && (table == nil || table.Columns[base] == nil) {
+			return fmt.Sprintf("%s.%s", tableName, base)
+		}
+	}
+	return fmt.Sprintf("%s.%s", tableName, columnName)
+}
+
+// ReversePredicateName returns the predicate carrying the reverse edge of a
+// foreign key. Self-references use a children name so hierarchies read
+// naturally: categories.parent_id is reversed by categories.children and
+// categories.original_id by categories.original_children.
+func ReversePredicateName(tableName, columnName, refTableName string) string {
+	if tableName == refTableName {
+		base := strings.TrimSuffix(strings.ToLower(columnName), "_id")
+		if base == "parent" {
+			return fmt.Sprintf("%s.children", tableName)
+		}
+		return fmt.Sprintf("%s.%s_children", tableName, base)
+	}
+	return fmt.Sprintf("%s.%s_reverse", tableName, columnName)
+}
+
+// collapsedJunction returns a table's junction if junction tables are
+// collapsed into edges, or nil
+func collapsedJunction(cfg *config.Config, table *Table) *Junction {
+	if table == nil || !cfg.Pipeline.CollapseJunctionTables {
+		return nil
+	}
+	return table.Junction
+}
+
+// detectJunctionTables flags tables with exactly two foreign keys whose other
+// columns are only an auto-increment id or timestamps, and returns how many
+// were found
+func detectJunctionTables(schema *Schema) int {
+	found := 0
+	for tableName, table := range schema.Tables {
+		table.Junction = nil
+
+		var fks []ForeignKey
+		for _, fk := range schema.Relationships {
+			if fk.TableName == tableName {
+				fks = append(fks, fk)
+			}
+		}
+		if len(fks) != 2 || fks[0].ColumnName == fks[1].ColumnName {
+			continue
+		}
+
+		junction := true
+		var facets []string
+		for name, col := range table.Columns {
+			if name == fks[0].ColumnName || name == fks[1].ColumnName || col.AutoIncrement {
+				continue
+			}
+			if MySQLToDgraphType(col.FullType()) == "datetime" {
+				facets = append(facets, name)
+				continue
+			}
+			junction = false
+			break
+		}
+		if !junction {
+			continue
+		}
+		sort.Strings(facets)
+
+		// Order the sides by column so the predicates are stable
+		if fks[0].ColumnName > fks[1].ColumnName {
+			fks[0], fks[1] = fks[1], fks[0]
+		}
+		table.Junction = &Junction{Left: fks[0], Right: fks[1], Facets: facets}
+		found++
+	}
+	return found
+}
+
+// IsGeoType reports whether a MySQL type is a spatial type
+func IsGeoType(mysqlType string) bool {
+	switch strings.ToLower(mysqlType) {
+	case "geometry", "point", "linestring", "polygon", "multipoint",
+		"multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return true
+	}
+	return false
+}
+
+// SelectList returns the column list for reading a table's rows. Spatial
+// columns are read as GeoJSON and JSON columns as text, since their raw bytes
+// are MySQL's internal binary formats; other columns are selected bare.
+func (t *Table) SelectList() string {
+	if len(t.Columns) == 0 {
+		return "*"
+	}
+
+	columns := make([]*Column, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		columns = append(columns, col)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].Position < columns[j].Position
+	})
+
+	exprs := make([]string, len(columns))
+	for i, col := range columns {
+		switch {
+		case IsGeoType(col.Type):
+			exprs[i] = fmt.Sprintf("ST_AsGeoJSON(%s) AS %s", quoteIdent(col.Name), quoteIdent(col.Name))
+		case IsJSONType(col.Type):
+			exprs[i] = fmt.Sprintf("CAST(%s AS CHAR) AS %s", quoteIdent(col.Name), quoteIdent(col.Name))
+		default:
+			exprs[i] = quoteIdent(col.Name)
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// IsJSONType reports whether a MySQL type is JSON
+func IsJSONType(mysqlType string) bool {
+	return strings.EqualFold(mysqlType, "json")
+}
+
+// IsBinaryType reports whether a MySQL type holds raw bytes, which are not
+// valid text and are written base64-encoded
+func IsBinaryType(mysqlType string) bool {
+	switch strings.ToLower(mysqlType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
+// IsSetType reports whether a MySQL type is a SET, which holds comma-joined members
+func IsSetType(mysqlType string) bool {
+	return strings.HasPrefix(strings.ToLower(mysqlType), "set")
+}
+
+// IsEnumType reports whether a MySQL type is an ENUM
+func IsEnumType(mysqlType string) bool {
+	return strings.HasPrefix(strings.ToLower(mysqlType), "enum")
+}
+
+// splitSetValue splits a SET value into its members. MySQL forbids commas in
+// SET members, so a plain split is exact.
+func splitSetValue(value string) []string {
+	var members []string
+	for _, member := range strings.Split(value, ",") {
+		if member != "" {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// IsDecimalType reports whether a MySQL type is an exact fixed-point type
+func IsDecimalType(mysqlType string) bool {
+	mysqlType = strings.ToLower(mysqlType)
+	return strings.HasPrefix(mysqlType, "decimal") || strings.HasPrefix(mysqlType, "numeric")
+}
+
+// formatDecimal renders a decimal value in plain notation, expanding any
+// exponent without going through a float so no digits are lost
+func formatDecimal(value string) string {
+	lower := strings.ToLower(value)
+	mantissa, exponent, found := strings.Cut(lower, "e")
+	if !found {
+		return value
+	}
+
+	rat, ok := new(big.Rat).SetString(lower)
+	if !ok {
+		return value
+	}
+
+	exp, err := strconv.Atoi(exponent)
+	if err != nil {
+		return value
+	}
+
+	scale := 0
+	if _, frac, ok := strings.Cut(mantissa, "."); ok {
+		scale = len(frac)
+	}
+	scale -= exp
+	if scale < 0 {
+		scale = 0
+	}
+
+	return rat.FloatString(scale)
+}
+
 // IsForeignKey checks if a column is likely a foreign key based on naming conventions
 func IsForeignKey(columnName string) bool {
 	columnName = strings.ToLower(columnName)
 	return strings.HasSuffix(columnName, "_id") && columnName != "id"
 }
 
-// DetectForeignKeysByConvention detects foreign keys based on naming conventions and table existence
+// DetectForeignKeysByConvention detects foreign keys based on naming conventions and table existence.
+// Tables and columns are visited in sorted order and candidates are tried in the
+// fixed priority of conventionCandidates, so the same database always yields the
+// same relationships.
 func (se *SchemaExtractor) DetectForeignKeysByConvention(ctx context.Context, schema *Schema) []ForeignKey {
 	var conventionFKs []ForeignKey
 
 	// Get list of existing tables for reference checking
 	existingTables := make(map[string]bool)
+	var tableNames []string
 	for tableName := range schema.Tables {
 		existingTables[tableName] = true
+		tableNames = append(tableNames, tableName)
 	}
+	sort.Strings(tableNames)
 
-	for tableName, table := range schema.Tables {
+	for _, tableName := range tableNames {
+		table := schema.Tables[tableName]
 		se.logger.Debug("Checking table for convention FKs", "table", tableName, "columns", len(table.Columns))
+
+		var columnNames []string
 		for columnName := range table.Columns {
+			columnNames = append(columnNames, columnName)
+		}
+		sort.Strings(columnNames)
+
+		for _, columnName := range columnNames {
 			if IsForeignKey(columnName) {
 				se.logger.Debug("Found potential FK column", "table", tableName, "column", columnName)
 				// Try to infer the referenced table name
@@ -418,52 +939,8 @@ func (se *SchemaExtractor) DetectForeignKeysByConvention(ctx context.Context, sc
 				var referencedTable string
 				var referencedColumn = "id" // Default assumption
 
-				// Try different table name patterns based on actual data patterns
-				candidates := []string{
-					// Direct patterns from actual database
-					"chorki_" + baseName,        // meta_id -> chorki_metas (but we need chorki_metas)
-					"chorki_" + baseName + "s",  // meta_id -> chorki_metas, series_id -> chorki_series
-					"chorki_" + baseName + "es", // video_id -> chorki_videos (special case)
-
-					// Handle special cases observed in the data
-					func() string {
-						switch baseName {
-						case "meta":
-							return "chorki_metas"
-						case "series":
-							return "chorki_series"
-						case "season":
-							return "chorki_seasons"
-						case "customer":
-							return "chorki_customers"
-						case "video":
-							return "chorki_videos"
-						case "stream":
-							return "chorki_streams"
-						case "content":
-							return "chorki_metas" // content_id likely references metas
-						case "profile":
-							return "chorki_customers" // profile_id likely references customers
-						case "parent":
-							return tableName // parent_id is self-referential
-						case "original":
-							return tableName // original_id is self-referential
-						case "seo_meta":
-							return "chorki_metas" // seo_meta_id references chorki_metas
-						case "ad_campaign":
-							return "chorki_metas" // ad_campaign_id references chorki_metas (or could be self-ref)
-						default:
-							return ""
-						}
-					}(),
-
-					// Generic patterns as fallback
-					baseName + "s", // user_id -> users
-					baseName,       // seo_meta -> seo_meta
-				}
-
-				for _, candidate := range candidates {
-					if candidate != "" && existingTables[candidate] {
+				for _, candidate := range conventionCandidates(tableName, baseName) {
+					if existingTables[candidate] {
 						referencedTable = candidate
 						break
 					}
@@ -477,6 +954,7 @@ func (se *SchemaExtractor) DetectForeignKeysByConvention(ctx context.Context, sc
 						ColumnName:     columnName,
 						RefTableName:   referencedTable,
 						RefColumnName:  referencedColumn,
+						Inferred:       "convention",
 						UpdateRule:     "CASCADE",
 						DeleteRule:     "RESTRICT",
 					}
@@ -498,3 +976,63 @@ func (se *SchemaExtractor) DetectForeignKeysByConvention(ctx context.Context, sc
 
 	return conventionFKs
 }
+
+// conventionCandidates returns the tables a "<base>_id" column may reference, in
+// priority order. The first existing table wins:
+//  1. known special cases observed in the source data (e.g. parent_id is self-referential)
+//  2. the exact singular name (user_id -> user)
+//  3. plural forms (user_id -> users, box_id -> boxes, category_id -> categories,
+//     person_id -> people)
+//  4. the same names with the "chorki_" table prefix
+func conventionCandidates(tableName, baseName string) []string {
+	var candidates []string
+
+	switch baseName {
+	case "meta":
+		candidates = append(candidates, "chorki_metas")
+	case "series":
+		candidates = append(candidates, "chorki_series")
+	case "season":
+		candidates = append(candidates, "chorki_seasons")
+	case "customer":
+		candidates = append(candidates, "chorki_customers")
+	case "video":
+		candidates = append(candidates, "chorki_videos")
+	case "stream":
+		candidates = append(candidates, "chorki_streams")
+	case "content":
+		candidates = append(candidates, "chorki_metas") // content_id likely references metas
+	case "profile":
+		candidates = append(candidates, "chorki_customers") // profile_id likely references customers
+	case "parent", "original":
+		candidates = append(candidates, tableName) // parent_id and original_id are self-referential
+	case "seo_meta":
+		candidates = append(candidates, "chorki_metas") // seo_meta_id references chorki_metas
+	case "ad_campaign":
+		candidates = append(candidates, "chorki_metas") // ad_campaign_id references chorki_metas (or could be self-ref)
+	}
+
+	names := []string{baseName, baseName + "s", baseName + "es"}
+	if strings.HasSuffix(baseName, "y") && len(baseName) > 1 {
+		names = append(names, baseName[:len(baseName)-1]+"ies")
+	}
+	if plural := pluralForm(baseName, nil); !containsName(names, plural) {
+		names = append(names, plural) // irregular plurals: person_id -> people
+	}
+
+	candidates = append(candidates, names...)
+	for _, name := range names {
+		candidates = append(candidates, "chorki_"+name)
+	}
+
+	return candidates
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
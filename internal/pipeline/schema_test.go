@@ -0,0 +1,637 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestDetectForeignKeysByConvention(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns map[string][]string
+		want    []string // table.column -> referenced table, in order
+	}{
+		{
+			name:    "exact singular wins over plural",
+			columns: map[string][]string{"user": nil, "users": nil, "orders": {"user_id"}},
+			want:    []string{"orders.user_id -> user"},
+		},
+		{
+			name:    "plural with s",
+			columns: map[string][]string{"users": nil, "orders": {"user_id"}},
+			want:    []string{"orders.user_id -> users"},
+		},
+		{
+			name:    "s wins over es",
+			columns: map[string][]string{"boxs": nil, "boxes": nil, "items": {"box_id"}},
+			want:    []string{"items.box_id -> boxs"},
+		},
+		{
+			name:    "ies plural",
+			columns: map[string][]string{"categories": nil, "posts": {"category_id"}},
+			want:    []string{"posts.category_id -> categories"},
+		},
+		{
+			name:    "irregular plural",
+			columns: map[string][]string{"people": nil, "visits": {"person_id"}},
+			want:    []string{"visits.person_id -> people"},
+		},
+		{
+			name:    "unprefixed table wins over the chorki_ prefix",
+			columns: map[string][]string{"tags": nil, "chorki_tags": nil, "posts": {"tag_id"}},
+			want:    []string{"posts.tag_id -> tags"},
+		},
+		{
+			name:    "parent_id is self-referential",
+			columns: map[string][]string{"parents": nil, "category": {"parent_id"}},
+			want:    []string{"category.parent_id -> category"},
+		},
+		{
+			name:    "tables and columns in sorted order",
+			columns: map[string][]string{"users": nil, "teams": nil, "tasks": {"user_id", "team_id"}, "events": {"user_id"}},
+			want:    []string{"events.user_id -> users", "tasks.team_id -> teams", "tasks.user_id -> users"},
+		},
+		{
+			name:    "no referenced table",
+			columns: map[string][]string{"orders": {"coupon_id"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor := NewSchemaExtractor(nil, logger.New("error", "text"), nil, nil)
+			// Map iteration order differs between runs; the result must not
+			for run := 0; run < 20; run++ {
+				var got []string
+				for _, fk := range extractor.DetectForeignKeysByConvention(context.Background(), fkSchema(tt.columns, nil)) {
+					if fk.Inferred != "convention" || fk.RefColumnName != "id" {
+						t.Errorf("foreign key %+v", fk)
+					}
+					got = append(got, fk.TableName+"."+fk.ColumnName+" -> "+fk.RefTableName)
+				}
+				if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+					t.Fatalf("run %d detected %q, want %q", run, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReversePredicateName(t *testing.T) {
+	tests := []struct {
+		table, column, ref string
+		want               string
+	}{
+		{"categories", "parent_id", "categories", "categories.children"},
+		{"categories", "Parent_ID", "categories", "categories.children"},
+		{"categories", "original_id", "categories", "categories.original_children"},
+		{"orders", "user_id", "users", "orders.user_id_reverse"},
+	}
+	for _, tt := range tests {
+		if got := ReversePredicateName(tt.table, tt.column, tt.ref); got != tt.want {
+			t.Errorf("ReversePredicateName(%s, %s, %s) = %q, want %q", tt.table, tt.column, tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"12345678.90", "12345678.90"},
+		{"123456789012.123456", "123456789012.123456"},
+		{"-0.05", "-0.05"},
+		{"1.5e3", "1500"},
+		{"-1E-6", "-0.000001"},
+		{"1.25E-2", "0.0125"},
+		{"12345678901234567.8901e2", "1234567890123456789.01"},
+		{"not a number", "not a number"},
+	}
+	for _, tt := range tests {
+		if got := formatDecimal(tt.value); got != tt.want {
+			t.Errorf("formatDecimal(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLToDgraphType(t *testing.T) {
+	tests := []struct {
+		mysqlType string
+		want      string
+	}{
+		{"tinyint(1)", "bool"},
+		{"TINYINT(1)", "bool"},
+		{"tinyint(1) unsigned", "bool"},
+		{"boolean", "bool"},
+		{"tinyint(4)", "int"},
+		{"tinyint", "int"}, // data_type alone has lost the display width
+		{"int(10) unsigned", "int"},
+		{"bigint unsigned", "int"},
+		{"decimal(10,2)", "float"},
+		{"double", "float"},
+		{"varchar(255)", "string"},
+		{"set('a','b')", "string"},
+		{"datetime(6)", "datetime"},
+		{"json", "string"},
+	}
+	for _, tt := range tests {
+		if got := MySQLToDgraphType(tt.mysqlType); got != tt.want {
+			t.Errorf("MySQLToDgraphType(%q) = %s, want %s", tt.mysqlType, got, tt.want)
+		}
+	}
+}
+
+func TestExtractSchemaColumnType(t *testing.T) {
+	info := &infoSchema{
+		columns: map[string][]fakeColumn{"users": {
+			{name: "id", dataType: "int", columnType: "int unsigned"},
+			{name: "active", dataType: "tinyint", columnType: "tinyint(1)"},
+			{name: "level", dataType: "tinyint", columnType: "tinyint(4)"},
+			{name: "name", dataType: "varchar", columnType: "varchar(255)"},
+		}},
+		primaryKeys: map[string][]string{"users": {"id"}},
+		rows:        map[string]*fakeTable{"users": {columns: []string{"id", "active", "level", "name"}}},
+	}
+	db, _ := newFakeDB(t, info.serve)
+	schema, err := NewSchemaExtractor(db, logger.New("error", "text"), nil, nil).ExtractSchema(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("ExtractSchema: %v", err)
+	}
+
+	tests := []struct {
+		column     string
+		columnType string
+		dgraphType string
+	}{
+		{"id", "int unsigned", "int"},
+		{"active", "tinyint(1)", "bool"},
+		{"level", "tinyint(4)", "int"},
+		{"name", "varchar(255)", "string"},
+	}
+	for _, tt := range tests {
+		column := schema.Tables["users"].Columns[tt.column]
+		if column == nil || column.ColumnType != tt.columnType {
+			t.Errorf("column %s = %+v, want column_type %s", tt.column, column, tt.columnType)
+			continue
+		}
+		if got := MySQLToDgraphType(column.FullType()); got != tt.dgraphType {
+			t.Errorf("column %s maps to %s, want %s", tt.column, got, tt.dgraphType)
+		}
+	}
+}
+
+func TestGeneratedColumn(t *testing.T) {
+	tests := []struct {
+		extra     string
+		generated bool
+		virtual   bool
+	}{
+		{extra: ""},
+		{extra: "auto_increment"},
+		{extra: "DEFAULT_GENERATED"},
+		{extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"},
+		{extra: "VIRTUAL GENERATED", generated: true, virtual: true},
+		{extra: "virtual generated", generated: true, virtual: true},
+		{extra: "STORED GENERATED", generated: true},
+		{extra: "PERSISTENT GENERATED", generated: true},
+	}
+	for _, tt := range tests {
+		generated, virtual := generatedColumn(tt.extra)
+		if generated != tt.generated || virtual != tt.virtual {
+			t.Errorf("generatedColumn(%q) = %v, %v, want %v, %v", tt.extra, generated, virtual, tt.generated, tt.virtual)
+		}
+	}
+}
+
+func TestExtractSchemaGeneratedColumns(t *testing.T) {
+	info := &infoSchema{
+		columns: map[string][]fakeColumn{"users": {
+			{name: "id", dataType: "int", columnType: "int", extra: "auto_increment"},
+			{name: "name", dataType: "varchar", columnType: "varchar(50)"},
+			{name: "full_name", dataType: "varchar", columnType: "varchar(60)", extra: "VIRTUAL GENERATED", generation: "concat(`name`,' ')"},
+			{name: "name_length", dataType: "int", columnType: "int", extra: "STORED GENERATED", generation: "char_length(`name`)"},
+		}},
+		primaryKeys: map[string][]string{"users": {"id"}},
+		rows:        map[string]*fakeTable{"users": {columns: []string{"id", "name", "full_name", "name_length"}}},
+	}
+	db, _ := newFakeDB(t, info.serve)
+	schema, err := NewSchemaExtractor(db, logger.New("error", "text"), nil, nil).ExtractSchema(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("ExtractSchema: %v", err)
+	}
+
+	tests := []struct {
+		column     string
+		generated  bool
+		virtual    bool
+		expression string
+	}{
+		{column: "id"},
+		{column: "name"},
+		{column: "full_name", generated: true, virtual: true, expression: "concat(`name`,' ')"},
+		{column: "name_length", generated: true, expression: "char_length(`name`)"},
+	}
+	for _, tt := range tests {
+		column := schema.Tables["users"].Columns[tt.column]
+		if column == nil {
+			t.Errorf("column %s missing", tt.column)
+			continue
+		}
+		if column.Generated != tt.generated || column.Virtual != tt.virtual || column.GenerationExpression != tt.expression {
+			t.Errorf("column %s generated %v virtual %v expression %q, want %v %v %q", tt.column,
+				column.Generated, column.Virtual, column.GenerationExpression, tt.generated, tt.virtual, tt.expression)
+		}
+	}
+}
+
+func TestExtractSchemaPartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions []Partition
+		want       []Partition
+	}{
+		{
+			name:       "partitions in definition order",
+			partitions: []Partition{{Name: "p2023", RowCount: 10}, {Name: "p2024", RowCount: 20}, {Name: "pmax", RowCount: 0}},
+			want:       []Partition{{Name: "p2023", RowCount: 10}, {Name: "p2024", RowCount: 20}, {Name: "pmax", RowCount: 0}},
+		},
+		{
+			name: "an unpartitioned table",
+		},
+		{
+			name:       "a partition name with a control character is not scanned",
+			partitions: []Partition{{Name: "p0", RowCount: 1}, {Name: "p\x001", RowCount: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &infoSchema{
+				columns:     map[string][]fakeColumn{"events": {{name: "id", dataType: "int", columnType: "int"}}},
+				primaryKeys: map[string][]string{"events": {"id"}},
+				partitions:  map[string][]Partition{"events": tt.partitions},
+				rows:        map[string]*fakeTable{"events": {columns: []string{"id"}}},
+			}
+			db, _ := newFakeDB(t, info.serve)
+			schema, err := NewSchemaExtractor(db, logger.New("error", "text"), nil, nil).ExtractSchema(context.Background(), "shop")
+			if err != nil {
+				t.Fatalf("ExtractSchema: %v", err)
+			}
+			if got := schema.Tables["events"].Partitions; !slices.Equal(got, tt.want) {
+				t.Errorf("partitions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectList(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []*Column
+		want    string
+	}{
+		{
+			name: "scalar columns stay bare",
+			columns: []*Column{
+				{Name: "id", Type: "int", Position: 1},
+				{Name: "name", Type: "varchar", Position: 2},
+				{Name: "avatar", Type: "blob", Position: 3},
+			},
+			want: "`id`, `name`, `avatar`",
+		},
+		{
+			name: "spatial columns as GeoJSON",
+			columns: []*Column{
+				{Name: "id", Type: "int", Position: 1},
+				{Name: "location", Type: "point", Position: 2},
+				{Name: "area", Type: "MULTIPOLYGON", Position: 3},
+			},
+			want: "`id`, ST_AsGeoJSON(`location`) AS `location`, ST_AsGeoJSON(`area`) AS `area`",
+		},
+		{
+			name: "JSON columns as text",
+			columns: []*Column{
+				{Name: "settings", Type: "json", Position: 2},
+				{Name: "id", Type: "int", Position: 1},
+			},
+			want: "`id`, CAST(`settings` AS CHAR) AS `settings`",
+		},
+		{name: "no columns", want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &Table{Name: "places", Columns: map[string]*Column{}}
+			for _, col := range tt.columns {
+				table.Columns[col.Name] = col
+			}
+			if got := table.SelectList(); got != tt.want {
+				t.Errorf("SelectList = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRowQueryWrapsSpatialAndJSON checks the row query the data phase sends
+func TestRowQueryWrapsSpatialAndJSON(t *testing.T) {
+	table := &fakeTable{columns: []string{"id", "location", "settings"}, rows: [][]driver.Value{
+		{int64(1), `{"type": "Point", "coordinates": [1, 2]}`, `{"a": 1}`},
+	}}
+	db, fake := newFakeDB(t, tablesHandler(map[string]*fakeTable{"places": table}))
+	schema := &Schema{Tables: map[string]*Table{"places": {
+		Name: "places",
+		Columns: map[string]*Column{
+			"id":       {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+			"location": {Name: "location", Type: "point", ColumnType: "point", Position: 2},
+			"settings": {Name: "settings", Type: "json", ColumnType: "json", Position: 3},
+		},
+		PrimaryKeys: []string{"id"},
+		RowCount:    1,
+	}}}
+	if err := testProcessor(testConfig(t)).ProcessTables(context.Background(), db, schema, []string{"places"}); err != nil {
+		t.Fatalf("ProcessTables: %v", err)
+	}
+
+	want := "SELECT `id`, ST_AsGeoJSON(`location`) AS `location`, CAST(`settings` AS CHAR) AS `settings` FROM `places`"
+	rowQueries := 0
+	for _, query := range fake.Queries() {
+		if !strings.Contains(query, "FROM `places`") || strings.HasPrefix(query, "SELECT COUNT") {
+			continue
+		}
+		rowQueries++
+		if !strings.HasPrefix(query, want) {
+			t.Errorf("row query %q, want it to start with %q", query, want)
+		}
+	}
+	if rowQueries == 0 {
+		t.Errorf("no row query sent: %v", fake.Queries())
+	}
+}
+
+func TestIsBinaryType(t *testing.T) {
+	for _, mysqlType := range []string{"binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "BLOB"} {
+		if !IsBinaryType(mysqlType) {
+			t.Errorf("IsBinaryType(%q) = false", mysqlType)
+		}
+	}
+	for _, mysqlType := range []string{"char", "varchar", "text", "longtext", "bit", "json", "geometry"} {
+		if IsBinaryType(mysqlType) {
+			t.Errorf("IsBinaryType(%q) = true", mysqlType)
+		}
+	}
+}
+
+func TestForwardPredicateName(t *testing.T) {
+	schema := fkSchema(map[string][]string{
+		"category": {"parent_id", "original_id"},
+		"nodes":    {"parent_id", "parent"},
+		"orders":   {"user_id"},
+	}, nil)
+	tests := []struct {
+		table, column, ref string
+		want               string
+	}{
+		{"category", "parent_id", "category", "category.parent"},
+		{"category", "original_id", "category", "category.original"},
+		// The shorter name is taken by a column
+		{"nodes", "parent_id", "nodes", "nodes.parent_id"},
+		{"orders", "user_id", "users", "orders.user_id"},
+	}
+	for _, tt := range tests {
+		if got := ForwardPredicateName(schema, tt.table, tt.column, tt.ref); got != tt.want {
+			t.Errorf("ForwardPredicateName(%s, %s, %s) = %q, want %q", tt.table, tt.column, tt.ref, got, tt.want)
+		}
+	}
+}
+
+// TestSelfReferencingHierarchy exports a category tree and checks its parent
+// and children edges link category nodes, as declared in the schema
+func TestSelfReferencingHierarchy(t *testing.T) {
+	tests := []struct {
+		reverseEdges string
+		declared     []string
+		edges        []string
+	}{
+		{
+			reverseEdges: "manual",
+			declared:     []string{"category.parent: uid .", "category.children: [uid] ."},
+			edges: []string{
+				"_:category_1 <category.children> _:category_2",
+				"_:category_1 <category.children> _:category_3",
+				"_:category_2 <category.children> _:category_4",
+				"_:category_2 <category.parent> _:category_1",
+				"_:category_3 <category.parent> _:category_1",
+				"_:category_4 <category.parent> _:category_2",
+			},
+		},
+		{
+			reverseEdges: "directive",
+			declared:     []string{"category.parent: uid @reverse ."},
+			edges: []string{
+				"_:category_2 <category.parent> _:category_1",
+				"_:category_3 <category.parent> _:category_1",
+				"_:category_4 <category.parent> _:category_2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reverseEdges, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Output.ReverseEdges = tt.reverseEdges
+			tree := func() *Schema {
+				return fkSchema(map[string][]string{"category": {"parent_id"}}, [][3]string{{"category", "parent_id", "category"}})
+			}
+			lines := processRDF(t, cfg, tree(), map[string]*fakeTable{"category": {
+				columns: []string{"id", "parent_id"},
+				rows: [][]driver.Value{
+					{int64(1), nil}, {int64(2), int64(1)}, {int64(3), int64(1)}, {int64(4), int64(2)},
+				},
+			}})
+
+			var edges []string
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				if strings.HasPrefix(fields[2], "_:") {
+					edges = append(edges, strings.Join(fields[:3], " "))
+					if !strings.HasPrefix(fields[0], "_:category_") || !strings.HasPrefix(fields[2], "_:category_") {
+						t.Errorf("edge leaves the category type: %s", line)
+					}
+				}
+				if strings.Contains(line, "parent_id") {
+					t.Errorf("column-named predicate written: %s", line)
+				}
+			}
+			slices.Sort(edges)
+			if !slices.Equal(edges, tt.edges) {
+				t.Errorf("edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(tt.edges, "\n"))
+			}
+
+			generator := NewSchemaGenerator(cfg, logger.New("error", "text"))
+			predicates, types, err := generator.build(tree())
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			rendered, err := generator.renderSchema(predicates, types)
+			if err != nil {
+				t.Fatalf("renderSchema: %v", err)
+			}
+			for _, want := range tt.declared {
+				if !strings.Contains(string(rendered), "\n"+want+"\n") {
+					t.Errorf("schema lacks %q:\n%s", want, rendered)
+				}
+				name, _, _ := strings.Cut(want, ":")
+				if !slices.Contains(types["category"], name) {
+					t.Errorf("type category lacks %s: %v", name, types["category"])
+				}
+			}
+		})
+	}
+}
+
+// adversarialNames are table and column names crafted to break out of a
+// query's quoting, or that are merely unusual
+var adversarialNames = []string{
+	"foo`; DROP TABLE bar; --",
+	"users` WHERE 1=1 --",
+	"a'b",
+	`a"b`,
+	"x; DELETE FROM users",
+	"name/*comment*/",
+	"line\nbreak",
+	"order items",
+	"customer-ref",
+	"naïve",
+	"tab\tle",
+	"semi;colon",
+	"",
+}
+
+func TestCheckIdentifier(t *testing.T) {
+	for _, name := range adversarialNames {
+		if err := checkIdentifier("table", name); err == nil {
+			t.Errorf("checkIdentifier(%q) accepted the name", name)
+		} else if !strings.Contains(err.Error(), "not allowed in queries") {
+			t.Errorf("checkIdentifier(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"users", "order", "select", "t$1", "_tmp", "2024_sales", "UPPER"} {
+		if err := checkIdentifier("table", name); err != nil {
+			t.Errorf("checkIdentifier(%q) = %v", name, err)
+		}
+	}
+	if err := checkIdentifiers("orders", "user_id", "users", "id`--"); err == nil {
+		t.Error("checkIdentifiers accepted a foreign key with an adversarial column")
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"order", "`order`"},
+		{"a`b", "`a``b`"},
+		{"foo`; DROP TABLE bar; --", "`foo``; DROP TABLE bar; --`"},
+	}
+	for _, tt := range tests {
+		if got := quoteIdent(tt.name); got != tt.want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := quoteTable("sales.order"); got != "`sales`.`order`" {
+		t.Errorf("quoteTable(sales.order) = %s", got)
+	}
+}
+
+// TestExtractSchemaSkipsAdversarialNames extracts a database whose
+// information_schema lists adversarial tables, columns and foreign keys, and
+// checks that none of them reaches a query or the schema
+func TestExtractSchemaSkipsAdversarialNames(t *testing.T) {
+	for _, name := range adversarialNames {
+		t.Run(strings.ReplaceAll(name, "\n", `\n`), func(t *testing.T) {
+			info := &infoSchema{
+				columns: map[string][]fakeColumn{
+					"users":  {{name: "id", dataType: "int", columnType: "int"}},
+					"orders": {{name: "id", dataType: "int", columnType: "int"}, {name: "user_id", dataType: "int", columnType: "int"}},
+					name:     {{name: "id", dataType: "int", columnType: "int"}},
+					"notes":  {{name: "id", dataType: "int", columnType: "int"}, {name: name, dataType: "text", columnType: "text"}},
+				},
+				primaryKeys: map[string][]string{"users": {"id"}, "orders": {"id"}},
+				foreignKeys: []ForeignKey{
+					{ConstraintName: "orders_user", TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id"},
+					{ConstraintName: "orders_bad", TableName: "orders", ColumnName: "user_id", RefTableName: name, RefColumnName: "id"},
+					{ConstraintName: "bad_orders", TableName: name, ColumnName: "order_id", RefTableName: "orders", RefColumnName: "id"},
+				},
+				rows: map[string]*fakeTable{
+					"users":  {columns: []string{"id"}},
+					"orders": {columns: []string{"id", "user_id"}},
+				},
+			}
+			db, fake := newFakeDB(t, info.serve)
+
+			extractor := NewSchemaExtractor(db, logger.New("error", "text"), nil, nil)
+			schema, err := extractor.ExtractSchema(context.Background(), "shop")
+			if err != nil {
+				t.Fatalf("ExtractSchema: %v", err)
+			}
+
+			if len(schema.Tables) != 2 || schema.Tables["users"] == nil || schema.Tables["orders"] == nil {
+				t.Errorf("tables = %v, want users and orders", tableNames(schema))
+			}
+			var declared []string
+			for _, fk := range schema.Relationships {
+				if fk.Inferred == "" {
+					declared = append(declared, fk.ConstraintName)
+				}
+			}
+			if len(declared) != 1 || declared[0] != "orders_user" {
+				t.Errorf("declared relationships = %v, want orders_user only", declared)
+			}
+			for _, query := range fake.Queries() {
+				if name != "" && strings.Contains(query, name) {
+					t.Errorf("query contains %q:\n%s", name, query)
+				}
+			}
+		})
+	}
+}
+
+func tableNames(schema *Schema) []string {
+	var names []string
+	for name := range schema.Tables {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestTableNamedOrder(t *testing.T) {
+	// Reserved words are valid identifiers and are quoted, never rejected
+	info := &infoSchema{
+		columns:     map[string][]fakeColumn{"order": {{name: "id", dataType: "int", columnType: "int"}, {name: "select", dataType: "varchar", columnType: "varchar(10)"}}},
+		primaryKeys: map[string][]string{"order": {"id"}},
+		rows: map[string]*fakeTable{"order": {columns: []string{"id", "select"}, rows: [][]driver.Value{
+			{int64(1), "a"}, {int64(2), "b"},
+		}}},
+	}
+	db, fake := newFakeDB(t, info.serve)
+
+	schema, err := NewSchemaExtractor(db, logger.New("error", "text"), nil, nil).ExtractSchema(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("ExtractSchema: %v", err)
+	}
+	if table := schema.Tables["order"]; table == nil || table.RowCount != 2 {
+		t.Fatalf("order table = %+v, want 2 rows", table)
+	}
+	found := false
+	for _, query := range fake.Queries() {
+		if strings.HasPrefix(query, "SELECT COUNT(*) FROM `order`") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no quoted row count of order in %q", fake.Queries())
+	}
+}
@@ -0,0 +1,362 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/importer"
+)
+
+// SchemaDiff compares the schema generated from MySQL with the schema live
+// in Dgraph. Added means present only in the MySQL side, removed only in
+// Dgraph. Dgraph's own dgraph.* predicates and types are ignored.
+type SchemaDiff struct {
+	DgraphEmpty       bool            `json:"dgraph_empty"` // Dgraph has no schema of its own yet
+	AddedPredicates   []string        `json:"added_predicates"`
+	RemovedPredicates []string        `json:"removed_predicates"`
+	ChangedPredicates []PredicateDiff `json:"changed_predicates"`
+	AddedTypes        []string        `json:"added_types"`
+	RemovedTypes      []string        `json:"removed_types"`
+	ChangedTypes      []TypeDiff      `json:"changed_types"`
+}
+
+// PredicateDiff is a predicate declared differently on the two sides
+type PredicateDiff struct {
+	Predicate   string `json:"predicate"`
+	MySQL       string `json:"mysql"`        // Declaration generated from MySQL
+	Dgraph      string `json:"dgraph"`       // Declaration live in Dgraph
+	TypeChanged bool   `json:"type_changed"` // The value type differs, not only directives
+}
+
+// TypeDiff is a type whose fields differ
+type TypeDiff struct {
+	Type          string   `json:"type"`
+	AddedFields   []string `json:"added_fields"`
+	RemovedFields []string `json:"removed_fields"`
+}
+
+// SafeToAlter reports whether applying the generated schema changes no
+// predicate's value type. Alter never drops predicates or types, and index
+// and directive changes only trigger reindexing.
+func (d *SchemaDiff) SafeToAlter() bool {
+	for _, change := range d.ChangedPredicates {
+		if change.TypeChanged {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the two schemas match
+func (d *SchemaDiff) Empty() bool {
+	return len(d.AddedPredicates)+len(d.RemovedPredicates)+len(d.ChangedPredicates)+
+		len(d.AddedTypes)+len(d.RemovedTypes)+len(d.ChangedTypes) == 0
+}
+
+// WriteText writes the diff as a human-readable report
+func (d *SchemaDiff) WriteText(w io.Writer) {
+	if d.DgraphEmpty {
+		fmt.Fprintln(w, "Dgraph has no schema yet; every predicate and type would be added.")
+	}
+	list := func(title string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d):\n", title, len(names))
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+	list("Predicates only in MySQL", d.AddedPredicates)
+	list("Predicates only in Dgraph", d.RemovedPredicates)
+	if len(d.ChangedPredicates) > 0 {
+		fmt.Fprintf(w, "Changed predicates (%d):\n", len(d.ChangedPredicates))
+		for _, change := range d.ChangedPredicates {
+			marker := ""
+			if change.TypeChanged {
+				marker = "  [type change]"
+			}
+			fmt.Fprintf(w, "  %s: %s -> %s%s\n", change.Predicate, change.Dgraph, change.MySQL, marker)
+		}
+	}
+	list("Types only in MySQL", d.AddedTypes)
+	list("Types only in Dgraph", d.RemovedTypes)
+	if len(d.ChangedTypes) > 0 {
+		fmt.Fprintf(w, "Changed types (%d):\n", len(d.ChangedTypes))
+		for _, change := range d.ChangedTypes {
+			fmt.Fprintf(w, "  %s: +%s -%s\n", change.Type,
+				strings.Join(change.AddedFields, ","), strings.Join(change.RemovedFields, ","))
+		}
+	}
+
+	switch {
+	case d.Empty():
+		fmt.Fprintln(w, "Schemas match.")
+	case d.SafeToAlter():
+		fmt.Fprintln(w, "Alter is safe: no predicate changes its value type.")
+	default:
+		fmt.Fprintln(w, "Alter is NOT safe: some predicates change their value type.")
+	}
+}
+
+// dgraphSchemaResponse is the result of the DQL "schema {}" query
+type dgraphSchemaResponse struct {
+	Schema []struct {
+		Predicate  string   `json:"predicate"`
+		Type       string   `json:"type"`
+		Index      bool     `json:"index"`
+		Tokenizer  []string `json:"tokenizer"`
+		Reverse    bool     `json:"reverse"`
+		Count      bool     `json:"count"`
+		List       bool     `json:"list"`
+		Upsert     bool     `json:"upsert"`
+		Lang       bool     `json:"lang"`
+		NoConflict bool     `json:"no_conflict"`
+	} `json:"schema"`
+	Types []struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	} `json:"types"`
+}
+
+// parseDgraphSchema converts a "schema {}" result into the form ParseSchema
+// returns, leaving out dgraph.* predicates, types and fields
+func parseDgraphSchema(data []byte) (map[string]SchemaPredicate, map[string][]string, error) {
+	var resp dgraphSchemaResponse
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode Dgraph schema: %w", err)
+		}
+	}
+
+	predicates := make(map[string]SchemaPredicate)
+	for _, p := range resp.Schema {
+		if isDgraphInternal(p.Predicate) {
+			continue
+		}
+		pred := SchemaPredicate{Name: p.Predicate, Type: p.Type, List: p.List}
+		if p.Index {
+			pred.Directives = append(pred.Directives, "@index("+strings.Join(p.Tokenizer, ",")+")")
+		}
+		for _, d := range []struct {
+			set  bool
+			name string
+		}{{p.Reverse, "@reverse"}, {p.Count, "@count"}, {p.Upsert, "@upsert"}, {p.Lang, "@lang"}, {p.NoConflict, "@noconflict"}} {
+			if d.set {
+				pred.Directives = append(pred.Directives, d.name)
+			}
+		}
+		predicates[pred.Name] = pred
+	}
+
+	types := make(map[string][]string)
+	for _, t := range resp.Types {
+		if isDgraphInternal(t.Name) {
+			continue
+		}
+		fields := []string{}
+		for _, f := range t.Fields {
+			fields = append(fields, f.Name)
+		}
+		types[t.Name] = fields
+	}
+	return predicates, types, nil
+}
+
+func isDgraphInternal(name string) bool {
+	return strings.HasPrefix(name, "dgraph.")
+}
+
+// predicateDeclaration renders a predicate's type and directives in a
+// canonical form: directives sorted, index tokenizers sorted without spaces
+func predicateDeclaration(pred SchemaPredicate) string {
+	typ := pred.Type
+	if pred.List {
+		typ = "[" + typ + "]"
+	}
+
+	// Rejoin index arguments a schema file split at ", "
+	joined := strings.Join(pred.Directives, " ")
+	for strings.Contains(joined, ", ") {
+		joined = strings.ReplaceAll(joined, ", ", ",")
+	}
+
+	var directives []string
+	for _, directive := range strings.Fields(joined) {
+		if args, ok := strings.CutPrefix(directive, "@index("); ok {
+			tokenizers := strings.Split(strings.TrimSuffix(args, ")"), ",")
+			for i := range tokenizers {
+				tokenizers[i] = strings.TrimSpace(tokenizers[i])
+			}
+			sort.Strings(tokenizers)
+			directive = "@index(" + strings.Join(tokenizers, ",") + ")"
+		}
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives)
+	return strings.TrimSpace(typ + " " + strings.Join(directives, " "))
+}
+
+// diffSchemas compares the MySQL-generated schema (want) with Dgraph's (have)
+func diffSchemas(wantPreds map[string]SchemaPredicate, wantTypes map[string][]string,
+	havePreds map[string]SchemaPredicate, haveTypes map[string][]string) *SchemaDiff {
+
+	diff := &SchemaDiff{DgraphEmpty: len(havePreds) == 0 && len(haveTypes) == 0}
+
+	for name, want := range wantPreds {
+		if isDgraphInternal(name) {
+			continue
+		}
+		have, ok := havePreds[name]
+		if !ok {
+			diff.AddedPredicates = append(diff.AddedPredicates, name)
+			continue
+		}
+		wantDecl, haveDecl := predicateDeclaration(want), predicateDeclaration(have)
+		if wantDecl != haveDecl {
+			diff.ChangedPredicates = append(diff.ChangedPredicates, PredicateDiff{
+				Predicate:   name,
+				MySQL:       wantDecl,
+				Dgraph:      haveDecl,
+				TypeChanged: want.Type != have.Type || want.List != have.List,
+			})
+		}
+	}
+	for name := range havePreds {
+		if _, ok := wantPreds[name]; !ok {
+			diff.RemovedPredicates = append(diff.RemovedPredicates, name)
+		}
+	}
+
+	for name, wantFields := range wantTypes {
+		haveFields, ok := haveTypes[name]
+		if !ok {
+			diff.AddedTypes = append(diff.AddedTypes, name)
+			continue
+		}
+		change := TypeDiff{
+			Type:          name,
+			AddedFields:   fieldsMissing(wantFields, haveFields),
+			RemovedFields: fieldsMissing(haveFields, wantFields),
+		}
+		if len(change.AddedFields) > 0 || len(change.RemovedFields) > 0 {
+			diff.ChangedTypes = append(diff.ChangedTypes, change)
+		}
+	}
+	for name := range haveTypes {
+		if _, ok := wantTypes[name]; !ok {
+			diff.RemovedTypes = append(diff.RemovedTypes, name)
+		}
+	}
+
+	sort.Strings(diff.AddedPredicates)
+	sort.Strings(diff.RemovedPredicates)
+	sort.Slice(diff.ChangedPredicates, func(i, j int) bool {
+		return diff.ChangedPredicates[i].Predicate < diff.ChangedPredicates[j].Predicate
+	})
+	sort.Strings(diff.AddedTypes)
+	sort.Strings(diff.RemovedTypes)
+	sort.Slice(diff.ChangedTypes, func(i, j int) bool {
+		return diff.ChangedTypes[i].Type < diff.ChangedTypes[j].Type
+	})
+	return diff
+}
+
+// fieldsMissing returns the fields of a, other than dgraph.* ones, that b lacks
+func fieldsMissing(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, field := range b {
+		present[field] = true
+	}
+	var missing []string
+	for _, field := range a {
+		if !present[field] && !isDgraphInternal(field) {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// DiffSchema compares the schema generated from the current MySQL schema
+// with the one live in Dgraph, fetched with the DQL "schema {}" query through
+// dgraph.transport. The report is written as JSON to
+// output.schema_diff_file and returned.
+func (p *Pipeline) DiffSchema() (*SchemaDiff, error) {
+	schema, err := p.loadSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract schema: %w", err)
+	}
+
+	transport, err := importer.NewTransport(p.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Dgraph: %w", err)
+	}
+	defer transport.Close()
+
+	return p.diffSchema(schema, transport)
+}
+
+// diffSchema compares the schema generated from schema with the one the
+// transport's Alpha serves and writes the report
+func (p *Pipeline) diffSchema(schema *Schema, transport importer.Transport) (*SchemaDiff, error) {
+	content, err := NewSchemaGenerator(p.cfg, p.logger).Render(schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema generation failed: %w", err)
+	}
+	wantPreds, wantTypes, err := ParseSchema(strings.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated schema: %w", err)
+	}
+
+	var data json.RawMessage
+	err = p.processor.retries.Do(p.ctx, p.cfg.Dgraph.MaxRetries, p.cfg.Dgraph.RetryDelay,
+		func(attempt int, err error) {
+			p.logger.Warn("Retrying schema query", "attempt", attempt, "error", err)
+		},
+		func() error {
+			var err error
+			data, err = transport.Query(p.ctx, "schema {}")
+			return err
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Dgraph schema: %w", err)
+	}
+	havePreds, haveTypes, err := parseDgraphSchema(data)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffSchemas(wantPreds, wantTypes, havePreds, haveTypes)
+
+	encoded, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema diff: %w", err)
+	}
+	if err := os.MkdirAll(p.cfg.Output.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	reportPath := filepath.Join(p.cfg.Output.Directory, p.cfg.Output.SchemaDiffFile)
+	if err := os.WriteFile(reportPath, encoded, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write schema diff: %w", err)
+	}
+
+	p.logger.Info("Schema diff written",
+		"file", reportPath,
+		"dgraph_empty", diff.DgraphEmpty,
+		"added_predicates", len(diff.AddedPredicates),
+		"removed_predicates", len(diff.RemovedPredicates),
+		"changed_predicates", len(diff.ChangedPredicates),
+		"added_types", len(diff.AddedTypes),
+		"removed_types", len(diff.RemovedTypes),
+		"changed_types", len(diff.ChangedTypes),
+		"safe_to_alter", diff.SafeToAlter())
+	return diff, nil
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// schemaTransport answers every query with the "schema {}" result schema
+type schemaTransport struct {
+	sinkTransport
+	schema  string
+	queries []string
+}
+
+func (f *schemaTransport) Query(_ context.Context, query string) (json.RawMessage, error) {
+	f.queries = append(f.queries, query)
+	return json.RawMessage(f.schema), nil
+}
+
+func TestDiffSchemaThroughTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		empty   bool
+		added   []string
+		removed []string
+		changed []string
+		safe    bool
+	}{
+		{
+			name:  "empty Dgraph",
+			empty: true,
+			added: []string{"users.id", "users.name"},
+			safe:  true,
+		},
+		{
+			name: "matching schema",
+			schema: `{"schema":[
+				{"predicate":"dgraph.type","type":"string","index":true,"tokenizer":["exact"],"list":true},
+				{"predicate":"users.id","type":"int","index":true,"tokenizer":["int"],"upsert":true},
+				{"predicate":"users.name","type":"string","index":true,"tokenizer":["term"]}],
+				"types":[{"name":"users","fields":[{"name":"users.id"},{"name":"users.name"}]}]}`,
+			safe: true,
+		},
+		{
+			name: "changed value type and extra predicate",
+			schema: `{"schema":[
+				{"predicate":"users.id","type":"string","index":true,"tokenizer":["exact"]},
+				{"predicate":"users.name","type":"string","index":true,"tokenizer":["term"]},
+				{"predicate":"users.legacy","type":"string"}],
+				"types":[{"name":"users","fields":[{"name":"users.id"},{"name":"users.name"}]}]}`,
+			removed: []string{"users.legacy"},
+			changed: []string{"users.id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			p := &Pipeline{cfg: cfg, logger: logger.New("error", "text"), ctx: context.Background(), processor: testProcessor(cfg)}
+			transport := &schemaTransport{schema: tt.schema}
+
+			diff, err := p.diffSchema(usersSchema(1), transport)
+			if err != nil {
+				t.Fatalf("diffSchema: %v", err)
+			}
+			if len(transport.queries) != 1 || transport.queries[0] != "schema {}" {
+				t.Errorf("queries = %q, want one schema {} query", transport.queries)
+			}
+			if diff.DgraphEmpty != tt.empty {
+				t.Errorf("DgraphEmpty = %v, want %v", diff.DgraphEmpty, tt.empty)
+			}
+			if !equalStrings(diff.AddedPredicates, tt.added) || !equalStrings(diff.RemovedPredicates, tt.removed) {
+				t.Errorf("added %v removed %v, want %v and %v", diff.AddedPredicates, diff.RemovedPredicates, tt.added, tt.removed)
+			}
+			var changed []string
+			for _, change := range diff.ChangedPredicates {
+				changed = append(changed, change.Predicate)
+			}
+			if !equalStrings(changed, tt.changed) {
+				t.Errorf("changed %v, want %v", changed, tt.changed)
+			}
+			if diff.SafeToAlter() != tt.safe {
+				t.Errorf("SafeToAlter = %v, want %v", diff.SafeToAlter(), tt.safe)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.Output.Directory, cfg.Output.SchemaDiffFile)); err != nil {
+				t.Errorf("report not written: %v", err)
+			}
+		})
+	}
+}
+
+// equalStrings reports whether a and b hold the same strings in order,
+// treating nil and empty alike
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
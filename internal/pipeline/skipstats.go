@@ -0,0 +1,176 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// SkipReason identifies why a value or row was not emitted
+type SkipReason string
+
+const (
+	SkipNullValue          SkipReason = "null_value"           // Column value was NULL
+	SkipEmptyString        SkipReason = "empty_string"         // Foreign key value was an empty string
+	SkipConversionFailed   SkipReason = "conversion_failed"    // Value could not be converted to its target type
+	SkipScanFailed         SkipReason = "scan_failed"          // Row could not be scanned from MySQL
+	SkipRowConversion      SkipReason = "row_conversion"       // Row could not be converted to RDF
+	SkipMissingPrimaryKey  SkipReason = "missing_primary_key"  // Row had a NULL primary key value and no key_columns label
+	SkipInvalidDate        SkipReason = "invalid_date"         // Date such as 0000-00-00 dropped by invalid_date_policy skip
+	SkipOversizedRow       SkipReason = "oversized_row"        // Row had a triple longer than the RDF readers accept
+	SkipOrphanedForeignKey SkipReason = "orphaned_foreign_key" // Foreign key value with no referenced row; its edge leads to a node without data
+)
+
+// SkipStats tallies data that was not emitted, per table and reason
+type SkipStats struct {
+	mu     sync.Mutex
+	counts map[string]map[SkipReason]int64
+}
+
+func NewSkipStats() *SkipStats {
+	return &SkipStats{
+		counts: make(map[string]map[SkipReason]int64),
+	}
+}
+
+// Add records a single skipped value or row
+func (s *SkipStats) Add(table string, reason SkipReason) {
+	s.AddN(table, reason, 1)
+}
+
+// AddN records n skipped values or rows
+func (s *SkipStats) AddN(table string, reason SkipReason, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts[table] == nil {
+		s.counts[table] = make(map[SkipReason]int64)
+	}
+	s.counts[table][reason] += n
+}
+
+// Count returns the number of skips recorded for a table and reason
+func (s *SkipStats) Count(table string, reason SkipReason) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[table][reason]
+}
+
+// Snapshot returns a copy of all counts keyed by table and reason
+func (s *SkipStats) Snapshot() map[string]map[SkipReason]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]map[SkipReason]int64, len(s.counts))
+	for table, reasons := range s.counts {
+		result[table] = make(map[SkipReason]int64, len(reasons))
+		for reason, count := range reasons {
+			result[table][reason] = count
+		}
+	}
+	return result
+}
+
+// Total returns the number of skips across all tables and reasons
+func (s *SkipStats) Total() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, reasons := range s.counts {
+		for _, count := range reasons {
+			total += count
+		}
+	}
+	return total
+}
+
+// LogSummary logs one line per table and reason in a stable order
+func (s *SkipStats) LogSummary(logger *logger.Logger) {
+	snapshot := s.Snapshot()
+
+	var tables []string
+	for table := range snapshot {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	logger.Info("Skipped data summary", "total_skipped", s.Total(), "tables", len(tables))
+
+	for _, table := range tables {
+		var reasons []string
+		for reason := range snapshot[table] {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+
+		for _, reason := range reasons {
+			logger.Info("Skipped data",
+				"table", table,
+				"reason", reason,
+				"count", snapshot[table][SkipReason(reason)])
+		}
+	}
+}
+
+// countOrphanedForeignKeys tallies, for every foreign key of the exported
+// tables, the values whose referenced row does not exist. Only rows the
+// table filter selects are counted, and empty values, tallied as
+// empty_string when written, are left out. Like isForeignKey, only the first
+// relationship of a column counts, so a declared key that naming conventions
+// also detect is counted once. A failed count is logged and left out of the
+// tally.
+func (dp *DataProcessor) countOrphanedForeignKeys(ctx context.Context, db *sql.DB, schema *Schema, tables []string) {
+	exported := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		exported[table] = true
+	}
+
+	counted := make(map[string]bool)
+	for _, fk := range schema.Relationships {
+		// Masked values are written as data, not as edges
+		if !exported[fk.TableName] || dp.cfg.Pipeline.ColumnRule(fk.TableName, fk.ColumnName) != "" {
+			continue
+		}
+		column := fk.TableName + "." + fk.ColumnName
+		if counted[column] {
+			continue
+		}
+		counted[column] = true
+		if schema.Tables[fk.RefTableName] == nil {
+			continue
+		}
+
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM (SELECT %s AS fk FROM %s%s) child LEFT JOIN %s parent ON child.fk = parent.%s WHERE child.fk IS NOT NULL AND CAST(child.fk AS CHAR) <> '' AND parent.%s IS NULL`,
+			quoteIdent(fk.ColumnName), quoteTable(fk.TableName), dp.where(fk.TableName),
+			quoteTable(fk.RefTableName), quoteIdent(fk.RefColumnName), quoteIdent(fk.RefColumnName))
+
+		orphans, err := dp.countOrphans(ctx, db, query)
+		if err != nil {
+			dp.logger.Warn("Failed to count orphaned foreign keys",
+				"table", fk.TableName,
+				"column", fk.ColumnName,
+				"error", err)
+			continue
+		}
+		if orphans > 0 {
+			dp.skipStats.AddN(fk.TableName, SkipOrphanedForeignKey, orphans)
+		}
+	}
+}
+
+// countOrphans runs one orphaned foreign key count under the query limiter
+func (dp *DataProcessor) countOrphans(ctx context.Context, db *sql.DB, query string) (int64, error) {
+	if err := dp.limiter.Acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer dp.limiter.Release()
+
+	var orphans int64
+	err := db.QueryRowContext(ctx, query).Scan(&orphans)
+	return orphans, err
+}
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+// withMaxLineBytes lowers the longest RDF line accepted for a test
+func withMaxLineBytes(t *testing.T, n int) {
+	old := maxRDFLineBytes
+	maxRDFLineBytes = n
+	t.Cleanup(func() { maxRDFLineBytes = old })
+}
+
+// skipSchema is users with a derived predicate on age, and orders whose
+// user_id references users, both declared and by naming convention
+func skipSchema() *Schema {
+	return &Schema{
+		Tables: map[string]*Table{
+			"users": {
+				Name: "users",
+				Columns: map[string]*Column{
+					"id":   {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+					"name": {Name: "name", Type: "varchar", ColumnType: "varchar(500)", Position: 2},
+					"age":  {Name: "age", Type: "varchar", ColumnType: "varchar(10)", Position: 3},
+				},
+				PrimaryKeys: []string{"id"},
+			},
+			"orders": {
+				Name: "orders",
+				Columns: map[string]*Column{
+					"id":      {Name: "id", Type: "int", ColumnType: "int", Position: 1},
+					"user_id": {Name: "user_id", Type: "varchar", ColumnType: "varchar(10)", Position: 2},
+				},
+				PrimaryKeys: []string{"id"},
+			},
+		},
+		Relationships: []ForeignKey{
+			{TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id"},
+			{TableName: "orders", ColumnName: "user_id", RefTableName: "users", RefColumnName: "id", Inferred: "convention"},
+		},
+	}
+}
+
+func TestSkipAccounting(t *testing.T) {
+	withMaxLineBytes(t, 200)
+	cfg := testConfig(t)
+	cfg.Output.ChunkSize = 1000
+	cfg.Output.DerivedPredicates = map[string]string{"users.double_age": "age * 2"}
+
+	users := &fakeTable{columns: []string{"id", "name", "age"}, rows: [][]driver.Value{
+		{int64(1), "ann", "30"},
+		{int64(2), nil, "thirty"},                  // NULL name, age the derived predicate cannot multiply
+		{nil, "ghost", "5"},                        // No primary key
+		{int64(4), strings.Repeat("x", 300), "40"}, // Name longer than a line may be
+	}}
+	orders := &fakeTable{columns: []string{"id", "user_id"}, rows: [][]driver.Value{
+		{int64(10), "1"},
+		{int64(11), "99"}, // No such user
+		{int64(12), nil},
+		{int64(13), ""},
+	}}
+	db, _ := newFakeDB(t, tablesHandler(map[string]*fakeTable{"users": users, "orders": orders}))
+
+	processor := testProcessor(cfg)
+	exporter := NewChunkedExporter(cfg, logger.New("error", "text"), cfg.Output.Directory, cfg.Output.ChunkSize)
+	if _, err := exporter.ExportInChunks(context.Background(), processor, db, skipSchema(), []string{"users", "orders"}); err != nil {
+		t.Fatalf("ExportInChunks: %v", err)
+	}
+	manifest, err := LoadChunkManifest(filepath.Join(cfg.Output.Directory, cfg.Output.ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table  string
+		reason SkipReason
+		count  int64
+	}{
+		{"users", SkipNullValue, 1},
+		{"users", SkipConversionFailed, 1},
+		{"users", SkipMissingPrimaryKey, 1},
+		{"users", SkipOversizedRow, 1},
+		{"users", SkipOrphanedForeignKey, 0},
+		{"orders", SkipNullValue, 1},
+		{"orders", SkipEmptyString, 1},
+		{"orders", SkipOrphanedForeignKey, 1},
+		{"orders", SkipMissingPrimaryKey, 0},
+	}
+	for _, tt := range tests {
+		if got := processor.SkipStats().Count(tt.table, tt.reason); got != tt.count {
+			t.Errorf("%s %s = %d, want %d", tt.table, tt.reason, got, tt.count)
+		}
+		if got := manifest.Skipped[tt.table][tt.reason]; got != tt.count {
+			t.Errorf("manifest %s %s = %d, want %d", tt.table, tt.reason, got, tt.count)
+		}
+	}
+	if total := processor.SkipStats().Total(); total != 7 {
+		t.Errorf("total skipped = %d, want 7", total)
+	}
+}
+
+func TestPrimaryKeyMissing(t *testing.T) {
+	table := &Table{Name: "items", PrimaryKeys: []string{"shop", "sku"}}
+	tests := []struct {
+		name       string
+		keyColumns []string
+		table      *Table
+		values     [][]byte // shop, sku, code
+		missing    bool
+	}{
+		{"complete key", nil, table, [][]byte{[]byte("1"), []byte("a"), nil}, false},
+		{"NULL key part", nil, table, [][]byte{[]byte("1"), nil, nil}, true},
+		{"empty key part is a value", nil, table, [][]byte{[]byte("1"), []byte(""), nil}, false},
+		{"key columns stand in", []string{"code"}, table, [][]byte{nil, nil, []byte("c1")}, false},
+		{"NULL key columns fall back", []string{"code"}, table, [][]byte{[]byte("1"), nil, nil}, true},
+		{"no primary key", nil, &Table{Name: "items"}, [][]byte{nil, nil, nil}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.keyColumns != nil {
+				cfg.Output.KeyColumns = map[string][]string{"items": tt.keyColumns}
+			}
+			dp := testProcessor(cfg)
+			cols := []string{"shop", "sku", "code"}
+			if got := dp.primaryKeyMissing("items", tt.table, cols, func(i int) []byte { return tt.values[i] }); got != tt.missing {
+				t.Errorf("primaryKeyMissing = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
+
+func TestSkipStatsSnapshot(t *testing.T) {
+	stats := NewSkipStats()
+	stats.Add("users", SkipNullValue)
+	stats.Add("users", SkipNullValue)
+	stats.AddN("orders", SkipOrphanedForeignKey, 5)
+
+	snapshot := stats.Snapshot()
+	stats.Add("users", SkipNullValue)
+
+	if got := snapshot["users"][SkipNullValue]; got != 2 {
+		t.Errorf("snapshot users null_value = %d, want 2", got)
+	}
+	if got := snapshot["orders"][SkipOrphanedForeignKey]; got != 5 {
+		t.Errorf("snapshot orders orphaned_foreign_key = %d, want 5", got)
+	}
+	if got := stats.Total(); got != 8 {
+		t.Errorf("Total = %d, want 8", got)
+	}
+}
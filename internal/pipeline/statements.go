@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// StatementCache prepares each distinct query once and reuses it. A table's
+// batch queries differ only in their bound keyset, limit and offset values,
+// so all batches of a table share one statement.
+type StatementCache struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	stmts    map[string]*cachedStatement
+	prepares int
+}
+
+// cachedStatement is a statement being prepared, or prepared; ready is
+// closed once stmt or err is set
+type cachedStatement struct {
+	ready chan struct{}
+	stmt  *sql.Stmt
+	err   error
+}
+
+func NewStatementCache(db *sql.DB) *StatementCache {
+	return &StatementCache{
+		db:    db,
+		stmts: make(map[string]*cachedStatement),
+	}
+}
+
+// Query runs a query through its prepared statement, preparing it on first use
+func (c *StatementCache) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.statement(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// statement returns the prepared statement of a query. The first caller
+// prepares it without holding the lock, so other queries are not held up by
+// a slow prepare; callers of the same query wait for it instead of preparing
+// it again. A failed prepare is not cached.
+func (c *StatementCache) statement(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	cached, ok := c.stmts[query]
+	if !ok {
+		cached = &cachedStatement{ready: make(chan struct{})}
+		c.stmts[query] = cached
+	}
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-cached.ready:
+			return cached.stmt, cached.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	cached.stmt, cached.err = c.db.PrepareContext(ctx, query)
+	c.mu.Lock()
+	if cached.err != nil {
+		delete(c.stmts, query)
+	} else {
+		c.prepares++
+	}
+	c.mu.Unlock()
+	close(cached.ready)
+	return cached.stmt, cached.err
+}
+
+// Prepares returns the number of statements prepared so far
+func (c *StatementCache) Prepares() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prepares
+}
+
+// Close closes every prepared statement, once those being prepared are
+func (c *StatementCache) Close() error {
+	c.mu.Lock()
+	stmts := c.stmts
+	c.stmts = make(map[string]*cachedStatement)
+	c.mu.Unlock()
+
+	var errs []error
+	for _, cached := range stmts {
+		<-cached.ready
+		if cached.stmt == nil {
+			continue
+		}
+		if err := cached.stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warmUpConnections opens n pool connections and pings each, so the first
+// batches do not wait for connection handshakes
+func warmUpConnections(ctx context.Context, db *sql.DB, n int) error {
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
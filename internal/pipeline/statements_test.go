@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPreparedBatchQueries exports tables in several batches and checks each
+// table's batch query is prepared once and reused by every batch
+func TestPreparedBatchQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepared bool
+		keyType  string // Type of the id column; varchar pages by OFFSET
+		prepares int    // Statements prepared per table
+	}{
+		{name: "keyset pages", prepared: true, keyType: "int", prepares: 2},
+		{name: "offset pages", prepared: true, keyType: "varchar", prepares: 1},
+		{name: "disabled", prepared: false, keyType: "int", prepares: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MySQL.PreparedStatements = tt.prepared
+			cfg.Pipeline.BatchSize = 2
+
+			schema := &Schema{Tables: make(map[string]*Table)}
+			tables := make(map[string]*fakeTable)
+			for _, name := range []string{"users", "groups"} {
+				schema.Tables[name] = &Table{
+					Name: name,
+					Columns: map[string]*Column{
+						"id":   {Name: "id", Type: tt.keyType, ColumnType: tt.keyType, Position: 1},
+						"name": {Name: "name", Type: "varchar", ColumnType: "varchar(50)", Position: 2},
+					},
+					PrimaryKeys: []string{"id"},
+				}
+				table := &fakeTable{columns: []string{"id", "name"}}
+				for i := 1; i <= 7; i++ {
+					table.rows = append(table.rows, []driver.Value{int64(i), "n"})
+				}
+				tables[name] = table
+			}
+			db, fake := newFakeDB(t, tablesHandler(tables))
+			for name, table := range tables {
+				schema.Tables[name].RowCount = int64(len(table.rows))
+			}
+			if err := testProcessor(cfg).ProcessTables(context.Background(), db, schema, []string{"groups", "users"}); err != nil {
+				t.Fatalf("ProcessTables: %v", err)
+			}
+
+			for name := range tables {
+				from := "FROM `" + name + "`"
+				batches := 0
+				for _, query := range fake.Queries() {
+					if strings.Contains(query, from) && !strings.HasPrefix(query, "SELECT COUNT") {
+						batches++
+					}
+				}
+				prepared := make(map[string]int)
+				for _, query := range fake.Prepares() {
+					if strings.Contains(query, from) {
+						prepared[query]++
+					}
+				}
+				if len(prepared) != tt.prepares {
+					t.Errorf("%s: prepared %v, want %d statements", name, prepared, tt.prepares)
+				}
+				for query, n := range prepared {
+					if n != 1 {
+						t.Errorf("%s: %q prepared %d times", name, query, n)
+					}
+					if strings.Contains(query, "LIMIT 2") {
+						t.Errorf("%s: %q has its limit formatted in", name, query)
+					}
+				}
+				// 7 rows in batches of 2
+				if batches < 4 {
+					t.Errorf("%s: %d batch queries, want at least 4", name, batches)
+				}
+			}
+		})
+	}
+}
+
+func TestStatementCache(t *testing.T) {
+	db, fake := newFakeDB(t, tablesHandler(map[string]*fakeTable{"users": usersTable(5)}))
+	cache := NewStatementCache(db)
+	ctx := context.Background()
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT ?", []interface{}{2}},
+		{"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?", []interface{}{2, 2}},
+		{"SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?", []interface{}{4, 2}},
+	}
+	for _, q := range queries {
+		rows, err := cache.Query(ctx, q.query, q.args...)
+		if err != nil {
+			t.Fatalf("Query(%q): %v", q.query, err)
+		}
+		rows.Close()
+	}
+	if got := cache.Prepares(); got != 2 {
+		t.Errorf("Prepares = %d, want 2", got)
+	}
+	if got := len(fake.Prepares()); got != 2 {
+		t.Errorf("driver prepared %d statements, want 2", got)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+// TestStatementCacheConcurrentPrepares checks a slow prepare holds up
+// neither other queries nor, beyond waiting for it, callers of its own query
+func TestStatementCacheConcurrentPrepares(t *testing.T) {
+	const slow = "SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT ?"
+	const fast = "SELECT `id`, `name` FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT ?"
+	db, fake := newFakeDB(t, tablesHandler(map[string]*fakeTable{"users": usersTable(5)}))
+	started, release := make(chan struct{}), make(chan struct{})
+	fake.prepare = func(query string) {
+		if query == slow {
+			close(started)
+			<-release
+		}
+	}
+	cache := NewStatementCache(db)
+	ctx := context.Background()
+
+	query := func(q string, args ...interface{}) error {
+		rows, err := cache.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- query(slow, 2) }()
+	<-started
+	go func() { errs <- query(slow, 3) }()
+
+	done := make(chan error, 1)
+	go func() { done <- query(fast, 2, 2) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Query(%q): %v", fast, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow prepare held up another query")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Query(%q): %v", slow, err)
+		}
+	}
+	prepared := 0
+	for _, q := range fake.Prepares() {
+		if q == slow {
+			prepared++
+		}
+	}
+	if prepared != 1 || cache.Prepares() != 2 {
+		t.Errorf("slow query prepared %d times, %d statements in all; want 1 and 2", prepared, cache.Prepares())
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestWarmUpConnections(t *testing.T) {
+	for _, n := range []int{1, 3} {
+		db, fake := newFakeDB(t, tablesHandler(nil))
+		db.SetMaxIdleConns(n)
+		if err := warmUpConnections(context.Background(), db, n); err != nil {
+			t.Fatalf("warmUpConnections(%d): %v", n, err)
+		}
+		if got := fake.Connects(); got != n {
+			t.Errorf("warmUpConnections(%d) opened %d connections", n, got)
+		}
+		if idle := db.Stats().Idle; idle != n {
+			t.Errorf("warmUpConnections(%d) left %d idle connections", n, idle)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// UIDStore collects the table:id -> uid mappings written to the mapping
+// file. Once more than threshold entries are held, they are written to a
+// sorted run file on disk and dropped from memory, so the store's memory is
+// bounded however many rows are migrated. A threshold of 0 never spills.
+type UIDStore struct {
+	dir       string
+	threshold int
+
+	mu   sync.RWMutex
+	mem  map[string]string
+	runs []string // Sorted run files, oldest first
+}
+
+func NewUIDStore(dir string, threshold int) *UIDStore {
+	return &UIDStore{
+		dir:       dir,
+		threshold: threshold,
+		mem:       make(map[string]string),
+	}
+}
+
+// Get returns a mapping held in memory. Spilled mappings are not looked up.
+func (s *UIDStore) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	uid, ok := s.mem[key]
+	return uid, ok
+}
+
+// Put records a mapping, spilling the in-memory entries past the threshold.
+// A key put again after being spilled is stored twice and merged by Each.
+func (s *UIDStore) Put(key, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mem[key] = uid
+	if s.threshold > 0 && len(s.mem) >= s.threshold {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the in-memory entries to a new sorted run file
+func (s *UIDStore) spill() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create UID spill directory: %w", err)
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("run_%06d", len(s.runs)))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create UID spill file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, key := range sortedKeys(s.mem) {
+		writeBinaryString(writer, key)
+		writeBinaryString(writer, s.mem[key])
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write UID spill file: %w", err)
+	}
+
+	s.runs = append(s.runs, path)
+	s.mem = make(map[string]string)
+	return nil
+}
+
+// Spilled returns the number of run files written so far
+func (s *UIDStore) Spilled() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.runs)
+}
+
+// Each calls fn for every mapping in key order, each key once. It merges
+// the run files with the entries still in memory and must not run
+// concurrently with Put.
+func (s *UIDStore) Each(fn func(key, uid string) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	merge := &runMerge{}
+	for _, path := range s.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open UID spill file: %w", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat UID spill file: %w", err)
+		}
+		if err := merge.add(&spillRun{reader: bufio.NewReader(file), size: info.Size()}); err != nil {
+			return err
+		}
+	}
+	if err := merge.add(&memRun{keys: sortedKeys(s.mem), mapping: s.mem}); err != nil {
+		return err
+	}
+
+	last, first := "", true
+	for merge.Len() > 0 {
+		run := merge.runs[0]
+		key, uid := run.current()
+		if first || key != last {
+			if err := fn(key, uid); err != nil {
+				return err
+			}
+			last, first = key, false
+		}
+
+		more, err := run.next()
+		if err != nil {
+			return err
+		}
+		if more {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	return nil
+}
+
+// Close removes the run files
+func (s *UIDStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = nil
+	return os.RemoveAll(s.dir)
+}
+
+func sortedKeys(mapping map[string]string) []string {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedRun is one sorted source of mappings in a merge
+type sortedRun interface {
+	current() (key, uid string)
+	next() (bool, error) // Advances; false once exhausted
+}
+
+type spillRun struct {
+	reader   *bufio.Reader
+	size     int64 // File size, bounding the length of each string
+	key, uid string
+}
+
+func (r *spillRun) current() (string, string) { return r.key, r.uid }
+
+func (r *spillRun) next() (bool, error) {
+	key, err := readBinaryString(r.reader, r.size)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read UID spill file: %w", err)
+	}
+	uid, err := readBinaryString(r.reader, r.size)
+	if err != nil {
+		return false, fmt.Errorf("failed to read UID spill file: %w", err)
+	}
+	r.key, r.uid = key, uid
+	return true, nil
+}
+
+type memRun struct {
+	keys    []string
+	mapping map[string]string
+	pos     int
+}
+
+func (r *memRun) current() (string, string) {
+	key := r.keys[r.pos-1]
+	return key, r.mapping[key]
+}
+
+func (r *memRun) next() (bool, error) {
+	if r.pos >= len(r.keys) {
+		return false, nil
+	}
+	r.pos++
+	return true, nil
+}
+
+// runMerge is a min-heap of runs ordered by their current key
+type runMerge struct {
+	runs []sortedRun
+}
+
+// add positions a run on its first entry and adds it unless it is empty
+func (m *runMerge) add(run sortedRun) error {
+	more, err := run.next()
+	if err != nil || !more {
+		return err
+	}
+	heap.Push(m, run)
+	return nil
+}
+
+func (m *runMerge) Len() int { return len(m.runs) }
+
+func (m *runMerge) Less(i, j int) bool {
+	a, _ := m.runs[i].current()
+	b, _ := m.runs[j].current()
+	return a < b
+}
+
+func (m *runMerge) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+
+func (m *runMerge) Push(x interface{}) { m.runs = append(m.runs, x.(sortedRun)) }
+
+func (m *runMerge) Pop() interface{} {
+	last := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return last
+}
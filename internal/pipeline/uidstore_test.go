@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestUIDStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		keys      int
+		repeat    bool // Put every key a second time after the first pass
+		spilled   int
+	}{
+		{name: "never spills", threshold: 0, keys: 50},
+		{name: "under the threshold", threshold: 100, keys: 50},
+		{name: "spills every entry", threshold: 1, keys: 5, spilled: 5},
+		{name: "spills in runs", threshold: 8, keys: 50, spilled: 6},
+		{name: "keys put again after spilling", threshold: 8, keys: 20, repeat: true, spilled: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), ".uidmap")
+			store := NewUIDStore(dir, tt.threshold)
+			want := make(map[string]string)
+			passes := 1
+			if tt.repeat {
+				passes = 2
+			}
+			for pass := 0; pass < passes; pass++ {
+				// Reverse order, so runs are not already sorted
+				for i := tt.keys - 1; i >= 0; i-- {
+					key := fmt.Sprintf("users:%d", i)
+					want[key] = fmt.Sprintf("_:users_%d", i)
+					if err := store.Put(key, want[key]); err != nil {
+						t.Fatalf("Put(%s): %v", key, err)
+					}
+				}
+			}
+			if got := store.Spilled(); got != tt.spilled {
+				t.Errorf("Spilled = %d, want %d", got, tt.spilled)
+			}
+
+			var keys []string
+			err := store.Each(func(key, uid string) error {
+				if uid != want[key] {
+					t.Errorf("%s = %q, want %q", key, uid, want[key])
+				}
+				keys = append(keys, key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Each: %v", err)
+			}
+			if !sort.StringsAreSorted(keys) || len(keys) != len(want) {
+				t.Errorf("Each visited %d keys (sorted: %v), want %d sorted keys once",
+					len(keys), sort.StringsAreSorted(keys), len(want))
+			}
+			if len(slices.Compact(keys)) != len(want) {
+				t.Error("Each visited a key twice")
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("spill directory left after Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestUIDStoreGet(t *testing.T) {
+	store := NewUIDStore(filepath.Join(t.TempDir(), ".uidmap"), 2)
+	defer store.Close()
+	store.Put("users:1", "_:users_1")
+	if uid, ok := store.Get("users:1"); !ok || uid != "_:users_1" {
+		t.Errorf("Get(users:1) = %q, %v before spilling", uid, ok)
+	}
+	store.Put("users:2", "_:users_2")
+	// Spilled entries are only visited by Each
+	if _, ok := store.Get("users:1"); ok {
+		t.Error("Get found a spilled entry")
+	}
+}
+
+// TestDeterministicUIDs checks deterministic_uids keeps no map, derives the
+// same blank nodes as the mapped default and writes no mapping file
+func TestDeterministicUIDs(t *testing.T) {
+	ids := []string{"1", "2", "1", "42", "ann@example.com"}
+	uidsOf := func(deterministic bool) []string {
+		cfg := testConfig(t)
+		cfg.Pipeline.DeterministicUIDs = deterministic
+		dp := testProcessor(cfg)
+		if (dp.uids == nil) != deterministic {
+			t.Fatalf("deterministic_uids %v: UID map kept: %v", deterministic, dp.uids != nil)
+		}
+		var uids []string
+		for _, id := range ids {
+			uids = append(uids, dp.getOrCreateUID("users", id))
+		}
+		if err := dp.writeUIDMappings(); err != nil {
+			t.Fatalf("writeUIDMappings: %v", err)
+		}
+		_, err := os.Stat(filepath.Join(cfg.Output.Directory, cfg.Output.MappingFile))
+		if deterministic != os.IsNotExist(err) {
+			t.Errorf("deterministic_uids %v: mapping file stat: %v", deterministic, err)
+		}
+		return uids
+	}
+
+	first, second, mapped := uidsOf(true), uidsOf(true), uidsOf(false)
+	if !slices.Equal(first, second) || !slices.Equal(first, mapped) {
+		t.Errorf("UIDs differ: %v, %v, mapped %v", first, second, mapped)
+	}
+	if first[0] != first[2] || first[0] == first[1] {
+		t.Errorf("UIDs %v, want one per id", first)
+	}
+}
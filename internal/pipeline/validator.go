@@ -1,21 +1,26 @@
 package pipeline
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/compress"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
 	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
 )
 
 // DataValidator handles validation of migrated data
 type DataValidator struct {
-	db     *sql.DB
-	cfg    *config.Config
-	logger *logger.Logger
+	db      *sql.DB
+	cfg     *config.Config
+	logger  *logger.Logger
+	filters map[string]string // table -> WHERE predicate the source counts honor
 }
 
 // ValidationResult represents the result of a validation check
@@ -36,11 +41,12 @@ type ValidationSummary struct {
 	Results      []ValidationResult
 }
 
-func NewDataValidator(db *sql.DB, cfg *config.Config, logger *logger.Logger) *DataValidator {
+func NewDataValidator(db *sql.DB, cfg *config.Config, logger *logger.Logger, filters map[string]string) *DataValidator {
 	return &DataValidator{
-		db:     db,
-		cfg:    cfg,
-		logger: logger,
+		db:      db,
+		cfg:     cfg,
+		logger:  logger,
+		filters: filters,
 	}
 }
 
@@ -85,15 +91,19 @@ func (dv *DataValidator) ValidateIntegrity(ctx context.Context) error {
 }
 
 func (dv *DataValidator) validateOutputFiles(summary *ValidationSummary) error {
-	files := []struct {
+	type outputFile struct {
 		name     string
 		path     string
 		required bool
-	}{
-		{"RDF file", filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.RDFFile), true},
-		{"Schema file", filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.SchemaFile), true},
-		{"Mapping file", filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.MappingFile), false},
 	}
+	var files []outputFile
+	for _, name := range rdfDataFiles(dv.cfg) {
+		files = append(files, outputFile{"RDF file", filepath.Join(dv.cfg.Output.Directory, name), true})
+	}
+	files = append(files,
+		outputFile{"Schema file", filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.SchemaFile), true},
+		outputFile{"Mapping file", filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.MappingFile), false},
+	)
 
 	for _, file := range files {
 		result := ValidationResult{
@@ -119,27 +129,23 @@ func (dv *DataValidator) validateOutputFiles(summary *ValidationSummary) error {
 }
 
 func (dv *DataValidator) validateRDFStructure(ctx context.Context, summary *ValidationSummary) error {
-	rdfPath := filepath.Join(dv.cfg.Output.Directory, dv.cfg.Output.RDFFile)
-
-	file, err := os.Open(rdfPath)
-	if err != nil {
-		return fmt.Errorf("failed to open RDF file: %w", err)
-	}
-	defer file.Close()
-
-	// Get file size
-	stat, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file stats: %w", err)
+	// Individual shards may be empty, so check the combined size
+	var size int64
+	for _, name := range rdfDataFiles(dv.cfg) {
+		stat, err := os.Stat(filepath.Join(dv.cfg.Output.Directory, name))
+		if err != nil {
+			return fmt.Errorf("failed to get file stats: %w", err)
+		}
+		size += stat.Size()
 	}
 
 	result := ValidationResult{
 		CheckName:   "RDF file size",
 		Description: "Checking if RDF file has content",
-		Actual:      stat.Size(),
+		Actual:      size,
 	}
 
-	if stat.Size() == 0 {
+	if size == 0 {
 		result.Passed = false
 		result.Error = fmt.Errorf("RDF file is empty")
 	} else {
@@ -149,24 +155,153 @@ func (dv *DataValidator) validateRDFStructure(ctx context.Context, summary *Vali
 
 	summary.addResult(result)
 
-	// TODO: Add more sophisticated RDF validation
-	// - Check for proper RDF triple format
-	// - Validate UID references
-	// - Check for orphaned references
+	return dv.validateReferences(summary)
+}
+
+// validateReferences reports edges whose target blank node is never typed,
+// which means the referenced row was not exported
+func (dv *DataValidator) validateReferences(summary *ValidationSummary) error {
+	// Delta runs leave out the type triples of unchanged rows
+	if dv.cfg.Pipeline.DeltaColumns {
+		dv.logger.Info("Skipping dangling reference check for delta output")
+		return nil
+	}
+
+	var rdfFiles []string
+	for _, name := range rdfDataFiles(dv.cfg) {
+		rdfFiles = append(rdfFiles, filepath.Join(dv.cfg.Output.Directory, name))
+	}
+	report, err := FindDanglingReferences(rdfFiles)
+	if err != nil {
+		return fmt.Errorf("failed to check references: %w", err)
+	}
+
+	for predicate, count := range report.ByPredicate {
+		dv.logger.Warn("Dangling references",
+			"predicate", predicate,
+			"count", count)
+	}
+
+	summary.addResult(ValidationResult{
+		CheckName:   "Dangling references",
+		Description: fmt.Sprintf("Checking that the targets of %d edges are typed nodes", report.References),
+		Expected:    int64(0),
+		Actual:      report.Dangling,
+		Passed:      report.Dangling == 0,
+	})
+	return nil
+}
+
+// DanglingReport counts edges pointing at blank nodes that never get a
+// <dgraph.type> triple
+type DanglingReport struct {
+	References  int64            // Edges to blank nodes
+	Dangling    int64            // Edges whose target has no type
+	ByPredicate map[string]int64 // Dangling edges per predicate
+}
+
+// FindDanglingReferences streams the RDF files twice: the first pass
+// collects the typed subjects, the second checks every blank node object
+// against them. Subjects are kept as 64-bit hashes, so memory grows with
+// the number of nodes rather than their label lengths.
+func FindDanglingReferences(rdfFiles []string) (*DanglingReport, error) {
+	typed := make(map[uint64]struct{})
+	err := scanTriples(rdfFiles, func(subject, predicate, object string) {
+		if predicate == "<dgraph.type>" {
+			typed[nodeHash(subject)] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DanglingReport{ByPredicate: make(map[string]int64)}
+	err = scanTriples(rdfFiles, func(subject, predicate, object string) {
+		if !strings.HasPrefix(object, "_:") {
+			return
+		}
+		report.References++
+		if _, ok := typed[nodeHash(object)]; !ok {
+			report.Dangling++
+			report.ByPredicate[strings.Trim(predicate, "<>")]++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
 
+// scanTriples calls fn with the terms of every triple in the files
+func scanTriples(rdfFiles []string, fn func(subject, predicate, object string)) error {
+	for _, path := range rdfFiles {
+		file, err := compress.Open(path)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), maxRDFLineBytes)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			subject, rest, _ := strings.Cut(line, " ")
+			predicate, object, _ := strings.Cut(rest, " ")
+			object = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(object), "."))
+			// An edge's object is followed by its facets, if any
+			if strings.HasPrefix(object, "_:") || strings.HasPrefix(object, "<") {
+				object, _, _ = strings.Cut(object, " ")
+			}
+			fn(subject, predicate, object)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
 	return nil
 }
 
+func nodeHash(label string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(label))
+	return h.Sum64()
+}
+
+// schemaFilter returns the information_schema condition that selects the
+// exported databases, and its arguments
+func (dv *DataValidator) schemaFilter() (string, []interface{}) {
+	databases := dv.cfg.MySQL.SourceDatabases()
+	args := make([]interface{}, len(databases))
+	for i, database := range databases {
+		args[i] = database
+	}
+	return "table_schema IN (" + strings.TrimSuffix(strings.Repeat("?,", len(databases)), ",") + ")", args
+}
+
+// tableName returns a table's name in the schema, qualified with its
+// database when several databases are exported
+func (dv *DataValidator) tableName(database, tableName string) string {
+	if dv.cfg.MySQL.QualifiedNames() {
+		return database + "." + tableName
+	}
+	return tableName
+}
+
 func (dv *DataValidator) validateRowCounts(ctx context.Context, summary *ValidationSummary) error {
 	// This is a simplified validation - in production you might want to
 	// count actual RDF triples and compare with expected counts
 
-	// Get list of tables from database
+	// Get list of tables from the exported databases
+	schemaFilter, args := dv.schemaFilter()
 	rows, err := dv.db.QueryContext(ctx, `
-		SELECT table_name 
+		SELECT table_schema, table_name 
 		FROM information_schema.tables 
-		WHERE table_schema = DATABASE()
-		AND table_type = 'BASE TABLE'`)
+		WHERE `+schemaFilter+`
+		AND table_type = 'BASE TABLE'`, args...)
 	if err != nil {
 		return fmt.Errorf("failed to get table list: %w", err)
 	}
@@ -176,14 +311,19 @@ func (dv *DataValidator) validateRowCounts(ctx context.Context, summary *Validat
 	var tableCount int
 
 	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
+		var database, tableName string
+		if err := rows.Scan(&database, &tableName); err != nil {
 			dv.logger.Warn("Failed to scan table name", "error", err)
 			continue
 		}
+		if err := checkIdentifiers(database, tableName); err != nil {
+			dv.logger.Warn("Skipping row count", "table", tableName, "error", err)
+			continue
+		}
+		tableName = dv.tableName(database, tableName)
 
 		var count int64
-		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteTable(tableName), whereClause(dv.filters[tableName]))
 		if err := dv.db.QueryRowContext(ctx, countQuery).Scan(&count); err != nil {
 			dv.logger.Warn("Failed to count rows", "table", tableName, "error", err)
 			continue
@@ -207,15 +347,18 @@ func (dv *DataValidator) validateRowCounts(ctx context.Context, summary *Validat
 
 func (dv *DataValidator) validateForeignKeyIntegrity(ctx context.Context, summary *ValidationSummary) error {
 	// Get foreign key constraints
+	schemaFilter, args := dv.schemaFilter()
 	rows, err := dv.db.QueryContext(ctx, `
 		SELECT 
+			table_schema,
 			table_name, 
 			column_name, 
+			referenced_table_schema,
 			referenced_table_name, 
 			referenced_column_name
 		FROM information_schema.key_column_usage
-		WHERE table_schema = DATABASE() 
-		AND referenced_table_name IS NOT NULL`)
+		WHERE `+schemaFilter+` 
+		AND referenced_table_name IS NOT NULL`, args...)
 	if err != nil {
 		return fmt.Errorf("failed to get foreign keys: %w", err)
 	}
@@ -225,11 +368,17 @@ func (dv *DataValidator) validateForeignKeyIntegrity(ctx context.Context, summar
 	var validFKs int
 
 	for rows.Next() {
-		var tableName, columnName, refTableName, refColumnName string
-		if err := rows.Scan(&tableName, &columnName, &refTableName, &refColumnName); err != nil {
+		var database, tableName, columnName, refDatabase, refTableName, refColumnName string
+		if err := rows.Scan(&database, &tableName, &columnName, &refDatabase, &refTableName, &refColumnName); err != nil {
 			dv.logger.Warn("Failed to scan foreign key", "error", err)
 			continue
 		}
+		if err := checkIdentifiers(database, tableName, columnName, refDatabase, refTableName, refColumnName); err != nil {
+			dv.logger.Warn("Skipping foreign key", "table", tableName, "error", err)
+			continue
+		}
+		tableName = dv.tableName(database, tableName)
+		refTableName = dv.tableName(refDatabase, refTableName)
 
 		fkCount++
 
@@ -239,7 +388,8 @@ func (dv *DataValidator) validateForeignKeyIntegrity(ctx context.Context, summar
 			FROM %s t1 
 			LEFT JOIN %s t2 ON t1.%s = t2.%s 
 			WHERE t1.%s IS NOT NULL AND t2.%s IS NULL`,
-			tableName, refTableName, columnName, refColumnName, columnName, refColumnName)
+			quoteTable(tableName), quoteTable(refTableName), quoteIdent(columnName), quoteIdent(refColumnName),
+			quoteIdent(columnName), quoteIdent(refColumnName))
 
 		var orphanCount int64
 		if err := dv.db.QueryRowContext(ctx, query).Scan(&orphanCount); err != nil {
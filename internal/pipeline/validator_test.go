@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"database/sql/driver"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+func TestFindDanglingReferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string // Contents of each RDF file
+		references  int64
+		byPredicate map[string]int64
+	}{
+		{
+			name: "all targets typed",
+			files: []string{`# header
+_:users_1 <dgraph.type> "users" .
+_:orders_1 <dgraph.type> "orders" .
+_:orders_1 <orders.user_id> _:users_1 .
+_:orders_1 <orders.total> "9.5"^^<xs:float> .
+`},
+			references: 1,
+		},
+		{
+			name: "target row not exported",
+			files: []string{`_:users_1 <dgraph.type> "users" .
+_:orders_1 <dgraph.type> "orders" .
+_:orders_1 <orders.user_id> _:users_1 .
+_:orders_2 <dgraph.type> "orders" .
+_:orders_2 <orders.user_id> _:users_7 .
+_:orders_3 <dgraph.type> "orders" .
+_:orders_3 <orders.user_id> _:users_8 .
+_:items_1 <items.order_id> _:orders_9 .
+`},
+			references:  4,
+			byPredicate: map[string]int64{"orders.user_id": 2, "items.order_id": 1},
+		},
+		{
+			name: "target only used as a subject",
+			files: []string{`_:users_1 <users.name> "Ada" .
+_:orders_1 <orders.user_id> _:users_1 .
+`},
+			references:  1,
+			byPredicate: map[string]int64{"orders.user_id": 1},
+		},
+		{
+			name: "target typed in another shard",
+			files: []string{
+				"_:orders_1 <dgraph.type> \"orders\" .\n_:orders_1 <orders.user_id> _:users_1 .\n",
+				"_:users_1 <dgraph.type> \"users\" .\n",
+			},
+			references: 1,
+		},
+		{
+			name: "edges with facets",
+			files: []string{`_:users_1 <dgraph.type> "users" .
+_:roles_2 <dgraph.type> "roles" .
+_:users_1 <users.roles> _:roles_2 (assigned_at=2024-01-01T00:00:00Z) .
+_:roles_2 <roles.users> _:users_1 (assigned_at=2024-01-01T00:00:00Z, note="a b") .
+_:users_1 <users.roles> _:roles_3 (assigned_at=2024-01-01T00:00:00Z) .
+`},
+			references:  3,
+			byPredicate: map[string]int64{"users.roles": 1},
+		},
+		{
+			name: "uid and literal objects are not references",
+			files: []string{`_:orders_1 <dgraph.type> "orders" .
+_:orders_1 <orders.user_id> <0x1f> .
+_:orders_1 <orders.note> "_:users_1" .
+`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for i, content := range tt.files {
+				path := filepath.Join(dir, "data."+string(rune('a'+i))+".rdf")
+				writeFile(t, path, content)
+				paths = append(paths, path)
+			}
+			report, err := FindDanglingReferences(paths)
+			if err != nil {
+				t.Fatalf("FindDanglingReferences: %v", err)
+			}
+
+			var dangling int64
+			for _, count := range tt.byPredicate {
+				dangling += count
+			}
+			if report.References != tt.references || report.Dangling != dangling {
+				t.Errorf("references %d, dangling %d, want %d and %d", report.References, report.Dangling, tt.references, dangling)
+			}
+			if len(report.ByPredicate) != len(tt.byPredicate) {
+				t.Errorf("by predicate %v, want %v", report.ByPredicate, tt.byPredicate)
+			}
+			for predicate, count := range tt.byPredicate {
+				if report.ByPredicate[predicate] != count {
+					t.Errorf("by predicate %v, want %v", report.ByPredicate, tt.byPredicate)
+				}
+			}
+		})
+	}
+
+	if _, err := FindDanglingReferences([]string{filepath.Join(t.TempDir(), "missing.rdf")}); err == nil {
+		t.Error("no error for a missing RDF file")
+	}
+}
+
+// TestValidateReferences checks the dangling reference result recorded for
+// an export and for an RDF file with an edge to a row that was not exported
+func TestValidateReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		dangling string // Appended to the exported RDF file
+		delta    bool
+		want     int64
+		checks   int
+	}{
+		// Order 3 belongs to user 9, who does not exist
+		{name: "export", want: 1, checks: 1},
+		{name: "dangling edge", dangling: "_:orders_1 <orders.user_id> _:users_404 .\n", want: 2, checks: 1},
+		{name: "delta output", dangling: "_:orders_1 <orders.user_id> _:users_404 .\n", delta: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pipeline.SkipValidation = true
+			processRDF(t, cfg, fkSchema(map[string][]string{"users": nil, "orders": {"user_id"}}, [][3]string{{"orders", "user_id", "users"}}),
+				map[string]*fakeTable{
+					"users":  {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}},
+					"orders": {columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(9)}}},
+				})
+			path := filepath.Join(cfg.Output.Directory, cfg.Output.RDFFile)
+			writeFile(t, path, readFile(t, path)+tt.dangling)
+			cfg.Pipeline.DeltaColumns = tt.delta
+
+			summary := &ValidationSummary{}
+			validator := NewDataValidator(nil, cfg, logger.New("error", "text"), nil)
+			if err := validator.validateReferences(summary); err != nil {
+				t.Fatalf("validateReferences: %v", err)
+			}
+			if len(summary.Results) != tt.checks {
+				t.Fatalf("results %+v, want %d", summary.Results, tt.checks)
+			}
+			if tt.checks == 0 {
+				return
+			}
+			result := summary.Results[0]
+			if result.CheckName != "Dangling references" || result.Actual != tt.want || result.Passed != (tt.want == 0) {
+				t.Errorf("result %+v, want %d dangling", result, tt.want)
+			}
+			if !strings.Contains(result.Description, "edges") {
+				t.Errorf("description %q", result.Description)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package retry decides which errors are worth retrying and runs operations
+// with retries. Every retry site in the pipeline and importer shares one
+// Classifier, so an error is either retried everywhere or nowhere.
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// StatusCoder is implemented by errors that carry an HTTP status code
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// defaultRules apply after the configured rules
+var defaultRules = []config.RetryRule{
+	// MySQL: lock wait timeout, deadlock, server gone away, lost connection,
+	// too many connections
+	{MySQLCode: 1205, Retryable: true},
+	{MySQLCode: 1213, Retryable: true},
+	{MySQLCode: 2006, Retryable: true},
+	{MySQLCode: 2013, Retryable: true},
+	{MySQLCode: 1040, Retryable: true},
+
+	// Dgraph over HTTP: throttling and unavailable alphas
+	{HTTPStatus: 429, Retryable: true},
+	{HTTPStatus: 502, Retryable: true},
+	{HTTPStatus: 503, Retryable: true},
+	{HTTPStatus: 504, Retryable: true},
+
+	// Dgraph transaction conflicts and transient network failures
+	{Contains: "please retry", Retryable: true},
+	{Contains: "transaction has been aborted", Retryable: true},
+	{Contains: "connection refused", Retryable: true},
+	{Contains: "connection reset", Retryable: true},
+	{Contains: "broken pipe", Retryable: true},
+	{Contains: "i/o timeout", Retryable: true},
+	{Contains: "context deadline exceeded", Retryable: true},
+}
+
+// Classifier sorts errors into retryable and fatal
+type Classifier struct {
+	rules    []config.RetryRule
+	maxDelay time.Duration // Cap on the doubling delay (0 = constant delay)
+}
+
+// NewClassifier returns a classifier that checks the configured rules, in
+// order, before the built-in ones
+func NewClassifier(cfg config.RetryConfig) *Classifier {
+	all := make([]config.RetryRule, 0, len(cfg.Rules)+len(defaultRules))
+	all = append(all, cfg.Rules...)
+	all = append(all, defaultRules...)
+	return &Classifier{rules: all, maxDelay: cfg.MaxDelay}
+}
+
+// Retryable reports whether an operation that failed with err may succeed if
+// repeated. Cancellation is never retryable; errors that match no rule are
+// retryable only if they are network timeouts or a bad driver connection.
+func (c *Classifier) Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	hasMySQLCode := errors.As(err, &mysqlErr)
+
+	var statusErr StatusCoder
+	hasStatus := errors.As(err, &statusErr)
+
+	message := strings.ToLower(err.Error())
+
+	for _, rule := range c.rules {
+		switch {
+		case rule.MySQLCode != 0:
+			if hasMySQLCode && mysqlErr.Number == rule.MySQLCode {
+				return rule.Retryable
+			}
+		case rule.HTTPStatus != 0:
+			if hasStatus && statusErr.StatusCode() == rule.HTTPStatus {
+				return rule.Retryable
+			}
+		case rule.Contains != "":
+			if strings.Contains(message, strings.ToLower(rule.Contains)) {
+				return rule.Retryable
+			}
+		}
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// Do runs fn until it succeeds, returns a fatal error, or has been retried
+// maxRetries times. The first retry waits delay and each further one twice
+// as long, up to the classifier's maximum delay. onRetry, if not nil, is
+// called before each retry.
+func (c *Classifier) Do(ctx context.Context, maxRetries int, delay time.Duration, onRetry func(attempt int, err error), fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= maxRetries || ctx.Err() != nil || !c.Retryable(err) {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt+1, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		if c.maxDelay > 0 {
+			delay *= 2
+			if delay > c.maxDelay {
+				delay = c.maxDelay
+			}
+		}
+	}
+}
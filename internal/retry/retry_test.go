@@ -0,0 +1,165 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+)
+
+// statusError is an error carrying an HTTP status
+type statusError int
+
+func (e statusError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+// timeoutError is a network error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "read tcp: timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     []config.RetryRule
+		err       error
+		retryable bool
+	}{
+		{name: "nil", err: nil},
+		{name: "lock wait timeout", err: &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, retryable: true},
+		{name: "deadlock", err: &mysql.MySQLError{Number: 1213}, retryable: true},
+		{name: "server gone away", err: &mysql.MySQLError{Number: 2006}, retryable: true},
+		{name: "lost connection", err: &mysql.MySQLError{Number: 2013}, retryable: true},
+		{name: "too many connections", err: &mysql.MySQLError{Number: 1040}, retryable: true},
+		{name: "wrapped MySQL error", err: fmt.Errorf("query failed: %w", &mysql.MySQLError{Number: 1213}), retryable: true},
+		{name: "syntax error", err: &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}},
+		{name: "unknown table", err: &mysql.MySQLError{Number: 1146}},
+		{name: "bad connection", err: driver.ErrBadConn, retryable: true},
+		{name: "invalid connection", err: mysql.ErrInvalidConn, retryable: true},
+		{name: "network timeout", err: fmt.Errorf("read: %w", timeoutError{}), retryable: true},
+		{name: "throttled", err: statusError(429), retryable: true},
+		{name: "unavailable", err: statusError(503), retryable: true},
+		{name: "bad request", err: statusError(400)},
+		{name: "aborted transaction", err: errors.New("Transaction has been aborted. Please retry"), retryable: true},
+		{name: "connection refused", err: errors.New("dial tcp 127.0.0.1:8080: connect: Connection refused"), retryable: true},
+		{name: "canceled", err: fmt.Errorf("query: %w", context.Canceled)},
+		{name: "canceled despite a matching message", err: fmt.Errorf("connection reset: %w", context.Canceled)},
+		{name: "unknown error", err: errors.New("invalid N-Quad")},
+		{
+			name:      "rule makes a MySQL code retryable",
+			rules:     []config.RetryRule{{MySQLCode: 1317, Retryable: true}},
+			err:       &mysql.MySQLError{Number: 1317},
+			retryable: true,
+		},
+		{
+			name:  "rule overrides a built-in rule",
+			rules: []config.RetryRule{{MySQLCode: 1213, Retryable: false}},
+			err:   &mysql.MySQLError{Number: 1213},
+		},
+		{
+			name:  "message rules ignore case",
+			rules: []config.RetryRule{{Contains: "READ-ONLY", Retryable: false}},
+			err:   errors.New("connection reset: server is read-only"),
+		},
+		{
+			name:      "status rule",
+			rules:     []config.RetryRule{{HTTPStatus: 500, Retryable: true}},
+			err:       statusError(500),
+			retryable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClassifier(config.RetryConfig{Rules: tt.rules})
+			if got := c.Retryable(tt.err); got != tt.retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	retryable := &mysql.MySQLError{Number: 1205}
+	fatal := &mysql.MySQLError{Number: 1064}
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   []error // Errors returned by the first calls
+		calls      int
+		err        error
+	}{
+		{name: "success", maxRetries: 3, calls: 1},
+		{name: "retried until success", maxRetries: 3, failures: []error{retryable, retryable}, calls: 3},
+		{name: "gives up after max retries", maxRetries: 2, failures: []error{retryable, retryable, retryable, retryable}, calls: 3, err: retryable},
+		{name: "no retries", maxRetries: 0, failures: []error{retryable}, calls: 1, err: retryable},
+		{name: "fatal error stops at once", maxRetries: 3, failures: []error{fatal}, calls: 1, err: fatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClassifier(config.RetryConfig{})
+			calls, retries := 0, 0
+			err := c.Do(context.Background(), tt.maxRetries, time.Millisecond,
+				func(attempt int, err error) {
+					retries++
+					if attempt != retries {
+						t.Errorf("retry %d reported as attempt %d", retries, attempt)
+					}
+				},
+				func() error {
+					calls++
+					if calls <= len(tt.failures) {
+						return tt.failures[calls-1]
+					}
+					return nil
+				})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Do = %v, want %v", err, tt.err)
+			}
+			if calls != tt.calls || retries != tt.calls-1 {
+				t.Errorf("%d calls and %d retries, want %d calls", calls, retries, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoDoublesTheDelay(t *testing.T) {
+	c := NewClassifier(config.RetryConfig{MaxDelay: time.Second})
+	var calls []time.Time
+	c.Do(context.Background(), 3, 10*time.Millisecond, nil, func() error {
+		calls = append(calls, time.Now())
+		return &mysql.MySQLError{Number: 1205}
+	})
+
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	if len(calls) != len(want)+1 {
+		t.Fatalf("%d calls, want %d", len(calls), len(want)+1)
+	}
+	for i, least := range want {
+		if wait := calls[i+1].Sub(calls[i]); wait < least {
+			t.Errorf("wait before retry %d = %v, want at least %v", i+1, wait, least)
+		}
+	}
+}
+
+func TestDoStopsOnCancel(t *testing.T) {
+	c := NewClassifier(config.RetryConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := c.Do(ctx, 5, time.Hour, func(int, error) { cancel() }, func() error {
+		calls++
+		return &mysql.MySQLError{Number: 1205}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want the error after 1 call", err, calls)
+	}
+}
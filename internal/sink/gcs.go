@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsEndpoint = "https://storage.googleapis.com"
+	gcsScope    = "https://www.googleapis.com/auth/devstorage.read_write"
+	// gcsAttempts is how many times an upload is sent before it fails
+	gcsAttempts = 3
+)
+
+// gcsRetryDelay is the delay before the first retry of an upload, doubled
+// for each one after. Tests lower it.
+var gcsRetryDelay = time.Second
+
+// gcsUploader puts files into a Cloud Storage bucket through resumable
+// uploads of the JSON API, which take a file of any size in one request
+type gcsUploader struct {
+	bucket   string
+	endpoint string
+	client   *http.Client
+
+	mu     sync.Mutex
+	authed *http.Client // client adding an access token, set on the first upload
+}
+
+func newGCSUploader(opts Options, client *http.Client) *gcsUploader {
+	endpoint := strings.TrimSuffix(opts.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = gcsEndpoint
+	}
+	return &gcsUploader{bucket: opts.Bucket, endpoint: endpoint, client: client}
+}
+
+func (u *gcsUploader) location(key string) string {
+	return "gs://" + u.bucket + "/" + key
+}
+
+// upload sends a file, starting over when Cloud Storage fails in a way
+// worth retrying
+func (u *gcsUploader) upload(localPath, key string) error {
+	client, err := u.authedClient()
+	if err != nil {
+		return err
+	}
+
+	delay := gcsRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := u.send(client, localPath, key)
+		if err == nil || attempt == gcsAttempts || !retryable(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send uploads a file in a new upload session
+func (u *gcsUploader) send(client *http.Client, localPath, key string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Start a session, then send the whole file to it
+	query := url.Values{"uploadType": {"resumable"}, "name": {key}}
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", u.endpoint, url.PathEscape(u.bucket), query.Encode())
+	req, err := http.NewRequest(http.MethodPost, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Upload-Content-Length", fmt.Sprint(stat.Size()))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("no upload session returned for %s", u.location(key))
+	}
+
+	req, err = http.NewRequest(http.MethodPut, session, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// authedClient returns a client that adds an OAuth2 token to every request,
+// refreshing it before it expires. The token is GOOGLE_OAUTH_ACCESS_TOKEN,
+// else one from the application default credentials: the
+// GOOGLE_APPLICATION_CREDENTIALS file (a service account key, user or
+// workload identity federation credentials), the gcloud default credentials
+// file, then the metadata server.
+func (u *gcsUploader) authedClient() (*http.Client, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.authed != nil {
+		return u.authed, nil
+	}
+	var source oauth2.TokenSource
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		source = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	} else {
+		// Tokens are fetched with the uploader's client
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, u.client)
+		creds, err := google.FindDefaultCredentials(ctx, gcsScope)
+		if err != nil {
+			return nil, fmt.Errorf("no Google Cloud credentials: %w", err)
+		}
+		source = creds.TokenSource
+	}
+	u.authed = &http.Client{
+		Timeout:   u.client.Timeout,
+		Transport: &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, source), Base: u.client.Transport},
+	}
+	return u.authed, nil
+}
+
+// retryable reports whether a failed upload may succeed when sent again: a
+// network error, or a status Cloud Storage documents as transient
+func retryable(err error) bool {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Status == http.StatusRequestTimeout || reqErr.Status == http.StatusTooManyRequests || reqErr.Status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,284 @@
+package sink
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testGCS serves the OAuth2 token endpoint and resumable uploads. Every
+// token request gets a new token valid for expiresIn seconds; the first
+// failSessions session starts fail with 503.
+type testGCS struct {
+	t            *testing.T
+	key          *rsa.PublicKey
+	expiresIn    int
+	failSessions int
+
+	mu       sync.Mutex
+	tokens   int
+	grants   []string
+	sessions int
+	uploads  map[string]string // Object name -> content
+	auth     []string          // Authorization header of each upload request
+}
+
+func (s *testGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/token":
+		r.ParseForm()
+		grant := r.PostForm.Get("grant_type")
+		s.grants = append(s.grants, grant)
+		if assertion := r.PostForm.Get("assertion"); assertion != "" {
+			s.checkJWT(assertion)
+		}
+		s.tokens++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":      fmt.Sprintf("token-%d", s.tokens),
+			"expires_in":        s.expiresIn,
+			"token_type":        "Bearer",
+			"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+		})
+	case r.URL.Path == "/upload/storage/v1/b/exports/o":
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		s.sessions++
+		if s.sessions <= s.failSessions {
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("uploadType") != "resumable" {
+			http.Error(w, "not resumable", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", "http://"+r.Host+"/session?name="+r.URL.Query().Get("name"))
+	case r.URL.Path == "/session" && r.Method == http.MethodPut:
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		s.uploads[r.URL.Query().Get("name")] = string(body)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// checkJWT verifies a service account assertion against the test key
+func (s *testGCS) checkJWT(assertion string) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		s.t.Errorf("assertion has %d parts", len(parts))
+		return
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.key, crypto.SHA256, digest[:], signature); err != nil {
+		s.t.Errorf("assertion signature: %v", err)
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var decoded map[string]interface{}
+	json.Unmarshal(claims, &decoded)
+	if decoded["iss"] != "exporter@project.iam.gserviceaccount.com" || decoded["scope"] != gcsScope {
+		s.t.Errorf("assertion claims = %v", decoded)
+	}
+}
+
+// startGCS starts the server and writes a credentials file of type for it
+func startGCS(t *testing.T, credentialsType string, expiresIn int) (*testGCS, *gcsUploader) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testGCS{t: t, key: &key.PublicKey, expiresIn: expiresIn, uploads: make(map[string]string)}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	subjectToken := filepath.Join(dir, "subject_token")
+	if err := os.WriteFile(subjectToken, []byte("oidc-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	creds := map[string]interface{}{
+		"type":               credentialsType,
+		"client_email":       "exporter@project.iam.gserviceaccount.com",
+		"private_key":        string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":          httpServer.URL + "/token",
+		"client_id":          "client",
+		"client_secret":      "secret",
+		"refresh_token":      "refresh",
+		"audience":           "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/ci",
+		"token_url":          httpServer.URL + "/token",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"credential_source":  map[string]string{"file": subjectToken},
+	}
+	data, _ := json.Marshal(creds)
+	path := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	old := gcsRetryDelay
+	gcsRetryDelay = time.Millisecond
+	t.Cleanup(func() { gcsRetryDelay = old })
+
+	return server, newGCSUploader(Options{Bucket: "exports", Endpoint: httpServer.URL}, httpServer.Client())
+}
+
+// uploadFiles uploads n files named data_N.rdf holding their name
+func uploadFiles(t *testing.T, u *gcsUploader, n int) {
+	t.Helper()
+	dir := t.TempDir()
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("data_%d.rdf", i)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.upload(path, "runs/"+name); err != nil {
+			t.Fatalf("upload %s: %v", name, err)
+		}
+	}
+}
+
+func TestGCSTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name            string
+		credentialsType string
+		expiresIn       int
+		grant           string
+		auth            []string // Bearer token of each request, two per upload
+	}{
+		{
+			name:            "a long-lived token is reused",
+			credentialsType: "service_account",
+			expiresIn:       3600,
+			grant:           "urn:ietf:params:oauth:grant-type:jwt-bearer",
+			auth: []string{
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+			},
+		},
+		{
+			name:            "a token about to expire is refreshed",
+			credentialsType: "service_account",
+			expiresIn:       5,
+			grant:           "urn:ietf:params:oauth:grant-type:jwt-bearer",
+			auth: []string{
+				"Bearer token-1", "Bearer token-2", "Bearer token-3",
+				"Bearer token-4", "Bearer token-5", "Bearer token-6",
+			},
+		},
+		{
+			name:            "user credentials use their refresh token",
+			credentialsType: "authorized_user",
+			expiresIn:       3600,
+			grant:           "refresh_token",
+			auth: []string{
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+			},
+		},
+		{
+			name:            "workload identity federation exchanges its subject token",
+			credentialsType: "external_account",
+			expiresIn:       3600,
+			grant:           "urn:ietf:params:oauth:grant-type:token-exchange",
+			auth: []string{
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+				"Bearer token-1", "Bearer token-1", "Bearer token-1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, u := startGCS(t, tt.credentialsType, tt.expiresIn)
+			uploadFiles(t, u, 3)
+
+			if strings.Join(server.auth, ",") != strings.Join(tt.auth, ",") {
+				t.Errorf("uploads authorized with %v, want %v", server.auth, tt.auth)
+			}
+			for _, grant := range server.grants {
+				if grant != tt.grant {
+					t.Errorf("grant_type = %q, want %q", grant, tt.grant)
+				}
+			}
+			for i := 1; i <= 3; i++ {
+				name := fmt.Sprintf("data_%d.rdf", i)
+				if got := server.uploads["runs/"+name]; got != name {
+					t.Errorf("runs/%s holds %q", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGCSAccessTokenFromEnvironment(t *testing.T) {
+	server, u := startGCS(t, "service_account", 3600)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "env-token")
+	uploadFiles(t, u, 1)
+
+	if len(server.grants) != 0 {
+		t.Errorf("token endpoint called %d times", len(server.grants))
+	}
+	if !slices.Equal(server.auth, []string{"Bearer env-token", "Bearer env-token"}) {
+		t.Errorf("upload authorized with %v, want Bearer env-token", server.auth)
+	}
+}
+
+func TestGCSRetriesTransientFailures(t *testing.T) {
+	server, u := startGCS(t, "service_account", 3600)
+	server.failSessions = 2
+	uploadFiles(t, u, 1)
+
+	if server.sessions != 3 {
+		t.Errorf("%d session starts, want 3", server.sessions)
+	}
+	if got := server.uploads["runs/data_1.rdf"]; got != "data_1.rdf" {
+		t.Errorf("runs/data_1.rdf holds %q", got)
+	}
+}
+
+func TestGCSUploadFailure(t *testing.T) {
+	requests := 0
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	t.Cleanup(httpServer.Close)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "env-token")
+
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	os.WriteFile(path, []byte("x"), 0644)
+	u := newGCSUploader(Options{Bucket: "exports", Endpoint: httpServer.URL}, httpServer.Client())
+	err := u.upload(path, "data.rdf")
+	if err == nil || !strings.Contains(err.Error(), "returned status 403") {
+		t.Fatalf("error = %v, want a 403 status error", err)
+	}
+	if requests != 1 {
+		t.Errorf("a 403 was sent %d times, want once", requests)
+	}
+}
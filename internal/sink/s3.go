@@ -0,0 +1,114 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3PartSize is the part size of multipart uploads; files up to one part
+// go up in a single PUT. S3 takes no part under 5 MB. Tests lower it.
+var s3PartSize int64 = 64 << 20
+
+// s3MaxBackoff caps the delay between retries of a failed request. Tests
+// lower it.
+var s3MaxBackoff = 20 * time.Second
+
+// s3Uploader puts files into an S3 bucket, or one of an S3-compatible store
+// such as MinIO when an endpoint is given. Credentials and the region come
+// from the AWS SDK's default chain, loaded on the first upload.
+type s3Uploader struct {
+	bucket   string
+	region   string // Empty = the SDK's, else us-east-1
+	endpoint string // Path-style base URL; empty = virtual-hosted AWS
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	uploader *manager.Uploader
+}
+
+func newS3Uploader(opts Options, timeout time.Duration) *s3Uploader {
+	return &s3Uploader{
+		bucket:   opts.Bucket,
+		region:   opts.Region,
+		endpoint: strings.TrimSuffix(opts.Endpoint, "/"),
+		timeout:  timeout,
+	}
+}
+
+func (u *s3Uploader) location(key string) string {
+	return "s3://" + u.bucket + "/" + key
+}
+
+func (u *s3Uploader) upload(localPath, key string) error {
+	ctx := context.Background()
+	uploader, err := u.getUploader(ctx)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The uploader sends files over one part in parts, aborting the upload
+	// if any part fails
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+		Body:   file,
+	})
+	return err
+}
+
+// getUploader returns the uploader, loading the AWS configuration the first
+// time: the environment, the shared config and credentials files (profiles,
+// SSO, assumed roles, credential_process), web identity, then the ECS task
+// or EC2 instance role
+func (u *s3Uploader) getUploader(ctx context.Context) (*manager.Uploader, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.uploader != nil {
+		return u.uploader, nil
+	}
+	options := []func(*config.LoadOptions) error{
+		// The SDK's own client, unlike a plain one, takes AWS_CA_BUNDLE
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(u.timeout)),
+		config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) { o.MaxBackoff = s3MaxBackoff })
+		}),
+	}
+	if u.region != "" {
+		options = append(options, config.WithRegion(u.region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if u.endpoint != "" {
+			o.BaseEndpoint = aws.String(u.endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	u.uploader = manager.NewUploader(client, func(m *manager.Uploader) {
+		m.PartSize = s3PartSize
+	})
+	return u.uploader, nil
+}
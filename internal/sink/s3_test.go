@@ -0,0 +1,316 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3Request is a request received by the test S3 server
+type s3Request struct {
+	method      string
+	path        string
+	query       string
+	auth        string
+	payloadHash string
+	body        string
+}
+
+// testS3 serves path-style S3 requests, recording them. PUTs of part
+// failPart fail, and completion answers completeBody.
+type testS3 struct {
+	mu           sync.Mutex
+	requests     []s3Request
+	failPart     string
+	completeBody string
+}
+
+func (s *testS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, s3Request{
+		method:      r.Method,
+		path:        r.URL.Path,
+		query:       r.URL.RawQuery,
+		auth:        r.Header.Get("Authorization"),
+		payloadHash: r.Header.Get("X-Amz-Content-Sha256"),
+		body:        string(body),
+	})
+	s.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		if query.Get("partNumber") == s.failPart {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", `"etag-`+query.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		fmt.Fprint(w, s.completeBody)
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// calls returns the method and query of every request, sorted, as parts
+// go up concurrently
+func (s *testS3) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []string
+	for _, req := range s.requests {
+		calls = append(calls, req.method+" "+req.query)
+	}
+	slices.Sort(calls)
+	return calls
+}
+
+// isolateAWS keeps the AWS SDK from reading the credentials of the machine
+// running the tests, and shortens its retries
+func isolateAWS(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":                      "",
+		"AWS_SECRET_ACCESS_KEY":                  "",
+		"AWS_SESSION_TOKEN":                      "",
+		"AWS_PROFILE":                            "",
+		"AWS_REGION":                             "",
+		"AWS_DEFAULT_REGION":                     "",
+		"AWS_ROLE_ARN":                           "",
+		"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+		"AWS_ENDPOINT_URL":                       "",
+		"AWS_CA_BUNDLE":                          "",
+		"AWS_CONFIG_FILE":                        filepath.Join(dir, "config"),
+		"AWS_SHARED_CREDENTIALS_FILE":            filepath.Join(dir, "credentials"),
+		"AWS_EC2_METADATA_DISABLED":              "true",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     "",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "",
+	} {
+		t.Setenv(name, value)
+	}
+	old := s3MaxBackoff
+	s3MaxBackoff = time.Millisecond
+	t.Cleanup(func() { s3MaxBackoff = old })
+}
+
+// uploadToS3 uploads content as key through an uploader pointed at server,
+// with credentials from the environment
+func uploadToS3(t *testing.T, server *testS3, content string) error {
+	t.Helper()
+	isolateAWS(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	return uploadWithChain(t, server, content)
+}
+
+// uploadWithChain uploads content through an uploader pointed at server,
+// with the credentials the test set up
+func uploadWithChain(t *testing.T, server *testS3, content string) error {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u := newS3Uploader(Options{Bucket: "exports", Region: "eu-west-1", Endpoint: httpServer.URL + "/"}, time.Minute)
+	return u.upload(path, "runs/1/data.rdf")
+}
+
+// withPartSize lowers the multipart part size for a test
+func withPartSize(t *testing.T, size int64) {
+	old := s3PartSize
+	s3PartSize = size
+	t.Cleanup(func() { s3PartSize = old })
+}
+
+func TestS3SinglePut(t *testing.T) {
+	server := &testS3{}
+	content := "_:a <name> \"A\" .\n"
+	if err := uploadToS3(t, server, content); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if len(server.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(server.requests))
+	}
+	got := server.requests[0]
+	if got.method != http.MethodPut || got.path != "/exports/runs/1/data.rdf" || got.query != "x-id=PutObject" {
+		t.Errorf("request = %s %s?%s, want PUT /exports/runs/1/data.rdf", got.method, got.path, got.query)
+	}
+	if got.body != content {
+		t.Errorf("body = %q", got.body)
+	}
+	if !strings.HasPrefix(got.auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") || !strings.Contains(got.auth, "/eu-west-1/s3/aws4_request") {
+		t.Errorf("Authorization = %q", got.auth)
+	}
+	// Plain HTTP does not protect the body, so the signature covers it
+	sum := sha256.Sum256([]byte(content))
+	if got.payloadHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("X-Amz-Content-Sha256 = %q, want the body's hash", got.payloadHash)
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	const partSize = 5 << 20
+	content := strings.Repeat("0123456789", (2*partSize+partSize/5)/10)
+	completed := `<CompleteMultipartUploadResult><ETag>"final"</ETag></CompleteMultipartUploadResult>`
+	tests := []struct {
+		name         string
+		failPart     string
+		completeBody string
+		errText      string
+		completes    bool
+		aborts       bool
+	}{
+		{name: "parts are completed in order", completeBody: completed, completes: true},
+		{name: "a failed part aborts the upload", failPart: "2", errText: "InternalError", aborts: true},
+		{
+			name:         "an error in a 200 completion fails the upload",
+			completeBody: `<Error><Code>InternalError</Code></Error>`,
+			errText:      "InternalError",
+			completes:    true,
+			aborts:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPartSize(t, partSize)
+			server := &testS3{failPart: tt.failPart, completeBody: tt.completeBody}
+			err := uploadToS3(t, server, content)
+
+			if tt.errText == "" && err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.errText)
+			}
+			calls := server.calls()
+			for _, req := range server.requests {
+				if req.path != "/exports/runs/1/data.rdf" {
+					t.Errorf("%s to %s", req.method, req.path)
+				}
+			}
+			if !slices.Contains(calls, "POST uploads=") {
+				t.Errorf("no multipart upload started in %q", calls)
+			}
+			if got := slices.Contains(calls, "POST uploadId=upload-1"); got != tt.completes {
+				t.Errorf("completed = %v, want %v in %q", got, tt.completes, calls)
+			}
+			if got := slices.Contains(calls, "DELETE uploadId=upload-1&x-id=AbortMultipartUpload"); got != tt.aborts {
+				t.Errorf("aborted = %v, want %v in %q", got, tt.aborts, calls)
+			}
+			if tt.errText != "" {
+				return
+			}
+
+			parts := make(map[string]string)
+			var completion string
+			for _, req := range server.requests {
+				switch {
+				case req.method == http.MethodPut:
+					parts[req.query] = req.body
+				case req.query == "uploadId=upload-1":
+					completion = req.body
+				}
+			}
+			var joined strings.Builder
+			for i := 1; i <= 3; i++ {
+				joined.WriteString(parts[fmt.Sprintf("partNumber=%d&uploadId=upload-1&x-id=UploadPart", i)])
+			}
+			if len(parts) != 3 || joined.String() != content {
+				t.Errorf("%d parts do not add up to the file", len(parts))
+			}
+			var listed struct {
+				Parts []struct {
+					PartNumber int
+					ETag       string
+				} `xml:"Part"`
+			}
+			if err := xml.Unmarshal([]byte(completion), &listed); err != nil {
+				t.Fatal(err)
+			}
+			if len(listed.Parts) != 3 || listed.Parts[2].PartNumber != 3 || listed.Parts[2].ETag != `"etag-3"` {
+				t.Errorf("completion lists %+v", listed.Parts)
+			}
+		})
+	}
+}
+
+func TestS3CredentialProcess(t *testing.T) {
+	isolateAWS(t)
+	dir := t.TempDir()
+	script := filepath.Join(dir, "credentials.sh")
+	output := `{"Version":1,"AccessKeyId":"AKIDPROCESS","SecretAccessKey":"secret","SessionToken":"process-session"}`
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config")
+	if err := os.WriteFile(configFile, []byte("[profile export]\ncredential_process = "+script+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_PROFILE", "export")
+
+	server := &testS3{}
+	if err := uploadWithChain(t, server, "x"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if auth := server.requests[0].auth; !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDPROCESS/") {
+		t.Errorf("Authorization = %q, want the credential_process key", auth)
+	}
+}
+
+func TestS3WebIdentity(t *testing.T) {
+	isolateAWS(t)
+	var assumed []string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assumed = append(assumed, r.PostForm.Get("Action")+" "+r.PostForm.Get("RoleArn")+" "+r.PostForm.Get("WebIdentityToken"))
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>AKIDROLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>role-session</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+	}))
+	t.Cleanup(sts.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("web-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/exporter")
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+
+	server := &testS3{}
+	if err := uploadWithChain(t, server, "x"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	want := []string{"AssumeRoleWithWebIdentity arn:aws:iam::123456789012:role/exporter web-token"}
+	if !slices.Equal(assumed, want) {
+		t.Errorf("STS calls = %q, want %q", assumed, want)
+	}
+	if auth := server.requests[0].auth; !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDROLE/") {
+		t.Errorf("Authorization = %q, want the assumed role's key", auth)
+	}
+}
@@ -0,0 +1,140 @@
+// Package sink stores the exporter's data files on local disk or in object
+// storage. Every file is written to the output directory first; the s3 and
+// gcs sinks upload it under the configured prefix once it is closed, so the
+// phases that read the output back still find it locally and the Dgraph
+// bulk loader can read it from the bucket.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sinks accepted by output.sink
+const (
+	Local = "local"
+	S3    = "s3"
+	GCS   = "gcs"
+)
+
+// Options configure a sink, from the output section of the configuration
+type Options struct {
+	Kind      string // local, s3 or gcs
+	Directory string // Where files are written, and staged before upload
+	Bucket    string // Bucket receiving the files (s3, gcs)
+	Prefix    string // Object name prefix, joined to each file name with "/"
+	Region    string // S3 region (empty = AWS_REGION, AWS_DEFAULT_REGION or the profile's, else us-east-1)
+	Endpoint  string // S3-compatible or GCS API base URL (empty = the provider's)
+}
+
+// Sink creates output files
+type Sink interface {
+	// Create opens name in the output directory for writing, truncating it
+	// or, with appending set, keeping what it holds. The file is stored
+	// once the writer is closed.
+	Create(name string, appending bool) (io.WriteCloser, error)
+}
+
+// uploadTimeout bounds each request of an upload
+const uploadTimeout = 30 * time.Minute
+
+// uploader copies a closed file to object storage
+type uploader interface {
+	upload(localPath, key string) error
+	location(key string) string
+}
+
+// New returns the sink for opts. An unknown kind is treated as local;
+// configuration validation rejects it first.
+func New(opts Options) Sink {
+	switch opts.Kind {
+	case S3:
+		return &remoteSink{opts: opts, uploader: newS3Uploader(opts, uploadTimeout)}
+	case GCS:
+		return &remoteSink{opts: opts, uploader: newGCSUploader(opts, &http.Client{Timeout: uploadTimeout})}
+	}
+	return &localSink{directory: opts.Directory}
+}
+
+// localSink writes files to the output directory only
+type localSink struct {
+	directory string
+}
+
+func (s *localSink) Create(name string, appending bool) (io.WriteCloser, error) {
+	return createFile(filepath.Join(s.directory, name), appending)
+}
+
+// remoteSink stages files in the output directory and uploads them on close
+type remoteSink struct {
+	opts     Options
+	uploader uploader
+}
+
+func (s *remoteSink) Create(name string, appending bool) (io.WriteCloser, error) {
+	localPath := filepath.Join(s.opts.Directory, name)
+	file, err := createFile(localPath, appending)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadingFile{File: file, uploader: s.uploader, key: objectKey(s.opts.Prefix, name)}, nil
+}
+
+// uploadingFile uploads the file it wraps once it is closed
+type uploadingFile struct {
+	*os.File
+	uploader uploader
+	key      string
+}
+
+func (f *uploadingFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if err := f.uploader.upload(f.Name(), f.key); err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %w", f.Name(), f.uploader.location(f.key), err)
+	}
+	return nil
+}
+
+// createFile creates path, or opens it for appending
+func createFile(path string, appending bool) (*os.File, error) {
+	if appending {
+		return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	return os.Create(path)
+}
+
+// objectKey joins the prefix and a file name into an object name
+func objectKey(prefix, name string) string {
+	return strings.TrimPrefix(path.Join(prefix, filepath.ToSlash(name)), "/")
+}
+
+// requestError is a storage API request that returned a failure status
+type requestError struct {
+	Method string
+	URL    string
+	Status int
+	Body   string
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("%s %s returned status %d: %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+// statusError describes a failed storage API request
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &requestError{
+		Method: resp.Request.Method,
+		URL:    resp.Request.URL.Redacted(),
+		Status: resp.StatusCode,
+		Body:   strings.TrimSpace(string(body)),
+	}
+}
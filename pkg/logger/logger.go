@@ -4,6 +4,8 @@ package logger
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,6 +13,40 @@ import (
 // Logger wraps logrus.Logger with additional convenience methods for structured logging
 type Logger struct {
 	*logrus.Logger
+
+	closer io.Closer // Log file opened by NewWithOutput, nil for standard streams
+}
+
+// NewWithOutput creates a logger writing to output: "stdout", "stderr" (also
+// used when empty) or a file path, which is opened for appending. Files are
+// rotated once they exceed maxSizeMB, keeping maxBackups old files; 0
+// disables rotation.
+func NewWithOutput(level, format, output string, maxSizeMB, maxBackups int) (*Logger, error) {
+	l := New(level, format)
+
+	switch output {
+	case "stdout":
+		l.SetOutput(os.Stdout)
+	case "", "stderr":
+		l.SetOutput(os.Stderr)
+	default:
+		file, err := openRotatingFile(output, int64(maxSizeMB)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		l.SetOutput(file)
+		l.closer = file
+	}
+
+	return l, nil
+}
+
+// Close closes the log file, if the logger writes to one
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
 }
 
 // New creates a new logger instance with specified level and format
@@ -55,6 +91,16 @@ func (l *Logger) Fatal(msg string, args ...interface{}) {
 	}
 }
 
+// FatalWithCleanup runs cleanup, such as closing connections and flushing
+// output, then logs like Fatal and exits. Fatal alone exits immediately and
+// skips deferred calls.
+func (l *Logger) FatalWithCleanup(cleanup func(), msg string, args ...interface{}) {
+	if cleanup != nil {
+		cleanup()
+	}
+	l.Fatal(msg, args...)
+}
+
 // Error logs an error message with optional structured fields
 func (l *Logger) Error(msg string, args ...interface{}) {
 	if len(args) > 0 {
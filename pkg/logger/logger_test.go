@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewWithOutputFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		check  func(t *testing.T, line string)
+	}{
+		{"text", "text", func(t *testing.T, line string) {
+			if !strings.Contains(line, "level=info") || !strings.Contains(line, `msg="table exported"`) ||
+				!strings.Contains(line, "rows=42") {
+				t.Errorf("text line = %q", line)
+			}
+		}},
+		{"json", "json", func(t *testing.T, line string) {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("json line %q: %v", line, err)
+			}
+			if entry["msg"] != "table exported" || entry["rows"] != float64(42) {
+				t.Errorf("json entry = %v", entry)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pipeline.log")
+			// Earlier runs' lines are kept
+			if err := os.WriteFile(path, []byte("previous run\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := NewWithOutput("info", tt.format, path, 0, 0)
+			if err != nil {
+				t.Fatalf("NewWithOutput: %v", err)
+			}
+			l.Debug("below the level")
+			l.Info("table exported", "rows", 42)
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != 2 || lines[0] != "previous run" {
+				t.Fatalf("log file = %q, want the previous line and one entry", data)
+			}
+			tt.check(t, lines[1])
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm&^0644 != 0 {
+				t.Errorf("log file mode = %v, want at most 0644", perm)
+			}
+		})
+	}
+}
+
+func TestNewWithOutputStreams(t *testing.T) {
+	tests := []struct {
+		output string
+		want   *os.File
+	}{
+		{"stdout", os.Stdout},
+		{"stderr", os.Stderr},
+		{"", os.Stderr},
+	}
+	for _, tt := range tests {
+		l, err := NewWithOutput("info", "text", tt.output, 10, 1)
+		if err != nil {
+			t.Fatalf("NewWithOutput(%q): %v", tt.output, err)
+		}
+		if l.Out != tt.want {
+			t.Errorf("NewWithOutput(%q) writes to %v, want %v", tt.output, l.Out, tt.want.Name())
+		}
+		if err := l.Close(); err != nil {
+			t.Errorf("Close on %q: %v", tt.output, err)
+		}
+	}
+}
+
+func TestNewWithOutputUnopenable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "pipeline.log")
+	l, err := NewWithOutput("info", "text", path, 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "failed to open log file") {
+		t.Errorf("NewWithOutput(%q) = %v, %v, want an open error", path, l, err)
+	}
+}
+
+// TestFatalWithCleanup checks buffered output is flushed by the cleanup
+// before the fatal entry is logged and the process exits
+func TestFatalWithCleanup(t *testing.T) {
+	var logged, output strings.Builder
+	l := New("info", "text")
+	l.SetOutput(&logged)
+
+	pending := bufio.NewWriter(&output)
+	pending.WriteString("_:users_1 <users.name> \"Ada\" .\n")
+
+	var events []string
+	l.ExitFunc = func(code int) {
+		events = append(events, fmt.Sprintf("exit %d", code))
+	}
+	l.FatalWithCleanup(func() {
+		pending.Flush()
+		events = append(events, "cleanup")
+		if logged.Len() > 0 {
+			t.Error("fatal entry logged before the cleanup ran")
+		}
+	}, "Pipeline execution failed", "error", "boom")
+
+	if output.String() != "_:users_1 <users.name> \"Ada\" .\n" {
+		t.Errorf("output = %q, want the buffered triple", output.String())
+	}
+	if !slices.Equal(events, []string{"cleanup", "exit 1"}) {
+		t.Errorf("events = %v, want cleanup then exit 1", events)
+	}
+	if !strings.Contains(logged.String(), "level=fatal") || !strings.Contains(logged.String(), "error=boom") {
+		t.Errorf("logged %q", logged.String())
+	}
+
+	// A nil cleanup only exits
+	events = nil
+	l.FatalWithCleanup(nil, "failed")
+	if !slices.Equal(events, []string{"exit 1"}) {
+		t.Errorf("events = %v, want exit 1", events)
+	}
+}
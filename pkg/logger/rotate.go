@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an append-only log file that is renamed to path.1 once it
+// grows past maxSize bytes. Older backups shift to path.2 and so on; the
+// oldest beyond maxBackups is removed. A maxSize of 0 never rotates.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File // Nil only when a rotation could not reopen path
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends one log entry, rotating first if the entry would push the
+// file past its size limit. An entry is still written when the rotation
+// fails, and the failure is returned with it.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	var rotateErr error
+	if rf.file == nil || rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		rotateErr = rf.rotate()
+		if rf.file == nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", rf.path, rotateErr)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("failed to rotate %s: %w", rf.path, rotateErr)
+	}
+	return n, err
+}
+
+// rotate moves the file aside and opens path again, which is then new, or
+// the old file if it could not be moved
+func (rf *rotatingFile) rotate() error {
+	var closeErr error
+	if rf.file != nil {
+		closeErr = rf.file.Close()
+		rf.file = nil
+	}
+	moveErr := rf.moveAside()
+	return errors.Join(closeErr, moveErr, rf.open())
+}
+
+// moveAside renames the file to path.1 after shifting older backups along,
+// or removes it when no backups are kept. It stops at the first backup it
+// cannot move, so none is overwritten.
+func (rf *rotatingFile) moveAside() error {
+	if rf.maxBackups == 0 {
+		return os.Remove(rf.path)
+	}
+	if err := os.Remove(rf.backup(rf.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(rf.backup(i), rf.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(rf.path, rf.backup(1))
+}
+
+func (rf *rotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", rf.path, n)
+}
+
+// Close closes the current file
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
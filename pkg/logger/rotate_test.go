@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	// Each entry is 10 bytes
+	entry := func(i int) string { return fmt.Sprintf("entry %03d\n", i) }
+	tests := []struct {
+		name       string
+		maxSize    int64
+		maxBackups int
+		entries    int
+		want       []string // Contents of path, path.1, path.2...
+	}{
+		{
+			name:    "no rotation",
+			entries: 5,
+			want:    []string{entry(0) + entry(1) + entry(2) + entry(3) + entry(4)},
+		},
+		{
+			name:       "under the limit",
+			maxSize:    30,
+			maxBackups: 2,
+			entries:    3,
+			want:       []string{entry(0) + entry(1) + entry(2)},
+		},
+		{
+			name:       "rotates past the limit",
+			maxSize:    25,
+			maxBackups: 2,
+			entries:    5,
+			want:       []string{entry(4), entry(2) + entry(3), entry(0) + entry(1)},
+		},
+		{
+			name:       "oldest backup is dropped",
+			maxSize:    20,
+			maxBackups: 2,
+			entries:    7,
+			want:       []string{entry(6), entry(4) + entry(5), entry(2) + entry(3)},
+		},
+		{
+			name:       "no backups",
+			maxSize:    20,
+			maxBackups: 0,
+			entries:    5,
+			want:       []string{entry(4)},
+		},
+		{
+			name:       "entry larger than the limit",
+			maxSize:    5,
+			maxBackups: 1,
+			entries:    2,
+			want:       []string{entry(1), entry(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pipeline.log")
+			rf, err := openRotatingFile(path, tt.maxSize, tt.maxBackups)
+			if err != nil {
+				t.Fatalf("openRotatingFile: %v", err)
+			}
+			for i := 0; i < tt.entries; i++ {
+				if n, err := rf.Write([]byte(entry(i))); err != nil || n != len(entry(i)) {
+					t.Fatalf("Write(%d) = %d, %v", i, n, err)
+				}
+			}
+			if err := rf.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			for i, want := range tt.want {
+				name := path
+				if i > 0 {
+					name = fmt.Sprintf("%s.%d", path, i)
+				}
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("read %s: %v", filepath.Base(name), err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+				}
+			}
+			extra := fmt.Sprintf("%s.%d", path, len(tt.want))
+			if _, err := os.Stat(extra); err == nil {
+				t.Errorf("%s exists beyond max_backups", filepath.Base(extra))
+			}
+		})
+	}
+}
+
+// TestRotatingFileFailedRotation checks a rotation that cannot move the file
+// aside reports it, keeps the backup in the way and goes on writing entries
+func TestRotatingFileFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.log")
+	// A directory holding a file can neither be removed nor replaced
+	if err := os.MkdirAll(filepath.Join(path+".1", "kept"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := openRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	entries := []string{"first entry\n", "second entry\n", "third entry\n"}
+	for i, entry := range entries {
+		n, err := rf.Write([]byte(entry))
+		if n != len(entry) {
+			t.Fatalf("Write(%d) = %d, %v", i, n, err)
+		}
+		if rotates := i > 0; (err != nil) != rotates || rotates && !strings.Contains(err.Error(), "failed to rotate") {
+			t.Errorf("Write(%d) error = %v, want a rotation error: %v", i, err, rotates)
+		}
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != strings.Join(entries, "") {
+		t.Errorf("pipeline.log = %q, want every entry", data)
+	}
+	if _, err := os.Stat(filepath.Join(path+".1", "kept")); err != nil {
+		t.Errorf("backup in the way was touched: %v", err)
+	}
+}
+
+// TestRotatingFileResumesSize checks an existing file's size counts toward
+// the limit when it is reopened
+func TestRotatingFileResumesSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 18)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := openRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	rf.Close()
+
+	if data, _ := os.ReadFile(path); string(data) != "next\n" {
+		t.Errorf("pipeline.log = %q, want only the new entry", data)
+	}
+	if data, _ := os.ReadFile(path + ".1"); len(data) != 19 {
+		t.Errorf("pipeline.log.1 = %q, want the earlier contents", data)
+	}
+}
@@ -0,0 +1,149 @@
+package pipeline_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/pipeline"
+)
+
+// memDB is a read-only database/sql driver holding one users table, answering
+// the information_schema queries of the schema extractor and the row pages of
+// the data phase
+type memDB struct{}
+
+var users = [][]driver.Value{
+	{int64(1), "Ada"},
+	{int64(2), "Grace"},
+	{int64(3), nil},
+}
+
+func (memDB) Connect(context.Context) (driver.Conn, error) { return memConn{}, nil }
+func (memDB) Driver() driver.Driver                        { return memDriver{} }
+
+type memDriver struct{}
+
+func (memDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("memory driver is only opened through a connector")
+}
+
+type memConn struct{}
+
+func (memConn) Prepare(query string) (driver.Stmt, error) { return memStmt(query), nil }
+func (memConn) Close() error                              { return nil }
+func (memConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("memory database has no transactions")
+}
+
+func (memConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.Contains(query, "table_type IN"):
+		return &memRows{columns: []string{"table_name"}, rows: [][]driver.Value{{"users"}}}, nil
+	case strings.Contains(query, "information_schema.columns"):
+		return &memRows{
+			columns: []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "auto_increment",
+				"column_comment", "ordinal_position", "collation_name", "extra", "generation_expression"},
+			rows: [][]driver.Value{
+				{"id", "int", "int", "NO", "", int64(1), "", int64(1), "", "auto_increment", ""},
+				{"name", "varchar", "varchar(50)", "YES", "", int64(0), "", int64(2), "utf8mb4_general_ci", "", ""},
+			},
+		}, nil
+	case strings.Contains(query, "constraint_name = 'PRIMARY'"):
+		return &memRows{columns: []string{"column_name"}, rows: [][]driver.Value{{"id"}}}, nil
+	case strings.Contains(query, "SELECT engine"):
+		return &memRows{columns: []string{"engine"}, rows: [][]driver.Value{{"InnoDB"}}}, nil
+	case strings.Contains(query, "information_schema"):
+		// No partitions, foreign keys or indexes
+		return &memRows{}, nil
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM `users`"):
+		return &memRows{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(len(users))}}}, nil
+	case strings.HasPrefix(query, "SELECT `id`, `name` FROM `users` LIMIT ? OFFSET ?"):
+		// Every row fits in the first page
+		if offset := args[1].Value.(int64); offset > 0 {
+			return &memRows{columns: []string{"id", "name"}}, nil
+		}
+		return &memRows{columns: []string{"id", "name"}, rows: users}, nil
+	}
+	return nil, fmt.Errorf("memory database has no answer for %q", query)
+}
+
+type memStmt string
+
+func (s memStmt) Close() error  { return nil }
+func (s memStmt) NumInput() int { return -1 }
+func (s memStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("memory database is read-only")
+}
+func (s memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return memConn{}.QueryContext(context.Background(), string(s), named)
+}
+
+type memRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+func (r *memRows) Close() error      { return nil }
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// ExampleNewWithDB runs a full migration of an in-memory database and reads
+// what it did from the result
+func ExampleNewWithDB() {
+	dir, err := os.MkdirTemp("", "pipeline-example")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := pipeline.DefaultConfig()
+	cfg.MySQL.Database = "shop"
+	cfg.Output.Directory = dir
+
+	p, err := pipeline.NewWithDB(cfg, logger.New("error", "text"), sql.OpenDB(memDB{}))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer p.Stop()
+
+	result, err := p.Run(context.Background(), pipeline.ModeFull, pipeline.RunOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("mode:", result.Mode)
+	fmt.Println("tables:", result.Tables)
+	fmt.Println("rows:", result.ProcessedRows, "errors:", result.Errors)
+	fmt.Println("skipped:", result.Skipped["users"][pipeline.SkipReason("null_value")])
+	for _, path := range result.OutputFiles {
+		fmt.Println("wrote", filepath.Base(path))
+	}
+	// Output:
+	// mode: full
+	// tables: [users]
+	// rows: 3 errors: 0
+	// skipped: 1
+	// wrote schema.txt
+	// wrote data.rdf
+	// wrote uid_mapping.txt
+}
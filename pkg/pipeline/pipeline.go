@@ -0,0 +1,91 @@
+// Package pipeline embeds the MySQL to Dgraph migration in other Go programs.
+// It exposes the pipeline, its configuration and run results from the
+// module's internal packages, which cannot be imported from outside it.
+//
+//	cfg, err := pipeline.LoadConfig("config/config.yaml")
+//	...
+//	p, err := pipeline.New(cfg, logger.New("info", "json"))
+//	...
+//	defer p.Stop()
+//	result, err := p.Run(ctx, pipeline.ModeFull, pipeline.RunOptions{Tables: []string{"users"}})
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/config"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/internal/pipeline"
+	"github.com/shahariaz/mysql_to_dgraph_pipeline/pkg/logger"
+)
+
+type (
+	// Config is the pipeline configuration, as read from config.yaml
+	Config = config.Config
+	// Pipeline runs migrations from MySQL to Dgraph
+	Pipeline = pipeline.Pipeline
+	// RunOptions are the per-run settings of Pipeline.Run
+	RunOptions = pipeline.RunOptions
+	// Result summarizes a run
+	Result = pipeline.Result
+	// SkipReason is why values or rows counted in Result.Skipped were not emitted
+	SkipReason = pipeline.SkipReason
+	// ChunkInfo describes a chunk file written when output.chunk_size is set
+	ChunkInfo = pipeline.ChunkInfo
+	// SchemaDiff is the result of schema-diff mode
+	SchemaDiff = pipeline.SchemaDiff
+	// AnalysisReport is the result of analyze mode
+	AnalysisReport = pipeline.AnalysisReport
+	// RelationshipDiscovery is the result of discover-relationships mode
+	RelationshipDiscovery = pipeline.RelationshipDiscovery
+	// PreflightReport is the result of Preflight
+	PreflightReport = pipeline.PreflightReport
+	// PreflightCheck is one check of a PreflightReport
+	PreflightCheck = pipeline.PreflightCheck
+)
+
+// Pipeline modes accepted by Pipeline.Run
+const (
+	ModeSchema                = pipeline.ModeSchema
+	ModeData                  = pipeline.ModeData
+	ModeFull                  = pipeline.ModeFull
+	ModeValidate              = pipeline.ModeValidate
+	ModeRelationshipsObserved = pipeline.ModeRelationshipsObserved
+	ModeSchemaDiff            = pipeline.ModeSchemaDiff
+	ModeAnalyze               = pipeline.ModeAnalyze
+	ModeDiscoverRelationships = pipeline.ModeDiscoverRelationships
+)
+
+// LoadConfig reads a YAML configuration file over the defaults, applies
+// environment overrides and validates the result
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// New validates the configuration and connects to MySQL
+func New(cfg *Config, logger *logger.Logger) (*Pipeline, error) {
+	return pipeline.New(cfg, logger)
+}
+
+// NewWithDB validates the configuration and runs the pipeline over an open
+// database instead of connecting to mysql.host. Stop closes db.
+func NewWithDB(cfg *Config, logger *logger.Logger, db *sql.DB) (*Pipeline, error) {
+	return pipeline.NewWithDB(cfg, logger, db)
+}
+
+// ValidateRDF checks the RDF output against the generated schema file
+// without connecting to MySQL or Dgraph
+func ValidateRDF(cfg *Config, logger *logger.Logger) error {
+	return pipeline.ValidateRDF(cfg, logger)
+}
+
+// Preflight checks that MySQL and Dgraph are reachable with the configured
+// credentials and TLS and that the output directory is writable
+func Preflight(ctx context.Context, cfg *Config, logger *logger.Logger) *PreflightReport {
+	return pipeline.Preflight(ctx, cfg, logger)
+}